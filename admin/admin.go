@@ -0,0 +1,272 @@
+// Package admin is a read-only HTTP API over a store's namespace, to back an ops UI. Mount
+// it under a prefix with http.StripPrefix:
+//
+//	http.Handle("/admin/", http.StripPrefix("/admin", admin.New(store, stream.Events)))
+//
+// It serves:
+//
+//	GET /entities?limit=50&cursor=...   IDs of the entities in the namespace
+//	GET /entities/{id}                  current state of the entity
+//	GET /entities/{id}/history          state history, if the store persists it
+//	GET /entities/{id}/events           inbound and outbound events, filtered by ?kind= and ?type=
+//	GET /undispatched?olderThan=5m      outbound events that haven't been sent, see TRACK_DISPATCH
+//	GET /types                          event types registered in the registry
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/a-h/stream"
+	"go.uber.org/zap"
+)
+
+// Store is the subset of stream.DynamoDBStore used by the Handler.
+type Store interface {
+	ListEntities(ctx context.Context, limit int, cursor string) (ids []string, next string, err error)
+	ExportRecords(ctx context.Context, id string, opts ...stream.ExportOption) (records []stream.ExportRecord, err error)
+	Undispatched(ctx context.Context, olderThan time.Duration) (undispatched []stream.UndispatchedEvent, err error)
+}
+
+// Handler serves the admin API.
+type Handler struct {
+	Store    Store
+	Registry *stream.Registry
+	// DefaultLimit is the number of entities listed if the request doesn't set a limit.
+	// Defaults to 50.
+	DefaultLimit int
+	// MaxLimit is the maximum number of entities listed by a request. Defaults to 1000.
+	MaxLimit int
+	// Redact lists fields to remove from every record, in addition to the fields listed by
+	// outbound events that implement stream.Redactor.
+	Redact []string
+	Log    *zap.Logger
+}
+
+// Option configures the Handler.
+type Option func(*Handler)
+
+// WithRedact removes the fields from every record, e.g. personal data that operators
+// shouldn't see. Nested fields are separated with a dot.
+func WithRedact(fields ...string) Option {
+	return func(h *Handler) {
+		h.Redact = append(h.Redact, fields...)
+	}
+}
+
+// WithLimits sets the default and maximum number of entities listed by a request.
+func WithLimits(defaultLimit, maxLimit int) Option {
+	return func(h *Handler) {
+		h.DefaultLimit = defaultLimit
+		h.MaxLimit = maxLimit
+	}
+}
+
+// WithLogger sets the logger used to log unexpected errors.
+func WithLogger(log *zap.Logger) Option {
+	return func(h *Handler) {
+		h.Log = log
+	}
+}
+
+// New creates a read-only admin API over the store. The registry lists the event types
+// served by /types. If it's nil, stream.Events is used.
+func New(store Store, registry *stream.Registry, opts ...Option) *Handler {
+	if registry == nil {
+		registry = stream.Events
+	}
+	h := &Handler{
+		Store:        store,
+		Registry:     registry,
+		DefaultLimit: 50,
+		MaxLimit:     1000,
+		Log:          zap.NewNop(),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// EntityList is the response of /entities.
+type EntityList struct {
+	IDs  []string `json:"ids"`
+	Next string   `json:"next,omitempty"`
+}
+
+// EventTypes is the response of /types.
+type EventTypes struct {
+	Inbound  []EventType `json:"inbound"`
+	Outbound []EventType `json:"outbound"`
+}
+
+// EventType is an event registered in the registry, and the Go type it's read into.
+type EventType struct {
+	Name   string `json:"name"`
+	GoType string `json:"goType"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		h.writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(segments) == 1 && segments[0] == "entities":
+		h.listEntities(w, r)
+	case len(segments) == 2 && segments[0] == "entities":
+		h.getState(w, r, segments[1])
+	case len(segments) == 3 && segments[0] == "entities" && segments[2] == "history":
+		h.getRecords(w, r, segments[1], func(rec stream.ExportRecord) bool {
+			return rec.Kind == stream.ExportKindHistory
+		})
+	case len(segments) == 3 && segments[0] == "entities" && segments[2] == "events":
+		h.getRecords(w, r, segments[1], eventFilter(r))
+	case len(segments) == 1 && segments[0] == "undispatched":
+		h.listUndispatched(w, r)
+	case len(segments) == 1 && segments[0] == "types":
+		h.writeJSON(w, http.StatusOK, h.eventTypes())
+	default:
+		h.writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (h *Handler) listEntities(w http.ResponseWriter, r *http.Request) {
+	limit := h.DefaultLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		var err error
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit <= 0 {
+			h.writeError(w, http.StatusBadRequest, errors.New("limit must be a positive integer"))
+			return
+		}
+	}
+	if limit > h.MaxLimit {
+		limit = h.MaxLimit
+	}
+	ids, next, err := h.Store.ListEntities(r.Context(), limit, r.URL.Query().Get("cursor"))
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+	h.writeJSON(w, http.StatusOK, EntityList{IDs: ids, Next: next})
+}
+
+func (h *Handler) listUndispatched(w http.ResponseWriter, r *http.Request) {
+	olderThan := time.Minute
+	if s := r.URL.Query().Get("olderThan"); s != "" {
+		var err error
+		olderThan, err = time.ParseDuration(s)
+		if err != nil || olderThan < 0 {
+			h.writeError(w, http.StatusBadRequest, errors.New("olderThan must be a duration, e.g. 5m"))
+			return
+		}
+	}
+	undispatched, err := h.Store.Undispatched(r.Context(), olderThan)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	if undispatched == nil {
+		undispatched = []stream.UndispatchedEvent{}
+	}
+	h.writeJSON(w, http.StatusOK, undispatched)
+}
+
+func (h *Handler) getState(w http.ResponseWriter, r *http.Request, id string) {
+	records, err := h.exportRecords(r.Context(), id)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	for _, rec := range records {
+		if rec.Kind == stream.ExportKindState {
+			h.writeJSON(w, http.StatusOK, rec)
+			return
+		}
+	}
+	h.writeError(w, http.StatusNotFound, stream.ErrStateNotFound)
+}
+
+func (h *Handler) getRecords(w http.ResponseWriter, r *http.Request, id string, include func(stream.ExportRecord) bool) {
+	records, err := h.exportRecords(r.Context(), id)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	filtered := []stream.ExportRecord{}
+	for _, rec := range records {
+		if include(rec) {
+			filtered = append(filtered, rec)
+		}
+	}
+	h.writeJSON(w, http.StatusOK, filtered)
+}
+
+func (h *Handler) exportRecords(ctx context.Context, id string) ([]stream.ExportRecord, error) {
+	return h.Store.ExportRecords(ctx, id, stream.ExportRedact(h.Redact...), stream.ExportApplyRedactors(true))
+}
+
+// eventFilter includes the inbound, outbound and annotation records that match the kind
+// and type query parameters.
+func eventFilter(r *http.Request) func(stream.ExportRecord) bool {
+	kind, typ := r.URL.Query().Get("kind"), r.URL.Query().Get("type")
+	return func(rec stream.ExportRecord) bool {
+		switch rec.Kind {
+		case stream.ExportKindInbound, stream.ExportKindOutbound, stream.ExportKindAnnotation:
+		default:
+			return false
+		}
+		return (kind == "" || rec.Kind == kind) && (typ == "" || rec.Type == typ)
+	}
+}
+
+func (h *Handler) eventTypes() (et EventTypes) {
+	et.Inbound = []EventType{}
+	for name, t := range h.Registry.Inbound.Types() {
+		et.Inbound = append(et.Inbound, EventType{Name: name, GoType: t.String()})
+	}
+	et.Outbound = []EventType{}
+	for name, t := range h.Registry.Outbound.Types() {
+		et.Outbound = append(et.Outbound, EventType{Name: name, GoType: t.String()})
+	}
+	sort.Slice(et.Inbound, func(i, j int) bool { return et.Inbound[i].Name < et.Inbound[j].Name })
+	sort.Slice(et.Outbound, func(i, j int) bool { return et.Outbound[i].Name < et.Outbound[j].Name })
+	return
+}
+
+func (h *Handler) writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, stream.ErrStateNotFound) {
+		h.writeError(w, http.StatusNotFound, err)
+		return
+	}
+	h.Log.Error("admin: store error", zap.Error(err))
+	h.writeError(w, http.StatusInternalServerError, errors.New("internal server error"))
+}
+
+func (h *Handler) writeError(w http.ResponseWriter, status int, err error) {
+	h.writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func (h *Handler) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.Log.Warn("admin: failed to write response", zap.Error(err))
+	}
+}
@@ -0,0 +1,219 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/a-h/stream"
+	"github.com/google/go-cmp/cmp"
+)
+
+type memoryStore struct {
+	ids     []string
+	records map[string][]stream.ExportRecord
+	// opts are the export options of the latest call.
+	opts stream.ExportOptions
+}
+
+func (s *memoryStore) ListEntities(_ context.Context, limit int, cursor string) (ids []string, next string, err error) {
+	start := 0
+	if cursor != "" {
+		for i, id := range s.ids {
+			if id == cursor {
+				start = i + 1
+			}
+		}
+	}
+	end := start + limit
+	if end >= len(s.ids) {
+		return s.ids[start:], "", nil
+	}
+	return s.ids[start:end], s.ids[end-1], nil
+}
+
+func (s *memoryStore) ExportRecords(_ context.Context, id string, opts ...stream.ExportOption) (records []stream.ExportRecord, err error) {
+	s.opts = stream.ExportOptions{}
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+	records, ok := s.records[id]
+	if !ok {
+		return nil, stream.ErrStateNotFound
+	}
+	return records, nil
+}
+
+func (s *memoryStore) Undispatched(_ context.Context, olderThan time.Duration) (undispatched []stream.UndispatchedEvent, err error) {
+	if olderThan == time.Minute*5 {
+		undispatched = append(undispatched, stream.UndispatchedEvent{ID: "a", Sequence: 1, Type: "GameWon", Attempts: 2, Error: "throttled"})
+	}
+	return
+}
+
+type PullHandle struct{}
+
+func (PullHandle) EventName() string { return "PullHandle" }
+func (PullHandle) IsInbound()        {}
+
+func newTestStore() *memoryStore {
+	return &memoryStore{
+		ids: []string{"a", "b", "c"},
+		records: map[string][]stream.ExportRecord{
+			"a": {
+				{Kind: stream.ExportKindInbound, Type: "PullHandle", Sequence: 1, Data: map[string]interface{}{}},
+				{Kind: stream.ExportKindOutbound, Type: "GameWon", Sequence: 1, Data: map[string]interface{}{"payout": 5.0}},
+				{Kind: stream.ExportKindState, Type: "SlotMachine", Sequence: 1, Data: map[string]interface{}{"balance": 5.0}},
+				{Kind: stream.ExportKindHistory, Type: "SlotMachine", Sequence: 1, Data: map[string]interface{}{"balance": 5.0}},
+			},
+		},
+	}
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "entities are listed with a cursor",
+			method:         http.MethodGet,
+			path:           "/entities?limit=2",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"ids":["a","b"],"next":"b"}`,
+		},
+		{
+			name:           "the cursor continues the list",
+			method:         http.MethodGet,
+			path:           "/entities?limit=2&cursor=b",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"ids":["c"]}`,
+		},
+		{
+			name:           "invalid limits are rejected",
+			method:         http.MethodGet,
+			path:           "/entities?limit=0",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"limit must be a positive integer"}`,
+		},
+		{
+			name:           "the state of an entity is returned",
+			method:         http.MethodGet,
+			path:           "/entities/a",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"kind":"state","type":"SlotMachine","sequence":1,"data":{"balance":5}}`,
+		},
+		{
+			name:           "missing entities return 404",
+			method:         http.MethodGet,
+			path:           "/entities/missing",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"state not found"}`,
+		},
+		{
+			name:           "the history of an entity is returned",
+			method:         http.MethodGet,
+			path:           "/entities/a/history",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[{"kind":"history","type":"SlotMachine","sequence":1,"data":{"balance":5}}]`,
+		},
+		{
+			name:           "events can be filtered by kind",
+			method:         http.MethodGet,
+			path:           "/entities/a/events?kind=outbound",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[{"kind":"outbound","type":"GameWon","sequence":1,"data":{"payout":5}}]`,
+		},
+		{
+			name:           "events can be filtered by type",
+			method:         http.MethodGet,
+			path:           "/entities/a/events?type=PullHandle",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[{"kind":"inbound","type":"PullHandle","sequence":1,"data":{}}]`,
+		},
+		{
+			name:           "undispatched events are listed",
+			method:         http.MethodGet,
+			path:           "/undispatched?olderThan=5m",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[{"ID":"a","Sequence":1,"Type":"GameWon","Date":"","Attempts":2,"Error":"throttled"}]`,
+		},
+		{
+			name:           "invalid durations are rejected",
+			method:         http.MethodGet,
+			path:           "/undispatched?olderThan=soon",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"olderThan must be a duration, e.g. 5m"}`,
+		},
+		{
+			name:           "registered event types are listed",
+			method:         http.MethodGet,
+			path:           "/types",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"inbound":[{"name":"PullHandle","goType":"admin.PullHandle"}],"outbound":[]}`,
+		},
+		{
+			name:           "the API is read-only",
+			method:         http.MethodPost,
+			path:           "/entities/a",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedBody:   `{"error":"method not allowed"}`,
+		},
+		{
+			name:           "unknown paths return 404",
+			method:         http.MethodGet,
+			path:           "/entities/a/unknown",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"not found"}`,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			registry := stream.NewRegistry()
+			stream.Register[PullHandle](registry.Inbound)
+			h := New(newTestStore(), registry)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(test.method, test.path, nil)
+
+			// Act.
+			h.ServeHTTP(w, r)
+
+			// Assert.
+			if w.Code != test.expectedStatus {
+				t.Errorf("expected status %d, got %d", test.expectedStatus, w.Code)
+			}
+			if diff := cmp.Diff(test.expectedBody+"\n", w.Body.String()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestHandlerRedactsRecords(t *testing.T) {
+	// Arrange.
+	store := newTestStore()
+	h := New(store, nil, WithRedact("email"))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/entities/a", nil)
+
+	// Act.
+	h.ServeHTTP(w, r)
+
+	// Assert.
+	var rec stream.ExportRecord
+	if err := json.Unmarshal(w.Body.Bytes(), &rec); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	expected := stream.ExportOptions{Redact: []string{"email"}, ApplyRedactors: true}
+	if diff := cmp.Diff(expected, store.opts); diff != "" {
+		t.Error(diff)
+	}
+}
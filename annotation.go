@@ -0,0 +1,190 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrEventNotFound is returned by Annotate if the entity has no event with the ID.
+var ErrEventNotFound = errors.New("event not found")
+
+// Annotation is a note attached to a stored inbound or outbound event after the fact, e.g.
+// "this payout was reversed by support ticket X". Events are immutable, so annotations
+// are stored as separate records.
+type Annotation struct {
+	// ID of the annotation, set when it's stored.
+	ID string `json:"-" dynamodbav:"-"`
+	// Date the annotation was stored, in RFC3339 format, set when it's stored.
+	Date    string            `json:"-" dynamodbav:"-"`
+	Text    string            `json:"text" dynamodbav:"text"`
+	ActorID string            `json:"actorId,omitempty" dynamodbav:"actorId,omitempty"`
+	Data    map[string]string `json:"data,omitempty" dynamodbav:"data,omitempty"`
+}
+
+// Envelope is an inbound or outbound event, with the library's attributes of its record,
+// and its annotations.
+type Envelope struct {
+	// EventID is the unique ID of the event record, see EventID.
+	EventID  string
+	Sequence int64
+	// Inbound is set for inbound events.
+	Inbound InboundEvent
+	// Outbound is set for outbound events.
+	Outbound    OutboundEvent
+	Metadata    EventMetadata
+	Annotations []Annotation
+}
+
+// Annotate attaches the annotation to the entity's event with the event ID, without
+// modifying the event. The annotation's ID is returned.
+func (ddb *DynamoDBStore) Annotate(ctx context.Context, id, eventID string, a Annotation) (annotationID string, err error) {
+	eventSortKey, err := ddb.getEventSortKey(ctx, id, eventID)
+	if err != nil {
+		return
+	}
+	annotationID = ddb.newEventID()
+	record, err := ddb.createAnnotationRecord(id, eventSortKey, annotationID, a)
+	if err != nil {
+		return
+	}
+	items := []types.TransactWriteItem{ddb.createPut(record)}
+	items, err = ddb.encryptItems(ctx, id, items)
+	if err != nil {
+		return
+	}
+	err = ddb.Execute(items)
+	return
+}
+
+func (ddb *DynamoDBStore) createAnnotationRecord(id, eventSortKey, annotationID string, a Annotation) (record map[string]types.AttributeValue, err error) {
+	record, err = ddb.marshalMap(a)
+	if err != nil {
+		err = fmt.Errorf("error marshalling annotation to map: %w", err)
+		return
+	}
+	if record == nil {
+		record = make(map[string]types.AttributeValue)
+	}
+	record["_namespace"] = ddb.attributeValueString(ddb.Namespace)
+	if ddb.Tenant != "" {
+		record["_tenant"] = ddb.attributeValueString(ddb.Tenant)
+	}
+	record["_pk"] = ddb.attributeValueString(ddb.createPartitionKey(id))
+	record["_sk"] = ddb.attributeValueString(ddb.createAnnotationRecordSortKey(eventSortKey, annotationID))
+	record["_typ"] = ddb.attributeValueString("ANNOTATION")
+	record["_id"] = ddb.attributeValueString(annotationID)
+	record["_event"] = ddb.attributeValueString(eventSortKey)
+	record["_ts"] = ddb.attributeValueInteger(ddb.Now().Unix())
+	record["_date"] = ddb.attributeValueString(ddb.Now().Format(time.RFC3339))
+	record["_fmt"] = ddb.attributeValueString(formatVersion())
+	return
+}
+
+// getEventSortKey returns the sort key of the inbound or outbound event record with the ID.
+func (ddb *DynamoDBStore) getEventSortKey(ctx context.Context, id, eventID string) (sk string, err error) {
+	qi := &dynamodb.QueryInput{
+		TableName:              ddb.TableName,
+		ConsistentRead:         aws.Bool(true),
+		KeyConditionExpression: aws.String("#_pk = :_pk"),
+		FilterExpression:       aws.String("#_id = :_id"),
+		ProjectionExpression:   aws.String("#_sk"),
+		ExpressionAttributeNames: map[string]string{
+			"#_pk": "_pk",
+			"#_sk": "_sk",
+			"#_id": "_id",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":_pk": ddb.attributeValueString(ddb.createPartitionKey(id)),
+			":_id": ddb.attributeValueString(eventID),
+		},
+		ReturnConsumedCapacity: ddb.returnConsumedCapacity(),
+	}
+	err = ddb.queryPages(ctx, qi, func(qo *dynamodb.QueryOutput, _ bool) bool {
+		for _, item := range qo.Items {
+			if prefix, _ := ddb.splitSortKey(item); prefix == "INBOUND" || prefix == "OUTBOUND" {
+				sk = stringAttribute(item, "_sk")
+				return false
+			}
+		}
+		return true
+	})
+	if err == nil && sk == "" {
+		err = ErrEventNotFound
+	}
+	return
+}
+
+// QueryEnvelopes returns the entity's inbound and outbound events in the order they were
+// stored, with their annotations.
+func (ddb *DynamoDBStore) QueryEnvelopes(ctx context.Context, id string, inboundEventReader *InboundEventReader, outboundEventReader *OutboundEventReader) (envelopes []Envelope, err error) {
+	inboundEventReader = ddb.inboundEventReader(inboundEventReader)
+	outboundEventReader = ddb.outboundEventReader(outboundEventReader)
+	records, err := ddb.queryRecords(ctx, id)
+	if err != nil {
+		return
+	}
+	var events []map[string]types.AttributeValue
+	annotations := make(map[string][]Annotation)
+	for _, r := range records {
+		prefix, _ := ddb.splitSortKey(r)
+		switch prefix {
+		case "INBOUND", "OUTBOUND":
+			events = append(events, r)
+		case "ANNOTATION":
+			var a Annotation
+			if err = ddb.unmarshalMap(r, &a); err != nil {
+				return
+			}
+			a.ID = stringAttribute(r, "_id")
+			a.Date = stringAttribute(r, "_date")
+			event := stringAttribute(r, "_event")
+			annotations[event] = append(annotations[event], a)
+		}
+	}
+	if err = ddb.sortEventRecords(events); err != nil {
+		return
+	}
+	envelopes = make([]Envelope, len(events))
+	for i, r := range events {
+		e := Envelope{
+			EventID: stringAttribute(r, "_id"),
+			Metadata: EventMetadata{
+				CorrelationID: stringAttribute(r, "_correlationId"),
+				CausationID:   stringAttribute(r, "_causationId"),
+				ActorID:       stringAttribute(r, "_actorId"),
+				FeatureFlags:  getRecordFeatureFlags(r),
+			},
+			Annotations: annotations[stringAttribute(r, "_sk")],
+		}
+		if e.Sequence, err = ddb.getRecordSequenceNumber(r); err != nil {
+			return
+		}
+		var typ string
+		if typ, err = ddb.getRecordType(r); err != nil {
+			return
+		}
+		var ok bool
+		if prefix, _ := ddb.splitSortKey(r); prefix == "INBOUND" {
+			e.Inbound, ok, err = inboundEventReader.Read(typ, r)
+			if err == nil && !ok {
+				err = fmt.Errorf("inbound event: no reader for %q", typ)
+			}
+		} else {
+			e.Outbound, ok, err = outboundEventReader.Read(typ, r)
+			if err == nil && !ok {
+				err = fmt.Errorf("outbound event: no reader for %q", typ)
+			}
+		}
+		if err != nil {
+			return
+		}
+		envelopes[i] = e
+	}
+	return
+}
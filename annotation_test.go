@@ -0,0 +1,101 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAnnotationRecord(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	// Act.
+	r, err := s.createAnnotationRecord("id", "OUTBOUND/1/0/Average", "annotation", Annotation{Text: "reversed by ticket 123"})
+	if err != nil {
+		t.Fatalf("failed to create annotation record: %v", err)
+	}
+
+	// Assert.
+	if diff := cmp.Diff("ANNOTATION/OUTBOUND/1/0/Average/annotation", stringAttribute(r, "_sk")); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff("OUTBOUND/1/0/Average", stringAttribute(r, "_event")); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff("reversed by ticket 123", stringAttribute(r, "text")); diff != "" {
+		t.Error(diff)
+	}
+	if prefix, _ := s.splitSortKey(r); prefix == "INBOUND" || prefix == "OUTBOUND" {
+		t.Error("expected annotations not to be read as events")
+	}
+}
+
+func TestAnnotateIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	// Arrange.
+	name := createLocalTable(t)
+	defer deleteLocalTable(t, name)
+	s, err := NewStore(name, "Average", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	err = s.Put("id", 0, &AverageState{Sum: 1, Count: 1, Value: 1}, []InboundEvent{Add{Number: 1}}, []OutboundEvent{Average{Value: 1}})
+	if err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	inboundEventReader := NewInboundEventReader().Add(Add{}.EventName(), func(item map[string]types.AttributeValue) (InboundEvent, error) {
+		var e Add
+		err := s.Unmarshal(item, &e)
+		return e, err
+	})
+	outboundEventReader := NewOutboundEventReader().Add(Average{}.EventName(), func(item map[string]types.AttributeValue) (OutboundEvent, error) {
+		var e Average
+		err := s.Unmarshal(item, &e)
+		return e, err
+	})
+	envelopes, err := s.QueryEnvelopes(context.Background(), "id", inboundEventReader, outboundEventReader)
+	if err != nil {
+		t.Fatalf("failed to query envelopes: %v", err)
+	}
+	if len(envelopes) != 2 {
+		t.Fatalf("expected 2 envelopes, got %d", len(envelopes))
+	}
+
+	// Act.
+	annotationID, err := s.Annotate(context.Background(), "id", envelopes[1].EventID, Annotation{Text: "reversed by ticket 123", ActorID: "support"})
+	if err != nil {
+		t.Fatalf("failed to annotate: %v", err)
+	}
+	_, notFoundErr := s.Annotate(context.Background(), "id", "unknown", Annotation{Text: "text"})
+	envelopes, err = s.QueryEnvelopes(context.Background(), "id", inboundEventReader, outboundEventReader)
+	if err != nil {
+		t.Fatalf("failed to query envelopes: %v", err)
+	}
+
+	// Assert.
+	if !errors.Is(notFoundErr, ErrEventNotFound) {
+		t.Errorf("expected ErrEventNotFound, got %v", notFoundErr)
+	}
+	if len(envelopes[0].Annotations) != 0 {
+		t.Errorf("expected the inbound event not to be annotated, got %v", envelopes[0].Annotations)
+	}
+	if len(envelopes[1].Annotations) != 1 {
+		t.Fatalf("expected the outbound event to have 1 annotation, got %d", len(envelopes[1].Annotations))
+	}
+	expected := []Annotation{{ID: annotationID, Date: envelopes[1].Annotations[0].Date, Text: "reversed by ticket 123", ActorID: "support"}}
+	if diff := cmp.Diff(expected, envelopes[1].Annotations); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff(Average{Value: 1}, envelopes[1].Outbound); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,233 @@
+package stream
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrChainBroken is returned by VerifyChain if the event log has been modified.
+var ErrChainBroken = errors.New("event hash chain is broken")
+
+// chainItems adds _hash and _prevHash attributes to each inbound and outbound event record,
+// linking each event to its predecessor. The _hash attribute of the STATE record is set to
+// the hash of the latest event, so that the next transaction can continue the chain.
+func (ddb *DynamoDBStore) chainItems(ctx context.Context, id string, atSequence int64, items []types.TransactWriteItem) (err error) {
+	if !ddb.HashChain {
+		return
+	}
+	var prev string
+	if atSequence > 1 {
+		prev, err = ddb.getChainHead(ctx, id)
+		if err != nil {
+			return
+		}
+	}
+	for i := 0; i < len(items); i++ {
+		if items[i].Put == nil {
+			continue
+		}
+		r := items[i].Put.Item
+		prefix, _ := ddb.splitSortKey(r)
+		if prefix != "INBOUND" && prefix != "OUTBOUND" {
+			continue
+		}
+		var hash string
+		hash, err = hashRecord(prev, r)
+		if err != nil {
+			return
+		}
+		r["_prevHash"] = ddb.attributeValueString(prev)
+		r["_hash"] = ddb.attributeValueString(hash)
+		prev = hash
+	}
+	for i := 0; i < len(items); i++ {
+		if items[i].Put != nil {
+			if prefix, _ := ddb.splitSortKey(items[i].Put.Item); prefix == "STATE" {
+				items[i].Put.Item["_hash"] = ddb.attributeValueString(prev)
+			}
+		}
+		if u := items[i].Update; u != nil {
+			u.UpdateExpression = aws.String(strings.Replace(*u.UpdateExpression, "SET ", "SET #_hash = :_hash, ", 1))
+			u.ExpressionAttributeNames["#_hash"] = "_hash"
+			u.ExpressionAttributeValues[":_hash"] = ddb.attributeValueString(prev)
+		}
+	}
+	return
+}
+
+// getChainHead returns the hash of the latest event of the entity.
+func (ddb *DynamoDBStore) getChainHead(ctx context.Context, id string) (hash string, err error) {
+	gio, err := ddb.Client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      ddb.TableName,
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]types.AttributeValue{
+			"_pk": ddb.attributeValueString(ddb.createPartitionKey(id)),
+			"_sk": ddb.attributeValueString(ddb.createStateRecordSortKey()),
+		},
+		ProjectionExpression: aws.String("#_hash"),
+		ExpressionAttributeNames: map[string]string{
+			"#_hash": "_hash",
+		},
+		ReturnConsumedCapacity: ddb.returnConsumedCapacity(),
+	})
+	if err != nil {
+		return
+	}
+	if gio.ConsumedCapacity != nil {
+		ddb.reportCapacity(OperationGet, *gio.ConsumedCapacity)
+	}
+	if v, ok := gio.Item["_hash"].(*types.AttributeValueMemberS); ok {
+		hash = v.Value
+	}
+	return
+}
+
+// hashRecord returns the SHA-256 hash of the previous hash, the record's key, type and
+// sequence, and its payload.
+func hashRecord(prev string, r map[string]types.AttributeValue) (hash string, err error) {
+	payload := make(map[string]types.AttributeValue)
+	for k, v := range r {
+		if !strings.HasPrefix(k, "_") {
+			payload[k] = v
+		}
+	}
+	// Map keys are sorted by the JSON encoder, so the output is stable.
+	payloadJSON, err := marshalAttributeValueMapJSON(payload)
+	if err != nil {
+		return
+	}
+	var pk, sk, typ, seq string
+	if v, ok := r["_pk"].(*types.AttributeValueMemberS); ok {
+		pk = v.Value
+	}
+	if v, ok := r["_sk"].(*types.AttributeValueMemberS); ok {
+		sk = v.Value
+	}
+	if v, ok := r["_typ"].(*types.AttributeValueMemberS); ok {
+		typ = v.Value
+	}
+	if v, ok := r["_seq"].(*types.AttributeValueMemberN); ok {
+		seq = v.Value
+	}
+	h := sha256.New()
+	for _, s := range []string{prev, pk, sk, typ, seq} {
+		h.Write([]byte(s))
+		h.Write([]byte{'\n'})
+	}
+	h.Write(payloadJSON)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyChain recalculates the hash of each of the entity's inbound and outbound events,
+// and returns ErrChainBroken if an event has been modified, removed or added since it was
+// stored. Requires the store to be configured with hash chaining.
+func (ddb *DynamoDBStore) VerifyChain(ctx context.Context, id string) (err error) {
+	records, err := ddb.queryRecords(ctx, id)
+	if err != nil {
+		return
+	}
+	var head string
+	var foundState bool
+	var events []map[string]types.AttributeValue
+	for _, r := range records {
+		prefix, suffix := ddb.splitSortKey(r)
+		switch prefix {
+		case "STATE":
+			if suffix == "" {
+				foundState = true
+				if v, ok := r["_hash"].(*types.AttributeValueMemberS); ok {
+					head = v.Value
+				}
+			}
+		case "INBOUND", "OUTBOUND":
+			events = append(events, r)
+		}
+	}
+	if !foundState {
+		return ErrStateNotFound
+	}
+	err = ddb.sortEventRecords(events)
+	if err != nil {
+		return
+	}
+	var prev string
+	for _, r := range events {
+		_, sk := ddb.splitSortKey(r)
+		var storedPrev, storedHash string
+		if v, ok := r["_prevHash"].(*types.AttributeValueMemberS); ok {
+			storedPrev = v.Value
+		}
+		if v, ok := r["_hash"].(*types.AttributeValueMemberS); ok {
+			storedHash = v.Value
+		}
+		if storedPrev != prev {
+			return fmt.Errorf("%w: %q does not follow the previous event", ErrChainBroken, sk)
+		}
+		var hash string
+		hash, err = hashRecord(prev, r)
+		if err != nil {
+			return
+		}
+		if hash != storedHash {
+			return fmt.Errorf("%w: %q has been modified", ErrChainBroken, sk)
+		}
+		prev = hash
+	}
+	if prev != head {
+		return fmt.Errorf("%w: the latest event does not match the state", ErrChainBroken)
+	}
+	return
+}
+
+// sortEventRecords sorts inbound and outbound records into the order they were chained in.
+// Within each transaction, inbound events are stored before outbound events.
+func (ddb *DynamoDBStore) sortEventRecords(records []map[string]types.AttributeValue) error {
+	type positioned struct {
+		sequence, kind, index int64
+		record                map[string]types.AttributeValue
+	}
+	sorted := make([]positioned, len(records))
+	for i, r := range records {
+		prefix, suffix := ddb.splitSortKey(r)
+		parts := strings.SplitN(suffix, "/", 3)
+		if len(parts) < 2 {
+			return fmt.Errorf("invalid event sort key %q", suffix)
+		}
+		seq, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid event sort key %q: %w", suffix, err)
+		}
+		index, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid event sort key %q: %w", suffix, err)
+		}
+		var kind int64
+		if prefix == "OUTBOUND" {
+			kind = 1
+		}
+		sorted[i] = positioned{sequence: seq, kind: kind, index: index, record: r}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].sequence != sorted[j].sequence {
+			return sorted[i].sequence < sorted[j].sequence
+		}
+		if sorted[i].kind != sorted[j].kind {
+			return sorted[i].kind < sorted[j].kind
+		}
+		return sorted[i].index < sorted[j].index
+	})
+	for i := range sorted {
+		records[i] = sorted[i].record
+	}
+	return nil
+}
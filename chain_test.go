@@ -0,0 +1,108 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestChainItems(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient), WithHashChain(true))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	// Act.
+	items, err := s.Prepare("id", 0, &AverageState{Sum: 1}, []InboundEvent{Add{Number: 1}}, []OutboundEvent{Average{Value: 1}})
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Assert.
+	state, inbound, outbound := items[0].Put.Item, items[1].Put.Item, items[2].Put.Item
+	if v := inbound["_prevHash"].(*types.AttributeValueMemberS).Value; v != "" {
+		t.Errorf("expected the first event to have an empty _prevHash, got %q", v)
+	}
+	if inbound["_hash"].(*types.AttributeValueMemberS).Value != outbound["_prevHash"].(*types.AttributeValueMemberS).Value {
+		t.Error("expected the outbound event to be chained to the inbound event")
+	}
+	if outbound["_hash"].(*types.AttributeValueMemberS).Value != state["_hash"].(*types.AttributeValueMemberS).Value {
+		t.Error("expected the state to contain the hash of the latest event")
+	}
+}
+
+func TestHashRecordDetectsChanges(t *testing.T) {
+	r := map[string]types.AttributeValue{
+		"_pk":    &types.AttributeValueMemberS{Value: "Average/id"},
+		"_sk":    &types.AttributeValueMemberS{Value: "INBOUND/1/0/Add"},
+		"Number": &types.AttributeValueMemberN{Value: "1"},
+	}
+	original, err := hashRecord("", r)
+	if err != nil {
+		t.Fatalf("failed to hash: %v", err)
+	}
+	r["Number"] = &types.AttributeValueMemberN{Value: "2"}
+	modified, err := hashRecord("", r)
+	if err != nil {
+		t.Fatalf("failed to hash: %v", err)
+	}
+	if original == modified {
+		t.Error("expected the hash to change when the payload is modified")
+	}
+}
+
+func TestVerifyChainIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	// Arrange.
+	name := createLocalTable(t)
+	defer deleteLocalTable(t, name)
+	s, err := NewStore(name, "Average", WithRegion(region), WithClient(testClient), WithHashChain(true))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	p, err := New(s, "id", &AverageState{})
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+	if err = p.Process(Add{Number: 1}, Add{Number: 2}); err != nil {
+		t.Fatalf("failed to process events: %v", err)
+	}
+	p, err = Load(s, "id", &AverageState{})
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	if err = p.Process(Subtract{Number: 1}); err != nil {
+		t.Fatalf("failed to process events: %v", err)
+	}
+	if err = s.VerifyChain(context.Background(), "id"); err != nil {
+		t.Fatalf("expected the chain to be valid, got %v", err)
+	}
+
+	// Act.
+	_, err = testClient.UpdateItem(context.Background(), &dynamodb.UpdateItemInput{
+		TableName: aws.String(name),
+		Key: map[string]types.AttributeValue{
+			"_pk": &types.AttributeValueMemberS{Value: "Average/id"},
+			"_sk": &types.AttributeValueMemberS{Value: "INBOUND/1/1/Add"},
+		},
+		UpdateExpression:          aws.String("SET #n = :n"),
+		ExpressionAttributeNames:  map[string]string{"#n": "Number"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":n": &types.AttributeValueMemberN{Value: "200"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to tamper with event: %v", err)
+	}
+
+	// Assert.
+	err = s.VerifyChain(context.Background(), "id")
+	if !errors.Is(err, ErrChainBroken) {
+		t.Errorf("expected ErrChainBroken, got %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// NamespaceClient bundles the store, state constructor, event readers, codec and processor
+// options of a namespace, so that each call site doesn't need to wire them together.
+//
+// Each call binds the store to its context if the store implements ContextStore, so that
+// the store's requests are cancelled with the context.
+type NamespaceClient[T State] struct {
+	// Store of the namespace.
+	Store Store
+	// NewState creates an empty state for the entity. It must return a pointer.
+	NewState func(id string) T
+	// InboundEventReader and OutboundEventReader are used by Query. If they're nil, the
+	// DynamoDBStore uses the readers of its Registry.
+	InboundEventReader  *InboundEventReader
+	OutboundEventReader *OutboundEventReader
+	// Unmarshal decodes the records read by the event readers that don't set their own.
+	// Defaults to the store's Unmarshal method, e.g. DynamoDBStore.Unmarshal, so that events
+	// are read with the codec that they were stored with.
+	Unmarshal func(item map[string]types.AttributeValue, out interface{}) error
+	// ProcessorOptions are applied to every Processor created by the client.
+	ProcessorOptions []ProcessorOption
+}
+
+// NamespaceClientOption configures a NamespaceClient.
+type NamespaceClientOption[T State] func(*NamespaceClient[T])
+
+// WithEventReaders sets the event readers used by Query.
+func WithEventReaders[T State](inbound *InboundEventReader, outbound *OutboundEventReader) NamespaceClientOption[T] {
+	return func(c *NamespaceClient[T]) {
+		c.InboundEventReader = inbound
+		c.OutboundEventReader = outbound
+	}
+}
+
+// WithUnmarshal sets the codec used by the event readers to decode records.
+func WithUnmarshal[T State](unmarshal func(item map[string]types.AttributeValue, out interface{}) error) NamespaceClientOption[T] {
+	return func(c *NamespaceClient[T]) {
+		c.Unmarshal = unmarshal
+	}
+}
+
+// WithProcessorOptions sets the options applied to every Processor created by the client.
+func WithProcessorOptions[T State](opts ...ProcessorOption) NamespaceClientOption[T] {
+	return func(c *NamespaceClient[T]) {
+		c.ProcessorOptions = append(c.ProcessorOptions, opts...)
+	}
+}
+
+// unmarshaler is implemented by stores that decode records with their own codec.
+type unmarshaler interface {
+	Unmarshal(item map[string]types.AttributeValue, out interface{}) error
+}
+
+// NewNamespaceClient creates a client for the namespace of the store.
+func NewNamespaceClient[T State](store Store, newState func(id string) T, opts ...NamespaceClientOption[T]) *NamespaceClient[T] {
+	c := &NamespaceClient[T]{
+		Store:    store,
+		NewState: newState,
+	}
+	if u, ok := store.(unmarshaler); ok {
+		c.Unmarshal = u.Unmarshal
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Get the state of the entity.
+func (c *NamespaceClient[T]) Get(ctx context.Context, id string, opts ...ReadOption) (state T, sequence int64, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	state = c.NewState(id)
+	sequence, err = GetWithOptions(StoreWithContext(ctx, c.Store), id, state, opts...)
+	return
+}
+
+// Load the state of the entity, and return a Processor for it.
+func (c *NamespaceClient[T]) Load(ctx context.Context, id string) (state T, p *Processor, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	state = c.NewState(id)
+	p, err = Load(StoreWithContext(ctx, c.Store), id, state, c.processorOptions(ctx)...)
+	return
+}
+
+// Process the inbound events. If the entity doesn't exist, it's created. Events that fail
+// ValidateEvent are rejected before anything is loaded.
+func (c *NamespaceClient[T]) Process(ctx context.Context, id string, events ...InboundEvent) (state T, err error) {
+	return c.process(ctx, id, true, events)
+}
+
+// Update processes the inbound events of an existing entity. If the entity doesn't exist,
+// ErrStateNotFound is returned.
+func (c *NamespaceClient[T]) Update(ctx context.Context, id string, events ...InboundEvent) (state T, err error) {
+	return c.process(ctx, id, false, events)
+}
+
+func (c *NamespaceClient[T]) process(ctx context.Context, id string, create bool, events []InboundEvent) (state T, err error) {
+	for _, e := range events {
+		if err = ValidateEvent(e); err != nil {
+			return
+		}
+	}
+	state, p, err := c.Load(ctx, id)
+	if errors.Is(err, ErrStateNotFound) && create {
+		state = c.NewState(id)
+		p, err = New(StoreWithContext(ctx, c.Store), id, state, c.processorOptions(ctx)...)
+	}
+	if err != nil {
+		return
+	}
+	err = p.Process(events...)
+	return
+}
+
+// processorOptions returns the ProcessorOptions of the client, with the trace header of
+// the context.
+func (c *NamespaceClient[T]) processorOptions(ctx context.Context) []ProcessorOption {
+	return append(c.ProcessorOptions[:len(c.ProcessorOptions):len(c.ProcessorOptions)], withTraceHeader(ctx))
+}
+
+// withTraceHeader sets the trace header of the metadata from the context, unless it's
+// already set.
+func withTraceHeader(ctx context.Context) ProcessorOption {
+	return func(p *Processor) {
+		if p.metadata.TraceHeader == "" {
+			p.metadata.TraceHeader = TraceHeader(ctx)
+		}
+	}
+}
+
+// Querier is implemented by stores that can return an entity's inbound and outbound events.
+type Querier interface {
+	Query(id string, state State, inboundEventReader *InboundEventReader, outboundEventReader *OutboundEventReader, opts ...ReadOption) (sequence int64, inbound []InboundEvent, outbound []OutboundEvent, err error)
+}
+
+// Query the state, inbound and outbound events of the entity.
+func (c *NamespaceClient[T]) Query(ctx context.Context, id string, opts ...ReadOption) (state T, sequence int64, inbound []InboundEvent, outbound []OutboundEvent, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	q, ok := StoreWithContext(ctx, c.Store).(Querier)
+	if !ok {
+		err = fmt.Errorf("store %T does not support Query", c.Store)
+		return
+	}
+	state = c.NewState(id)
+	sequence, inbound, outbound, err = q.Query(id, state, c.inboundEventReader(), c.outboundEventReader(), opts...)
+	return
+}
+
+// inboundEventReader returns a copy of the client's reader that uses the client's codec,
+// unless the reader sets its own.
+func (c *NamespaceClient[T]) inboundEventReader() *InboundEventReader {
+	if c.InboundEventReader == nil || c.InboundEventReader.Unmarshal != nil || c.Unmarshal == nil {
+		return c.InboundEventReader
+	}
+	r := *c.InboundEventReader
+	r.Unmarshal = c.Unmarshal
+	return &r
+}
+
+// outboundEventReader returns a copy of the client's reader that uses the client's codec,
+// unless the reader sets its own.
+func (c *NamespaceClient[T]) outboundEventReader() *OutboundEventReader {
+	if c.OutboundEventReader == nil || c.OutboundEventReader.Unmarshal != nil || c.Unmarshal == nil {
+		return c.OutboundEventReader
+	}
+	r := *c.OutboundEventReader
+	r.Unmarshal = c.Unmarshal
+	return &r
+}
@@ -0,0 +1,142 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+// putStore records the state written by Put, and returns it from Get.
+type putStore struct {
+	Store
+	states    map[string]AverageState
+	sequences map[string]int64
+}
+
+func (s *putStore) Get(id string, state State) (sequence int64, err error) {
+	current, ok := s.states[id]
+	if !ok {
+		return 0, ErrStateNotFound
+	}
+	*state.(*AverageState) = current
+	return s.sequences[id], nil
+}
+
+func (s *putStore) Prepare(id string, atSequence int64, state State, inbound []InboundEvent, outbound []OutboundEvent) (items []types.TransactWriteItem, err error) {
+	s.states[id] = *state.(*AverageState)
+	s.sequences[id] = atSequence + 1
+	return
+}
+
+func (s *putStore) Execute(items []types.TransactWriteItem) error {
+	return nil
+}
+
+func TestNamespaceClient(t *testing.T) {
+	// Arrange.
+	store := &putStore{
+		states:    map[string]AverageState{},
+		sequences: map[string]int64{},
+	}
+	client := NewNamespaceClient(store, func(id string) *AverageState { return &AverageState{} })
+	ctx := context.Background()
+
+	// Act.
+	created, err := client.Process(ctx, "id", Add{Number: 2})
+	if err != nil {
+		t.Fatalf("failed to create entity: %v", err)
+	}
+	updated, err := client.Process(ctx, "id", Add{Number: 4})
+	if err != nil {
+		t.Fatalf("failed to update entity: %v", err)
+	}
+	retrieved, sequence, err := client.Get(ctx, "id")
+	if err != nil {
+		t.Fatalf("failed to get entity: %v", err)
+	}
+
+	// Assert.
+	if diff := cmp.Diff(&AverageState{Sum: 2, Count: 1, Value: 2}, created); diff != "" {
+		t.Error(diff)
+	}
+	expected := &AverageState{Sum: 6, Count: 2, Value: 3}
+	if diff := cmp.Diff(expected, updated); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff(expected, retrieved); diff != "" {
+		t.Error(diff)
+	}
+	if sequence != 2 {
+		t.Errorf("expected sequence 2, got %d", sequence)
+	}
+}
+
+func TestNamespaceClientQueryRequiresQuerier(t *testing.T) {
+	client := NewNamespaceClient(&putStore{}, func(id string) *AverageState { return &AverageState{} })
+	_, _, _, _, err := client.Query(context.Background(), "id")
+	if err == nil {
+		t.Error("expected error querying a store that doesn't support it")
+	}
+}
+
+func TestNamespaceClientUpdateRequiresAnExistingEntity(t *testing.T) {
+	// Arrange.
+	store := &putStore{
+		states:    map[string]AverageState{},
+		sequences: map[string]int64{},
+	}
+	client := NewNamespaceClient(store, func(id string) *AverageState { return &AverageState{} })
+
+	// Act.
+	_, err := client.Update(context.Background(), "id", Add{Number: 2})
+
+	// Assert.
+	if !errors.Is(err, ErrStateNotFound) {
+		t.Errorf("expected ErrStateNotFound, got %v", err)
+	}
+	if _, ok := store.states["id"]; ok {
+		t.Error("expected the entity not to be created")
+	}
+}
+
+func TestStoreRequestsUseTheContext(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Act.
+	_, err = StoreWithContext(ctx, s).Get("id", &AverageState{})
+
+	// Assert.
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestNamespaceClientUsesTheStoreCodec(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient), WithCodecTag("json"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	inbound := NewInboundEventReader()
+	client := NewNamespaceClient(s, func(id string) *AverageState { return &AverageState{} }, WithEventReaders[*AverageState](inbound, nil))
+
+	// Act.
+	r := client.inboundEventReader()
+
+	// Assert.
+	if r.Unmarshal == nil {
+		t.Error("expected the reader to use the store's codec")
+	}
+	if inbound.Unmarshal != nil {
+		t.Error("expected the client's reader not to be modified")
+	}
+}
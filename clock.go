@@ -0,0 +1,65 @@
+package stream
+
+import (
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// Clock returns the current time. The store uses it for the timestamps of records, so that
+// tests can assert exact stored items, see WithClock.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc is a function that implements Clock.
+type ClockFunc func() time.Time
+
+// Now returns f().
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// SystemClock returns the current time in UTC.
+var SystemClock Clock = ClockFunc(func() time.Time {
+	return time.Now().UTC()
+})
+
+// IDGenerator returns a unique ID each time it's called, e.g. for event records.
+type IDGenerator interface {
+	NewID() string
+}
+
+// IDGeneratorFunc is a function that implements IDGenerator.
+type IDGeneratorFunc func() string
+
+// NewID returns f().
+func (f IDGeneratorFunc) NewID() string {
+	return f()
+}
+
+// ULIDGenerator returns ULIDs with the timestamp of the clock, so that IDs sort in the
+// order that they were created.
+func ULIDGenerator(c Clock) IDGenerator {
+	return IDGeneratorFunc(func() string {
+		return ulid.MustNew(ulid.Timestamp(c.Now()), ulid.DefaultEntropy()).String()
+	})
+}
+
+// WithClock sets the clock used for the timestamps of records, e.g. _ts and _date.
+// Defaults to SystemClock.
+func WithClock(c Clock) StoreOption {
+	return func(o *StoreOptions) error {
+		o.Clock = c
+		return nil
+	}
+}
+
+// WithIDGenerator sets the generator of the IDs of inbound, outbound and annotation
+// records. Defaults to a ULIDGenerator that uses the store's clock.
+func WithIDGenerator(g IDGenerator) StoreOption {
+	return func(o *StoreOptions) error {
+		o.IDGenerator = g
+		return nil
+	}
+}
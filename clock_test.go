@@ -0,0 +1,62 @@
+package stream
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStoreClockAndIDGenerator(t *testing.T) {
+	// Arrange.
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	var ids int
+	s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient),
+		WithClock(ClockFunc(func() time.Time { return now })),
+		WithIDGenerator(IDGeneratorFunc(func() string {
+			ids++
+			return "event-" + strconv.Itoa(ids)
+		})))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	// Act.
+	items, err := s.Prepare("id", 0, &AverageState{}, []InboundEvent{Add{Number: 1}}, []OutboundEvent{Average{}})
+	if err != nil {
+		t.Fatalf("failed to prepare items: %v", err)
+	}
+
+	// Assert.
+	var actual []string
+	for _, item := range items {
+		r := item.Put.Item
+		actual = append(actual, stringAttribute(r, "_sk")+" "+stringAttribute(r, "_date")+" "+stringAttribute(r, "_id"))
+	}
+	expected := []string{
+		"STATE 2020-01-01T00:00:00Z ",
+		"INBOUND/1/0/Add 2020-01-01T00:00:00Z event-1",
+		"OUTBOUND/1/0/Average 2020-01-01T00:00:00Z event-2",
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestULIDGeneratorUsesTheClock(t *testing.T) {
+	// Arrange.
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	g := ULIDGenerator(ClockFunc(func() time.Time { return now }))
+
+	// Act.
+	a, b := g.NewID(), g.NewID()
+
+	// Assert.
+	if a == b {
+		t.Errorf("expected unique IDs, got %q twice", a)
+	}
+	if a[:10] != b[:10] {
+		t.Errorf("expected IDs with the same timestamp, got %q and %q", a, b)
+	}
+}
@@ -0,0 +1,77 @@
+// stream-export writes every record of an entity to stdout as JSON, e.g. to respond
+// to a GDPR subject-access request.
+//
+//	stream-export -table stream -namespace Customer -id 123 -redact email,address.postcode
+//
+// With -dump, the records are written as stored, for stream-import to restore them into
+// another table or namespace. If -id is omitted, the whole namespace is dumped.
+//
+//	stream-export -table stream -namespace Customer -dump > customers.ndjson
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/a-h/stream"
+)
+
+var (
+	tableFlag          = flag.String("table", "", "Name of the DynamoDB table.")
+	namespaceFlag      = flag.String("namespace", "", "Namespace of the entity.")
+	idFlag             = flag.String("id", "", "ID of the entity.")
+	regionFlag         = flag.String("region", "", "AWS region, defaults to the region in the environment.")
+	tenantFlag         = flag.String("tenant", "", "Tenant of the entity, if the store is tenant-scoped.")
+	kmsKeyFlag         = flag.String("kms-key", "", "ARN of the KMS key, if the store is encrypted.")
+	formatFlag         = flag.String("format", string(stream.ExportNDJSON), "Output format, ndjson or json.")
+	redactFlag         = flag.String("redact", "", "Comma separated list of fields to remove from each record.")
+	applyRedactorsFlag = flag.Bool("apply-redactors", true, "Remove the fields listed by outbound events that implement stream.Redactor.")
+	dumpFlag           = flag.Bool("dump", false, "Write the records as stored, for stream-import. The id flag is optional.")
+)
+
+func main() {
+	flag.Parse()
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "stream-export: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	if *tableFlag == "" || *namespaceFlag == "" || (*idFlag == "" && !*dumpFlag) {
+		flag.Usage()
+		return errors.New("the table, namespace and id flags are required")
+	}
+	opts := []stream.StoreOption{stream.WithRegion(*regionFlag)}
+	if *tenantFlag != "" {
+		opts = append(opts, stream.WithTenant(*tenantFlag))
+	}
+	if *kmsKeyFlag != "" {
+		opts = append(opts, stream.WithEncryption(*kmsKeyFlag))
+	}
+	store, err := stream.NewStore(*tableFlag, *namespaceFlag, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create store: %w", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *dumpFlag {
+		if *idFlag == "" {
+			return store.Dump(ctx, os.Stdout)
+		}
+		return store.Dump(ctx, os.Stdout, *idFlag)
+	}
+	exportOpts := []stream.ExportOption{
+		stream.ExportAs(stream.ExportFormat(*formatFlag)),
+		stream.ExportApplyRedactors(*applyRedactorsFlag),
+	}
+	if *redactFlag != "" {
+		exportOpts = append(exportOpts, stream.ExportRedact(strings.Split(*redactFlag, ",")...))
+	}
+	return store.Export(ctx, *idFlag, os.Stdout, exportOpts...)
+}
@@ -0,0 +1,61 @@
+// stream-init-table creates a DynamoDB table keyed for stream.DynamoDBStore, e.g. to
+// bootstrap a new project, a CI environment, or DynamoDB Local.
+//
+//	stream-init-table -table stream -stream -ttl -endpoint http://localhost:8000
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/a-h/stream"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+var (
+	tableFlag       = flag.String("table", "", "Name of the DynamoDB table to create.")
+	regionFlag      = flag.String("region", "", "AWS region, defaults to the region in the environment.")
+	endpointFlag    = flag.String("endpoint", "", "DynamoDB endpoint, e.g. http://localhost:8000 for DynamoDB Local.")
+	streamFlag      = flag.Bool("stream", false, "Enable DynamoDB Streams with the NEW_IMAGE view type.")
+	ttlFlag         = flag.Bool("ttl", false, "Enable time to live on the _ttl attribute.")
+	outboxIndexFlag = flag.String("outbox-index", "", "Name of a global secondary index to create for the outbox.")
+)
+
+func main() {
+	flag.Parse()
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "stream-init-table: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	if *tableFlag == "" {
+		flag.Usage()
+		return errors.New("the table flag is required")
+	}
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(*regionFlag))
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	var clientOpts []func(*dynamodb.Options)
+	if *endpointFlag != "" {
+		clientOpts = append(clientOpts, dynamodb.WithEndpointResolver(dynamodb.EndpointResolverFromURL(*endpointFlag)))
+	}
+	client := dynamodb.NewFromConfig(cfg, clientOpts...)
+	err = stream.CreateTable(ctx, client, *tableFlag,
+		stream.TableStream(*streamFlag),
+		stream.TableTTL(*ttlFlag),
+		stream.TableOutboxIndex(*outboxIndexFlag),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "stream-init-table: created table %q\n", *tableFlag)
+	return nil
+}
@@ -0,0 +1,70 @@
+// stream-replay republishes events from a dead letter queue to EventBridge, once the cause
+// of the failure has been resolved. Dead letters are read as newline delimited JSON, from
+// a file, or stdin.
+//
+//	stream-replay -file dead-letters.ndjson
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/a-h/stream/handler"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+)
+
+var (
+	fileFlag     = flag.String("file", "", "Newline delimited JSON file of dead letters, defaults to stdin.")
+	regionFlag   = flag.String("region", "", "AWS region, defaults to the region in the environment.")
+	eventBusFlag = flag.String("event-bus", "default", "Event bus of dead letters that don't have one.")
+	sourceFlag   = flag.String("source", "stream-replay", "Source of dead letters that don't have one.")
+)
+
+func main() {
+	flag.Parse()
+	if err := run(context.Background()); err != nil {
+		fmt.Fprintf(os.Stderr, "stream-replay: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context) error {
+	var r io.Reader = os.Stdin
+	if *fileFlag != "" {
+		f, err := os.Open(*fileFlag)
+		if err != nil {
+			return fmt.Errorf("failed to open file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	letters, err := handler.ReadDeadLetters(r)
+	if err != nil {
+		return fmt.Errorf("failed to read dead letters: %w", err)
+	}
+	var opts []func(*config.LoadOptions) error
+	if *regionFlag != "" {
+		opts = append(opts, config.WithRegion(*regionFlag))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to load aws config: %w", err)
+	}
+	h, err := handler.New(handler.Config{
+		EventBridge:     eventbridge.NewFromConfig(cfg),
+		EventBusName:    *eventBusFlag,
+		EventSourceName: *sourceFlag,
+	})
+	if err != nil {
+		return err
+	}
+	if err = h.Replay(ctx, letters); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "stream-replay: replayed %d events\n", len(letters))
+	return nil
+}
@@ -0,0 +1,76 @@
+// stream-serve hosts a web dashboard over the admin API, to search entities by ID, view
+// their state and history, and check whether their outbound events have been dispatched.
+//
+//	stream-serve -table stream -namespace Order -addr localhost:8080 -redact email
+//
+// The dashboard has no authentication, so don't expose it publicly.
+package main
+
+import (
+	_ "embed"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/a-h/stream"
+	"github.com/a-h/stream/admin"
+)
+
+var (
+	tableFlag     = flag.String("table", "", "Name of the DynamoDB table.")
+	namespaceFlag = flag.String("namespace", "", "Namespace of the entities.")
+	regionFlag    = flag.String("region", "", "AWS region, defaults to the region in the environment.")
+	tenantFlag    = flag.String("tenant", "", "Tenant of the entities, if the store is tenant-scoped.")
+	kmsKeyFlag    = flag.String("kms-key", "", "ARN of the KMS key, if the store is encrypted.")
+	addrFlag      = flag.String("addr", "localhost:8080", "Address to listen on.")
+	redactFlag    = flag.String("redact", "", "Comma separated list of fields to remove from records, e.g. email,address.line1.")
+)
+
+//go:embed index.html
+var index []byte
+
+func main() {
+	flag.Parse()
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "stream-serve: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	if *tableFlag == "" || *namespaceFlag == "" {
+		flag.Usage()
+		return errors.New("the table and namespace flags are required")
+	}
+	opts := []stream.StoreOption{stream.WithRegion(*regionFlag)}
+	if *tenantFlag != "" {
+		opts = append(opts, stream.WithTenant(*tenantFlag))
+	}
+	if *kmsKeyFlag != "" {
+		opts = append(opts, stream.WithEncryption(*kmsKeyFlag))
+	}
+	store, err := stream.NewStore(*tableFlag, *namespaceFlag, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create store: %w", err)
+	}
+	var adminOpts []admin.Option
+	if *redactFlag != "" {
+		adminOpts = append(adminOpts, admin.WithRedact(strings.Split(*redactFlag, ",")...))
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/api/", http.StripPrefix("/api", admin.New(store, nil, adminOpts...)))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(index)
+	})
+	log.Printf("serving %s/%s on http://%s", *tableFlag, *namespaceFlag, *addrFlag)
+	return http.ListenAndServe(*addrFlag, mux)
+}
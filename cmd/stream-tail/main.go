@@ -0,0 +1,82 @@
+// stream-tail prints the outbound events of a namespace as they're stored, e.g. to
+// watch a service while debugging.
+//
+//	stream-tail -table stream -namespace Order -types OrderPlaced,OrderShipped -since 5m
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/a-h/stream"
+)
+
+var (
+	tableFlag     = flag.String("table", "", "Name of the DynamoDB table.")
+	namespaceFlag = flag.String("namespace", "", "Namespace of the entities.")
+	regionFlag    = flag.String("region", "", "AWS region, defaults to the region in the environment.")
+	tenantFlag    = flag.String("tenant", "", "Tenant of the entities, if the store is tenant-scoped.")
+	kmsKeyFlag    = flag.String("kms-key", "", "ARN of the KMS key, if the store is encrypted.")
+	typesFlag     = flag.String("types", "", "Comma separated list of event types to print, defaults to every type.")
+	sinceFlag     = flag.Duration("since", 0, "Print the events stored within this duration, as well as new events.")
+	intervalFlag  = flag.Duration("interval", time.Second*2, "Time to wait between scans of the table.")
+	jsonFlag      = flag.Bool("json", false, "Print each event as a single line of JSON.")
+)
+
+func main() {
+	flag.Parse()
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "stream-tail: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	if *tableFlag == "" || *namespaceFlag == "" {
+		flag.Usage()
+		return errors.New("the table and namespace flags are required")
+	}
+	opts := []stream.StoreOption{stream.WithRegion(*regionFlag)}
+	if *tenantFlag != "" {
+		opts = append(opts, stream.WithTenant(*tenantFlag))
+	}
+	if *kmsKeyFlag != "" {
+		opts = append(opts, stream.WithEncryption(*kmsKeyFlag))
+	}
+	store, err := stream.NewStore(*tableFlag, *namespaceFlag, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create store: %w", err)
+	}
+	tailOpts := []stream.TailOption{
+		stream.TailSince(time.Now().Add(-*sinceFlag)),
+		stream.TailPollInterval(*intervalFlag),
+	}
+	if *typesFlag != "" {
+		tailOpts = append(tailOpts, stream.TailTypes(strings.Split(*typesFlag, ",")...))
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err = store.Tail(ctx, print, tailOpts...)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+func print(e stream.TailedEvent) error {
+	if *jsonFlag {
+		return json.NewEncoder(os.Stdout).Encode(e)
+	}
+	fmt.Printf("%s %s/%s #%d %s\n", e.Date, *namespaceFlag, e.ID, e.Sequence, e.Type)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("  ", "  ")
+	fmt.Print("  ")
+	return enc.Encode(e.Data)
+}
@@ -0,0 +1,139 @@
+// stream-verify checks that the stored state of an entity matches the state produced by
+// reprocessing its inbound events, to find drift caused by past bugs or manual edits.
+//
+// The entity's inbound records are written, as exported by stream-export, to the stdin of a
+// plugin, a program built with stream.ReplayExport, which writes the replayed state to
+// stdout. Fields that differ are written to stdout, and the command exits with status 2.
+//
+//	stream-verify -table stream -namespace SlotMachine -id 123 -plugin ./slotmachine-replay
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+
+	"github.com/a-h/stream"
+)
+
+var (
+	tableFlag     = flag.String("table", "", "Name of the DynamoDB table.")
+	namespaceFlag = flag.String("namespace", "", "Namespace of the entity.")
+	idFlag        = flag.String("id", "", "ID of the entity.")
+	pluginFlag    = flag.String("plugin", "", "Path of the program that replays the inbound events.")
+	regionFlag    = flag.String("region", "", "AWS region, defaults to the region in the environment.")
+	tenantFlag    = flag.String("tenant", "", "Tenant of the entity, if the store is tenant-scoped.")
+	kmsKeyFlag    = flag.String("kms-key", "", "ARN of the KMS key, if the store is encrypted.")
+)
+
+// errDrift is returned if the stored state differs from the replayed state.
+var errDrift = errors.New("the stored state differs from the replayed state")
+
+func main() {
+	flag.Parse()
+	err := run()
+	if errors.Is(err, errDrift) {
+		fmt.Fprintf(os.Stderr, "stream-verify: %v\n", err)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "stream-verify: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	if *tableFlag == "" || *namespaceFlag == "" || *idFlag == "" || *pluginFlag == "" {
+		flag.Usage()
+		return errors.New("the table, namespace, id and plugin flags are required")
+	}
+	opts := []stream.StoreOption{stream.WithRegion(*regionFlag)}
+	if *tenantFlag != "" {
+		opts = append(opts, stream.WithTenant(*tenantFlag))
+	}
+	if *kmsKeyFlag != "" {
+		opts = append(opts, stream.WithEncryption(*kmsKeyFlag))
+	}
+	store, err := stream.NewStore(*tableFlag, *namespaceFlag, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create store: %w", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	var export bytes.Buffer
+	if err = store.Export(ctx, *idFlag, &export, stream.ExportApplyRedactors(false)); err != nil {
+		return fmt.Errorf("failed to export entity: %w", err)
+	}
+	stored, inbound, err := split(&export)
+	if err != nil {
+		return err
+	}
+	if stored == nil {
+		return errors.New("the entity has no STATE record")
+	}
+	replayed, err := replay(*pluginFlag, inbound)
+	if err != nil {
+		return err
+	}
+	drift := stream.FindDrift(stored.Data, replayed.Data)
+	enc := json.NewEncoder(os.Stdout)
+	for _, d := range drift {
+		if err = enc.Encode(d); err != nil {
+			return err
+		}
+	}
+	if len(drift) > 0 {
+		return fmt.Errorf("%w: %d fields differ", errDrift, len(drift))
+	}
+	return nil
+}
+
+// split reads the stored state record, and the inbound records in sequence order, from
+// the export.
+func split(export *bytes.Buffer) (stored *stream.ExportRecord, inbound []stream.ExportRecord, err error) {
+	dec := json.NewDecoder(export)
+	for dec.More() {
+		var r stream.ExportRecord
+		if err = dec.Decode(&r); err != nil {
+			return nil, nil, fmt.Errorf("failed to read export: %w", err)
+		}
+		switch r.Kind {
+		case stream.ExportKindState:
+			stored = &r
+		case stream.ExportKindInbound:
+			inbound = append(inbound, r)
+		}
+	}
+	sort.SliceStable(inbound, func(i, j int) bool { return inbound[i].Sequence < inbound[j].Sequence })
+	return
+}
+
+// replay runs the plugin with the inbound records on stdin, and reads the replayed state
+// from stdout.
+func replay(plugin string, inbound []stream.ExportRecord) (replayed stream.ExportRecord, err error) {
+	var stdin, stdout bytes.Buffer
+	enc := json.NewEncoder(&stdin)
+	for _, r := range inbound {
+		if err = enc.Encode(r); err != nil {
+			return
+		}
+	}
+	cmd := exec.Command(plugin)
+	cmd.Stdin = &stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err = cmd.Run(); err != nil {
+		return replayed, fmt.Errorf("plugin failed: %w", err)
+	}
+	if err = json.Unmarshal(stdout.Bytes(), &replayed); err != nil {
+		return replayed, fmt.Errorf("failed to read the plugin's output: %w", err)
+	}
+	return
+}
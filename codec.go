@@ -0,0 +1,110 @@
+package stream
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TimeCodec controls how time.Time fields of state and events are stored. The
+// handler publishes the stored representation, so the same codec also determines
+// the JSON sent to EventBridge.
+//
+// Other scalar types, e.g. money or decimals, control their representation by
+// implementing both attributevalue.Marshaler and attributevalue.Unmarshaler.
+type TimeCodec struct {
+	Encode func(time.Time) (types.AttributeValue, error)
+	// DecodeS decodes string attributes.
+	DecodeS func(string) (time.Time, error)
+	// DecodeN decodes number attributes.
+	DecodeN func(string) (time.Time, error)
+}
+
+// TimeRFC3339Nano stores times as RFC3339 strings with nanosecond precision. This is
+// the default, and matches encoding/json. The zone offset is kept, but not the zone
+// name.
+var TimeRFC3339Nano = TimeCodec{
+	Encode: func(t time.Time) (types.AttributeValue, error) {
+		return &types.AttributeValueMemberS{Value: t.Format(time.RFC3339Nano)}, nil
+	},
+	DecodeS: func(s string) (time.Time, error) {
+		return time.Parse(time.RFC3339Nano, s)
+	},
+	DecodeN: decodeUnixMillis,
+}
+
+// TimeUnixMillis stores times as the number of milliseconds since the Unix epoch in
+// UTC, as used by JavaScript.
+var TimeUnixMillis = TimeCodec{
+	Encode: func(t time.Time) (types.AttributeValue, error) {
+		return &types.AttributeValueMemberN{Value: strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)}, nil
+	},
+	DecodeS: func(s string) (time.Time, error) {
+		return time.Parse(time.RFC3339Nano, s)
+	},
+	DecodeN: decodeUnixMillis,
+}
+
+// TimeWithZone stores times as RFC3339 strings followed by the IANA zone name in
+// square brackets, e.g. "2022-03-27T01:30:00Z[Europe/London]", so that times keep
+// their location when they're read back.
+var TimeWithZone = TimeCodec{
+	Encode: func(t time.Time) (types.AttributeValue, error) {
+		return &types.AttributeValueMemberS{Value: t.Format(time.RFC3339Nano) + "[" + t.Location().String() + "]"}, nil
+	},
+	DecodeS: func(s string) (t time.Time, err error) {
+		var zone string
+		if i := strings.LastIndex(s, "["); i >= 0 && strings.HasSuffix(s, "]") {
+			s, zone = s[:i], s[i+1:len(s)-1]
+		}
+		t, err = time.Parse(time.RFC3339Nano, s)
+		if err != nil || zone == "" {
+			return
+		}
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return t, fmt.Errorf("failed to load time zone %q: %w", zone, err)
+		}
+		return t.In(loc), nil
+	},
+	DecodeN: decodeUnixMillis,
+}
+
+func decodeUnixMillis(s string) (time.Time, error) {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)).UTC(), nil
+}
+
+func newEncoder(o StoreOptions) *attributevalue.Encoder {
+	return attributevalue.NewEncoder(func(opts *attributevalue.EncoderOptions) {
+		opts.TagKey = o.CodecTag
+		if o.TimeCodec.Encode != nil {
+			opts.EncodeTime = o.TimeCodec.Encode
+		}
+	})
+}
+
+func newDecoder(o StoreOptions) *attributevalue.Decoder {
+	return attributevalue.NewDecoder(func(opts *attributevalue.DecoderOptions) {
+		opts.TagKey = o.CodecTag
+		if o.TimeCodec.DecodeS != nil {
+			opts.DecodeTime.S = o.TimeCodec.DecodeS
+		}
+		if o.TimeCodec.DecodeN != nil {
+			opts.DecodeTime.N = o.TimeCodec.DecodeN
+		}
+	})
+}
+
+// Unmarshal decodes a record into out using the store's codec, so that event readers
+// passed to Query decode fields in the same way as they were stored.
+func (ddb *DynamoDBStore) Unmarshal(item map[string]types.AttributeValue, out interface{}) error {
+	return ddb.unmarshalMap(item, out)
+}
@@ -0,0 +1,78 @@
+package stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+type Appointment struct {
+	At time.Time `dynamodbav:"at"`
+}
+
+func TestTimeCodecs(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("failed to load location: %v", err)
+	}
+	at := time.Date(2022, 3, 27, 2, 30, 0, 123000000, london)
+	tests := []struct {
+		name           string
+		codec          TimeCodec
+		expectedStored types.AttributeValue
+		expectedZone   string
+	}{
+		{
+			name:           "RFC3339",
+			codec:          TimeRFC3339Nano,
+			expectedStored: &types.AttributeValueMemberS{Value: "2022-03-27T02:30:00.123+01:00"},
+			expectedZone:   "",
+		},
+		{
+			name:           "Unix milliseconds",
+			codec:          TimeUnixMillis,
+			expectedStored: &types.AttributeValueMemberN{Value: "1648344600123"},
+			expectedZone:   "UTC",
+		},
+		{
+			name:           "with zone",
+			codec:          TimeWithZone,
+			expectedStored: &types.AttributeValueMemberS{Value: "2022-03-27T02:30:00.123+01:00[Europe/London]"},
+			expectedZone:   "Europe/London",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			s, err := NewStore("table", "Appointment", WithRegion(region), WithClient(testClient), WithTimeCodec(tt.codec))
+			if err != nil {
+				t.Fatalf("failed to create store: %v", err)
+			}
+
+			// Act.
+			item, err := s.marshalMap(Appointment{At: at})
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+			var actual Appointment
+			err = s.Unmarshal(item, &actual)
+			if err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+
+			// Assert.
+			if diff := cmp.Diff(tt.expectedStored, item["at"], ignoreAttributeValueUnexported); diff != "" {
+				t.Error(diff)
+			}
+			if !actual.At.Equal(at) {
+				t.Errorf("expected %v, got %v", at, actual.At)
+			}
+			if tt.expectedZone != "" && actual.At.Location().String() != tt.expectedZone {
+				t.Errorf("expected zone %q, got %q", tt.expectedZone, actual.At.Location())
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoResult is returned by ProcessCommand if the state didn't return a result of the
+// command's result type.
+var ErrNoResult = errors.New("the state did not return a result for the command")
+
+// Command is an inbound event that has a result of type TResult, e.g. whether a game was
+// won, so that API handlers don't need to infer the outcome from the state. The IsCommand
+// method is a marker, which ensures that the result type passed to ProcessCommand matches
+// the command.
+//
+//	func (PullHandle) IsCommand(PullHandleResult) {}
+type Command[TResult any] interface {
+	InboundEvent
+	IsCommand(TResult)
+}
+
+// Result wraps the result of a command, so that it can be returned from State.Process
+// alongside outbound events. Results are returned by ProcessCommand, and aren't stored
+// or sent.
+func Result(v any) OutboundEvent {
+	return commandResult{value: v}
+}
+
+type commandResult struct {
+	value any
+}
+
+func (commandResult) EventName() string { return "Result" }
+func (commandResult) IsOutbound()       {}
+
+// SplitResults separates the command results returned with Result from outbound events,
+// e.g. to check the result of calling State.Process in a test.
+func SplitResults(events []OutboundEvent) (outbound []OutboundEvent, results []any) {
+	for _, e := range events {
+		if r, ok := e.(commandResult); ok {
+			results = append(results, r.value)
+			continue
+		}
+		outbound = append(outbound, e)
+	}
+	return
+}
+
+// ProcessCommand processes the command, stores the updated state and outbound events, and
+// returns the result returned by the state using Result. If the state returns more than
+// one result of the type, the last is used.
+//
+//	result, err := stream.ProcessCommand[PullHandleResult](p, PullHandle{})
+func ProcessCommand[TResult any](p *Processor, cmd Command[TResult]) (result TResult, err error) {
+	if err = p.Process(cmd); err != nil {
+		return
+	}
+	return commandResultOf[TResult](p, cmd)
+}
+
+// commandResultOf returns the last result of type TResult returned by the state while
+// processing the command.
+func commandResultOf[TResult any](p *Processor, cmd InboundEvent) (result TResult, err error) {
+	var found bool
+	for _, r := range p.results {
+		if v, ok := r.(TResult); ok {
+			result, found = v, true
+		}
+	}
+	if !found {
+		err = fmt.Errorf("%w: %s", ErrNoResult, cmd.EventName())
+	}
+	return
+}
@@ -0,0 +1,110 @@
+package stream
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+type Deposit struct {
+	Amount int
+}
+
+func (Deposit) EventName() string              { return "Deposit" }
+func (Deposit) IsInbound()                     {}
+func (Deposit) IsCommand(result DepositResult) {}
+
+type DepositResult struct {
+	Balance int
+}
+
+type Deposited struct {
+	Amount int
+}
+
+func (Deposited) EventName() string { return "Deposited" }
+func (Deposited) IsOutbound()       {}
+
+type Wallet struct {
+	Balance int
+}
+
+func (w *Wallet) Process(event InboundEvent) (outbound []OutboundEvent, err error) {
+	switch e := event.(type) {
+	case Deposit:
+		w.Balance += e.Amount
+		outbound = append(outbound, Deposited{Amount: e.Amount}, Result(DepositResult{Balance: w.Balance}))
+	case WalletDeposit:
+		w.Balance += e.Amount
+		outbound = append(outbound, Deposited{Amount: e.Amount}, Result(DepositResult{Balance: w.Balance}))
+	}
+	return
+}
+
+// preparedStore records the outbound events passed to Prepare.
+type preparedStore struct {
+	Store
+	outbound []OutboundEvent
+}
+
+func (s *preparedStore) Prepare(id string, atSequence int64, state State, inbound []InboundEvent, outbound []OutboundEvent) (items []types.TransactWriteItem, err error) {
+	s.outbound = outbound
+	return
+}
+
+func (s *preparedStore) Execute(items []types.TransactWriteItem) error {
+	return nil
+}
+
+func TestProcessCommand(t *testing.T) {
+	// Arrange.
+	store := &preparedStore{}
+	p, err := New(store, "id", &Wallet{Balance: 10})
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+
+	// Act.
+	result, err := ProcessCommand[DepositResult](p, Deposit{Amount: 5})
+	if err != nil {
+		t.Fatalf("failed to process command: %v", err)
+	}
+
+	// Assert.
+	if diff := cmp.Diff(DepositResult{Balance: 15}, result); diff != "" {
+		t.Errorf("unexpected result: %s", diff)
+	}
+	if diff := cmp.Diff([]OutboundEvent{Deposited{Amount: 5}}, store.outbound); diff != "" {
+		t.Errorf("expected results not to be stored: %s", diff)
+	}
+	if diff := cmp.Diff([]OutboundEvent{Deposited{Amount: 5}}, p.Outbound()); diff != "" {
+		t.Errorf("expected results not to be included in the outbound events: %s", diff)
+	}
+}
+
+type Noop struct{}
+
+func (Noop) EventName() string              { return "Noop" }
+func (Noop) IsInbound()                     {}
+func (Noop) IsCommand(result DepositResult) {}
+
+func TestProcessCommandWithoutResult(t *testing.T) {
+	// Arrange.
+	p, err := New(&preparedStore{}, "id", &Wallet{})
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+
+	// Act.
+	_, err = ProcessCommand[DepositResult](p, Noop{})
+
+	// Assert.
+	if !errors.Is(err, ErrNoResult) {
+		t.Errorf("expected ErrNoResult, got %v", err)
+	}
+	if p.Sequence() != 1 {
+		t.Errorf("expected the command to be stored, got sequence %d", p.Sequence())
+	}
+}
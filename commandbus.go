@@ -0,0 +1,133 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownCommand is returned by CommandBus.Dispatch if no handler is registered for the
+// command's name.
+var ErrUnknownCommand = errors.New("no handler is registered for the command")
+
+// CommandBus dispatches commands to the state they're addressed to, so that API handlers
+// and queue consumers share the same Load, Process and retry logic.
+type CommandBus struct {
+	// MaxRetries is the number of times that a command is retried if the state was
+	// updated since it was read. Defaults to 3.
+	MaxRetries int
+	commands   map[string]commandHandler
+}
+
+type commandHandler struct {
+	store    Store
+	newState func(id string) State
+	id       func(cmd InboundEvent) (string, error)
+}
+
+// CommandBusOption configures a CommandBus.
+type CommandBusOption func(*CommandBus)
+
+// WithCommandRetries sets the number of times that a command is retried if the state was
+// updated since it was read.
+func WithCommandRetries(n int) CommandBusOption {
+	return func(b *CommandBus) {
+		b.MaxRetries = n
+	}
+}
+
+// NewCommandBus creates a CommandBus. Register commands with RegisterCommand.
+func NewCommandBus(opts ...CommandBusOption) *CommandBus {
+	b := &CommandBus{
+		MaxRetries: 3,
+		commands:   make(map[string]commandHandler),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// RegisterCommand registers the command type T with the bus. Commands of type T are
+// processed by the state returned by newState, stored in the store's namespace, with the
+// ID returned by id. Registering a command name again replaces the previous handler.
+//
+//	stream.RegisterCommand(bus, store, func(id string) stream.State { return &SlotMachine{ID: id} },
+//		func(cmd PullHandle) (string, error) { return cmd.MachineID, nil })
+func RegisterCommand[T InboundEvent](b *CommandBus, store Store, newState func(id string) State, id func(cmd T) (string, error)) {
+	var zero T
+	b.commands[zero.EventName()] = commandHandler{
+		store:    store,
+		newState: newState,
+		id: func(cmd InboundEvent) (string, error) {
+			return id(cmd.(T))
+		},
+	}
+}
+
+// Dispatch loads the state that the command is addressed to, or creates it if it doesn't
+// exist, and processes the command. If the state was updated since it was read, the
+// command is retried against the latest state, up to MaxRetries times. Commands that fail
+// ValidateEvent are rejected before anything is loaded.
+func (b *CommandBus) Dispatch(ctx context.Context, cmd InboundEvent, opts ...ProcessorOption) (p *Processor, err error) {
+	h, id, err := b.resolve(cmd)
+	if err != nil {
+		return
+	}
+	return b.dispatch(ctx, h, id, cmd, opts)
+}
+
+// resolve validates the command, and returns its handler, and the ID of the entity that
+// it's addressed to.
+func (b *CommandBus) resolve(cmd InboundEvent) (h commandHandler, id string, err error) {
+	if err = ValidateEvent(cmd); err != nil {
+		return
+	}
+	h, ok := b.commands[cmd.EventName()]
+	if !ok {
+		err = fmt.Errorf("%w: %s", ErrUnknownCommand, cmd.EventName())
+		return
+	}
+	id, err = h.id(cmd)
+	if err != nil {
+		err = fmt.Errorf("failed to get the ID of %s: %w", cmd.EventName(), err)
+	}
+	return
+}
+
+func (b *CommandBus) dispatch(ctx context.Context, h commandHandler, id string, cmd InboundEvent, opts []ProcessorOption) (p *Processor, err error) {
+	for attempt := 0; ; attempt++ {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		p, err = Load(h.store, id, h.newState(id), opts...)
+		if errors.Is(err, ErrStateNotFound) {
+			p, err = New(h.store, id, h.newState(id), opts...)
+		}
+		if err != nil {
+			return
+		}
+		err = p.Process(cmd)
+		if errors.Is(err, ErrOptimisticConcurrency) && attempt < b.MaxRetries {
+			continue
+		}
+		return
+	}
+}
+
+// Dispatcher dispatches commands, e.g. a CommandBus or a SerialDispatcher.
+type Dispatcher interface {
+	Dispatch(ctx context.Context, cmd InboundEvent, opts ...ProcessorOption) (p *Processor, err error)
+}
+
+// DispatchCommand dispatches the command, and returns the result returned by the state
+// using Result.
+//
+//	result, err := stream.DispatchCommand[PullHandleResult](ctx, bus, PullHandle{MachineID: id})
+func DispatchCommand[TResult any](ctx context.Context, d Dispatcher, cmd Command[TResult], opts ...ProcessorOption) (result TResult, err error) {
+	p, err := d.Dispatch(ctx, cmd, opts...)
+	if err != nil {
+		return
+	}
+	return commandResultOf[TResult](p, cmd)
+}
@@ -0,0 +1,147 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+type WalletDeposit struct {
+	WalletID string
+	Amount   int
+}
+
+func (WalletDeposit) EventName() string              { return "WalletDeposit" }
+func (WalletDeposit) IsInbound()                     {}
+func (WalletDeposit) IsCommand(result DepositResult) {}
+
+// walletStore stores wallets, and returns ErrOptimisticConcurrency for the first
+// conflicts writes.
+type walletStore struct {
+	Store
+	wallets   map[string]Wallet
+	conflicts int
+	writes    int
+}
+
+func (s *walletStore) Get(id string, state State) (sequence int64, err error) {
+	w, ok := s.wallets[id]
+	if !ok {
+		return 0, ErrStateNotFound
+	}
+	*state.(*Wallet) = w
+	return 1, nil
+}
+
+func (s *walletStore) Prepare(id string, atSequence int64, state State, inbound []InboundEvent, outbound []OutboundEvent) (items []types.TransactWriteItem, err error) {
+	s.writes++
+	if s.writes <= s.conflicts {
+		return nil, ErrOptimisticConcurrency
+	}
+	s.wallets[id] = *state.(*Wallet)
+	return
+}
+
+func (s *walletStore) Execute(items []types.TransactWriteItem) error {
+	return nil
+}
+
+func newWalletBus(store *walletStore, opts ...CommandBusOption) *CommandBus {
+	bus := NewCommandBus(opts...)
+	RegisterCommand(bus, store, func(id string) State { return &Wallet{} },
+		func(cmd WalletDeposit) (string, error) { return cmd.WalletID, nil })
+	return bus
+}
+
+func TestCommandBus(t *testing.T) {
+	tests := []struct {
+		name            string
+		wallets         map[string]Wallet
+		conflicts       int
+		expected        DepositResult
+		expectedErr     error
+		expectedWallets map[string]Wallet
+	}{
+		{
+			name:            "commands create the state if it doesn't exist",
+			wallets:         map[string]Wallet{},
+			expected:        DepositResult{Balance: 5},
+			expectedWallets: map[string]Wallet{"a": {Balance: 5}},
+		},
+		{
+			name:            "commands are processed by the stored state",
+			wallets:         map[string]Wallet{"a": {Balance: 10}},
+			expected:        DepositResult{Balance: 15},
+			expectedWallets: map[string]Wallet{"a": {Balance: 15}},
+		},
+		{
+			name:            "commands are retried if the state was updated since it was read",
+			wallets:         map[string]Wallet{"a": {Balance: 10}},
+			conflicts:       2,
+			expected:        DepositResult{Balance: 15},
+			expectedWallets: map[string]Wallet{"a": {Balance: 15}},
+		},
+		{
+			name:            "commands fail after the maximum number of retries",
+			wallets:         map[string]Wallet{"a": {Balance: 10}},
+			conflicts:       4,
+			expectedErr:     ErrOptimisticConcurrency,
+			expectedWallets: map[string]Wallet{"a": {Balance: 10}},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			store := &walletStore{wallets: test.wallets, conflicts: test.conflicts}
+			bus := newWalletBus(store)
+
+			// Act.
+			result, err := DispatchCommand[DepositResult](context.Background(), bus, WalletDeposit{WalletID: "a", Amount: 5})
+
+			// Assert.
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("expected error %v, got %v", test.expectedErr, err)
+			}
+			if diff := cmp.Diff(test.expected, result); diff != "" {
+				t.Errorf("unexpected result: %s", diff)
+			}
+			if diff := cmp.Diff(test.expectedWallets, store.wallets); diff != "" {
+				t.Errorf("unexpected wallets: %s", diff)
+			}
+		})
+	}
+}
+
+func TestCommandBusUnknownCommand(t *testing.T) {
+	// Arrange.
+	bus := NewCommandBus()
+
+	// Act.
+	_, err := bus.Dispatch(context.Background(), Deposit{Amount: 5})
+
+	// Assert.
+	if !errors.Is(err, ErrUnknownCommand) {
+		t.Errorf("expected ErrUnknownCommand, got %v", err)
+	}
+}
+
+func TestCommandBusRetries(t *testing.T) {
+	// Arrange.
+	store := &walletStore{wallets: map[string]Wallet{}, conflicts: 1}
+	bus := newWalletBus(store, WithCommandRetries(0))
+
+	// Act.
+	_, err := bus.Dispatch(context.Background(), WalletDeposit{WalletID: "a", Amount: 5})
+
+	// Assert.
+	if !errors.Is(err, ErrOptimisticConcurrency) {
+		t.Errorf("expected ErrOptimisticConcurrency, got %v", err)
+	}
+	if store.writes != 1 {
+		t.Errorf("expected 1 write, got %d", store.writes)
+	}
+}
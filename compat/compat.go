@@ -0,0 +1,381 @@
+// Package compat snapshots the stored shape of events and states, and detects breaking
+// changes against a baseline, so that a deploy that can't read existing records is caught
+// in CI, or at startup, instead of corrupting reads.
+//
+//	func TestCompatibility(t *testing.T) {
+//		current := compat.FromRegistry(stream.Events).Add("SlotMachine", SlotMachineState{})
+//		if err := compat.CheckFile("compat.json", current); err != nil {
+//			t.Error(err)
+//		}
+//	}
+package compat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/a-h/stream"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+)
+
+// ErrIncompatible is returned when the current snapshot has breaking changes.
+var ErrIncompatible = errors.New("compat: incompatible changes")
+
+// Shape types, using the DynamoDB attribute types that values are marshaled to.
+const (
+	TypeString    = "S"
+	TypeNumber    = "N"
+	TypeBinary    = "B"
+	TypeBool      = "BOOL"
+	TypeMap       = "M"
+	TypeList      = "L"
+	TypeStringSet = "SS"
+	TypeNumberSet = "NS"
+	TypeBinarySet = "BS"
+	// TypeTime values are stored using the store's TimeCodec.
+	TypeTime = "TIME"
+	// TypeCustom values implement attributevalue.Marshaler.
+	TypeCustom = "CUSTOM"
+	// TypeAny values are interfaces, which aren't compared.
+	TypeAny = "ANY"
+)
+
+// Shape of a marshaled value.
+type Shape struct {
+	Type string `json:"type"`
+	// Name of the Go type, for TypeCustom shapes.
+	Name string `json:"name,omitempty"`
+	// Fields of structs.
+	Fields map[string]Shape `json:"fields,omitempty"`
+	// Elem is the shape of the elements of lists, and the values of maps.
+	Elem *Shape `json:"elem,omitempty"`
+}
+
+// Snapshot of the shapes of events and states, by name.
+type Snapshot map[string]Shape
+
+// New creates an empty snapshot.
+func New() Snapshot {
+	return make(Snapshot)
+}
+
+// FromRegistry creates a snapshot of the events added to the registry's readers with
+// stream.Register and stream.RegisterOutbound.
+func FromRegistry(r *stream.Registry) Snapshot {
+	s := New()
+	for name, t := range r.Inbound.Types() {
+		s.AddType(name, t)
+	}
+	for name, t := range r.Outbound.Types() {
+		s.AddType(name, t)
+	}
+	return s
+}
+
+// Add the shape of the type of v, e.g. a state, to the snapshot.
+func (s Snapshot) Add(name string, v interface{}) Snapshot {
+	return s.AddType(name, reflect.TypeOf(v))
+}
+
+// AddType adds the shape of the type to the snapshot.
+func (s Snapshot) AddType(name string, t reflect.Type) Snapshot {
+	s[name] = shapeOf(t, "", make(map[reflect.Type]bool))
+	return s
+}
+
+// Load a snapshot written by Write.
+func Load(r io.Reader) (s Snapshot, err error) {
+	s = New()
+	err = json.NewDecoder(r).Decode(&s)
+	if err != nil {
+		err = fmt.Errorf("compat: failed to load snapshot: %w", err)
+	}
+	return
+}
+
+// Write the snapshot as JSON.
+func (s Snapshot) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+var marshalerType = reflect.TypeOf((*attributevalue.Marshaler)(nil)).Elem()
+var timeType = reflect.TypeOf(time.Time{})
+
+func shapeOf(t reflect.Type, opts string, visiting map[reflect.Type]bool) Shape {
+	if t == nil {
+		return Shape{Type: TypeAny}
+	}
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		return Shape{Type: TypeCustom, Name: t.String()}
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return Shape{Type: TypeTime}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return Shape{Type: TypeBool}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if hasOption(opts, "string") {
+			return Shape{Type: TypeString}
+		}
+		return Shape{Type: TypeNumber}
+	case reflect.String:
+		return Shape{Type: TypeString}
+	case reflect.Interface:
+		return Shape{Type: TypeAny}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return Shape{Type: TypeBinary}
+		}
+		switch {
+		case hasOption(opts, "stringset"):
+			return Shape{Type: TypeStringSet}
+		case hasOption(opts, "numberset"):
+			return Shape{Type: TypeNumberSet}
+		case hasOption(opts, "binaryset"):
+			return Shape{Type: TypeBinarySet}
+		}
+		elem := shapeOf(t.Elem(), "", visiting)
+		return Shape{Type: TypeList, Elem: &elem}
+	case reflect.Map:
+		switch {
+		case hasOption(opts, "stringset"):
+			return Shape{Type: TypeStringSet}
+		case hasOption(opts, "numberset"):
+			return Shape{Type: TypeNumberSet}
+		case hasOption(opts, "binaryset"):
+			return Shape{Type: TypeBinarySet}
+		}
+		elem := shapeOf(t.Elem(), "", visiting)
+		return Shape{Type: TypeMap, Elem: &elem}
+	case reflect.Struct:
+		shape := Shape{Type: TypeMap, Fields: make(map[string]Shape)}
+		// Recursive types are compared to the first level.
+		if visiting[t] {
+			return shape
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		addFields(shape.Fields, t, visiting)
+		return shape
+	}
+	return Shape{Type: TypeAny}
+}
+
+// addFields adds the fields of the struct that are marshaled by attributevalue, using the
+// names in dynamodbav tags. Anonymous struct fields without a name are flattened.
+func addFields(fields map[string]Shape, t reflect.Type, visiting map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("dynamodbav")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct && ft != timeType {
+			addFields(fields, ft, visiting)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = shapeOf(f.Type, opts, visiting)
+	}
+}
+
+func hasOption(opts, option string) bool {
+	for _, o := range strings.Split(opts, ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// ChangeKind is the kind of a change between snapshots.
+type ChangeKind string
+
+// Kinds of change. Removed and TypeChanged changes are breaking, because records stored by
+// the baseline can't be read.
+const (
+	Added       ChangeKind = "added"
+	Removed     ChangeKind = "removed"
+	TypeChanged ChangeKind = "typeChanged"
+)
+
+// Change to the shape of an event or state.
+type Change struct {
+	Kind ChangeKind `json:"kind"`
+	// Name of the event or state.
+	Name string `json:"name"`
+	// Field is the path of the field, e.g. "payment.amount", "items[]" for the elements of
+	// lists, or "prices{}" for the values of maps. Empty if the event or state itself was
+	// added or removed.
+	Field string `json:"field,omitempty"`
+	From  string `json:"from,omitempty"`
+	To    string `json:"to,omitempty"`
+}
+
+// Breaking returns true if records stored with the baseline can't be read.
+func (c Change) Breaking() bool {
+	return c.Kind == Removed || c.Kind == TypeChanged
+}
+
+func (c Change) String() string {
+	name := c.Name
+	if c.Field != "" {
+		name += "." + c.Field
+	}
+	if c.Kind == TypeChanged {
+		return fmt.Sprintf("%s: type changed from %s to %s", name, c.From, c.To)
+	}
+	return fmt.Sprintf("%s: %s", name, c.Kind)
+}
+
+// IncompatibleError is returned by Check when there are breaking changes.
+type IncompatibleError struct {
+	Changes []Change `json:"changes"`
+}
+
+func (e *IncompatibleError) Error() string {
+	msgs := make([]string, len(e.Changes))
+	for i, c := range e.Changes {
+		msgs[i] = c.String()
+	}
+	return fmt.Sprintf("compat: incompatible changes: %s", strings.Join(msgs, "; "))
+}
+
+func (e *IncompatibleError) Is(target error) bool {
+	return target == ErrIncompatible
+}
+
+// Compare the current snapshot to the baseline, returning the changes, sorted by name and
+// field.
+func Compare(baseline, current Snapshot) (changes []Change) {
+	for name, b := range baseline {
+		c, ok := current[name]
+		if !ok {
+			changes = append(changes, Change{Kind: Removed, Name: name})
+			continue
+		}
+		changes = append(changes, compareShapes(name, "", b, c)...)
+	}
+	for name := range current {
+		if _, ok := baseline[name]; !ok {
+			changes = append(changes, Change{Kind: Added, Name: name})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Name != changes[j].Name {
+			return changes[i].Name < changes[j].Name
+		}
+		return changes[i].Field < changes[j].Field
+	})
+	return
+}
+
+func compareShapes(name, path string, baseline, current Shape) (changes []Change) {
+	if baseline.Type == TypeAny || current.Type == TypeAny {
+		return
+	}
+	if baseline.Type != current.Type || baseline.Name != current.Name {
+		return []Change{{Kind: TypeChanged, Name: name, Field: path, From: baseline.describe(), To: current.describe()}}
+	}
+	if baseline.Elem != nil && current.Elem != nil {
+		suffix := "[]"
+		if baseline.Type == TypeMap {
+			suffix = "{}"
+		}
+		changes = append(changes, compareShapes(name, path+suffix, *baseline.Elem, *current.Elem)...)
+	}
+	for field, b := range baseline.Fields {
+		c, ok := current.Fields[field]
+		if !ok {
+			changes = append(changes, Change{Kind: Removed, Name: name, Field: join(path, field)})
+			continue
+		}
+		changes = append(changes, compareShapes(name, join(path, field), b, c)...)
+	}
+	for field := range current.Fields {
+		if _, ok := baseline.Fields[field]; !ok {
+			changes = append(changes, Change{Kind: Added, Name: name, Field: join(path, field)})
+		}
+	}
+	return
+}
+
+func (s Shape) describe() string {
+	if s.Name != "" {
+		return s.Type + "(" + s.Name + ")"
+	}
+	return s.Type
+}
+
+func join(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+// Check returns an *IncompatibleError containing the breaking changes between the baseline
+// and the current snapshot, if there are any.
+func Check(baseline, current Snapshot) error {
+	var breaking []Change
+	for _, c := range Compare(baseline, current) {
+		if c.Breaking() {
+			breaking = append(breaking, c)
+		}
+	}
+	if len(breaking) > 0 {
+		return &IncompatibleError{Changes: breaking}
+	}
+	return nil
+}
+
+// CheckFile checks the current snapshot against the baseline stored in the file. If the
+// file doesn't exist, or the current snapshot is compatible, the file is updated to the
+// current snapshot, so that added fields become part of the baseline.
+func CheckFile(name string, current Snapshot) (err error) {
+	f, err := os.Open(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("compat: failed to open baseline: %w", err)
+	}
+	if err == nil {
+		baseline, err := Load(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if err = Check(baseline, current); err != nil {
+			return err
+		}
+	}
+	f, err = os.Create(name)
+	if err != nil {
+		return fmt.Errorf("compat: failed to write baseline: %w", err)
+	}
+	defer f.Close()
+	return current.Write(f)
+}
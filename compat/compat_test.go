@@ -0,0 +1,165 @@
+package compat
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/a-h/stream"
+	"github.com/google/go-cmp/cmp"
+)
+
+type Payment struct {
+	Amount   int      `dynamodbav:"amount"`
+	Currency string   `dynamodbav:"currency"`
+	Tags     []string `dynamodbav:"tags,stringset"`
+}
+
+type GameWonV1 struct {
+	Payout    int               `dynamodbav:"payout"`
+	Payment   Payment           `dynamodbav:"payment"`
+	Lines     []Payment         `dynamodbav:"lines"`
+	Prices    map[string]int    `dynamodbav:"prices"`
+	At        time.Time         `dynamodbav:"at"`
+	Ignored   string            `dynamodbav:"-"`
+	Extra     interface{}       `dynamodbav:"extra"`
+	Overrides map[string]string `dynamodbav:"overrides"`
+}
+
+func (GameWonV1) EventName() string { return "GameWon" }
+func (GameWonV1) IsOutbound()       {}
+
+type GameWonV2 struct {
+	Payout  string `dynamodbav:"payout"`
+	Payment struct {
+		Amount int `dynamodbav:"amount"`
+	} `dynamodbav:"payment"`
+	Lines     []Payment         `dynamodbav:"lines"`
+	Prices    map[string]string `dynamodbav:"prices"`
+	At        time.Time         `dynamodbav:"at"`
+	Extra     int               `dynamodbav:"extra"`
+	Overrides map[string]string `dynamodbav:"overrides"`
+	Jackpot   bool              `dynamodbav:"jackpot"`
+}
+
+func TestShape(t *testing.T) {
+	// Act.
+	s := New().Add("Payment", Payment{})
+
+	// Assert.
+	expected := Snapshot{
+		"Payment": {
+			Type: TypeMap,
+			Fields: map[string]Shape{
+				"amount":   {Type: TypeNumber},
+				"currency": {Type: TypeString},
+				"tags":     {Type: TypeStringSet},
+			},
+		},
+	}
+	if diff := cmp.Diff(expected, s); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// Arrange.
+	baseline := New().Add("GameWon", GameWonV1{}).Add("Removed", Payment{})
+	current := New().Add("GameWon", GameWonV2{}).Add("Added", Payment{})
+
+	// Act.
+	changes := Compare(baseline, current)
+
+	// Assert.
+	expected := []Change{
+		{Kind: Added, Name: "Added"},
+		{Kind: Added, Name: "GameWon", Field: "jackpot"},
+		{Kind: Removed, Name: "GameWon", Field: "payment.currency"},
+		{Kind: Removed, Name: "GameWon", Field: "payment.tags"},
+		{Kind: TypeChanged, Name: "GameWon", Field: "payout", From: TypeNumber, To: TypeString},
+		{Kind: TypeChanged, Name: "GameWon", Field: "prices{}", From: TypeNumber, To: TypeString},
+		{Kind: Removed, Name: "Removed"},
+	}
+	if diff := cmp.Diff(expected, changes); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestCheckReturnsBreakingChanges(t *testing.T) {
+	// Arrange.
+	baseline := New().Add("GameWon", GameWonV1{})
+	current := New().Add("GameWon", GameWonV2{})
+
+	// Act.
+	err := Check(baseline, current)
+
+	// Assert.
+	if !errors.Is(err, ErrIncompatible) {
+		t.Fatalf("expected ErrIncompatible, got %v", err)
+	}
+	var ie *IncompatibleError
+	if !errors.As(err, &ie) || len(ie.Changes) != 4 {
+		t.Errorf("expected 4 breaking changes, got %v", err)
+	}
+}
+
+func TestCheckAllowsAddedFields(t *testing.T) {
+	// Arrange.
+	baseline := New().Add("Payment", struct {
+		Amount int `dynamodbav:"amount"`
+	}{})
+	current := New().Add("Payment", Payment{})
+
+	// Act.
+	err := Check(baseline, current)
+
+	// Assert.
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestFromRegistry(t *testing.T) {
+	// Arrange.
+	r := stream.NewRegistry()
+	stream.RegisterOutbound[GameWonV1](r.Outbound)
+
+	// Act.
+	s := FromRegistry(r)
+
+	// Assert.
+	if diff := cmp.Diff(New().Add("GameWon", GameWonV1{}), s); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestCheckFile(t *testing.T) {
+	// Arrange.
+	name := filepath.Join(t.TempDir(), "compat.json")
+
+	// Act.
+	err := CheckFile(name, New().Add("GameWon", GameWonV1{}))
+	if err != nil {
+		t.Fatalf("failed to create baseline: %v", err)
+	}
+	err = CheckFile(name, New().Add("GameWon", GameWonV2{}))
+
+	// Assert.
+	if !errors.Is(err, ErrIncompatible) {
+		t.Errorf("expected ErrIncompatible, got %v", err)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatalf("failed to open baseline: %v", err)
+	}
+	defer f.Close()
+	baseline, err := Load(f)
+	if err != nil {
+		t.Fatalf("failed to load baseline: %v", err)
+	}
+	if diff := cmp.Diff(New().Add("GameWon", GameWonV1{}), baseline); diff != "" {
+		t.Errorf("expected the baseline not to be updated: %s", diff)
+	}
+}
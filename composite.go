@@ -0,0 +1,55 @@
+package stream
+
+// Component is part of a Composite state, with its own Process method.
+type Component interface {
+	State
+	// Handles returns the names of the inbound events that the component processes.
+	Handles() []string
+}
+
+// Composite can be implemented by states that are composed of components, instead of
+// handling every inbound event in a single Process method. The Processor and Repair route
+// each inbound event to the components that handle it, in the order that they're
+// returned by Components, and merge their outbound events. The components must be part
+// of the state, e.g. pointers to its fields, so that they're stored with it.
+//
+// The state's own Process method isn't called by the Processor, but implement it with
+// ProcessComponents so that the state can be used directly, e.g. in tests.
+type Composite interface {
+	Components() []Component
+}
+
+// ProcessComponents passes the event to each of the components that handle it, and
+// returns their outbound events.
+func ProcessComponents(c Composite, event InboundEvent) (outbound []OutboundEvent, err error) {
+	name := event.EventName()
+	for _, component := range c.Components() {
+		if !handles(component, name) {
+			continue
+		}
+		var o []OutboundEvent
+		o, err = component.Process(event)
+		if err != nil {
+			return
+		}
+		outbound = append(outbound, o...)
+	}
+	return
+}
+
+func handles(c Component, eventName string) bool {
+	for _, name := range c.Handles() {
+		if name == eventName {
+			return true
+		}
+	}
+	return false
+}
+
+// processEvent passes the event to the state, or its components if it's a Composite.
+func processEvent(state State, event InboundEvent) (outbound []OutboundEvent, err error) {
+	if c, ok := state.(Composite); ok {
+		return ProcessComponents(c, event)
+	}
+	return state.Process(event)
+}
@@ -0,0 +1,77 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type Totals struct {
+	Sum int
+}
+
+func (t *Totals) Handles() []string { return []string{"Add", "Subtract"} }
+func (t *Totals) Process(event InboundEvent) (outbound []OutboundEvent, err error) {
+	switch e := event.(type) {
+	case Add:
+		t.Sum += e.Number
+	case Subtract:
+		t.Sum -= e.Number
+	}
+	return
+}
+
+type Counter struct {
+	Count int
+}
+
+func (c *Counter) Handles() []string { return []string{"Add"} }
+func (c *Counter) Process(event InboundEvent) (outbound []OutboundEvent, err error) {
+	c.Count++
+	return []OutboundEvent{Count{Number: c.Count}}, nil
+}
+
+type CompositeState struct {
+	Totals  Totals
+	Counter Counter
+}
+
+func (s *CompositeState) Components() []Component { return []Component{&s.Totals, &s.Counter} }
+func (s *CompositeState) Process(event InboundEvent) ([]OutboundEvent, error) {
+	return ProcessComponents(s, event)
+}
+
+func TestCompositeStateRoutesEventsToComponents(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Composite", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	state := &CompositeState{}
+	p, err := New(s, "id", state)
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+
+	// Act.
+	items, err := p.Prepare(Add{Number: 3}, Subtract{Number: 1}, Add{Number: 2})
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Assert.
+	expected := &CompositeState{Totals: Totals{Sum: 4}, Counter: Counter{Count: 2}}
+	if diff := cmp.Diff(expected, state); diff != "" {
+		t.Errorf("unexpected state: %s", diff)
+	}
+	if diff := cmp.Diff([]OutboundEvent{Count{Number: 1}, Count{Number: 2}}, p.Outbound()); diff != "" {
+		t.Errorf("unexpected outbound events: %s", diff)
+	}
+	var stored CompositeState
+	if err = s.Unmarshal(items[0].Put.Item, &stored); err != nil {
+		t.Fatalf("failed to unmarshal state: %v", err)
+	}
+	if diff := cmp.Diff(*expected, stored); diff != "" {
+		t.Errorf("expected the components to be stored with the state: %s", diff)
+	}
+}
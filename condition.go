@@ -0,0 +1,56 @@
+package stream
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrConditionCheckFailed is returned when a condition check added with WithTransactItems
+// fails, e.g. because a user record that must exist has been deleted.
+var ErrConditionCheckFailed = errors.New("a condition check of the transaction failed")
+
+// WithTransactItems adds ConditionCheck, Put, Update or Delete items on other keys or
+// tables to the transaction, e.g. to only accept an event if a user record exists. The
+// items are written as-is, without metadata or encryption.
+func WithTransactItems(items ...types.TransactWriteItem) WriteOption {
+	return func(o *WriteOptions) {
+		o.Items = append(o.Items, items...)
+	}
+}
+
+// ProcessWith processes the inbound events, then stores the updated state and outbound
+// events in a transaction with the additional items.
+//
+//	err := p.ProcessWith([]types.TransactWriteItem{{
+//		ConditionCheck: &types.ConditionCheck{
+//			TableName:           aws.String("users"),
+//			Key:                 userKey,
+//			ConditionExpression: aws.String("attribute_exists(pk)"),
+//		},
+//	}}, PullHandle{})
+func (p *Processor) ProcessWith(items []types.TransactWriteItem, events ...InboundEvent) error {
+	prepared, err := p.Prepare(events...)
+	if err != nil {
+		return err
+	}
+	return p.Execute(append(prepared, items...))
+}
+
+// isExternalItem returns true if the item is a condition check, or is on another table,
+// so it wasn't created by the store.
+func (ddb *DynamoDBStore) isExternalItem(item types.TransactWriteItem) bool {
+	var table *string
+	switch {
+	case item.ConditionCheck != nil:
+		return true
+	case item.Put != nil:
+		table = item.Put.TableName
+	case item.Update != nil:
+		table = item.Update.TableName
+	case item.Delete != nil:
+		table = item.Delete.TableName
+	}
+	return aws.ToString(table) != aws.ToString(ddb.TableName)
+}
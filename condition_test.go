@@ -0,0 +1,101 @@
+package stream
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestPrepareWithTransactItems(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Conditions", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	check := types.TransactWriteItem{
+		ConditionCheck: &types.ConditionCheck{
+			TableName:           aws.String("users"),
+			Key:                 map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: "user"}},
+			ConditionExpression: aws.String("attribute_exists(pk)"),
+		},
+	}
+
+	// Act.
+	items, err := s.PrepareWithOptions("id", 0, &AverageState{}, []InboundEvent{Add{Number: 1}}, nil, WithTransactItems(check))
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Assert.
+	last := items[len(items)-1]
+	if last.ConditionCheck != check.ConditionCheck {
+		t.Fatalf("expected the condition check to be the last item, got %+v", last)
+	}
+	if !s.isExternalItem(last) {
+		t.Error("expected the condition check to be external")
+	}
+	for _, item := range items[:len(items)-1] {
+		if s.isExternalItem(item) {
+			t.Errorf("expected the store's items not to be external, got %+v", item)
+		}
+	}
+}
+
+func TestProcessWithIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	// Arrange.
+	name := createLocalTable(t)
+	defer deleteLocalTable(t, name)
+	s, err := NewStore(name, "Conditions", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	userExists := func(id string) types.TransactWriteItem {
+		return types.TransactWriteItem{
+			ConditionCheck: &types.ConditionCheck{
+				TableName: aws.String(name),
+				Key: map[string]types.AttributeValue{
+					"_pk": &types.AttributeValueMemberS{Value: "Conditions/" + id},
+					"_sk": &types.AttributeValueMemberS{Value: "STATE"},
+				},
+				ConditionExpression: aws.String("attribute_exists(#_pk)"),
+				ExpressionAttributeNames: map[string]string{
+					"#_pk": "_pk",
+				},
+			},
+		}
+	}
+	user, err := New(s, "user", &AverageState{})
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+
+	t.Run("events are rejected if the condition fails", func(t *testing.T) {
+		p, err := New(s, "id", &AverageState{})
+		if err != nil {
+			t.Fatalf("failed to create processor: %v", err)
+		}
+		err = p.ProcessWith([]types.TransactWriteItem{userExists("user")}, Add{Number: 1})
+		if !errors.Is(err, ErrConditionCheckFailed) {
+			t.Errorf("expected ErrConditionCheckFailed, got %v", err)
+		}
+	})
+	t.Run("events are accepted if the condition passes", func(t *testing.T) {
+		err = user.Process(Add{Number: 1})
+		if err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+		p, err := New(s, "id", &AverageState{})
+		if err != nil {
+			t.Fatalf("failed to create processor: %v", err)
+		}
+		err = p.ProcessWith([]types.TransactWriteItem{userExists("user")}, Add{Number: 1})
+		if err != nil {
+			t.Errorf("expected the events to be stored, got %v", err)
+		}
+	})
+}
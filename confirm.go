@@ -0,0 +1,106 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Confirmable can be implemented by outbound events that must not be lost. The
+// records are stored with a _pending attribute that the handler removes once
+// EventBridge has acknowledged the event. Records that are still pending can be
+// republished with Republish.
+type Confirmable interface {
+	RequiresConfirmation() bool
+}
+
+func requiresConfirmation(e OutboundEvent) bool {
+	c, ok := e.(Confirmable)
+	return ok && c.RequiresConfirmation()
+}
+
+// Republish touches outbound records in the store's namespace that have been
+// pending for longer than olderThan, so that DynamoDB Streams delivers them to the
+// handler again. It scans the table, so run it periodically, e.g. on a schedule,
+// rather than on each request. It returns the number of records republished.
+func (ddb *DynamoDBStore) Republish(ctx context.Context, olderThan time.Duration) (n int, err error) {
+	now := ddb.Now()
+	si := &dynamodb.ScanInput{
+		TableName:              ddb.TableName,
+		ConsistentRead:         aws.Bool(!ddb.EventuallyConsistentReads),
+		FilterExpression:       aws.String("begins_with(#_pk, :_pk) AND #_pending < :_cutoff"),
+		ProjectionExpression:   aws.String("#_pk, #_sk, #_pending"),
+		ReturnConsumedCapacity: ddb.returnConsumedCapacity(),
+		ExpressionAttributeNames: map[string]string{
+			"#_pk":      "_pk",
+			"#_sk":      "_sk",
+			"#_pending": "_pending",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":_pk":     ddb.attributeValueString(ddb.createPartitionKey("")),
+			":_cutoff": ddb.attributeValueInteger(now.Add(-olderThan).Unix()),
+		},
+	}
+	pages := dynamodb.NewScanPaginator(ddb.Client, si)
+	for pages.HasMorePages() {
+		var page *dynamodb.ScanOutput
+		page, err = pages.NextPage(ctx)
+		if err != nil {
+			return
+		}
+		if page.ConsumedCapacity != nil {
+			ddb.reportCapacity(OperationScan, *page.ConsumedCapacity)
+		}
+		for _, item := range page.Items {
+			var republished bool
+			republished, err = ddb.touchPending(ctx, item, now)
+			if err != nil {
+				return
+			}
+			if republished {
+				n++
+			}
+		}
+	}
+	return
+}
+
+// touchPending updates the _pending timestamp of the record, unless it has been
+// confirmed or touched since it was read.
+func (ddb *DynamoDBStore) touchPending(ctx context.Context, item map[string]types.AttributeValue, now time.Time) (ok bool, err error) {
+	uio, err := ddb.Client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: ddb.TableName,
+		Key: map[string]types.AttributeValue{
+			"_pk": item["_pk"],
+			"_sk": item["_sk"],
+		},
+		UpdateExpression:    aws.String("SET #_pending = :_now ADD #_attempts :_one"),
+		ConditionExpression: aws.String("#_pending = :_pending"),
+		ExpressionAttributeNames: map[string]string{
+			"#_pending":  "_pending",
+			"#_attempts": "_attempts",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":_now":     ddb.attributeValueInteger(now.Unix()),
+			":_one":     &types.AttributeValueMemberN{Value: strconv.Itoa(1)},
+			":_pending": item["_pending"],
+		},
+		ReturnConsumedCapacity: ddb.returnConsumedCapacity(),
+	})
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return false, nil
+		}
+		return
+	}
+	if uio.ConsumedCapacity != nil {
+		ddb.reportCapacity(OperationRepublish, *uio.ConsumedCapacity)
+	}
+	return true, nil
+}
@@ -0,0 +1,33 @@
+package stream
+
+import "testing"
+
+type RefundIssued struct {
+	Amount int `dynamodbav:"amount"`
+}
+
+func (RefundIssued) EventName() string          { return "RefundIssued" }
+func (RefundIssued) IsOutbound()                {}
+func (RefundIssued) RequiresConfirmation() bool { return true }
+
+func TestConfirmableEventsArePending(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	// Act.
+	items, err := s.Prepare("id", 0, &AverageState{}, nil, []OutboundEvent{RefundIssued{Amount: 1}, Average{Value: 1}})
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Assert.
+	if _, ok := items[1].Put.Item["_pending"]; !ok {
+		t.Error("expected confirmable events to be pending")
+	}
+	if _, ok := items[2].Put.Item["_pending"]; ok {
+		t.Error("expected other events not to be pending")
+	}
+}
@@ -0,0 +1,302 @@
+// Package consumer processes events received from SQS, or delivered to a Lambda function by
+// an EventBridge rule, e.g. the outbound events of another service, as the inbound events
+// of entities.
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/a-h/stream"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Message received from SQS.
+type Message struct {
+	// ID of the SQS message.
+	ID string
+	// EventID of the event, if it's known. The ID the stream handler stores in the detail's
+	// _metadata is used, since it's the same each time the event is published, falling back
+	// to the ID of the EventBridge event or SQS message attribute.
+	EventID string
+	// DetailType is the name of the event, used to find the registered inbound event.
+	DetailType string
+	// Detail of the event, as JSON.
+	Detail json.RawMessage
+	// Metadata of the event, e.g. its correlationId, if it was published by the stream
+	// handler.
+	Metadata map[string]string
+}
+
+// Extractor reads a value, such as the entity ID, from a message.
+type Extractor func(m Message) (string, error)
+
+// FromJSONField reads a string or number from the detail. Nested fields are separated with
+// a dot, e.g. "order.customerId".
+func FromJSONField(path string) Extractor {
+	return func(m Message) (v string, err error) {
+		var current interface{}
+		d := json.NewDecoder(strings.NewReader(string(m.Detail)))
+		d.UseNumber()
+		if err = d.Decode(&current); err != nil {
+			return
+		}
+		for _, name := range strings.Split(path, ".") {
+			fields, ok := current.(map[string]interface{})
+			if !ok {
+				return "", fmt.Errorf("missing field %q", path)
+			}
+			current = fields[name]
+		}
+		switch value := current.(type) {
+		case string:
+			v = value
+		case json.Number:
+			v = value.String()
+		}
+		if v == "" {
+			err = fmt.Errorf("missing field %q", path)
+		}
+		return
+	}
+}
+
+// Handler decodes SQS messages into registered inbound events, and processes them against
+// the entity returned by ID.
+type Handler struct {
+	Store    stream.Store
+	NewState func(id string) stream.State
+	// Events are the inbound events that can be processed, added with stream.Register.
+	// Messages are decoded from JSON into the event registered with the message's
+	// DetailType. Messages with other detail types are skipped.
+	Events *stream.InboundEventReader
+	// ID reads the ID of the entity to process the event against.
+	ID Extractor
+	// MaxRetries is the number of times that processing is retried if the state is updated
+	// concurrently, see stream.ErrOptimisticConcurrency. Defaults to 3.
+	MaxRetries       int
+	ProcessorOptions []stream.ProcessorOption
+	// Quarantine stores SQS messages that still fail after MaxAttempts deliveries, so that
+	// they can be listed and redriven, see WithQuarantine.
+	Quarantine  Quarantine
+	MaxAttempts int
+	// Deduplicator skips events that have already been processed, see WithDeduplicator.
+	Deduplicator *Deduplicator
+	// Clock is used for the time that messages are quarantined. Defaults to
+	// stream.SystemClock.
+	Clock stream.Clock
+}
+
+// Option configures a Handler.
+type Option func(*Handler)
+
+// WithMaxRetries sets the number of times that processing is retried after an optimistic
+// concurrency error.
+func WithMaxRetries(n int) Option {
+	return func(h *Handler) {
+		h.MaxRetries = n
+	}
+}
+
+// WithProcessorOptions applies the options to each Processor created by the handler.
+func WithProcessorOptions(opts ...stream.ProcessorOption) Option {
+	return func(h *Handler) {
+		h.ProcessorOptions = append(h.ProcessorOptions, opts...)
+	}
+}
+
+// WithClock sets the clock used for the time that messages are quarantined.
+func WithClock(c stream.Clock) Option {
+	return func(h *Handler) {
+		h.Clock = c
+	}
+}
+
+// New creates a Handler that processes the registered events against the entity returned
+// by id.
+func New(store stream.Store, newState func(id string) stream.State, events *stream.InboundEventReader, id Extractor, opts ...Option) *Handler {
+	h := &Handler{
+		Store:      store,
+		NewState:   newState,
+		Events:     events,
+		ID:         id,
+		MaxRetries: 3,
+		Clock:      stream.SystemClock,
+	}
+	for _, o := range opts {
+		o(h)
+	}
+	return h
+}
+
+// HandleRequest processes the messages of the SQS event, and returns the messages that
+// failed, so that only they are retried. The event source mapping must enable
+// ReportBatchItemFailures. For FIFO queues, the later messages of a message group that
+// contains a failed message also fail, so that they're processed in order.
+func (h *Handler) HandleRequest(ctx context.Context, event events.SQSEvent) (resp events.SQSEventResponse, err error) {
+	failedGroups := make(map[string]bool)
+	for _, record := range event.Records {
+		group := record.Attributes["MessageGroupId"]
+		if group != "" && failedGroups[group] {
+			resp.BatchItemFailures = append(resp.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+			continue
+		}
+		if err := h.handle(ctx, record); err != nil {
+			if group != "" {
+				failedGroups[group] = true
+			}
+			resp.BatchItemFailures = append(resp.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+		}
+	}
+	return resp, nil
+}
+
+func (h *Handler) handle(ctx context.Context, record events.SQSMessage) (err error) {
+	m, err := getMessage(record)
+	if err != nil {
+		return
+	}
+	if err = h.processOnce(ctx, m); err != nil {
+		if attempts := getAttempts(record.Attributes); h.shouldQuarantine(attempts, err) {
+			return h.quarantine(ctx, m, attempts, err)
+		}
+	}
+	return
+}
+
+// HandleEventBridgeEvent processes an event delivered to a Lambda function by an
+// EventBridge rule. Returning an error causes EventBridge to retry the invocation.
+func (h *Handler) HandleEventBridgeEvent(ctx context.Context, event events.CloudWatchEvent) error {
+	m := Message{
+		ID:         event.ID,
+		EventID:    event.ID,
+		DetailType: event.DetailType,
+		Detail:     event.Detail,
+	}
+	var err error
+	if m.Metadata, err = getMetadata(m.Detail); err != nil {
+		return err
+	}
+	m.EventID = eventID(m.Metadata, m.EventID)
+	return h.processOnce(ctx, m)
+}
+
+// processOnce processes the message, unless the Deduplicator has recorded its event ID.
+func (h *Handler) processOnce(ctx context.Context, m Message) error {
+	if h.Deduplicator == nil || m.EventID == "" {
+		return h.Process(ctx, m)
+	}
+	return h.Deduplicator.Once(ctx, m.EventID, func(ctx context.Context) error {
+		return h.Process(ctx, m)
+	})
+}
+
+// Process the message against the entity returned by ID, retrying if the state is updated
+// concurrently. Messages whose detail type isn't registered are skipped. If the detail
+// can't be decoded, or the ID can't be read, the error matches ErrInvalidMessage. If the
+// state panics, the error matches ErrPanic.
+func (h *Handler) Process(ctx context.Context, m Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrPanic, r)
+		}
+	}()
+	t, ok := h.Events.Types()[m.DetailType]
+	if !ok {
+		return nil
+	}
+	event, err := decode(t, m.Detail)
+	if err != nil {
+		return fmt.Errorf("%w: failed to decode %s: %v", ErrInvalidMessage, m.DetailType, err)
+	}
+	id, err := h.ID(m)
+	if err != nil {
+		return fmt.Errorf("%w: failed to get id: %v", ErrInvalidMessage, err)
+	}
+	opts := append([]stream.ProcessorOption{stream.WithMetadata(stream.EventMetadata{
+		CorrelationID: m.Metadata["correlationId"],
+		CausationID:   m.EventID,
+	})}, h.ProcessorOptions...)
+	client := stream.NewNamespaceClient(h.Store, h.NewState, stream.WithProcessorOptions[stream.State](opts...))
+	for attempt := 0; ; attempt++ {
+		_, err = client.Process(ctx, id, event)
+		if !errors.Is(err, stream.ErrOptimisticConcurrency) || attempt >= h.MaxRetries {
+			return
+		}
+		if err = ctx.Err(); err != nil {
+			return
+		}
+	}
+}
+
+// eventBridgeEvent is the body of messages sent to SQS by EventBridge rules.
+type eventBridgeEvent struct {
+	ID         string          `json:"id"`
+	DetailType string          `json:"detail-type"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// getMessage reads the message from the body of an EventBridge event, or from a body that
+// contains the detail, with a detailType message attribute, as sent by the stream handler's
+// SQS sink.
+func getMessage(record events.SQSMessage) (m Message, err error) {
+	m.ID = record.MessageId
+	if dt, ok := record.MessageAttributes["detailType"]; ok && dt.StringValue != nil {
+		m.DetailType = *dt.StringValue
+		m.Detail = json.RawMessage(record.Body)
+		if id, ok := record.MessageAttributes["eventId"]; ok && id.StringValue != nil {
+			m.EventID = *id.StringValue
+		}
+	} else {
+		var e eventBridgeEvent
+		if err = json.Unmarshal([]byte(record.Body), &e); err != nil {
+			return m, fmt.Errorf("invalid message body: %w", err)
+		}
+		if e.DetailType == "" {
+			return m, errors.New("missing detail type")
+		}
+		m.DetailType, m.Detail, m.EventID = e.DetailType, e.Detail, e.ID
+	}
+	if m.Metadata, err = getMetadata(m.Detail); err != nil {
+		return
+	}
+	m.EventID = eventID(m.Metadata, m.EventID)
+	return
+}
+
+// eventID returns the event ID from the metadata, which is stable across republishing,
+// e.g. by the sweeper or a dead letter replay, or the fallback if there isn't one.
+func eventID(metadata map[string]string, fallback string) string {
+	if id := metadata["eventId"]; id != "" {
+		return id
+	}
+	return fallback
+}
+
+// getMetadata reads the metadata that the stream handler adds to the detail of events.
+func getMetadata(detail json.RawMessage) (metadata map[string]string, err error) {
+	var d struct {
+		Metadata map[string]string `json:"_metadata"`
+	}
+	if err = json.Unmarshal(detail, &d); err != nil {
+		return nil, fmt.Errorf("invalid detail: %w", err)
+	}
+	return d.Metadata, nil
+}
+
+// decode the detail into a new value of the registered event type.
+func decode(t reflect.Type, detail json.RawMessage) (event stream.InboundEvent, err error) {
+	v := reflect.New(t)
+	if err = json.Unmarshal(detail, v.Interface()); err != nil {
+		return
+	}
+	event, ok := v.Elem().Interface().(stream.InboundEvent)
+	if !ok {
+		err = fmt.Errorf("%v is not an inbound event", t)
+	}
+	return
+}
@@ -0,0 +1,317 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/a-h/stream"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+type OrderPlaced struct {
+	OrderID    string `json:"orderId"`
+	CustomerID string `json:"customerId" validate:"required"`
+	Total      int    `json:"total"`
+}
+
+func (OrderPlaced) EventName() string { return "OrderPlaced" }
+func (OrderPlaced) IsInbound()        {}
+
+type Customer struct {
+	Spent int
+}
+
+func (c *Customer) Process(event stream.InboundEvent) (outbound []stream.OutboundEvent, err error) {
+	if e, ok := event.(OrderPlaced); ok {
+		if e.Total < 0 {
+			panic("negative total")
+		}
+		c.Spent += e.Total
+	}
+	return
+}
+
+type memoryStore struct {
+	stream.Store
+	// conflicts is the number of optimistic concurrency errors to return.
+	conflicts int
+	processed map[string][]stream.InboundEvent
+	metadata  []stream.EventMetadata
+}
+
+func (s *memoryStore) Get(id string, state stream.State) (sequence int64, err error) {
+	if _, ok := s.processed[id]; !ok {
+		err = stream.ErrStateNotFound
+	}
+	return
+}
+
+func (s *memoryStore) Prepare(id string, atSequence int64, state stream.State, inbound []stream.InboundEvent, outbound []stream.OutboundEvent) (items []types.TransactWriteItem, err error) {
+	return s.PrepareWithOptions(id, atSequence, state, inbound, outbound)
+}
+
+func (s *memoryStore) PrepareWithOptions(id string, atSequence int64, state stream.State, inbound []stream.InboundEvent, outbound []stream.OutboundEvent, opts ...stream.WriteOption) (items []types.TransactWriteItem, err error) {
+	if s.conflicts > 0 {
+		s.conflicts--
+		return nil, stream.ErrOptimisticConcurrency
+	}
+	var o stream.WriteOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	s.processed[id] = append(s.processed[id], inbound...)
+	s.metadata = append(s.metadata, o.Metadata)
+	return
+}
+
+func (s *memoryStore) Execute(items []types.TransactWriteItem) error {
+	return nil
+}
+
+func message(id, body string, attributes map[string]string) events.SQSMessage {
+	m := events.SQSMessage{
+		MessageId:         id,
+		Body:              body,
+		MessageAttributes: make(map[string]events.SQSMessageAttribute),
+		Attributes:        make(map[string]string),
+	}
+	for k, v := range attributes {
+		v := v
+		if k == "MessageGroupId" || k == "ApproximateReceiveCount" {
+			m.Attributes[k] = v
+			continue
+		}
+		m.MessageAttributes[k] = events.SQSMessageAttribute{StringValue: &v, DataType: "String"}
+	}
+	return m
+}
+
+func TestHandler(t *testing.T) {
+	eventBridgeBody := `{"id":"eb-1","detail-type":"OrderPlaced","source":"orders","detail":{"orderId":"1","customerId":"cus_1","total":100,"_metadata":{"correlationId":"corr-1"}}}`
+	var tests = []struct {
+		name              string
+		messages          []events.SQSMessage
+		conflicts         int
+		expectedFailures  []string
+		expectedProcessed map[string][]stream.InboundEvent
+	}{
+		{
+			name:     "messages sent by EventBridge rules are processed",
+			messages: []events.SQSMessage{message("1", eventBridgeBody, nil)},
+			expectedProcessed: map[string][]stream.InboundEvent{
+				"cus_1": {OrderPlaced{OrderID: "1", CustomerID: "cus_1", Total: 100}},
+			},
+		},
+		{
+			name: "messages sent by the stream handler are processed",
+			messages: []events.SQSMessage{
+				message("1", `{"orderId":"2","customerId":"cus_2","total":50}`, map[string]string{"detailType": "OrderPlaced", "eventId": "evt-2"}),
+			},
+			expectedProcessed: map[string][]stream.InboundEvent{
+				"cus_2": {OrderPlaced{OrderID: "2", CustomerID: "cus_2", Total: 50}},
+			},
+		},
+		{
+			name: "unregistered events are skipped",
+			messages: []events.SQSMessage{
+				message("1", `{}`, map[string]string{"detailType": "OrderViewed"}),
+			},
+			expectedProcessed: map[string][]stream.InboundEvent{},
+		},
+		{
+			name:      "optimistic concurrency errors are retried",
+			messages:  []events.SQSMessage{message("1", eventBridgeBody, nil)},
+			conflicts: 2,
+			expectedProcessed: map[string][]stream.InboundEvent{
+				"cus_1": {OrderPlaced{OrderID: "1", CustomerID: "cus_1", Total: 100}},
+			},
+		},
+		{
+			name:              "messages fail after the retries",
+			messages:          []events.SQSMessage{message("1", eventBridgeBody, nil)},
+			conflicts:         4,
+			expectedFailures:  []string{"1"},
+			expectedProcessed: map[string][]stream.InboundEvent{},
+		},
+		{
+			name: "invalid messages fail",
+			messages: []events.SQSMessage{
+				message("1", "not json", nil),
+				message("2", `{"orderId":"3","total":50}`, map[string]string{"detailType": "OrderPlaced"}),
+				message("3", `{"orderId":"4","customerId":"cus_4","total":50}`, map[string]string{"detailType": "OrderPlaced"}),
+			},
+			expectedFailures: []string{"1", "2"},
+			expectedProcessed: map[string][]stream.InboundEvent{
+				"cus_4": {OrderPlaced{OrderID: "4", CustomerID: "cus_4", Total: 50}},
+			},
+		},
+		{
+			name: "later messages of a FIFO message group fail after a failure",
+			messages: []events.SQSMessage{
+				message("1", "not json", map[string]string{"MessageGroupId": "a"}),
+				message("2", `{"orderId":"5","customerId":"cus_5","total":50}`, map[string]string{"detailType": "OrderPlaced", "MessageGroupId": "a"}),
+				message("3", `{"orderId":"6","customerId":"cus_6","total":50}`, map[string]string{"detailType": "OrderPlaced", "MessageGroupId": "b"}),
+			},
+			expectedFailures: []string{"1", "2"},
+			expectedProcessed: map[string][]stream.InboundEvent{
+				"cus_6": {OrderPlaced{OrderID: "6", CustomerID: "cus_6", Total: 50}},
+			},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			store := &memoryStore{conflicts: test.conflicts, processed: make(map[string][]stream.InboundEvent)}
+			reader := stream.NewInboundEventReader()
+			stream.Register[OrderPlaced](reader)
+			h := New(store, func(id string) stream.State { return &Customer{} }, reader, FromJSONField("customerId"))
+
+			// Act.
+			resp, err := h.HandleRequest(context.Background(), events.SQSEvent{Records: test.messages})
+
+			// Assert.
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var failures []string
+			for _, f := range resp.BatchItemFailures {
+				failures = append(failures, f.ItemIdentifier)
+			}
+			if diff := cmp.Diff(test.expectedFailures, failures); diff != "" {
+				t.Errorf("unexpected failures: %s", diff)
+			}
+			if diff := cmp.Diff(test.expectedProcessed, store.processed); diff != "" {
+				t.Errorf("unexpected events processed: %s", diff)
+			}
+		})
+	}
+}
+
+func TestHandlerPropagatesMetadata(t *testing.T) {
+	// Arrange.
+	store := &memoryStore{processed: make(map[string][]stream.InboundEvent)}
+	reader := stream.NewInboundEventReader()
+	stream.Register[OrderPlaced](reader)
+	h := New(store, func(id string) stream.State { return &Customer{} }, reader, FromJSONField("customerId"))
+	body := `{"id":"eb-1","detail-type":"OrderPlaced","detail":{"customerId":"cus_1","_metadata":{"correlationId":"corr-1"}}}`
+
+	// Act.
+	_, err := h.HandleRequest(context.Background(), events.SQSEvent{Records: []events.SQSMessage{message("1", body, nil)}})
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []stream.EventMetadata{{CorrelationID: "corr-1", CausationID: "eb-1"}}
+	if diff := cmp.Diff(expected, store.metadata); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestGetMessageEventID(t *testing.T) {
+	var tests = []struct {
+		name     string
+		record   events.SQSMessage
+		expected string
+	}{
+		{
+			name:     "the metadata event ID is preferred to the EventBridge event ID",
+			record:   message("1", `{"id":"eb-1","detail-type":"OrderPlaced","detail":{"_metadata":{"eventId":"evt-1"}}}`, nil),
+			expected: "evt-1",
+		},
+		{
+			name:     "the EventBridge event ID is used if there's no metadata event ID",
+			record:   message("1", `{"id":"eb-1","detail-type":"OrderPlaced","detail":{}}`, nil),
+			expected: "eb-1",
+		},
+		{
+			name:     "the metadata event ID is preferred to the message attribute",
+			record:   message("1", `{"_metadata":{"eventId":"evt-1"}}`, map[string]string{"detailType": "OrderPlaced", "eventId": "attr-1"}),
+			expected: "evt-1",
+		},
+		{
+			name:     "the message attribute is used if there's no metadata event ID",
+			record:   message("1", `{}`, map[string]string{"detailType": "OrderPlaced", "eventId": "attr-1"}),
+			expected: "attr-1",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Act.
+			m, err := getMessage(test.record)
+
+			// Assert.
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if m.EventID != test.expected {
+				t.Errorf("expected event ID %q, got %q", test.expected, m.EventID)
+			}
+		})
+	}
+}
+
+func TestHandleEventBridgeEvent(t *testing.T) {
+	var tests = []struct {
+		name              string
+		event             events.CloudWatchEvent
+		expectError       bool
+		expectedProcessed map[string][]stream.InboundEvent
+	}{
+		{
+			name: "registered events are processed",
+			event: events.CloudWatchEvent{
+				ID:         "eb-1",
+				DetailType: "OrderPlaced",
+				Detail:     []byte(`{"orderId":"1","customerId":"cus_1","total":100}`),
+			},
+			expectedProcessed: map[string][]stream.InboundEvent{
+				"cus_1": {OrderPlaced{OrderID: "1", CustomerID: "cus_1", Total: 100}},
+			},
+		},
+		{
+			name: "unregistered events are skipped",
+			event: events.CloudWatchEvent{
+				ID:         "eb-2",
+				DetailType: "OrderViewed",
+				Detail:     []byte(`{}`),
+			},
+			expectedProcessed: map[string][]stream.InboundEvent{},
+		},
+		{
+			name: "events that can't be processed return an error",
+			event: events.CloudWatchEvent{
+				ID:         "eb-3",
+				DetailType: "OrderPlaced",
+				Detail:     []byte(`{"orderId":"3"}`),
+			},
+			expectError:       true,
+			expectedProcessed: map[string][]stream.InboundEvent{},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			store := &memoryStore{processed: make(map[string][]stream.InboundEvent)}
+			reader := stream.NewInboundEventReader()
+			stream.Register[OrderPlaced](reader)
+			h := New(store, func(id string) stream.State { return &Customer{} }, reader, FromJSONField("customerId"))
+
+			// Act.
+			err := h.HandleEventBridgeEvent(context.Background(), test.event)
+
+			// Assert.
+			if test.expectError != (err != nil) {
+				t.Errorf("expected error %v, got %v", test.expectError, err)
+			}
+			if diff := cmp.Diff(test.expectedProcessed, store.processed); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/a-h/stream"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrInProgress is returned by Deduplicator.Once if another invocation holds the lease of
+// the event, and hasn't finished processing it. The message should be retried, so that it's
+// processed if the other invocation stops before it finishes.
+var ErrInProgress = errors.New("the event is being processed by another invocation")
+
+// DynamoDBAPI is the subset of the DynamoDB client used by the Deduplicator.
+type DynamoDBAPI interface {
+	GetItem(context.Context, *dynamodb.GetItemInput, ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(context.Context, *dynamodb.PutItemInput, ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DeleteItem(context.Context, *dynamodb.DeleteItemInput, ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// Deduplicator records the IDs of the events that a consumer has processed, using a
+// conditional write, so that events redelivered by EventBridge or SQS are only processed
+// once. It can be used with any consumer of outbound events, not only the Handler.
+//
+// Records are stored in a table with the same key schema as a stream table. Enable TTL on
+// the table's _ttl attribute so that expired records are deleted.
+type Deduplicator struct {
+	Client    DynamoDBAPI
+	TableName string
+	// Name of the consumer, so that consumers can share a table.
+	Name string
+	// TTL is how long event IDs are remembered. It should be longer than the event can be
+	// redelivered for, e.g. EventBridge retries for up to 24 hours. Defaults to 48 hours.
+	TTL time.Duration
+	// LeaseDuration is how long Once skips an event while it's being processed. If the
+	// process stops before the event is processed, it's processed again once the lease
+	// expires. It should be longer than processing takes. Defaults to 5 minutes.
+	LeaseDuration time.Duration
+	// Clock is used for the expiry of records. Defaults to stream.SystemClock.
+	Clock stream.Clock
+}
+
+// NewDeduplicator creates a Deduplicator that stores event IDs in the table.
+func NewDeduplicator(client DynamoDBAPI, tableName, name string) *Deduplicator {
+	return &Deduplicator{
+		Client:        client,
+		TableName:     tableName,
+		Name:          name,
+		TTL:           48 * time.Hour,
+		LeaseDuration: 5 * time.Minute,
+		Clock:         stream.SystemClock,
+	}
+}
+
+func (d *Deduplicator) key(eventID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"_pk": &types.AttributeValueMemberS{Value: "DEDUPLICATE/" + d.Name + "/" + eventID},
+		"_sk": &types.AttributeValueMemberS{Value: "DEDUPLICATE"},
+	}
+}
+
+// Claim records the event ID, and returns false if it has already been recorded, and
+// hasn't expired.
+func (d *Deduplicator) Claim(ctx context.Context, eventID string) (ok bool, err error) {
+	return d.claim(ctx, eventID, d.TTL)
+}
+
+func (d *Deduplicator) claim(ctx context.Context, eventID string, ttl time.Duration) (ok bool, err error) {
+	now := d.Clock.Now()
+	item := d.key(eventID)
+	item["_ttl"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(ttl).Unix(), 10)}
+	_, err = d.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(d.TableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(#_pk) OR #_ttl < :_now"),
+		ExpressionAttributeNames: map[string]string{
+			"#_pk":  "_pk",
+			"#_ttl": "_ttl",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":_now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		},
+	})
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to claim event %s: %w", eventID, err)
+	}
+	return true, nil
+}
+
+// Release removes the event ID, so that the event can be processed again.
+func (d *Deduplicator) Release(ctx context.Context, eventID string) error {
+	_, err := d.Client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(d.TableName),
+		Key:       d.key(eventID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to release event %s: %w", eventID, err)
+	}
+	return nil
+}
+
+// complete records that the event has been processed, for the TTL.
+func (d *Deduplicator) complete(ctx context.Context, eventID string) error {
+	item := d.key(eventID)
+	item["_ttl"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(d.Clock.Now().Add(d.TTL).Unix(), 10)}
+	item["_completed"] = &types.AttributeValueMemberBOOL{Value: true}
+	_, err := d.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(d.TableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("processed event %s, but failed to record it: %w", eventID, err)
+	}
+	return nil
+}
+
+// completed returns true if the event has been processed, rather than leased.
+func (d *Deduplicator) completed(ctx context.Context, eventID string) (ok bool, err error) {
+	gio, err := d.Client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(d.TableName),
+		Key:            d.key(eventID),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to get event %s: %w", eventID, err)
+	}
+	completed, isBool := gio.Item["_completed"].(*types.AttributeValueMemberBOOL)
+	return isBool && completed.Value, nil
+}
+
+// Once calls f, unless the event has already been processed, or is being processed. The
+// event ID is claimed for the LeaseDuration while f runs, and for the TTL once f succeeds.
+// If f returns an error, the event ID is released, so that a redelivery of the event is
+// processed. If another invocation holds the lease, ErrInProgress is returned, so that the
+// event is retried, and processed once the lease expires if that invocation stops before
+// f returns.
+func (d *Deduplicator) Once(ctx context.Context, eventID string, f func(ctx context.Context) error) (err error) {
+	ok, err := d.claim(ctx, eventID, d.LeaseDuration)
+	if err != nil {
+		return
+	}
+	if !ok {
+		if ok, err = d.completed(ctx, eventID); err != nil || ok {
+			return
+		}
+		return ErrInProgress
+	}
+	if err = f(ctx); err != nil {
+		if rerr := d.Release(ctx, eventID); rerr != nil {
+			return fmt.Errorf("%w: %v", err, rerr)
+		}
+		return
+	}
+	return d.complete(ctx, eventID)
+}
+
+// WithDeduplicator skips messages whose event ID has already been processed. Messages
+// without an event ID are always processed.
+func WithDeduplicator(d *Deduplicator) Option {
+	return func(h *Handler) {
+		h.Deduplicator = d
+	}
+}
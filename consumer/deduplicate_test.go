@@ -0,0 +1,199 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/a-h/stream"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+// conditionalDynamoDB stores the TTL of each claimed key, and fails claims of keys that
+// haven't expired.
+type conditionalDynamoDB struct {
+	ttls      map[string]int64
+	completed map[string]bool
+}
+
+func newConditionalDynamoDB() *conditionalDynamoDB {
+	return &conditionalDynamoDB{ttls: map[string]int64{}, completed: map[string]bool{}}
+}
+
+func (db *conditionalDynamoDB) GetItem(_ context.Context, input *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	pk := input.Key["_pk"].(*types.AttributeValueMemberS).Value
+	if _, ok := db.ttls[pk]; !ok {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	item := map[string]types.AttributeValue{"_pk": input.Key["_pk"]}
+	if db.completed[pk] {
+		item["_completed"] = &types.AttributeValueMemberBOOL{Value: true}
+	}
+	return &dynamodb.GetItemOutput{Item: item}, nil
+}
+
+func (db *conditionalDynamoDB) PutItem(_ context.Context, input *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	pk := input.Item["_pk"].(*types.AttributeValueMemberS).Value
+	if input.ConditionExpression != nil {
+		now, _ := strconv.ParseInt(input.ExpressionAttributeValues[":_now"].(*types.AttributeValueMemberN).Value, 10, 64)
+		if ttl, ok := db.ttls[pk]; ok && ttl >= now {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+	}
+	db.ttls[pk], _ = strconv.ParseInt(input.Item["_ttl"].(*types.AttributeValueMemberN).Value, 10, 64)
+	_, db.completed[pk] = input.Item["_completed"]
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (db *conditionalDynamoDB) DeleteItem(_ context.Context, input *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	delete(db.ttls, input.Key["_pk"].(*types.AttributeValueMemberS).Value)
+	delete(db.completed, input.Key["_pk"].(*types.AttributeValueMemberS).Value)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestDeduplicator(t *testing.T) {
+	start := time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		attempts []time.Time
+		errs     []error
+		expected []bool
+	}{
+		{
+			name:     "events are processed once",
+			attempts: []time.Time{start, start.Add(time.Minute)},
+			expected: []bool{true, false},
+		},
+		{
+			name:     "events that fail are processed again",
+			attempts: []time.Time{start, start.Add(time.Minute)},
+			errs:     []error{errors.New("failed"), nil},
+			expected: []bool{true, true},
+		},
+		{
+			name:     "events are processed again once the TTL has passed",
+			attempts: []time.Time{start, start.Add(49 * time.Hour)},
+			expected: []bool{true, true},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			d := NewDeduplicator(newConditionalDynamoDB(), "table", "consumer")
+			var processed []bool
+
+			// Act.
+			for i, at := range test.attempts {
+				at := at
+				d.Clock = stream.ClockFunc(func() time.Time { return at })
+				var called bool
+				err := d.Once(context.Background(), "event-1", func(ctx context.Context) error {
+					called = true
+					if i < len(test.errs) {
+						return test.errs[i]
+					}
+					return nil
+				})
+				if err != nil && (i >= len(test.errs) || test.errs[i] == nil) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				processed = append(processed, called)
+			}
+
+			// Assert.
+			if diff := cmp.Diff(test.expected, processed); diff != "" {
+				t.Errorf("unexpected processing: %s", diff)
+			}
+		})
+	}
+}
+
+func TestDeduplicatorLeasesEventsWhileTheyAreProcessed(t *testing.T) {
+	// Arrange.
+	now := time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+	db := newConditionalDynamoDB()
+	d := NewDeduplicator(db, "table", "consumer")
+	d.Clock = stream.ClockFunc(func() time.Time { return now })
+	pk := "DEDUPLICATE/consumer/event-1"
+	var leaseTTL int64
+
+	// Act.
+	err := d.Once(context.Background(), "event-1", func(ctx context.Context) error {
+		leaseTTL = db.ttls[pk]
+		return nil
+	})
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := now.Add(5 * time.Minute).Unix(); leaseTTL != expected {
+		t.Errorf("expected a lease until %d while processing, got %d", expected, leaseTTL)
+	}
+	if expected := now.Add(48 * time.Hour).Unix(); db.ttls[pk] != expected {
+		t.Errorf("expected the event to be remembered until %d once processed, got %d", expected, db.ttls[pk])
+	}
+}
+
+func TestDeduplicatorReturnsErrInProgressWhileTheEventIsLeased(t *testing.T) {
+	// Arrange.
+	now := time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+	d := NewDeduplicator(newConditionalDynamoDB(), "table", "consumer")
+	d.Clock = stream.ClockFunc(func() time.Time { return now })
+	var concurrentErr error
+	var concurrentCalled bool
+
+	// Act.
+	err := d.Once(context.Background(), "event-1", func(ctx context.Context) error {
+		concurrentErr = d.Once(ctx, "event-1", func(ctx context.Context) error {
+			concurrentCalled = true
+			return nil
+		})
+		return nil
+	})
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !errors.Is(concurrentErr, ErrInProgress) {
+		t.Errorf("expected ErrInProgress while the event is leased, got %v", concurrentErr)
+	}
+	if concurrentCalled {
+		t.Error("expected the leased event not to be processed again")
+	}
+}
+
+func TestHandlerDeduplicatesMessages(t *testing.T) {
+	// Arrange.
+	store := &memoryStore{processed: map[string][]stream.InboundEvent{}}
+	reader := stream.NewInboundEventReader()
+	stream.Register[OrderPlaced](reader)
+	d := NewDeduplicator(newConditionalDynamoDB(), "table", "consumer")
+	h := New(store, func(id string) stream.State { return &Customer{} }, reader, FromJSONField("customerId"), WithDeduplicator(d))
+	body := `{"orderId":"o1","customerId":"c1","total":5}`
+	event := events.SQSEvent{Records: []events.SQSMessage{
+		message("1", body, map[string]string{"detailType": "OrderPlaced", "eventId": "event-1"}),
+		message("2", body, map[string]string{"detailType": "OrderPlaced", "eventId": "event-1"}),
+	}}
+
+	// Act.
+	resp, err := h.HandleRequest(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Assert.
+	if len(resp.BatchItemFailures) != 0 {
+		t.Errorf("expected no failures, got %v", resp.BatchItemFailures)
+	}
+	if diff := cmp.Diff(map[string][]stream.InboundEvent{"c1": {OrderPlaced{OrderID: "o1", CustomerID: "c1", Total: 5}}}, store.processed); diff != "" {
+		t.Errorf("expected the event to be processed once: %s", diff)
+	}
+}
@@ -0,0 +1,137 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/a-h/stream"
+)
+
+// ErrPanic is returned by Process if the state panics while processing the message.
+var ErrPanic = errors.New("panic while processing the message")
+
+// ErrInvalidMessage is returned by Process if the detail of the message can't be decoded
+// into its registered event, or the entity ID can't be read from it. Retrying doesn't help,
+// so invalid messages are quarantined on their first attempt.
+var ErrInvalidMessage = errors.New("invalid message")
+
+// QuarantinedMessage is a message that repeatedly failed processing.
+type QuarantinedMessage struct {
+	Message
+	// Error returned by the latest attempt.
+	Error string `json:"error"`
+	// Attempts to process the message.
+	Attempts int `json:"attempts"`
+	// QuarantinedAt is the time that the message was last quarantined.
+	QuarantinedAt time.Time `json:"quarantinedAt"`
+}
+
+// Quarantine stores messages that repeatedly failed processing, instead of retrying them
+// forever, e.g. in a DynamoDB table or an SQS queue that's only read by an operator.
+type Quarantine interface {
+	// Put stores the message, replacing any quarantined message with the same ID.
+	Put(ctx context.Context, m QuarantinedMessage) error
+	// List returns the quarantined messages.
+	List(ctx context.Context) ([]QuarantinedMessage, error)
+	// Delete removes the message with the ID from the quarantine.
+	Delete(ctx context.Context, id string) error
+}
+
+// WithQuarantine moves SQS messages to the quarantine once they've been received
+// maxAttempts times and still fail, instead of returning them to the queue. Messages that
+// fail with ErrInvalidMessage or stream.ErrInvalidEvent are quarantined on their first
+// attempt. Optimistic concurrency, ErrInProgress and context errors are transient, so they
+// aren't quarantined.
+func WithQuarantine(q Quarantine, maxAttempts int) Option {
+	return func(h *Handler) {
+		h.Quarantine = q
+		h.MaxAttempts = maxAttempts
+	}
+}
+
+// shouldQuarantine returns true if the message is invalid, or failed on its final attempt
+// with an error that isn't transient.
+func (h *Handler) shouldQuarantine(attempts int, err error) bool {
+	if h.Quarantine == nil {
+		return false
+	}
+	if errors.Is(err, ErrInvalidMessage) || errors.Is(err, stream.ErrInvalidEvent) {
+		return true
+	}
+	if attempts < h.MaxAttempts {
+		return false
+	}
+	return !errors.Is(err, stream.ErrOptimisticConcurrency) &&
+		!errors.Is(err, ErrInProgress) &&
+		!errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded)
+}
+
+// quarantine the message. If the message is stored, the error is cleared, so that the
+// message is removed from the queue.
+func (h *Handler) quarantine(ctx context.Context, m Message, attempts int, err error) error {
+	qm := QuarantinedMessage{
+		Message:       m,
+		Error:         err.Error(),
+		Attempts:      attempts,
+		QuarantinedAt: h.Clock.Now(),
+	}
+	if qerr := h.Quarantine.Put(ctx, qm); qerr != nil {
+		return fmt.Errorf("%v: failed to quarantine message: %w", err, qerr)
+	}
+	return nil
+}
+
+// Quarantined returns the messages in the quarantine.
+func (h *Handler) Quarantined(ctx context.Context) ([]QuarantinedMessage, error) {
+	if h.Quarantine == nil {
+		return nil, errors.New("consumer: no quarantine configured")
+	}
+	return h.Quarantine.List(ctx)
+}
+
+// Redrive processes the quarantined messages with the IDs, or all quarantined messages if
+// no IDs are passed, e.g. after a bug in the state has been fixed. Messages that are
+// processed are removed from the quarantine. Messages that fail again are updated with the
+// error, and returned.
+func (h *Handler) Redrive(ctx context.Context, ids ...string) (failed []QuarantinedMessage, err error) {
+	messages, err := h.Quarantined(ctx)
+	if err != nil {
+		return
+	}
+	include := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		include[id] = true
+	}
+	for _, qm := range messages {
+		if len(ids) > 0 && !include[qm.ID] {
+			continue
+		}
+		if perr := h.Process(ctx, qm.Message); perr != nil {
+			qm.Attempts++
+			qm.Error = perr.Error()
+			qm.QuarantinedAt = h.Clock.Now()
+			if err = h.Quarantine.Put(ctx, qm); err != nil {
+				return
+			}
+			failed = append(failed, qm)
+			continue
+		}
+		if err = h.Quarantine.Delete(ctx, qm.ID); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// getAttempts returns the number of times that SQS has delivered the message.
+func getAttempts(attributes map[string]string) int {
+	n, err := strconv.Atoi(attributes["ApproximateReceiveCount"])
+	if err != nil {
+		return 1
+	}
+	return n
+}
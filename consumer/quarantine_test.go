@@ -0,0 +1,238 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/a-h/stream"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+type memoryQuarantine struct {
+	messages map[string]QuarantinedMessage
+	err      error
+}
+
+func (q *memoryQuarantine) Put(ctx context.Context, m QuarantinedMessage) error {
+	if q.err != nil {
+		return q.err
+	}
+	q.messages[m.ID] = m
+	return nil
+}
+
+func (q *memoryQuarantine) List(ctx context.Context) (messages []QuarantinedMessage, err error) {
+	for _, m := range q.messages {
+		messages = append(messages, m)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	return
+}
+
+func (q *memoryQuarantine) Delete(ctx context.Context, id string) error {
+	delete(q.messages, id)
+	return nil
+}
+
+type RefundRequested struct {
+	CustomerID string `json:"customerId"`
+	Reason     string `json:"reason" validate:"required"`
+}
+
+func (RefundRequested) EventName() string { return "RefundRequested" }
+func (RefundRequested) IsInbound()        {}
+
+func newQuarantineTestHandler(store *memoryStore, q Quarantine) *Handler {
+	reader := stream.NewInboundEventReader()
+	stream.Register[OrderPlaced](reader)
+	stream.Register[RefundRequested](reader)
+	return New(store, func(id string) stream.State { return &Customer{} }, reader, FromJSONField("customerId"), WithQuarantine(q, 3))
+}
+
+func TestQuarantine(t *testing.T) {
+	poison := `{"orderId":"o1","customerId":"c1","total":-1}`
+	tests := []struct {
+		name                string
+		attempts            string
+		quarantineErr       error
+		expectedFailures    []string
+		expectedQuarantined []string
+	}{
+		{
+			name:             "messages are retried until the maximum number of attempts",
+			attempts:         "2",
+			expectedFailures: []string{"1"},
+		},
+		{
+			name:                "messages that fail on the last attempt are quarantined",
+			attempts:            "3",
+			expectedQuarantined: []string{"1"},
+		},
+		{
+			name:             "messages are retried if they can't be quarantined",
+			attempts:         "3",
+			quarantineErr:    errors.New("quarantine unavailable"),
+			expectedFailures: []string{"1"},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			store := &memoryStore{processed: map[string][]stream.InboundEvent{}}
+			q := &memoryQuarantine{messages: map[string]QuarantinedMessage{}, err: test.quarantineErr}
+			h := newQuarantineTestHandler(store, q)
+			event := events.SQSEvent{Records: []events.SQSMessage{
+				message("1", poison, map[string]string{"detailType": "OrderPlaced", "ApproximateReceiveCount": test.attempts}),
+			}}
+
+			// Act.
+			resp, err := h.HandleRequest(context.Background(), event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// Assert.
+			var failures []string
+			for _, f := range resp.BatchItemFailures {
+				failures = append(failures, f.ItemIdentifier)
+			}
+			if diff := cmp.Diff(test.expectedFailures, failures); diff != "" {
+				t.Errorf("unexpected failures: %s", diff)
+			}
+			var quarantined []string
+			for id, m := range q.messages {
+				quarantined = append(quarantined, id)
+				if m.Error != ErrPanic.Error()+": negative total" {
+					t.Errorf("expected the error to be recorded, got %q", m.Error)
+				}
+			}
+			if diff := cmp.Diff(test.expectedQuarantined, quarantined); diff != "" {
+				t.Errorf("unexpected quarantined messages: %s", diff)
+			}
+		})
+	}
+}
+
+func TestQuarantineQuarantinesInvalidMessagesOnTheFirstAttempt(t *testing.T) {
+	tests := []struct {
+		name          string
+		detailType    string
+		body          string
+		expectedError error
+	}{
+		{
+			name:          "messages that can't be decoded",
+			detailType:    "OrderPlaced",
+			body:          `{"orderId":1,"customerId":"c1","total":5}`,
+			expectedError: ErrInvalidMessage,
+		},
+		{
+			name:          "messages without an entity ID",
+			detailType:    "OrderPlaced",
+			body:          `{"orderId":"o1","total":5}`,
+			expectedError: ErrInvalidMessage,
+		},
+		{
+			name:          "events that fail validation",
+			detailType:    "RefundRequested",
+			body:          `{"customerId":"c1"}`,
+			expectedError: stream.ErrInvalidEvent,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			store := &memoryStore{processed: map[string][]stream.InboundEvent{}}
+			q := &memoryQuarantine{messages: map[string]QuarantinedMessage{}}
+			h := newQuarantineTestHandler(store, q)
+			m := message("1", test.body, map[string]string{"detailType": test.detailType, "ApproximateReceiveCount": "1"})
+
+			// Act.
+			resp, err := h.HandleRequest(context.Background(), events.SQSEvent{Records: []events.SQSMessage{m}})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// Assert.
+			if len(resp.BatchItemFailures) != 0 {
+				t.Errorf("expected no failures, got %v", resp.BatchItemFailures)
+			}
+			if _, ok := q.messages["1"]; !ok {
+				t.Fatal("expected the message to be quarantined")
+			}
+			perr := h.Process(context.Background(), q.messages["1"].Message)
+			if !errors.Is(perr, test.expectedError) {
+				t.Errorf("expected %v, got %v", test.expectedError, perr)
+			}
+		})
+	}
+}
+
+func TestQuarantineDoesNotQuarantineConcurrencyErrors(t *testing.T) {
+	// Arrange.
+	store := &memoryStore{processed: map[string][]stream.InboundEvent{}, conflicts: 10}
+	q := &memoryQuarantine{messages: map[string]QuarantinedMessage{}}
+	h := newQuarantineTestHandler(store, q)
+	event := events.SQSEvent{Records: []events.SQSMessage{
+		message("1", `{"orderId":"o1","customerId":"c1","total":5}`, map[string]string{"detailType": "OrderPlaced", "ApproximateReceiveCount": "5"}),
+	}}
+
+	// Act.
+	resp, err := h.HandleRequest(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Assert.
+	if len(resp.BatchItemFailures) != 1 {
+		t.Errorf("expected the message to be retried, got %v", resp.BatchItemFailures)
+	}
+	if len(q.messages) != 0 {
+		t.Errorf("expected no quarantined messages, got %v", q.messages)
+	}
+}
+
+func TestRedrive(t *testing.T) {
+	// Arrange.
+	store := &memoryStore{processed: map[string][]stream.InboundEvent{}}
+	q := &memoryQuarantine{messages: map[string]QuarantinedMessage{
+		"1": {Message: Message{ID: "1", DetailType: "OrderPlaced", Detail: []byte(`{"orderId":"o1","customerId":"c1","total":5}`)}, Attempts: 3},
+		"2": {Message: Message{ID: "2", DetailType: "OrderPlaced", Detail: []byte(`{"orderId":"o2","customerId":"c2","total":-1}`)}, Attempts: 3},
+		"3": {Message: Message{ID: "3", DetailType: "OrderPlaced", Detail: []byte(`{"orderId":"o3","customerId":"c3","total":5}`)}, Attempts: 3},
+	}}
+	h := newQuarantineTestHandler(store, q)
+
+	// Act.
+	failed, err := h.Redrive(context.Background(), "1", "2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Assert.
+	expectedFailed := []QuarantinedMessage{
+		{Message: q.messages["2"].Message, Error: ErrPanic.Error() + ": negative total", Attempts: 4},
+	}
+	if diff := cmp.Diff(expectedFailed, failed, cmpopts.IgnoreFields(QuarantinedMessage{}, "QuarantinedAt")); diff != "" {
+		t.Errorf("unexpected failed messages: %s", diff)
+	}
+	remaining, err := h.Quarantined(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var ids []string
+	for _, m := range remaining {
+		ids = append(ids, m.ID)
+	}
+	if diff := cmp.Diff([]string{"2", "3"}, ids); diff != "" {
+		t.Errorf("unexpected quarantined messages: %s", diff)
+	}
+	if diff := cmp.Diff(map[string][]stream.InboundEvent{"c1": {OrderPlaced{OrderID: "o1", CustomerID: "c1", Total: 5}}}, store.processed); diff != "" {
+		t.Errorf("unexpected processed events: %s", diff)
+	}
+}
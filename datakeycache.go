@@ -0,0 +1,94 @@
+package stream
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Defaults for the data key cache, see WithDataKeyCache.
+const (
+	DefaultDataKeyCacheSize = 1000
+	DefaultDataKeyCacheTTL  = 5 * time.Minute
+)
+
+// dataKeyCache holds plaintext data keys in memory for a limited time. When it's full,
+// the least recently used key is evicted, so that memory use is bounded however many
+// entities the store reads.
+type dataKeyCache struct {
+	m       sync.Mutex
+	size    int
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type dataKeyCacheEntry struct {
+	name    string
+	key     dataKey
+	expires time.Time
+}
+
+func newDataKeyCache(size int, ttl time.Duration, now func() time.Time) *dataKeyCache {
+	if size <= 0 {
+		size = DefaultDataKeyCacheSize
+	}
+	if ttl <= 0 {
+		ttl = DefaultDataKeyCacheTTL
+	}
+	if now == nil {
+		now = time.Now
+	}
+	return &dataKeyCache{
+		size:    size,
+		ttl:     ttl,
+		now:     now,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (c *dataKeyCache) get(name string) (key dataKey, ok bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	e, ok := c.entries[name]
+	if !ok {
+		return
+	}
+	entry := e.Value.(*dataKeyCacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.order.Remove(e)
+		delete(c.entries, name)
+		return key, false
+	}
+	c.order.MoveToFront(e)
+	return entry.key, true
+}
+
+func (c *dataKeyCache) put(name string, key dataKey) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if e, ok := c.entries[name]; ok {
+		c.order.Remove(e)
+	}
+	c.entries[name] = c.order.PushFront(&dataKeyCacheEntry{
+		name:    name,
+		key:     key,
+		expires: c.now().Add(c.ttl),
+	})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*dataKeyCacheEntry).name)
+	}
+}
+
+func (c *dataKeyCache) delete(name string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if e, ok := c.entries[name]; ok {
+		c.order.Remove(e)
+		delete(c.entries, name)
+	}
+}
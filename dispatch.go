@@ -0,0 +1,82 @@
+package stream
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// UndispatchedEvent is an outbound event record that the handler hasn't sent to
+// EventBridge.
+type UndispatchedEvent struct {
+	ID       string
+	Sequence int64
+	Type     string
+	// Date the event was stored.
+	Date string
+	// Attempts to send the event.
+	Attempts int
+	// Error returned by the latest attempt.
+	Error string
+}
+
+// Undispatched returns the outbound events in the store's namespace that were stored more
+// than olderThan ago, and haven't been sent to EventBridge, e.g. to alert on stuck events.
+// The dispatch status is only recorded if the handler's TRACK_DISPATCH environment variable
+// is "true". It scans the table, so run it periodically, rather than on each request.
+func (ddb *DynamoDBStore) Undispatched(ctx context.Context, olderThan time.Duration) (undispatched []UndispatchedEvent, err error) {
+	prefix := ddb.createPartitionKey("")
+	si := &dynamodb.ScanInput{
+		TableName:              ddb.TableName,
+		ConsistentRead:         aws.Bool(!ddb.EventuallyConsistentReads),
+		FilterExpression:       aws.String("begins_with(#_pk, :_pk) AND begins_with(#_sk, :_sk) AND attribute_not_exists(#_dispatchedAt) AND #_ts < :_cutoff"),
+		ReturnConsumedCapacity: ddb.returnConsumedCapacity(),
+		ExpressionAttributeNames: map[string]string{
+			"#_pk":           "_pk",
+			"#_sk":           "_sk",
+			"#_ts":           "_ts",
+			"#_dispatchedAt": "_dispatchedAt",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":_pk":     ddb.attributeValueString(prefix),
+			":_sk":     ddb.attributeValueString("OUTBOUND/"),
+			":_cutoff": ddb.attributeValueInteger(ddb.Now().Add(-olderThan).Unix()),
+		},
+	}
+	pages := dynamodb.NewScanPaginator(ddb.Client, si)
+	for pages.HasMorePages() {
+		var page *dynamodb.ScanOutput
+		page, err = pages.NextPage(ctx)
+		if err != nil {
+			return
+		}
+		if page.ConsumedCapacity != nil {
+			ddb.reportCapacity(OperationScan, *page.ConsumedCapacity)
+		}
+		for _, item := range page.Items {
+			e := UndispatchedEvent{
+				ID:    strings.TrimPrefix(stringAttribute(item, "_pk"), prefix),
+				Type:  stringAttribute(item, "_typ"),
+				Date:  stringAttribute(item, "_date"),
+				Error: stringAttribute(item, "_dispatchError"),
+			}
+			e.Sequence, err = ddb.getRecordSequenceNumber(item)
+			if err != nil {
+				return
+			}
+			if attempts, ok := item["_dispatchAttempts"].(*types.AttributeValueMemberN); ok {
+				e.Attempts, err = strconv.Atoi(attempts.Value)
+				if err != nil {
+					return
+				}
+			}
+			undispatched = append(undispatched, e)
+		}
+	}
+	return
+}
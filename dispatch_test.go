@@ -0,0 +1,71 @@
+package stream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestUndispatchedIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	// Arrange.
+	name := createLocalTable(t)
+	defer deleteLocalTable(t, name)
+	s, err := NewStore(name, "Dispatch", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	now := time.Now()
+	s.Now = func() time.Time { return now.Add(-time.Hour) }
+	err = s.Put("id", 0, &AverageState{}, []InboundEvent{Add{Number: 1}}, []OutboundEvent{Average{Value: 1}, Count{Number: 1}})
+	if err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	s.Now = func() time.Time { return now }
+	// Mark the Average event as dispatched, and record a failure for the Count event, as
+	// the handler does.
+	update := func(sk, expression string, values map[string]types.AttributeValue) {
+		_, err := testClient.UpdateItem(context.Background(), &dynamodb.UpdateItemInput{
+			TableName: aws.String(name),
+			Key: map[string]types.AttributeValue{
+				"_pk": &types.AttributeValueMemberS{Value: "Dispatch/id"},
+				"_sk": &types.AttributeValueMemberS{Value: sk},
+			},
+			UpdateExpression:          aws.String(expression),
+			ExpressionAttributeValues: values,
+		})
+		if err != nil {
+			t.Fatalf("failed to update record: %v", err)
+		}
+	}
+	update("OUTBOUND/1/0/Average", "SET _dispatchedAt = :now ADD _dispatchAttempts :one", map[string]types.AttributeValue{
+		":now": &types.AttributeValueMemberN{Value: "1"},
+		":one": &types.AttributeValueMemberN{Value: "1"},
+	})
+	update("OUTBOUND/1/1/Count", "SET _dispatchError = :error ADD _dispatchAttempts :one", map[string]types.AttributeValue{
+		":error": &types.AttributeValueMemberS{Value: "InternalFailure: "},
+		":one":   &types.AttributeValueMemberN{Value: "1"},
+	})
+
+	// Act.
+	undispatched, err := s.Undispatched(context.Background(), time.Minute)
+	if err != nil {
+		t.Fatalf("failed to query undispatched events: %v", err)
+	}
+
+	// Assert.
+	expected := []UndispatchedEvent{
+		{ID: "id", Sequence: 1, Type: "Count", Attempts: 1, Error: "InternalFailure: "},
+	}
+	if diff := cmp.Diff(expected, undispatched, cmpopts.IgnoreFields(UndispatchedEvent{}, "Date")); diff != "" {
+		t.Error(diff)
+	}
+}
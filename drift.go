@@ -0,0 +1,137 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+)
+
+// ReplayExport reads the inbound records of an export, see Export, processes them in order
+// against the empty state, and writes the resulting state to w as an ExportRecord of kind
+// ExportKindState. Outbound events are discarded. Pass the store options that affect the
+// codec, e.g. WithCodecTag, so that the state is encoded in the same way as the stored
+// state.
+//
+// It's used to build the plugin that the stream-verify command runs to check an entity's
+// stored state against its inbound events.
+//
+//	func main() {
+//		reader := stream.NewInboundEventReader()
+//		stream.Register[models.InsertCoin](reader)
+//		stream.Register[models.PullHandle](reader)
+//		if err := stream.ReplayExport(os.Stdin, os.Stdout, models.NewSlotMachine(""), reader); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+func ReplayExport(r io.Reader, w io.Writer, state State, inboundEventReader *InboundEventReader, opts ...StoreOption) (err error) {
+	var o StoreOptions
+	for _, opt := range opts {
+		if err = opt(&o); err != nil {
+			return
+		}
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var line int
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record ExportRecord
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if record.Kind != ExportKindInbound {
+			continue
+		}
+		item, err := attributevalue.MarshalMap(record.Data)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		event, ok, err := inboundEventReader.Read(record.Type, item)
+		if err != nil {
+			return fmt.Errorf("line %d: failed to read %s: %w", line, record.Type, err)
+		}
+		if !ok {
+			return fmt.Errorf("line %d: no reader for inbound event %q", line, record.Type)
+		}
+		if _, err = state.Process(event); err != nil {
+			return fmt.Errorf("line %d: failed to process %s: %w", line, record.Type, err)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	av, err := newEncoder(o).Encode(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	replayed := ExportRecord{
+		Kind: ExportKindState,
+		Type: reflect.TypeOf(state).Elem().Name(),
+	}
+	if err = attributevalue.Unmarshal(av, &replayed.Data); err != nil {
+		return fmt.Errorf("failed to convert state: %w", err)
+	}
+	if replayed.Data == nil {
+		replayed.Data = make(map[string]interface{})
+	}
+	return json.NewEncoder(w).Encode(replayed)
+}
+
+// Drift is a field whose stored value differs from the value produced by replaying the
+// entity's inbound events.
+type Drift struct {
+	// Path of the field, e.g. "balance" or "games[2].payout".
+	Path     string      `json:"path"`
+	Stored   interface{} `json:"stored"`
+	Replayed interface{} `json:"replayed"`
+}
+
+// FindDrift compares the data of a stored state record with the data of a replayed state
+// record, as written by Export and ReplayExport, and returns the fields that differ, sorted
+// by path.
+func FindDrift(stored, replayed map[string]interface{}) (drift []Drift) {
+	drift = findDrift("", stored, replayed)
+	sort.Slice(drift, func(i, j int) bool { return drift[i].Path < drift[j].Path })
+	return
+}
+
+func findDrift(path string, stored, replayed interface{}) (drift []Drift) {
+	switch s := stored.(type) {
+	case map[string]interface{}:
+		r, ok := replayed.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for k := range s {
+			drift = append(drift, findDrift(joinPath(path, k), s[k], r[k])...)
+		}
+		for k := range r {
+			if _, ok := s[k]; !ok {
+				drift = append(drift, findDrift(joinPath(path, k), nil, r[k])...)
+			}
+		}
+		return
+	case []interface{}:
+		r, ok := replayed.([]interface{})
+		if !ok || len(r) != len(s) {
+			break
+		}
+		for i := range s {
+			drift = append(drift, findDrift(path+"["+strconv.Itoa(i)+"]", s[i], r[i])...)
+		}
+		return
+	}
+	if !reflect.DeepEqual(stored, replayed) {
+		drift = append(drift, Drift{Path: path, Stored: stored, Replayed: replayed})
+	}
+	return
+}
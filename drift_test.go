@@ -0,0 +1,126 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReplayExport(t *testing.T) {
+	// Arrange.
+	export := strings.Join([]string{
+		`{"kind":"state","type":"Wallet","sequence":3,"data":{"Balance":20}}`,
+		`{"kind":"inbound","type":"Deposit","sequence":1,"data":{"Amount":5}}`,
+		`{"kind":"outbound","type":"Deposited","sequence":1,"data":{"Amount":5}}`,
+		`{"kind":"inbound","type":"Deposit","sequence":2,"data":{"Amount":10}}`,
+	}, "\n")
+	reader := NewInboundEventReader()
+	Register[Deposit](reader)
+	var w bytes.Buffer
+
+	// Act.
+	err := ReplayExport(strings.NewReader(export), &w, &Wallet{}, reader)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var replayed ExportRecord
+	if err = json.Unmarshal(w.Bytes(), &replayed); err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	expected := ExportRecord{
+		Kind: ExportKindState,
+		Type: "Wallet",
+		Data: map[string]interface{}{"Balance": float64(15)},
+	}
+	if diff := cmp.Diff(expected, replayed); diff != "" {
+		t.Errorf("unexpected state: %s", diff)
+	}
+}
+
+func TestReplayExportUnknownEvent(t *testing.T) {
+	// Arrange.
+	export := `{"kind":"inbound","type":"Withdraw","sequence":1,"data":{"Amount":5}}`
+
+	// Act.
+	err := ReplayExport(strings.NewReader(export), &bytes.Buffer{}, &Wallet{}, NewInboundEventReader())
+
+	// Assert.
+	if err == nil || !strings.Contains(err.Error(), `line 1: no reader for inbound event "Withdraw"`) {
+		t.Errorf("expected an unknown event error, got %v", err)
+	}
+}
+
+func TestFindDrift(t *testing.T) {
+	tests := []struct {
+		name     string
+		stored   string
+		replayed string
+		expected []Drift
+	}{
+		{
+			name:     "equal states have no drift",
+			stored:   `{"balance":1,"games":[{"payout":2}]}`,
+			replayed: `{"balance":1,"games":[{"payout":2}]}`,
+		},
+		{
+			name:     "changed fields drift",
+			stored:   `{"balance":1,"owner":{"name":"a"}}`,
+			replayed: `{"balance":2,"owner":{"name":"b"}}`,
+			expected: []Drift{
+				{Path: "balance", Stored: float64(1), Replayed: float64(2)},
+				{Path: "owner.name", Stored: "a", Replayed: "b"},
+			},
+		},
+		{
+			name:     "missing and extra fields drift",
+			stored:   `{"edited":true}`,
+			replayed: `{"balance":1}`,
+			expected: []Drift{
+				{Path: "balance", Stored: nil, Replayed: float64(1)},
+				{Path: "edited", Stored: true, Replayed: nil},
+			},
+		},
+		{
+			name:     "list items are compared by index",
+			stored:   `{"games":[{"payout":2},{"payout":3}]}`,
+			replayed: `{"games":[{"payout":2},{"payout":4}]}`,
+			expected: []Drift{
+				{Path: "games[1].payout", Stored: float64(3), Replayed: float64(4)},
+			},
+		},
+		{
+			name:     "lists of different lengths drift",
+			stored:   `{"games":[1]}`,
+			replayed: `{"games":[1,2]}`,
+			expected: []Drift{
+				{Path: "games", Stored: []interface{}{float64(1)}, Replayed: []interface{}{float64(1), float64(2)}},
+			},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			var stored, replayed map[string]interface{}
+			if err := json.Unmarshal([]byte(test.stored), &stored); err != nil {
+				t.Fatalf("invalid stored state: %v", err)
+			}
+			if err := json.Unmarshal([]byte(test.replayed), &replayed); err != nil {
+				t.Fatalf("invalid replayed state: %v", err)
+			}
+
+			// Act.
+			actual := FindDrift(stored, replayed)
+
+			// Assert.
+			if diff := cmp.Diff(test.expected, actual); diff != "" {
+				t.Errorf("unexpected drift: %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DumpRecord is a single record of an entity, written by Dump and read by Import. Unlike
+// ExportRecord, the item is kept as stored, in DynamoDB JSON, so that sequence numbers,
+// metadata and encrypted payloads survive the round trip. The partition key is removed,
+// and set by Import, along with the namespace and tenant attributes.
+type DumpRecord struct {
+	ID   string          `json:"id"`
+	Item json.RawMessage `json:"item"`
+}
+
+// MarshalItemJSON encodes a stored item as DynamoDB JSON, the format of DumpRecord items
+// and DynamoDB Streams, e.g. {"name":{"S":"value"}}.
+func MarshalItemJSON(item map[string]types.AttributeValue) ([]byte, error) {
+	return marshalAttributeValueMapJSON(item)
+}
+
+// UnmarshalItemJSON decodes an item encoded by MarshalItemJSON.
+func UnmarshalItemJSON(data []byte) (item map[string]types.AttributeValue, err error) {
+	return unmarshalAttributeValueMapJSON(data)
+}
+
+// Dump writes every record of the entities to w as NDJSON, e.g. to seed another
+// environment, or to back up an entity before a manual fix. If no IDs are passed, every
+// entity in the store's namespace is written, by scanning the table.
+func (ddb *DynamoDBStore) Dump(ctx context.Context, w io.Writer, ids ...string) (err error) {
+	enc := json.NewEncoder(w)
+	write := func(item map[string]types.AttributeValue) error {
+		r, err := ddb.createDumpRecord(item)
+		if err != nil {
+			return err
+		}
+		return enc.Encode(r)
+	}
+	if len(ids) == 0 {
+		return ddb.scanNamespace(ctx, write)
+	}
+	for _, id := range ids {
+		var n int
+		n, err = ddb.queryItems(ctx, id, write)
+		if err != nil {
+			return
+		}
+		if n == 0 {
+			return fmt.Errorf("dump: %s: %w", id, ErrStateNotFound)
+		}
+	}
+	return
+}
+
+func (ddb *DynamoDBStore) createDumpRecord(item map[string]types.AttributeValue) (r DumpRecord, err error) {
+	r.ID = strings.TrimPrefix(stringAttribute(item, "_pk"), ddb.createPartitionKey(""))
+	copied := make(map[string]types.AttributeValue, len(item))
+	for k, v := range item {
+		if k != "_pk" {
+			copied[k] = v
+		}
+	}
+	r.Item, err = marshalAttributeValueMapJSON(copied)
+	return
+}
+
+// queryItems passes each stored record of the entity to f, without decrypting it.
+func (ddb *DynamoDBStore) queryItems(ctx context.Context, id string, f func(map[string]types.AttributeValue) error) (n int, err error) {
+	qi := &dynamodb.QueryInput{
+		TableName:              ddb.TableName,
+		ConsistentRead:         aws.Bool(true),
+		KeyConditionExpression: aws.String("#_pk = :_pk"),
+		ExpressionAttributeNames: map[string]string{
+			"#_pk": "_pk",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":_pk": ddb.attributeValueString(ddb.createPartitionKey(id)),
+		},
+		ReturnConsumedCapacity: ddb.returnConsumedCapacity(),
+	}
+	var pagerError error
+	err = ddb.queryPages(ctx, qi, func(qo *dynamodb.QueryOutput, _ bool) bool {
+		for _, item := range qo.Items {
+			if pagerError = f(item); pagerError != nil {
+				return false
+			}
+			n++
+		}
+		return true
+	})
+	if err != nil {
+		return
+	}
+	err = pagerError
+	return
+}
+
+// scanNamespace passes each stored record in the store's namespace to f.
+func (ddb *DynamoDBStore) scanNamespace(ctx context.Context, f func(map[string]types.AttributeValue) error) (err error) {
+	si := &dynamodb.ScanInput{
+		TableName:              ddb.TableName,
+		ConsistentRead:         aws.Bool(!ddb.EventuallyConsistentReads),
+		FilterExpression:       aws.String("begins_with(#_pk, :_pk)"),
+		ReturnConsumedCapacity: ddb.returnConsumedCapacity(),
+		ExpressionAttributeNames: map[string]string{
+			"#_pk": "_pk",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":_pk": ddb.attributeValueString(ddb.createPartitionKey("")),
+		},
+	}
+	pages := dynamodb.NewScanPaginator(ddb.Client, si)
+	for pages.HasMorePages() {
+		var page *dynamodb.ScanOutput
+		page, err = pages.NextPage(ctx)
+		if err != nil {
+			return
+		}
+		if page.ConsumedCapacity != nil {
+			ddb.reportCapacity(OperationScan, *page.ConsumedCapacity)
+		}
+		for _, item := range page.Items {
+			if err = f(item); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// ErrImportConflict is returned by Import when a record already exists in the
+// destination store, and overwrite is false.
+var ErrImportConflict = errors.New("import: record already exists")
+
+// Import writes the records read from r, in the NDJSON format written by Dump, to the
+// store's namespace and tenant, keeping their sequence numbers. Existing records are
+// only replaced if overwrite is true, otherwise ErrImportConflict is returned. Records
+// of encrypted stores can only be read if the destination uses the same KMS key.
+func (ddb *DynamoDBStore) Import(ctx context.Context, r io.Reader, overwrite bool) (n int, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var dr DumpRecord
+		if err = json.Unmarshal(scanner.Bytes(), &dr); err != nil {
+			return n, fmt.Errorf("import: line %d: %w", line, err)
+		}
+		var item map[string]types.AttributeValue
+		if item, err = ddb.createImportItem(dr); err != nil {
+			return n, fmt.Errorf("import: line %d: %w", line, err)
+		}
+		if err = ddb.putImportItem(ctx, item, overwrite); err != nil {
+			return n, fmt.Errorf("import: line %d: %w", line, err)
+		}
+		n++
+	}
+	err = scanner.Err()
+	return
+}
+
+func (ddb *DynamoDBStore) createImportItem(dr DumpRecord) (item map[string]types.AttributeValue, err error) {
+	if dr.ID == "" {
+		return nil, errors.New("missing id")
+	}
+	item, err = unmarshalAttributeValueMapJSON(dr.Item)
+	if err != nil {
+		return
+	}
+	if _, ok := item["_sk"]; !ok {
+		return nil, errors.New("missing _sk attribute")
+	}
+	item["_pk"] = ddb.attributeValueString(ddb.createPartitionKey(dr.ID))
+	if _, ok := item["_namespace"]; ok {
+		item["_namespace"] = ddb.attributeValueString(ddb.Namespace)
+	}
+	delete(item, "_tenant")
+	if ddb.Tenant != "" {
+		item["_tenant"] = ddb.attributeValueString(ddb.Tenant)
+	}
+	return
+}
+
+func (ddb *DynamoDBStore) putImportItem(ctx context.Context, item map[string]types.AttributeValue, overwrite bool) (err error) {
+	pi := &dynamodb.PutItemInput{
+		TableName:              ddb.TableName,
+		Item:                   item,
+		ReturnConsumedCapacity: ddb.returnConsumedCapacity(),
+	}
+	if !overwrite {
+		pi.ConditionExpression = aws.String("attribute_not_exists(#_pk)")
+		pi.ExpressionAttributeNames = map[string]string{
+			"#_pk": "_pk",
+		}
+	}
+	po, err := ddb.Client.PutItem(ctx, pi)
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return ErrImportConflict
+		}
+		return
+	}
+	if po.ConsumedCapacity != nil {
+		ddb.reportCapacity(OperationImport, *po.ConsumedCapacity)
+	}
+	return
+}
@@ -0,0 +1,163 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDumpRecordRoundTrip(t *testing.T) {
+	// Arrange.
+	from, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient), WithTenant("a"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	to, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient), WithTenant("b"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	items, err := from.Prepare("id", 4, &AverageState{Sum: 1, Count: 1, Value: 1}, []InboundEvent{Add{Number: 1}}, nil)
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Act.
+	dr, err := from.createDumpRecord(items[0].Put.Item)
+	if err != nil {
+		t.Fatalf("failed to create dump record: %v", err)
+	}
+	imported, err := to.createImportItem(dr)
+	if err != nil {
+		t.Fatalf("failed to create import item: %v", err)
+	}
+
+	// Assert.
+	if dr.ID != "id" {
+		t.Errorf("expected id %q, got %q", "id", dr.ID)
+	}
+	if pk := stringAttribute(imported, "_pk"); pk != "b/Average/id" {
+		t.Errorf("expected the partition key to be rewritten, got %q", pk)
+	}
+	if tenant := stringAttribute(imported, "_tenant"); tenant != "b" {
+		t.Errorf("expected the tenant to be rewritten, got %q", tenant)
+	}
+	expected := make(map[string]types.AttributeValue)
+	for k, v := range items[0].Put.Item {
+		if k != "_pk" && k != "_tenant" {
+			expected[k] = v
+		}
+	}
+	delete(imported, "_pk")
+	delete(imported, "_tenant")
+	if diff := cmp.Diff(expected, imported, cmp.AllowUnexported(types.AttributeValueMemberS{}, types.AttributeValueMemberN{}, types.AttributeValueMemberM{}, types.AttributeValueMemberSS{})); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestImportRejectsInvalidRecords(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "invalid JSON",
+			input: `{"id":`,
+		},
+		{
+			name:  "missing id",
+			input: `{"item":{"_sk":{"S":"STATE"}}}`,
+		},
+		{
+			name:  "missing sort key",
+			input: `{"id":"id","item":{"_seq":{"N":"1"}}}`,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient))
+			if err != nil {
+				t.Fatalf("failed to create store: %v", err)
+			}
+
+			// Act.
+			n, err := s.Import(context.Background(), bytes.NewBufferString(test.input), false)
+
+			// Assert.
+			if err == nil {
+				t.Error("expected an error")
+			}
+			if n != 0 {
+				t.Errorf("expected no records to be imported, got %d", n)
+			}
+		})
+	}
+}
+
+func TestDumpImportIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	// Arrange.
+	fromTable := createLocalTable(t)
+	defer deleteLocalTable(t, fromTable)
+	toTable := createLocalTable(t)
+	defer deleteLocalTable(t, toTable)
+	from, err := NewStore(fromTable, "Average", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	to, err := NewStore(toTable, "Average", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	for _, id := range []string{"a", "b"} {
+		p, err := New(from, id, &AverageState{})
+		if err != nil {
+			t.Fatalf("failed to create processor: %v", err)
+		}
+		if err = p.Process(Add{Number: 1}, Add{Number: 3}); err != nil {
+			t.Fatalf("failed to process events: %v", err)
+		}
+	}
+
+	// Act.
+	var buf bytes.Buffer
+	if err = from.Dump(context.Background(), &buf); err != nil {
+		t.Fatalf("failed to dump: %v", err)
+	}
+	dump := buf.Bytes()
+	n, err := to.Import(context.Background(), bytes.NewReader(dump), false)
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+
+	// Assert.
+	if n == 0 {
+		t.Fatal("expected records to be imported")
+	}
+	for _, id := range []string{"a", "b"} {
+		var state AverageState
+		sequence, err := to.Get(id, &state)
+		if err != nil {
+			t.Fatalf("failed to get %q: %v", id, err)
+		}
+		if sequence != 1 {
+			t.Errorf("expected the sequence number to be preserved, got %d", sequence)
+		}
+		if diff := cmp.Diff(AverageState{Sum: 4, Count: 2, Value: 2}, state); diff != "" {
+			t.Error(diff)
+		}
+	}
+	if _, err = to.Import(context.Background(), bytes.NewReader(dump), false); !errors.Is(err, ErrImportConflict) {
+		t.Errorf("expected ErrImportConflict on a second import, got %v", err)
+	}
+	if _, err = to.Import(context.Background(), bytes.NewReader(dump), true); err != nil {
+		t.Errorf("expected the overwrite to succeed, got %v", err)
+	}
+}
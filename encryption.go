@@ -0,0 +1,509 @@
+package stream
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// KMSAPI is the subset of the KMS client used to encrypt records.
+type KMSAPI interface {
+	GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// dataKey is a plaintext data key, and the same key encrypted by KMS.
+type dataKey struct {
+	Plaintext []byte
+	Encrypted []byte
+}
+
+func (ddb *DynamoDBStore) isEncrypted() bool {
+	return ddb.KMSKeyARN != ""
+}
+
+func (ddb *DynamoDBStore) generateDataKey(ctx context.Context) (key dataKey, err error) {
+	gdko, err := ddb.KMS.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(ddb.KMSKeyARN),
+		KeySpec: kmstypes.DataKeySpecAes256,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to generate data key: %w", err)
+		return
+	}
+	key = dataKey{Plaintext: gdko.Plaintext, Encrypted: gdko.CiphertextBlob}
+	return
+}
+
+// keyCache returns the store's data key cache, creating it on first use, since stores
+// can be created without NewStore.
+func (ddb *DynamoDBStore) keyCache() *dataKeyCache {
+	ddb.dataKeysOnce.Do(func() {
+		now := ddb.Now
+		if now == nil {
+			now = time.Now
+		}
+		ddb.dataKeys = newDataKeyCache(ddb.DataKeyCacheSize, ddb.DataKeyCacheTTL, now)
+	})
+	return ddb.dataKeys
+}
+
+// writeDataKey returns the data key used to encrypt the entity's records. The key is
+// reused for writes to the entity until it expires from the cache, so that each write
+// doesn't call KMS.
+func (ddb *DynamoDBStore) writeDataKey(ctx context.Context, id string) (key dataKey, err error) {
+	name := "entity/" + id
+	if key, ok := ddb.keyCache().get(name); ok {
+		return key, nil
+	}
+	if key, err = ddb.generateDataKey(ctx); err != nil {
+		return
+	}
+	ddb.keyCache().put(name, key)
+	return
+}
+
+func (ddb *DynamoDBStore) decryptDataKey(ctx context.Context, encrypted []byte) (plaintext []byte, err error) {
+	name := "encrypted/" + string(encrypted)
+	if cached, ok := ddb.keyCache().get(name); ok {
+		return cached.Plaintext, nil
+	}
+	do, err := ddb.KMS.Decrypt(ctx, &kms.DecryptInput{
+		CiphertextBlob: encrypted,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to decrypt data key: %w", err)
+		return
+	}
+	ddb.keyCache().put(name, dataKey{Plaintext: do.Plaintext, Encrypted: encrypted})
+	return do.Plaintext, nil
+}
+
+// ErrShredded is returned when reading an encrypted record of an entity whose data key
+// has been deleted by Shred.
+var ErrShredded = errors.New("the data key of the entity has been deleted")
+
+// encryptItems replaces the payload attributes of each item with an encrypted _enc
+// attribute. The library's attributes, e.g. _pk, _sk and _seq, are kept in plaintext
+// so that they can be queried.
+func (ddb *DynamoDBStore) encryptItems(ctx context.Context, id string, items []types.TransactWriteItem) (encrypted []types.TransactWriteItem, err error) {
+	if !ddb.isEncrypted() {
+		return items, nil
+	}
+	var key dataKey
+	var created bool
+	if ddb.CryptoShredding {
+		key, created, err = ddb.getOrCreateEntityKey(ctx, id)
+	} else {
+		key, err = ddb.writeDataKey(ctx, id)
+	}
+	if err != nil {
+		return
+	}
+	for i := 0; i < len(items); i++ {
+		if items[i].Put == nil {
+			continue
+		}
+		// If crypto shredding is enabled, the encrypted data key is only stored in the
+		// entity's KEY record, so that deleting it makes the records unreadable.
+		err = encryptRecord(key, items[i].Put.Item, !ddb.CryptoShredding)
+		if err != nil {
+			return
+		}
+	}
+	if created {
+		items = append(items, ddb.createEntityKeyPut(id, key))
+	}
+	return items, nil
+}
+
+// decryptRecord returns a copy of the record with the payload attributes decrypted.
+// Records that are not encrypted are returned unchanged. The entityKey function is used
+// to get the entity's data key for records that don't include their own.
+func (ddb *DynamoDBStore) decryptRecord(ctx context.Context, r map[string]types.AttributeValue, entityKey func() ([]byte, error)) (decrypted map[string]types.AttributeValue, err error) {
+	enc, ok := r["_enc"].(*types.AttributeValueMemberB)
+	if !ok {
+		return r, nil
+	}
+	if ddb.KMS == nil {
+		return nil, errors.New("record is encrypted, but the store has no KMS client")
+	}
+	var key []byte
+	if encryptedKey, ok := r["_key"].(*types.AttributeValueMemberB); ok {
+		key, err = ddb.decryptDataKey(ctx, encryptedKey.Value)
+	} else if entityKey != nil {
+		key, err = entityKey()
+	} else {
+		err = errors.New("missing _key field in encrypted record")
+	}
+	if err != nil {
+		return
+	}
+	plaintext, err := decrypt(key, enc.Value, recordAdditionalData(r))
+	if err != nil {
+		return
+	}
+	payload, err := unmarshalAttributeValueMapJSON(plaintext)
+	if err != nil {
+		return
+	}
+	decrypted = make(map[string]types.AttributeValue, len(r)+len(payload))
+	for k, v := range payload {
+		decrypted[k] = v
+	}
+	for k, v := range r {
+		if k == "_enc" || k == "_key" {
+			continue
+		}
+		decrypted[k] = v
+	}
+	return
+}
+
+// Decrypt returns a copy of a record read from the table, or its stream, with the payload
+// attributes decrypted, e.g. to project encrypted events. Records that aren't encrypted
+// are returned unchanged.
+func (ddb *DynamoDBStore) Decrypt(ctx context.Context, item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	id := strings.TrimPrefix(stringAttribute(item, "_pk"), ddb.createPartitionKey(""))
+	return ddb.decryptRecord(ctx, item, ddb.newEntityKeyLoader(ctx, id))
+}
+
+// newEntityKeyLoader returns a function that reads and decrypts the entity's data key
+// the first time that it's called.
+func (ddb *DynamoDBStore) newEntityKeyLoader(ctx context.Context, id string) func() ([]byte, error) {
+	var key []byte
+	var err error
+	var loaded bool
+	return func() ([]byte, error) {
+		if loaded {
+			return key, err
+		}
+		loaded = true
+		var encrypted []byte
+		var shredded bool
+		encrypted, shredded, err = ddb.getEntityKey(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if shredded || encrypted == nil {
+			err = ErrShredded
+			return nil, err
+		}
+		key, err = ddb.decryptDataKey(ctx, encrypted)
+		return key, err
+	}
+}
+
+// getEntityKey returns the encrypted data key of the entity, or nil if it doesn't exist.
+// If the key has been deleted by Shred, shredded is true.
+func (ddb *DynamoDBStore) getEntityKey(ctx context.Context, id string) (encrypted []byte, shredded bool, err error) {
+	gio, err := ddb.Client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      ddb.TableName,
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]types.AttributeValue{
+			"_pk": ddb.attributeValueString(ddb.createPartitionKey(id)),
+			"_sk": ddb.attributeValueString(ddb.createKeyRecordSortKey()),
+		},
+		ReturnConsumedCapacity: ddb.returnConsumedCapacity(),
+	})
+	if err != nil {
+		return
+	}
+	if gio.ConsumedCapacity != nil {
+		ddb.reportCapacity(OperationGet, *gio.ConsumedCapacity)
+	}
+	if v, ok := gio.Item["_key"].(*types.AttributeValueMemberB); ok {
+		encrypted = v.Value
+	}
+	if v, ok := gio.Item["_shredded"].(*types.AttributeValueMemberBOOL); ok {
+		shredded = v.Value
+	}
+	return
+}
+
+// getOrCreateEntityKey returns the entity's data key, or generates one if the entity is
+// new. It returns ErrShredded if the entity has been shredded, rather than creating a new
+// key that can't decrypt the entity's existing records.
+func (ddb *DynamoDBStore) getOrCreateEntityKey(ctx context.Context, id string) (key dataKey, created bool, err error) {
+	encrypted, shredded, err := ddb.getEntityKey(ctx, id)
+	if err != nil {
+		return
+	}
+	if shredded {
+		err = ErrShredded
+		return
+	}
+	if encrypted == nil {
+		key, err = ddb.generateDataKey(ctx)
+		created = err == nil
+		return
+	}
+	plaintext, err := ddb.decryptDataKey(ctx, encrypted)
+	if err != nil {
+		return
+	}
+	key = dataKey{Plaintext: plaintext, Encrypted: encrypted}
+	return
+}
+
+func (ddb *DynamoDBStore) createEntityKeyPut(id string, key dataKey) types.TransactWriteItem {
+	return ddb.createPut(map[string]types.AttributeValue{
+		"_namespace": ddb.attributeValueString(ddb.Namespace),
+		"_pk":        ddb.attributeValueString(ddb.createPartitionKey(id)),
+		"_sk":        ddb.attributeValueString(ddb.createKeyRecordSortKey()),
+		"_typ":       ddb.attributeValueString("KEY"),
+		"_key":       &types.AttributeValueMemberB{Value: key.Encrypted},
+		"_ts":        ddb.attributeValueInteger(ddb.Now().Unix()),
+		"_date":      ddb.attributeValueString(ddb.Now().Format(time.RFC3339)),
+		"_fmt":       ddb.attributeValueString(formatVersion()),
+	})
+}
+
+// Shred deletes the data key of the entity, so that its encrypted state and events can no
+// longer be read, e.g. to erase personal data without rewriting the event log. Requires
+// the store to be configured with encryption and crypto shredding.
+//
+// The KEY record is replaced with a tombstone, so that reads and writes of the entity
+// return ErrShredded, instead of a new data key being created for it.
+func (ddb *DynamoDBStore) Shred(ctx context.Context, id string) (err error) {
+	if !ddb.isEncrypted() || !ddb.CryptoShredding {
+		return errors.New("shred requires encryption and crypto shredding to be enabled")
+	}
+	pio, err := ddb.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: ddb.TableName,
+		Item: map[string]types.AttributeValue{
+			"_namespace": ddb.attributeValueString(ddb.Namespace),
+			"_pk":        ddb.attributeValueString(ddb.createPartitionKey(id)),
+			"_sk":        ddb.attributeValueString(ddb.createKeyRecordSortKey()),
+			"_typ":       ddb.attributeValueString("KEY"),
+			"_shredded":  &types.AttributeValueMemberBOOL{Value: true},
+			"_ts":        ddb.attributeValueInteger(ddb.Now().Unix()),
+			"_date":      ddb.attributeValueString(ddb.Now().Format(time.RFC3339)),
+			"_fmt":       ddb.attributeValueString(formatVersion()),
+		},
+		ReturnConsumedCapacity: ddb.returnConsumedCapacity(),
+	})
+	if err != nil {
+		return
+	}
+	if pio.ConsumedCapacity != nil {
+		ddb.reportCapacity(OperationShred, *pio.ConsumedCapacity)
+	}
+	ddb.keyCache().delete("entity/" + id)
+	return
+}
+
+func encryptRecord(key dataKey, r map[string]types.AttributeValue, includeKey bool) (err error) {
+	payload := make(map[string]types.AttributeValue)
+	for k, v := range r {
+		if !strings.HasPrefix(k, "_") {
+			payload[k] = v
+		}
+	}
+	plaintext, err := marshalAttributeValueMapJSON(payload)
+	if err != nil {
+		return
+	}
+	ciphertext, err := encrypt(key.Plaintext, plaintext, recordAdditionalData(r))
+	if err != nil {
+		return
+	}
+	for k := range payload {
+		delete(r, k)
+	}
+	r["_enc"] = &types.AttributeValueMemberB{Value: ciphertext}
+	if includeKey {
+		r["_key"] = &types.AttributeValueMemberB{Value: key.Encrypted}
+	}
+	return
+}
+
+// recordAdditionalData binds the ciphertext to the record's key, so that it can't be
+// copied to another record.
+func recordAdditionalData(r map[string]types.AttributeValue) []byte {
+	var pk, sk string
+	if v, ok := r["_pk"].(*types.AttributeValueMemberS); ok {
+		pk = v.Value
+	}
+	if v, ok := r["_sk"].(*types.AttributeValueMemberS); ok {
+		sk = v.Value
+	}
+	return []byte(pk + "/" + sk)
+}
+
+func encrypt(key, plaintext, additionalData []byte) (ciphertext []byte, err error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func decrypt(key, ciphertext, additionalData []byte) (plaintext []byte, err error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("encrypted payload is too short")
+	}
+	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	plaintext, err = gcm.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		err = fmt.Errorf("failed to decrypt payload: %w", err)
+	}
+	return
+}
+
+func newGCM(key []byte) (gcm cipher.AEAD, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return
+	}
+	return cipher.NewGCM(block)
+}
+
+// marshalAttributeValueMapJSON encodes the attributes as DynamoDB JSON, the format used
+// by DynamoDB Streams, e.g. {"name":{"S":"value"}}.
+func marshalAttributeValueMapJSON(m map[string]types.AttributeValue) ([]byte, error) {
+	jm, err := toAttributeValueJSONMap(m)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jm)
+}
+
+func unmarshalAttributeValueMapJSON(data []byte) (m map[string]types.AttributeValue, err error) {
+	var jm map[string]map[string]json.RawMessage
+	err = json.Unmarshal(data, &jm)
+	if err != nil {
+		return
+	}
+	m = make(map[string]types.AttributeValue, len(jm))
+	for k, v := range jm {
+		m[k], err = fromAttributeValueJSON(v)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func toAttributeValueJSONMap(m map[string]types.AttributeValue) (jm map[string]interface{}, err error) {
+	jm = make(map[string]interface{}, len(m))
+	for k, v := range m {
+		jm[k], err = toAttributeValueJSON(v)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func toAttributeValueJSON(av types.AttributeValue) (j map[string]interface{}, err error) {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberB:
+		return map[string]interface{}{"B": v.Value}, nil
+	case *types.AttributeValueMemberBOOL:
+		return map[string]interface{}{"BOOL": v.Value}, nil
+	case *types.AttributeValueMemberBS:
+		return map[string]interface{}{"BS": v.Value}, nil
+	case *types.AttributeValueMemberL:
+		l := make([]interface{}, len(v.Value))
+		for i := 0; i < len(v.Value); i++ {
+			l[i], err = toAttributeValueJSON(v.Value[i])
+			if err != nil {
+				return
+			}
+		}
+		return map[string]interface{}{"L": l}, nil
+	case *types.AttributeValueMemberM:
+		var m map[string]interface{}
+		m, err = toAttributeValueJSONMap(v.Value)
+		return map[string]interface{}{"M": m}, err
+	case *types.AttributeValueMemberN:
+		return map[string]interface{}{"N": v.Value}, nil
+	case *types.AttributeValueMemberNS:
+		return map[string]interface{}{"NS": v.Value}, nil
+	case *types.AttributeValueMemberNULL:
+		return map[string]interface{}{"NULL": true}, nil
+	case *types.AttributeValueMemberS:
+		return map[string]interface{}{"S": v.Value}, nil
+	case *types.AttributeValueMemberSS:
+		return map[string]interface{}{"SS": v.Value}, nil
+	}
+	return nil, fmt.Errorf("unknown attribute value type: %T", av)
+}
+
+func fromAttributeValueJSON(j map[string]json.RawMessage) (av types.AttributeValue, err error) {
+	for typ, raw := range j {
+		switch typ {
+		case "B":
+			var v []byte
+			err = json.Unmarshal(raw, &v)
+			return &types.AttributeValueMemberB{Value: v}, err
+		case "BOOL":
+			var v bool
+			err = json.Unmarshal(raw, &v)
+			return &types.AttributeValueMemberBOOL{Value: v}, err
+		case "BS":
+			var v [][]byte
+			err = json.Unmarshal(raw, &v)
+			return &types.AttributeValueMemberBS{Value: v}, err
+		case "L":
+			var jl []map[string]json.RawMessage
+			err = json.Unmarshal(raw, &jl)
+			if err != nil {
+				return
+			}
+			l := make([]types.AttributeValue, len(jl))
+			for i := 0; i < len(jl); i++ {
+				l[i], err = fromAttributeValueJSON(jl[i])
+				if err != nil {
+					return
+				}
+			}
+			return &types.AttributeValueMemberL{Value: l}, nil
+		case "M":
+			var m map[string]types.AttributeValue
+			m, err = unmarshalAttributeValueMapJSON(raw)
+			return &types.AttributeValueMemberM{Value: m}, err
+		case "N":
+			var v string
+			err = json.Unmarshal(raw, &v)
+			return &types.AttributeValueMemberN{Value: v}, err
+		case "NS":
+			var v []string
+			err = json.Unmarshal(raw, &v)
+			return &types.AttributeValueMemberNS{Value: v}, err
+		case "NULL":
+			return &types.AttributeValueMemberNULL{Value: true}, nil
+		case "S":
+			var v string
+			err = json.Unmarshal(raw, &v)
+			return &types.AttributeValueMemberS{Value: v}, err
+		case "SS":
+			var v []string
+			err = json.Unmarshal(raw, &v)
+			return &types.AttributeValueMemberSS{Value: v}, err
+		}
+		return nil, fmt.Errorf("unknown attribute value type: %q", typ)
+	}
+	return nil, errors.New("empty attribute value")
+}
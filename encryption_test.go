@@ -0,0 +1,256 @@
+package stream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// mockKMS "encrypts" data keys by reversing them.
+type mockKMS struct {
+	generateCalls int
+	decryptCalls  int
+}
+
+func (m *mockKMS) GenerateDataKey(_ context.Context, _ *kms.GenerateDataKeyInput, _ ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error) {
+	m.generateCalls++
+	plaintext := []byte("0123456789abcdef0123456789abcdef")
+	return &kms.GenerateDataKeyOutput{
+		Plaintext:      plaintext,
+		CiphertextBlob: reverse(plaintext),
+	}, nil
+}
+
+func (m *mockKMS) Decrypt(_ context.Context, input *kms.DecryptInput, _ ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	m.decryptCalls++
+	return &kms.DecryptOutput{
+		Plaintext: reverse(input.CiphertextBlob),
+	}, nil
+}
+
+func reverse(b []byte) (r []byte) {
+	r = make([]byte, len(b))
+	for i := 0; i < len(b); i++ {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
+
+func TestEncryption(t *testing.T) {
+	// Arrange.
+	kmsClient := &mockKMS{}
+	s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient), WithEncryption("arn:aws:kms:eu-west-1:123456789012:key/test"), WithKMSClient(kmsClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	state := &AverageState{Sum: 3, Count: 2, Value: 1.5}
+
+	// Act.
+	items, err := s.Prepare("id", 0, state, []InboundEvent{Add{Number: 3}}, nil)
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Assert.
+	for _, item := range items {
+		r := item.Put.Item
+		if _, ok := r["Sum"]; ok {
+			t.Errorf("expected payload attributes to be encrypted, got %v", r)
+		}
+		if _, ok := r["_enc"]; !ok {
+			t.Errorf("expected _enc attribute, got %v", r)
+		}
+		if diff := cmp.Diff(&types.AttributeValueMemberS{Value: "Average/id"}, r["_pk"], ignoreAttributeValueUnexported); diff != "" {
+			t.Error(diff)
+		}
+	}
+	decrypted, err := s.decryptRecord(context.Background(), items[0].Put.Item, nil)
+	if err != nil {
+		t.Fatalf("failed to decrypt: %v", err)
+	}
+	actual := &AverageState{}
+	err = s.unmarshalMap(decrypted, actual)
+	if err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if diff := cmp.Diff(state, actual); diff != "" {
+		t.Error(diff)
+	}
+	if _, err = s.Decrypt(context.Background(), items[1].Put.Item); err != nil {
+		t.Fatalf("failed to decrypt: %v", err)
+	}
+	if kmsClient.decryptCalls != 1 {
+		t.Errorf("expected the data key to be cached, but KMS was called %d times", kmsClient.decryptCalls)
+	}
+}
+
+func TestEncryptionIsBoundToTheRecordKey(t *testing.T) {
+	s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient), WithEncryption("key"), WithKMSClient(&mockKMS{}))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	items, err := s.Prepare("id", 0, &AverageState{Sum: 1}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+	r := items[0].Put.Item
+	r["_pk"] = &types.AttributeValueMemberS{Value: "Average/other"}
+	_, err = s.decryptRecord(context.Background(), r, nil)
+	if err == nil {
+		t.Error("expected error decrypting a payload copied to another record")
+	}
+}
+
+func TestEncryptionReusesDataKeysPerEntity(t *testing.T) {
+	// Arrange.
+	kmsClient := &mockKMS{}
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := ClockFunc(func() time.Time { return now })
+	s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient), WithEncryption("key"), WithKMSClient(kmsClient), WithClock(clock), WithDataKeyCache(10, time.Minute))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	prepare := func(id string) {
+		if _, err := s.Prepare(id, 0, &AverageState{Sum: 1}, []InboundEvent{Add{Number: 1}}, nil); err != nil {
+			t.Fatalf("failed to prepare: %v", err)
+		}
+	}
+
+	// Act.
+	prepare("a")
+	prepare("a")
+	prepare("b")
+	afterWrites := kmsClient.generateCalls
+	now = now.Add(time.Minute)
+	prepare("a")
+
+	// Assert.
+	if afterWrites != 2 {
+		t.Errorf("expected a data key to be generated per entity, got %d calls to KMS", afterWrites)
+	}
+	if kmsClient.generateCalls != 3 {
+		t.Errorf("expected a new data key to be generated after the TTL, got %d calls to KMS", kmsClient.generateCalls)
+	}
+}
+
+func TestDataKeyCache(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c := newDataKeyCache(2, time.Minute, func() time.Time { return now })
+	c.put("a", dataKey{Plaintext: []byte("a")})
+	c.put("b", dataKey{Plaintext: []byte("b")})
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+	c.put("c", dataKey{Plaintext: []byte("c")})
+	if _, ok := c.get("b"); ok {
+		t.Error("expected the least recently used key to be evicted")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Error("expected a to be cached")
+	}
+	now = now.Add(time.Minute)
+	if _, ok := c.get("c"); ok {
+		t.Error("expected c to expire")
+	}
+	if len(c.entries) != 1 || c.order.Len() != 1 {
+		t.Errorf("expected expired keys to be removed, got %d entries", len(c.entries))
+	}
+}
+
+func TestAttributeValueJSON(t *testing.T) {
+	expected := map[string]types.AttributeValue{
+		"B":         &types.AttributeValueMemberB{Value: []byte{0xDE, 0xAD}},
+		"BOOL":      &types.AttributeValueMemberBOOL{Value: true},
+		"BS":        &types.AttributeValueMemberBS{Value: [][]byte{{0xBE}, {0xEF}}},
+		"EmptyList": &types.AttributeValueMemberL{Value: []types.AttributeValue{}},
+		"L": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+			&types.AttributeValueMemberS{Value: "a"},
+			&types.AttributeValueMemberN{Value: "1"},
+		}},
+		"M": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"inner": &types.AttributeValueMemberS{Value: "value"},
+		}},
+		"N":    &types.AttributeValueMemberN{Value: "1.5"},
+		"NS":   &types.AttributeValueMemberNS{Value: []string{"1", "2"}},
+		"NULL": &types.AttributeValueMemberNULL{Value: true},
+		"S":    &types.AttributeValueMemberS{Value: "string"},
+		"SS":   &types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+	}
+	data, err := marshalAttributeValueMapJSON(expected)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	actual, err := unmarshalAttributeValueMapJSON(data)
+	if err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if diff := cmp.Diff(expected, actual, ignoreAttributeValueUnexported); diff != "" {
+		t.Error(diff)
+	}
+}
+
+var ignoreAttributeValueUnexported = cmpopts.IgnoreUnexported(
+	types.AttributeValueMemberB{},
+	types.AttributeValueMemberBOOL{},
+	types.AttributeValueMemberBS{},
+	types.AttributeValueMemberL{},
+	types.AttributeValueMemberM{},
+	types.AttributeValueMemberN{},
+	types.AttributeValueMemberNS{},
+	types.AttributeValueMemberNULL{},
+	types.AttributeValueMemberS{},
+	types.AttributeValueMemberSS{},
+)
+
+func TestCryptoShreddingIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	// Arrange.
+	name := createLocalTable(t)
+	defer deleteLocalTable(t, name)
+	s, err := NewStore(name, "Average", WithRegion(region), WithClient(testClient), WithEncryption("key"), WithKMSClient(&mockKMS{}), WithCryptoShredding(true))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	err = s.Put("id", 0, &AverageState{Sum: 1}, []InboundEvent{Add{Number: 1}}, nil)
+	if err != nil {
+		t.Fatalf("failed to put state: %v", err)
+	}
+	err = s.Put("id", 1, &AverageState{Sum: 2}, []InboundEvent{Add{Number: 1}}, nil)
+	if err != nil {
+		t.Fatalf("failed to put updated state: %v", err)
+	}
+	retrieved := &AverageState{}
+	if _, err = s.Get("id", retrieved); err != nil {
+		t.Fatalf("failed to get state: %v", err)
+	}
+	if retrieved.Sum != 2 {
+		t.Errorf("expected sum of 2, got %d", retrieved.Sum)
+	}
+
+	// Act.
+	err = s.Shred(context.Background(), "id")
+	if err != nil {
+		t.Fatalf("failed to shred: %v", err)
+	}
+
+	// Assert.
+	_, err = s.Get("id", &AverageState{})
+	if err != ErrShredded {
+		t.Errorf("expected ErrShredded, got %v", err)
+	}
+	err = s.Put("id", 2, &AverageState{Sum: 3}, []InboundEvent{Add{Number: 1}}, nil)
+	if err != ErrShredded {
+		t.Errorf("expected writes to a shredded entity to return ErrShredded, got %v", err)
+	}
+	_, err = s.Get("id", &AverageState{})
+	if err != ErrShredded {
+		t.Errorf("expected ErrShredded after a write, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package stream
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ListEntities returns the IDs of up to limit entities in the store's namespace, e.g. to
+// browse them in an admin UI, and a cursor to pass to the next call, which is empty when
+// there are no more entities. Entities are found by scanning the table, so the IDs aren't
+// sorted.
+func (ddb *DynamoDBStore) ListEntities(ctx context.Context, limit int, cursor string) (ids []string, next string, err error) {
+	if limit <= 0 {
+		return nil, "", fmt.Errorf("list entities: limit must be positive")
+	}
+	var startKey map[string]types.AttributeValue
+	if cursor != "" {
+		if startKey, err = decodeCursor(cursor); err != nil {
+			return
+		}
+	}
+	var after map[string]types.AttributeValue
+	err = ddb.scanEntities(ctx, startKey, func(id string, key map[string]types.AttributeValue, last bool) bool {
+		ids = append(ids, id)
+		if len(ids) < limit {
+			return true
+		}
+		// Continue from the last returned entity, unless it's the end of the table.
+		if !last {
+			after = key
+		}
+		return false
+	})
+	if err != nil || after == nil {
+		return
+	}
+	next, err = encodeCursor(after)
+	return
+}
+
+// scanEntities passes the ID and key of each entity in the store's namespace, and tenant if
+// the store is tenant-scoped, to f, starting after startKey if it's set. last is true for the
+// final entity in the table. The scan stops when f returns false.
+func (ddb *DynamoDBStore) scanEntities(ctx context.Context, startKey map[string]types.AttributeValue, f func(id string, key map[string]types.AttributeValue, last bool) bool) (err error) {
+	prefix := ddb.createPartitionKey("")
+	si := &dynamodb.ScanInput{
+		TableName:              ddb.TableName,
+		ConsistentRead:         aws.Bool(!ddb.EventuallyConsistentReads),
+		FilterExpression:       aws.String("begins_with(#_pk, :_pk) AND #_sk = :_sk"),
+		ProjectionExpression:   aws.String("#_pk, #_sk"),
+		ExclusiveStartKey:      startKey,
+		ReturnConsumedCapacity: ddb.returnConsumedCapacity(),
+		ExpressionAttributeNames: map[string]string{
+			"#_pk": "_pk",
+			"#_sk": "_sk",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":_pk": ddb.attributeValueString(prefix),
+			":_sk": ddb.attributeValueString(ddb.createStateRecordSortKey()),
+		},
+	}
+	for {
+		var page *dynamodb.ScanOutput
+		page, err = ddb.Client.Scan(ctx, si)
+		if err != nil {
+			return
+		}
+		if page.ConsumedCapacity != nil {
+			ddb.reportCapacity(OperationScan, *page.ConsumedCapacity)
+		}
+		for i, item := range page.Items {
+			key := map[string]types.AttributeValue{
+				"_pk": item["_pk"],
+				"_sk": item["_sk"],
+			}
+			last := i == len(page.Items)-1 && len(page.LastEvaluatedKey) == 0
+			if !f(strings.TrimPrefix(stringAttribute(item, "_pk"), prefix), key, last) {
+				return
+			}
+		}
+		if len(page.LastEvaluatedKey) == 0 {
+			return
+		}
+		si.ExclusiveStartKey = page.LastEvaluatedKey
+	}
+}
+
+func encodeCursor(key map[string]types.AttributeValue) (cursor string, err error) {
+	data, err := marshalAttributeValueMapJSON(key)
+	if err != nil {
+		return
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(cursor string) (key map[string]types.AttributeValue, err error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("list entities: invalid cursor: %w", err)
+	}
+	key, err = unmarshalAttributeValueMapJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("list entities: invalid cursor: %w", err)
+	}
+	return
+}
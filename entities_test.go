@@ -0,0 +1,94 @@
+package stream
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEntityCursorRoundTrip(t *testing.T) {
+	// Arrange.
+	key := map[string]types.AttributeValue{
+		"_pk": &types.AttributeValueMemberS{Value: "Average/id"},
+		"_sk": &types.AttributeValueMemberS{Value: "STATE"},
+	}
+
+	// Act.
+	cursor, err := encodeCursor(key)
+	if err != nil {
+		t.Fatalf("failed to encode cursor: %v", err)
+	}
+	decoded, err := decodeCursor(cursor)
+	if err != nil {
+		t.Fatalf("failed to decode cursor: %v", err)
+	}
+
+	// Assert.
+	if diff := cmp.Diff(key, decoded, cmp.AllowUnexported(types.AttributeValueMemberS{})); diff != "" {
+		t.Error(diff)
+	}
+	if _, err = decodeCursor("not a cursor"); err == nil {
+		t.Error("expected an error for an invalid cursor")
+	}
+}
+
+func TestListEntitiesIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	// Arrange.
+	name := createLocalTable(t)
+	defer deleteLocalTable(t, name)
+	s, err := NewStore(name, "Average", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	other, err := NewStore(name, "Other", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	var expected []string
+	for i := 0; i < 5; i++ {
+		id := strconv.Itoa(i)
+		expected = append(expected, id)
+		p, err := New(s, id, &AverageState{})
+		if err != nil {
+			t.Fatalf("failed to create processor: %v", err)
+		}
+		if err = p.Process(Add{Number: i}); err != nil {
+			t.Fatalf("failed to process: %v", err)
+		}
+	}
+	p, err := New(other, "other", &AverageState{})
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+	if err = p.Process(Add{Number: 1}); err != nil {
+		t.Fatalf("failed to process: %v", err)
+	}
+
+	// Act.
+	var ids []string
+	var cursor string
+	for pages := 0; pages < 10; pages++ {
+		var page []string
+		page, cursor, err = s.ListEntities(context.Background(), 2, cursor)
+		if err != nil {
+			t.Fatalf("failed to list entities: %v", err)
+		}
+		ids = append(ids, page...)
+		if cursor == "" {
+			break
+		}
+	}
+
+	// Assert.
+	sort.Strings(ids)
+	if diff := cmp.Diff(expected, ids); diff != "" {
+		t.Error(diff)
+	}
+}
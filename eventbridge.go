@@ -0,0 +1,61 @@
+package stream
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// EventTimer can be implemented by outbound events to set the Time of the EventBridge event,
+// e.g. when the event happened in an external system. Otherwise, EventBridge uses the time
+// that the event was sent.
+type EventTimer interface {
+	EventTime() time.Time
+}
+
+// ResourceLister can be implemented by outbound events to set the Resources of the
+// EventBridge event, i.e. the ARNs of the AWS resources that the event relates to.
+type ResourceLister interface {
+	Resources() []string
+}
+
+// DetailTypeOverrider can be implemented by outbound events to send the EventBridge event
+// with a DetailType other than the event name.
+type DetailTypeOverrider interface {
+	DetailTypeOverride() string
+}
+
+// EventBusNamer can be implemented by outbound events to send the event to a different
+// event bus than the handler's EVENT_BUS_NAME, e.g. a tenant-specific bus. The handler's
+// role must have permission to put events on the bus.
+type EventBusNamer interface {
+	EventBusName() string
+}
+
+// EventSourcer can be implemented by outbound events to send the event with a different
+// Source than the handler's EVENT_SOURCE_NAME.
+type EventSourcer interface {
+	EventSource() string
+}
+
+// attributeValuesEventBridge returns the attributes used by the handler to populate the
+// EventBridge fields of the outbound event.
+func (ddb *DynamoDBStore) attributeValuesEventBridge(e OutboundEvent) (avs map[string]types.AttributeValue) {
+	avs = make(map[string]types.AttributeValue)
+	if t, ok := e.(EventTimer); ok && !t.EventTime().IsZero() {
+		avs["_eventTime"] = ddb.attributeValueString(t.EventTime().UTC().Format(time.RFC3339Nano))
+	}
+	if r, ok := e.(ResourceLister); ok && len(r.Resources()) > 0 {
+		avs["_resources"] = &types.AttributeValueMemberSS{Value: r.Resources()}
+	}
+	if d, ok := e.(DetailTypeOverrider); ok && d.DetailTypeOverride() != "" {
+		avs["_detailType"] = ddb.attributeValueString(d.DetailTypeOverride())
+	}
+	if b, ok := e.(EventBusNamer); ok && b.EventBusName() != "" {
+		avs["_eventBus"] = ddb.attributeValueString(b.EventBusName())
+	}
+	if src, ok := e.(EventSourcer); ok && src.EventSource() != "" {
+		avs["_source"] = ddb.attributeValueString(src.EventSource())
+	}
+	return
+}
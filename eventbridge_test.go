@@ -0,0 +1,84 @@
+package stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+type InstanceStopped struct {
+	InstanceARN string    `dynamodbav:"instanceArn"`
+	StoppedAt   time.Time `dynamodbav:"stoppedAt"`
+}
+
+func (InstanceStopped) EventName() string          { return "InstanceStopped" }
+func (InstanceStopped) IsOutbound()                {}
+func (e InstanceStopped) EventTime() time.Time     { return e.StoppedAt }
+func (e InstanceStopped) Resources() []string      { return []string{e.InstanceARN} }
+func (InstanceStopped) DetailTypeOverride() string { return "EC2 Instance Stopped" }
+
+func TestEventBridgeFieldsAreStored(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	e := InstanceStopped{
+		InstanceARN: "arn:aws:ec2:eu-west-2:123456789012:instance/i-1",
+		StoppedAt:   time.Date(2022, time.November, 20, 13, 0, 0, 0, time.UTC),
+	}
+
+	// Act.
+	items, err := s.Prepare("id", 0, &AverageState{}, nil, []OutboundEvent{e, Average{Value: 1}})
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Assert.
+	expected := map[string]types.AttributeValue{
+		"_eventTime":  &types.AttributeValueMemberS{Value: "2022-11-20T13:00:00Z"},
+		"_resources":  &types.AttributeValueMemberSS{Value: []string{"arn:aws:ec2:eu-west-2:123456789012:instance/i-1"}},
+		"_detailType": &types.AttributeValueMemberS{Value: "EC2 Instance Stopped"},
+	}
+	for k, v := range expected {
+		if diff := cmp.Diff(v, items[1].Put.Item[k], cmp.AllowUnexported(types.AttributeValueMemberS{}, types.AttributeValueMemberSS{})); diff != "" {
+			t.Errorf("%s: %s", k, diff)
+		}
+		if _, ok := items[2].Put.Item[k]; ok {
+			t.Errorf("expected events that don't set %s not to store it", k)
+		}
+	}
+}
+
+type TenantInvoiced struct {
+	Tenant string `dynamodbav:"tenant"`
+}
+
+func (TenantInvoiced) EventName() string      { return "TenantInvoiced" }
+func (TenantInvoiced) IsOutbound()            {}
+func (e TenantInvoiced) EventBusName() string { return "tenant-" + e.Tenant }
+func (TenantInvoiced) EventSource() string    { return "billing" }
+
+func TestEventBusAndSourceAreStored(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	// Act.
+	items, err := s.Prepare("id", 0, &AverageState{}, nil, []OutboundEvent{TenantInvoiced{Tenant: "a"}})
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Assert.
+	if bus, ok := items[1].Put.Item["_eventBus"].(*types.AttributeValueMemberS); !ok || bus.Value != "tenant-a" {
+		t.Errorf("expected the event bus to be stored, got %v", items[1].Put.Item["_eventBus"])
+	}
+	if source, ok := items[1].Put.Item["_source"].(*types.AttributeValueMemberS); !ok || source.Value != "billing" {
+		t.Errorf("expected the source to be stored, got %v", items[1].Put.Item["_source"])
+	}
+}
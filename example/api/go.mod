@@ -5,7 +5,6 @@ go 1.16
 replace github.com/a-h/stream => ../../
 
 require (
-	github.com/a-h/pathvars v0.0.0-20200320143331-78b263b728e2
 	github.com/a-h/stream v0.0.0-20210716111946-61d6ec1f2973
 	github.com/akrylysov/algnhsa v0.12.1
 	github.com/google/go-cmp v0.5.9
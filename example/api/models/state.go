@@ -93,7 +93,7 @@ func (_ InsertCoin) EventName() string { return "InsertCoin" }
 func (_ InsertCoin) IsInbound()        {}
 
 type PullHandle struct {
-	UserID string `json:"userId"`
+	UserID string `json:"userId" validate:"required"`
 }
 
 func (_ PullHandle) EventName() string { return "PullHandle" }
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/aws/aws-cdk-go/awscdk/v2"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsevents"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awseventstargets"
+	"github.com/aws/constructs-go/constructs/v10"
+	"github.com/aws/jsii-runtime-go"
+)
+
+// APIDestinationProps configures delivery of selected outbound event types to an
+// HTTP endpoint via an EventBridge API Destination.
+type APIDestinationProps struct {
+	// EventBus that the stream handler publishes outbound events to.
+	EventBus awsevents.IEventBus
+	// Source is the EVENT_SOURCE_NAME of the stream handler.
+	Source string
+	// EventTypes are the outbound event names (EventBridge detail types) to send.
+	EventTypes []string
+	// Endpoint is the HTTP endpoint to POST the events to.
+	Endpoint string
+	// APIKeyHeader is the name of the header used to send the API key, e.g. "x-api-key".
+	APIKeyHeader string
+	// APIKeySecretID is the Secrets Manager secret name or ARN that contains the API key.
+	APIKeySecretID string
+}
+
+// NewAPIDestination creates a rule on the event bus that sends the selected outbound event
+// types to an EventBridge API Destination, using an API key connection for auth.
+func NewAPIDestination(scope constructs.Construct, id string, props APIDestinationProps) awsevents.Rule {
+	connection := awsevents.NewConnection(scope, jsii.String(id+"Connection"), &awsevents.ConnectionProps{
+		Authorization: awsevents.Authorization_ApiKey(jsii.String(props.APIKeyHeader),
+			awscdk.SecretValue_SecretsManager(jsii.String(props.APIKeySecretID), nil)),
+	})
+	destination := awsevents.NewApiDestination(scope, jsii.String(id+"Destination"), &awsevents.ApiDestinationProps{
+		Connection: connection,
+		Endpoint:   jsii.String(props.Endpoint),
+		HttpMethod: awsevents.HttpMethod_POST,
+	})
+	rule := awsevents.NewRule(scope, jsii.String(id+"Rule"), &awsevents.RuleProps{
+		EventBus: props.EventBus,
+		EventPattern: &awsevents.EventPattern{
+			Source:     jsii.Strings(props.Source),
+			DetailType: jsii.Strings(props.EventTypes...),
+		},
+	})
+	rule.AddTarget(awseventstargets.NewApiDestination(destination, &awseventstargets.ApiDestinationProps{
+		// Send the outbound event, rather than the whole EventBridge envelope.
+		Event: awsevents.RuleTargetInput_FromEventPath(jsii.String("$.detail")),
+	}))
+	return rule
+}
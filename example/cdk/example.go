@@ -14,6 +14,8 @@ import (
 	"github.com/aws/jsii-runtime-go"
 )
 
+const eventSourceName = "slot-machine"
+
 type ExampleStackProps struct {
 	awscdk.StackProps
 }
@@ -63,7 +65,7 @@ func NewExampleStack(scope constructs.Construct, id string, props *ExampleStackP
 		Tracing:      awslambda.Tracing_ACTIVE,
 		Environment: &map[string]*string{
 			"EVENT_BUS_NAME":    eventBus.EventBusName(),
-			"EVENT_SOURCE_NAME": jsii.String("slot-machine"),
+			"EVENT_SOURCE_NAME": jsii.String(eventSourceName),
 		},
 		Timeout:      awscdk.Duration_Minutes(jsii.Number(15)),
 		LogRetention: awslogs.RetentionDays_ONE_YEAR,
@@ -89,6 +91,25 @@ func NewExampleStack(scope constructs.Construct, id string, props *ExampleStackP
 		Filters:          &filters,
 	}))
 
+	// Optionally, send payouts to a partner's HTTP endpoint, configured with:
+	//   cdk deploy -c payoutEndpoint=https://example.com/payouts -c payoutAPIKeySecretID=payoutApiKey
+	if endpoint, ok := stack.Node().TryGetContext(jsii.String("payoutEndpoint")).(string); ok && endpoint != "" {
+		secretID, ok := stack.Node().TryGetContext(jsii.String("payoutAPIKeySecretID")).(string)
+		if ok && secretID != "" {
+			NewAPIDestination(stack, "payout", APIDestinationProps{
+				EventBus:       eventBus,
+				Source:         eventSourceName,
+				EventTypes:     []string{"PayoutMade"},
+				Endpoint:       endpoint,
+				APIKeyHeader:   "x-api-key",
+				APIKeySecretID: secretID,
+			})
+		} else {
+			// Fail synth with a clear message, rather than passing an empty secret ID to Secrets Manager.
+			awscdk.Annotations_Of(stack).AddError(jsii.String("payoutEndpoint requires the payoutAPIKeySecretID context value, the name of the Secrets Manager secret that contains the API key"))
+		}
+	}
+
 	// POST /machine/id/insertCoin handler.
 	insertCoinPost := awslambdago.NewGoFunction(stack, jsii.String("insertCoinHandler"), &awslambdago.GoFunctionProps{
 		Runtime:      awslambda.Runtime_PROVIDED_AL2(),
@@ -0,0 +1,116 @@
+package orders
+
+import (
+	"fmt"
+
+	"github.com/a-h/stream"
+)
+
+// Namespaces of the entities that take part in fulfilling an order.
+const (
+	OrderNamespace    = "order"
+	PaymentNamespace  = "payment"
+	ShipmentNamespace = "shipment"
+)
+
+// Command is an inbound event to send to an entity.
+type Command struct {
+	Namespace string
+	ID        string
+	Event     stream.InboundEvent
+}
+
+// Fulfill is the process manager that coordinates the order, payment and shipment
+// entities. It receives the outbound events of each entity (e.g. from an EventBridge
+// rule), and returns the commands to send next.
+//
+// It doesn't keep any state of its own. Each entity uses the order ID as its ID and
+// ignores duplicate commands, so redelivered events are safe to handle again.
+func Fulfill(event stream.OutboundEvent) (commands []Command) {
+	switch e := event.(type) {
+	case OrderPlaced:
+		commands = append(commands, Command{
+			Namespace: PaymentNamespace,
+			ID:        e.OrderID,
+			Event:     TakePayment{CustomerID: e.CustomerID, Amount: e.Amount},
+		})
+	case PaymentTaken:
+		commands = append(commands, Command{
+			Namespace: OrderNamespace,
+			ID:        e.OrderID,
+			Event:     MarkOrderPaid{},
+		})
+	case PaymentFailed:
+		commands = append(commands, Command{
+			Namespace: OrderNamespace,
+			ID:        e.OrderID,
+			Event:     CancelOrder{Reason: e.Reason},
+		})
+	case OrderPaid:
+		commands = append(commands, Command{
+			Namespace: ShipmentNamespace,
+			ID:        e.OrderID,
+			Event:     ShipOrder{Address: e.Address},
+		})
+	case OrderShipped:
+		commands = append(commands, Command{
+			Namespace: OrderNamespace,
+			ID:        e.OrderID,
+			Event:     MarkOrderShipped{},
+		})
+	case ShipmentFailed:
+		commands = append(commands, Command{
+			Namespace: OrderNamespace,
+			ID:        e.OrderID,
+			Event:     CancelOrder{Reason: e.Reason},
+		})
+	case OrderCancelled:
+		if e.Refund {
+			commands = append(commands, Command{
+				Namespace: PaymentNamespace,
+				ID:        e.OrderID,
+				Event:     RefundPayment{},
+			})
+		}
+	}
+	return
+}
+
+// NewState creates an empty state for the namespace.
+func NewState(namespace, id string) (state stream.State, err error) {
+	switch namespace {
+	case OrderNamespace:
+		return NewOrder(id), nil
+	case PaymentNamespace:
+		return NewPayment(id), nil
+	case ShipmentNamespace:
+		return NewShipment(id), nil
+	}
+	return nil, fmt.Errorf("unknown namespace %q", namespace)
+}
+
+// Dispatcher sends commands to entities.
+type Dispatcher struct {
+	// Stores for each namespace.
+	Stores map[string]stream.Store
+}
+
+// Dispatch the command to the entity, creating the entity if it doesn't exist.
+func (d Dispatcher) Dispatch(cmd Command) (err error) {
+	store, ok := d.Stores[cmd.Namespace]
+	if !ok {
+		return fmt.Errorf("no store for namespace %q", cmd.Namespace)
+	}
+	state, err := NewState(cmd.Namespace, cmd.ID)
+	if err != nil {
+		return
+	}
+	p, err := stream.Load(store, cmd.ID, state)
+	if err == stream.ErrStateNotFound {
+		p, err = stream.New(store, cmd.ID, state)
+	}
+	if err != nil {
+		return
+	}
+	return p.Process(cmd.Event)
+}
@@ -0,0 +1,263 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/a-h/stream"
+	"github.com/a-h/stream/projection"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/google/go-cmp/cmp"
+)
+
+var placedAt = time.Date(2022, time.November, 20, 13, 0, 0, 0, time.UTC)
+
+// expiry is the payment timeout scheduled when the order is placed.
+var expiry = stream.Schedule(OrderNamespace, "order", placedAt.Add(PaymentTimeout), ExpireOrder{})
+
+// simulate processes the commands against in-memory states, passing each outbound
+// event to the process manager until there are no more commands to process.
+func simulate(t *testing.T, states map[string]stream.State, commands ...Command) (events []stream.OutboundEvent) {
+	for len(commands) > 0 {
+		cmd := commands[0]
+		commands = commands[1:]
+		key := cmd.Namespace + "/" + cmd.ID
+		state, ok := states[key]
+		if !ok {
+			var err error
+			state, err = NewState(cmd.Namespace, cmd.ID)
+			if err != nil {
+				t.Fatalf("failed to create state: %v", err)
+			}
+			states[key] = state
+		}
+		outbound, err := state.Process(cmd.Event)
+		if err != nil {
+			t.Fatalf("failed to process %s: %v", cmd.Event.EventName(), err)
+		}
+		for _, e := range outbound {
+			events = append(events, e)
+			commands = append(commands, Fulfill(e)...)
+		}
+	}
+	return
+}
+
+func TestFulfillment(t *testing.T) {
+	var tests = []struct {
+		name          string
+		order         PlaceOrder
+		expectedOrder *Order
+		expected      []stream.OutboundEvent
+	}{
+		{
+			name:  "orders are paid for, shipped and completed",
+			order: PlaceOrder{CustomerID: "customer", Amount: 100, Address: "1 Main Street", At: placedAt},
+			expectedOrder: &Order{
+				ID:         "order",
+				CustomerID: "customer",
+				Amount:     100,
+				Address:    "1 Main Street",
+				Status:     OrderStatusCompleted,
+			},
+			expected: []stream.OutboundEvent{
+				OrderPlaced{OrderID: "order", CustomerID: "customer", Amount: 100, Address: "1 Main Street"},
+				expiry,
+				PaymentTaken{OrderID: "order", Amount: 100},
+				OrderPaid{OrderID: "order", Address: "1 Main Street"},
+				OrderShipped{OrderID: "order"},
+				OrderCompleted{OrderID: "order"},
+			},
+		},
+		{
+			name:  "orders are cancelled if payment fails",
+			order: PlaceOrder{CustomerID: "customer", Amount: Limit + 1, Address: "1 Main Street", At: placedAt},
+			expectedOrder: &Order{
+				ID:         "order",
+				CustomerID: "customer",
+				Amount:     Limit + 1,
+				Address:    "1 Main Street",
+				Status:     OrderStatusCancelled,
+				Reason:     "payment limit exceeded",
+			},
+			expected: []stream.OutboundEvent{
+				OrderPlaced{OrderID: "order", CustomerID: "customer", Amount: Limit + 1, Address: "1 Main Street"},
+				expiry,
+				PaymentFailed{OrderID: "order", Reason: "payment limit exceeded"},
+				OrderCancelled{OrderID: "order", Reason: "payment limit exceeded"},
+			},
+		},
+		{
+			name:  "payments are refunded if shipping fails",
+			order: PlaceOrder{CustomerID: "customer", Amount: 100, At: placedAt},
+			expectedOrder: &Order{
+				ID:         "order",
+				CustomerID: "customer",
+				Amount:     100,
+				Status:     OrderStatusCancelled,
+				Reason:     "missing address",
+				Refunded:   true,
+			},
+			expected: []stream.OutboundEvent{
+				OrderPlaced{OrderID: "order", CustomerID: "customer", Amount: 100},
+				expiry,
+				PaymentTaken{OrderID: "order", Amount: 100},
+				OrderPaid{OrderID: "order"},
+				ShipmentFailed{OrderID: "order", Reason: "missing address"},
+				OrderCancelled{OrderID: "order", Reason: "missing address", Refund: true},
+				PaymentRefunded{OrderID: "order", Amount: 100},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			states := map[string]stream.State{}
+
+			// Act.
+			actual := simulate(t, states, Command{Namespace: OrderNamespace, ID: "order", Event: tt.order})
+
+			// Assert.
+			if diff := cmp.Diff(tt.expected, actual); diff != "" {
+				t.Error("unexpected events")
+				t.Error(diff)
+			}
+			if diff := cmp.Diff(tt.expectedOrder, states[OrderNamespace+"/order"]); diff != "" {
+				t.Error("unexpected order")
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestFulfillmentIgnoresDuplicateEvents(t *testing.T) {
+	// Arrange.
+	states := map[string]stream.State{}
+	events := simulate(t, states, Command{
+		Namespace: OrderNamespace,
+		ID:        "order",
+		Event:     PlaceOrder{CustomerID: "customer", Amount: 100, Address: "1 Main Street", At: placedAt},
+	})
+
+	// Act.
+	var redelivered []Command
+	for _, e := range events {
+		redelivered = append(redelivered, Fulfill(e)...)
+	}
+	duplicates := simulate(t, states, redelivered...)
+
+	// Assert.
+	if len(duplicates) != 0 {
+		t.Errorf("expected redelivered events to be ignored, got %v", duplicates)
+	}
+}
+
+func TestOrdersAreCancelledIfPaymentTimesOut(t *testing.T) {
+	// Arrange.
+	states := map[string]stream.State{}
+	simulate(t, states, Command{Namespace: OrderNamespace, ID: "order", Event: PlaceOrder{CustomerID: "customer", Amount: 100, At: placedAt}}, Command{Namespace: OrderNamespace, ID: "order", Event: ExpireOrder{}})
+	paidOrder := NewOrder("paid")
+	if _, err := paidOrder.Place(PlaceOrder{Amount: 100, At: placedAt}); err != nil {
+		t.Fatalf("failed to place order: %v", err)
+	}
+	if _, err := paidOrder.MarkPaid(); err != nil {
+		t.Fatalf("failed to mark order paid: %v", err)
+	}
+
+	// Act.
+	expired, err := paidOrder.Expire()
+	if err != nil {
+		t.Fatalf("failed to expire order: %v", err)
+	}
+
+	// Assert.
+	order := states[OrderNamespace+"/order"].(*Order)
+	if order.Status != OrderStatusCancelled || order.Reason != "payment timed out" {
+		t.Errorf("expected the unpaid order to be cancelled, got %+v", order)
+	}
+	if len(expired) != 0 || paidOrder.Status != OrderStatusPaid {
+		t.Errorf("expected the timeout of a paid order to be ignored, got %v", expired)
+	}
+}
+
+func TestLatePaymentsAreRefunded(t *testing.T) {
+	// Arrange.
+	o := NewOrder("order")
+	if _, err := o.Place(PlaceOrder{Amount: 100, At: placedAt}); err != nil {
+		t.Fatalf("failed to place order: %v", err)
+	}
+	if _, err := o.Expire(); err != nil {
+		t.Fatalf("failed to expire order: %v", err)
+	}
+
+	// Act.
+	outbound, err := o.MarkPaid()
+	if err != nil {
+		t.Fatalf("failed to mark order paid: %v", err)
+	}
+	duplicate, err := o.MarkPaid()
+	if err != nil {
+		t.Fatalf("failed to mark order paid: %v", err)
+	}
+
+	// Assert.
+	expected := []stream.OutboundEvent{OrderCancelled{OrderID: "order", Reason: "payment timed out", Refund: true}}
+	if diff := cmp.Diff(expected, outbound); diff != "" {
+		t.Error(diff)
+	}
+	if len(duplicate) != 0 {
+		t.Errorf("expected duplicate payments to be ignored, got %v", duplicate)
+	}
+}
+
+func TestOrdersCannotBeShippedBeforePayment(t *testing.T) {
+	// Arrange.
+	o := NewOrder("order")
+	if _, err := o.Place(PlaceOrder{Amount: 100, At: placedAt}); err != nil {
+		t.Fatalf("failed to place order: %v", err)
+	}
+
+	// Act.
+	_, err := o.MarkShipped()
+
+	// Assert.
+	if !errors.Is(err, ErrOrderNotPaid) {
+		t.Errorf("expected ErrOrderNotPaid, got %v", err)
+	}
+	if o.Status != OrderStatusPlaced {
+		t.Errorf("expected the order to remain placed, got %q", o.Status)
+	}
+}
+
+func TestSummaries(t *testing.T) {
+	// Arrange.
+	events := simulate(t, map[string]stream.State{}, Command{
+		Namespace: OrderNamespace,
+		ID:        "order",
+		Event:     PlaceOrder{CustomerID: "customer", Amount: 100, Address: "1 Main Street", At: placedAt},
+	})
+	summaries := Summaries{}
+
+	// Act.
+	for _, e := range events {
+		item, err := attributevalue.MarshalMap(e)
+		if err != nil {
+			t.Fatalf("failed to marshal %s: %v", e.EventName(), err)
+		}
+		err = summaries.Project(context.Background(), projection.Event{Type: e.EventName(), Item: item})
+		if err != nil {
+			t.Fatalf("failed to project %s: %v", e.EventName(), err)
+		}
+	}
+
+	// Assert.
+	expected := Summaries{
+		"order": {OrderID: "order", CustomerID: "customer", Amount: 100, Status: OrderStatusCompleted},
+	}
+	if diff := cmp.Diff(expected, summaries); diff != "" {
+		t.Error(diff)
+	}
+}
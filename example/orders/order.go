@@ -0,0 +1,208 @@
+package orders
+
+import (
+	"errors"
+	"time"
+
+	"github.com/a-h/stream"
+)
+
+var ErrOrderNotPlaced = errors.New("order has not been placed")
+var ErrOrderAlreadyPlaced = errors.New("order has already been placed")
+var ErrOrderNotPaid = errors.New("order has not been paid")
+
+// PaymentTimeout is how long after an order is placed that it's cancelled if payment
+// hasn't been taken.
+const PaymentTimeout = 30 * time.Minute
+
+type OrderStatus string
+
+const (
+	OrderStatusNew       OrderStatus = ""
+	OrderStatusPlaced    OrderStatus = "placed"
+	OrderStatusPaid      OrderStatus = "paid"
+	OrderStatusCompleted OrderStatus = "completed"
+	OrderStatusCancelled OrderStatus = "cancelled"
+)
+
+func NewOrder(id string) *Order {
+	return &Order{
+		ID: id,
+	}
+}
+
+// Order is the customer's view of the order.
+type Order struct {
+	ID         string      `json:"id"`
+	CustomerID string      `json:"customerId"`
+	Amount     int         `json:"amount"`
+	Address    string      `json:"address"`
+	Status     OrderStatus `json:"status"`
+	Reason     string      `json:"reason,omitempty"`
+	// Refunded is true once a refund of the payment has been requested.
+	Refunded bool `json:"refunded,omitempty"`
+}
+
+func (o *Order) Process(event stream.InboundEvent) (outbound []stream.OutboundEvent, err error) {
+	switch e := event.(type) {
+	case PlaceOrder:
+		return o.Place(e)
+	case MarkOrderPaid:
+		return o.MarkPaid()
+	case MarkOrderShipped:
+		return o.MarkShipped()
+	case CancelOrder:
+		return o.Cancel(e)
+	case ExpireOrder:
+		return o.Expire()
+	}
+	return
+}
+
+func (o *Order) Place(e PlaceOrder) (outbound []stream.OutboundEvent, err error) {
+	if o.Status != OrderStatusNew {
+		return nil, ErrOrderAlreadyPlaced
+	}
+	o.CustomerID = e.CustomerID
+	o.Amount = e.Amount
+	o.Address = e.Address
+	o.Status = OrderStatusPlaced
+	outbound = append(outbound, OrderPlaced{
+		OrderID:    o.ID,
+		CustomerID: o.CustomerID,
+		Amount:     o.Amount,
+		Address:    o.Address,
+	})
+	// Cancel the order if it isn't paid for in time.
+	outbound = append(outbound, stream.Schedule(OrderNamespace, o.ID, e.At.Add(PaymentTimeout), ExpireOrder{}))
+	return
+}
+
+func (o *Order) MarkPaid() (outbound []stream.OutboundEvent, err error) {
+	switch o.Status {
+	case OrderStatusNew:
+		return nil, ErrOrderNotPlaced
+	case OrderStatusPlaced:
+		o.Status = OrderStatusPaid
+		outbound = append(outbound, OrderPaid{OrderID: o.ID, Address: o.Address})
+	case OrderStatusCancelled:
+		// The payment was taken after the order expired, so refund it.
+		if !o.Refunded {
+			o.Refunded = true
+			outbound = append(outbound, OrderCancelled{OrderID: o.ID, Reason: o.Reason, Refund: true})
+		}
+	}
+	// Payment notifications may be delivered more than once, so ignore duplicates.
+	return
+}
+
+func (o *Order) MarkShipped() (outbound []stream.OutboundEvent, err error) {
+	switch o.Status {
+	case OrderStatusNew:
+		return nil, ErrOrderNotPlaced
+	case OrderStatusPlaced:
+		// Orders are only shipped once they've been paid for.
+		return nil, ErrOrderNotPaid
+	case OrderStatusPaid:
+		o.Status = OrderStatusCompleted
+		outbound = append(outbound, OrderCompleted{OrderID: o.ID})
+	}
+	return
+}
+
+func (o *Order) Cancel(e CancelOrder) (outbound []stream.OutboundEvent, err error) {
+	switch o.Status {
+	case OrderStatusNew:
+		return nil, ErrOrderNotPlaced
+	case OrderStatusPlaced, OrderStatusPaid:
+		outbound = append(outbound, OrderCancelled{
+			OrderID: o.ID,
+			Reason:  e.Reason,
+			Refund:  o.Status == OrderStatusPaid,
+		})
+		o.Refunded = o.Status == OrderStatusPaid
+		o.Status = OrderStatusCancelled
+		o.Reason = e.Reason
+	}
+	return
+}
+
+// Expire cancels the order if it still hasn't been paid for when the payment timeout
+// scheduled by Place is delivered.
+func (o *Order) Expire() (outbound []stream.OutboundEvent, err error) {
+	if o.Status != OrderStatusPlaced {
+		return
+	}
+	return o.Cancel(CancelOrder{Reason: "payment timed out"})
+}
+
+// Input events.
+type PlaceOrder struct {
+	CustomerID string `json:"customerId"`
+	Amount     int    `json:"amount"`
+	Address    string `json:"address"`
+	// At is the time that the order was placed.
+	At time.Time `json:"at"`
+}
+
+func (PlaceOrder) EventName() string { return "PlaceOrder" }
+func (PlaceOrder) IsInbound()        {}
+
+type MarkOrderPaid struct{}
+
+func (MarkOrderPaid) EventName() string { return "MarkOrderPaid" }
+func (MarkOrderPaid) IsInbound()        {}
+
+type MarkOrderShipped struct{}
+
+func (MarkOrderShipped) EventName() string { return "MarkOrderShipped" }
+func (MarkOrderShipped) IsInbound()        {}
+
+type CancelOrder struct {
+	Reason string `json:"reason"`
+}
+
+func (CancelOrder) EventName() string { return "CancelOrder" }
+func (CancelOrder) IsInbound()        {}
+
+// ExpireOrder is scheduled by Place, and delivered after the PaymentTimeout.
+type ExpireOrder struct{}
+
+func (ExpireOrder) EventName() string { return "ExpireOrder" }
+func (ExpireOrder) IsInbound()        {}
+
+// Output events.
+type OrderPlaced struct {
+	OrderID    string `json:"orderId"`
+	CustomerID string `json:"customerId"`
+	Amount     int    `json:"amount"`
+	Address    string `json:"address"`
+}
+
+func (OrderPlaced) EventName() string { return "OrderPlaced" }
+func (OrderPlaced) IsOutbound()       {}
+
+type OrderPaid struct {
+	OrderID string `json:"orderId"`
+	Address string `json:"address"`
+}
+
+func (OrderPaid) EventName() string { return "OrderPaid" }
+func (OrderPaid) IsOutbound()       {}
+
+type OrderCompleted struct {
+	OrderID string `json:"orderId"`
+}
+
+func (OrderCompleted) EventName() string { return "OrderCompleted" }
+func (OrderCompleted) IsOutbound()       {}
+
+type OrderCancelled struct {
+	OrderID string `json:"orderId"`
+	Reason  string `json:"reason"`
+	// Refund is true if the payment had already been taken.
+	Refund bool `json:"refund"`
+}
+
+func (OrderCancelled) EventName() string { return "OrderCancelled" }
+func (OrderCancelled) IsOutbound()       {}
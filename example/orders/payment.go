@@ -0,0 +1,104 @@
+package orders
+
+import (
+	"errors"
+
+	"github.com/a-h/stream"
+)
+
+var ErrPaymentNotTaken = errors.New("payment has not been taken")
+
+func NewPayment(orderID string) *Payment {
+	return &Payment{
+		OrderID: orderID,
+	}
+}
+
+// Payment for an order. It uses the order ID as its ID, so that taking payment
+// for the same order twice is ignored.
+type Payment struct {
+	OrderID    string `json:"orderId"`
+	CustomerID string `json:"customerId"`
+	Amount     int    `json:"amount"`
+	Taken      bool   `json:"taken"`
+	Refunded   bool   `json:"refunded"`
+}
+
+// Limit is the largest payment that can be taken.
+const Limit = 1000
+
+func (p *Payment) Process(event stream.InboundEvent) (outbound []stream.OutboundEvent, err error) {
+	switch e := event.(type) {
+	case TakePayment:
+		return p.Take(e)
+	case RefundPayment:
+		return p.Refund()
+	}
+	return
+}
+
+func (p *Payment) Take(e TakePayment) (outbound []stream.OutboundEvent, err error) {
+	if p.Taken {
+		return
+	}
+	if e.Amount > Limit {
+		outbound = append(outbound, PaymentFailed{OrderID: p.OrderID, Reason: "payment limit exceeded"})
+		return
+	}
+	p.CustomerID = e.CustomerID
+	p.Amount = e.Amount
+	p.Taken = true
+	outbound = append(outbound, PaymentTaken{OrderID: p.OrderID, Amount: p.Amount})
+	return
+}
+
+func (p *Payment) Refund() (outbound []stream.OutboundEvent, err error) {
+	if !p.Taken {
+		return nil, ErrPaymentNotTaken
+	}
+	if p.Refunded {
+		return
+	}
+	p.Refunded = true
+	outbound = append(outbound, PaymentRefunded{OrderID: p.OrderID, Amount: p.Amount})
+	return
+}
+
+// Input events.
+type TakePayment struct {
+	CustomerID string `json:"customerId"`
+	Amount     int    `json:"amount"`
+}
+
+func (TakePayment) EventName() string { return "TakePayment" }
+func (TakePayment) IsInbound()        {}
+
+type RefundPayment struct{}
+
+func (RefundPayment) EventName() string { return "RefundPayment" }
+func (RefundPayment) IsInbound()        {}
+
+// Output events.
+type PaymentTaken struct {
+	OrderID string `json:"orderId"`
+	Amount  int    `json:"amount"`
+}
+
+func (PaymentTaken) EventName() string { return "PaymentTaken" }
+func (PaymentTaken) IsOutbound()       {}
+
+type PaymentFailed struct {
+	OrderID string `json:"orderId"`
+	Reason  string `json:"reason"`
+}
+
+func (PaymentFailed) EventName() string { return "PaymentFailed" }
+func (PaymentFailed) IsOutbound()       {}
+
+type PaymentRefunded struct {
+	OrderID string `json:"orderId"`
+	Amount  int    `json:"amount"`
+}
+
+func (PaymentRefunded) EventName() string { return "PaymentRefunded" }
+func (PaymentRefunded) IsOutbound()       {}
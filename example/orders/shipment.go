@@ -0,0 +1,64 @@
+package orders
+
+import (
+	"github.com/a-h/stream"
+)
+
+func NewShipment(orderID string) *Shipment {
+	return &Shipment{
+		OrderID: orderID,
+	}
+}
+
+// Shipment of an order. It uses the order ID as its ID.
+type Shipment struct {
+	OrderID string `json:"orderId"`
+	Address string `json:"address"`
+	Shipped bool   `json:"shipped"`
+}
+
+func (s *Shipment) Process(event stream.InboundEvent) (outbound []stream.OutboundEvent, err error) {
+	switch e := event.(type) {
+	case ShipOrder:
+		return s.Ship(e)
+	}
+	return
+}
+
+func (s *Shipment) Ship(e ShipOrder) (outbound []stream.OutboundEvent, err error) {
+	if s.Shipped {
+		return
+	}
+	if e.Address == "" {
+		outbound = append(outbound, ShipmentFailed{OrderID: s.OrderID, Reason: "missing address"})
+		return
+	}
+	s.Address = e.Address
+	s.Shipped = true
+	outbound = append(outbound, OrderShipped{OrderID: s.OrderID})
+	return
+}
+
+// Input events.
+type ShipOrder struct {
+	Address string `json:"address"`
+}
+
+func (ShipOrder) EventName() string { return "ShipOrder" }
+func (ShipOrder) IsInbound()        {}
+
+// Output events.
+type OrderShipped struct {
+	OrderID string `json:"orderId"`
+}
+
+func (OrderShipped) EventName() string { return "OrderShipped" }
+func (OrderShipped) IsOutbound()       {}
+
+type ShipmentFailed struct {
+	OrderID string `json:"orderId"`
+	Reason  string `json:"reason"`
+}
+
+func (ShipmentFailed) EventName() string { return "ShipmentFailed" }
+func (ShipmentFailed) IsOutbound()       {}
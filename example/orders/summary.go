@@ -0,0 +1,68 @@
+package orders
+
+import (
+	"context"
+
+	"github.com/a-h/stream/projection"
+)
+
+// Summary of an order, e.g. for a customer's order history page.
+type Summary struct {
+	OrderID    string      `json:"orderId"`
+	CustomerID string      `json:"customerId"`
+	Amount     int         `json:"amount"`
+	Status     OrderStatus `json:"status"`
+}
+
+// Summaries is a read model of orders, maintained from the order's outbound events by a
+// projection.Handler. It's kept in memory for the example, but would usually be a table.
+//
+//	h := projection.Handler{
+//		Name:        "order-summaries",
+//		Projector:   summaries,
+//		Checkpoints: projection.NewDynamoDBCheckpoints(client, checkpointTableName),
+//	}
+type Summaries map[string]Summary
+
+// Project the order event into the read model.
+func (s Summaries) Project(ctx context.Context, e projection.Event) (err error) {
+	switch e.Type {
+	case OrderPlaced{}.EventName():
+		var placed OrderPlaced
+		if err = e.Unmarshal(&placed); err != nil {
+			return
+		}
+		s[placed.OrderID] = Summary{
+			OrderID:    placed.OrderID,
+			CustomerID: placed.CustomerID,
+			Amount:     placed.Amount,
+			Status:     OrderStatusPlaced,
+		}
+	case OrderPaid{}.EventName():
+		var paid OrderPaid
+		if err = e.Unmarshal(&paid); err != nil {
+			return
+		}
+		s.setStatus(paid.OrderID, OrderStatusPaid)
+	case OrderCompleted{}.EventName():
+		var completed OrderCompleted
+		if err = e.Unmarshal(&completed); err != nil {
+			return
+		}
+		s.setStatus(completed.OrderID, OrderStatusCompleted)
+	case OrderCancelled{}.EventName():
+		var cancelled OrderCancelled
+		if err = e.Unmarshal(&cancelled); err != nil {
+			return
+		}
+		s.setStatus(cancelled.OrderID, OrderStatusCancelled)
+	}
+	return
+}
+
+func (s Summaries) setStatus(orderID string, status OrderStatus) {
+	summary := s[orderID]
+	summary.OrderID = orderID
+	summary.Status = status
+	s[orderID] = summary
+}
@@ -0,0 +1,279 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ExportFormat is the output format of Export.
+type ExportFormat string
+
+const (
+	// ExportNDJSON writes one JSON record per line.
+	ExportNDJSON ExportFormat = "ndjson"
+	// ExportJSON writes a single JSON document that contains all of the records.
+	ExportJSON ExportFormat = "json"
+)
+
+// Kinds of exported record.
+const (
+	ExportKindState      = "state"
+	ExportKindHistory    = "history"
+	ExportKindInbound    = "inbound"
+	ExportKindOutbound   = "outbound"
+	ExportKindAnnotation = "annotation"
+)
+
+// ExportRecord is a single state or event record of an export.
+type ExportRecord struct {
+	Kind          string                 `json:"kind"`
+	Type          string                 `json:"type"`
+	Sequence      int64                  `json:"sequence,omitempty"`
+	Date          string                 `json:"date,omitempty"`
+	EventID       string                 `json:"eventId,omitempty"`
+	CorrelationID string                 `json:"correlationId,omitempty"`
+	CausationID   string                 `json:"causationId,omitempty"`
+	ActorID       string                 `json:"actorId,omitempty"`
+	Data          map[string]interface{} `json:"data"`
+	// Dispatch is set on outbound records if the handler tracks their dispatch status.
+	Dispatch *ExportDispatch `json:"dispatch,omitempty"`
+}
+
+// ExportDispatch is the dispatch status of an outbound record, see TRACK_DISPATCH.
+type ExportDispatch struct {
+	// DispatchedAt is the time that the event was sent, in RFC3339 format.
+	DispatchedAt string `json:"dispatchedAt,omitempty"`
+	Attempts     int    `json:"attempts,omitempty"`
+	// Error returned by the latest attempt.
+	Error string `json:"error,omitempty"`
+	// Pending is true if the event is waiting to be confirmed by the handler.
+	Pending bool `json:"pending,omitempty"`
+}
+
+// ExportBundle is the document written by Export in the ExportJSON format.
+type ExportBundle struct {
+	Namespace string         `json:"namespace"`
+	Tenant    string         `json:"tenant,omitempty"`
+	ID        string         `json:"id"`
+	Records   []ExportRecord `json:"records"`
+}
+
+// ExportOption configures an export.
+type ExportOption func(*ExportOptions)
+
+// ExportOptions for an export.
+type ExportOptions struct {
+	Format ExportFormat
+	// Redact lists fields to remove from every record. Nested fields are separated with
+	// a dot, e.g. "payment.cardNumber".
+	Redact []string
+	// ApplyRedactors removes the fields listed by outbound events that implement Redactor.
+	ApplyRedactors bool
+}
+
+// ExportAs sets the output format. Defaults to ExportNDJSON.
+func ExportAs(f ExportFormat) ExportOption {
+	return func(o *ExportOptions) {
+		o.Format = f
+	}
+}
+
+// ExportRedact removes the fields from every exported record.
+func ExportRedact(fields ...string) ExportOption {
+	return func(o *ExportOptions) {
+		o.Redact = append(o.Redact, fields...)
+	}
+}
+
+// ExportApplyRedactors sets whether the fields listed by outbound events that implement
+// Redactor are removed from the export.
+func ExportApplyRedactors(do bool) ExportOption {
+	return func(o *ExportOptions) {
+		o.ApplyRedactors = do
+	}
+}
+
+// Export writes every state, state history, inbound and outbound record of the entity
+// to w as portable JSON, e.g. to respond to a GDPR subject-access request. Encrypted
+// records are decrypted, and the library's attributes are replaced by the fields of
+// ExportRecord.
+func (ddb *DynamoDBStore) Export(ctx context.Context, id string, w io.Writer, opts ...ExportOption) (err error) {
+	o := ExportOptions{
+		Format: ExportNDJSON,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Format != ExportNDJSON && o.Format != ExportJSON {
+		return fmt.Errorf("export: unknown format %q", o.Format)
+	}
+	records, err := ddb.exportRecords(ctx, id, o)
+	if err != nil {
+		return
+	}
+	enc := json.NewEncoder(w)
+	if o.Format == ExportJSON {
+		enc.SetIndent("", "  ")
+		return enc.Encode(ExportBundle{
+			Namespace: ddb.Namespace,
+			Tenant:    ddb.Tenant,
+			ID:        id,
+			Records:   records,
+		})
+	}
+	for _, r := range records {
+		if err = enc.Encode(r); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// ExportRecords returns the records that Export would write, e.g. to serve them from an
+// API. The format option is ignored.
+func (ddb *DynamoDBStore) ExportRecords(ctx context.Context, id string, opts ...ExportOption) (records []ExportRecord, err error) {
+	var o ExportOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return ddb.exportRecords(ctx, id, o)
+}
+
+func (ddb *DynamoDBStore) exportRecords(ctx context.Context, id string, o ExportOptions) (records []ExportRecord, err error) {
+	items, err := ddb.queryRecords(ctx, id)
+	if err != nil {
+		return
+	}
+	if len(items) == 0 {
+		return nil, ErrStateNotFound
+	}
+	records = make([]ExportRecord, 0, len(items))
+	for _, item := range items {
+		var r ExportRecord
+		var ok bool
+		r, ok, err = ddb.createExportRecord(item, o)
+		if err != nil {
+			return
+		}
+		if ok {
+			records = append(records, r)
+		}
+	}
+	return
+}
+
+func (ddb *DynamoDBStore) createExportRecord(item map[string]types.AttributeValue, o ExportOptions) (r ExportRecord, ok bool, err error) {
+	prefix, suffix := ddb.splitSortKey(item)
+	switch {
+	case prefix == "STATE" && suffix == "":
+		r.Kind = ExportKindState
+	case prefix == "STATE":
+		r.Kind = ExportKindHistory
+	case prefix == "INBOUND":
+		r.Kind = ExportKindInbound
+	case prefix == "OUTBOUND":
+		r.Kind = ExportKindOutbound
+	case prefix == "ANNOTATION":
+		r.Kind = ExportKindAnnotation
+	default:
+		// KEY and COUNTER records don't contain personal data.
+		return
+	}
+	if r.Type, err = ddb.getRecordType(item); err != nil {
+		return
+	}
+	// Annotations don't have a sequence number of their own.
+	if r.Kind != ExportKindAnnotation {
+		if r.Sequence, err = ddb.getRecordSequenceNumber(item); err != nil {
+			return
+		}
+	}
+	r.Date = stringAttribute(item, "_date")
+	r.EventID = stringAttribute(item, "_id")
+	r.CorrelationID = stringAttribute(item, "_correlationId")
+	r.CausationID = stringAttribute(item, "_causationId")
+	r.ActorID = stringAttribute(item, "_actorId")
+	if r.Kind == ExportKindOutbound {
+		if r.Dispatch, err = getExportDispatch(item); err != nil {
+			return
+		}
+	}
+	payload := make(map[string]types.AttributeValue, len(item))
+	for k, v := range item {
+		if !strings.HasPrefix(k, "_") {
+			payload[k] = v
+		}
+	}
+	if err = attributevalue.UnmarshalMap(payload, &r.Data); err != nil {
+		err = fmt.Errorf("export: failed to convert %s record: %w", r.Kind, err)
+		return
+	}
+	if r.Data == nil {
+		r.Data = make(map[string]interface{})
+	}
+	redactMap(r.Data, o.Redact)
+	if o.ApplyRedactors {
+		if v, isSet := item["_redact"].(*types.AttributeValueMemberSS); isSet {
+			redactMap(r.Data, v.Value)
+		}
+	}
+	return r, true, nil
+}
+
+func getExportDispatch(item map[string]types.AttributeValue) (d *ExportDispatch, err error) {
+	dispatchedAt, hasDispatchedAt := item["_dispatchedAt"].(*types.AttributeValueMemberN)
+	attempts, hasAttempts := item["_dispatchAttempts"].(*types.AttributeValueMemberN)
+	_, pending := item["_pending"]
+	dispatchError := stringAttribute(item, "_dispatchError")
+	if !hasDispatchedAt && !hasAttempts && !pending && dispatchError == "" {
+		return nil, nil
+	}
+	d = &ExportDispatch{Error: dispatchError, Pending: pending}
+	if hasDispatchedAt {
+		var sec int64
+		if sec, err = strconv.ParseInt(dispatchedAt.Value, 10, 64); err != nil {
+			return nil, fmt.Errorf("export: invalid _dispatchedAt: %w", err)
+		}
+		d.DispatchedAt = time.Unix(sec, 0).UTC().Format(time.RFC3339)
+	}
+	if hasAttempts {
+		if d.Attempts, err = strconv.Atoi(attempts.Value); err != nil {
+			return nil, fmt.Errorf("export: invalid _dispatchAttempts: %w", err)
+		}
+	}
+	return
+}
+
+func stringAttribute(item map[string]types.AttributeValue, name string) string {
+	if v, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
+// redactMap removes the fields from the map, following dots into nested maps.
+func redactMap(m map[string]interface{}, fields []string) {
+	for _, f := range fields {
+		path := strings.Split(f, ".")
+		current := m
+		for i, name := range path {
+			if i == len(path)-1 {
+				delete(current, name)
+				break
+			}
+			next, ok := current[name].(map[string]interface{})
+			if !ok {
+				break
+			}
+			current = next
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+type CustomerRegistered struct {
+	Name    string            `dynamodbav:"name"`
+	Email   string            `dynamodbav:"email"`
+	Address map[string]string `dynamodbav:"address"`
+}
+
+func (CustomerRegistered) EventName() string  { return "CustomerRegistered" }
+func (CustomerRegistered) IsOutbound()        {}
+func (CustomerRegistered) Redacted() []string { return []string{"address.postcode"} }
+
+func TestExportRecordRedaction(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Customer", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	items, err := s.PrepareWithOptions("id", 0, &AverageState{}, nil, []OutboundEvent{CustomerRegistered{
+		Name:    "Alice",
+		Email:   "alice@example.com",
+		Address: map[string]string{"line1": "1 High Street", "postcode": "AB1 2CD"},
+	}}, WithEventMetadata(EventMetadata{CorrelationID: "correlation"}))
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Act.
+	r, ok, err := s.createExportRecord(items[1].Put.Item, ExportOptions{Redact: []string{"email"}, ApplyRedactors: true})
+	if err != nil {
+		t.Fatalf("failed to create export record: %v", err)
+	}
+
+	// Assert.
+	if !ok {
+		t.Fatal("expected the outbound record to be exported")
+	}
+	expected := ExportRecord{
+		Kind:          ExportKindOutbound,
+		Type:          "CustomerRegistered",
+		Sequence:      1,
+		Date:          r.Date,
+		EventID:       r.EventID,
+		CorrelationID: "correlation",
+		Data: map[string]interface{}{
+			"name":    "Alice",
+			"address": map[string]interface{}{"line1": "1 High Street"},
+		},
+	}
+	if diff := cmp.Diff(expected, r); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestExportRecordDispatchStatus(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Customer", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	items, err := s.Prepare("id", 0, &AverageState{}, nil, []OutboundEvent{CustomerRegistered{Name: "Alice"}})
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+	item := items[1].Put.Item
+	item["_dispatchedAt"] = &types.AttributeValueMemberN{Value: "1700000000"}
+	item["_dispatchAttempts"] = &types.AttributeValueMemberN{Value: "2"}
+
+	// Act.
+	r, _, err := s.createExportRecord(item, ExportOptions{})
+	if err != nil {
+		t.Fatalf("failed to create export record: %v", err)
+	}
+
+	// Assert.
+	expected := &ExportDispatch{DispatchedAt: "2023-11-14T22:13:20Z", Attempts: 2}
+	if diff := cmp.Diff(expected, r.Dispatch); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestExportIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	// Arrange.
+	name := createLocalTable(t)
+	defer deleteLocalTable(t, name)
+	s, err := NewStore(name, "Average", WithRegion(region), WithClient(testClient), WithPersistStateHistory(true))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	p, err := New(s, "id", &AverageState{})
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+	if err = p.Process(Add{Number: 1}); err != nil {
+		t.Fatalf("failed to process events: %v", err)
+	}
+
+	// Act.
+	var buf bytes.Buffer
+	err = s.Export(context.Background(), "id", &buf)
+	if err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+
+	// Assert.
+	var kinds []string
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var r ExportRecord
+		if err = json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("failed to read exported record: %v", err)
+		}
+		kinds = append(kinds, r.Kind)
+	}
+	expected := []string{ExportKindInbound, ExportKindOutbound, ExportKindState, ExportKindHistory}
+	if diff := cmp.Diff(expected, kinds); diff != "" {
+		t.Error(diff)
+	}
+}
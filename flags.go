@@ -0,0 +1,63 @@
+package stream
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// FeatureFlags are the per-request feature flags that were active when inbound events
+// were processed, keyed by flag name.
+type FeatureFlags map[string]bool
+
+// Enabled returns true if the flag is set and enabled.
+func (f FeatureFlags) Enabled(name string) bool {
+	return f[name]
+}
+
+// FeatureFlagged can be implemented by states that change behavior behind feature flags.
+// Before processing inbound events, the Processor passes the FeatureFlags of its
+// EventMetadata to SetFeatureFlags, and Repair passes the flags stored with each inbound
+// event, so that replaying events reproduces the original behavior. The flags should not
+// be stored as part of the state, e.g. use a `dynamodbav:"-"` struct tag.
+type FeatureFlagged interface {
+	SetFeatureFlags(flags FeatureFlags)
+}
+
+// WithFeatureFlags sets the feature flags passed to states that implement FeatureFlagged,
+// and stored with each inbound event.
+func WithFeatureFlags(flags FeatureFlags) ProcessorOption {
+	return func(p *Processor) {
+		p.metadata.FeatureFlags = flags
+	}
+}
+
+func setFeatureFlags(state State, flags FeatureFlags) {
+	if ff, ok := state.(FeatureFlagged); ok {
+		ff.SetFeatureFlags(flags)
+	}
+}
+
+func (ddb *DynamoDBStore) attributeValueFeatureFlags(flags FeatureFlags) (av types.AttributeValue, ok bool) {
+	if len(flags) == 0 {
+		return
+	}
+	m := make(map[string]types.AttributeValue, len(flags))
+	for name, enabled := range flags {
+		m[name] = &types.AttributeValueMemberBOOL{Value: enabled}
+	}
+	return &types.AttributeValueMemberM{Value: m}, true
+}
+
+// getRecordFeatureFlags returns the feature flags stored with an inbound event record.
+func getRecordFeatureFlags(r map[string]types.AttributeValue) (flags FeatureFlags) {
+	m, ok := r["_flags"].(*types.AttributeValueMemberM)
+	if !ok {
+		return
+	}
+	flags = make(FeatureFlags, len(m.Value))
+	for name, v := range m.Value {
+		if b, ok := v.(*types.AttributeValueMemberBOOL); ok {
+			flags[name] = b.Value
+		}
+	}
+	return
+}
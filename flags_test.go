@@ -0,0 +1,60 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// FlaggedState doubles numbers when the "double" feature flag is enabled.
+type FlaggedState struct {
+	Sum   int
+	flags FeatureFlags
+}
+
+func (s *FlaggedState) SetFeatureFlags(flags FeatureFlags) { s.flags = flags }
+
+func (s *FlaggedState) Process(event InboundEvent) (outbound []OutboundEvent, err error) {
+	if e, ok := event.(Add); ok {
+		if s.flags.Enabled("double") {
+			s.Sum += e.Number * 2
+		} else {
+			s.Sum += e.Number
+		}
+	}
+	outbound = append(outbound, Count{s.Sum})
+	return
+}
+
+func TestFeatureFlagsArePassedToStateAndStored(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Flagged", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	state := &FlaggedState{}
+	p, err := New(s, "id", state, WithFeatureFlags(FeatureFlags{"double": true}))
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+
+	// Act.
+	items, err := p.Prepare(Add{Number: 2})
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Assert.
+	if state.Sum != 4 {
+		t.Errorf("expected the flag to be applied, got sum %d", state.Sum)
+	}
+	if _, ok := items[0].Put.Item["flags"]; ok {
+		t.Error("expected the flags not to be stored in the state")
+	}
+	if diff := cmp.Diff(FeatureFlags{"double": true}, getRecordFeatureFlags(items[1].Put.Item)); diff != "" {
+		t.Errorf("expected the flags to be stored with the inbound event: %s", diff)
+	}
+	if _, ok := items[2].Put.Item["_flags"]; ok {
+		t.Error("expected the flags not to be stored with outbound events")
+	}
+}
@@ -0,0 +1,56 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// The record format version written to the _fmt attribute of each record.
+//
+// The minor version is incremented when metadata attributes are added. Readers ignore
+// metadata attributes that they don't know about, so records written by a newer minor
+// version can be read by older versions of the library.
+//
+// The major version is incremented when the meaning of existing attributes changes.
+// Readers return ErrUnsupportedFormat for records with a newer major version, rather
+// than misreading them.
+//
+// Versions:
+//
+//   - 1.0: _pk, _sk, _typ, _seq, _ts, _date, _namespace and _fmt.
+//   - 1.1: adds the event and state metadata attributes, e.g. _id, _ver, _hash, _redact,
+//     _priority, _pending, _outbox, _flags, _traceHeader and _shredded.
+const (
+	FormatMajorVersion = 1
+	FormatMinorVersion = 1
+)
+
+// ErrUnsupportedFormat is returned when reading a record written by a newer, incompatible
+// version of the library.
+var ErrUnsupportedFormat = errors.New("record format is not supported by this version of the library, upgrade to read it")
+
+func formatVersion() string {
+	return fmt.Sprintf("%d.%d", FormatMajorVersion, FormatMinorVersion)
+}
+
+// checkRecordFormat returns ErrUnsupportedFormat if the record was written with a newer
+// major version of the format. Records without a _fmt attribute were written before the
+// format was versioned, and are compatible with version 1.
+func checkRecordFormat(r map[string]types.AttributeValue) error {
+	v, ok := r["_fmt"].(*types.AttributeValueMemberS)
+	if !ok {
+		return nil
+	}
+	major, err := strconv.Atoi(strings.SplitN(v.Value, ".", 2)[0])
+	if err != nil {
+		return fmt.Errorf("invalid _fmt field in record: %q", v.Value)
+	}
+	if major > FormatMajorVersion {
+		return fmt.Errorf("%w: record format %s, library format %s", ErrUnsupportedFormat, v.Value, formatVersion())
+	}
+	return nil
+}
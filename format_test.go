@@ -0,0 +1,60 @@
+package stream
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestCheckRecordFormat(t *testing.T) {
+	var tests = []struct {
+		name     string
+		record   map[string]types.AttributeValue
+		expected error
+	}{
+		{
+			name:     "records without a format version are supported",
+			record:   map[string]types.AttributeValue{},
+			expected: nil,
+		},
+		{
+			name: "records with the current format version are supported",
+			record: map[string]types.AttributeValue{
+				"_fmt": &types.AttributeValueMemberS{Value: formatVersion()},
+			},
+			expected: nil,
+		},
+		{
+			name: "records with an older minor format version are supported",
+			record: map[string]types.AttributeValue{
+				"_fmt": &types.AttributeValueMemberS{Value: "1.0"},
+			},
+			expected: nil,
+		},
+		{
+			name: "records with a newer minor format version are supported",
+			record: map[string]types.AttributeValue{
+				"_fmt":     &types.AttributeValueMemberS{Value: "1.99"},
+				"_unknown": &types.AttributeValueMemberS{Value: "new metadata"},
+			},
+			expected: nil,
+		},
+		{
+			name: "records with a newer major format version are not supported",
+			record: map[string]types.AttributeValue{
+				"_fmt": &types.AttributeValueMemberS{Value: "2.0"},
+			},
+			expected: ErrUnsupportedFormat,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkRecordFormat(tt.record)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/a-h/stream
 
-go 1.16
+go 1.18
 
 require (
 	github.com/aws/aws-lambda-go v1.36.0
@@ -9,11 +9,41 @@ require (
 	github.com/aws/aws-sdk-go-v2/credentials v1.13.6
 	github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue v1.10.8
 	github.com/aws/aws-sdk-go-v2/service/dynamodb v1.17.9
+	github.com/aws/aws-sdk-go-v2/service/dynamodbstreams v1.13.28
 	github.com/aws/aws-sdk-go-v2/service/eventbridge v1.16.22
+	github.com/aws/aws-sdk-go-v2/service/firehose v1.16.0
+	github.com/aws/aws-sdk-go-v2/service/iotdataplane v1.14.0
+	github.com/aws/aws-sdk-go-v2/service/kms v1.19.4
+	github.com/aws/aws-sdk-go-v2/service/lambda v1.26.2
+	github.com/aws/aws-sdk-go-v2/service/s3 v1.29.6
+	github.com/aws/aws-sdk-go-v2/service/scheduler v1.0.3
+	github.com/aws/aws-sdk-go-v2/service/sfn v1.17.1
+	github.com/aws/aws-sdk-go-v2/service/sns v1.18.8
+	github.com/aws/aws-sdk-go-v2/service/sqs v1.19.17
+	github.com/aws/smithy-go v1.13.5
 	github.com/google/go-cmp v0.5.8
 	github.com/google/uuid v1.3.0
-	github.com/pkg/errors v0.9.1 // indirect
-	go.uber.org/atomic v1.10.0 // indirect
+	github.com/oklog/ulid/v2 v2.1.0
 	go.uber.org/multierr v1.9.0
 	go.uber.org/zap v1.24.0
 )
+
+require (
+	github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream v1.4.10 // indirect
+	github.com/aws/aws-sdk-go-v2/feature/ec2/imds v1.12.21 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/configsources v1.1.27 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/endpoints/v2 v2.4.21 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/ini v1.3.28 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/v4a v1.0.18 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/accept-encoding v1.9.11 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/checksum v1.1.22 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/endpoint-discovery v1.7.21 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/presigned-url v1.9.21 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/s3shared v1.13.21 // indirect
+	github.com/aws/aws-sdk-go-v2/service/sso v1.11.27 // indirect
+	github.com/aws/aws-sdk-go-v2/service/ssooidc v1.13.11 // indirect
+	github.com/aws/aws-sdk-go-v2/service/sts v1.17.7 // indirect
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	go.uber.org/atomic v1.10.0 // indirect
+)
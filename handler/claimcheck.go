@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// PayloadStoreAPI is the subset of the S3 client used by the handler to store the detail of
+// events that are too large for EventBridge.
+type PayloadStoreAPI interface {
+	PutObject(context.Context, *s3.PutObjectInput, ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// claimCheckKey is the key of the claim check in the detail of events that were too large
+// to send.
+const claimCheckKey = "_claimCheck"
+
+// claimCheck points to the stored detail of an event.
+type claimCheck struct {
+	Location string `json:"location"`
+	Size     int    `json:"size"`
+}
+
+// checkDetail stores the detail of the entry in the PayloadBucket, and replaces it with a
+// claim check that points to it, e.g. "s3://bucket/key". The metadata and envelope are kept, so that consumers can filter and
+// correlate events without fetching the detail. CloudEvents keep their attributes, with
+// the claim check as their data. The pointer is created from the stored detail, so that
+// both reflect any transforms.
+func (h *Handler) checkDetail(ctx context.Context, key string, e *types.PutEventsRequestEntry) (err error) {
+	key += ".json"
+	_, err = h.PayloadStore.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(h.PayloadBucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader([]byte(*e.Detail)),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store detail: %w", err)
+	}
+	cc := claimCheck{Location: "s3://" + h.PayloadBucket + "/" + key, Size: len(*e.Detail)}
+	// Transforms can replace the detail with something other than an object, in which case
+	// only the claim check is sent.
+	var m map[string]interface{}
+	_ = json.Unmarshal([]byte(*e.Detail), &m)
+	pointer := make(map[string]interface{})
+	if h.CloudEvents {
+		for k, v := range m {
+			pointer[k] = v
+		}
+		pointer["data"] = map[string]interface{}{claimCheckKey: cc}
+	} else {
+		pointer[claimCheckKey] = cc
+		if v, ok := m["_metadata"]; ok {
+			pointer["_metadata"] = v
+		}
+		if v, ok := m[envelopeKey]; ok && h.Envelope {
+			pointer[envelopeKey] = v
+		}
+	}
+	detailJSON, err := json.Marshal(pointer)
+	if err != nil {
+		return
+	}
+	detail := string(detailJSON)
+	e.Detail = &detail
+	return
+}
+
+// payloadKey returns the key of the stored detail of the record. Outbound records have a
+// unique sort key, but the STATE record is updated in place, so its sequence and the event
+// type are added, e.g. "Order/1/STATE/3/OrderStateUpdated".
+func payloadKey(id, sk, eventType string, r map[string]events.DynamoDBAttributeValue) string {
+	if sk != "STATE" {
+		return id + "/" + sk
+	}
+	var seq string
+	if v, ok := r["_seq"]; ok && v.DataType() == events.DataTypeNumber {
+		seq = v.Number()
+	}
+	return id + "/" + sk + "/" + seq + "/" + eventType
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/go-cmp/cmp"
+)
+
+type memoryPayloadStore map[string][]byte
+
+func (s memoryPayloadStore) PutObject(_ context.Context, input *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if aws.ToString(input.Bucket) != "bucket" {
+		return nil, fmt.Errorf("unexpected bucket %q", aws.ToString(input.Bucket))
+	}
+	detail, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	s[aws.ToString(input.Key)] = detail
+	return &s3.PutObjectOutput{}, nil
+}
+
+func oversizedRecord() map[string]events.DynamoDBAttributeValue {
+	return map[string]events.DynamoDBAttributeValue{
+		"_pk":     events.NewStringAttribute("Document/id"),
+		"_sk":     events.NewStringAttribute("OUTBOUND/1/0/DocumentUploaded"),
+		"_typ":    events.NewStringAttribute("DocumentUploaded"),
+		"_id":     events.NewStringAttribute("01ARZ3NDEKTSV4RRFFQ69G5FAV"),
+		"content": events.NewStringAttribute(strings.Repeat("a", 300*1024)),
+	}
+}
+
+func TestOversizedEventsAreClaimChecked(t *testing.T) {
+	// Arrange.
+	payloads := memoryPayloadStore{}
+	h := newTestHandler(Config{EventSourceName: "source", PayloadStore: payloads, PayloadBucket: "bucket", Metadata: true})
+
+	// Act.
+	_, _, e, err := h.createOutboundEvent(context.Background(), "", oversizedRecord())
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("failed to create outbound event: %v", err)
+	}
+	stored, ok := payloads["Document/id/OUTBOUND/1/0/DocumentUploaded.json"]
+	if !ok {
+		t.Fatalf("expected the detail to be stored, got %v", payloads)
+	}
+	expected := `{"_claimCheck":{"location":"s3://bucket/Document/id/OUTBOUND/1/0/DocumentUploaded.json","size":` + strconv.Itoa(len(stored)) + `},"_metadata":{"eventId":"01ARZ3NDEKTSV4RRFFQ69G5FAV"}}`
+	if diff := cmp.Diff(expected, *e.Detail); diff != "" {
+		t.Error(diff)
+	}
+	if _, err := batch([]types.PutEventsRequestEntry{*e}); err != nil {
+		t.Errorf("expected the claim check to be sent, got %v", err)
+	}
+}
+
+func TestOversizedCloudEventsKeepTheirAttributes(t *testing.T) {
+	// Arrange.
+	h := newTestHandler(Config{EventSourceName: "source", PayloadStore: memoryPayloadStore{}, PayloadBucket: "bucket", CloudEvents: true})
+
+	// Act.
+	_, _, e, err := h.createOutboundEvent(context.Background(), "", oversizedRecord())
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("failed to create outbound event: %v", err)
+	}
+	if !strings.Contains(*e.Detail, `"data":{"_claimCheck":{"location":"s3://bucket/`) || !strings.Contains(*e.Detail, `"specversion":"1.0"`) {
+		t.Errorf("unexpected detail: %s", *e.Detail)
+	}
+}
+
+func TestOversizedEventsAreNotClaimCheckedWithoutAPayloadStore(t *testing.T) {
+	// Arrange.
+	h := newTestHandler(Config{EventSourceName: "source"})
+
+	// Act.
+	_, _, e, err := h.createOutboundEvent(context.Background(), "", oversizedRecord())
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("failed to create outbound event: %v", err)
+	}
+	if _, err := batch([]types.PutEventsRequestEntry{*e}); err == nil {
+		t.Error("expected oversized events to fail to be batched")
+	}
+}
+
+func TestOversizedStateEventsAreStoredPerSequence(t *testing.T) {
+	// Arrange.
+	payloads := memoryPayloadStore{}
+	h := newTestHandler(Config{EventSourceName: "source", PayloadStore: payloads, PayloadBucket: "bucket", StateUpdates: true})
+	stateRecord := func(seq string) events.DynamoDBEventRecord {
+		return events.DynamoDBEventRecord{
+			EventName: "MODIFY",
+			Change: events.DynamoDBStreamRecord{NewImage: map[string]events.DynamoDBAttributeValue{
+				"_pk":        events.NewStringAttribute("Document/id"),
+				"_sk":        events.NewStringAttribute("STATE"),
+				"_seq":       events.NewNumberAttribute(seq),
+				"_namespace": events.NewStringAttribute("Document"),
+				"content":    events.NewStringAttribute(strings.Repeat("a", 300*1024)),
+			}},
+		}
+	}
+
+	// Act.
+	for _, seq := range []string{"1", "2"} {
+		if _, err := h.createStateEvent(context.Background(), "", stateRecord(seq)); err != nil {
+			t.Fatalf("failed to create state event: %v", err)
+		}
+	}
+
+	// Assert.
+	for _, key := range []string{"Document/id/STATE/1/DocumentStateUpdated.json", "Document/id/STATE/2/DocumentStateUpdated.json"} {
+		if _, ok := payloads[key]; !ok {
+			t.Errorf("expected %s to be stored, got %d payloads", key, len(payloads))
+		}
+	}
+}
+
+func TestClaimChecksAreCreatedFromTheTransformedDetail(t *testing.T) {
+	// Arrange.
+	payloads := memoryPayloadStore{}
+	h := newTestHandler(Config{
+		EventSourceName: "source",
+		PayloadStore:    payloads,
+		PayloadBucket:   "bucket",
+		Transforms: []Transform{func(e *types.PutEventsRequestEntry) (*types.PutEventsRequestEntry, error) {
+			detail := `{"content":"` + strings.Repeat("b", 300*1024) + `","_metadata":{"eventId":"transformed"}}`
+			e.Detail = &detail
+			return e, nil
+		}},
+	})
+
+	// Act.
+	_, _, e, err := h.createOutboundEvent(context.Background(), "", oversizedRecord())
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("failed to create outbound event: %v", err)
+	}
+	stored := payloads["Document/id/OUTBOUND/1/0/DocumentUploaded.json"]
+	if !strings.Contains(string(stored), `"eventId":"transformed"`) {
+		t.Error("expected the transformed detail to be stored")
+	}
+	if !strings.Contains(*e.Detail, `"_metadata":{"eventId":"transformed"}`) {
+		t.Errorf("expected the pointer to keep the transformed metadata, got %s", *e.Detail)
+	}
+}
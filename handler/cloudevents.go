@@ -0,0 +1,34 @@
+package handler
+
+// cloudEventExtensions maps event metadata to CloudEvents extension attributes, which must
+// be lowercase.
+var cloudEventExtensions = map[string]string{
+	"correlationId": "correlationid",
+	"causationId":   "causationid",
+	"actorId":       "actorid",
+	"tenant":        "tenant",
+	"version":       "version",
+}
+
+// newCloudEvent wraps the event data in a CloudEvents envelope. The subject is the
+// partition key of the entity, e.g. "SlotMachine/id".
+func newCloudEvent(eventType, source, subject, date string, data map[string]interface{}, metadata map[string]string) map[string]interface{} {
+	ce := map[string]interface{}{
+		"specversion":     "1.0",
+		"id":              metadata["eventId"],
+		"source":          source,
+		"type":            eventType,
+		"subject":         subject,
+		"datacontenttype": "application/json",
+		"data":            data,
+	}
+	if date != "" {
+		ce["time"] = date
+	}
+	for from, to := range cloudEventExtensions {
+		if v, ok := metadata[from]; ok {
+			ce[to] = v
+		}
+	}
+	return ce
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCloudEvents(t *testing.T) {
+	// Arrange.
+	h := newTestHandler(Config{
+		EventSourceName: "slotmachine",
+		CloudEvents:     true,
+	})
+	r := map[string]events.DynamoDBAttributeValue{
+		"_pk":            events.NewStringAttribute("SlotMachine/id"),
+		"_typ":           events.NewStringAttribute("GameWon"),
+		"_sk":            events.NewStringAttribute("OUTBOUND/1/0/GameWon"),
+		"_id":            events.NewStringAttribute("01ARZ3NDEKTSV4RRFFQ69G5FAV"),
+		"_date":          events.NewStringAttribute("2022-11-20T13:00:00Z"),
+		"_correlationId": events.NewStringAttribute("correlation"),
+		"payout":         events.NewNumberAttribute("10"),
+	}
+
+	// Act.
+	_, _, e, err := h.createOutboundEvent(context.Background(), "", r)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("failed to create outbound event: %v", err)
+	}
+	expected := `{"correlationid":"correlation","data":{"payout":10},"datacontenttype":"application/json","id":"01ARZ3NDEKTSV4RRFFQ69G5FAV","source":"slotmachine","specversion":"1.0","subject":"SlotMachine/id","time":"2022-11-20T13:00:00Z","type":"GameWon"}`
+	if diff := cmp.Diff(expected, *e.Detail); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestScheduledCloudEventsCreateSchedules(t *testing.T) {
+	// Arrange.
+	h := newTestHandler(Config{CloudEvents: true})
+	detail := `{"id":"01ARZ3NDEKTSV4RRFFQ69G5FAV","data":{"namespace":"Coin","id":"id","at":"2022-11-20T13:10:00Z","type":"ExpireCoin","event":{}}}`
+
+	// Act.
+	s, err := h.createSchedule(detail)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("failed to create schedule: %v", err)
+	}
+	if s.Name != "stream-01ARZ3NDEKTSV4RRFFQ69G5FAV" {
+		t.Errorf("unexpected schedule name %q", s.Name)
+	}
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// pendingRecord is an outbound record that must be confirmed once EventBridge has
+// acknowledged it, see stream.Confirmable.
+type pendingRecord struct {
+	tableName string
+	pk, sk    string
+}
+
+func getPendingRecord(tableName string, r map[string]events.DynamoDBAttributeValue) *pendingRecord {
+	if _, ok := r["_pending"]; !ok {
+		return nil
+	}
+	return &pendingRecord{
+		tableName: tableName,
+		pk:        r["_pk"].String(),
+		sk:        r["_sk"].String(),
+	}
+}
+
+// shouldPublish returns true for new records, and for pending records that have been
+// touched by stream.DynamoDBStore.Republish. Other updates, e.g. confirmations, or
+// recording the dispatch status, are not published again.
+func shouldPublish(record events.DynamoDBEventRecord) bool {
+	if record.EventName != string(events.DynamoDBOperationTypeModify) {
+		return true
+	}
+	pending, ok := record.Change.NewImage["_pending"]
+	if !ok {
+		return false
+	}
+	previous, ok := record.Change.OldImage["_pending"]
+	return !ok || previous.Number() != pending.Number()
+}
+
+// confirm removes the _pending attribute from the record.
+func (h *Handler) confirm(ctx context.Context, p *pendingRecord) (err error) {
+	_, err = h.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(p.tableName),
+		Key: map[string]dynamodbtypes.AttributeValue{
+			"_pk": &dynamodbtypes.AttributeValueMemberS{Value: p.pk},
+			"_sk": &dynamodbtypes.AttributeValueMemberS{Value: p.sk},
+		},
+		UpdateExpression:    aws.String("REMOVE #_pending"),
+		ConditionExpression: aws.String("attribute_exists(#_pk)"),
+		ExpressionAttributeNames: map[string]string{
+			"#_pk":      "_pk",
+			"#_pending": "_pending",
+		},
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to confirm %s %s: %w", p.pk, p.sk, err)
+	}
+	return
+}
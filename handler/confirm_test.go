@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+// failingEventBridge fails entries with the given detail types.
+type failingEventBridge struct {
+	fail map[string]bool
+	sent *[]string
+}
+
+func (m failingEventBridge) PutEvents(_ context.Context, input *eventbridge.PutEventsInput, _ ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	var output eventbridge.PutEventsOutput
+	for _, e := range input.Entries {
+		*m.sent = append(*m.sent, *e.DetailType)
+		if m.fail[*e.DetailType] {
+			output.Entries = append(output.Entries, types.PutEventsResultEntry{ErrorCode: aws.String("InternalFailure")})
+			output.FailedEntryCount++
+			continue
+		}
+		output.Entries = append(output.Entries, types.PutEventsResultEntry{EventId: aws.String("id")})
+	}
+	return &output, nil
+}
+
+type mockDynamoDB struct {
+	DynamoDBAPI
+	m         sync.Mutex
+	confirmed []string
+}
+
+func (m *mockDynamoDB) UpdateItem(_ context.Context, input *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	m.confirmed = append(m.confirmed, input.Key["_sk"].(*dynamodbtypes.AttributeValueMemberS).Value)
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func outboundRecord(eventName, typ string, pending bool) events.DynamoDBEventRecord {
+	image := map[string]events.DynamoDBAttributeValue{
+		"_pk":  events.NewStringAttribute("Payment/id"),
+		"_sk":  events.NewStringAttribute("OUTBOUND/1/0/" + typ),
+		"_typ": events.NewStringAttribute(typ),
+	}
+	if pending {
+		image["_pending"] = events.NewNumberAttribute("1640995200")
+	}
+	return events.DynamoDBEventRecord{
+		EventName:      eventName,
+		EventSourceArn: "arn:aws:dynamodb:eu-west-1:123456789012:table/stream/stream/2022-01-01T00:00:00.000",
+		Change:         events.DynamoDBStreamRecord{NewImage: image},
+	}
+}
+
+func TestPendingRecordsAreConfirmed(t *testing.T) {
+	// Arrange.
+	var sent []string
+	db := &mockDynamoDB{}
+	h := newTestHandler(Config{
+		EventBridge: failingEventBridge{fail: map[string]bool{"Failed": true}, sent: &sent},
+		DynamoDB:    db,
+	})
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{
+			outboundRecord("INSERT", "Critical", true),
+			outboundRecord("INSERT", "Normal", false),
+			outboundRecord("INSERT", "Failed", true),
+			// The confirmation of an earlier event isn't published again.
+			outboundRecord("MODIFY", "Confirmed", false),
+			// Records touched by Republish are published again.
+			outboundRecord("MODIFY", "Republished", true),
+		},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if err == nil {
+		t.Error("expected an error for the failed entry")
+	}
+	if diff := cmp.Diff([]string{"Critical", "Normal", "Failed", "Republished"}, sent); diff != "" {
+		t.Errorf("unexpected events sent: %s", diff)
+	}
+	if diff := cmp.Diff([]string{"OUTBOUND/1/0/Critical", "OUTBOUND/1/0/Republished"}, db.confirmed); diff != "" {
+		t.Errorf("unexpected records confirmed: %s", diff)
+	}
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// DeadLetterQueueAPI is the subset of the SQS client used by the handler to send events
+// that couldn't be published to a dead letter queue, as JSON, so that they can be replayed
+// with Handler.Replay once the cause has been resolved.
+type DeadLetterQueueAPI interface {
+	SendMessageBatch(context.Context, *sqs.SendMessageBatchInput, ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+}
+
+// The maximum number of messages, and total size of the messages, in a SendMessageBatch
+// request.
+const (
+	deadLetterBatchSize  = 10
+	deadLetterBatchBytes = 256 * 1024
+)
+
+// DeadLetter is an event that couldn't be published, with the reason that it failed.
+type DeadLetter struct {
+	// ID of the event.
+	ID string `json:"id,omitempty"`
+	// PK of the entity that produced the event, e.g. "Payment/123".
+	PK           string     `json:"pk,omitempty"`
+	EventBusName string     `json:"eventBusName"`
+	Source       string     `json:"source"`
+	DetailType   string     `json:"detailType"`
+	Detail       string     `json:"detail"`
+	Time         *time.Time `json:"time,omitempty"`
+	Resources    []string   `json:"resources,omitempty"`
+	TraceHeader  string     `json:"traceHeader,omitempty"`
+	// ErrorCode returned by EventBridge, if the entry was rejected.
+	ErrorCode    string    `json:"errorCode,omitempty"`
+	ErrorMessage string    `json:"errorMessage"`
+	FailedAt     time.Time `json:"failedAt"`
+}
+
+func newDeadLetter(e outboundEvent, errorCode, errorMessage string, failedAt time.Time) DeadLetter {
+	return DeadLetter{
+		ID:           e.id,
+		PK:           e.position.pk,
+		EventBusName: aws.ToString(e.entry.EventBusName),
+		Source:       aws.ToString(e.entry.Source),
+		DetailType:   aws.ToString(e.entry.DetailType),
+		Detail:       aws.ToString(e.entry.Detail),
+		Time:         e.entry.Time,
+		Resources:    e.entry.Resources,
+		TraceHeader:  aws.ToString(e.entry.TraceHeader),
+		ErrorCode:    errorCode,
+		ErrorMessage: errorMessage,
+		FailedAt:     failedAt,
+	}
+}
+
+// deadLetter sends the letters to the DeadLetterQueue, and returns nil if they were sent,
+// so that the stream moves on. If there's no DeadLetterQueue, or the letters can't be sent,
+// the error is returned.
+func (h *Handler) deadLetter(ctx context.Context, i int, letters []DeadLetter, err error) error {
+	if h.DeadLetterQueue == nil || len(letters) == 0 {
+		return err
+	}
+	if dlqErr := h.sendDeadLetters(ctx, letters); dlqErr != nil {
+		return multierr.Combine(err, fmt.Errorf("batch %d: failed to send events to the dead letter queue: %w", i, dlqErr))
+	}
+	h.Log.Warn("sent events to the dead letter queue", zap.Int("batch", i+1), zap.Int("count", len(letters)), zap.Error(err))
+	return nil
+}
+
+// sendDeadLetters sends each letter as a JSON message to the DeadLetterQueueURL, in
+// batches.
+func (h *Handler) sendDeadLetters(ctx context.Context, letters []DeadLetter) (err error) {
+	var entries []sqstypes.SendMessageBatchRequestEntry
+	var size int
+	for i, l := range letters {
+		body, err := json.Marshal(l)
+		if err != nil {
+			return fmt.Errorf("failed to marshal dead letter %q: %w", l.ID, err)
+		}
+		if len(entries) == deadLetterBatchSize || (len(entries) > 0 && size+len(body) > deadLetterBatchBytes) {
+			if err = h.sendDeadLetterBatch(ctx, entries); err != nil {
+				return err
+			}
+			entries, size = nil, 0
+		}
+		entries = append(entries, sqstypes.SendMessageBatchRequestEntry{
+			Id:          aws.String(strconv.Itoa(i)),
+			MessageBody: aws.String(string(body)),
+		})
+		size += len(body)
+	}
+	if len(entries) == 0 {
+		return
+	}
+	return h.sendDeadLetterBatch(ctx, entries)
+}
+
+func (h *Handler) sendDeadLetterBatch(ctx context.Context, entries []sqstypes.SendMessageBatchRequestEntry) error {
+	output, err := h.DeadLetterQueue.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+		QueueUrl: aws.String(h.DeadLetterQueueURL),
+		Entries:  entries,
+	})
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, f := range output.Failed {
+		errs = append(errs, fmt.Errorf("message %s: %s: %s", aws.ToString(f.Id), aws.ToString(f.Code), aws.ToString(f.Message)))
+	}
+	return multierr.Combine(errs...)
+}
+
+// ReadDeadLetters reads newline delimited JSON dead letters, e.g. the messages received
+// from an SQS dead letter queue.
+func ReadDeadLetters(r io.Reader) (letters []DeadLetter, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var l DeadLetter
+		if err = json.Unmarshal(scanner.Bytes(), &l); err != nil {
+			return nil, fmt.Errorf("line %d: invalid dead letter: %w", line, err)
+		}
+		letters = append(letters, l)
+	}
+	return letters, scanner.Err()
+}
+
+// Replay publishes the dead letters, in batches, with retries, keeping the order of the
+// events of each entity. Letters without an event bus or source use the handler's. Events
+// that fail again are sent to the DeadLetterQueue, if there is one.
+func (h *Handler) Replay(ctx context.Context, letters []DeadLetter) error {
+	outboundEvents := make([]outboundEvent, len(letters))
+	for i, l := range letters {
+		busName, source := override(h.EventBusName, h.EventSourceName, l.EventBusName, l.Source)
+		outboundEvents[i] = outboundEvent{
+			entry: types.PutEventsRequestEntry{
+				EventBusName: &busName,
+				Source:       &source,
+				DetailType:   aws.String(l.DetailType),
+				Detail:       aws.String(l.Detail),
+				Time:         l.Time,
+				Resources:    l.Resources,
+				TraceHeader:  optionalString(l.TraceHeader),
+			},
+			position: position{pk: l.PK, index: i},
+			id:       l.ID,
+		}
+	}
+	return h.send(ctx, outboundEvents)
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a-h/stream"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockDeadLetterQueue struct {
+	letters  []DeadLetter
+	requests int
+	// failed is the number of messages in each batch that fail.
+	failed int
+	err    error
+}
+
+func (m *mockDeadLetterQueue) SendMessageBatch(_ context.Context, input *sqs.SendMessageBatchInput, _ ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.requests++
+	output := &sqs.SendMessageBatchOutput{}
+	for i, e := range input.Entries {
+		if i < m.failed {
+			output.Failed = append(output.Failed, sqstypes.BatchResultErrorEntry{Id: e.Id, Code: aws.String("InternalError")})
+			continue
+		}
+		var l DeadLetter
+		if err := json.Unmarshal([]byte(aws.ToString(e.MessageBody)), &l); err != nil {
+			return nil, err
+		}
+		m.letters = append(m.letters, l)
+	}
+	return output, nil
+}
+
+func TestFailedEventsAreSentToTheDeadLetterQueue(t *testing.T) {
+	// Arrange.
+	var sent []string
+	dlq := &mockDeadLetterQueue{}
+	failedAt := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	h := newTestHandler(Config{
+		EventBridge:        failingEventBridge{fail: map[string]bool{"Failed": true}, sent: &sent},
+		EventBusName:       "bus",
+		EventSourceName:    "source",
+		MaxRetries:         -1,
+		DeadLetterQueue:    dlq,
+		DeadLetterQueueURL: "https://sqs.eu-west-1.amazonaws.com/123456789012/dead-letters",
+		Clock:              stream.ClockFunc(func() time.Time { return failedAt }),
+	})
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{
+			outboundRecord("INSERT", "Normal", false),
+			outboundRecord("INSERT", "Failed", false),
+		},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if err != nil {
+		t.Errorf("expected dead lettered events not to return an error, got %v", err)
+	}
+	expected := []DeadLetter{
+		{
+			PK:           "Payment/id",
+			EventBusName: "bus",
+			Source:       "source",
+			DetailType:   "Failed",
+			Detail:       "{}",
+			ErrorCode:    "InternalFailure",
+			FailedAt:     failedAt,
+		},
+	}
+	if diff := cmp.Diff(expected, dlq.letters); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestDeadLetterQueueErrorsAreReturned(t *testing.T) {
+	// Arrange.
+	var sent []string
+	h := newTestHandler(Config{
+		EventBridge:     failingEventBridge{fail: map[string]bool{"Failed": true}, sent: &sent},
+		MaxRetries:      -1,
+		DeadLetterQueue: &mockDeadLetterQueue{err: errors.New("queue unavailable")},
+	})
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{outboundRecord("INSERT", "Failed", false)},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if err == nil || !strings.Contains(err.Error(), "queue unavailable") {
+		t.Errorf("expected the dead letter queue error, got %v", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	// Arrange.
+	var sent []string
+	h := newTestHandler(Config{
+		EventBridge:     detailRecordingEventBridge{sent: &sent},
+		EventBusName:    "bus",
+		EventSourceName: "source",
+	})
+	input := `{"id":"1","pk":"Payment/id","detailType":"PaymentTaken","detail":"{\"amount\":10}","errorCode":"InternalFailure","failedAt":"2022-11-20T13:00:00Z"}
+
+{"id":"2","pk":"Payment/id","eventBusName":"other","source":"other","detailType":"PaymentRefunded","detail":"{}","errorMessage":"timeout","failedAt":"2022-11-20T13:00:00Z"}
+`
+	letters, err := ReadDeadLetters(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("failed to read dead letters: %v", err)
+	}
+
+	// Act.
+	err = h.Replay(context.Background(), letters)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{`PaymentTaken {"amount":10}`, "PaymentRefunded {}"}, sent); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestReadDeadLettersReturnsInvalidLines(t *testing.T) {
+	// Act.
+	_, err := ReadDeadLetters(strings.NewReader("{}\nnot json\n"))
+
+	// Assert.
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error for line 2, got %v", err)
+	}
+}
+
+func TestDeadLettersAreSentInBatches(t *testing.T) {
+	var tests = []struct {
+		name             string
+		dlq              *mockDeadLetterQueue
+		expectedRequests int
+		expectError      bool
+	}{
+		{
+			name:             "letters are sent in batches of 10",
+			dlq:              &mockDeadLetterQueue{},
+			expectedRequests: 2,
+		},
+		{
+			name:             "failed messages return an error",
+			dlq:              &mockDeadLetterQueue{failed: 1},
+			expectedRequests: 1,
+			expectError:      true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			h := newTestHandler(Config{DeadLetterQueue: test.dlq, DeadLetterQueueURL: "https://sqs.eu-west-1.amazonaws.com/123456789012/dead-letters"})
+			letters := make([]DeadLetter, deadLetterBatchSize+1)
+			for i := range letters {
+				letters[i] = DeadLetter{DetailType: "Failed", Detail: "{}"}
+			}
+
+			// Act.
+			err := h.sendDeadLetters(context.Background(), letters)
+
+			// Assert.
+			if (err != nil) != test.expectError {
+				t.Errorf("expected error %v, got %v", test.expectError, err)
+			}
+			if test.dlq.requests != test.expectedRequests {
+				t.Errorf("expected %d requests, got %d", test.expectedRequests, test.dlq.requests)
+			}
+			if !test.expectError && len(test.dlq.letters) != len(letters) {
+				t.Errorf("expected %d letters, got %d", len(letters), len(test.dlq.letters))
+			}
+		})
+	}
+}
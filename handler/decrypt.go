@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+// KMSAPI is the subset of the KMS client used by the handler.
+type KMSAPI interface {
+	Decrypt(context.Context, *kms.DecryptInput, ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// DynamoDBAPI is the subset of the DynamoDB client used by the handler.
+type DynamoDBAPI interface {
+	GetItem(context.Context, *dynamodb.GetItemInput, ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	UpdateItem(context.Context, *dynamodb.UpdateItemInput, ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	Query(context.Context, *dynamodb.QueryInput, ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+}
+
+// decryptRecord replaces the _enc attribute of records written by a store configured
+// with encryption with the decrypted payload attributes. If the store uses crypto
+// shredding, the data key is read from the entity's KEY record in the table.
+func (h *Handler) decryptRecord(ctx context.Context, tableName string, r map[string]events.DynamoDBAttributeValue) (err error) {
+	enc, ok := r["_enc"]
+	if !ok {
+		return
+	}
+	var encryptedKey []byte
+	if k, ok := r["_key"]; ok {
+		encryptedKey = k.Binary()
+	} else {
+		encryptedKey, err = h.getEntityKey(ctx, tableName, r["_pk"].String())
+		if err != nil {
+			return
+		}
+	}
+	do, err := h.KMS.Decrypt(ctx, &kms.DecryptInput{
+		CiphertextBlob: encryptedKey,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	block, err := aes.NewCipher(do.Plaintext)
+	if err != nil {
+		return
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return
+	}
+	ciphertext := enc.Binary()
+	if len(ciphertext) < gcm.NonceSize() {
+		return errors.New("encrypted payload is too short")
+	}
+	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	additionalData := []byte(r["_pk"].String() + "/" + r["_sk"].String())
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt payload: %w", err)
+	}
+	var payload map[string]events.DynamoDBAttributeValue
+	err = json.Unmarshal(plaintext, &payload)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal decrypted payload: %w", err)
+	}
+	delete(r, "_enc")
+	delete(r, "_key")
+	for k, v := range payload {
+		r[k] = v
+	}
+	return
+}
+
+func (h *Handler) getEntityKey(ctx context.Context, tableName, pk string) (encrypted []byte, err error) {
+	if tableName == "" {
+		return nil, errors.New("missing _key field in encrypted record, and the table name is unknown")
+	}
+	gio, err := h.DynamoDB.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      &tableName,
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]dynamodbtypes.AttributeValue{
+			"_pk": &dynamodbtypes.AttributeValueMemberS{Value: pk},
+			"_sk": &dynamodbtypes.AttributeValueMemberS{Value: "KEY"},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data key: %w", err)
+	}
+	v, ok := gio.Item["_key"].(*dynamodbtypes.AttributeValueMemberB)
+	if !ok {
+		return nil, fmt.Errorf("the data key of %q has been deleted", pk)
+	}
+	return v.Value, nil
+}
+
+// tableNameFromStreamARN returns the table name from a DynamoDB stream ARN, e.g.
+// arn:aws:dynamodb:eu-west-1:123456789012:table/name/stream/2021-01-01T00:00:00.000
+func tableNameFromStreamARN(arn string) string {
+	i := strings.Index(arn, ":table/")
+	if i < 0 {
+		return ""
+	}
+	return strings.SplitN(arn[i+len(":table/"):], "/", 2)[0]
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"go.uber.org/zap"
+)
+
+// defaultDeduplicationCacheSize is the number of deliveries remembered by each Webhook,
+// unless its Deliveries field is set.
+const defaultDeduplicationCacheSize = 10000
+
+// Deduplicator records the IDs of events that have been published, so that they're not
+// published again.
+type Deduplicator interface {
+	Published(ctx context.Context, id string) (bool, error)
+	MarkPublished(ctx context.Context, ids ...string) error
+}
+
+// MemoryDeduplicator remembers the IDs of the most recently published events in memory.
+// Lambda usually retries a failed stream batch in the same execution environment, so it
+// prevents most duplicates without writing to the table. Use leases, see
+// Config.LeaseDuration, to prevent duplicates across execution environments.
+type MemoryDeduplicator struct {
+	m     sync.Mutex
+	ids   map[string]struct{}
+	order []string
+	next  int
+}
+
+// NewMemoryDeduplicator creates a deduplicator that remembers up to size IDs.
+func NewMemoryDeduplicator(size int) *MemoryDeduplicator {
+	return &MemoryDeduplicator{
+		ids:   make(map[string]struct{}, size),
+		order: make([]string, size),
+	}
+}
+
+func (d *MemoryDeduplicator) Published(ctx context.Context, id string) (bool, error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	_, ok := d.ids[id]
+	return ok, nil
+}
+
+func (d *MemoryDeduplicator) MarkPublished(ctx context.Context, ids ...string) error {
+	d.m.Lock()
+	defer d.m.Unlock()
+	if len(d.order) == 0 {
+		return nil
+	}
+	for _, id := range ids {
+		if _, ok := d.ids[id]; ok {
+			continue
+		}
+		// Forget the oldest ID.
+		delete(d.ids, d.order[d.next])
+		d.order[d.next] = id
+		d.ids[id] = struct{}{}
+		d.next = (d.next + 1) % len(d.order)
+	}
+	return nil
+}
+
+// getEventID returns the event ID of the record.
+func getEventID(r map[string]events.DynamoDBAttributeValue) string {
+	if v, ok := r["_id"]; ok && v.DataType() == events.DataTypeString {
+		return v.String()
+	}
+	return ""
+}
+
+// deduplicate returns the events that haven't been published. Events that have been
+// published are acknowledged, so that pending records are confirmed.
+func (h *Handler) deduplicate(ctx context.Context, outboundEvents []outboundEvent) (unpublished []outboundEvent, err error) {
+	if h.Deduplicator == nil {
+		return outboundEvents, nil
+	}
+	for _, e := range outboundEvents {
+		if e.id == "" {
+			unpublished = append(unpublished, e)
+			continue
+		}
+		var published bool
+		published, err = h.Deduplicator.Published(ctx, e.id)
+		if err != nil {
+			return
+		}
+		if published {
+			h.Log.Info("skipping event that has already been published", zap.String("id", e.id))
+			h.acknowledge(ctx, 0, e, types.PutEventsResultEntry{})
+			continue
+		}
+		unpublished = append(unpublished, e)
+	}
+	return
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+func identifiedRecord(typ, id string, pending bool) events.DynamoDBEventRecord {
+	r := outboundRecord("INSERT", typ, pending)
+	r.Change.NewImage["_id"] = events.NewStringAttribute(id)
+	return r
+}
+
+func TestPublishedEventsAreNotPublishedAgainOnRetry(t *testing.T) {
+	// Arrange.
+	var sent []string
+	db := &mockDynamoDB{}
+	h := newTestHandler(Config{
+		EventBridge:  failingEventBridge{fail: map[string]bool{"Failed": true}, sent: &sent},
+		DynamoDB:     db,
+		Deduplicator: NewMemoryDeduplicator(10),
+	})
+	event := func() events.DynamoDBEvent {
+		return events.DynamoDBEvent{
+			Records: []events.DynamoDBEventRecord{
+				identifiedRecord("Pending", "1", true),
+				identifiedRecord("Normal", "2", false),
+				identifiedRecord("Failed", "3", false),
+			},
+		}
+	}
+
+	// Act.
+	first := h.HandleRequest(context.Background(), event())
+	second := h.HandleRequest(context.Background(), event())
+
+	// Assert.
+	if first == nil || second == nil {
+		t.Error("expected the failed event to fail both times")
+	}
+	if diff := cmp.Diff([]string{"Pending", "Normal", "Failed", "Failed"}, sent); diff != "" {
+		t.Errorf("expected only the failed event to be retried: %s", diff)
+	}
+	if diff := cmp.Diff([]string{"OUTBOUND/1/0/Pending", "OUTBOUND/1/0/Pending"}, db.confirmed); diff != "" {
+		t.Errorf("expected skipped pending events to be confirmed: %s", diff)
+	}
+}
+
+func TestMemoryDeduplicatorForgetsTheOldestIDs(t *testing.T) {
+	// Arrange.
+	ctx := context.Background()
+	d := NewMemoryDeduplicator(2)
+
+	// Act.
+	if err := d.MarkPublished(ctx, "1", "2", "2", "3"); err != nil {
+		t.Fatalf("failed to mark events as published: %v", err)
+	}
+
+	// Assert.
+	for id, expected := range map[string]bool{"1": false, "2": true, "3": true, "4": false} {
+		published, err := d.Published(ctx, id)
+		if err != nil {
+			t.Fatalf("failed to check event: %v", err)
+		}
+		if published != expected {
+			t.Errorf("%s: expected published to be %v, got %v", id, expected, published)
+		}
+	}
+}
+
+func TestConfigFromEnvOnlyDeduplicatesWhenConfigured(t *testing.T) {
+	var tests = []struct {
+		name     string
+		size     string
+		expected bool
+	}{
+		{
+			name: "by default, event IDs aren't remembered",
+		},
+		{
+			name: "a size of 0 disables deduplication",
+			size: "0",
+		},
+		{
+			name:     "a size enables deduplication",
+			size:     "100",
+			expected: true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			t.Setenv("AWS_REGION", "eu-west-1")
+			t.Setenv("DEDUPLICATION_CACHE_SIZE", test.size)
+
+			// Act.
+			c, err := ConfigFromEnv(context.Background())
+			if err != nil {
+				t.Fatalf("failed to read config: %v", err)
+			}
+
+			// Assert.
+			if actual := c.Deduplicator != nil; actual != test.expected {
+				t.Errorf("expected deduplication %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// dispatchRecord is an outbound record to update with its dispatch status.
+type dispatchRecord struct {
+	tableName string
+	pk, sk    string
+	// pending records are confirmed when they're dispatched.
+	pending bool
+	// outbox records are removed from the outbox index when they're dispatched.
+	outbox bool
+	// leased records have their lease released if they fail to be dispatched.
+	leased bool
+	// dispatched is set once the record has been dispatched.
+	dispatched bool
+}
+
+func (h *Handler) getDispatchRecord(tableName string, r map[string]events.DynamoDBAttributeValue) *dispatchRecord {
+	if !h.TrackDispatch && h.LeaseDuration <= 0 {
+		return nil
+	}
+	_, pending := r["_pending"]
+	return &dispatchRecord{
+		tableName: tableName,
+		pk:        r["_pk"].String(),
+		sk:        r["_sk"].String(),
+		pending:   pending,
+	}
+}
+
+// recordDispatch increments the dispatch attempts of the record. If failure is empty, the
+// time of dispatch is set, and pending records are confirmed, otherwise the failure reason
+// is set.
+func (h *Handler) recordDispatch(ctx context.Context, d *dispatchRecord, failure string) (err error) {
+	names := map[string]string{
+		"#_pk":               "_pk",
+		"#_dispatchAttempts": "_dispatchAttempts",
+		"#_dispatchError":    "_dispatchError",
+	}
+	values := map[string]dynamodbtypes.AttributeValue{
+		":_one": &dynamodbtypes.AttributeValueMemberN{Value: "1"},
+	}
+	var expression string
+	if failure != "" {
+		expression = "SET #_dispatchError = :_error ADD #_dispatchAttempts :_one"
+		values[":_error"] = &dynamodbtypes.AttributeValueMemberS{Value: failure}
+		if d.leased {
+			expression += " REMOVE #_leaseExpires"
+			names["#_leaseExpires"] = "_leaseExpires"
+		}
+	} else {
+		expression = "SET #_dispatchedAt = :_now ADD #_dispatchAttempts :_one REMOVE #_dispatchError"
+		names["#_dispatchedAt"] = "_dispatchedAt"
+		values[":_now"] = &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(h.now().Unix(), 10)}
+		if d.pending {
+			expression += ", #_pending"
+			names["#_pending"] = "_pending"
+		}
+		if d.outbox {
+			expression += ", #_outbox"
+			names["#_outbox"] = "_outbox"
+		}
+	}
+	_, err = h.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(d.tableName),
+		Key: map[string]dynamodbtypes.AttributeValue{
+			"_pk": &dynamodbtypes.AttributeValueMemberS{Value: d.pk},
+			"_sk": &dynamodbtypes.AttributeValueMemberS{Value: d.sk},
+		},
+		UpdateExpression:          aws.String(expression),
+		ConditionExpression:       aws.String("attribute_exists(#_pk)"),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to record dispatch of %s %s: %w", d.pk, d.sk, err)
+		return
+	}
+	d.dispatched = failure == ""
+	return
+}
+
+// removeFromOutbox removes the record from the outbox index without publishing it, e.g.
+// because a transform dropped it. If failure isn't empty, it's recorded as the dispatch
+// error, so that the record can still be found.
+func (h *Handler) removeFromOutbox(ctx context.Context, d *dispatchRecord, failure string) (err error) {
+	names := map[string]string{
+		"#_pk":     "_pk",
+		"#_outbox": "_outbox",
+	}
+	var values map[string]dynamodbtypes.AttributeValue
+	expression := "REMOVE #_outbox"
+	if failure != "" {
+		expression = "SET #_dispatchError = :_error ADD #_dispatchAttempts :_one REMOVE #_outbox"
+		names["#_dispatchError"] = "_dispatchError"
+		names["#_dispatchAttempts"] = "_dispatchAttempts"
+		values = map[string]dynamodbtypes.AttributeValue{
+			":_error": &dynamodbtypes.AttributeValueMemberS{Value: failure},
+			":_one":   &dynamodbtypes.AttributeValueMemberN{Value: "1"},
+		}
+	}
+	_, err = h.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(d.tableName),
+		Key: map[string]dynamodbtypes.AttributeValue{
+			"_pk": &dynamodbtypes.AttributeValueMemberS{Value: d.pk},
+			"_sk": &dynamodbtypes.AttributeValueMemberS{Value: d.sk},
+		},
+		UpdateExpression:          aws.String(expression),
+		ConditionExpression:       aws.String("attribute_exists(#_pk)"),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to remove %s %s from the outbox: %w", d.pk, d.sk, err)
+	}
+	return
+}
+
+// getFailure returns the reason that EventBridge rejected the entry, or an empty string.
+func getFailure(entry types.PutEventsResultEntry) string {
+	if entry.ErrorCode == nil {
+		return ""
+	}
+	return aws.ToString(entry.ErrorCode) + ": " + aws.ToString(entry.ErrorMessage)
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+// updateRecordingDynamoDB records the update expression applied to each sort key.
+type updateRecordingDynamoDB struct {
+	DynamoDBAPI
+	m       sync.Mutex
+	updates map[string]string
+	errors  map[string]string
+}
+
+func (m *updateRecordingDynamoDB) UpdateItem(_ context.Context, input *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	sk := input.Key["_sk"].(*dynamodbtypes.AttributeValueMemberS).Value
+	m.updates[sk] = aws.ToString(input.UpdateExpression)
+	if v, ok := input.ExpressionAttributeValues[":_error"].(*dynamodbtypes.AttributeValueMemberS); ok {
+		m.errors[sk] = v.Value
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func TestDispatchIsRecorded(t *testing.T) {
+	// Arrange.
+	var sent []string
+	db := &updateRecordingDynamoDB{updates: map[string]string{}, errors: map[string]string{}}
+	h := newTestHandler(Config{
+		EventBridge:   failingEventBridge{fail: map[string]bool{"Failed": true}, sent: &sent},
+		DynamoDB:      db,
+		TrackDispatch: true,
+	})
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{
+			outboundRecord("INSERT", "Critical", true),
+			outboundRecord("INSERT", "Normal", false),
+			outboundRecord("INSERT", "Failed", false),
+		},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if err == nil {
+		t.Error("expected an error for the failed entry")
+	}
+	expected := map[string]string{
+		"OUTBOUND/1/0/Critical": "SET #_dispatchedAt = :_now ADD #_dispatchAttempts :_one REMOVE #_dispatchError, #_pending",
+		"OUTBOUND/1/0/Normal":   "SET #_dispatchedAt = :_now ADD #_dispatchAttempts :_one REMOVE #_dispatchError",
+		"OUTBOUND/1/0/Failed":   "SET #_dispatchError = :_error ADD #_dispatchAttempts :_one",
+	}
+	if diff := cmp.Diff(expected, db.updates); diff != "" {
+		t.Errorf("unexpected updates: %s", diff)
+	}
+	if diff := cmp.Diff(map[string]string{"OUTBOUND/1/0/Failed": "InternalFailure: "}, db.errors); diff != "" {
+		t.Errorf("unexpected failure reasons: %s", diff)
+	}
+}
+
+func TestRecordingDispatchDoesNotRepublish(t *testing.T) {
+	// Arrange.
+	record := outboundRecord("MODIFY", "Failed", true)
+	record.Change.OldImage = map[string]events.DynamoDBAttributeValue{
+		"_pending": record.Change.NewImage["_pending"],
+	}
+
+	// Act.
+	publish := shouldPublish(record)
+
+	// Assert.
+	if publish {
+		t.Error("expected records with an unchanged _pending attribute not to be published again")
+	}
+}
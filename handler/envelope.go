@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// envelopeKey is the key of the envelope in the detail of events, if Config.Envelope is set.
+const envelopeKey = "meta"
+
+// envelope of an outbound event, used by consumers to correlate, order and deduplicate
+// events.
+type envelope struct {
+	Namespace string `json:"namespace"`
+	ID        string `json:"id"`
+	Sequence  int64  `json:"sequence"`
+	Index     int    `json:"index"`
+	EventID   string `json:"eventId,omitempty"`
+}
+
+// getEnvelope returns the envelope of the record, whose partition key is
+// [tenant/]namespace/id.
+func getEnvelope(r map[string]events.DynamoDBAttributeValue) (e envelope) {
+	p := getPosition(r)
+	e.Sequence = p.seq
+	e.Index = p.index
+	pk := p.pk
+	if v, ok := r["_tenant"]; ok && v.DataType() == events.DataTypeString {
+		pk = strings.TrimPrefix(pk, v.String()+"/")
+	}
+	parts := strings.SplitN(pk, "/", 2)
+	e.Namespace = parts[0]
+	if len(parts) > 1 {
+		e.ID = parts[1]
+	}
+	if v, ok := r["_id"]; ok && v.DataType() == events.DataTypeString {
+		e.EventID = v.String()
+	}
+	return
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEnvelope(t *testing.T) {
+	var tests = []struct {
+		name     string
+		envelope bool
+		tenant   string
+		expected string
+	}{
+		{
+			name:     "the envelope is not included by default",
+			expected: `{"_metadata":{"eventId":"01ARZ3NDEKTSV4RRFFQ69G5FAV"},"payout":10}`,
+		},
+		{
+			name:     "the envelope is included under the meta key",
+			envelope: true,
+			expected: `{"_metadata":{"eventId":"01ARZ3NDEKTSV4RRFFQ69G5FAV"},"meta":{"namespace":"SlotMachine","id":"id/with/slashes","sequence":3,"index":1,"eventId":"01ARZ3NDEKTSV4RRFFQ69G5FAV"},"payout":10}`,
+		},
+		{
+			name:     "the tenant is removed from the partition key",
+			envelope: true,
+			tenant:   "tenant",
+			expected: `{"_metadata":{"eventId":"01ARZ3NDEKTSV4RRFFQ69G5FAV","tenant":"tenant"},"meta":{"namespace":"SlotMachine","id":"id/with/slashes","sequence":3,"index":1,"eventId":"01ARZ3NDEKTSV4RRFFQ69G5FAV"},"payout":10}`,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			h := newTestHandler(Config{Envelope: test.envelope, Metadata: true})
+			pk := "SlotMachine/id/with/slashes"
+			r := map[string]events.DynamoDBAttributeValue{
+				"_typ":   events.NewStringAttribute("GameWon"),
+				"_sk":    events.NewStringAttribute("OUTBOUND/3/1/GameWon"),
+				"_id":    events.NewStringAttribute("01ARZ3NDEKTSV4RRFFQ69G5FAV"),
+				"payout": events.NewNumberAttribute("10"),
+			}
+			if test.tenant != "" {
+				pk = test.tenant + "/" + pk
+				r["_tenant"] = events.NewStringAttribute(test.tenant)
+			}
+			r["_pk"] = events.NewStringAttribute(pk)
+
+			// Act.
+			_, _, e, err := h.createOutboundEvent(context.Background(), "", r)
+
+			// Assert.
+			if err != nil {
+				t.Fatalf("failed to create outbound event: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, *e.Detail); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// eventBridgeFields are set by outbound events that implement stream.EventTimer,
+// stream.ResourceLister, stream.DetailTypeOverrider, stream.EventBusNamer or
+// stream.EventSourcer. The time defaults to the time that the record was stored.
+type eventBridgeFields struct {
+	time         *time.Time
+	resources    []string
+	detailType   string
+	eventBusName string
+	source       string
+}
+
+func getEventBridgeFields(r map[string]events.DynamoDBAttributeValue) (f eventBridgeFields) {
+	if v, ok := r["_eventTime"]; ok && v.DataType() == events.DataTypeString {
+		if t, err := time.Parse(time.RFC3339Nano, v.String()); err == nil {
+			f.time = &t
+		}
+	}
+	if f.time == nil {
+		f.time = getStoredTime(r)
+	}
+	if v, ok := r["_resources"]; ok && v.DataType() == events.DataTypeStringSet {
+		f.resources = v.StringSet()
+	}
+	if v, ok := r["_detailType"]; ok && v.DataType() == events.DataTypeString {
+		f.detailType = v.String()
+	}
+	if v, ok := r["_eventBus"]; ok && v.DataType() == events.DataTypeString {
+		f.eventBusName = v.String()
+	}
+	if v, ok := r["_source"]; ok && v.DataType() == events.DataTypeString {
+		f.source = v.String()
+	}
+	return
+}
+
+// getStoredTime returns the time that the record was stored, from its _date attribute, or
+// its _ts attribute, so that delayed, or replayed, stream records keep their original time.
+func getStoredTime(r map[string]events.DynamoDBAttributeValue) *time.Time {
+	if v, ok := r["_date"]; ok && v.DataType() == events.DataTypeString {
+		if t, err := time.Parse(time.RFC3339, v.String()); err == nil {
+			return &t
+		}
+	}
+	if v, ok := r["_ts"]; ok && v.DataType() == events.DataTypeNumber {
+		if sec, err := v.Int64(); err == nil {
+			t := time.Unix(sec, 0).UTC()
+			return &t
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEventBridgeFields(t *testing.T) {
+	// Arrange.
+	r := map[string]events.DynamoDBAttributeValue{
+		"_pk":         events.NewStringAttribute("Instance/id"),
+		"_typ":        events.NewStringAttribute("InstanceStopped"),
+		"_sk":         events.NewStringAttribute("OUTBOUND/1/0/InstanceStopped"),
+		"_eventTime":  events.NewStringAttribute("2022-11-20T13:00:00Z"),
+		"_resources":  events.NewStringSetAttribute([]string{"arn:aws:ec2:eu-west-2:123456789012:instance/i-1"}),
+		"_detailType": events.NewStringAttribute("EC2 Instance Stopped"),
+	}
+
+	// Act.
+	_, _, e, err := newTestHandler(Config{}).createOutboundEvent(context.Background(), "", r)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("failed to create outbound event: %v", err)
+	}
+	if *e.DetailType != "EC2 Instance Stopped" {
+		t.Errorf("expected the detail type to be overridden, got %q", *e.DetailType)
+	}
+	if e.Time == nil || !e.Time.Equal(time.Date(2022, time.November, 20, 13, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected time %v", e.Time)
+	}
+	if diff := cmp.Diff([]string{"arn:aws:ec2:eu-west-2:123456789012:instance/i-1"}, e.Resources); diff != "" {
+		t.Error(diff)
+	}
+	if *e.Detail != "{}" {
+		t.Errorf("expected the fields not to be included in the detail, got %s", *e.Detail)
+	}
+}
+
+func TestEventTimeDefaultsToTheStoredTime(t *testing.T) {
+	var tests = []struct {
+		name     string
+		stored   map[string]events.DynamoDBAttributeValue
+		expected time.Time
+	}{
+		{
+			name: "the _date attribute is used",
+			stored: map[string]events.DynamoDBAttributeValue{
+				"_date": events.NewStringAttribute("2022-11-20T13:00:00+01:00"),
+				"_ts":   events.NewNumberAttribute("1"),
+			},
+			expected: time.Date(2022, time.November, 20, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "the _ts attribute is used if there's no _date",
+			stored: map[string]events.DynamoDBAttributeValue{
+				"_ts": events.NewNumberAttribute("1668949200"),
+			},
+			expected: time.Date(2022, time.November, 20, 13, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "the event time takes precedence",
+			stored: map[string]events.DynamoDBAttributeValue{
+				"_eventTime": events.NewStringAttribute("2022-11-20T14:00:00Z"),
+				"_date":      events.NewStringAttribute("2022-11-20T13:00:00Z"),
+			},
+			expected: time.Date(2022, time.November, 20, 14, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			r := map[string]events.DynamoDBAttributeValue{
+				"_pk":  events.NewStringAttribute("Instance/id"),
+				"_typ": events.NewStringAttribute("InstanceStopped"),
+				"_sk":  events.NewStringAttribute("OUTBOUND/1/0/InstanceStopped"),
+			}
+			for k, v := range test.stored {
+				r[k] = v
+			}
+
+			// Act.
+			_, _, e, err := newTestHandler(Config{}).createOutboundEvent(context.Background(), "", r)
+
+			// Assert.
+			if err != nil {
+				t.Fatalf("failed to create outbound event: %v", err)
+			}
+			if e.Time == nil || !e.Time.Equal(test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, e.Time)
+			}
+		})
+	}
+}
+
+func TestEventBridgeFieldsAreNilByDefault(t *testing.T) {
+	// Arrange.
+	r := map[string]events.DynamoDBAttributeValue{
+		"_pk":  events.NewStringAttribute("Instance/id"),
+		"_typ": events.NewStringAttribute("InstanceStopped"),
+		"_sk":  events.NewStringAttribute("OUTBOUND/1/0/InstanceStopped"),
+	}
+
+	// Act.
+	_, _, e, err := newTestHandler(Config{}).createOutboundEvent(context.Background(), "", r)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("failed to create outbound event: %v", err)
+	}
+	if *e.DetailType != "InstanceStopped" || e.Time != nil || e.Resources != nil {
+		t.Errorf("expected the default fields, got %q, %v, %v", *e.DetailType, e.Time, e.Resources)
+	}
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/firehose"
+	firehosetypes "github.com/aws/aws-sdk-go-v2/service/firehose/types"
+)
+
+// FirehoseAPI is the subset of the Kinesis Data Firehose client used by the handler.
+type FirehoseAPI interface {
+	PutRecordBatch(context.Context, *firehose.PutRecordBatchInput, ...func(*firehose.Options)) (*firehose.PutRecordBatchOutput, error)
+}
+
+// firehoseBatchSize is the maximum number of records in a PutRecordBatch request.
+const firehoseBatchSize = 500
+
+// FirehoseRecord is written to the delivery stream for each outbound event, as a line of
+// newline delimited JSON, so that it can be queried in S3, e.g. with Athena, or loaded
+// into Redshift.
+type FirehoseRecord struct {
+	ID         string          `json:"id,omitempty"`
+	Namespace  string          `json:"namespace"`
+	PK         string          `json:"pk"`
+	Sequence   int64           `json:"sequence"`
+	Index      int             `json:"index"`
+	DetailType string          `json:"detailType"`
+	Source     string          `json:"source"`
+	Time       *time.Time      `json:"time,omitempty"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// firehoseFailure is the error code of events that couldn't be put into Firehose.
+const firehoseFailure = "FirehoseFailure"
+
+// publishFirehose puts the events into the FirehoseDeliveryStream, in batches.
+func (h *Handler) publishFirehose(ctx context.Context, outboundEvents []outboundEvent) (results []types.PutEventsResultEntry) {
+	results = make([]types.PutEventsResultEntry, len(outboundEvents))
+	var records []firehosetypes.Record
+	var indices []int
+	for i, e := range outboundEvents {
+		r, err := json.Marshal(FirehoseRecord{
+			ID:         e.id,
+			Namespace:  e.namespace,
+			PK:         e.position.pk,
+			Sequence:   e.position.seq,
+			Index:      e.position.index,
+			DetailType: aws.ToString(e.entry.DetailType),
+			Source:     aws.ToString(e.entry.Source),
+			Time:       e.entry.Time,
+			Detail:     json.RawMessage(aws.ToString(e.entry.Detail)),
+		})
+		if err != nil {
+			results[i] = firehoseResult(err.Error())
+			continue
+		}
+		records = append(records, firehosetypes.Record{Data: append(r, '\n')})
+		indices = append(indices, i)
+	}
+	for start := 0; start < len(records); start += firehoseBatchSize {
+		end := start + firehoseBatchSize
+		if end > len(records) {
+			end = len(records)
+		}
+		output, err := h.Firehose.PutRecordBatch(ctx, &firehose.PutRecordBatchInput{
+			DeliveryStreamName: aws.String(h.FirehoseDeliveryStream),
+			Records:            records[start:end],
+		})
+		if err != nil {
+			for _, i := range indices[start:end] {
+				results[i] = firehoseResult(err.Error())
+			}
+			continue
+		}
+		// The responses are in the same order as the records.
+		for j, response := range output.RequestResponses {
+			if response.ErrorCode != nil && start+j < end {
+				results[indices[start+j]] = firehoseResult(aws.ToString(response.ErrorCode) + ": " + aws.ToString(response.ErrorMessage))
+			}
+		}
+	}
+	return
+}
+
+func firehoseResult(message string) types.PutEventsResultEntry {
+	return types.PutEventsResultEntry{ErrorCode: aws.String(firehoseFailure), ErrorMessage: aws.String(message)}
+}
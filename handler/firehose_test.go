@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/firehose"
+	firehosetypes "github.com/aws/aws-sdk-go-v2/service/firehose/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockFirehose struct {
+	stream   string
+	records  []string
+	requests int
+	failed   []int
+	err      error
+}
+
+func (m *mockFirehose) PutRecordBatch(_ context.Context, input *firehose.PutRecordBatchInput, _ ...func(*firehose.Options)) (*firehose.PutRecordBatchOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.requests++
+	m.stream = aws.ToString(input.DeliveryStreamName)
+	output := &firehose.PutRecordBatchOutput{
+		RequestResponses: make([]firehosetypes.PutRecordBatchResponseEntry, len(input.Records)),
+	}
+	for _, r := range input.Records {
+		m.records = append(m.records, string(r.Data))
+	}
+	for _, j := range m.failed {
+		output.RequestResponses[j] = firehosetypes.PutRecordBatchResponseEntry{
+			ErrorCode:    aws.String("ServiceUnavailableException"),
+			ErrorMessage: aws.String("slow down"),
+		}
+	}
+	return output, nil
+}
+
+func TestFirehose(t *testing.T) {
+	// Arrange.
+	var sent []string
+	stream := &mockFirehose{}
+	h := newTestHandler(Config{
+		EventBridge:            failingEventBridge{sent: &sent},
+		EventSourceName:        "source",
+		Firehose:               stream,
+		FirehoseDeliveryStream: "analytics",
+	})
+	refunded := outboundRecord("INSERT", "PaymentRefunded", false)
+	refunded.Change.NewImage["_sk"] = events.NewStringAttribute("OUTBOUND/2/0/PaymentRefunded")
+	refunded.Change.NewImage["amount"] = events.NewNumberAttribute("10")
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{outboundRecord("INSERT", "PaymentTaken", false), refunded},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"PaymentTaken", "PaymentRefunded"}, sent); diff != "" {
+		t.Errorf("expected the events to be sent to EventBridge: %s", diff)
+	}
+	if stream.stream != "analytics" {
+		t.Errorf("expected the analytics delivery stream, got %q", stream.stream)
+	}
+	expected := []string{
+		`{"namespace":"Payment","pk":"Payment/id","sequence":1,"index":0,"detailType":"PaymentTaken","source":"source","detail":{}}` + "\n",
+		`{"namespace":"Payment","pk":"Payment/id","sequence":2,"index":0,"detailType":"PaymentRefunded","source":"source","detail":{"amount":10}}` + "\n",
+	}
+	if diff := cmp.Diff(expected, stream.records); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestFirehoseFailures(t *testing.T) {
+	var tests = []struct {
+		name     string
+		firehose *mockFirehose
+		expected []bool
+	}{
+		{
+			name:     "failed records are returned",
+			firehose: &mockFirehose{failed: []int{1}},
+			expected: []bool{false, true},
+		},
+		{
+			name:     "all records fail if the request fails",
+			firehose: &mockFirehose{err: errors.New("unavailable")},
+			expected: []bool{true, true},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			h := newTestHandler(Config{Firehose: test.firehose, FirehoseDeliveryStream: "analytics"})
+			outboundEvents := []outboundEvent{
+				{entry: types.PutEventsRequestEntry{Detail: aws.String("{}")}},
+				{entry: types.PutEventsRequestEntry{Detail: aws.String("{}")}},
+			}
+
+			// Act.
+			results := h.publishFirehose(context.Background(), outboundEvents)
+
+			// Assert.
+			actual := make([]bool, len(results))
+			for i, r := range results {
+				actual[i] = r.ErrorCode != nil
+			}
+			if diff := cmp.Diff(test.expected, actual); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestFirehoseRecordsAreBatched(t *testing.T) {
+	// Arrange.
+	stream := &mockFirehose{}
+	h := newTestHandler(Config{Firehose: stream, FirehoseDeliveryStream: "analytics"})
+	outboundEvents := make([]outboundEvent, firehoseBatchSize+1)
+	for i := range outboundEvents {
+		outboundEvents[i] = outboundEvent{entry: types.PutEventsRequestEntry{Detail: aws.String("{}")}}
+	}
+
+	// Act.
+	results := h.publishFirehose(context.Background(), outboundEvents)
+
+	// Assert.
+	if stream.requests != 2 {
+		t.Errorf("expected 2 requests, got %d", stream.requests)
+	}
+	if len(stream.records) != len(outboundEvents) {
+		t.Errorf("expected %d records, got %d", len(outboundEvents), len(stream.records))
+	}
+	for i, r := range results {
+		if r.ErrorCode != nil {
+			t.Errorf("unexpected error for record %d: %s", i, aws.ToString(r.ErrorMessage))
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// detailFormat configures how attribute values are written to the detail of events.
+type detailFormat struct {
+	numbers NumberFormat
+	binary  BinaryFormat
+}
+
+// NumberFormat of the numbers in the detail of events.
+type NumberFormat string
+
+const (
+	// NumberFormatNative converts numbers to int64, or float64, which loses the precision
+	// of large integers, e.g. 64-bit IDs, and decimals, e.g. financial amounts.
+	NumberFormatNative NumberFormat = ""
+	// NumberFormatPrecise writes numbers as JSON numbers, exactly as they're stored. Consumers
+	// must parse them without converting to float64, e.g. using json.Decoder.UseNumber.
+	NumberFormatPrecise NumberFormat = "precise"
+	// NumberFormatString writes numbers as JSON strings, e.g. "12.50".
+	NumberFormatString NumberFormat = "string"
+)
+
+func (nf NumberFormat) valid() bool {
+	return nf == NumberFormatNative || nf == NumberFormatPrecise || nf == NumberFormatString
+}
+
+// BinaryFormat of the binary and binary set attributes in the detail of events.
+type BinaryFormat string
+
+const (
+	// BinaryFormatBase64 writes binary values as standard base64 strings, e.g. "3q2+7w==",
+	// which can't be distinguished from other strings.
+	BinaryFormatBase64 BinaryFormat = ""
+	// BinaryFormatTagged writes binary values as objects with a "$binary" field that
+	// contains the standard base64 encoding, e.g. {"$binary":"3q2+7w=="}.
+	BinaryFormatTagged BinaryFormat = "tagged"
+	// BinaryFormatHex writes binary values as lowercase hex strings, e.g. "deadbeef".
+	BinaryFormatHex BinaryFormat = "hex"
+	// BinaryFormatExclude removes binary fields from the detail. Binary elements of lists
+	// are written as null, so that the indices of other elements don't change.
+	BinaryFormatExclude BinaryFormat = "exclude"
+)
+
+// binaryKey is the key of base64 encoded values written with BinaryFormatTagged.
+const binaryKey = "$binary"
+
+func (bf BinaryFormat) valid() bool {
+	return bf == BinaryFormatBase64 || bf == BinaryFormatTagged || bf == BinaryFormatHex || bf == BinaryFormatExclude
+}
+
+func isBinary(av events.DynamoDBAttributeValue) bool {
+	return av.DataType() == events.DataTypeBinary || av.DataType() == events.DataTypeBinarySet
+}
+
+func getBinary(b []byte, bf BinaryFormat) interface{} {
+	switch bf {
+	case BinaryFormatTagged:
+		return map[string]string{binaryKey: base64.StdEncoding.EncodeToString(b)}
+	case BinaryFormatHex:
+		return hex.EncodeToString(b)
+	case BinaryFormatExclude:
+		return nil
+	}
+	return b
+}
+
+func getBinarySet(bs [][]byte, bf BinaryFormat) interface{} {
+	switch bf {
+	case BinaryFormatBase64:
+		return bs
+	case BinaryFormatExclude:
+		return nil
+	}
+	op := make([]interface{}, len(bs))
+	for i, b := range bs {
+		op[i] = getBinary(b, bf)
+	}
+	return op
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestNumberFormat(t *testing.T) {
+	input := map[string]events.DynamoDBAttributeValue{
+		"id":     events.NewNumberAttribute("18446744073709551615"),
+		"amount": events.NewNumberAttribute("12345678901234567.89"),
+		"list":   events.NewListAttribute([]events.DynamoDBAttributeValue{events.NewNumberAttribute("1")}),
+	}
+	var tests = []struct {
+		format   NumberFormat
+		expected string
+	}{
+		{
+			format:   NumberFormatNative,
+			expected: `{"amount":12345678901234568,"id":18446744073709552000,"list":[1]}`,
+		},
+		{
+			format:   NumberFormatPrecise,
+			expected: `{"amount":12345678901234567.89,"id":18446744073709551615,"list":[1]}`,
+		},
+		{
+			format:   NumberFormatString,
+			expected: `{"amount":"12345678901234567.89","id":"18446744073709551615","list":["1"]}`,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(string(test.format), func(t *testing.T) {
+			// Act.
+			m, err := stripDynamoDBTypesFromMap(input, detailFormat{numbers: test.format})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			actual, err := json.Marshal(m)
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+
+			// Assert.
+			if string(actual) != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestBinaryFormat(t *testing.T) {
+	input := map[string]events.DynamoDBAttributeValue{
+		"binary":    events.NewBinaryAttribute([]byte{0xDE, 0xAD, 0xBE, 0xEF}),
+		"binarySet": events.NewBinarySetAttribute([][]byte{{0xDE, 0xAD}, {0xBE, 0xEF}}),
+		"list":      events.NewListAttribute([]events.DynamoDBAttributeValue{events.NewBinaryAttribute([]byte{0x01}), events.NewStringAttribute("a")}),
+		"string":    events.NewStringAttribute("3q2+7w=="),
+	}
+	var tests = []struct {
+		format   BinaryFormat
+		expected string
+	}{
+		{
+			format:   BinaryFormatBase64,
+			expected: `{"binary":"3q2+7w==","binarySet":["3q0=","vu8="],"list":["AQ==","a"],"string":"3q2+7w=="}`,
+		},
+		{
+			format:   BinaryFormatTagged,
+			expected: `{"binary":{"$binary":"3q2+7w=="},"binarySet":[{"$binary":"3q0="},{"$binary":"vu8="}],"list":[{"$binary":"AQ=="},"a"],"string":"3q2+7w=="}`,
+		},
+		{
+			format:   BinaryFormatHex,
+			expected: `{"binary":"deadbeef","binarySet":["dead","beef"],"list":["01","a"],"string":"3q2+7w=="}`,
+		},
+		{
+			format:   BinaryFormatExclude,
+			expected: `{"list":[null,"a"],"string":"3q2+7w=="}`,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(string(test.format), func(t *testing.T) {
+			// Act.
+			m, err := stripDynamoDBTypesFromMap(input, detailFormat{binary: test.format})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			actual, err := json.Marshal(m)
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+
+			// Assert.
+			if string(actual) != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, actual)
+			}
+		})
+	}
+}
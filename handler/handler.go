@@ -3,102 +3,647 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"reflect"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/a-h/stream"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/firehose"
+	"github.com/aws/aws-sdk-go-v2/service/iotdataplane"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	awslambda "github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/scheduler"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
 )
 
-type eventBridgeAPI interface {
+// EventBridgeAPI is the subset of the EventBridge client used by the handler.
+type EventBridgeAPI interface {
 	PutEvents(context.Context, *eventbridge.PutEventsInput, ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error)
 }
 
-var log *zap.Logger
-var eventBridge eventBridgeAPI
-var eventBusName = os.Getenv("EVENT_BUS_NAME")
-var eventSourceName = os.Getenv("EVENT_SOURCE_NAME")
+// Config of a Handler.
+type Config struct {
+	// Log defaults to a production logger.
+	Log *zap.Logger
+	// EventBridge client used to publish events. Optional if SNS or SQS is set.
+	EventBridge EventBridgeAPI
+	// SNS, if set, publishes events to the SNSTopicARN topic, in addition to EventBridge,
+	// or instead of EventBridge if the EventBridge client isn't set. ConfigFromEnv sets it
+	// if SNS_TOPIC_ARN is set.
+	SNS         SNSAPI
+	SNSTopicARN string
+	// SQS, if set, sends events to the SQSQueueURL queue, in addition to EventBridge, or
+	// instead of EventBridge if the EventBridge client isn't set. ConfigFromEnv sets it if
+	// SQS_QUEUE_URL is set.
+	SQS         SQSAPI
+	SQSQueueURL string
+	// Kafka, if set, produces events to Kafka topics, in addition to EventBridge, or instead
+	// of EventBridge if the EventBridge client isn't set. KafkaTopic chooses the topic of
+	// each event, and defaults to a topic per namespace.
+	Kafka      KafkaAPI
+	KafkaTopic KafkaTopic
+	// NATS, if set, publishes events to NATS JetStream, in addition to EventBridge, or
+	// instead of EventBridge if the EventBridge client isn't set, using the subject
+	// "<namespace>.<DetailType>", with the NATSSubjectPrefix, e.g. "events.".
+	NATS              NATSAPI
+	NATSSubjectPrefix string
+	// Webhooks, if set, receive events, in addition to EventBridge, or instead of
+	// EventBridge if the EventBridge client isn't set.
+	Webhooks []*Webhook
+	// Firehose, if set, puts every event into the FirehoseDeliveryStream as newline
+	// delimited JSON, e.g. for analytics in S3 or Redshift, in addition to EventBridge, or
+	// instead of EventBridge if the EventBridge client isn't set. ConfigFromEnv sets it if
+	// FIREHOSE_DELIVERY_STREAM is set.
+	Firehose               FirehoseAPI
+	FirehoseDeliveryStream string
+	// StepFunctions, if set, starts an execution of the state machine in StateMachines that
+	// matches the DetailType of each event, with the event's detail as input. ConfigFromEnv
+	// sets it if STATE_MACHINES is set to a JSON object of ARNs by DetailType.
+	StepFunctions StepFunctionsAPI
+	// StateMachines are the ARNs of state machines, by DetailType.
+	StateMachines map[string]string
+	// Lambda, if set, asynchronously invokes the function in Functions that matches the
+	// DetailType of each event, with an EventBridge event as the payload. ConfigFromEnv sets
+	// it if FUNCTIONS is set to a JSON object of function names by DetailType.
+	Lambda LambdaAPI
+	// Functions are the names, or ARNs, of Lambda functions, by DetailType.
+	Functions map[string]string
+	// Realtime, if set, publishes each event to the IoT Core MQTT topic of the entity that
+	// produced it, so that web and mobile clients receive updates in real time. The topic is
+	// the RealtimeChannelPrefix, e.g. "stream/", followed by the entity's partition key.
+	// ConfigFromEnv sets it if IOT_DATA_ENDPOINT is set, e.g. to
+	// "https://abc123-ats.iot.eu-west-1.amazonaws.com".
+	Realtime              RealtimeAPI
+	RealtimeChannelPrefix string
+	// DynamoDB client used to read the data keys of encrypted records, and to update the
+	// status of outbound records. Required if the store encrypts records, or if events are
+	// confirmed, leased or have their dispatch tracked.
+	DynamoDB DynamoDBAPI
+	// KMS client used to decrypt the data keys of encrypted records.
+	KMS KMSAPI
+	// EventBusName and EventSourceName of events that don't set their own, see
+	// stream.EventBusNamer and stream.EventSourcer.
+	EventBusName    string
+	EventSourceName string
+	// HighPriorityEventBusName, if set, receives events with a priority above
+	// stream.PriorityNormal.
+	HighPriorityEventBusName string
+	// VersionedDetailType appends the version of versioned events to the DetailType, e.g.
+	// "GamePlayed@2", so that EventBridge rules can match specific versions.
+	VersionedDetailType bool
+	// CloudEvents sends the detail of each event as a CloudEvents 1.0 structured JSON
+	// event, for consumers outside of AWS.
+	CloudEvents bool
+	// TrackDispatch records the dispatch status on each outbound record, see
+	// stream.DynamoDBStore.Undispatched.
+	TrackDispatch bool
+	// LeaseDuration, if set, claims each outbound record with a conditional update before
+	// it's published, so that concurrent invocations, or stream retries, don't publish
+	// events that have already been published. If publishing fails, the lease is released
+	// so that the event can be retried. Leasing records the dispatch status, as if
+	// TrackDispatch is set.
+	LeaseDuration time.Duration
+	// Scheduler, if set, creates an EventBridge Scheduler schedule for each
+	// stream.ScheduledEvent outbound event, instead of publishing it to EventBridge. The
+	// schedule passes the event to the ScheduleTargetARN, using the ScheduleRoleARN, and is
+	// created in the ScheduleGroupName group, or the default group. ConfigFromEnv sets it if
+	// SCHEDULE_TARGET_ARN is set.
+	Scheduler         SchedulerAPI
+	ScheduleTargetARN string
+	ScheduleRoleARN   string
+	ScheduleGroupName string
+	// Router, if set, chooses the event bus and source of outbound events.
+	Router Router
+	// Routes send events to different event buses, or with different sources, by the
+	// namespace of the entity and the event name. The first matching route is used.
+	Routes []Route
+	// Transforms are applied to each outbound event, in order, before it's published, and
+	// can drop events. Dropped events are confirmed, but aren't recorded as dispatched.
+	Transforms []Transform
+	// MaxRetries is the number of times that entries rejected by EventBridge with a
+	// retryable error, e.g. ThrottlingException, are retried. Defaults to 3. Set to -1 to
+	// disable retries.
+	MaxRetries int
+	// RetryBackoff is the time to wait before the first retry, doubling for each retry.
+	// Defaults to 100ms.
+	RetryBackoff time.Duration
+	// Envelope adds the namespace, ID, sequence, index and event ID of each event to its
+	// detail, under the "meta" key, so that consumers can correlate, order and deduplicate
+	// events.
+	Envelope bool
+	// Metadata adds the correlation, causation and actor IDs, event ID, version and tenant
+	// of each event to its detail, under the "_metadata" key. CloudEvents always include
+	// them as extension attributes.
+	Metadata bool
+	// StateUpdates publishes the new state when a STATE record is inserted or modified, as
+	// a "<Namespace>StateUpdated" event, e.g. "SlotMachineStateUpdated".
+	StateUpdates bool
+	// Deletions publishes the old state when a STATE record is removed, as a
+	// "<Namespace>Deleted" event, e.g. "SlotMachineDeleted". The stream view type must
+	// include old images.
+	Deletions bool
+	// Deduplicator, if set, skips events that have already been published, e.g. when a
+	// stream batch is retried after a partial failure.
+	Deduplicator Deduplicator
+	// PayloadStore, if set, stores the detail of events that are larger than the EventBridge
+	// limit of 256KB in the PayloadBucket, and the handler sends a claim check that points
+	// to the stored detail instead. Otherwise, oversized events can't be sent. ConfigFromEnv
+	// sets it if PAYLOAD_BUCKET is set.
+	PayloadStore  PayloadStoreAPI
+	PayloadBucket string
+	// NumberFormat of numbers in the detail of events. Defaults to NumberFormatNative.
+	NumberFormat NumberFormat
+	// BinaryFormat of binary and binary set attributes in the detail of events. Defaults to
+	// BinaryFormatBase64.
+	BinaryFormat BinaryFormat
+	// DeadLetterQueue, if set, sends events that couldn't be published, after retries, to
+	// the DeadLetterQueueURL SQS queue, so that the stream moves on. Replay them with
+	// Replay. ConfigFromEnv sets it if DEAD_LETTER_QUEUE_URL is set.
+	DeadLetterQueue    DeadLetterQueueAPI
+	DeadLetterQueueURL string
+	// MaxInFlight is the maximum number of PutEvents requests sent concurrently. Defaults
+	// to 10. Set to -1 for no limit.
+	MaxInFlight int
+	// Clock is used for the timestamps the handler writes, e.g. the dispatch time of
+	// outbound records. Defaults to stream.SystemClock.
+	Clock stream.Clock
+}
+
+// ConfigFromEnv reads the configuration from the EVENT_BUS_NAME, EVENT_SOURCE_NAME,
+// HIGH_PRIORITY_EVENT_BUS_NAME, VERSIONED_DETAIL_TYPE, EVENT_FORMAT, TRACK_DISPATCH,
+// LEASE_DURATION, MAX_IN_FLIGHT, EVENT_ENVELOPE, PUBLISH_STATE_UPDATES, PUBLISH_DELETIONS,
+// DEDUPLICATION_CACHE_SIZE, ROUTES, NUMBER_FORMAT and BINARY_FORMAT environment variables,
+// and creates the AWS clients from the default AWS configuration. If DEDUPLICATION_CACHE_SIZE
+// is set, that many published event IDs are remembered in memory.
+//
+// The clients of other sinks are created if their environment variables are set:
+// SNS_TOPIC_ARN for SNS, SQS_QUEUE_URL for SQS, FIREHOSE_DELIVERY_STREAM for Kinesis Data
+// Firehose, STATE_MACHINES for Step Functions, FUNCTIONS for Lambda, and IOT_DATA_ENDPOINT
+// and REALTIME_CHANNEL_PREFIX for IoT Core. The EventBridge Scheduler client is created if
+// SCHEDULE_TARGET_ARN is set, with SCHEDULE_ROLE_ARN and SCHEDULE_GROUP_NAME, and the S3
+// client that stores the detail of oversized events if PAYLOAD_BUCKET is set. The SQS
+// client of the dead letter queue is created if DEAD_LETTER_QUEUE_URL is set.
+func ConfigFromEnv(ctx context.Context) (c Config, err error) {
+	c = Config{
+		EventBusName:             os.Getenv("EVENT_BUS_NAME"),
+		EventSourceName:          os.Getenv("EVENT_SOURCE_NAME"),
+		HighPriorityEventBusName: os.Getenv("HIGH_PRIORITY_EVENT_BUS_NAME"),
+		VersionedDetailType:      os.Getenv("VERSIONED_DETAIL_TYPE") == "true",
+		CloudEvents:              strings.EqualFold(os.Getenv("EVENT_FORMAT"), "cloudevents"),
+		TrackDispatch:            os.Getenv("TRACK_DISPATCH") == "true",
+		Envelope:                 os.Getenv("EVENT_ENVELOPE") == "true",
+		Metadata:                 os.Getenv("EVENT_METADATA") == "true",
+		StateUpdates:             os.Getenv("PUBLISH_STATE_UPDATES") == "true",
+		Deletions:                os.Getenv("PUBLISH_DELETIONS") == "true",
+		NumberFormat:             NumberFormat(os.Getenv("NUMBER_FORMAT")),
+		BinaryFormat:             BinaryFormat(os.Getenv("BINARY_FORMAT")),
+		SNSTopicARN:              os.Getenv("SNS_TOPIC_ARN"),
+		SQSQueueURL:              os.Getenv("SQS_QUEUE_URL"),
+		FirehoseDeliveryStream:   os.Getenv("FIREHOSE_DELIVERY_STREAM"),
+		RealtimeChannelPrefix:    os.Getenv("REALTIME_CHANNEL_PREFIX"),
+		ScheduleTargetARN:        os.Getenv("SCHEDULE_TARGET_ARN"),
+		ScheduleRoleARN:          os.Getenv("SCHEDULE_ROLE_ARN"),
+		ScheduleGroupName:        os.Getenv("SCHEDULE_GROUP_NAME"),
+		PayloadBucket:            os.Getenv("PAYLOAD_BUCKET"),
+		DeadLetterQueueURL:       os.Getenv("DEAD_LETTER_QUEUE_URL"),
+	}
+	c.LeaseDuration, err = getLeaseDuration(os.Getenv("LEASE_DURATION"))
+	if err != nil {
+		return
+	}
+	if v := os.Getenv("ROUTES"); v != "" {
+		if err = json.Unmarshal([]byte(v), &c.Routes); err != nil {
+			err = fmt.Errorf("invalid ROUTES: %w", err)
+			return
+		}
+	}
+	if v := os.Getenv("STATE_MACHINES"); v != "" {
+		if err = json.Unmarshal([]byte(v), &c.StateMachines); err != nil {
+			err = fmt.Errorf("invalid STATE_MACHINES: %w", err)
+			return
+		}
+	}
+	if v := os.Getenv("FUNCTIONS"); v != "" {
+		if err = json.Unmarshal([]byte(v), &c.Functions); err != nil {
+			err = fmt.Errorf("invalid FUNCTIONS: %w", err)
+			return
+		}
+	}
+	if v := os.Getenv("DEDUPLICATION_CACHE_SIZE"); v != "" {
+		var size int
+		size, err = strconv.Atoi(v)
+		if err != nil {
+			err = fmt.Errorf("invalid DEDUPLICATION_CACHE_SIZE: %w", err)
+			return
+		}
+		if size > 0 {
+			c.Deduplicator = NewMemoryDeduplicator(size)
+		}
+	}
+	if v := os.Getenv("MAX_IN_FLIGHT"); v != "" {
+		c.MaxInFlight, err = strconv.Atoi(v)
+		if err != nil {
+			err = fmt.Errorf("invalid MAX_IN_FLIGHT: %w", err)
+			return
+		}
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		err = fmt.Errorf("unable to load aws config: %w", err)
+		return
+	}
+	c.EventBridge = eventbridge.NewFromConfig(cfg)
+	c.KMS = kms.NewFromConfig(cfg)
+	c.DynamoDB = dynamodb.NewFromConfig(cfg)
+	if c.SNSTopicARN != "" {
+		c.SNS = sns.NewFromConfig(cfg)
+	}
+	if c.SQSQueueURL != "" {
+		c.SQS = sqs.NewFromConfig(cfg)
+	}
+	if c.FirehoseDeliveryStream != "" {
+		c.Firehose = firehose.NewFromConfig(cfg)
+	}
+	if len(c.StateMachines) > 0 {
+		c.StepFunctions = sfn.NewFromConfig(cfg)
+	}
+	if len(c.Functions) > 0 {
+		c.Lambda = awslambda.NewFromConfig(cfg)
+	}
+	if c.ScheduleTargetARN != "" {
+		c.Scheduler = scheduler.NewFromConfig(cfg)
+	}
+	if c.DeadLetterQueueURL != "" {
+		c.DeadLetterQueue = sqs.NewFromConfig(cfg)
+	}
+	if c.PayloadBucket != "" {
+		c.PayloadStore = s3.NewFromConfig(cfg)
+	}
+	if endpoint := os.Getenv("IOT_DATA_ENDPOINT"); endpoint != "" {
+		c.Realtime = iotdataplane.NewFromConfig(cfg, func(o *iotdataplane.Options) {
+			o.EndpointResolver = iotdataplane.EndpointResolverFromURL(endpoint)
+		})
+	}
+	return
+}
+
+// Handler publishes the outbound event records of a DynamoDB stream to EventBridge.
+// Multiple handlers, e.g. with different event buses, can be used in the same process.
+type Handler struct {
+	Config
+}
 
+// New creates a handler.
+func New(c Config) (h *Handler, err error) {
+	if c.EventSourceName == "" {
+		return nil, errors.New("handler: missing EventSourceName")
+	}
+	if c.EventBridge == nil && len((&Handler{Config: c}).sinks()) == 0 {
+		return nil, errors.New("handler: missing EventBridge client, or another sink")
+	}
+	if c.EventBridge != nil && c.EventBusName == "" {
+		return nil, errors.New("handler: missing EventBusName")
+	}
+	if c.Firehose != nil && c.FirehoseDeliveryStream == "" {
+		return nil, errors.New("handler: missing FirehoseDeliveryStream")
+	}
+	if c.SNS != nil && c.SNSTopicARN == "" {
+		return nil, errors.New("handler: missing SNSTopicARN")
+	}
+	if c.SQS != nil && c.SQSQueueURL == "" {
+		return nil, errors.New("handler: missing SQSQueueURL")
+	}
+	if c.DeadLetterQueue != nil && c.DeadLetterQueueURL == "" {
+		return nil, errors.New("handler: missing DeadLetterQueueURL")
+	}
+	if c.PayloadStore != nil && c.PayloadBucket == "" {
+		return nil, errors.New("handler: missing PayloadBucket")
+	}
+	if c.Scheduler != nil && (c.ScheduleTargetARN == "" || c.ScheduleRoleARN == "") {
+		return nil, errors.New("handler: missing ScheduleTargetARN or ScheduleRoleARN")
+	}
+	if !c.NumberFormat.valid() {
+		return nil, fmt.Errorf("handler: unknown NumberFormat %q", c.NumberFormat)
+	}
+	if !c.BinaryFormat.valid() {
+		return nil, fmt.Errorf("handler: unknown BinaryFormat %q", c.BinaryFormat)
+	}
+	h = &Handler{Config: c}
+	if h.MaxRetries == 0 {
+		h.MaxRetries = defaultMaxRetries
+	}
+	if h.RetryBackoff == 0 {
+		h.RetryBackoff = defaultRetryBackoff
+	}
+	if h.MaxInFlight == 0 {
+		h.MaxInFlight = defaultMaxInFlight
+	}
+	if h.Clock == nil {
+		h.Clock = stream.SystemClock
+	}
+	if h.Kafka != nil && h.KafkaTopic == nil {
+		h.KafkaTopic = TopicPerNamespace("")
+	}
+	if h.Log == nil {
+		h.Log, err = zap.NewProduction()
+		if err != nil {
+			return nil, fmt.Errorf("handler: failed to create logger: %w", err)
+		}
+	}
+	return
+}
+
+// now returns the time of the handler's clock, or the system time if the handler wasn't
+// created with New.
+func (h *Handler) now() time.Time {
+	if h.Clock == nil {
+		return stream.SystemClock.Now()
+	}
+	return h.Clock.Now()
+}
+
+// defaultHandler is configured from the environment by Start and StartRelay.
+var defaultHandler *Handler
+
+// schedulerClient, router and transforms are set by SetScheduler, SetRouter and
+// SetTransforms, and used by defaultHandler.
+var schedulerClient SchedulerAPI
+var router Router
+var transforms []Transform
+
+// Start configures the handler from the environment, see ConfigFromEnv, and starts the
+// Lambda function.
 func Start() {
-	var err error
-	log, err = zap.NewProduction()
+	initialize()
+	defaultHandler.Log.Info("starting handler")
+	lambda.Start(HandleRequest)
+}
+
+// initialize defaultHandler from the environment.
+func initialize() {
+	log, err := zap.NewProduction()
 	if err != nil {
 		panic("failed to create logger: " + err.Error())
 	}
-	if eventBusName == "" {
-		log.Fatal("missing EVENT_BUS_NAME environment variable")
+	c, err := ConfigFromEnv(context.Background())
+	if err != nil {
+		log.Fatal("invalid configuration", zap.Error(err))
 	}
-	if eventSourceName == "" {
-		log.Fatal("missing EVENT_SOURCE_NAME environment variable")
+	c.Log = log
+	if schedulerClient != nil {
+		c.Scheduler = schedulerClient
 	}
-	cfg, err := config.LoadDefaultConfig(context.Background())
+	c.Router = router
+	c.Transforms = transforms
+	defaultHandler, err = New(c)
 	if err != nil {
-		log.Fatal("unable to load aws config", zap.Error(err))
+		log.Fatal("invalid configuration", zap.Error(err))
 	}
-	eventBridge = eventbridge.NewFromConfig(cfg)
-	log.Info("starting handler")
-	lambda.Start(HandleRequest)
 }
 
+// HandleRequest handles the DynamoDB stream event using the handler configured by Start.
 func HandleRequest(ctx context.Context, event events.DynamoDBEvent) error {
-	defer log.Sync()
-	//TODO: Remove.
-	log.Info("processing records", zap.Int("count", len(event.Records)), zap.Any("event", event))
-	var outboundEvents []types.PutEventsRequestEntry
+	return defaultHandler.HandleRequest(ctx, event)
+}
+
+// HandleRequest publishes the outbound event records of the DynamoDB stream event.
+func (h *Handler) HandleRequest(ctx context.Context, event events.DynamoDBEvent) error {
+	defer h.Log.Sync()
+	h.Log.Info("processing records", zap.Int("count", len(event.Records)))
+	var outboundEvents []outboundEvent
 	for i := 0; i < len(event.Records); i++ {
-		id, eventType, outboundEvent, err := createOutboundEvent(event.Records[i].Change.NewImage)
+		tableName := tableNameFromStreamARN(event.Records[i].EventSourceArn)
+		if isStateRecord(event.Records[i]) {
+			se, err := h.createStateEvent(ctx, tableName, event.Records[i])
+			if err != nil {
+				h.Log.Error("failed to create state event", zap.Error(err))
+				return err
+			}
+			if se != nil {
+				outboundEvents = append(outboundEvents, *se)
+			}
+			continue
+		}
+		if !shouldPublish(event.Records[i]) {
+			continue
+		}
+		p := getPendingRecord(tableName, event.Records[i].Change.NewImage)
+		d := h.getDispatchRecord(tableName, event.Records[i].Change.NewImage)
+		priority := getPriority(event.Records[i].Change.NewImage)
+		position := getPosition(event.Records[i].Change.NewImage)
+		eventID := getEventID(event.Records[i].Change.NewImage)
+		namespace := getEnvelope(event.Records[i].Change.NewImage).Namespace
+		id, eventType, entry, err := h.createOutboundEvent(ctx, tableName, event.Records[i].Change.NewImage)
 		if err != nil {
-			log.Error("failed to create outbound event", zap.Error(err))
+			h.Log.Error("failed to create outbound event", zap.Error(err))
 			return err
 		}
-		if outboundEvent == nil {
+		if entry == nil {
+			// The event was dropped by a transform, so it won't be published.
+			if p != nil && h.DynamoDB != nil {
+				if err = h.confirm(ctx, p); err != nil {
+					h.Log.Warn("failed to confirm dropped outbound event", zap.String("id", id), zap.Error(err))
+				}
+			}
+			continue
+		}
+		if eventType == stream.ScheduledEventName && h.Scheduler != nil {
+			s, err := h.createSchedule(*entry.Detail)
+			if err != nil {
+				h.Log.Error("failed to create schedule", zap.Error(err))
+				return err
+			}
+			if err = h.schedule(ctx, s); err != nil {
+				h.Log.Error("failed to schedule event", zap.String("id", id), zap.Error(err))
+				return err
+			}
+			h.Log.Info("scheduled event", zap.String("id", id), zap.String("name", s.Name), zap.Time("at", s.At))
 			continue
 		}
-		outboundEvents = append(outboundEvents, *outboundEvent)
-		log.Info("found outbound event", zap.String("id", id), zap.String("type", eventType))
+		outboundEvents = append(outboundEvents, outboundEvent{entry: *entry, pending: p, dispatch: d, priority: priority, position: position, namespace: namespace, id: eventID})
+		h.Log.Info("found outbound event", zap.String("id", id), zap.String("type", eventType))
+	}
+	if err := h.sendByPriority(ctx, outboundEvents); err != nil {
+		return err
+	}
+	h.Log.Info("complete", zap.Int("sent", len(outboundEvents)))
+	return nil
+}
+
+// outboundEvent is an event to send to EventBridge.
+type outboundEvent struct {
+	entry types.PutEventsRequestEntry
+	// pending is the record to confirm once EventBridge has acknowledged the event, or nil.
+	pending *pendingRecord
+	// dispatch is the record to update with the dispatch status, or nil.
+	dispatch *dispatchRecord
+	priority stream.Priority
+	// position of the event in the events produced by the entity.
+	position position
+	// namespace of the entity that produced the event.
+	namespace string
+	// id of the event, used for deduplication: the event ID of outbound records, or the
+	// stream record's event ID for state events.
+	id string
+	// accepted records the targets that have accepted the event, keyed by eventBridgeTarget
+	// and the position of each sink, so that retries don't publish it to them again.
+	accepted map[int]bool
+}
+
+// accept records that the target has accepted the event.
+func (e *outboundEvent) accept(target int) {
+	if e.accepted == nil {
+		e.accepted = make(map[int]bool)
+	}
+	e.accepted[target] = true
+}
+
+// send the events to EventBridge in concurrent batches.
+func (h *Handler) send(ctx context.Context, outboundEvents []outboundEvent) error {
+	outboundEvents, err := h.deduplicate(ctx, outboundEvents)
+	if err != nil {
+		return err
+	}
+	outboundEvents, err = h.claimAll(ctx, outboundEvents)
+	if err != nil {
+		return err
+	}
+	sortByPosition(outboundEvents)
+	entries := make([]types.PutEventsRequestEntry, len(outboundEvents))
+	for i, e := range outboundEvents {
+		entries[i] = e.entry
 	}
-	batches, err := batch(outboundEvents)
+	entryBatches, err := batch(entries)
 	if err != nil {
 		return fmt.Errorf("failed to create batches: %w", err)
 	}
+	batches := make([][]outboundEvent, len(entryBatches))
+	var offset int
+	for i := range entryBatches {
+		batches[i] = outboundEvents[offset : offset+len(entryBatches[i])]
+		offset += len(entryBatches[i])
+	}
+	// Batches that contain events of the same entity are sent in sequence.
+	chains := chain(batches)
 	var wg sync.WaitGroup
-	wg.Add(len(batches))
+	wg.Add(len(chains))
 	errors := make([]error, len(batches))
-	for i := 0; i < len(batches); i++ {
-		go func(i int) {
+	// Limit the number of batches in flight.
+	inFlight := len(chains)
+	if h.MaxInFlight > 0 && h.MaxInFlight < inFlight {
+		inFlight = h.MaxInFlight
+	}
+	sem := make(chan struct{}, inFlight)
+	var i int
+	for _, c := range chains {
+		sem <- struct{}{}
+		go func(first int, c [][]outboundEvent) {
+			defer func() { <-sem }()
 			defer wg.Done()
-			log.Info("sending batch", zap.Int("batch", i+1), zap.Int("n", len(batches)))
-			peo, err := eventBridge.PutEvents(context.Background(), &eventbridge.PutEventsInput{
-				Entries: batches[i],
-			})
-			if err != nil {
-				errors[i] = fmt.Errorf("batch %d: failed to send events: %v", i, err)
-				return
+			for j, b := range c {
+				h.Log.Info("sending batch", zap.Int("batch", first+j+1), zap.Int("n", len(batches)))
+				errors[first+j] = h.sendBatch(ctx, first+j, b)
+				// Don't send later events of the entity if earlier events failed.
+				if errors[first+j] != nil {
+					return
+				}
 			}
-			if peo.FailedEntryCount > 0 {
-				errors[i] = fmt.Errorf("batch %d: failed to send %d events", i, peo.FailedEntryCount)
-				return
-			}
-		}(i)
+		}(i, c)
+		i += len(c)
 	}
 	wg.Wait()
-	if err = multierr.Combine(errors...); err != nil {
-		return err
+	return multierr.Combine(errors...)
+}
+
+// sendBatch sends a batch of events, retrying entries that fail with a retryable error,
+// e.g. throttling, up to MaxRetries times.
+func (h *Handler) sendBatch(ctx context.Context, i int, batch []outboundEvent) error {
+	remaining := batch
+	for attempt := 0; ; attempt++ {
+		peo, err := h.putEvents(ctx, remaining)
+		if err != nil {
+			letters := make([]DeadLetter, len(remaining))
+			for j, e := range remaining {
+				if e.dispatch != nil {
+					if err := h.recordDispatch(ctx, e.dispatch, err.Error()); err != nil {
+						h.Log.Warn("failed to record dispatch failure", zap.Int("batch", i+1), zap.Error(err))
+					}
+				}
+				letters[j] = newDeadLetter(e, "", err.Error(), h.now())
+			}
+			return h.deadLetter(ctx, i, letters, fmt.Errorf("batch %d: failed to send events: %w", i, err))
+		}
+		var retry []outboundEvent
+		var failed []DeadLetter
+		var published []string
+		for j := range remaining {
+			entry := peo.Entries[j]
+			if isRetryable(entry) && attempt < h.MaxRetries {
+				retry = append(retry, remaining[j])
+				continue
+			}
+			if entry.ErrorCode != nil {
+				failed = append(failed, newDeadLetter(remaining[j], aws.ToString(entry.ErrorCode), aws.ToString(entry.ErrorMessage), h.now()))
+			} else if remaining[j].id != "" {
+				published = append(published, remaining[j].id)
+			}
+			h.acknowledge(ctx, i, remaining[j], entry)
+		}
+		if h.Deduplicator != nil && len(published) > 0 {
+			if err := h.Deduplicator.MarkPublished(ctx, published...); err != nil {
+				h.Log.Warn("failed to mark events as published", zap.Int("batch", i+1), zap.Error(err))
+			}
+		}
+		if len(retry) == 0 {
+			if len(failed) > 0 {
+				return h.deadLetter(ctx, i, failed, fmt.Errorf("batch %d: failed to send %d events", i, len(failed)))
+			}
+			return nil
+		}
+		h.Log.Info("retrying failed events", zap.Int("batch", i+1), zap.Int("count", len(retry)), zap.Int("attempt", attempt+1))
+		if err := sleep(ctx, h.backoff(attempt)); err != nil {
+			return fmt.Errorf("batch %d: %d events not retried: %w", i, len(retry), err)
+		}
+		remaining = retry
 	}
-	log.Info("complete", zap.Int("sent", len(outboundEvents)))
-	return nil
 }
 
-func createOutboundEvent(r map[string]events.DynamoDBAttributeValue) (id, eventType string, e *types.PutEventsRequestEntry, err error) {
+// acknowledge the result of sending the event, by recording its dispatch, or confirming
+// the pending record if EventBridge accepted it. Records that fail to be confirmed are
+// republished by the sweeper.
+func (h *Handler) acknowledge(ctx context.Context, i int, e outboundEvent, entry types.PutEventsResultEntry) {
+	if e.dispatch != nil {
+		if err := h.recordDispatch(ctx, e.dispatch, getFailure(entry)); err != nil {
+			h.Log.Warn("failed to record dispatch", zap.Int("batch", i+1), zap.Error(err))
+		}
+		return
+	}
+	if e.pending == nil || entry.ErrorCode != nil {
+		return
+	}
+	if err := h.confirm(ctx, e.pending); err != nil {
+		h.Log.Warn("failed to confirm outbound event", zap.Int("batch", i+1), zap.Error(err))
+	}
+}
+
+func (h *Handler) createOutboundEvent(ctx context.Context, tableName string, r map[string]events.DynamoDBAttributeValue) (id, eventType string, e *types.PutEventsRequestEntry, err error) {
 	pkField, ok := r["_pk"]
 	if !ok {
 		return
@@ -117,6 +662,61 @@ func createOutboundEvent(r map[string]events.DynamoDBAttributeValue) (id, eventT
 		return
 	}
 	eventType = typ.String()
+	e, err = h.createEntry(ctx, tableName, id, sk, eventType, r)
+	return
+}
+
+// createEntry creates the EventBridge entry for the record, removing the library's
+// attributes from the detail.
+func (h *Handler) createEntry(ctx context.Context, tableName, id, sk, eventType string, r map[string]events.DynamoDBAttributeValue) (e *types.PutEventsRequestEntry, err error) {
+	// Don't send records written in a newer, incompatible format.
+	if f, ok := r["_fmt"]; ok {
+		major, parseErr := strconv.Atoi(strings.SplitN(f.String(), ".", 2)[0])
+		if parseErr != nil || major > stream.FormatMajorVersion {
+			err = fmt.Errorf("unsupported record format %q", f.String())
+			return
+		}
+	}
+
+	// Decrypt the payload if the store is configured with encryption.
+	err = h.decryptRecord(ctx, tableName, r)
+	if err != nil {
+		err = fmt.Errorf("could not decrypt record: %w", err)
+		return
+	}
+
+	// Propagate correlation, causation and actor metadata.
+	metadata := getMetadata(r)
+
+	// Fields that must not leave the table.
+	redacted := getRedactedFields(r)
+
+	var date string
+	if d, ok := r["_date"]; ok && d.DataType() == events.DataTypeString {
+		date = d.String()
+	}
+
+	// Expose the version of versioned events.
+	detailType := eventType
+	if v, ok := r["_ver"]; ok && v.DataType() == events.DataTypeNumber {
+		metadata["version"] = v.Number()
+		if h.VersionedDetailType {
+			detailType = eventType + "@" + v.Number()
+		}
+	}
+
+	// Get the key of the detail before the library's attributes are removed, in case the
+	// event is too large to send.
+	key := payloadKey(id, sk, eventType, r)
+
+	// Populate the EventBridge fields set by the event.
+	fields := getEventBridgeFields(r)
+	if fields.detailType != "" {
+		detailType = fields.detailType
+	}
+	env := getEnvelope(r)
+	busName, source := h.route(eventType, env.Namespace, metadata, getPriority(r), fields)
+	traceHeader := getTraceHeader(ctx, r)
 
 	// Remove _ fields from the event.
 	var keysToDelete []string
@@ -130,11 +730,21 @@ func createOutboundEvent(r map[string]events.DynamoDBAttributeValue) (id, eventT
 		delete(r, keysToDelete[i])
 	}
 	// Strip type data.
-	m, err := stripDynamoDBTypesFromMap(r)
+	m, err := stripDynamoDBTypesFromMap(r, detailFormat{numbers: h.NumberFormat, binary: h.BinaryFormat})
 	if err != nil {
 		err = fmt.Errorf("could not strip dynamodb type information from record: %v", err)
 		return
 	}
+	redact(m, redacted)
+	if h.Envelope {
+		m[envelopeKey] = env
+	}
+	if h.CloudEvents {
+		m = newCloudEvent(detailType, source, id, date, m, metadata)
+	} else if (h.Metadata || eventType == stream.ScheduledEventName) && len(metadata) > 0 {
+		// Schedules are named after the event ID, so scheduled events always include it.
+		m["_metadata"] = metadata
+	}
 	// Get JSON.
 	detailJSON, err := json.Marshal(m)
 	if err != nil {
@@ -143,19 +753,50 @@ func createOutboundEvent(r map[string]events.DynamoDBAttributeValue) (id, eventT
 	detail := string(detailJSON)
 
 	e = &types.PutEventsRequestEntry{
-		DetailType:   &eventType,
-		EventBusName: &eventBusName,
-		Source:       &eventSourceName,
+		DetailType:   &detailType,
+		EventBusName: &busName,
+		Source:       &source,
 		Detail:       &detail,
+		Time:         fields.time,
+		Resources:    fields.resources,
+		TraceHeader:  traceHeader,
+	}
+	if e, err = h.transform(e); err != nil || e == nil {
+		return
+	}
+	// Store the detail of events that are too large to send.
+	if getSize(*e) > maxBatchSizeKB && h.PayloadStore != nil {
+		err = h.checkDetail(ctx, key, e)
 	}
 	return
 }
 
-func stripDynamoDBTypesFromMap(m map[string]events.DynamoDBAttributeValue) (op map[string]interface{}, err error) {
+var metadataFields = map[string]string{
+	"_id":            "eventId",
+	"_correlationId": "correlationId",
+	"_causationId":   "causationId",
+	"_actorId":       "actorId",
+	"_tenant":        "tenant",
+}
+
+func getMetadata(r map[string]events.DynamoDBAttributeValue) (metadata map[string]string) {
+	metadata = make(map[string]string)
+	for from, to := range metadataFields {
+		if v, ok := r[from]; ok && v.DataType() == events.DataTypeString {
+			metadata[to] = v.String()
+		}
+	}
+	return
+}
+
+func stripDynamoDBTypesFromMap(m map[string]events.DynamoDBAttributeValue, f detailFormat) (op map[string]interface{}, err error) {
 	op = make(map[string]interface{})
 	for k := range m {
 		k := k
-		op[k], err = getAttributeValue(m[k])
+		if f.binary == BinaryFormatExclude && isBinary(m[k]) {
+			continue
+		}
+		op[k], err = getAttributeValue(m[k], f)
 		if err != nil {
 			return
 		}
@@ -163,10 +804,10 @@ func stripDynamoDBTypesFromMap(m map[string]events.DynamoDBAttributeValue) (op m
 	return
 }
 
-func stripDynamoDBTypesFromList(list []events.DynamoDBAttributeValue) (op []interface{}, err error) {
+func stripDynamoDBTypesFromList(list []events.DynamoDBAttributeValue, f detailFormat) (op []interface{}, err error) {
 	op = make([]interface{}, len(list))
 	for i := 0; i < len(list); i++ {
-		op[i], err = getAttributeValue(list[i])
+		op[i], err = getAttributeValue(list[i], f)
 		if err != nil {
 			return
 		}
@@ -174,20 +815,20 @@ func stripDynamoDBTypesFromList(list []events.DynamoDBAttributeValue) (op []inte
 	return
 }
 
-func getAttributeValue(av events.DynamoDBAttributeValue) (interface{}, error) {
+func getAttributeValue(av events.DynamoDBAttributeValue, f detailFormat) (interface{}, error) {
 	switch av.DataType() {
 	case events.DataTypeBinary:
-		return av.Binary(), nil
+		return getBinary(av.Binary(), f.binary), nil
 	case events.DataTypeBoolean:
 		return av.Boolean(), nil
 	case events.DataTypeBinarySet:
-		return av.BinarySet(), nil
+		return getBinarySet(av.BinarySet(), f.binary), nil
 	case events.DataTypeList:
-		return stripDynamoDBTypesFromList(av.List())
+		return stripDynamoDBTypesFromList(av.List(), f)
 	case events.DataTypeMap:
-		return stripDynamoDBTypesFromMap(av.Map())
+		return stripDynamoDBTypesFromMap(av.Map(), f)
 	case events.DataTypeNumber:
-		return getNumber(av.Number())
+		return getNumber(av.Number(), f.numbers)
 	case events.DataTypeNumberSet:
 		return av.NumberSet(), nil
 	case events.DataTypeNull:
@@ -200,7 +841,13 @@ func getAttributeValue(av events.DynamoDBAttributeValue) (interface{}, error) {
 	return nil, fmt.Errorf("unknown DynamoDBAttributeValue type: %v", reflect.TypeOf(av.DataType()))
 }
 
-func getNumber(s string) (interface{}, error) {
+func getNumber(s string, nf NumberFormat) (interface{}, error) {
+	switch nf {
+	case NumberFormatPrecise:
+		return json.Number(s), nil
+	case NumberFormatString:
+		return s, nil
+	}
 	// First try integer.
 	i, err := strconv.ParseInt(s, 10, 64)
 	if err == nil {
@@ -215,8 +862,9 @@ func getNumber(s string) (interface{}, error) {
 }
 
 const (
-	maxBatchSizeKB = 256 * 1024
-	maxCount       = 10
+	maxBatchSizeKB     = 256 * 1024
+	maxCount           = 10
+	defaultMaxInFlight = 10
 )
 
 func batch(values []types.PutEventsRequestEntry) (pages [][]types.PutEventsRequestEntry, err error) {
@@ -2,13 +2,20 @@ package handler
 
 import (
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
@@ -78,7 +85,7 @@ func TestStripDynamoDBTypes(t *testing.T) {
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			actual, err := stripDynamoDBTypesFromMap(tt.input)
+			actual, err := stripDynamoDBTypesFromMap(tt.input, detailFormat{})
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -95,13 +102,23 @@ type mockEventBridge struct {
 
 func (m mockEventBridge) PutEvents(_ context.Context, input *eventbridge.PutEventsInput, _ ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
 	*m.input = *input
-	return &eventbridge.PutEventsOutput{}, nil
+	return accepted(input), nil
+}
+
+// accepted returns a successful result for each entry of the input.
+func accepted(input *eventbridge.PutEventsInput) *eventbridge.PutEventsOutput {
+	return &eventbridge.PutEventsOutput{Entries: make([]types.PutEventsResultEntry, len(input.Entries))}
+}
+
+// newTestHandler creates a handler that doesn't log.
+func newTestHandler(c Config) *Handler {
+	c.Log = zap.NewNop()
+	return &Handler{Config: c}
 }
 
 func TestOnlyOutboundTypeEventsAreEmitted(t *testing.T) {
 	var input eventbridge.PutEventsInput
-	eventBridge = mockEventBridge{&input}
-	log = zap.NewNop()
+	h := newTestHandler(Config{EventBridge: mockEventBridge{&input}})
 	pk := uuid.NewString()
 	outbound := events.DynamoDBEventRecord{
 		Change: events.DynamoDBStreamRecord{
@@ -141,7 +158,7 @@ func TestOnlyOutboundTypeEventsAreEmitted(t *testing.T) {
 			state,
 		},
 	}
-	err := HandleRequest(context.Background(), event)
+	err := h.HandleRequest(context.Background(), event)
 	if err != nil {
 		t.Fatal("failed to handle request: ", err.Error())
 	}
@@ -269,3 +286,398 @@ func TestBatchError(t *testing.T) {
 		})
 	}
 }
+
+type mockKMS struct {
+	key []byte
+}
+
+func (m mockKMS) Decrypt(_ context.Context, _ *kms.DecryptInput, _ ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	return &kms.DecryptOutput{Plaintext: m.key}, nil
+}
+
+func TestEncryptedOutboundEventsAreDecrypted(t *testing.T) {
+	// Arrange.
+	key := []byte("0123456789abcdef0123456789abcdef")
+	h := newTestHandler(Config{KMS: mockKMS{key: key}})
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	payload := []byte(`{"newCount":{"N":"1"},"oldCount":{"N":"0"}}`)
+	ciphertext := gcm.Seal(nonce, nonce, payload, []byte("Counter/id/OUTBOUND/1/0/CounterUpdated"))
+	r := map[string]events.DynamoDBAttributeValue{
+		"_pk":  events.NewStringAttribute("Counter/id"),
+		"_typ": events.NewStringAttribute("CounterUpdated"),
+		"_sk":  events.NewStringAttribute("OUTBOUND/1/0/CounterUpdated"),
+		"_enc": events.NewBinaryAttribute(ciphertext),
+		"_key": events.NewBinaryAttribute([]byte("encrypted key")),
+	}
+
+	// Act.
+	_, _, e, err := h.createOutboundEvent(context.Background(), "", r)
+	if err != nil {
+		t.Fatalf("failed to create outbound event: %v", err)
+	}
+
+	// Assert.
+	if diff := cmp.Diff(`{"newCount":1,"oldCount":0}`, *e.Detail); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestTableNameFromStreamARN(t *testing.T) {
+	actual := tableNameFromStreamARN("arn:aws:dynamodb:eu-west-1:123456789012:table/slotMachine/stream/2021-01-01T00:00:00.000")
+	if diff := cmp.Diff("slotMachine", actual); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestMetadataIsPropagated(t *testing.T) {
+	r := map[string]events.DynamoDBAttributeValue{
+		"_pk":            events.NewStringAttribute("Counter/id"),
+		"_typ":           events.NewStringAttribute("CounterUpdated"),
+		"_sk":            events.NewStringAttribute("OUTBOUND/1/0/CounterUpdated"),
+		"_id":            events.NewStringAttribute("01ARZ3NDEKTSV4RRFFQ69G5FAV"),
+		"_correlationId": events.NewStringAttribute("correlation"),
+		"_causationId":   events.NewStringAttribute("causation"),
+		"_actorId":       events.NewStringAttribute("actor"),
+		"newCount":       events.NewNumberAttribute("1"),
+	}
+	_, _, e, err := newTestHandler(Config{Metadata: true}).createOutboundEvent(context.Background(), "", r)
+	if err != nil {
+		t.Fatalf("failed to create outbound event: %v", err)
+	}
+	expected := `{"_metadata":{"actorId":"actor","causationId":"causation","correlationId":"correlation","eventId":"01ARZ3NDEKTSV4RRFFQ69G5FAV"},"newCount":1}`
+	if diff := cmp.Diff(expected, *e.Detail); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestMetadataIsOnlyAddedWhenConfigured(t *testing.T) {
+	r := map[string]events.DynamoDBAttributeValue{
+		"_pk":            events.NewStringAttribute("Counter/id"),
+		"_typ":           events.NewStringAttribute("CounterUpdated"),
+		"_sk":            events.NewStringAttribute("OUTBOUND/1/0/CounterUpdated"),
+		"_id":            events.NewStringAttribute("01ARZ3NDEKTSV4RRFFQ69G5FAV"),
+		"_correlationId": events.NewStringAttribute("correlation"),
+		"newCount":       events.NewNumberAttribute("1"),
+	}
+	_, _, e, err := newTestHandler(Config{}).createOutboundEvent(context.Background(), "", r)
+	if err != nil {
+		t.Fatalf("failed to create outbound event: %v", err)
+	}
+	expected := `{"newCount":1}`
+	if diff := cmp.Diff(expected, *e.Detail); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestRedactedFieldsAreRemoved(t *testing.T) {
+	r := map[string]events.DynamoDBAttributeValue{
+		"_pk":        events.NewStringAttribute("Payment/id"),
+		"_typ":       events.NewStringAttribute("PaymentTaken"),
+		"_sk":        events.NewStringAttribute("OUTBOUND/1/0/PaymentTaken"),
+		"_redact":    events.NewStringSetAttribute([]string{"cardNumber", "billing.postcode", "missing.field"}),
+		"cardNumber": events.NewStringAttribute("4111111111111111"),
+		"amount":     events.NewNumberAttribute("100"),
+		"billing": events.NewMapAttribute(map[string]events.DynamoDBAttributeValue{
+			"name":     events.NewStringAttribute("A"),
+			"postcode": events.NewStringAttribute("AB1 2CD"),
+		}),
+	}
+	_, _, e, err := newTestHandler(Config{}).createOutboundEvent(context.Background(), "", r)
+	if err != nil {
+		t.Fatalf("failed to create outbound event: %v", err)
+	}
+	expected := `{"amount":100,"billing":{"name":"A"}}`
+	if diff := cmp.Diff(expected, *e.Detail); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestVersionedEvents(t *testing.T) {
+	var tests = []struct {
+		name               string
+		versioned          bool
+		expectedDetailType string
+	}{
+		{
+			name:               "the version is added to the metadata",
+			expectedDetailType: "GamePlayed",
+		},
+		{
+			name:               "the version can be added to the detail type",
+			versioned:          true,
+			expectedDetailType: "GamePlayed@2",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			h := newTestHandler(Config{VersionedDetailType: test.versioned, Metadata: true})
+			r := map[string]events.DynamoDBAttributeValue{
+				"_pk":   events.NewStringAttribute("SlotMachine/id"),
+				"_typ":  events.NewStringAttribute("GamePlayed"),
+				"_sk":   events.NewStringAttribute("OUTBOUND/1/0/GamePlayed"),
+				"_ver":  events.NewNumberAttribute("2"),
+				"stake": events.NewNumberAttribute("10"),
+			}
+
+			// Act.
+			_, _, e, err := h.createOutboundEvent(context.Background(), "", r)
+
+			// Assert.
+			if err != nil {
+				t.Fatalf("failed to create outbound event: %v", err)
+			}
+			if *e.DetailType != test.expectedDetailType {
+				t.Errorf("expected detail type %q, got %q", test.expectedDetailType, *e.DetailType)
+			}
+			expected := `{"_metadata":{"version":"2"},"stake":10}`
+			if diff := cmp.Diff(expected, *e.Detail); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	var tests = []struct {
+		name        string
+		config      Config
+		expectError bool
+	}{
+		{
+			name:        "the event bus name is required",
+			config:      Config{EventSourceName: "source", EventBridge: recordingEventBridge{}},
+			expectError: true,
+		},
+		{
+			name:        "the event source name is required",
+			config:      Config{EventBusName: "bus", EventBridge: recordingEventBridge{}},
+			expectError: true,
+		},
+		{
+			name:        "EventBridge, or another sink, is required",
+			config:      Config{EventBusName: "bus", EventSourceName: "source"},
+			expectError: true,
+		},
+		{
+			name:        "the SNS topic is required",
+			config:      Config{EventBusName: "bus", EventSourceName: "source", SNS: &mockSNS{}},
+			expectError: true,
+		},
+		{
+			name:        "the SQS queue is required",
+			config:      Config{EventBusName: "bus", EventSourceName: "source", SQS: &mockSQS{}},
+			expectError: true,
+		},
+		{
+			name:        "the dead letter queue URL is required",
+			config:      Config{EventBusName: "bus", EventSourceName: "source", EventBridge: recordingEventBridge{}, DeadLetterQueue: &mockDeadLetterQueue{}},
+			expectError: true,
+		},
+		{
+			name:        "the payload bucket is required",
+			config:      Config{EventBusName: "bus", EventSourceName: "source", EventBridge: recordingEventBridge{}, PayloadStore: memoryPayloadStore{}},
+			expectError: true,
+		},
+		{
+			name:        "the schedule target and role are required",
+			config:      Config{EventBusName: "bus", EventSourceName: "source", EventBridge: recordingEventBridge{}, Scheduler: recordingScheduler{}},
+			expectError: true,
+		},
+		{
+			name:   "handlers can publish to SNS instead of EventBridge without an event bus name",
+			config: Config{EventSourceName: "source", SNS: &mockSNS{}, SNSTopicARN: "arn:aws:sns:eu-west-1:123456789012:events", Log: zap.NewNop()},
+		},
+		{
+			name:   "handlers can be created",
+			config: Config{EventBusName: "bus", EventSourceName: "source", EventBridge: recordingEventBridge{}, Log: zap.NewNop()},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Act.
+			h, err := New(test.config)
+
+			// Assert.
+			if test.expectError {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if h.EventSourceName != "source" {
+				t.Errorf("expected the configuration to be used, got %q", h.EventSourceName)
+			}
+		})
+	}
+}
+
+// concurrencyEventBridge records the maximum number of concurrent PutEvents requests.
+type concurrencyEventBridge struct {
+	m        *sync.Mutex
+	inFlight *int
+	max      *int
+}
+
+func (c concurrencyEventBridge) PutEvents(ctx context.Context, input *eventbridge.PutEventsInput, _ ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	c.m.Lock()
+	*c.inFlight++
+	if *c.inFlight > *c.max {
+		*c.max = *c.inFlight
+	}
+	c.m.Unlock()
+	defer func() {
+		c.m.Lock()
+		*c.inFlight--
+		c.m.Unlock()
+	}()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(10 * time.Millisecond):
+	}
+	return accepted(input), nil
+}
+
+// manyOutboundRecords creates records for n entities.
+func manyOutboundRecords(n int) (event events.DynamoDBEvent) {
+	for i := 0; i < n; i++ {
+		r := outboundRecord("INSERT", "Normal", false)
+		r.Change.NewImage["_pk"] = events.NewStringAttribute(fmt.Sprintf("Payment/%03d", i))
+		event.Records = append(event.Records, r)
+	}
+	return
+}
+
+func TestMaxInFlightLimitsConcurrentBatches(t *testing.T) {
+	// Arrange.
+	var inFlight, max int
+	h := newTestHandler(Config{
+		EventBridge: concurrencyEventBridge{m: &sync.Mutex{}, inFlight: &inFlight, max: &max},
+		MaxInFlight: 2,
+	})
+
+	// Act.
+	err := h.HandleRequest(context.Background(), manyOutboundRecords(100))
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("failed to handle request: %v", err)
+	}
+	if max != 2 {
+		t.Errorf("expected 2 batches in flight, got %d", max)
+	}
+}
+
+func TestSendsRespectTheContext(t *testing.T) {
+	// Arrange.
+	var inFlight, max int
+	h := newTestHandler(Config{
+		EventBridge: concurrencyEventBridge{m: &sync.Mutex{}, inFlight: &inFlight, max: &max},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Act.
+	err := h.HandleRequest(ctx, manyOutboundRecords(10))
+
+	// Assert.
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the context to be cancelled, got %v", err)
+	}
+}
+
+func TestConfigFromEnvCreatesTheClientsOfConfiguredSinks(t *testing.T) {
+	var tests = []struct {
+		name    string
+		env     map[string]string
+		created func(c Config) bool
+	}{
+		{
+			name:    "SNS",
+			env:     map[string]string{"SNS_TOPIC_ARN": "arn:aws:sns:eu-west-1:123456789012:events"},
+			created: func(c Config) bool { return c.SNS != nil },
+		},
+		{
+			name:    "SQS",
+			env:     map[string]string{"SQS_QUEUE_URL": "https://sqs.eu-west-1.amazonaws.com/123456789012/events"},
+			created: func(c Config) bool { return c.SQS != nil },
+		},
+		{
+			name:    "Firehose",
+			env:     map[string]string{"FIREHOSE_DELIVERY_STREAM": "analytics"},
+			created: func(c Config) bool { return c.Firehose != nil },
+		},
+		{
+			name:    "Step Functions",
+			env:     map[string]string{"STATE_MACHINES": `{"OrderPlaced":"arn:aws:states:eu-west-1:123456789012:stateMachine:fulfilment"}`},
+			created: func(c Config) bool { return c.StepFunctions != nil && len(c.StateMachines) == 1 },
+		},
+		{
+			name:    "Lambda",
+			env:     map[string]string{"FUNCTIONS": `{"OrderPlaced":"fulfilment"}`},
+			created: func(c Config) bool { return c.Lambda != nil && len(c.Functions) == 1 },
+		},
+		{
+			name:    "IoT Core",
+			env:     map[string]string{"IOT_DATA_ENDPOINT": "https://abc123-ats.iot.eu-west-1.amazonaws.com", "REALTIME_CHANNEL_PREFIX": "stream/"},
+			created: func(c Config) bool { return c.Realtime != nil && c.RealtimeChannelPrefix == "stream/" },
+		},
+		{
+			name:    "EventBridge Scheduler",
+			env:     map[string]string{"SCHEDULE_TARGET_ARN": "arn:aws:lambda:eu-west-1:123456789012:function:deliver", "SCHEDULE_ROLE_ARN": "arn:aws:iam::123456789012:role/scheduler"},
+			created: func(c Config) bool { return c.Scheduler != nil && c.ScheduleRoleARN != "" },
+		},
+		{
+			name:    "S3 payload store",
+			env:     map[string]string{"PAYLOAD_BUCKET": "payloads"},
+			created: func(c Config) bool { return c.PayloadStore != nil && c.PayloadBucket == "payloads" },
+		},
+		{
+			name:    "SQS dead letter queue",
+			env:     map[string]string{"DEAD_LETTER_QUEUE_URL": "https://sqs.eu-west-1.amazonaws.com/123456789012/dead-letters"},
+			created: func(c Config) bool { return c.DeadLetterQueue != nil && c.DeadLetterQueueURL != "" },
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			t.Setenv("AWS_REGION", "eu-west-1")
+
+			// Act.
+			without, err := ConfigFromEnv(context.Background())
+			if err != nil {
+				t.Fatalf("failed to read config: %v", err)
+			}
+			for k, v := range test.env {
+				t.Setenv(k, v)
+			}
+			with, err := ConfigFromEnv(context.Background())
+			if err != nil {
+				t.Fatalf("failed to read config: %v", err)
+			}
+
+			// Assert.
+			if test.created(without) {
+				t.Error("expected the client not to be created without its environment variables")
+			}
+			if !test.created(with) {
+				t.Error("expected the client to be created")
+			}
+		})
+	}
+}
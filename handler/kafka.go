@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// KafkaAPI produces messages to Kafka topics, e.g. using a synchronous producer of a Kafka
+// client library, connected to MSK or Confluent, with the message's headers as record
+// headers.
+type KafkaAPI interface {
+	Produce(ctx context.Context, m KafkaMessage) error
+}
+
+// KafkaMessage is an outbound event, produced to a Kafka topic.
+type KafkaMessage struct {
+	Topic string
+	// Key is the entity's partition key, e.g. "Payment/123", so that the events of each
+	// entity are written to the same partition, in order.
+	Key string
+	// Value is the detail of the event.
+	Value string
+	// Headers of the message: the detailType and source of the event, and its eventId.
+	Headers map[string]string
+}
+
+// KafkaTopic returns the topic of an event, from the namespace of the entity that produced
+// it, and the event's DetailType.
+type KafkaTopic func(namespace, detailType string) string
+
+// TopicPerNamespace produces the events of each namespace to a topic named after it, with
+// the prefix, e.g. "events.Payment".
+func TopicPerNamespace(prefix string) KafkaTopic {
+	return func(namespace, detailType string) string {
+		return prefix + namespace
+	}
+}
+
+// TopicPerDetailType produces each type of event to a topic named after it, with the
+// prefix, e.g. "events.PaymentTaken".
+func TopicPerDetailType(prefix string) KafkaTopic {
+	return func(namespace, detailType string) string {
+		return prefix + detailType
+	}
+}
+
+// kafkaProduceFailure is the error code of events that couldn't be produced to Kafka.
+const kafkaProduceFailure = "KafkaProduceFailure"
+
+// publishKafka produces each event to the topic chosen by KafkaTopic.
+func (h *Handler) publishKafka(ctx context.Context, outboundEvents []outboundEvent) []types.PutEventsResultEntry {
+	return publishEach(outboundEvents, kafkaProduceFailure, func(e outboundEvent) (string, error) {
+		m := KafkaMessage{
+			Topic:   h.KafkaTopic(e.namespace, aws.ToString(e.entry.DetailType)),
+			Key:     e.position.pk,
+			Value:   aws.ToString(e.entry.Detail),
+			Headers: getAttributes(e),
+		}
+		return e.id, h.Kafka.Produce(ctx, m)
+	})
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockKafka struct {
+	produced []KafkaMessage
+}
+
+func (m *mockKafka) Produce(_ context.Context, msg KafkaMessage) error {
+	m.produced = append(m.produced, msg)
+	return nil
+}
+
+func TestKafka(t *testing.T) {
+	var tests = []struct {
+		name          string
+		topic         KafkaTopic
+		expectedTopic string
+	}{
+		{
+			name:          "events can be produced to a topic per namespace",
+			topic:         TopicPerNamespace("events."),
+			expectedTopic: "events.Payment",
+		},
+		{
+			name:          "events can be produced to a topic per detail type",
+			topic:         TopicPerDetailType("events."),
+			expectedTopic: "events.PaymentTaken",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			kafka := &mockKafka{}
+			h := newTestHandler(Config{
+				EventSourceName: "source",
+				Kafka:           kafka,
+				KafkaTopic:      test.topic,
+			})
+			event := events.DynamoDBEvent{
+				Records: []events.DynamoDBEventRecord{outboundRecord("INSERT", "PaymentTaken", false)},
+			}
+
+			// Act.
+			err := h.HandleRequest(context.Background(), event)
+
+			// Assert.
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			expected := []KafkaMessage{
+				{
+					Topic:   test.expectedTopic,
+					Key:     "Payment/id",
+					Value:   "{}",
+					Headers: map[string]string{"detailType": "PaymentTaken", "source": "source"},
+				},
+			}
+			if diff := cmp.Diff(expected, kafka.produced); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestKafkaTopicDefaultsToATopicPerNamespace(t *testing.T) {
+	// Act.
+	h, err := New(Config{EventBusName: "bus", EventSourceName: "source", Kafka: &mockKafka{}})
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if topic := h.KafkaTopic("Payment", "PaymentTaken"); topic != "Payment" {
+		t.Errorf("expected topic %q, got %q", "Payment", topic)
+	}
+}
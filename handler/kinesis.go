@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"go.uber.org/zap"
+)
+
+// StartKinesis configures the handler from the environment, see ConfigFromEnv, and starts
+// the Lambda function, reading the table's changes from Kinesis Data Streams for DynamoDB,
+// instead of DynamoDB Streams.
+func StartKinesis() {
+	initialize()
+	defaultHandler.Log.Info("starting kinesis handler")
+	lambda.Start(HandleKinesisRequest)
+}
+
+// HandleKinesisRequest publishes the outbound event records of the Kinesis event using the
+// handler configured by Start or StartKinesis.
+func HandleKinesisRequest(ctx context.Context, event events.KinesisEvent) error {
+	return defaultHandler.HandleKinesisRequest(ctx, event)
+}
+
+// HandleKinesisRequest publishes the outbound event records of a Kinesis Data Streams for
+// DynamoDB event. Kinesis can deliver a change more than once, so use a Deduplicator, or
+// leases, to avoid publishing duplicate events.
+func (h *Handler) HandleKinesisRequest(ctx context.Context, event events.KinesisEvent) error {
+	e, err := dynamoDBEventFromKinesis(event)
+	if err != nil {
+		h.Log.Error("failed to read kinesis records", zap.Error(err))
+		return err
+	}
+	return h.HandleRequest(ctx, e)
+}
+
+// kinesisChangeRecord is the data of a Kinesis Data Streams for DynamoDB record.
+type kinesisChangeRecord struct {
+	AWSRegion    string                      `json:"awsRegion"`
+	EventID      string                      `json:"eventID"`
+	EventName    string                      `json:"eventName"`
+	EventSource  string                      `json:"eventSource"`
+	TableName    string                      `json:"tableName"`
+	RecordFormat string                      `json:"recordFormat"`
+	Change       events.DynamoDBStreamRecord `json:"dynamodb"`
+}
+
+// kinesisCreationTime is the creation time of a Kinesis Data Streams for DynamoDB record.
+// Unlike DynamoDB Streams, which uses seconds, it's a Unix time in milliseconds, or in
+// microseconds if the stream's ApproximateCreationDateTimePrecision is MICROSECOND.
+type kinesisCreationTime struct {
+	Change struct {
+		ApproximateCreationDateTime          json.Number `json:"ApproximateCreationDateTime"`
+		ApproximateCreationDateTimePrecision string      `json:"ApproximateCreationDateTimePrecision"`
+	} `json:"dynamodb"`
+}
+
+// microsecondThreshold is the smallest Unix time in microseconds that's expected, i.e. the
+// year 1973. Times in milliseconds are smaller than this until the year 5138.
+const microsecondThreshold = 1e14
+
+// Time returns the creation time of the record, or the zero time if it isn't set.
+func (ct kinesisCreationTime) Time() (t time.Time, err error) {
+	if ct.Change.ApproximateCreationDateTime == "" {
+		return
+	}
+	v, err := ct.Change.ApproximateCreationDateTime.Int64()
+	if err != nil {
+		return
+	}
+	switch ct.Change.ApproximateCreationDateTimePrecision {
+	case "MICROSECOND":
+		t = time.UnixMicro(v)
+	case "MILLISECOND":
+		t = time.UnixMilli(v)
+	default:
+		if v >= microsecondThreshold {
+			t = time.UnixMicro(v)
+		} else {
+			t = time.UnixMilli(v)
+		}
+	}
+	return t.UTC(), nil
+}
+
+func dynamoDBEventFromKinesis(event events.KinesisEvent) (e events.DynamoDBEvent, err error) {
+	e.Records = make([]events.DynamoDBEventRecord, len(event.Records))
+	for i, r := range event.Records {
+		var cr kinesisChangeRecord
+		if err = json.Unmarshal(r.Kinesis.Data, &cr); err != nil {
+			err = fmt.Errorf("record %s: failed to unmarshal change: %w", r.EventID, err)
+			return
+		}
+		if cr.RecordFormat != "" && cr.RecordFormat != "application/json" {
+			err = fmt.Errorf("record %s: unsupported record format %q", r.EventID, cr.RecordFormat)
+			return
+		}
+		var ct kinesisCreationTime
+		if err = json.Unmarshal(r.Kinesis.Data, &ct); err != nil {
+			err = fmt.Errorf("record %s: failed to unmarshal creation time: %w", r.EventID, err)
+			return
+		}
+		var created time.Time
+		if created, err = ct.Time(); err != nil {
+			err = fmt.Errorf("record %s: invalid ApproximateCreationDateTime: %w", r.EventID, err)
+			return
+		}
+		cr.Change.ApproximateCreationDateTime = events.SecondsEpochTime{Time: created}
+		e.Records[i] = events.DynamoDBEventRecord{
+			AWSRegion:      cr.AWSRegion,
+			EventID:        cr.EventID,
+			EventName:      cr.EventName,
+			EventSource:    cr.EventSource,
+			EventSourceArn: tableARN(r.EventSourceArn, cr.AWSRegion, cr.TableName),
+			Change:         cr.Change,
+		}
+	}
+	return
+}
+
+// tableARN creates the ARN of the table, using the account of the Kinesis stream, so that
+// the table name can be read in the same way as from DynamoDB Streams records.
+func tableARN(streamARN, region, tableName string) string {
+	var account string
+	if parts := strings.Split(streamARN, ":"); len(parts) > 4 {
+		account = parts[4]
+	}
+	return fmt.Sprintf("arn:aws:dynamodb:%s:%s:table/%s", region, account, tableName)
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+const kinesisData = `{
+	"awsRegion": "eu-west-1",
+	"eventID": "8b2c7d5e-5a4e-4d4e-9d6b-7b2f1f2b0f1e",
+	"eventName": "INSERT",
+	"userIdentity": null,
+	"recordFormat": "application/json",
+	"tableName": "stream",
+	"dynamodb": {
+		"ApproximateCreationDateTime": 1668949200000,
+		"Keys": {"_pk": {"S": "Payment/id"}, "_sk": {"S": "OUTBOUND/1/0/PaymentTaken"}},
+		"NewImage": {
+			"_pk": {"S": "Payment/id"},
+			"_sk": {"S": "OUTBOUND/1/0/PaymentTaken"},
+			"_typ": {"S": "PaymentTaken"},
+			"amount": {"N": "10"}
+		},
+		"SizeBytes": 100
+	},
+	"eventSource": "aws:dynamodb"
+}`
+
+func TestKinesisRecordsArePublished(t *testing.T) {
+	// Arrange.
+	var sent []string
+	h := newTestHandler(Config{EventBridge: detailRecordingEventBridge{sent: &sent}})
+	event := events.KinesisEvent{
+		Records: []events.KinesisEventRecord{
+			{
+				EventID:        "shardId-000000000000:1",
+				EventSourceArn: "arn:aws:kinesis:eu-west-1:123456789012:stream/stream-changes",
+				Kinesis:        events.KinesisRecord{Data: []byte(kinesisData)},
+			},
+		},
+	}
+
+	// Act.
+	err := h.HandleKinesisRequest(context.Background(), event)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{`PaymentTaken {"amount":10}`}, sent); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestKinesisRecordsUseTheTableName(t *testing.T) {
+	// Arrange.
+	event := events.KinesisEvent{
+		Records: []events.KinesisEventRecord{
+			{
+				EventSourceArn: "arn:aws:kinesis:eu-west-1:123456789012:stream/stream-changes",
+				Kinesis:        events.KinesisRecord{Data: []byte(kinesisData)},
+			},
+		},
+	}
+
+	// Act.
+	e, err := dynamoDBEventFromKinesis(event)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if arn := e.Records[0].EventSourceArn; arn != "arn:aws:dynamodb:eu-west-1:123456789012:table/stream" {
+		t.Errorf("unexpected ARN %q", arn)
+	}
+	if name := tableNameFromStreamARN(e.Records[0].EventSourceArn); name != "stream" {
+		t.Errorf("expected table name %q, got %q", "stream", name)
+	}
+}
+
+func TestInvalidKinesisRecordsReturnAnError(t *testing.T) {
+	// Arrange.
+	h := newTestHandler(Config{})
+	event := events.KinesisEvent{
+		Records: []events.KinesisEventRecord{
+			{EventID: "1", Kinesis: events.KinesisRecord{Data: []byte("not json")}},
+		},
+	}
+
+	// Act.
+	err := h.HandleKinesisRequest(context.Background(), event)
+
+	// Assert.
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestKinesisRecordsUseTheCreationTimeUnit(t *testing.T) {
+	expected := time.Date(2022, time.November, 20, 13, 0, 0, 0, time.UTC)
+	var tests = []struct {
+		name     string
+		replace  string
+		expected time.Time
+	}{
+		{
+			name:     "milliseconds",
+			replace:  `"ApproximateCreationDateTime": 1668949200000`,
+			expected: expected,
+		},
+		{
+			name:     "microseconds",
+			replace:  `"ApproximateCreationDateTime": 1668949200000123`,
+			expected: expected.Add(123 * time.Microsecond),
+		},
+		{
+			name:     "explicit microsecond precision",
+			replace:  `"ApproximateCreationDateTime": 1668949200000123, "ApproximateCreationDateTimePrecision": "MICROSECOND"`,
+			expected: expected.Add(123 * time.Microsecond),
+		},
+		{
+			name:     "explicit millisecond precision",
+			replace:  `"ApproximateCreationDateTime": 1668949200000, "ApproximateCreationDateTimePrecision": "MILLISECOND"`,
+			expected: expected,
+		},
+		{
+			name:     "missing",
+			replace:  `"SizeBytes": 1`,
+			expected: time.Time{},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			data := strings.Replace(kinesisData, `"ApproximateCreationDateTime": 1668949200000`, test.replace, 1)
+			event := events.KinesisEvent{
+				Records: []events.KinesisEventRecord{
+					{Kinesis: events.KinesisRecord{Data: []byte(data)}},
+				},
+			}
+
+			// Act.
+			e, err := dynamoDBEventFromKinesis(event)
+
+			// Assert.
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual := e.Records[0].Change.ApproximateCreationDateTime.Time; !actual.Equal(test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
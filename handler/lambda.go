@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	awslambda "github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// LambdaAPI is the subset of the Lambda client used by the handler.
+type LambdaAPI interface {
+	Invoke(context.Context, *awslambda.InvokeInput, ...func(*awslambda.Options)) (*awslambda.InvokeOutput, error)
+}
+
+// lambdaFailure is the error code of events whose functions couldn't be invoked.
+const lambdaFailure = "LambdaFailure"
+
+// invokeFunctions asynchronously invokes the function of each event's DetailType, with an
+// EventBridge event as the payload, so that functions can also be triggered by EventBridge
+// rules. Events without a function are skipped.
+func (h *Handler) invokeFunctions(ctx context.Context, outboundEvents []outboundEvent) []types.PutEventsResultEntry {
+	return publishEach(outboundEvents, lambdaFailure, func(e outboundEvent) (string, error) {
+		detailType := aws.ToString(e.entry.DetailType)
+		functionName, ok := h.Functions[detailType]
+		if !ok {
+			return e.id, nil
+		}
+		ce := events.CloudWatchEvent{
+			Version:    "0",
+			ID:         e.id,
+			DetailType: detailType,
+			Source:     aws.ToString(e.entry.Source),
+			Time:       h.now(),
+			Resources:  e.entry.Resources,
+			Detail:     json.RawMessage(aws.ToString(e.entry.Detail)),
+		}
+		if e.entry.Time != nil {
+			ce.Time = *e.entry.Time
+		}
+		payload, err := json.Marshal(ce)
+		if err != nil {
+			return "", err
+		}
+		output, err := h.Lambda.Invoke(ctx, &awslambda.InvokeInput{
+			FunctionName:   aws.String(functionName),
+			InvocationType: lambdatypes.InvocationTypeEvent,
+			Payload:        payload,
+		})
+		if err != nil {
+			return "", err
+		}
+		if output.FunctionError != nil {
+			return "", fmt.Errorf("function %s: %s", functionName, aws.ToString(output.FunctionError))
+		}
+		return e.id, nil
+	})
+}
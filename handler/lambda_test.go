@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awslambda "github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockLambda struct {
+	invoked []string
+	events  []events.CloudWatchEvent
+}
+
+func (m *mockLambda) Invoke(_ context.Context, input *awslambda.InvokeInput, _ ...func(*awslambda.Options)) (*awslambda.InvokeOutput, error) {
+	if input.InvocationType != lambdatypes.InvocationTypeEvent {
+		return nil, fmt.Errorf("expected an asynchronous invocation, got %q", input.InvocationType)
+	}
+	var e events.CloudWatchEvent
+	if err := json.Unmarshal(input.Payload, &e); err != nil {
+		return nil, err
+	}
+	m.invoked = append(m.invoked, aws.ToString(input.FunctionName))
+	m.events = append(m.events, e)
+	return &awslambda.InvokeOutput{StatusCode: 202}, nil
+}
+
+func TestLambda(t *testing.T) {
+	// Arrange.
+	functions := &mockLambda{}
+	h := newTestHandler(Config{
+		EventSourceName: "source",
+		Lambda:          functions,
+		Functions:       map[string]string{"OrderPlaced": "fulfilment"},
+	})
+	placed := outboundRecord("INSERT", "OrderPlaced", false)
+	placed.Change.NewImage["_eventTime"] = events.NewStringAttribute("2022-11-20T13:00:00Z")
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{placed, outboundRecord("INSERT", "OrderViewed", false)},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"fulfilment"}, functions.invoked); diff != "" {
+		t.Error(diff)
+	}
+	e := functions.events[0]
+	if e.DetailType != "OrderPlaced" || e.Source != "source" || string(e.Detail) != "{}" {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if e.Time.Format("2006-01-02T15:04:05Z07:00") != "2022-11-20T13:00:00Z" {
+		t.Errorf("expected the event time, got %v", e.Time)
+	}
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.uber.org/zap"
+)
+
+// getLeaseDuration parses the LEASE_DURATION environment variable, e.g. "1m", see
+// Config.LeaseDuration.
+func getLeaseDuration(v string) (d time.Duration, err error) {
+	if v == "" {
+		return
+	}
+	d, err = time.ParseDuration(v)
+	if err != nil {
+		err = fmt.Errorf("invalid LEASE_DURATION: %w", err)
+	}
+	return
+}
+
+// claimAll returns the events that were claimed. Events that have already been dispatched,
+// or are leased by another invocation, are skipped.
+func (h *Handler) claimAll(ctx context.Context, outboundEvents []outboundEvent) (claimed []outboundEvent, err error) {
+	if h.LeaseDuration <= 0 {
+		return outboundEvents, nil
+	}
+	now := h.now()
+	for _, e := range outboundEvents {
+		if e.dispatch == nil {
+			claimed = append(claimed, e)
+			continue
+		}
+		var ok bool
+		ok, err = h.claim(ctx, e.dispatch, now)
+		if err != nil {
+			return
+		}
+		if !ok {
+			h.Log.Info("skipping event claimed by another invocation", zap.String("pk", e.dispatch.pk), zap.String("sk", e.dispatch.sk))
+			continue
+		}
+		e.dispatch.leased = true
+		claimed = append(claimed, e)
+	}
+	return
+}
+
+// claim the record, unless it has already been dispatched, or has an unexpired lease.
+func (h *Handler) claim(ctx context.Context, d *dispatchRecord, now time.Time) (ok bool, err error) {
+	_, err = h.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(d.tableName),
+		Key: map[string]dynamodbtypes.AttributeValue{
+			"_pk": &dynamodbtypes.AttributeValueMemberS{Value: d.pk},
+			"_sk": &dynamodbtypes.AttributeValueMemberS{Value: d.sk},
+		},
+		UpdateExpression:    aws.String("SET #_leaseExpires = :_expires"),
+		ConditionExpression: aws.String("attribute_exists(#_pk) AND attribute_not_exists(#_dispatchedAt) AND (attribute_not_exists(#_leaseExpires) OR #_leaseExpires < :_now)"),
+		ExpressionAttributeNames: map[string]string{
+			"#_pk":           "_pk",
+			"#_dispatchedAt": "_dispatchedAt",
+			"#_leaseExpires": "_leaseExpires",
+		},
+		ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+			":_now":     &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+			":_expires": &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(h.LeaseDuration).Unix(), 10)},
+		},
+	})
+	if err != nil {
+		var conditionFailed *dynamodbtypes.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to claim %s %s: %w", d.pk, d.sk, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+// leasingDynamoDB fails claims on records that have been claimed before, and records the
+// other updates.
+type leasingDynamoDB struct {
+	DynamoDBAPI
+	m       sync.Mutex
+	claimed map[string]bool
+	updates []string
+}
+
+func (m *leasingDynamoDB) UpdateItem(_ context.Context, input *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	sk := input.Key["_sk"].(*dynamodbtypes.AttributeValueMemberS).Value
+	expression := aws.ToString(input.UpdateExpression)
+	if strings.HasPrefix(expression, "SET #_leaseExpires") {
+		if m.claimed[sk] {
+			return nil, &dynamodbtypes.ConditionalCheckFailedException{}
+		}
+		m.claimed[sk] = true
+	}
+	m.updates = append(m.updates, sk+": "+expression)
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func TestLeasedEventsArePublishedOnce(t *testing.T) {
+	// Arrange.
+	var sent []string
+	db := &leasingDynamoDB{claimed: map[string]bool{"OUTBOUND/1/0/Claimed": true}}
+	h := newTestHandler(Config{
+		EventBridge:   failingEventBridge{fail: map[string]bool{"Failed": true}, sent: &sent},
+		DynamoDB:      db,
+		LeaseDuration: time.Minute,
+	})
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{
+			outboundRecord("INSERT", "Claimed", false),
+			outboundRecord("INSERT", "Normal", false),
+			outboundRecord("INSERT", "Failed", false),
+		},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if err == nil {
+		t.Error("expected an error for the failed entry")
+	}
+	if diff := cmp.Diff([]string{"Normal", "Failed"}, sent); diff != "" {
+		t.Errorf("expected events claimed by another invocation not to be sent: %s", diff)
+	}
+	expected := []string{
+		"OUTBOUND/1/0/Normal: SET #_leaseExpires = :_expires",
+		"OUTBOUND/1/0/Failed: SET #_leaseExpires = :_expires",
+		"OUTBOUND/1/0/Normal: SET #_dispatchedAt = :_now ADD #_dispatchAttempts :_one REMOVE #_dispatchError",
+		"OUTBOUND/1/0/Failed: SET #_dispatchError = :_error ADD #_dispatchAttempts :_one REMOVE #_leaseExpires",
+	}
+	if diff := cmp.Diff(expected, db.updates); diff != "" {
+		t.Errorf("unexpected updates: %s", diff)
+	}
+}
+
+func TestGetLeaseDuration(t *testing.T) {
+	if d, err := getLeaseDuration(""); err != nil || d != 0 {
+		t.Errorf("expected leases to be disabled by default, got %v, %v", d, err)
+	}
+	if d, err := getLeaseDuration("30s"); err != nil || d != 30*time.Second {
+		t.Errorf("expected 30s, got %v, %v", d, err)
+	}
+	if _, err := getLeaseDuration("soon"); err == nil {
+		t.Error("expected an error for an invalid duration")
+	}
+}
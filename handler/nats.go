@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// NATSAPI publishes messages to NATS JetStream, e.g. using the Publish method of a
+// JetStream context of the github.com/nats-io/nats.go client, and waits for the
+// acknowledgement.
+type NATSAPI interface {
+	Publish(ctx context.Context, m NATSMessage) error
+}
+
+// NATSMessage is an outbound event, published to a JetStream subject.
+type NATSMessage struct {
+	// Subject is "<namespace>.<DetailType>", e.g. "Payment.PaymentTaken", with the
+	// NATSSubjectPrefix.
+	Subject string
+	// Data is the detail of the event.
+	Data string
+	// Headers of the message: the detailType and source of the event, and its eventId. The
+	// event ID is also set as the Nats-Msg-Id header, so that JetStream deduplicates
+	// retries.
+	Headers map[string]string
+}
+
+// natsMsgIDHeader is the header used by JetStream to deduplicate messages.
+const natsMsgIDHeader = "Nats-Msg-Id"
+
+// natsPublishFailure is the error code of events that couldn't be published to NATS.
+const natsPublishFailure = "NATSPublishFailure"
+
+// publishNATS publishes each event to its JetStream subject.
+func (h *Handler) publishNATS(ctx context.Context, outboundEvents []outboundEvent) []types.PutEventsResultEntry {
+	return publishEach(outboundEvents, natsPublishFailure, func(e outboundEvent) (string, error) {
+		m := NATSMessage{
+			Subject: h.NATSSubjectPrefix + e.namespace + "." + aws.ToString(e.entry.DetailType),
+			Data:    aws.ToString(e.entry.Detail),
+			Headers: getAttributes(e),
+		}
+		if e.id != "" {
+			m.Headers[natsMsgIDHeader] = e.id
+		}
+		return e.id, h.NATS.Publish(ctx, m)
+	})
+}
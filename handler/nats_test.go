@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockNATS struct {
+	published []NATSMessage
+}
+
+func (m *mockNATS) Publish(_ context.Context, msg NATSMessage) error {
+	m.published = append(m.published, msg)
+	return nil
+}
+
+func TestNATS(t *testing.T) {
+	// Arrange.
+	nats := &mockNATS{}
+	h := newTestHandler(Config{
+		EventSourceName:   "source",
+		NATS:              nats,
+		NATSSubjectPrefix: "events.",
+		Metadata:          true,
+	})
+	r := outboundRecord("INSERT", "PaymentTaken", false)
+	r.Change.NewImage["_id"] = events.NewStringAttribute("01ARZ3NDEKTSV4RRFFQ69G5FAV")
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{r},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []NATSMessage{
+		{
+			Subject: "events.Payment.PaymentTaken",
+			Data:    `{"_metadata":{"eventId":"01ARZ3NDEKTSV4RRFFQ69G5FAV"}}`,
+			Headers: map[string]string{
+				"detailType":  "PaymentTaken",
+				"source":      "source",
+				"eventId":     "01ARZ3NDEKTSV4RRFFQ69G5FAV",
+				"Nats-Msg-Id": "01ARZ3NDEKTSV4RRFFQ69G5FAV",
+			},
+		},
+	}
+	if diff := cmp.Diff(expected, nats.published); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// position of an outbound record in the events produced by its entity.
+type position struct {
+	pk    string
+	seq   int64
+	index int
+}
+
+// getPosition returns the position from the _pk and _sk attributes of the record, where
+// the sort key is OUTBOUND/<seq>/<index>/<type>, or from the _seq attribute of STATE
+// records.
+func getPosition(r map[string]events.DynamoDBAttributeValue) (p position) {
+	if v, ok := r["_pk"]; ok && v.DataType() == events.DataTypeString {
+		p.pk = v.String()
+	}
+	v, ok := r["_sk"]
+	if !ok || v.DataType() != events.DataTypeString {
+		return
+	}
+	parts := strings.SplitN(v.String(), "/", 4)
+	if len(parts) < 3 {
+		// STATE records store their sequence in the _seq attribute.
+		if seq, ok := r["_seq"]; ok && seq.DataType() == events.DataTypeNumber {
+			p.seq, _ = strconv.ParseInt(seq.Number(), 10, 64)
+		}
+		return
+	}
+	p.seq, _ = strconv.ParseInt(parts[1], 10, 64)
+	p.index, _ = strconv.Atoi(parts[2])
+	return
+}
+
+func (p position) before(q position) bool {
+	if p.pk != q.pk {
+		return p.pk < q.pk
+	}
+	if p.seq != q.seq {
+		return p.seq < q.seq
+	}
+	return p.index < q.index
+}
+
+// sortByPosition sorts the events by entity, and then in the order that they were produced.
+func sortByPosition(outboundEvents []outboundEvent) {
+	sort.SliceStable(outboundEvents, func(i, j int) bool {
+		return outboundEvents[i].position.before(outboundEvents[j].position)
+	})
+}
+
+// chain consecutive batches that contain events of the same entity, so that they're sent in
+// sequence, instead of concurrently, and EventBridge receives the entity's events in order.
+// The batches must contain events sorted by position.
+func chain(batches [][]outboundEvent) (chains [][][]outboundEvent) {
+	for i, b := range batches {
+		if i > 0 && len(b) > 0 {
+			previous := batches[i-1]
+			if len(previous) > 0 && previous[len(previous)-1].position.pk == b[0].position.pk {
+				chains[len(chains)-1] = append(chains[len(chains)-1], b)
+				continue
+			}
+		}
+		chains = append(chains, [][]outboundEvent{b})
+	}
+	return
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+func sequencedRecord(pk string, seq, index int) events.DynamoDBEventRecord {
+	typ := fmt.Sprintf("%s/%d/%d", pk, seq, index)
+	r := outboundRecord("INSERT", typ, false)
+	r.Change.NewImage["_pk"] = events.NewStringAttribute(pk)
+	r.Change.NewImage["_sk"] = events.NewStringAttribute(fmt.Sprintf("OUTBOUND/%d/%d/Event", seq, index))
+	return r
+}
+
+func TestEventsAreSentInTheOrderTheyWereProduced(t *testing.T) {
+	// Arrange.
+	var sent []string
+	h := newTestHandler(Config{EventBridge: failingEventBridge{sent: &sent}})
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{
+			sequencedRecord("B", 2, 0),
+			sequencedRecord("A", 10, 1),
+			sequencedRecord("A", 2, 0),
+			sequencedRecord("B", 1, 0),
+			sequencedRecord("A", 10, 0),
+		},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("failed to handle request: %v", err)
+	}
+	expected := []string{"A/2/0", "A/10/0", "A/10/1", "B/1/0", "B/2/0"}
+	if diff := cmp.Diff(expected, sent); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestBatchesOfTheSameEntityAreNotSentConcurrently(t *testing.T) {
+	// Arrange.
+	var inFlight, max int
+	h := newTestHandler(Config{
+		EventBridge: concurrencyEventBridge{m: &sync.Mutex{}, inFlight: &inFlight, max: &max},
+	})
+	var event events.DynamoDBEvent
+	for i := 0; i < 30; i++ {
+		event.Records = append(event.Records, sequencedRecord("A", i, 0))
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("failed to handle request: %v", err)
+	}
+	if max != 1 {
+		t.Errorf("expected batches to be sent in sequence, got %d in flight", max)
+	}
+}
+
+func TestChain(t *testing.T) {
+	// Arrange.
+	e := func(pk string) outboundEvent { return outboundEvent{position: position{pk: pk}} }
+	batches := [][]outboundEvent{
+		{e("A"), e("A")},
+		{e("A"), e("B")},
+		{e("B")},
+		{e("C")},
+	}
+
+	// Act.
+	chains := chain(batches)
+
+	// Assert.
+	var sizes []int
+	for _, c := range chains {
+		sizes = append(sizes, len(c))
+	}
+	if diff := cmp.Diff([]int{3, 1}, sizes); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"github.com/a-h/stream"
+	"github.com/aws/aws-lambda-go/events"
+	"go.uber.org/multierr"
+)
+
+// getPriority returns the priority set by the stream.Prioritizer interface when the
+// outbound event was stored.
+func getPriority(r map[string]events.DynamoDBAttributeValue) stream.Priority {
+	v, ok := r["_priority"]
+	if !ok || v.DataType() != events.DataTypeNumber {
+		return stream.PriorityNormal
+	}
+	p, err := strconv.Atoi(v.Number())
+	if err != nil {
+		return stream.PriorityNormal
+	}
+	return stream.Priority(p)
+}
+
+// groupByPriority groups the events by priority, highest first. The order of events
+// within each group is kept. An event is never put in a group before an earlier event of
+// the same entity, so if the entity's earlier event has a lower priority, the event is
+// moved to the lower priority group, and consumers receive the entity's events in order.
+func groupByPriority(outboundEvents []outboundEvent) (groups [][]outboundEvent) {
+	// Walk each entity's events in the order that they were produced.
+	order := make([]int, len(outboundEvents))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return outboundEvents[order[i]].position.before(outboundEvents[order[j]].position)
+	})
+	groupPriority := make([]stream.Priority, len(outboundEvents))
+	lowest := make(map[string]stream.Priority)
+	for _, i := range order {
+		p, pk := outboundEvents[i].priority, outboundEvents[i].position.pk
+		if l, ok := lowest[pk]; ok && l < p && pk != "" {
+			p = l
+		}
+		lowest[pk] = p
+		groupPriority[i] = p
+	}
+	byPriority := make(map[stream.Priority][]outboundEvent)
+	var priorities []stream.Priority
+	for i, e := range outboundEvents {
+		p := groupPriority[i]
+		if _, ok := byPriority[p]; !ok {
+			priorities = append(priorities, p)
+		}
+		byPriority[p] = append(byPriority[p], e)
+	}
+	sort.Slice(priorities, func(i, j int) bool { return priorities[i] > priorities[j] })
+	for _, p := range priorities {
+		groups = append(groups, byPriority[p])
+	}
+	return
+}
+
+// sendByPriority sends the events in groups, highest priority first, so that they're not
+// delayed by bulk events. If a group fails, the later events of its entities aren't sent,
+// so that they're not received out of order.
+func (h *Handler) sendByPriority(ctx context.Context, outboundEvents []outboundEvent) error {
+	failed := make(map[string]bool)
+	var errors []error
+	for _, group := range groupByPriority(outboundEvents) {
+		var send []outboundEvent
+		for _, e := range group {
+			if !failed[e.position.pk] {
+				send = append(send, e)
+			}
+		}
+		if len(send) == 0 {
+			continue
+		}
+		if err := h.send(ctx, send); err != nil {
+			errors = append(errors, err)
+			for _, e := range send {
+				failed[e.position.pk] = true
+			}
+		}
+	}
+	return multierr.Combine(errors...)
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/google/go-cmp/cmp"
+)
+
+// recordingEventBridge records the detail type and bus of each event, in the order sent.
+type recordingEventBridge struct {
+	sent *[]string
+}
+
+func (m recordingEventBridge) PutEvents(_ context.Context, input *eventbridge.PutEventsInput, _ ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	for _, e := range input.Entries {
+		*m.sent = append(*m.sent, *e.EventBusName+"/"+*e.DetailType)
+	}
+	return accepted(input), nil
+}
+
+func prioritizedRecord(typ, priority string) events.DynamoDBEventRecord {
+	image := map[string]events.DynamoDBAttributeValue{
+		"_pk":  events.NewStringAttribute("Payment/id"),
+		"_sk":  events.NewStringAttribute("OUTBOUND/1/0/" + typ),
+		"_typ": events.NewStringAttribute(typ),
+	}
+	if priority != "" {
+		image["_priority"] = events.NewNumberAttribute(priority)
+	}
+	return events.DynamoDBEventRecord{
+		EventName: "INSERT",
+		Change:    events.DynamoDBStreamRecord{NewImage: image},
+	}
+}
+
+func withPK(r events.DynamoDBEventRecord, pk string) events.DynamoDBEventRecord {
+	r.Change.NewImage["_pk"] = events.NewStringAttribute(pk)
+	return r
+}
+
+func withSequence(r events.DynamoDBEventRecord, seq string) events.DynamoDBEventRecord {
+	r.Change.NewImage["_sk"] = events.NewStringAttribute("OUTBOUND/" + seq + "/0/" + r.Change.NewImage["_typ"].String())
+	return r
+}
+
+func TestHigherPriorityEventsAreSentFirst(t *testing.T) {
+	// Arrange.
+	var sent []string
+	h := newTestHandler(Config{
+		EventBridge:              recordingEventBridge{sent: &sent},
+		EventBusName:             "bus",
+		HighPriorityEventBusName: "priority",
+	})
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{
+			withPK(prioritizedRecord("Telemetry", "-1"), "Device/1"),
+			withPK(prioritizedRecord("OrderPlaced", ""), "Order/1"),
+			withPK(prioritizedRecord("PaymentAuthorized", "1"), "Payment/1"),
+			withPK(prioritizedRecord("OrderShipped", ""), "Order/2"),
+		},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("failed to handle request: %v", err)
+	}
+	expected := []string{"priority/PaymentAuthorized", "bus/OrderPlaced", "bus/OrderShipped", "bus/Telemetry"}
+	if diff := cmp.Diff(expected, sent); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestPriorityDoesNotReorderTheEventsOfAnEntity(t *testing.T) {
+	// Arrange.
+	var sent []string
+	h := newTestHandler(Config{
+		EventBridge:              recordingEventBridge{sent: &sent},
+		EventBusName:             "bus",
+		HighPriorityEventBusName: "priority",
+	})
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{
+			withSequence(prioritizedRecord("OrderPlaced", ""), "1"),
+			withSequence(prioritizedRecord("PaymentAuthorized", "1"), "2"),
+			withPK(prioritizedRecord("FraudDetected", "1"), "Payment/other"),
+		},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("failed to handle request: %v", err)
+	}
+	expected := []string{"priority/FraudDetected", "bus/OrderPlaced", "priority/PaymentAuthorized"}
+	if diff := cmp.Diff(expected, sent); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestLaterEventsOfAnEntityAreNotSentIfAHigherPriorityGroupFails(t *testing.T) {
+	// Arrange.
+	var sent []string
+	h := newTestHandler(Config{
+		EventBridge: failingEventBridge{fail: map[string]bool{"PaymentAuthorized": true}, sent: &sent},
+	})
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{
+			withSequence(prioritizedRecord("PaymentAuthorized", "1"), "1"),
+			withSequence(prioritizedRecord("OrderShipped", ""), "2"),
+			withPK(prioritizedRecord("OrderPlaced", ""), "Order/1"),
+		},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if err == nil {
+		t.Error("expected an error for the failed entry")
+	}
+	expected := []string{"PaymentAuthorized", "OrderPlaced"}
+	if diff := cmp.Diff(expected, sent); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/iotdataplane"
+)
+
+// RealtimeAPI is the subset of the IoT Core data plane client used by the handler to
+// publish messages to web and mobile clients over MQTT. websocket.Pusher implements it to
+// push messages to API Gateway WebSocket clients instead.
+type RealtimeAPI interface {
+	Publish(context.Context, *iotdataplane.PublishInput, ...func(*iotdataplane.Options)) (*iotdataplane.PublishOutput, error)
+}
+
+// RealtimeMessage is published for each outbound event.
+type RealtimeMessage struct {
+	ID         string          `json:"id,omitempty"`
+	DetailType string          `json:"detailType"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// realtimeFailure is the error code of events that couldn't be published to clients.
+const realtimeFailure = "RealtimeFailure"
+
+// publishRealtime publishes each event to the topic of the entity that produced it, i.e.
+// the RealtimeChannelPrefix followed by its partition key, e.g. "stream/SlotMachine/123",
+// so that clients can subscribe to the updates of an entity.
+func (h *Handler) publishRealtime(ctx context.Context, outboundEvents []outboundEvent) []types.PutEventsResultEntry {
+	return publishEach(outboundEvents, realtimeFailure, func(e outboundEvent) (string, error) {
+		payload, err := json.Marshal(RealtimeMessage{
+			ID:         e.id,
+			DetailType: aws.ToString(e.entry.DetailType),
+			Detail:     json.RawMessage(aws.ToString(e.entry.Detail)),
+		})
+		if err != nil {
+			return "", err
+		}
+		_, err = h.Realtime.Publish(ctx, &iotdataplane.PublishInput{
+			Topic:   aws.String(h.RealtimeChannelPrefix + e.position.pk),
+			Payload: payload,
+		})
+		return e.id, err
+	})
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iotdataplane"
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockRealtime struct {
+	published []string
+}
+
+func (m *mockRealtime) Publish(_ context.Context, input *iotdataplane.PublishInput, _ ...func(*iotdataplane.Options)) (*iotdataplane.PublishOutput, error) {
+	m.published = append(m.published, aws.ToString(input.Topic)+" "+string(input.Payload))
+	return &iotdataplane.PublishOutput{}, nil
+}
+
+func TestRealtime(t *testing.T) {
+	// Arrange.
+	realtime := &mockRealtime{}
+	h := newTestHandler(Config{
+		Realtime:              realtime,
+		RealtimeChannelPrefix: "stream/",
+	})
+	r := outboundRecord("INSERT", "CoinInserted", false)
+	r.Change.NewImage["_pk"] = events.NewStringAttribute("SlotMachine/123")
+	r.Change.NewImage["coins"] = events.NewNumberAttribute("1")
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{r},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{`stream/SlotMachine/123 {"detailType":"CoinInserted","detail":{"coins":1}}`}
+	if diff := cmp.Diff(expected, realtime.published); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// getRedactedFields returns the fields listed by the stream.Redactor interface when
+// the outbound event was stored.
+func getRedactedFields(r map[string]events.DynamoDBAttributeValue) (fields []string) {
+	v, ok := r["_redact"]
+	if !ok {
+		return
+	}
+	switch v.DataType() {
+	case events.DataTypeStringSet:
+		return v.StringSet()
+	case events.DataTypeString:
+		return []string{v.String()}
+	}
+	return
+}
+
+// redact removes the fields from the event, following dots into nested maps.
+func redact(m map[string]interface{}, fields []string) {
+	for _, f := range fields {
+		path := strings.Split(f, ".")
+		current := m
+		for i, name := range path {
+			if i == len(path)-1 {
+				delete(current, name)
+				break
+			}
+			next, ok := current[name].(map[string]interface{})
+			if !ok {
+				break
+			}
+			current = next
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// Relay publishes outbound events from the outbox index of a table, for environments that
+// can't use DynamoDB Streams and Lambda. The store must be configured with the
+// stream.WithOutbox option. Events are removed from the index once EventBridge has accepted
+// them, and failed events are retried on the next poll.
+type Relay struct {
+	TableName string
+	// IndexName of the global secondary index, with _outbox as the partition key, and _id
+	// as the sort key. The index must project all attributes.
+	IndexName string
+	// Outbox is the partition of the index to publish, see stream.DynamoDBStore.OutboxPartition.
+	Outbox string
+	// BatchSize is the maximum number of events to publish in each poll. Defaults to 100.
+	BatchSize int32
+	// PollInterval is the time to wait after a poll that didn't find any events, or failed.
+	// Defaults to 1 second.
+	PollInterval time.Duration
+	// Handler publishes the events. Defaults to the handler configured from the environment
+	// by StartRelay.
+	Handler *Handler
+}
+
+// StartRelay configures the relay from the same environment variables as Start, and runs
+// it until the process is stopped.
+func StartRelay(r Relay) {
+	initialize()
+	log := defaultHandler.Log
+	log.Info("starting relay", zap.String("table", r.TableName), zap.String("outbox", r.Outbox))
+	if err := r.Run(context.Background()); err != nil {
+		log.Fatal("relay failed", zap.Error(err))
+	}
+}
+
+func (r Relay) handler() *Handler {
+	if r.Handler != nil {
+		return r.Handler
+	}
+	return defaultHandler
+}
+
+// Run polls the outbox until the context is cancelled.
+func (r Relay) Run(ctx context.Context) error {
+	interval := r.PollInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+	for {
+		n, err := r.Poll(ctx)
+		if err != nil {
+			r.handler().Log.Error("failed to poll outbox", zap.Error(err))
+		}
+		if n > 0 && err == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Poll publishes the oldest events in the outbox, and returns the number of events that
+// were published. Events dropped by a transform are removed from the outbox. Events that
+// can't be converted to an EventBridge entry, e.g. because they can't be decrypted, are
+// sent to the DeadLetterQueue, if there is one, and removed from the outbox with their
+// dispatch error recorded, so that they don't block the events behind them.
+func (r Relay) Poll(ctx context.Context) (n int, err error) {
+	batchSize := r.BatchSize
+	if batchSize == 0 {
+		batchSize = 100
+	}
+	h := r.handler()
+	qo, err := h.DynamoDB.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(r.TableName),
+		IndexName:              aws.String(r.IndexName),
+		KeyConditionExpression: aws.String("#_outbox = :_outbox"),
+		ExpressionAttributeNames: map[string]string{
+			"#_outbox": "_outbox",
+		},
+		ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+			":_outbox": &dynamodbtypes.AttributeValueMemberS{Value: r.Outbox},
+		},
+		Limit: aws.Int32(batchSize),
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to query outbox: %w", err)
+		return
+	}
+	var outboundEvents []outboundEvent
+	var errors []error
+	for _, item := range qo.Items {
+		var image map[string]events.DynamoDBAttributeValue
+		image, err = toStreamImage(item)
+		if err != nil {
+			return
+		}
+		_, pending := image["_pending"]
+		d := &dispatchRecord{
+			tableName: r.TableName,
+			pk:        image["_pk"].String(),
+			sk:        image["_sk"].String(),
+			pending:   pending,
+			outbox:    true,
+		}
+		priority := getPriority(image)
+		position := getPosition(image)
+		eventID := getEventID(image)
+		typ := image["_typ"].String()
+		_, _, entry, createErr := h.createOutboundEvent(ctx, r.TableName, image)
+		if createErr != nil {
+			errors = append(errors, r.skip(ctx, d, eventID, typ, position, createErr))
+			continue
+		}
+		if entry == nil {
+			if err = h.removeFromOutbox(ctx, d, ""); err != nil {
+				return
+			}
+			continue
+		}
+		outboundEvents = append(outboundEvents, outboundEvent{entry: *entry, dispatch: d, priority: priority, position: position, id: eventID})
+	}
+	errors = append(errors, h.sendByPriority(ctx, outboundEvents))
+	for _, e := range outboundEvents {
+		if e.dispatch.dispatched {
+			n++
+		}
+	}
+	err = multierr.Combine(errors...)
+	return
+}
+
+// skip an event that can't be published, by sending it to the DeadLetterQueue, if there is
+// one, and removing it from the outbox. If the dead letter can't be sent, the event is left
+// in the outbox to be retried.
+func (r Relay) skip(ctx context.Context, d *dispatchRecord, eventID, typ string, p position, cause error) error {
+	h := r.handler()
+	failure := fmt.Sprintf("failed to create outbound event: %v", cause)
+	h.Log.Error("skipping outbox event", zap.String("pk", d.pk), zap.String("sk", d.sk), zap.Error(cause))
+	letter := DeadLetter{
+		ID:           eventID,
+		PK:           p.pk,
+		DetailType:   typ,
+		ErrorMessage: failure,
+		FailedAt:     h.now(),
+	}
+	if err := h.deadLetter(ctx, 0, []DeadLetter{letter}, nil); err != nil {
+		return err
+	}
+	return h.removeFromOutbox(ctx, d, failure)
+}
+
+// toStreamImage converts an item read from the table to a DynamoDB stream image.
+func toStreamImage(item map[string]dynamodbtypes.AttributeValue) (image map[string]events.DynamoDBAttributeValue, err error) {
+	image = make(map[string]events.DynamoDBAttributeValue, len(item))
+	for k, v := range item {
+		image[k], err = toStreamAttribute(v)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func toStreamAttribute(av dynamodbtypes.AttributeValue) (events.DynamoDBAttributeValue, error) {
+	switch v := av.(type) {
+	case *dynamodbtypes.AttributeValueMemberB:
+		return events.NewBinaryAttribute(v.Value), nil
+	case *dynamodbtypes.AttributeValueMemberBOOL:
+		return events.NewBooleanAttribute(v.Value), nil
+	case *dynamodbtypes.AttributeValueMemberBS:
+		return events.NewBinarySetAttribute(v.Value), nil
+	case *dynamodbtypes.AttributeValueMemberL:
+		list := make([]events.DynamoDBAttributeValue, len(v.Value))
+		for i := range v.Value {
+			var err error
+			if list[i], err = toStreamAttribute(v.Value[i]); err != nil {
+				return events.DynamoDBAttributeValue{}, err
+			}
+		}
+		return events.NewListAttribute(list), nil
+	case *dynamodbtypes.AttributeValueMemberM:
+		m, err := toStreamImage(v.Value)
+		if err != nil {
+			return events.DynamoDBAttributeValue{}, err
+		}
+		return events.NewMapAttribute(m), nil
+	case *dynamodbtypes.AttributeValueMemberN:
+		return events.NewNumberAttribute(v.Value), nil
+	case *dynamodbtypes.AttributeValueMemberNS:
+		return events.NewNumberSetAttribute(v.Value), nil
+	case *dynamodbtypes.AttributeValueMemberNULL:
+		return events.NewNullAttribute(), nil
+	case *dynamodbtypes.AttributeValueMemberS:
+		return events.NewStringAttribute(v.Value), nil
+	case *dynamodbtypes.AttributeValueMemberSS:
+		return events.NewStringSetAttribute(v.Value), nil
+	}
+	return events.DynamoDBAttributeValue{}, fmt.Errorf("unsupported attribute type %T", av)
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+// outboxDynamoDB returns the items from the outbox index, and records updates.
+type outboxDynamoDB struct {
+	*updateRecordingDynamoDB
+	items []map[string]dynamodbtypes.AttributeValue
+	query *dynamodb.QueryInput
+}
+
+func (m *outboxDynamoDB) Query(_ context.Context, input *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	m.query = input
+	return &dynamodb.QueryOutput{Items: m.items}, nil
+}
+
+func outboxItem(typ string) map[string]dynamodbtypes.AttributeValue {
+	return map[string]dynamodbtypes.AttributeValue{
+		"_pk":     &dynamodbtypes.AttributeValueMemberS{Value: "Payment/id"},
+		"_sk":     &dynamodbtypes.AttributeValueMemberS{Value: "OUTBOUND/1/0/" + typ},
+		"_typ":    &dynamodbtypes.AttributeValueMemberS{Value: typ},
+		"_outbox": &dynamodbtypes.AttributeValueMemberS{Value: "Payment/"},
+		"amount":  &dynamodbtypes.AttributeValueMemberN{Value: "1"},
+	}
+}
+
+func TestRelayPublishesOutboxEvents(t *testing.T) {
+	// Arrange.
+	var sent []string
+	db := &outboxDynamoDB{
+		updateRecordingDynamoDB: &updateRecordingDynamoDB{updates: map[string]string{}, errors: map[string]string{}},
+		items:                   []map[string]dynamodbtypes.AttributeValue{outboxItem("PaymentTaken"), outboxItem("Failed")},
+	}
+	h := newTestHandler(Config{
+		EventBridge: failingEventBridge{fail: map[string]bool{"Failed": true}, sent: &sent},
+		DynamoDB:    db,
+	})
+	r := Relay{TableName: "stream", IndexName: "outbox", Outbox: "Payment/", Handler: h}
+
+	// Act.
+	n, err := r.Poll(context.Background())
+
+	// Assert.
+	if err == nil {
+		t.Error("expected an error for the failed entry")
+	}
+	if n != 1 {
+		t.Errorf("expected 1 event to be published, got %d", n)
+	}
+	if aws.ToString(db.query.IndexName) != "outbox" {
+		t.Errorf("expected the outbox index to be queried, got %q", aws.ToString(db.query.IndexName))
+	}
+	if diff := cmp.Diff([]string{"PaymentTaken", "Failed"}, sent); diff != "" {
+		t.Errorf("unexpected events sent: %s", diff)
+	}
+	expected := map[string]string{
+		"OUTBOUND/1/0/PaymentTaken": "SET #_dispatchedAt = :_now ADD #_dispatchAttempts :_one REMOVE #_dispatchError, #_outbox",
+		"OUTBOUND/1/0/Failed":       "SET #_dispatchError = :_error ADD #_dispatchAttempts :_one",
+	}
+	if diff := cmp.Diff(expected, db.updates); diff != "" {
+		t.Errorf("unexpected updates: %s", diff)
+	}
+}
+
+func TestRelayRemovesDroppedAndPoisonEventsFromTheOutbox(t *testing.T) {
+	// Arrange.
+	var sent []string
+	poison := outboxItem("Poison")
+	poison["_fmt"] = &dynamodbtypes.AttributeValueMemberS{Value: "99.0"}
+	db := &outboxDynamoDB{
+		updateRecordingDynamoDB: &updateRecordingDynamoDB{updates: map[string]string{}, errors: map[string]string{}},
+		items:                   []map[string]dynamodbtypes.AttributeValue{outboxItem("Dropped"), poison, outboxItem("PaymentTaken")},
+	}
+	dlq := &mockDeadLetterQueue{}
+	h := newTestHandler(Config{
+		EventBridge:     failingEventBridge{sent: &sent},
+		DynamoDB:        db,
+		DeadLetterQueue: dlq,
+		Transforms: []Transform{func(e *types.PutEventsRequestEntry) (*types.PutEventsRequestEntry, error) {
+			if aws.ToString(e.DetailType) == "Dropped" {
+				return nil, nil
+			}
+			return e, nil
+		}},
+	})
+	r := Relay{TableName: "stream", IndexName: "outbox", Outbox: "Payment/", Handler: h}
+
+	// Act.
+	n, err := r.Poll(context.Background())
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 event to be published, got %d", n)
+	}
+	if diff := cmp.Diff([]string{"PaymentTaken"}, sent); diff != "" {
+		t.Errorf("unexpected events sent: %s", diff)
+	}
+	expected := map[string]string{
+		"OUTBOUND/1/0/Dropped":      "REMOVE #_outbox",
+		"OUTBOUND/1/0/Poison":       "SET #_dispatchError = :_error ADD #_dispatchAttempts :_one REMOVE #_outbox",
+		"OUTBOUND/1/0/PaymentTaken": "SET #_dispatchedAt = :_now ADD #_dispatchAttempts :_one REMOVE #_dispatchError, #_outbox",
+	}
+	if diff := cmp.Diff(expected, db.updates); diff != "" {
+		t.Errorf("unexpected updates: %s", diff)
+	}
+	if len(dlq.letters) != 1 || dlq.letters[0].DetailType != "Poison" {
+		t.Errorf("expected the poison event to be dead lettered, got %+v", dlq.letters)
+	}
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+const (
+	defaultMaxRetries   = 3
+	defaultRetryBackoff = 100 * time.Millisecond
+)
+
+// retryableErrorCodes are the PutEvents entry error codes that can succeed if retried, and
+// the error codes of the sinks. An event is only retried against the targets that failed.
+var retryableErrorCodes = map[string]bool{
+	"ThrottlingException": true,
+	"InternalFailure":     true,
+	snsPublishFailure:     true,
+	sqsSendFailure:        true,
+	kafkaProduceFailure:   true,
+	natsPublishFailure:    true,
+	webhookFailure:        true,
+	firehoseFailure:       true,
+	stepFunctionsFailure:  true,
+	lambdaFailure:         true,
+	realtimeFailure:       true,
+}
+
+// missingResultEntry is the result of an entry that PutEvents didn't return a result for.
+// It's retried, because it's not known whether the entry was accepted.
+var missingResultEntry = types.PutEventsResultEntry{
+	ErrorCode:    aws.String("InternalFailure"),
+	ErrorMessage: aws.String("no result was returned for the entry"),
+}
+
+func isRetryable(entry types.PutEventsResultEntry) bool {
+	return retryableErrorCodes[aws.ToString(entry.ErrorCode)]
+}
+
+// backoff returns the time to wait before the retry, doubling for each attempt.
+func (h *Handler) backoff(attempt int) time.Duration {
+	return h.RetryBackoff << attempt
+}
+
+// sleep for the duration, or until the context is cancelled.
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+// throttlingEventBridge rejects entries with the given error codes for the given number of
+// attempts. Entries with the code "Missing" are left out of the result, which must only be
+// used for the last entry.
+type throttlingEventBridge struct {
+	m        *sync.Mutex
+	codes    map[string]string
+	failures map[string]int
+	sent     *[]string
+}
+
+func (m throttlingEventBridge) PutEvents(_ context.Context, input *eventbridge.PutEventsInput, _ ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	var output eventbridge.PutEventsOutput
+	for _, e := range input.Entries {
+		*m.sent = append(*m.sent, *e.DetailType)
+		if m.failures[*e.DetailType] > 0 {
+			m.failures[*e.DetailType]--
+			if m.codes[*e.DetailType] == "Missing" {
+				continue
+			}
+			output.Entries = append(output.Entries, types.PutEventsResultEntry{ErrorCode: aws.String(m.codes[*e.DetailType])})
+			output.FailedEntryCount++
+			continue
+		}
+		output.Entries = append(output.Entries, types.PutEventsResultEntry{EventId: aws.String("id")})
+	}
+	return &output, nil
+}
+
+func TestRetryableEntriesAreRetried(t *testing.T) {
+	var tests = []struct {
+		name         string
+		codes        map[string]string
+		failures     map[string]int
+		expectedSent []string
+		expectError  bool
+	}{
+		{
+			name:         "throttled entries are retried until they succeed",
+			codes:        map[string]string{"Throttled": "ThrottlingException"},
+			failures:     map[string]int{"Throttled": 2},
+			expectedSent: []string{"Normal", "Throttled", "Throttled", "Throttled"},
+		},
+		{
+			name:         "entries are retried up to the maximum number of retries",
+			codes:        map[string]string{"Throttled": "InternalFailure"},
+			failures:     map[string]int{"Throttled": 5},
+			expectedSent: []string{"Normal", "Throttled", "Throttled", "Throttled", "Throttled"},
+			expectError:  true,
+		},
+		{
+			name:         "entries without a result are retried",
+			codes:        map[string]string{"Throttled": "Missing"},
+			failures:     map[string]int{"Throttled": 1},
+			expectedSent: []string{"Normal", "Throttled", "Throttled"},
+		},
+		{
+			name:         "entries that fail with other errors are not retried",
+			codes:        map[string]string{"Throttled": "MalformedDetail"},
+			failures:     map[string]int{"Throttled": 1},
+			expectedSent: []string{"Normal", "Throttled"},
+			expectError:  true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			var sent []string
+			h := newTestHandler(Config{
+				EventBridge: throttlingEventBridge{m: &sync.Mutex{}, codes: test.codes, failures: test.failures, sent: &sent},
+				MaxRetries:  3,
+			})
+			event := events.DynamoDBEvent{
+				Records: []events.DynamoDBEventRecord{
+					outboundRecord("INSERT", "Normal", false),
+					outboundRecord("INSERT", "Throttled", false),
+				},
+			}
+
+			// Act.
+			err := h.HandleRequest(context.Background(), event)
+
+			// Assert.
+			if test.expectError && err == nil {
+				t.Error("expected an error")
+			}
+			if !test.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(test.expectedSent, sent); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestSinkFailuresAreOnlyRetriedAgainstTheFailedSink(t *testing.T) {
+	// Arrange.
+	var sent []string
+	topic := &mockSNS{}
+	queue := &mockSQS{failures: 1}
+	h := newTestHandler(Config{
+		EventSourceName: "source",
+		EventBridge:     failingEventBridge{sent: &sent},
+		SNS:             topic,
+		SNSTopicARN:     "arn:aws:sns:eu-west-1:123456789012:events",
+		SQS:             queue,
+		SQSQueueURL:     "https://sqs.eu-west-1.amazonaws.com/123456789012/events",
+		MaxRetries:      3,
+	})
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{outboundRecord("INSERT", "Normal", false)},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"Normal"}, sent); diff != "" {
+		t.Errorf("unexpected EventBridge events: %s", diff)
+	}
+	if len(topic.published) != 1 {
+		t.Errorf("expected 1 SNS message, got %d", len(topic.published))
+	}
+	if len(queue.sent) != 1 {
+		t.Errorf("expected 1 SQS message, got %d", len(queue.sent))
+	}
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"github.com/a-h/stream"
+)
+
+// Router chooses the event bus and source of an outbound event from its type and metadata,
+// e.g. to send the events of each tenant to a tenant-specific bus. Empty return values use
+// the defaults.
+type Router func(eventType string, metadata map[string]string) (eventBusName, source string)
+
+// Route sends events that match its Namespace and DetailType to its EventBusName, with its
+// Source. Empty Namespace and DetailType fields match all events, and empty EventBusName
+// and Source fields use the defaults.
+type Route struct {
+	// Namespace of the entity that produced the event, e.g. "Order".
+	Namespace string `json:"namespace"`
+	// DetailType is the name of the event, e.g. "OrderPlaced".
+	DetailType   string `json:"detailType"`
+	EventBusName string `json:"eventBusName"`
+	Source       string `json:"source"`
+}
+
+func (r Route) matches(namespace, eventType string) bool {
+	return (r.Namespace == "" || r.Namespace == namespace) && (r.DetailType == "" || r.DetailType == eventType)
+}
+
+// SetRouter configures the handler started by Start to route outbound events with the
+// router. Call it before Start. Handlers created with New use Config.Router.
+func SetRouter(r Router) {
+	router = r
+}
+
+// route returns the event bus and source of an outbound event. Values set by the event take
+// precedence over the router, which takes precedence over the first matching route, the
+// HighPriorityEventBusName and the defaults.
+func (h *Handler) route(eventType, namespace string, metadata map[string]string, priority stream.Priority, fields eventBridgeFields) (busName, source string) {
+	busName, source = h.EventBusName, h.EventSourceName
+	if priority > stream.PriorityNormal && h.HighPriorityEventBusName != "" {
+		busName = h.HighPriorityEventBusName
+	}
+	for _, r := range h.Routes {
+		if r.matches(namespace, eventType) {
+			busName, source = override(busName, source, r.EventBusName, r.Source)
+			break
+		}
+	}
+	if h.Router != nil {
+		routedBusName, routedSource := h.Router(eventType, metadata)
+		busName, source = override(busName, source, routedBusName, routedSource)
+	}
+	return override(busName, source, fields.eventBusName, fields.source)
+}
+
+// override the bus and source with the values that aren't empty.
+func override(busName, source, withBusName, withSource string) (string, string) {
+	if withBusName != "" {
+		busName = withBusName
+	}
+	if withSource != "" {
+		source = withSource
+	}
+	return busName, source
+}
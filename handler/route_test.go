@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/a-h/stream"
+)
+
+func TestRoute(t *testing.T) {
+	tenantRouter := func(eventType string, metadata map[string]string) (eventBusName, source string) {
+		if metadata["tenant"] == "" {
+			return
+		}
+		return "tenant-" + metadata["tenant"], ""
+	}
+	var tests = []struct {
+		name           string
+		router         Router
+		metadata       map[string]string
+		priority       stream.Priority
+		fields         eventBridgeFields
+		expectedBus    string
+		expectedSource string
+	}{
+		{
+			name:           "events use the default bus and source",
+			expectedBus:    "default",
+			expectedSource: "source",
+		},
+		{
+			name:           "high priority events use the high priority bus",
+			priority:       stream.PriorityHigh,
+			expectedBus:    "high",
+			expectedSource: "source",
+		},
+		{
+			name:           "the router overrides the bus",
+			router:         tenantRouter,
+			metadata:       map[string]string{"tenant": "a"},
+			priority:       stream.PriorityHigh,
+			expectedBus:    "tenant-a",
+			expectedSource: "source",
+		},
+		{
+			name:           "empty values returned by the router use the defaults",
+			router:         tenantRouter,
+			expectedBus:    "default",
+			expectedSource: "source",
+		},
+		{
+			name:           "events override the router",
+			router:         tenantRouter,
+			metadata:       map[string]string{"tenant": "a"},
+			fields:         eventBridgeFields{eventBusName: "shared", source: "billing"},
+			expectedBus:    "shared",
+			expectedSource: "billing",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			h := newTestHandler(Config{
+				EventBusName:             "default",
+				EventSourceName:          "source",
+				HighPriorityEventBusName: "high",
+				Router:                   test.router,
+			})
+
+			// Act.
+			bus, source := h.route("TenantInvoiced", "Billing", test.metadata, test.priority, test.fields)
+
+			// Assert.
+			if bus != test.expectedBus || source != test.expectedSource {
+				t.Errorf("expected %q, %q, got %q, %q", test.expectedBus, test.expectedSource, bus, source)
+			}
+		})
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	routes := []Route{
+		{Namespace: "Order", DetailType: "OrderPlaced", EventBusName: "org", Source: "orders"},
+		{Namespace: "Order", EventBusName: "private"},
+		{DetailType: "AuditLogged", EventBusName: "audit"},
+	}
+	var tests = []struct {
+		namespace      string
+		eventType      string
+		expectedBus    string
+		expectedSource string
+	}{
+		{namespace: "Order", eventType: "OrderPlaced", expectedBus: "org", expectedSource: "orders"},
+		{namespace: "Order", eventType: "OrderPacked", expectedBus: "private", expectedSource: "source"},
+		{namespace: "Payment", eventType: "AuditLogged", expectedBus: "audit", expectedSource: "source"},
+		{namespace: "Payment", eventType: "PaymentTaken", expectedBus: "default", expectedSource: "source"},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.namespace+"/"+test.eventType, func(t *testing.T) {
+			// Arrange.
+			h := newTestHandler(Config{
+				EventBusName:    "default",
+				EventSourceName: "source",
+				Routes:          routes,
+			})
+
+			// Act.
+			bus, source := h.route(test.eventType, test.namespace, nil, stream.PriorityNormal, eventBridgeFields{})
+
+			// Assert.
+			if bus != test.expectedBus || source != test.expectedSource {
+				t.Errorf("expected %q, %q, got %q, %q", test.expectedBus, test.expectedSource, bus, source)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/scheduler"
+	schedulertypes "github.com/aws/aws-sdk-go-v2/service/scheduler/types"
+)
+
+// SchedulerAPI is the subset of the EventBridge Scheduler client used by the handler.
+type SchedulerAPI interface {
+	CreateSchedule(context.Context, *scheduler.CreateScheduleInput, ...func(*scheduler.Options)) (*scheduler.CreateScheduleOutput, error)
+}
+
+// Schedule to deliver an inbound event to an entity.
+type Schedule struct {
+	// Name of the schedule, derived from the ID of the outbound event, so that retries
+	// don't create duplicate schedules.
+	Name string
+	// At is the time to deliver the event.
+	At time.Time
+	// Input is the JSON to pass to the schedule's target, containing the namespace, id,
+	// type and event fields of the stream.ScheduledEvent.
+	Input string
+}
+
+// Expression returns the EventBridge Scheduler expression for the time, e.g.
+// "at(2022-11-20T13:00:00)". Schedule times are in UTC.
+func (s Schedule) Expression() string {
+	return "at(" + s.At.UTC().Format("2006-01-02T15:04:05") + ")"
+}
+
+// SetScheduler configures the handler started by Start to create schedules with the
+// client, instead of the one that ConfigFromEnv creates. The SCHEDULE_TARGET_ARN and
+// SCHEDULE_ROLE_ARN environment variables must be set. Call it before Start. Handlers
+// created with New use Config.Scheduler.
+func SetScheduler(s SchedulerAPI) {
+	schedulerClient = s
+}
+
+// schedule creates a one-time schedule that passes the input to the ScheduleTargetARN at
+// the time of the schedule. If the schedule already exists, e.g. because the stream batch
+// is being retried, it isn't created again.
+func (h *Handler) schedule(ctx context.Context, s Schedule) (err error) {
+	input := &scheduler.CreateScheduleInput{
+		Name:                       aws.String(s.Name),
+		ScheduleExpression:         aws.String(s.Expression()),
+		ScheduleExpressionTimezone: aws.String("UTC"),
+		FlexibleTimeWindow:         &schedulertypes.FlexibleTimeWindow{Mode: schedulertypes.FlexibleTimeWindowModeOff},
+		Target: &schedulertypes.Target{
+			Arn:     aws.String(h.ScheduleTargetARN),
+			RoleArn: aws.String(h.ScheduleRoleARN),
+			Input:   aws.String(s.Input),
+		},
+	}
+	if h.ScheduleGroupName != "" {
+		input.GroupName = aws.String(h.ScheduleGroupName)
+	}
+	_, err = h.Scheduler.CreateSchedule(ctx, input)
+	var conflict *schedulertypes.ConflictException
+	if errors.As(err, &conflict) {
+		return nil
+	}
+	return
+}
+
+// createSchedule creates a Schedule from the detail of a stream.ScheduledEvent.
+func (h *Handler) createSchedule(detail string) (s Schedule, err error) {
+	var e struct {
+		Namespace string            `json:"namespace"`
+		ID        string            `json:"id"`
+		At        time.Time         `json:"at"`
+		Type      string            `json:"type"`
+		Event     json.RawMessage   `json:"event"`
+		Metadata  map[string]string `json:"_metadata"`
+	}
+	var ce struct {
+		ID   string          `json:"id"`
+		Data json.RawMessage `json:"data"`
+	}
+	if h.CloudEvents {
+		if err = json.Unmarshal([]byte(detail), &ce); err != nil {
+			return s, fmt.Errorf("failed to decode scheduled event: %w", err)
+		}
+		detail = string(ce.Data)
+	}
+	if err = json.Unmarshal([]byte(detail), &e); err != nil {
+		return s, fmt.Errorf("failed to decode scheduled event: %w", err)
+	}
+	if h.CloudEvents {
+		e.Metadata = map[string]string{"eventId": ce.ID}
+	}
+	if e.Metadata["eventId"] == "" {
+		return s, fmt.Errorf("scheduled event has no event ID")
+	}
+	input, err := json.Marshal(map[string]interface{}{
+		"namespace": e.Namespace,
+		"id":        e.ID,
+		"type":      e.Type,
+		"event":     e.Event,
+	})
+	if err != nil {
+		return
+	}
+	s = Schedule{
+		Name:  "stream-" + e.Metadata["eventId"],
+		At:    e.At,
+		Input: string(input),
+	}
+	return
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/scheduler"
+	schedulertypes "github.com/aws/aws-sdk-go-v2/service/scheduler/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+// createdSchedule is the part of a scheduler.CreateScheduleInput checked by the tests.
+type createdSchedule struct {
+	Name       string
+	Group      string
+	Expression string
+	Timezone   string
+	TargetARN  string
+	RoleARN    string
+	Input      string
+}
+
+// recordingScheduler records the schedules it's asked to create.
+type recordingScheduler struct {
+	schedules *[]createdSchedule
+	err       error
+}
+
+func (s recordingScheduler) CreateSchedule(_ context.Context, input *scheduler.CreateScheduleInput, _ ...func(*scheduler.Options)) (*scheduler.CreateScheduleOutput, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if input.FlexibleTimeWindow == nil || input.FlexibleTimeWindow.Mode != schedulertypes.FlexibleTimeWindowModeOff {
+		return nil, errors.New("expected the flexible time window to be off")
+	}
+	*s.schedules = append(*s.schedules, createdSchedule{
+		Name:       aws.ToString(input.Name),
+		Group:      aws.ToString(input.GroupName),
+		Expression: aws.ToString(input.ScheduleExpression),
+		Timezone:   aws.ToString(input.ScheduleExpressionTimezone),
+		TargetARN:  aws.ToString(input.Target.Arn),
+		RoleARN:    aws.ToString(input.Target.RoleArn),
+		Input:      aws.ToString(input.Target.Input),
+	})
+	return &scheduler.CreateScheduleOutput{}, nil
+}
+
+// scheduledRecord is the outbound record of a stream.ScheduledEvent.
+func scheduledRecord() events.DynamoDBEventRecord {
+	return events.DynamoDBEventRecord{
+		EventName: "INSERT",
+		Change: events.DynamoDBStreamRecord{
+			NewImage: map[string]events.DynamoDBAttributeValue{
+				"_pk":       events.NewStringAttribute("Coin/id"),
+				"_sk":       events.NewStringAttribute("OUTBOUND/1/0/ScheduledEvent"),
+				"_typ":      events.NewStringAttribute("ScheduledEvent"),
+				"_id":       events.NewStringAttribute("01GJ9ZQ1ZJ4XPD2Q5Q5RPR5E5M"),
+				"namespace": events.NewStringAttribute("Coin"),
+				"id":        events.NewStringAttribute("id"),
+				"at":        events.NewStringAttribute("2022-11-20T13:10:00Z"),
+				"type":      events.NewStringAttribute("ExpireCoin"),
+				"event": events.NewMapAttribute(map[string]events.DynamoDBAttributeValue{
+					"reason": events.NewStringAttribute("unused"),
+				}),
+			},
+		},
+	}
+}
+
+func TestScheduledEventsCreateSchedules(t *testing.T) {
+	// Arrange.
+	var sent []string
+	var schedules []createdSchedule
+	h := newTestHandler(Config{
+		EventBridge:       recordingEventBridge{sent: &sent},
+		Scheduler:         recordingScheduler{schedules: &schedules},
+		ScheduleTargetARN: "arn:aws:lambda:eu-west-1:123456789012:function:deliver",
+		ScheduleRoleARN:   "arn:aws:iam::123456789012:role/scheduler",
+		ScheduleGroupName: "stream",
+	})
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{
+			scheduledRecord(),
+			prioritizedRecord("CoinIssued", ""),
+		},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("failed to handle request: %v", err)
+	}
+	expected := []createdSchedule{
+		{
+			Name:       "stream-01GJ9ZQ1ZJ4XPD2Q5Q5RPR5E5M",
+			Group:      "stream",
+			Expression: "at(2022-11-20T13:10:00)",
+			Timezone:   "UTC",
+			TargetARN:  "arn:aws:lambda:eu-west-1:123456789012:function:deliver",
+			RoleARN:    "arn:aws:iam::123456789012:role/scheduler",
+			Input:      `{"event":{"reason":"unused"},"id":"id","namespace":"Coin","type":"ExpireCoin"}`,
+		},
+	}
+	if diff := cmp.Diff(expected, schedules); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]string{"/CoinIssued"}, sent); diff != "" {
+		t.Errorf("expected scheduled events not to be published: %s", diff)
+	}
+}
+
+func TestExistingSchedulesAreNotCreatedAgain(t *testing.T) {
+	var tests = []struct {
+		name        string
+		err         error
+		expectError bool
+	}{
+		{
+			name: "schedules that already exist are skipped, so that retries succeed",
+			err:  &schedulertypes.ConflictException{Message: aws.String("schedule already exists")},
+		},
+		{
+			name:        "other errors are returned",
+			err:         &schedulertypes.ThrottlingException{Message: aws.String("slow down")},
+			expectError: true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			h := newTestHandler(Config{
+				EventBridge:       recordingEventBridge{sent: &[]string{}},
+				Scheduler:         recordingScheduler{schedules: &[]createdSchedule{}, err: test.err},
+				ScheduleTargetARN: "arn:aws:lambda:eu-west-1:123456789012:function:deliver",
+				ScheduleRoleARN:   "arn:aws:iam::123456789012:role/scheduler",
+			})
+			event := events.DynamoDBEvent{
+				Records: []events.DynamoDBEventRecord{scheduledRecord()},
+			}
+
+			// Act.
+			err := h.HandleRequest(context.Background(), event)
+
+			// Assert.
+			if (err != nil) != test.expectError {
+				t.Errorf("expected error %v, got %v", test.expectError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// SimulatorAPI is the subset of the DynamoDB client used by the Simulator.
+type SimulatorAPI interface {
+	Scan(context.Context, *dynamodb.ScanInput, ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+}
+
+// Subscriber receives the events published to a LocalBus.
+type Subscriber func(ctx context.Context, entry types.PutEventsRequestEntry) error
+
+// LocalBus is an EventBridgeAPI that passes each event to a Subscriber in the same
+// process, e.g. to test the outbox without AWS. Events that the Subscriber returns an
+// error for are rejected, and aren't retried by the handler.
+type LocalBus struct {
+	Subscriber Subscriber
+}
+
+// PutEvents passes each entry to the Subscriber, in order.
+func (b LocalBus) PutEvents(ctx context.Context, params *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	peo := &eventbridge.PutEventsOutput{Entries: make([]types.PutEventsResultEntry, len(params.Entries))}
+	for i, entry := range params.Entries {
+		if err := b.Subscriber(ctx, entry); err != nil {
+			peo.Entries[i] = types.PutEventsResultEntry{
+				ErrorCode:    aws.String("SubscriberError"),
+				ErrorMessage: aws.String(err.Error()),
+			}
+			peo.FailedEntryCount++
+			continue
+		}
+		peo.Entries[i] = types.PutEventsResultEntry{EventId: aws.String(fmt.Sprintf("local-%d", i))}
+	}
+	return peo, nil
+}
+
+// Simulator feeds the changes to a local table, e.g. in DynamoDB Local, to the handler as
+// DynamoDB stream records, so that the whole pipeline of transforms, routes and sinks
+// can be tested end to end. Use a LocalBus as the handler's EventBridge client to receive
+// the events in process. The Simulator scans the table on each poll, so it's only suitable
+// for small test tables. Alternatively, use a StreamReader with DynamoDB Local's streams.
+type Simulator struct {
+	Handler   *Handler
+	Client    SimulatorAPI
+	TableName string
+	// PollInterval is the time to wait between scans of the table. Defaults to 100ms.
+	PollInterval time.Duration
+	// items are the records found by the latest poll, by key.
+	items map[string]map[string]dynamodbtypes.AttributeValue
+}
+
+// NewSimulator creates a Simulator that feeds the changes to the table to the handler.
+// Records that are already in the table are passed to the handler by the first poll.
+func NewSimulator(h *Handler, client SimulatorAPI, tableName string) *Simulator {
+	return &Simulator{
+		Handler:      h,
+		Client:       client,
+		TableName:    tableName,
+		PollInterval: time.Millisecond * 100,
+		items:        make(map[string]map[string]dynamodbtypes.AttributeValue),
+	}
+}
+
+// Run polls the table until the context is cancelled, or the handler returns an error.
+func (s *Simulator) Run(ctx context.Context) error {
+	for {
+		if _, err := s.Poll(ctx); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(s.PollInterval):
+		}
+	}
+}
+
+// Poll passes the records that were inserted, modified or removed since the previous poll
+// to the handler, and returns the number of changes.
+func (s *Simulator) Poll(ctx context.Context) (n int, err error) {
+	items, err := s.scan(ctx)
+	if err != nil {
+		return
+	}
+	// The images are converted for each poll, because the handler can modify them.
+	var records []events.DynamoDBEventRecord
+	for key, item := range items {
+		var image, previous map[string]events.DynamoDBAttributeValue
+		if image, err = toStreamImage(item); err != nil {
+			return
+		}
+		previousItem, ok := s.items[key]
+		if !ok {
+			records = append(records, s.record(events.DynamoDBOperationTypeInsert, image, nil))
+			continue
+		}
+		if previous, err = toStreamImage(previousItem); err != nil {
+			return
+		}
+		if changed(previous, image) {
+			records = append(records, s.record(events.DynamoDBOperationTypeModify, image, previous))
+		}
+	}
+	for key, previousItem := range s.items {
+		if _, ok := items[key]; ok {
+			continue
+		}
+		var previous map[string]events.DynamoDBAttributeValue
+		if previous, err = toStreamImage(previousItem); err != nil {
+			return
+		}
+		records = append(records, s.record(events.DynamoDBOperationTypeRemove, nil, previous))
+	}
+	if len(records) == 0 {
+		return
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return getPosition(recordImage(records[i])).before(getPosition(recordImage(records[j])))
+	})
+	if err = s.Handler.HandleRequest(ctx, events.DynamoDBEvent{Records: records}); err != nil {
+		return
+	}
+	s.items = items
+	return len(records), nil
+}
+
+func (s *Simulator) scan(ctx context.Context) (items map[string]map[string]dynamodbtypes.AttributeValue, err error) {
+	items = make(map[string]map[string]dynamodbtypes.AttributeValue)
+	pages := dynamodb.NewScanPaginator(s.Client, &dynamodb.ScanInput{
+		TableName:      aws.String(s.TableName),
+		ConsistentRead: aws.Bool(true),
+	})
+	for pages.HasMorePages() {
+		var page *dynamodb.ScanOutput
+		page, err = pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan table: %w", err)
+		}
+		for _, item := range page.Items {
+			items[simulatorKey(item)] = item
+		}
+	}
+	return
+}
+
+func (s *Simulator) record(operation events.DynamoDBOperationType, image, previous map[string]events.DynamoDBAttributeValue) events.DynamoDBEventRecord {
+	return events.DynamoDBEventRecord{
+		EventName:      string(operation),
+		EventSource:    "aws:dynamodb",
+		EventSourceArn: "arn:aws:dynamodb:local:000000000000:table/" + s.TableName + "/stream/simulator",
+		Change: events.DynamoDBStreamRecord{
+			NewImage:       image,
+			OldImage:       previous,
+			StreamViewType: string(dynamodbtypes.StreamViewTypeNewAndOldImages),
+		},
+	}
+}
+
+func recordImage(r events.DynamoDBEventRecord) map[string]events.DynamoDBAttributeValue {
+	if r.Change.NewImage != nil {
+		return r.Change.NewImage
+	}
+	return r.Change.OldImage
+}
+
+func simulatorKey(item map[string]dynamodbtypes.AttributeValue) string {
+	var pk, sk string
+	if v, ok := item["_pk"].(*dynamodbtypes.AttributeValueMemberS); ok {
+		pk = v.Value
+	}
+	if v, ok := item["_sk"].(*dynamodbtypes.AttributeValueMemberS); ok {
+		sk = v.Value
+	}
+	return pk + "\x00" + sk
+}
+
+// changed returns true if any attribute of the record is different.
+func changed(previous, image map[string]events.DynamoDBAttributeValue) bool {
+	if len(previous) != len(image) {
+		return true
+	}
+	for k, v := range image {
+		p, ok := previous[k]
+		if !ok || !equalAttribute(p, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func equalAttribute(a, b events.DynamoDBAttributeValue) bool {
+	ja, errA := a.MarshalJSON()
+	jb, errB := b.MarshalJSON()
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
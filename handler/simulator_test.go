@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+// scanDynamoDB returns its items from Scan.
+type scanDynamoDB struct {
+	items []map[string]dynamodbtypes.AttributeValue
+}
+
+func (m *scanDynamoDB) Scan(_ context.Context, _ *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	return &dynamodb.ScanOutput{Items: m.items}, nil
+}
+
+func simulatorItem(seq, typ string) map[string]dynamodbtypes.AttributeValue {
+	return map[string]dynamodbtypes.AttributeValue{
+		"_pk":  &dynamodbtypes.AttributeValueMemberS{Value: "Payment/id"},
+		"_sk":  &dynamodbtypes.AttributeValueMemberS{Value: "OUTBOUND/" + seq + "/0/" + typ},
+		"_typ": &dynamodbtypes.AttributeValueMemberS{Value: typ},
+	}
+}
+
+func TestSimulatorPublishesNewOutboundRecords(t *testing.T) {
+	// Arrange.
+	var received []string
+	bus := LocalBus{Subscriber: func(ctx context.Context, entry types.PutEventsRequestEntry) error {
+		received = append(received, aws.ToString(entry.DetailType))
+		return nil
+	}}
+	h := newTestHandler(Config{EventBridge: bus, EventBusName: "bus", EventSourceName: "source"})
+	db := &scanDynamoDB{
+		items: []map[string]dynamodbtypes.AttributeValue{
+			simulatorItem("10", "PaymentRefunded"),
+			simulatorItem("9", "PaymentTaken"),
+			{
+				"_pk":  &dynamodbtypes.AttributeValueMemberS{Value: "Payment/id"},
+				"_sk":  &dynamodbtypes.AttributeValueMemberS{Value: "STATE"},
+				"_seq": &dynamodbtypes.AttributeValueMemberN{Value: "10"},
+			},
+		},
+	}
+	s := NewSimulator(h, db, "stream")
+
+	// Act.
+	first, err := s.Poll(context.Background())
+	if err != nil {
+		t.Fatalf("failed to poll: %v", err)
+	}
+	unchanged, err := s.Poll(context.Background())
+	if err != nil {
+		t.Fatalf("failed to poll: %v", err)
+	}
+	db.items = append(db.items, simulatorItem("11", "PaymentClosed"))
+	second, err := s.Poll(context.Background())
+	if err != nil {
+		t.Fatalf("failed to poll: %v", err)
+	}
+
+	// Assert.
+	if first != 3 || unchanged != 0 || second != 1 {
+		t.Errorf("expected 3, 0 and 1 changes, got %d, %d and %d", first, unchanged, second)
+	}
+	expected := []string{"PaymentTaken", "PaymentRefunded", "PaymentClosed"}
+	if diff := cmp.Diff(expected, received); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestSimulatorRetriesChangesAfterErrors(t *testing.T) {
+	// Arrange.
+	fail := true
+	var received int
+	bus := LocalBus{Subscriber: func(ctx context.Context, entry types.PutEventsRequestEntry) error {
+		if fail {
+			return errors.New("subscriber failed")
+		}
+		received++
+		return nil
+	}}
+	h := newTestHandler(Config{EventBridge: bus, EventBusName: "bus", EventSourceName: "source", MaxRetries: -1})
+	db := &scanDynamoDB{items: []map[string]dynamodbtypes.AttributeValue{simulatorItem("1", "PaymentTaken")}}
+	s := NewSimulator(h, db, "stream")
+
+	// Act.
+	_, err := s.Poll(context.Background())
+	fail = false
+	n, retryErr := s.Poll(context.Background())
+
+	// Assert.
+	if err == nil {
+		t.Error("expected the subscriber's error to be returned")
+	}
+	if retryErr != nil {
+		t.Fatalf("failed to retry: %v", retryErr)
+	}
+	if n != 1 || received != 1 {
+		t.Errorf("expected the record to be published on the next poll, got %d changes and %d events", n, received)
+	}
+}
+
+func TestLocalBusRejectsFailedEntries(t *testing.T) {
+	// Arrange.
+	bus := LocalBus{Subscriber: func(ctx context.Context, entry types.PutEventsRequestEntry) error {
+		if aws.ToString(entry.DetailType) == "Failed" {
+			return errors.New("failed")
+		}
+		return nil
+	}}
+
+	// Act.
+	peo, err := bus.PutEvents(context.Background(), &eventbridge.PutEventsInput{
+		Entries: []types.PutEventsRequestEntry{{DetailType: aws.String("Failed")}, {DetailType: aws.String("OK")}},
+	})
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if peo.FailedEntryCount != 1 || peo.Entries[0].ErrorCode == nil || peo.Entries[1].ErrorCode != nil {
+		t.Errorf("expected only the first entry to fail, got %+v", peo.Entries)
+	}
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// sink publishes events to a service other than EventBridge, returning the result of each.
+type sink func(ctx context.Context, outboundEvents []outboundEvent) []types.PutEventsResultEntry
+
+func (h *Handler) sinks() (sinks []sink) {
+	if h.SNS != nil {
+		sinks = append(sinks, h.publishSNS)
+	}
+	if h.SQS != nil {
+		sinks = append(sinks, h.publishSQS)
+	}
+	if h.Kafka != nil {
+		sinks = append(sinks, h.publishKafka)
+	}
+	if h.NATS != nil {
+		sinks = append(sinks, h.publishNATS)
+	}
+	if len(h.Webhooks) > 0 {
+		sinks = append(sinks, h.publishWebhooks)
+	}
+	if h.Firehose != nil {
+		sinks = append(sinks, h.publishFirehose)
+	}
+	if h.StepFunctions != nil {
+		sinks = append(sinks, h.startExecutions)
+	}
+	if h.Lambda != nil {
+		sinks = append(sinks, h.invokeFunctions)
+	}
+	if h.Realtime != nil {
+		sinks = append(sinks, h.publishRealtime)
+	}
+	return
+}
+
+// eventBridgeTarget is the key of EventBridge in the targets that accepted an event. The
+// sinks are keyed by their position in h.sinks(), starting at 1.
+const eventBridgeTarget = 0
+
+// putEvents publishes the events to EventBridge, if it's configured, and then to the other
+// sinks. Only the events that were accepted are published to the next sink, and each event
+// records the targets that accepted it, so that retries only publish it to the targets
+// that failed.
+func (h *Handler) putEvents(ctx context.Context, outboundEvents []outboundEvent) (peo *eventbridge.PutEventsOutput, err error) {
+	peo = &eventbridge.PutEventsOutput{Entries: make([]types.PutEventsResultEntry, len(outboundEvents))}
+	if h.EventBridge != nil {
+		var entries []types.PutEventsRequestEntry
+		var indices []int
+		for j, e := range outboundEvents {
+			if !e.accepted[eventBridgeTarget] {
+				entries = append(entries, e.entry)
+				indices = append(indices, j)
+			}
+		}
+		if len(entries) > 0 {
+			var out *eventbridge.PutEventsOutput
+			out, err = h.EventBridge.PutEvents(ctx, &eventbridge.PutEventsInput{
+				Entries: entries,
+			})
+			if err != nil {
+				return nil, err
+			}
+			for k, j := range indices {
+				peo.Entries[j] = missingResultEntry
+				if k < len(out.Entries) {
+					peo.Entries[j] = out.Entries[k]
+				}
+				if peo.Entries[j].ErrorCode == nil {
+					outboundEvents[j].accept(eventBridgeTarget)
+				}
+			}
+		}
+	}
+	for i, publish := range h.sinks() {
+		target := i + 1
+		var pending []outboundEvent
+		var indices []int
+		for j, e := range outboundEvents {
+			if peo.Entries[j].ErrorCode == nil && !e.accepted[target] {
+				pending = append(pending, e)
+				indices = append(indices, j)
+			}
+		}
+		if len(pending) == 0 {
+			continue
+		}
+		for k, result := range publish(ctx, pending) {
+			if result.ErrorCode != nil {
+				peo.Entries[indices[k]] = result
+				continue
+			}
+			outboundEvents[indices[k]].accept(target)
+		}
+	}
+	return
+}
+
+// publishEach publishes each event, in order, and returns the result of each. If an event
+// fails, the later events of the same entity aren't published, so that they're not
+// received out of order.
+func publishEach(outboundEvents []outboundEvent, errorCode string, publish func(e outboundEvent) (id string, err error)) (results []types.PutEventsResultEntry) {
+	failed := make(map[string]bool)
+	results = make([]types.PutEventsResultEntry, len(outboundEvents))
+	for i, e := range outboundEvents {
+		if failed[e.position.pk] {
+			results[i] = types.PutEventsResultEntry{
+				ErrorCode:    aws.String(errorCode),
+				ErrorMessage: aws.String("an earlier event of the entity failed"),
+			}
+			continue
+		}
+		id, err := publish(e)
+		if err != nil {
+			failed[e.position.pk] = true
+			results[i] = types.PutEventsResultEntry{
+				ErrorCode:    aws.String(errorCode),
+				ErrorMessage: aws.String(err.Error()),
+			}
+			continue
+		}
+		results[i] = types.PutEventsResultEntry{EventId: aws.String(id)}
+	}
+	return
+}
+
+// getAttributes returns the message attributes of the event, so that subscriptions can
+// filter messages.
+func getAttributes(e outboundEvent) map[string]string {
+	attributes := map[string]string{
+		"detailType": aws.ToString(e.entry.DetailType),
+		"source":     aws.ToString(e.entry.Source),
+	}
+	if e.id != "" {
+		attributes["eventId"] = e.id
+	}
+	return attributes
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// SNSAPI is the subset of the SNS client used by the handler.
+type SNSAPI interface {
+	Publish(context.Context, *sns.PublishInput, ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// snsPublishFailure is the error code of events that couldn't be published to SNS.
+const snsPublishFailure = "SNSPublishFailure"
+
+// publishSNS publishes each event to the SNSTopicARN topic. The message is the detail of
+// the event, with String message attributes so that subscriptions can filter messages.
+// Messages to FIFO topics, whose ARNs end in ".fifo", are grouped by entity, so that
+// subscribers receive the events of each entity in order, and deduplicated by event ID.
+func (h *Handler) publishSNS(ctx context.Context, outboundEvents []outboundEvent) []types.PutEventsResultEntry {
+	fifo := strings.HasSuffix(h.SNSTopicARN, ".fifo")
+	return publishEach(outboundEvents, snsPublishFailure, func(e outboundEvent) (id string, err error) {
+		input := &sns.PublishInput{
+			TopicArn:          aws.String(h.SNSTopicARN),
+			Message:           e.entry.Detail,
+			MessageAttributes: make(map[string]snstypes.MessageAttributeValue),
+		}
+		for k, v := range getAttributes(e) {
+			input.MessageAttributes[k] = snstypes.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(v)}
+		}
+		if fifo {
+			input.MessageGroupId = aws.String(e.position.pk)
+			input.MessageDeduplicationId = optionalString(e.id)
+		}
+		output, err := h.SNS.Publish(ctx, input)
+		if err != nil {
+			return
+		}
+		return aws.ToString(output.MessageId), nil
+	})
+}
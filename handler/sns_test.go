@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/google/go-cmp/cmp"
+)
+
+// snsMessage is the part of a sns.PublishInput checked by the tests.
+type snsMessage struct {
+	TopicARN               string
+	Message                string
+	Attributes             map[string]string
+	MessageGroupID         string
+	MessageDeduplicationID string
+}
+
+type mockSNS struct {
+	published []snsMessage
+	fail      map[string]bool
+}
+
+func (m *mockSNS) Publish(_ context.Context, input *sns.PublishInput, _ ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	msg := snsMessage{
+		TopicARN:               aws.ToString(input.TopicArn),
+		Message:                aws.ToString(input.Message),
+		Attributes:             make(map[string]string),
+		MessageGroupID:         aws.ToString(input.MessageGroupId),
+		MessageDeduplicationID: aws.ToString(input.MessageDeduplicationId),
+	}
+	for k, v := range input.MessageAttributes {
+		msg.Attributes[k] = aws.ToString(v.StringValue)
+	}
+	if m.fail[msg.Attributes["detailType"]] {
+		return nil, errors.New("publish failed")
+	}
+	m.published = append(m.published, msg)
+	return &sns.PublishOutput{MessageId: aws.String("message-id")}, nil
+}
+
+func TestSNS(t *testing.T) {
+	var tests = []struct {
+		name             string
+		eventBridge      bool
+		topicARN         string
+		expectedEvents   []string
+		expectedMessages []snsMessage
+	}{
+		{
+			name:     "events can be published to SNS instead of EventBridge",
+			topicARN: "arn:aws:sns:eu-west-1:123456789012:events",
+			expectedMessages: []snsMessage{
+				{
+					TopicARN:   "arn:aws:sns:eu-west-1:123456789012:events",
+					Message:    "{}",
+					Attributes: map[string]string{"detailType": "Normal", "source": "source"},
+				},
+			},
+		},
+		{
+			name:           "events can be published to SNS and EventBridge",
+			eventBridge:    true,
+			topicARN:       "arn:aws:sns:eu-west-1:123456789012:events",
+			expectedEvents: []string{"Normal"},
+			expectedMessages: []snsMessage{
+				{
+					TopicARN:   "arn:aws:sns:eu-west-1:123456789012:events",
+					Message:    "{}",
+					Attributes: map[string]string{"detailType": "Normal", "source": "source"},
+				},
+			},
+		},
+		{
+			name:     "FIFO topics are grouped by entity",
+			topicARN: "arn:aws:sns:eu-west-1:123456789012:events.fifo",
+			expectedMessages: []snsMessage{
+				{
+					TopicARN:       "arn:aws:sns:eu-west-1:123456789012:events.fifo",
+					Message:        "{}",
+					Attributes:     map[string]string{"detailType": "Normal", "source": "source"},
+					MessageGroupID: "Payment/id",
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			var sent []string
+			topic := &mockSNS{}
+			c := Config{
+				EventSourceName: "source",
+				SNS:             topic,
+				SNSTopicARN:     test.topicARN,
+			}
+			if test.eventBridge {
+				c.EventBridge = failingEventBridge{sent: &sent}
+			}
+			h := newTestHandler(c)
+			event := events.DynamoDBEvent{
+				Records: []events.DynamoDBEventRecord{outboundRecord("INSERT", "Normal", false)},
+			}
+
+			// Act.
+			err := h.HandleRequest(context.Background(), event)
+
+			// Assert.
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(test.expectedEvents, sent); diff != "" {
+				t.Errorf("unexpected EventBridge events: %s", diff)
+			}
+			if diff := cmp.Diff(test.expectedMessages, topic.published); diff != "" {
+				t.Errorf("unexpected SNS messages: %s", diff)
+			}
+		})
+	}
+}
+
+func TestSNSFailuresStopTheEntitysLaterEvents(t *testing.T) {
+	// Arrange.
+	topic := &mockSNS{fail: map[string]bool{"Failed": true}}
+	h := newTestHandler(Config{
+		SNS:         topic,
+		SNSTopicARN: "arn:aws:sns:eu-west-1:123456789012:events.fifo",
+	})
+	failed := outboundRecord("INSERT", "Failed", false)
+	failed.Change.NewImage["_sk"] = events.NewStringAttribute("OUTBOUND/1/0/Failed")
+	later := outboundRecord("INSERT", "Later", false)
+	later.Change.NewImage["_sk"] = events.NewStringAttribute("OUTBOUND/1/1/Later")
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{failed, later},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if err == nil {
+		t.Error("expected an error")
+	}
+	if len(topic.published) != 0 {
+		t.Errorf("expected no messages to be published, got %v", topic.published)
+	}
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// SQSAPI is the subset of the SQS client used by the handler.
+type SQSAPI interface {
+	SendMessage(context.Context, *sqs.SendMessageInput, ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+// sqsSendFailure is the error code of events that couldn't be sent to SQS.
+const sqsSendFailure = "SQSSendFailure"
+
+// publishSQS sends each event to the SQSQueueURL queue. The body is the detail of the
+// event, with String message attributes. Messages to FIFO queues, whose URLs end in
+// ".fifo", are grouped by the entity's partition key, so that consumers receive the events
+// of each entity in strict order, and deduplicated by event ID.
+func (h *Handler) publishSQS(ctx context.Context, outboundEvents []outboundEvent) []types.PutEventsResultEntry {
+	fifo := strings.HasSuffix(h.SQSQueueURL, ".fifo")
+	return publishEach(outboundEvents, sqsSendFailure, func(e outboundEvent) (id string, err error) {
+		input := &sqs.SendMessageInput{
+			QueueUrl:          aws.String(h.SQSQueueURL),
+			MessageBody:       e.entry.Detail,
+			MessageAttributes: make(map[string]sqstypes.MessageAttributeValue),
+		}
+		for k, v := range getAttributes(e) {
+			input.MessageAttributes[k] = sqstypes.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(v)}
+		}
+		if fifo {
+			input.MessageGroupId = aws.String(e.position.pk)
+			input.MessageDeduplicationId = optionalString(e.id)
+		}
+		output, err := h.SQS.SendMessage(ctx, input)
+		if err != nil {
+			return
+		}
+		return aws.ToString(output.MessageId), nil
+	})
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/google/go-cmp/cmp"
+)
+
+// sqsMessage is the part of a sqs.SendMessageInput checked by the tests.
+type sqsMessage struct {
+	QueueURL               string
+	Body                   string
+	Attributes             map[string]string
+	MessageGroupID         string
+	MessageDeduplicationID string
+}
+
+type mockSQS struct {
+	sent []sqsMessage
+	// failures is the number of messages to fail before sending succeeds.
+	failures int
+}
+
+func (m *mockSQS) SendMessage(_ context.Context, input *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	msg := sqsMessage{
+		QueueURL:               aws.ToString(input.QueueUrl),
+		Body:                   aws.ToString(input.MessageBody),
+		Attributes:             make(map[string]string),
+		MessageGroupID:         aws.ToString(input.MessageGroupId),
+		MessageDeduplicationID: aws.ToString(input.MessageDeduplicationId),
+	}
+	for k, v := range input.MessageAttributes {
+		msg.Attributes[k] = aws.ToString(v.StringValue)
+	}
+	if m.failures > 0 {
+		m.failures--
+		return nil, errors.New("send failed")
+	}
+	m.sent = append(m.sent, msg)
+	return &sqs.SendMessageOutput{MessageId: aws.String("message-id")}, nil
+}
+
+func TestSQSFIFOQueuesAreGroupedByEntity(t *testing.T) {
+	// Arrange.
+	queue := &mockSQS{}
+	h := newTestHandler(Config{
+		EventSourceName: "source",
+		SQS:             queue,
+		SQSQueueURL:     "https://sqs.eu-west-1.amazonaws.com/123456789012/events.fifo",
+		Metadata:        true,
+	})
+	first := outboundRecord("INSERT", "PaymentTaken", false)
+	first.Change.NewImage["_id"] = events.NewStringAttribute("01ARZ3NDEKTSV4RRFFQ69G5FAV")
+	second := outboundRecord("INSERT", "PaymentRefunded", false)
+	second.Change.NewImage["_sk"] = events.NewStringAttribute("OUTBOUND/2/0/PaymentRefunded")
+	second.Change.NewImage["_id"] = events.NewStringAttribute("01ARZ3NDEKTSV4RRFFQ69G5FAW")
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{second, first},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []sqsMessage{
+		{
+			QueueURL:               "https://sqs.eu-west-1.amazonaws.com/123456789012/events.fifo",
+			Body:                   `{"_metadata":{"eventId":"01ARZ3NDEKTSV4RRFFQ69G5FAV"}}`,
+			Attributes:             map[string]string{"detailType": "PaymentTaken", "source": "source", "eventId": "01ARZ3NDEKTSV4RRFFQ69G5FAV"},
+			MessageGroupID:         "Payment/id",
+			MessageDeduplicationID: "01ARZ3NDEKTSV4RRFFQ69G5FAV",
+		},
+		{
+			QueueURL:               "https://sqs.eu-west-1.amazonaws.com/123456789012/events.fifo",
+			Body:                   `{"_metadata":{"eventId":"01ARZ3NDEKTSV4RRFFQ69G5FAW"}}`,
+			Attributes:             map[string]string{"detailType": "PaymentRefunded", "source": "source", "eventId": "01ARZ3NDEKTSV4RRFFQ69G5FAW"},
+			MessageGroupID:         "Payment/id",
+			MessageDeduplicationID: "01ARZ3NDEKTSV4RRFFQ69G5FAW",
+		},
+	}
+	if diff := cmp.Diff(expected, queue.sent); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// isStateRecord returns true if the stream record is a change to the STATE record of an
+// entity.
+func isStateRecord(record events.DynamoDBEventRecord) bool {
+	r := record.Change.NewImage
+	if record.EventName == string(events.DynamoDBOperationTypeRemove) {
+		r = record.Change.OldImage
+	}
+	sk, ok := r["_sk"]
+	return ok && sk.DataType() == events.DataTypeString && sk.String() == "STATE"
+}
+
+// createStateEvent creates a "<Namespace>StateUpdated" event from an inserted or modified
+// STATE record, or a "<Namespace>Deleted" event from a removed STATE record, if the handler
+// is configured to publish them. State events don't have their dispatch tracked, because
+// updating the STATE record would publish it again.
+func (h *Handler) createStateEvent(ctx context.Context, tableName string, record events.DynamoDBEventRecord) (e *outboundEvent, err error) {
+	r := record.Change.NewImage
+	suffix := "StateUpdated"
+	if record.EventName == string(events.DynamoDBOperationTypeRemove) {
+		if !h.Deletions {
+			return
+		}
+		r = record.Change.OldImage
+		suffix = "Deleted"
+	} else if !h.StateUpdates {
+		return
+	}
+	position := getPosition(r)
+	namespace := getEnvelope(r).Namespace
+	eventType := namespace + suffix
+	entry, err := h.createEntry(ctx, tableName, position.pk, "STATE", eventType, r)
+	if err != nil || entry == nil {
+		return
+	}
+	return &outboundEvent{entry: *entry, position: position, namespace: namespace, id: record.EventID}, nil
+}
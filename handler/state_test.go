@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/google/go-cmp/cmp"
+)
+
+// detailRecordingEventBridge records the detail type and detail of each event.
+type detailRecordingEventBridge struct {
+	sent *[]string
+}
+
+func (m detailRecordingEventBridge) PutEvents(_ context.Context, input *eventbridge.PutEventsInput, _ ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	for _, e := range input.Entries {
+		*m.sent = append(*m.sent, *e.DetailType+" "+*e.Detail)
+	}
+	return accepted(input), nil
+}
+
+func stateRecord(eventName string, balance string) events.DynamoDBEventRecord {
+	image := map[string]events.DynamoDBAttributeValue{
+		"_pk":     events.NewStringAttribute("Account/id"),
+		"_sk":     events.NewStringAttribute("STATE"),
+		"_seq":    events.NewNumberAttribute("2"),
+		"_typ":    events.NewStringAttribute("Account"),
+		"balance": events.NewNumberAttribute(balance),
+	}
+	r := events.DynamoDBEventRecord{EventName: eventName}
+	if eventName == "REMOVE" {
+		r.Change.OldImage = image
+	} else {
+		r.Change.NewImage = image
+	}
+	return r
+}
+
+func TestStateRecords(t *testing.T) {
+	var tests = []struct {
+		name     string
+		config   Config
+		expected []string
+	}{
+		{
+			name:     "state records are not published by default",
+			expected: []string{"Normal {}"},
+		},
+		{
+			name:     "state updates can be published",
+			config:   Config{StateUpdates: true},
+			expected: []string{"AccountStateUpdated {\"balance\":10}", "AccountStateUpdated {\"balance\":20}", "Normal {}"},
+		},
+		{
+			name:     "deletions can be published",
+			config:   Config{Deletions: true},
+			expected: []string{"AccountDeleted {\"balance\":20}", "Normal {}"},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			var sent []string
+			test.config.EventBridge = detailRecordingEventBridge{sent: &sent}
+			h := newTestHandler(test.config)
+			event := events.DynamoDBEvent{
+				Records: []events.DynamoDBEventRecord{
+					stateRecord("INSERT", "10"),
+					stateRecord("MODIFY", "20"),
+					stateRecord("REMOVE", "20"),
+					outboundRecord("INSERT", "Normal", false),
+				},
+			}
+
+			// Act.
+			err := h.HandleRequest(context.Background(), event)
+
+			// Assert.
+			if err != nil {
+				t.Fatalf("failed to handle request: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, sent); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
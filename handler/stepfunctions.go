@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+)
+
+// StepFunctionsAPI is the subset of the Step Functions client used by the handler.
+type StepFunctionsAPI interface {
+	StartExecution(context.Context, *sfn.StartExecutionInput, ...func(*sfn.Options)) (*sfn.StartExecutionOutput, error)
+}
+
+// stepFunctionsFailure is the error code of events whose executions couldn't be started.
+const stepFunctionsFailure = "StepFunctionsFailure"
+
+// startExecutions starts an execution of the state machine of each event's DetailType, with
+// the detail of the event as its input. Executions are named after the event ID, so that
+// retries don't start another execution of standard workflows. Events without a state
+// machine are skipped.
+func (h *Handler) startExecutions(ctx context.Context, outboundEvents []outboundEvent) []types.PutEventsResultEntry {
+	return publishEach(outboundEvents, stepFunctionsFailure, func(e outboundEvent) (id string, err error) {
+		arn, ok := h.StateMachines[aws.ToString(e.entry.DetailType)]
+		if !ok {
+			return e.id, nil
+		}
+		output, err := h.StepFunctions.StartExecution(ctx, &sfn.StartExecutionInput{
+			StateMachineArn: aws.String(arn),
+			Name:            optionalString(e.id),
+			Input:           e.entry.Detail,
+		})
+		if err != nil {
+			return
+		}
+		return aws.ToString(output.ExecutionArn), nil
+	})
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+	"github.com/google/go-cmp/cmp"
+)
+
+// execution is the part of a sfn.StartExecutionInput checked by the tests.
+type execution struct {
+	StateMachineARN string
+	Name            string
+	Input           string
+}
+
+type mockStepFunctions struct {
+	started []execution
+}
+
+func (m *mockStepFunctions) StartExecution(_ context.Context, input *sfn.StartExecutionInput, _ ...func(*sfn.Options)) (*sfn.StartExecutionOutput, error) {
+	m.started = append(m.started, execution{
+		StateMachineARN: aws.ToString(input.StateMachineArn),
+		Name:            aws.ToString(input.Name),
+		Input:           aws.ToString(input.Input),
+	})
+	return &sfn.StartExecutionOutput{
+		ExecutionArn: aws.String("arn:aws:states:eu-west-1:123456789012:execution:fulfilment:" + aws.ToString(input.Name)),
+	}, nil
+}
+
+func TestStepFunctions(t *testing.T) {
+	// Arrange.
+	var sent []string
+	machines := &mockStepFunctions{}
+	h := newTestHandler(Config{
+		EventBridge:   failingEventBridge{sent: &sent},
+		StepFunctions: machines,
+		Metadata:      true,
+		StateMachines: map[string]string{
+			"OrderPlaced": "arn:aws:states:eu-west-1:123456789012:stateMachine:fulfilment",
+		},
+	})
+	placed := outboundRecord("INSERT", "OrderPlaced", false)
+	placed.Change.NewImage["_id"] = events.NewStringAttribute("01ARZ3NDEKTSV4RRFFQ69G5FAV")
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{placed, outboundRecord("INSERT", "OrderViewed", false)},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []execution{
+		{
+			StateMachineARN: "arn:aws:states:eu-west-1:123456789012:stateMachine:fulfilment",
+			Name:            "01ARZ3NDEKTSV4RRFFQ69G5FAV",
+			Input:           `{"_metadata":{"eventId":"01ARZ3NDEKTSV4RRFFQ69G5FAV"}}`,
+		},
+	}
+	if diff := cmp.Diff(expected, machines.started); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,385 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/a-h/stream"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamstypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// shardEnd is the checkpoint of a shard that has been read to the end.
+const shardEnd = "SHARD_END"
+
+// StreamsAPI is the subset of the DynamoDB Streams client used by the StreamReader.
+type StreamsAPI interface {
+	DescribeStream(context.Context, *dynamodbstreams.DescribeStreamInput, ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error)
+	GetShardIterator(context.Context, *dynamodbstreams.GetShardIteratorInput, ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error)
+	GetRecords(context.Context, *dynamodbstreams.GetRecordsInput, ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error)
+}
+
+// ShardLeases stores the checkpoint of each shard of a stream in a lease table with the same
+// key schema as a stream table, and leases each shard to one reader at a time.
+type ShardLeases struct {
+	Client    DynamoDBAPI
+	TableName string
+	// Clock is used for the expiry of leases. Defaults to stream.SystemClock.
+	Clock stream.Clock
+}
+
+// NewShardLeases creates leases stored in the table.
+func NewShardLeases(client DynamoDBAPI, tableName string) *ShardLeases {
+	return &ShardLeases{
+		Client:    client,
+		TableName: tableName,
+		Clock:     stream.SystemClock,
+	}
+}
+
+func (l *ShardLeases) key(streamARN, shardID string) map[string]dynamodbtypes.AttributeValue {
+	return map[string]dynamodbtypes.AttributeValue{
+		"_pk": &dynamodbtypes.AttributeValueMemberS{Value: "SHARD/" + streamARN + "/" + shardID},
+		"_sk": &dynamodbtypes.AttributeValueMemberS{Value: "LEASE"},
+	}
+}
+
+// Acquire the lease of the shard for the owner, unless another owner holds an unexpired
+// lease, and return the shard's checkpoint.
+func (l *ShardLeases) Acquire(ctx context.Context, streamARN, shardID, owner string, d time.Duration) (checkpoint string, ok bool, err error) {
+	now := l.Clock.Now()
+	uio, err := l.Client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(l.TableName),
+		Key:                 l.key(streamARN, shardID),
+		UpdateExpression:    aws.String("SET #_owner = :_owner, #_leaseExpires = :_expires"),
+		ConditionExpression: aws.String("attribute_not_exists(#_pk) OR #_owner = :_owner OR #_leaseExpires < :_now"),
+		ExpressionAttributeNames: map[string]string{
+			"#_pk":           "_pk",
+			"#_owner":        "_owner",
+			"#_leaseExpires": "_leaseExpires",
+		},
+		ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+			":_owner":   &dynamodbtypes.AttributeValueMemberS{Value: owner},
+			":_now":     &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+			":_expires": &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(d).Unix(), 10)},
+		},
+		ReturnValues: dynamodbtypes.ReturnValueAllNew,
+	})
+	if err != nil {
+		var conditionFailed *dynamodbtypes.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("failed to acquire lease of shard %s: %w", shardID, err)
+	}
+	if v, isString := uio.Attributes["_checkpoint"].(*dynamodbtypes.AttributeValueMemberS); isString {
+		checkpoint = v.Value
+	}
+	return checkpoint, true, nil
+}
+
+// Checkpoint records the sequence number of the latest record of the shard that has been
+// processed, and renews the owner's lease. If the owner no longer holds the lease, ok is
+// false.
+func (l *ShardLeases) Checkpoint(ctx context.Context, streamARN, shardID, owner, checkpoint string, d time.Duration) (ok bool, err error) {
+	_, err = l.Client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(l.TableName),
+		Key:                 l.key(streamARN, shardID),
+		UpdateExpression:    aws.String("SET #_checkpoint = :_checkpoint, #_leaseExpires = :_expires"),
+		ConditionExpression: aws.String("#_owner = :_owner"),
+		ExpressionAttributeNames: map[string]string{
+			"#_owner":        "_owner",
+			"#_checkpoint":   "_checkpoint",
+			"#_leaseExpires": "_leaseExpires",
+		},
+		ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+			":_owner":      &dynamodbtypes.AttributeValueMemberS{Value: owner},
+			":_checkpoint": &dynamodbtypes.AttributeValueMemberS{Value: checkpoint},
+			":_expires":    &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(l.Clock.Now().Add(d).Unix(), 10)},
+		},
+	})
+	if err != nil {
+		var conditionFailed *dynamodbtypes.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to checkpoint shard %s: %w", shardID, err)
+	}
+	return true, nil
+}
+
+// Finished returns true if the shard has been read to the end.
+func (l *ShardLeases) Finished(ctx context.Context, streamARN, shardID string) (finished bool, err error) {
+	gio, err := l.Client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(l.TableName),
+		Key:            l.key(streamARN, shardID),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to get lease of shard %s: %w", shardID, err)
+	}
+	v, ok := gio.Item["_checkpoint"].(*dynamodbtypes.AttributeValueMemberS)
+	return ok && v.Value == shardEnd, nil
+}
+
+// StreamReader reads the table's changes from the DynamoDB Streams API, instead of being
+// invoked by Lambda, e.g. to run the handler in a container, and passes them to the
+// handler. Each shard is leased to one reader at a time, so several readers can share a
+// stream, and the shards of a reader that stops are taken over when its leases expire.
+type StreamReader struct {
+	Handler   *Handler
+	Streams   StreamsAPI
+	StreamARN string
+	Leases    *ShardLeases
+	// Owner identifies the reader in the lease table. Defaults to a random ID.
+	Owner string
+	// BatchSize is the maximum number of records passed to the handler at once. Defaults to
+	// 100.
+	BatchSize int32
+	// PollInterval is the time to wait after reading no records from a shard, and between
+	// checks for new shards. Defaults to 1 second.
+	PollInterval time.Duration
+	// LeaseDuration is the time that a shard is leased for. Leases are renewed each time
+	// that the shard is read. Defaults to 1 minute.
+	LeaseDuration time.Duration
+
+	m       sync.Mutex
+	reading map[string]bool
+}
+
+// NewStreamReader creates a reader of the stream that passes records to the handler.
+func NewStreamReader(h *Handler, streams StreamsAPI, streamARN string, leases *ShardLeases) *StreamReader {
+	return &StreamReader{
+		Handler:       h,
+		Streams:       streams,
+		StreamARN:     streamARN,
+		Leases:        leases,
+		Owner:         uuid.New().String(),
+		BatchSize:     100,
+		PollInterval:  time.Second,
+		LeaseDuration: time.Minute,
+		reading:       make(map[string]bool),
+	}
+}
+
+// Run reads the shards of the stream until the context is cancelled. Shards are read once
+// their parent shard has been read to the end, so that the changes of each item are
+// processed in order.
+func (r *StreamReader) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		shards, err := r.shards(ctx)
+		if err != nil {
+			return err
+		}
+		for shard := range shards {
+			shard := shard
+			if !r.start(shard) {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer r.stop(shard)
+				if err := r.readShard(ctx, shard, shards); err != nil && ctx.Err() == nil {
+					r.Handler.Log.Error("failed to read shard", zap.String("shard", shard), zap.Error(err))
+				}
+			}()
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(r.PollInterval):
+		}
+	}
+}
+
+func (r *StreamReader) start(shard string) bool {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.reading[shard] {
+		return false
+	}
+	r.reading[shard] = true
+	return true
+}
+
+func (r *StreamReader) stop(shard string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	delete(r.reading, shard)
+}
+
+// shards returns the IDs of the stream's shards, mapped to the IDs of their parents.
+func (r *StreamReader) shards(ctx context.Context) (parents map[string]string, err error) {
+	parents = make(map[string]string)
+	var start *string
+	for {
+		dso, err := r.Streams.DescribeStream(ctx, &dynamodbstreams.DescribeStreamInput{
+			StreamArn:             aws.String(r.StreamARN),
+			ExclusiveStartShardId: start,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe stream: %w", err)
+		}
+		if dso.StreamDescription == nil {
+			return parents, nil
+		}
+		for _, s := range dso.StreamDescription.Shards {
+			parents[aws.ToString(s.ShardId)] = aws.ToString(s.ParentShardId)
+		}
+		start = dso.StreamDescription.LastEvaluatedShardId
+		if start == nil {
+			return parents, nil
+		}
+	}
+}
+
+// readShard reads the shard until it ends, the lease is lost, or the context is cancelled.
+func (r *StreamReader) readShard(ctx context.Context, shard string, parents map[string]string) (err error) {
+	if parent := parents[shard]; parent != "" {
+		if _, exists := parents[parent]; exists {
+			finished, err := r.Leases.Finished(ctx, r.StreamARN, parent)
+			if err != nil || !finished {
+				return err
+			}
+		}
+	}
+	checkpoint, ok, err := r.Leases.Acquire(ctx, r.StreamARN, shard, r.Owner, r.LeaseDuration)
+	if err != nil || !ok || checkpoint == shardEnd {
+		return
+	}
+	iterator, err := r.iterator(ctx, shard, checkpoint)
+	if err != nil {
+		return
+	}
+	for iterator != nil {
+		gro, err := r.Streams.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{
+			ShardIterator: iterator,
+			Limit:         aws.Int32(r.BatchSize),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get records: %w", err)
+		}
+		if len(gro.Records) > 0 {
+			event := events.DynamoDBEvent{Records: make([]events.DynamoDBEventRecord, len(gro.Records))}
+			for i, record := range gro.Records {
+				event.Records[i] = r.eventRecord(record)
+			}
+			if err = r.Handler.HandleRequest(ctx, event); err != nil {
+				return err
+			}
+			checkpoint = event.Records[len(event.Records)-1].Change.SequenceNumber
+		}
+		iterator = gro.NextShardIterator
+		if iterator == nil {
+			checkpoint = shardEnd
+		}
+		if ok, err = r.Leases.Checkpoint(ctx, r.StreamARN, shard, r.Owner, checkpoint, r.LeaseDuration); err != nil || !ok {
+			return err
+		}
+		if len(gro.Records) == 0 && iterator != nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(r.PollInterval):
+			}
+		}
+	}
+	return nil
+}
+
+// iterator returns an iterator that starts after the checkpoint, or at the start of the
+// shard.
+func (r *StreamReader) iterator(ctx context.Context, shard, checkpoint string) (iterator *string, err error) {
+	input := &dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         aws.String(r.StreamARN),
+		ShardId:           aws.String(shard),
+		ShardIteratorType: streamstypes.ShardIteratorTypeTrimHorizon,
+	}
+	if checkpoint != "" {
+		input.ShardIteratorType = streamstypes.ShardIteratorTypeAfterSequenceNumber
+		input.SequenceNumber = aws.String(checkpoint)
+	}
+	gsio, err := r.Streams.GetShardIterator(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get iterator of shard %s: %w", shard, err)
+	}
+	return gsio.ShardIterator, nil
+}
+
+// eventRecord converts the record to the format that Lambda passes to the handler.
+func (r *StreamReader) eventRecord(record streamstypes.Record) (er events.DynamoDBEventRecord) {
+	er = events.DynamoDBEventRecord{
+		AWSRegion:      aws.ToString(record.AwsRegion),
+		EventID:        aws.ToString(record.EventID),
+		EventName:      string(record.EventName),
+		EventSource:    aws.ToString(record.EventSource),
+		EventVersion:   aws.ToString(record.EventVersion),
+		EventSourceArn: r.StreamARN,
+	}
+	if c := record.Dynamodb; c != nil {
+		er.Change = events.DynamoDBStreamRecord{
+			Keys:           streamAttributes(c.Keys),
+			NewImage:       streamAttributes(c.NewImage),
+			OldImage:       streamAttributes(c.OldImage),
+			SequenceNumber: aws.ToString(c.SequenceNumber),
+			SizeBytes:      aws.ToInt64(c.SizeBytes),
+			StreamViewType: string(c.StreamViewType),
+		}
+		if c.ApproximateCreationDateTime != nil {
+			er.Change.ApproximateCreationDateTime = events.SecondsEpochTime{Time: *c.ApproximateCreationDateTime}
+		}
+	}
+	return
+}
+
+func streamAttributes(m map[string]streamstypes.AttributeValue) map[string]events.DynamoDBAttributeValue {
+	if m == nil {
+		return nil
+	}
+	op := make(map[string]events.DynamoDBAttributeValue, len(m))
+	for k, v := range m {
+		op[k] = streamAttribute(v)
+	}
+	return op
+}
+
+func streamAttribute(av streamstypes.AttributeValue) events.DynamoDBAttributeValue {
+	switch v := av.(type) {
+	case *streamstypes.AttributeValueMemberB:
+		return events.NewBinaryAttribute(v.Value)
+	case *streamstypes.AttributeValueMemberBOOL:
+		return events.NewBooleanAttribute(v.Value)
+	case *streamstypes.AttributeValueMemberBS:
+		return events.NewBinarySetAttribute(v.Value)
+	case *streamstypes.AttributeValueMemberL:
+		list := make([]events.DynamoDBAttributeValue, len(v.Value))
+		for i, item := range v.Value {
+			list[i] = streamAttribute(item)
+		}
+		return events.NewListAttribute(list)
+	case *streamstypes.AttributeValueMemberM:
+		return events.NewMapAttribute(streamAttributes(v.Value))
+	case *streamstypes.AttributeValueMemberN:
+		return events.NewNumberAttribute(v.Value)
+	case *streamstypes.AttributeValueMemberNS:
+		return events.NewNumberSetAttribute(v.Value)
+	case *streamstypes.AttributeValueMemberS:
+		return events.NewStringAttribute(v.Value)
+	case *streamstypes.AttributeValueMemberSS:
+		return events.NewStringSetAttribute(v.Value)
+	}
+	return events.NewNullAttribute()
+}
@@ -0,0 +1,261 @@
+package handler
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/a-h/stream"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamstypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+// mockStreams returns the records of closed shards.
+type mockStreams struct {
+	shards  []streamstypes.Shard
+	records map[string][]string
+}
+
+func (m *mockStreams) DescribeStream(_ context.Context, input *dynamodbstreams.DescribeStreamInput, _ ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error) {
+	return &dynamodbstreams.DescribeStreamOutput{
+		StreamDescription: &streamstypes.StreamDescription{Shards: m.shards},
+	}, nil
+}
+
+func (m *mockStreams) GetShardIterator(_ context.Context, input *dynamodbstreams.GetShardIteratorInput, _ ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error) {
+	var position int
+	if input.ShardIteratorType == streamstypes.ShardIteratorTypeAfterSequenceNumber {
+		position, _ = strconv.Atoi(strings.TrimPrefix(aws.ToString(input.SequenceNumber), aws.ToString(input.ShardId)+"/"))
+		position++
+	}
+	return &dynamodbstreams.GetShardIteratorOutput{
+		ShardIterator: aws.String(aws.ToString(input.ShardId) + "/" + strconv.Itoa(position)),
+	}, nil
+}
+
+func (m *mockStreams) GetRecords(_ context.Context, input *dynamodbstreams.GetRecordsInput, _ ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error) {
+	parts := strings.Split(aws.ToString(input.ShardIterator), "/")
+	shard := parts[0]
+	position, _ := strconv.Atoi(parts[1])
+	var output dynamodbstreams.GetRecordsOutput
+	for i := position; i < len(m.records[shard]) && i < position+int(aws.ToInt32(input.Limit)); i++ {
+		output.Records = append(output.Records, streamRecord(shard+"/"+strconv.Itoa(i), m.records[shard][i]))
+	}
+	if next := position + len(output.Records); next < len(m.records[shard]) {
+		output.NextShardIterator = aws.String(shard + "/" + strconv.Itoa(next))
+	}
+	return &output, nil
+}
+
+func streamRecord(sequenceNumber, typ string) streamstypes.Record {
+	return streamstypes.Record{
+		EventName: streamstypes.OperationTypeInsert,
+		Dynamodb: &streamstypes.StreamRecord{
+			SequenceNumber: aws.String(sequenceNumber),
+			NewImage: map[string]streamstypes.AttributeValue{
+				"_pk":  &streamstypes.AttributeValueMemberS{Value: "Payment/id"},
+				"_sk":  &streamstypes.AttributeValueMemberS{Value: "OUTBOUND/1/0/" + typ},
+				"_typ": &streamstypes.AttributeValueMemberS{Value: typ},
+			},
+		},
+	}
+}
+
+// leaseDynamoDB stores the owner, lease expiry and checkpoint of each shard.
+type leaseDynamoDB struct {
+	DynamoDBAPI
+	m      sync.Mutex
+	leases map[string]map[string]string
+}
+
+func (db *leaseDynamoDB) UpdateItem(_ context.Context, input *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	db.m.Lock()
+	defer db.m.Unlock()
+	pk := input.Key["_pk"].(*dynamodbtypes.AttributeValueMemberS).Value
+	value := func(name string) string {
+		switch v := input.ExpressionAttributeValues[name].(type) {
+		case *dynamodbtypes.AttributeValueMemberS:
+			return v.Value
+		case *dynamodbtypes.AttributeValueMemberN:
+			return v.Value
+		}
+		return ""
+	}
+	lease, exists := db.leases[pk]
+	if aws.ToString(input.ConditionExpression) == "#_owner = :_owner" {
+		if !exists || lease["owner"] != value(":_owner") {
+			return nil, &dynamodbtypes.ConditionalCheckFailedException{}
+		}
+		lease["checkpoint"] = value(":_checkpoint")
+		lease["expires"] = value(":_expires")
+		return &dynamodb.UpdateItemOutput{}, nil
+	}
+	if exists && lease["owner"] != value(":_owner") && lease["expires"] >= value(":_now") {
+		return nil, &dynamodbtypes.ConditionalCheckFailedException{}
+	}
+	if !exists {
+		lease = map[string]string{}
+		db.leases[pk] = lease
+	}
+	lease["owner"] = value(":_owner")
+	lease["expires"] = value(":_expires")
+	output := &dynamodb.UpdateItemOutput{Attributes: map[string]dynamodbtypes.AttributeValue{}}
+	if lease["checkpoint"] != "" {
+		output.Attributes["_checkpoint"] = &dynamodbtypes.AttributeValueMemberS{Value: lease["checkpoint"]}
+	}
+	return output, nil
+}
+
+func (db *leaseDynamoDB) GetItem(_ context.Context, input *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	db.m.Lock()
+	defer db.m.Unlock()
+	output := &dynamodb.GetItemOutput{}
+	if lease, ok := db.leases[input.Key["_pk"].(*dynamodbtypes.AttributeValueMemberS).Value]; ok {
+		output.Item = map[string]dynamodbtypes.AttributeValue{
+			"_checkpoint": &dynamodbtypes.AttributeValueMemberS{Value: lease["checkpoint"]},
+		}
+	}
+	return output, nil
+}
+
+func (db *leaseDynamoDB) checkpoints() map[string]string {
+	db.m.Lock()
+	defer db.m.Unlock()
+	checkpoints := make(map[string]string)
+	for pk, lease := range db.leases {
+		checkpoints[pk[strings.LastIndex(pk, "/")+1:]] = lease["checkpoint"]
+	}
+	return checkpoints
+}
+
+func TestStreamReader(t *testing.T) {
+	// Arrange.
+	var sent []string
+	eb := failingEventBridge{sent: &sent}
+	h := newTestHandler(Config{EventBridge: eb})
+	streams := &mockStreams{
+		// The child is listed first, but is read after its parent.
+		shards: []streamstypes.Shard{
+			{ShardId: aws.String("child"), ParentShardId: aws.String("parent")},
+			{ShardId: aws.String("parent"), ParentShardId: aws.String("trimmed")},
+		},
+		records: map[string][]string{
+			"parent": {"A", "B", "C"},
+			"child":  {"D"},
+		},
+	}
+	db := &leaseDynamoDB{leases: map[string]map[string]string{
+		"SHARD/stream/parent": {"owner": "previous", "expires": "0", "checkpoint": "parent/0"},
+	}}
+	r := NewStreamReader(h, streams, "stream", NewShardLeases(db, "leases"))
+	r.BatchSize = 1
+	r.PollInterval = time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Act.
+	go func() {
+		for ctx.Err() == nil {
+			if cmp.Equal(map[string]string{"parent": shardEnd, "child": shardEnd}, db.checkpoints()) {
+				cancel()
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	err := r.Run(ctx)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"B", "C", "D"}, sent); diff != "" {
+		t.Errorf("expected records to be read from the checkpoint, in order: %s", diff)
+	}
+}
+
+func TestShardLeases(t *testing.T) {
+	// Arrange.
+	now := time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+	leases := NewShardLeases(&leaseDynamoDB{leases: map[string]map[string]string{}}, "leases")
+	leases.Clock = stream.ClockFunc(func() time.Time { return now })
+	ctx := context.Background()
+
+	// Act.
+	_, acquired, err := leases.Acquire(ctx, "stream", "shard", "a", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkpointed, err := leases.Checkpoint(ctx, "stream", "shard", "a", "1", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, stolen, err := leases.Acquire(ctx, "stream", "shard", "b", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now = now.Add(2 * time.Minute)
+	checkpoint, expired, err := leases.Acquire(ctx, "stream", "shard", "b", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lost, err := leases.Checkpoint(ctx, "stream", "shard", "a", "2", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Assert.
+	if !acquired || !checkpointed {
+		t.Error("expected the lease to be acquired and checkpointed")
+	}
+	if stolen {
+		t.Error("expected an unexpired lease not to be acquired by another owner")
+	}
+	if !expired || checkpoint != "1" {
+		t.Errorf("expected an expired lease to be acquired with its checkpoint, got %v, %q", expired, checkpoint)
+	}
+	if lost {
+		t.Error("expected the previous owner not to be able to checkpoint")
+	}
+}
+
+func TestStreamAttribute(t *testing.T) {
+	// Arrange.
+	av := &streamstypes.AttributeValueMemberM{Value: map[string]streamstypes.AttributeValue{
+		"s":    &streamstypes.AttributeValueMemberS{Value: "a"},
+		"n":    &streamstypes.AttributeValueMemberN{Value: "1"},
+		"b":    &streamstypes.AttributeValueMemberB{Value: []byte{1}},
+		"bool": &streamstypes.AttributeValueMemberBOOL{Value: true},
+		"null": &streamstypes.AttributeValueMemberNULL{Value: true},
+		"l":    &streamstypes.AttributeValueMemberL{Value: []streamstypes.AttributeValue{&streamstypes.AttributeValueMemberS{Value: "b"}}},
+		"ss":   &streamstypes.AttributeValueMemberSS{Value: []string{"c"}},
+		"ns":   &streamstypes.AttributeValueMemberNS{Value: []string{"2"}},
+		"bs":   &streamstypes.AttributeValueMemberBS{Value: [][]byte{{2}}},
+	}}
+
+	// Act.
+	actual := streamAttribute(av)
+
+	// Assert.
+	expected := events.NewMapAttribute(map[string]events.DynamoDBAttributeValue{
+		"s":    events.NewStringAttribute("a"),
+		"n":    events.NewNumberAttribute("1"),
+		"b":    events.NewBinaryAttribute([]byte{1}),
+		"bool": events.NewBooleanAttribute(true),
+		"null": events.NewNullAttribute(),
+		"l":    events.NewListAttribute([]events.DynamoDBAttributeValue{events.NewStringAttribute("b")}),
+		"ss":   events.NewStringSetAttribute([]string{"c"}),
+		"ns":   events.NewNumberSetAttribute([]string{"2"}),
+		"bs":   events.NewBinarySetAttribute([][]byte{{2}}),
+	})
+	if diff := cmp.Diff(expected, actual, cmp.AllowUnexported(events.DynamoDBAttributeValue{})); diff != "" {
+		t.Errorf("unexpected attribute: %s", diff)
+	}
+}
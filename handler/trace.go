@@ -0,0 +1,20 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// getTraceHeader returns the X-Ray trace header stored with the record, see
+// stream.EventMetadata, or the trace header of the Lambda invocation.
+func getTraceHeader(ctx context.Context, r map[string]events.DynamoDBAttributeValue) *string {
+	if v, ok := r["_traceHeader"]; ok && v.DataType() == events.DataTypeString && v.String() != "" {
+		th := v.String()
+		return &th
+	}
+	if th, ok := ctx.Value("x-amzn-trace-id").(string); ok && th != "" {
+		return &th
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestTraceHeader(t *testing.T) {
+	invocation := "Root=1-5759e988-bd862e3fe1be46a994272793;Sampled=1"
+	stored := "Root=1-67891233-abcdef012345678912345678;Sampled=1"
+	var tests = []struct {
+		name     string
+		ctx      context.Context
+		stored   string
+		expected *string
+	}{
+		{
+			name:     "the trace header is not set without a trace",
+			ctx:      context.Background(),
+			expected: nil,
+		},
+		{
+			name:     "the trace header of the Lambda invocation is used",
+			ctx:      context.WithValue(context.Background(), "x-amzn-trace-id", invocation),
+			expected: aws.String(invocation),
+		},
+		{
+			name:     "the trace header stored with the event takes precedence",
+			ctx:      context.WithValue(context.Background(), "x-amzn-trace-id", invocation),
+			stored:   stored,
+			expected: aws.String(stored),
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			r := map[string]events.DynamoDBAttributeValue{
+				"_pk":  events.NewStringAttribute("Payment/id"),
+				"_sk":  events.NewStringAttribute("OUTBOUND/1/0/PaymentTaken"),
+				"_typ": events.NewStringAttribute("PaymentTaken"),
+			}
+			if test.stored != "" {
+				r["_traceHeader"] = events.NewStringAttribute(test.stored)
+			}
+
+			// Act.
+			_, _, e, err := newTestHandler(Config{}).createOutboundEvent(test.ctx, "", r)
+
+			// Assert.
+			if err != nil {
+				t.Fatalf("failed to create outbound event: %v", err)
+			}
+			if aws.ToString(e.TraceHeader) != aws.ToString(test.expected) {
+				t.Errorf("expected trace header %q, got %q", aws.ToString(test.expected), aws.ToString(e.TraceHeader))
+			}
+			if *e.Detail != "{}" {
+				t.Errorf("expected the trace header not to be included in the detail, got %s", *e.Detail)
+			}
+		})
+	}
+}
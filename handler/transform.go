@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// Transform changes an outbound event before it's published, e.g. to rename its DetailType,
+// or enrich its detail. Returning nil drops the event.
+type Transform func(e *types.PutEventsRequestEntry) (*types.PutEventsRequestEntry, error)
+
+// SetTransforms configures the handler started by Start to apply the transforms to outbound
+// events. Call it before Start. Handlers created with New use Config.Transforms.
+func SetTransforms(t ...Transform) {
+	transforms = t
+}
+
+// transform applies the transforms in order, stopping if an event is dropped.
+func (h *Handler) transform(e *types.PutEventsRequestEntry) (*types.PutEventsRequestEntry, error) {
+	var err error
+	for i, t := range h.Transforms {
+		e, err = t(e)
+		if err != nil {
+			return nil, fmt.Errorf("transform %d: %w", i, err)
+		}
+		if e == nil {
+			return nil, nil
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTransforms(t *testing.T) {
+	// Arrange.
+	var sent []string
+	db := &mockDynamoDB{}
+	dropInternal := func(e *types.PutEventsRequestEntry) (*types.PutEventsRequestEntry, error) {
+		if *e.DetailType == "Internal" {
+			return nil, nil
+		}
+		return e, nil
+	}
+	rename := func(e *types.PutEventsRequestEntry) (*types.PutEventsRequestEntry, error) {
+		e.DetailType = aws.String("Renamed" + *e.DetailType)
+		return e, nil
+	}
+	enrich := func(e *types.PutEventsRequestEntry) (*types.PutEventsRequestEntry, error) {
+		e.Detail = aws.String(`{"region":"eu-west-1"}`)
+		return e, nil
+	}
+	h := newTestHandler(Config{
+		EventBridge: detailRecordingEventBridge{sent: &sent},
+		DynamoDB:    db,
+		Transforms:  []Transform{dropInternal, rename, enrich},
+	})
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{
+			outboundRecord("INSERT", "Internal", true),
+			outboundRecord("INSERT", "Normal", false),
+		},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{`RenamedNormal {"region":"eu-west-1"}`}, sent); diff != "" {
+		t.Errorf("unexpected events sent: %s", diff)
+	}
+	if diff := cmp.Diff([]string{"OUTBOUND/1/0/Internal"}, db.confirmed); diff != "" {
+		t.Errorf("expected the dropped event to be confirmed: %s", diff)
+	}
+}
+
+func TestTransformErrorsAreReturned(t *testing.T) {
+	// Arrange.
+	var sent []string
+	errTransform := errors.New("transform failed")
+	h := newTestHandler(Config{
+		EventBridge: detailRecordingEventBridge{sent: &sent},
+		Transforms: []Transform{func(e *types.PutEventsRequestEntry) (*types.PutEventsRequestEntry, error) {
+			return nil, errTransform
+		}},
+	})
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{outboundRecord("INSERT", "Normal", false)},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if !errors.Is(err, errTransform) {
+		t.Errorf("expected the transform error, got %v", err)
+	}
+	if len(sent) != 0 {
+		t.Errorf("expected no events to be sent, got %v", sent)
+	}
+}
@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/a-h/stream"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"go.uber.org/zap"
+)
+
+// Headers of webhook requests. The signature is the hex encoded HMAC-SHA256 of the
+// timestamp, a ".", and the body, prefixed with "sha256=", which receivers can check with
+// webhook.Stream.
+const (
+	WebhookSignatureHeader = "X-Stream-Signature"
+	WebhookEventTypeHeader = "X-Stream-Event-Type"
+	WebhookEventIDHeader   = "X-Stream-Event-Id"
+	WebhookTimestampHeader = "X-Stream-Timestamp"
+)
+
+const (
+	defaultWebhookFailureThreshold = 5
+	defaultWebhookCooldown         = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned when events aren't sent to a webhook endpoint, because recent
+// deliveries failed.
+var ErrCircuitOpen = errors.New("handler: webhook circuit open")
+
+// Webhook POSTs the detail of outbound events to an HTTP endpoint, e.g. to notify an
+// external partner. Failed requests are retried with exponential backoff, and after
+// FailureThreshold consecutive failed deliveries, events aren't sent to the endpoint until
+// the Cooldown has passed, so that an unavailable partner doesn't slow down the stream.
+// Webhooks must be used as pointers, because they track the state of the endpoint.
+type Webhook struct {
+	URL string
+	// Secret used to sign the body of each request.
+	Secret []byte
+	// DetailTypes, if set, are the only events sent to the endpoint.
+	DetailTypes []string
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+	// MaxRetries defaults to 3. Set to -1 to disable retries.
+	MaxRetries int
+	// RetryBackoff is the time to wait before the first retry, doubling for each retry.
+	// Defaults to 100ms.
+	RetryBackoff time.Duration
+	// FailureThreshold defaults to 5.
+	FailureThreshold int
+	// Cooldown defaults to 30s.
+	Cooldown time.Duration
+	// Clock is used for the timestamp header and the circuit breaker. Defaults to
+	// stream.SystemClock.
+	Clock stream.Clock
+	// Deliveries records the IDs of the events delivered to the endpoint, so that they're
+	// not sent again when a batch is retried because another endpoint failed. Defaults to
+	// a MemoryDeduplicator of 10,000 IDs.
+	Deliveries Deduplicator
+
+	m         sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// webhookFailure is the error code of events that couldn't be sent to a webhook.
+const webhookFailure = "WebhookFailure"
+
+// publishWebhooks sends each event to the webhooks that accept its DetailType, and
+// haven't already received it. Events aren't sent to endpoints whose circuit is open, see
+// skipWebhook.
+func (h *Handler) publishWebhooks(ctx context.Context, outboundEvents []outboundEvent) []types.PutEventsResultEntry {
+	return publishEach(outboundEvents, webhookFailure, func(e outboundEvent) (string, error) {
+		for _, w := range h.Webhooks {
+			if !w.accepts(aws.ToString(e.entry.DetailType)) {
+				continue
+			}
+			delivered, err := w.delivered(ctx, e.id)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", w.URL, err)
+			}
+			if delivered {
+				continue
+			}
+			err = w.send(ctx, e)
+			if errors.Is(err, ErrCircuitOpen) {
+				err = h.skipWebhook(ctx, w, e)
+			}
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", w.URL, err)
+			}
+			if e.id != "" {
+				if err = w.deliveries().MarkPublished(ctx, e.id); err != nil {
+					h.Log.Warn("failed to record webhook delivery", zap.String("url", w.URL), zap.Error(err))
+				}
+			}
+		}
+		return e.id, nil
+	})
+}
+
+// skipWebhook sends an event that wasn't sent to the webhook because its circuit is open
+// to the DeadLetterQueue, if there is one, so that the rest of the batch isn't failed and
+// retried while the endpoint is unavailable.
+func (h *Handler) skipWebhook(ctx context.Context, w *Webhook, e outboundEvent) error {
+	message := fmt.Sprintf("%s: %v", w.URL, ErrCircuitOpen)
+	if h.DeadLetterQueue == nil {
+		h.Log.Warn("skipping webhook", zap.String("url", w.URL), zap.String("id", e.id), zap.Error(ErrCircuitOpen))
+		return nil
+	}
+	return h.deadLetter(ctx, 0, []DeadLetter{newDeadLetter(e, webhookFailure, message, h.now())}, nil)
+}
+
+func (w *Webhook) deliveries() Deduplicator {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if w.Deliveries == nil {
+		w.Deliveries = NewMemoryDeduplicator(defaultDeduplicationCacheSize)
+	}
+	return w.Deliveries
+}
+
+// delivered returns true if the event has already been sent to the endpoint.
+func (w *Webhook) delivered(ctx context.Context, id string) (bool, error) {
+	if id == "" {
+		return false, nil
+	}
+	return w.deliveries().Published(ctx, id)
+}
+
+func (w *Webhook) accepts(detailType string) bool {
+	if len(w.DetailTypes) == 0 {
+		return true
+	}
+	for _, dt := range w.DetailTypes {
+		if dt == detailType {
+			return true
+		}
+	}
+	return false
+}
+
+// send the event, with retries, unless the circuit is open.
+func (w *Webhook) send(ctx context.Context, e outboundEvent) (err error) {
+	if w.isOpen() {
+		return ErrCircuitOpen
+	}
+	maxRetries, backoff := w.MaxRetries, w.RetryBackoff
+	if maxRetries == 0 {
+		maxRetries = defaultMaxRetries
+	}
+	if backoff == 0 {
+		backoff = defaultRetryBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		var retryable bool
+		retryable, err = w.post(ctx, e)
+		if err == nil || !retryable || attempt >= maxRetries {
+			break
+		}
+		if err = sleep(ctx, backoff<<attempt); err != nil {
+			break
+		}
+	}
+	w.record(err == nil)
+	return
+}
+
+// post the event, returning whether a failed request can be retried.
+func (w *Webhook) post(ctx context.Context, e outboundEvent) (retryable bool, err error) {
+	body := []byte(aws.ToString(e.entry.Detail))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventTypeHeader, aws.ToString(e.entry.DetailType))
+	if e.id != "" {
+		req.Header.Set(WebhookEventIDHeader, e.id)
+	}
+	timestamp := strconv.FormatInt(w.now().Unix(), 10)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	mac := hmac.New(sha256.New, w.Secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retryable = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retryable, fmt.Errorf("unexpected status %d", resp.StatusCode)
+}
+
+func (w *Webhook) now() time.Time {
+	if w.Clock == nil {
+		return stream.SystemClock.Now()
+	}
+	return w.Clock.Now()
+}
+
+func (w *Webhook) isOpen() bool {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.now().Before(w.openUntil)
+}
+
+// record the result of a delivery, opening the circuit after FailureThreshold consecutive
+// failures.
+func (w *Webhook) record(ok bool) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if ok {
+		w.failures = 0
+		return
+	}
+	w.failures++
+	threshold, cooldown := w.FailureThreshold, w.Cooldown
+	if threshold == 0 {
+		threshold = defaultWebhookFailureThreshold
+	}
+	if cooldown == 0 {
+		cooldown = defaultWebhookCooldown
+	}
+	if w.failures >= threshold {
+		w.failures = 0
+		w.openUntil = w.now().Add(cooldown)
+	}
+}
@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/a-h/stream/webhook"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+// webhookServer records the event types that it receives, and fails the first failures
+// requests.
+type webhookServer struct {
+	m        sync.Mutex
+	failures int
+	verify   webhook.Verifier
+	received []string
+	requests int
+}
+
+func (s *webhookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.requests++
+	if s.requests <= s.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	if err := s.verify(r, body); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	s.received = append(s.received, r.Header.Get(WebhookEventTypeHeader))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestWebhooks(t *testing.T) {
+	var tests = []struct {
+		name             string
+		failures         int
+		detailTypes      []string
+		expectError      bool
+		expectedReceived []string
+		expectedRequests int
+	}{
+		{
+			name:             "signed events are sent to the endpoint",
+			expectedReceived: []string{"PaymentTaken", "PaymentRefunded"},
+			expectedRequests: 2,
+		},
+		{
+			name:             "endpoints can receive selected events",
+			detailTypes:      []string{"PaymentRefunded"},
+			expectedReceived: []string{"PaymentRefunded"},
+			expectedRequests: 1,
+		},
+		{
+			name:             "failed requests are retried",
+			failures:         2,
+			expectedReceived: []string{"PaymentTaken", "PaymentRefunded"},
+			expectedRequests: 4,
+		},
+		{
+			name:             "the entity's later events aren't sent after a failure",
+			failures:         10,
+			expectError:      true,
+			expectedRequests: 3,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			secret := []byte("secret")
+			server := &webhookServer{
+				failures: test.failures,
+				verify:   webhook.Stream(secret, time.Minute),
+			}
+			s := httptest.NewServer(server)
+			defer s.Close()
+			h := newTestHandler(Config{
+				Webhooks: []*Webhook{
+					{
+						URL:          s.URL,
+						Secret:       secret,
+						DetailTypes:  test.detailTypes,
+						MaxRetries:   2,
+						RetryBackoff: time.Millisecond,
+					},
+				},
+			})
+			refunded := outboundRecord("INSERT", "PaymentRefunded", false)
+			refunded.Change.NewImage["_sk"] = events.NewStringAttribute("OUTBOUND/2/0/PaymentRefunded")
+			event := events.DynamoDBEvent{
+				Records: []events.DynamoDBEventRecord{outboundRecord("INSERT", "PaymentTaken", false), refunded},
+			}
+
+			// Act.
+			err := h.HandleRequest(context.Background(), event)
+
+			// Assert.
+			if test.expectError != (err != nil) {
+				t.Errorf("expected error %v, got %v", test.expectError, err)
+			}
+			if diff := cmp.Diff(test.expectedReceived, server.received); diff != "" {
+				t.Errorf("unexpected events received: %s", diff)
+			}
+			if server.requests != test.expectedRequests {
+				t.Errorf("expected %d requests, got %d", test.expectedRequests, server.requests)
+			}
+		})
+	}
+}
+
+func TestWebhookCircuitOpensAfterConsecutiveFailures(t *testing.T) {
+	// Arrange.
+	server := &webhookServer{failures: 100}
+	s := httptest.NewServer(server)
+	defer s.Close()
+	w := &Webhook{
+		URL:              s.URL,
+		MaxRetries:       -1,
+		FailureThreshold: 2,
+		Cooldown:         time.Hour,
+	}
+
+	// Act.
+	var errs []error
+	for i := 0; i < 3; i++ {
+		errs = append(errs, w.send(context.Background(), outboundEvent{}))
+	}
+
+	// Assert.
+	if errors.Is(errs[0], ErrCircuitOpen) || errors.Is(errs[1], ErrCircuitOpen) {
+		t.Errorf("expected the circuit to be closed for the first failures, got %v", errs)
+	}
+	if !errors.Is(errs[2], ErrCircuitOpen) {
+		t.Errorf("expected the circuit to be open, got %v", errs[2])
+	}
+	if server.requests != 2 {
+		t.Errorf("expected 2 requests, got %d", server.requests)
+	}
+}
+
+func TestWebhookEventsAreSkippedWhileTheCircuitIsOpen(t *testing.T) {
+	// Arrange.
+	dlq := &mockDeadLetterQueue{}
+	w := &Webhook{URL: "http://localhost", Cooldown: time.Hour}
+	w.openUntil = time.Now().Add(time.Hour)
+	h := newTestHandler(Config{Webhooks: []*Webhook{w}, DeadLetterQueue: dlq})
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{outboundRecord("INSERT", "PaymentTaken", false)},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), event)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("expected the batch to succeed, got %v", err)
+	}
+	if len(dlq.letters) != 1 || dlq.letters[0].DetailType != "PaymentTaken" {
+		t.Errorf("expected the event to be dead lettered, got %+v", dlq.letters)
+	}
+}
+
+func TestWebhookRetriesOnlySendToEndpointsThatFailed(t *testing.T) {
+	// Arrange.
+	secret := []byte("secret")
+	healthy := &webhookServer{verify: webhook.Stream(secret, time.Minute)}
+	failing := &webhookServer{failures: 1, verify: webhook.Stream(secret, time.Minute)}
+	hs, fs := httptest.NewServer(healthy), httptest.NewServer(failing)
+	defer hs.Close()
+	defer fs.Close()
+	h := newTestHandler(Config{
+		Webhooks: []*Webhook{
+			{URL: hs.URL, Secret: secret, MaxRetries: -1},
+			{URL: fs.URL, Secret: secret, MaxRetries: -1},
+		},
+	})
+	// The handler removes the library's attributes from the records that it sends, so each
+	// attempt needs a new event.
+	newEvent := func() events.DynamoDBEvent {
+		record := outboundRecord("INSERT", "PaymentTaken", false)
+		record.Change.NewImage["_id"] = events.NewStringAttribute("event-1")
+		return events.DynamoDBEvent{Records: []events.DynamoDBEventRecord{record}}
+	}
+
+	// Act.
+	firstErr := h.HandleRequest(context.Background(), newEvent())
+	secondErr := h.HandleRequest(context.Background(), newEvent())
+
+	// Assert.
+	if firstErr == nil {
+		t.Error("expected the first attempt to fail")
+	}
+	if secondErr != nil {
+		t.Errorf("expected the retry to succeed, got %v", secondErr)
+	}
+	if healthy.requests != 1 {
+		t.Errorf("expected the healthy endpoint to receive the event once, got %d requests", healthy.requests)
+	}
+	if failing.requests != 2 {
+		t.Errorf("expected the failing endpoint to be retried, got %d requests", failing.requests)
+	}
+}
@@ -0,0 +1,73 @@
+package stream
+
+// Hooks are called by the Processor, e.g. to apply validation, logging or metrics, or to
+// enrich events, in one place rather than in every State. Nil hooks are skipped, and an
+// error returned by a hook stops processing.
+type Hooks struct {
+	// BeforeProcess is called before each inbound event is passed to the state. The
+	// returned event is processed and stored instead, e.g. to add a timestamp.
+	BeforeProcess func(p *Processor, event InboundEvent) (InboundEvent, error)
+	// AfterProcess is called after the state has processed each inbound event. The
+	// returned outbound events are stored instead of the events emitted by the state.
+	AfterProcess func(p *Processor, event InboundEvent, outbound []OutboundEvent) ([]OutboundEvent, error)
+	// BeforePersist is called with all of the inbound and outbound events, before the
+	// transaction is prepared.
+	BeforePersist func(p *Processor, inbound []InboundEvent, outbound []OutboundEvent) error
+	// AfterPersist is called after the transaction has been executed, with the error
+	// returned by the store, if any.
+	AfterPersist func(p *Processor, err error)
+}
+
+// WithHooks adds hooks to the processor. If the option is used more than once, the hooks
+// are called in the order that they were added.
+func WithHooks(h Hooks) ProcessorOption {
+	return func(p *Processor) {
+		p.hooks = append(p.hooks, h)
+	}
+}
+
+func (p *Processor) beforeProcess(event InboundEvent) (InboundEvent, error) {
+	var err error
+	for _, h := range p.hooks {
+		if h.BeforeProcess == nil {
+			continue
+		}
+		if event, err = h.BeforeProcess(p, event); err != nil {
+			return nil, err
+		}
+	}
+	return event, nil
+}
+
+func (p *Processor) afterProcess(event InboundEvent, outbound []OutboundEvent) ([]OutboundEvent, error) {
+	var err error
+	for _, h := range p.hooks {
+		if h.AfterProcess == nil {
+			continue
+		}
+		if outbound, err = h.AfterProcess(p, event, outbound); err != nil {
+			return nil, err
+		}
+	}
+	return outbound, nil
+}
+
+func (p *Processor) beforePersist(inbound []InboundEvent, outbound []OutboundEvent) error {
+	for _, h := range p.hooks {
+		if h.BeforePersist == nil {
+			continue
+		}
+		if err := h.BeforePersist(p, inbound, outbound); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Processor) afterPersist(err error) {
+	for _, h := range p.hooks {
+		if h.AfterPersist != nil {
+			h.AfterPersist(p, err)
+		}
+	}
+}
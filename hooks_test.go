@@ -0,0 +1,88 @@
+package stream
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHooks(t *testing.T) {
+	// Arrange.
+	store := &putStore{
+		states:    map[string]AverageState{},
+		sequences: map[string]int64{},
+	}
+	var calls []string
+	hooks := Hooks{
+		BeforeProcess: func(p *Processor, event InboundEvent) (InboundEvent, error) {
+			calls = append(calls, "BeforeProcess")
+			e := event.(Add)
+			e.Number *= 10
+			return e, nil
+		},
+		AfterProcess: func(p *Processor, event InboundEvent, outbound []OutboundEvent) ([]OutboundEvent, error) {
+			calls = append(calls, "AfterProcess")
+			return outbound[:1], nil
+		},
+		BeforePersist: func(p *Processor, inbound []InboundEvent, outbound []OutboundEvent) error {
+			calls = append(calls, "BeforePersist")
+			if diff := cmp.Diff([]InboundEvent{Add{Number: 10}}, inbound); diff != "" {
+				t.Errorf("expected the enriched inbound events: %s", diff)
+			}
+			return nil
+		},
+		AfterPersist: func(p *Processor, err error) {
+			calls = append(calls, "AfterPersist")
+			if err != nil || p.Sequence() != 1 {
+				t.Errorf("expected the state to be stored, got sequence %d, err %v", p.Sequence(), err)
+			}
+		},
+	}
+	p, err := New(store, "id", &AverageState{}, WithHooks(hooks))
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+
+	// Act.
+	err = p.Process(Add{Number: 1})
+	if err != nil {
+		t.Fatalf("failed to process events: %v", err)
+	}
+
+	// Assert.
+	if diff := cmp.Diff([]string{"BeforeProcess", "AfterProcess", "BeforePersist", "AfterPersist"}, calls); diff != "" {
+		t.Errorf("unexpected hook calls: %s", diff)
+	}
+	if diff := cmp.Diff([]OutboundEvent{Average{Value: 10}}, p.Outbound()); diff != "" {
+		t.Errorf("expected the outbound events returned by AfterProcess: %s", diff)
+	}
+}
+
+func TestHookErrorsStopProcessing(t *testing.T) {
+	// Arrange.
+	store := &putStore{
+		states:    map[string]AverageState{},
+		sequences: map[string]int64{},
+	}
+	errRejected := errors.New("rejected")
+	p, err := New(store, "id", &AverageState{}, WithHooks(Hooks{
+		BeforePersist: func(p *Processor, inbound []InboundEvent, outbound []OutboundEvent) error {
+			return errRejected
+		},
+	}))
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+
+	// Act.
+	err = p.Process(Add{Number: 1})
+
+	// Assert.
+	if !errors.Is(err, errRejected) {
+		t.Errorf("expected the hook's error, got %v", err)
+	}
+	if len(store.states) != 0 {
+		t.Error("expected nothing to be stored")
+	}
+}
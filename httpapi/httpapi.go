@@ -0,0 +1,301 @@
+// Package httpapi builds HTTP handlers that process inbound events against an entity,
+// so that each API endpoint doesn't need to extract the ID, load the state, process the
+// event, map errors to status codes, and write the response.
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/a-h/stream"
+	"go.uber.org/zap"
+)
+
+// Extractor reads a value, such as the entity ID, from a request.
+type Extractor func(r *http.Request) (string, error)
+
+// FromPath reads a variable from the request path, using a pattern such as
+// "*/machine/{id}". Each segment of the pattern matches a segment of the path, and a
+// leading "*" matches any prefix, e.g. the API Gateway stage.
+func FromPath(pattern, name string) Extractor {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	return func(r *http.Request) (v string, err error) {
+		pathSegments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		ps := patternSegments
+		if len(ps) > 0 && ps[0] == "*" {
+			ps = ps[1:]
+			if len(pathSegments) < len(ps) {
+				return "", fmt.Errorf("path does not match %q", pattern)
+			}
+			pathSegments = pathSegments[len(pathSegments)-len(ps):]
+		}
+		if len(pathSegments) != len(ps) {
+			return "", fmt.Errorf("path does not match %q", pattern)
+		}
+		for i, segment := range ps {
+			if segment == "{"+name+"}" {
+				v = pathSegments[i]
+				continue
+			}
+			if !strings.HasPrefix(segment, "{") && segment != pathSegments[i] {
+				return "", fmt.Errorf("path does not match %q", pattern)
+			}
+		}
+		if v == "" {
+			err = fmt.Errorf("missing %s in path", name)
+		}
+		return
+	}
+}
+
+// Decoder creates the inbound event to process from the request and its body. It returns
+// nil to process no events, e.g. to create an entity.
+type Decoder func(r *http.Request, body []byte) (stream.InboundEvent, error)
+
+// JSON decodes the request body into T. An empty body decodes to the zero value of T.
+func JSON[T stream.InboundEvent]() Decoder {
+	return func(r *http.Request, body []byte) (stream.InboundEvent, error) {
+		var e T
+		if len(body) == 0 {
+			return e, nil
+		}
+		err := json.Unmarshal(body, &e)
+		return e, err
+	}
+}
+
+// Empty processes no inbound events, e.g. to create an entity.
+func Empty() Decoder {
+	return func(r *http.Request, body []byte) (stream.InboundEvent, error) {
+		return nil, nil
+	}
+}
+
+// Handler processes the inbound event decoded from each POST request against the entity
+// with the ID read from the request, and responds with the state as JSON.
+type Handler struct {
+	Store    stream.Store
+	NewState func(id string) stream.State
+	ID       Extractor
+	Decode   Decoder
+	// Statuses map domain errors returned by the state to status codes, matched with
+	// errors.Is. Other errors are logged and return 500 Internal Server Error.
+	Statuses map[error]int
+	// Create the entity if it doesn't exist. If false, requests for entities that don't
+	// exist return 404 Not Found. Defaults to true.
+	Create bool
+	// MaxRetries is the number of times that processing is retried if the state is updated
+	// concurrently. Defaults to 3.
+	MaxRetries int
+	// MaxBodyBytes limits the size of the request body. Defaults to 1MB.
+	MaxBodyBytes     int64
+	ProcessorOptions []stream.ProcessorOption
+	Log              *zap.Logger
+}
+
+// Option configures a Handler.
+type Option func(*Handler)
+
+// WithStatus returns the status code for errors that match err, e.g. a domain error
+// returned by the state.
+func WithStatus(err error, status int) Option {
+	return func(h *Handler) {
+		h.Statuses[err] = status
+	}
+}
+
+// WithCreate sets whether the entity is created if it doesn't exist.
+func WithCreate(do bool) Option {
+	return func(h *Handler) {
+		h.Create = do
+	}
+}
+
+// WithMaxRetries sets the number of times that processing is retried after an optimistic
+// concurrency error.
+func WithMaxRetries(n int) Option {
+	return func(h *Handler) {
+		h.MaxRetries = n
+	}
+}
+
+// WithMaxBodyBytes limits the size of the request body.
+func WithMaxBodyBytes(n int64) Option {
+	return func(h *Handler) {
+		h.MaxBodyBytes = n
+	}
+}
+
+// WithProcessorOptions applies the options to each Processor created by the handler.
+func WithProcessorOptions(opts ...stream.ProcessorOption) Option {
+	return func(h *Handler) {
+		h.ProcessorOptions = append(h.ProcessorOptions, opts...)
+	}
+}
+
+// WithLogger logs errors that return 500 Internal Server Error.
+func WithLogger(log *zap.Logger) Option {
+	return func(h *Handler) {
+		h.Log = log
+	}
+}
+
+// New creates a Handler that processes the events returned by decode against the entity
+// returned by id. If the entity doesn't exist, it's created, unless WithCreate(false) is
+// passed.
+//
+//	h := httpapi.New(store, newState, httpapi.FromPath("*/machine/{id}/insertCoin", "id"),
+//		httpapi.JSON[models.InsertCoin](),
+//		httpapi.WithStatus(models.ErrCannotInsertCoin, http.StatusNotAcceptable))
+func New(store stream.Store, newState func(id string) stream.State, id Extractor, decode Decoder, opts ...Option) *Handler {
+	h := &Handler{
+		Store:        store,
+		NewState:     newState,
+		ID:           id,
+		Decode:       decode,
+		Statuses:     make(map[error]int),
+		Create:       true,
+		MaxRetries:   3,
+		MaxBodyBytes: 1 << 20,
+		Log:          zap.NewNop(),
+	}
+	for _, o := range opts {
+		o(h)
+	}
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := h.ID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.MaxBodyBytes))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusRequestEntityTooLarge)
+		return
+	}
+	event, err := h.Decode(r, body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode body: %v", err), http.StatusBadRequest)
+		return
+	}
+	var events []stream.InboundEvent
+	if event != nil {
+		if err = stream.ValidateEvent(event); err != nil {
+			h.writeError(w, err)
+			return
+		}
+		events = append(events, event)
+	}
+	state, err := h.process(r, id, events)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, state)
+}
+
+// process the events, retrying if the state is updated concurrently.
+func (h *Handler) process(r *http.Request, id string, events []stream.InboundEvent) (state stream.State, err error) {
+	client := stream.NewNamespaceClient(h.Store, h.NewState, stream.WithProcessorOptions[stream.State](h.ProcessorOptions...))
+	for attempt := 0; ; attempt++ {
+		if h.Create {
+			state, err = client.Process(r.Context(), id, events...)
+		} else {
+			state, err = client.Update(r.Context(), id, events...)
+		}
+		if !errors.Is(err, stream.ErrOptimisticConcurrency) || attempt >= h.MaxRetries {
+			return
+		}
+	}
+}
+
+// writeError writes the status code of the error. Schema errors are written as JSON, so
+// that clients can show which fields are invalid.
+func (h *Handler) writeError(w http.ResponseWriter, err error) {
+	var schemaErr *stream.SchemaError
+	if errors.As(err, &schemaErr) {
+		writeJSON(w, http.StatusBadRequest, schemaErr)
+		return
+	}
+	for target, status := range h.Statuses {
+		if errors.Is(err, target) {
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+	switch {
+	case errors.Is(err, stream.ErrStateNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, stream.ErrInvalidEvent):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, stream.ErrInvalidState):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, stream.ErrOptimisticConcurrency):
+		http.Error(w, "the entity was updated concurrently, try again", http.StatusConflict)
+	default:
+		h.Log.Error("failed to process request", zap.Error(err))
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// GetHandler responds to GET requests with the state of the entity as JSON.
+type GetHandler struct {
+	Store    stream.Store
+	NewState func(id string) stream.State
+	ID       Extractor
+	// ReadOptions are passed to the store, e.g. stream.ConsistentRead(false) for cheaper
+	// reads when displaying the entity.
+	ReadOptions []stream.ReadOption
+	Log         *zap.Logger
+}
+
+// NewGet creates a GetHandler for the entity returned by id.
+func NewGet(store stream.Store, newState func(id string) stream.State, id Extractor, opts ...stream.ReadOption) *GetHandler {
+	return &GetHandler{
+		Store:       store,
+		NewState:    newState,
+		ID:          id,
+		ReadOptions: opts,
+		Log:         zap.NewNop(),
+	}
+}
+
+func (h *GetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := h.ID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	state := h.NewState(id)
+	if _, err = stream.GetWithOptions(h.Store, id, state, h.ReadOptions...); err != nil {
+		if errors.Is(err, stream.ErrStateNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		h.Log.Error("failed to get state", zap.String("id", id), zap.Error(err))
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, state)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,304 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/a-h/stream"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+var ErrTooMuch = errors.New("too much")
+
+type Add struct {
+	Amount int    `json:"amount"`
+	UserID string `json:"userId" validate:"required"`
+}
+
+func (Add) EventName() string { return "Add" }
+func (Add) IsInbound()        {}
+
+type Counter struct {
+	Total int `json:"total"`
+}
+
+func (c *Counter) Process(event stream.InboundEvent) (outbound []stream.OutboundEvent, err error) {
+	if e, ok := event.(Add); ok {
+		if e.Amount > 10 {
+			return nil, ErrTooMuch
+		}
+		c.Total += e.Amount
+	}
+	return
+}
+
+// memoryStore stores counters, and returns ErrOptimisticConcurrency for the first conflicts
+// writes.
+type memoryStore struct {
+	stream.Store
+	counters  map[string]Counter
+	conflicts int
+}
+
+func (s *memoryStore) Get(id string, state stream.State) (sequence int64, err error) {
+	c, ok := s.counters[id]
+	if !ok {
+		return 0, stream.ErrStateNotFound
+	}
+	*state.(*Counter) = c
+	return 1, nil
+}
+
+func (s *memoryStore) Prepare(id string, atSequence int64, state stream.State, inbound []stream.InboundEvent, outbound []stream.OutboundEvent) (items []types.TransactWriteItem, err error) {
+	if s.conflicts > 0 {
+		s.conflicts--
+		return nil, stream.ErrOptimisticConcurrency
+	}
+	s.counters[id] = *state.(*Counter)
+	return
+}
+
+func (s *memoryStore) Execute(items []types.TransactWriteItem) error {
+	return nil
+}
+
+func newCounter(id string) stream.State { return &Counter{} }
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name             string
+		method           string
+		path             string
+		body             string
+		decoder          Decoder
+		opts             []Option
+		counters         map[string]Counter
+		conflicts        int
+		expectedStatus   int
+		expectedBody     string
+		expectedCounters map[string]Counter
+	}{
+		{
+			name:             "entities are created if they don't exist",
+			method:           http.MethodPost,
+			path:             "/prod/counter/a",
+			decoder:          Empty(),
+			counters:         map[string]Counter{},
+			expectedStatus:   http.StatusOK,
+			expectedBody:     `{"total":0}` + "\n",
+			expectedCounters: map[string]Counter{"a": {}},
+		},
+		{
+			name:             "events are decoded from the body and processed",
+			method:           http.MethodPost,
+			path:             "/prod/counter/a/add",
+			body:             `{"amount":2,"userId":"user"}`,
+			counters:         map[string]Counter{"a": {Total: 1}},
+			expectedStatus:   http.StatusOK,
+			expectedBody:     `{"total":3}` + "\n",
+			expectedCounters: map[string]Counter{"a": {Total: 3}},
+		},
+		{
+			name:             "events are retried if the state is updated concurrently",
+			method:           http.MethodPost,
+			path:             "/prod/counter/a/add",
+			body:             `{"amount":2,"userId":"user"}`,
+			counters:         map[string]Counter{"a": {Total: 1}},
+			conflicts:        2,
+			expectedStatus:   http.StatusOK,
+			expectedBody:     `{"total":3}` + "\n",
+			expectedCounters: map[string]Counter{"a": {Total: 3}},
+		},
+		{
+			name:             "concurrency errors return a conflict after the retries",
+			method:           http.MethodPost,
+			path:             "/prod/counter/a/add",
+			body:             `{"amount":2,"userId":"user"}`,
+			counters:         map[string]Counter{"a": {Total: 1}},
+			conflicts:        4,
+			expectedStatus:   http.StatusConflict,
+			expectedBody:     "the entity was updated concurrently, try again\n",
+			expectedCounters: map[string]Counter{"a": {Total: 1}},
+		},
+		{
+			name:             "domain errors are mapped to status codes",
+			method:           http.MethodPost,
+			path:             "/prod/counter/a/add",
+			body:             `{"amount":11,"userId":"user"}`,
+			opts:             []Option{WithStatus(ErrTooMuch, http.StatusNotAcceptable)},
+			counters:         map[string]Counter{"a": {Total: 1}},
+			expectedStatus:   http.StatusNotAcceptable,
+			expectedBody:     "too much\n",
+			expectedCounters: map[string]Counter{"a": {Total: 1}},
+		},
+		{
+			name:             "unmapped errors return an internal server error",
+			method:           http.MethodPost,
+			path:             "/prod/counter/a/add",
+			body:             `{"amount":11,"userId":"user"}`,
+			counters:         map[string]Counter{"a": {Total: 1}},
+			expectedStatus:   http.StatusInternalServerError,
+			expectedBody:     "internal server error\n",
+			expectedCounters: map[string]Counter{"a": {Total: 1}},
+		},
+		{
+			name:             "invalid events return the schema violations",
+			method:           http.MethodPost,
+			path:             "/prod/counter/a/add",
+			body:             `{"amount":2}`,
+			counters:         map[string]Counter{"a": {Total: 1}},
+			expectedStatus:   http.StatusBadRequest,
+			expectedBody:     `{"event":"Add","violations":[{"field":"userId","rule":"required","message":"is required"}]}` + "\n",
+			expectedCounters: map[string]Counter{"a": {Total: 1}},
+		},
+		{
+			name:             "bodies that can't be decoded are bad requests",
+			method:           http.MethodPost,
+			path:             "/prod/counter/a/add",
+			body:             `{`,
+			counters:         map[string]Counter{},
+			expectedStatus:   http.StatusBadRequest,
+			expectedBody:     "failed to decode body: unexpected end of JSON input\n",
+			expectedCounters: map[string]Counter{},
+		},
+		{
+			name:             "entities that don't exist aren't created if creation is disabled",
+			method:           http.MethodPost,
+			path:             "/prod/counter/a/add",
+			body:             `{"amount":2,"userId":"user"}`,
+			opts:             []Option{WithCreate(false)},
+			counters:         map[string]Counter{},
+			expectedStatus:   http.StatusNotFound,
+			expectedBody:     "not found\n",
+			expectedCounters: map[string]Counter{},
+		},
+		{
+			name:             "paths that don't match are not found",
+			method:           http.MethodPost,
+			path:             "/prod/other/a/add",
+			counters:         map[string]Counter{},
+			expectedStatus:   http.StatusNotFound,
+			expectedBody:     "path does not match \"*/counter/{id}/add\"\n",
+			expectedCounters: map[string]Counter{},
+		},
+		{
+			name:             "only POST requests are processed",
+			method:           http.MethodGet,
+			path:             "/prod/counter/a/add",
+			counters:         map[string]Counter{},
+			expectedStatus:   http.StatusMethodNotAllowed,
+			expectedBody:     "method not allowed\n",
+			expectedCounters: map[string]Counter{},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			store := &memoryStore{counters: test.counters, conflicts: test.conflicts}
+			pattern, decoder := "*/counter/{id}/add", JSON[Add]()
+			if test.decoder != nil {
+				pattern, decoder = "*/counter/{id}", test.decoder
+			}
+			h := New(store, newCounter, FromPath(pattern, "id"), decoder, test.opts...)
+			r := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			w := httptest.NewRecorder()
+
+			// Act.
+			h.ServeHTTP(w, r)
+
+			// Assert.
+			if w.Code != test.expectedStatus {
+				t.Errorf("expected status %d, got %d", test.expectedStatus, w.Code)
+			}
+			if diff := cmp.Diff(test.expectedBody, w.Body.String()); diff != "" {
+				t.Errorf("unexpected body: %s", diff)
+			}
+			if diff := cmp.Diff(test.expectedCounters, store.counters); diff != "" {
+				t.Errorf("unexpected counters: %s", diff)
+			}
+		})
+	}
+}
+
+func TestGetHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "the state is returned as JSON",
+			path:           "/counter/a",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"total":5}` + "\n",
+		},
+		{
+			name:           "entities that don't exist are not found",
+			path:           "/counter/b",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "not found\n",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			store := &memoryStore{counters: map[string]Counter{"a": {Total: 5}}}
+			h := NewGet(store, newCounter, FromPath("*/counter/{id}", "id"))
+			r := httptest.NewRequest(http.MethodGet, test.path, nil)
+			w := httptest.NewRecorder()
+
+			// Act.
+			h.ServeHTTP(w, r)
+
+			// Assert.
+			if w.Code != test.expectedStatus {
+				t.Errorf("expected status %d, got %d", test.expectedStatus, w.Code)
+			}
+			if diff := cmp.Diff(test.expectedBody, w.Body.String()); diff != "" {
+				t.Errorf("unexpected body: %s", diff)
+			}
+		})
+	}
+}
+
+func TestFromPath(t *testing.T) {
+	tests := []struct {
+		pattern     string
+		path        string
+		expected    string
+		expectedErr bool
+	}{
+		{pattern: "/machine/{id}", path: "/machine/a", expected: "a"},
+		{pattern: "*/machine/{id}", path: "/prod/machine/a", expected: "a"},
+		{pattern: "*/machine/{id}", path: "/machine/a", expected: "a"},
+		{pattern: "*/machine/{id}/insertCoin", path: "/prod/machine/a/insertCoin", expected: "a"},
+		{pattern: "*/machine/{id}/insertCoin", path: "/prod/machine/a/pullHandle", expectedErr: true},
+		{pattern: "/machine/{id}", path: "/prod/machine/a", expectedErr: true},
+		{pattern: "/machine/{id}", path: "/machine/", expectedErr: true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.pattern+" "+test.path, func(t *testing.T) {
+			// Arrange.
+			r := httptest.NewRequest(http.MethodGet, test.path, nil)
+
+			// Act.
+			actual, err := FromPath(test.pattern, "id")(r)
+
+			// Assert.
+			if (err != nil) != test.expectedErr {
+				t.Fatalf("expected error %v, got %v", test.expectedErr, err)
+			}
+			if actual != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// JSONSchema is a JSON Schema that events are validated against. The type, enum, const,
+// required, properties, additionalProperties, items, minimum, maximum, exclusiveMinimum,
+// exclusiveMaximum, minLength, maxLength, pattern, minItems and maxItems keywords are
+// supported. Other keywords are ignored.
+type JSONSchema struct {
+	Type                 schemaTypes            `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Const                *interface{}           `json:"const"`
+	Required             []string               `json:"required"`
+	Properties           map[string]*JSONSchema `json:"properties"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *JSONSchema            `json:"items"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	ExclusiveMinimum     *float64               `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *float64               `json:"exclusiveMaximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Pattern              string                 `json:"pattern"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	pattern              *regexp.Regexp
+}
+
+// schemaTypes is the type keyword, which can be a string or an array of strings.
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("type must be a string or an array of strings: %w", err)
+	}
+	*t = multiple
+	return nil
+}
+
+// ParseJSONSchema parses a JSON Schema.
+func ParseJSONSchema(schema []byte) (s *JSONSchema, err error) {
+	s = &JSONSchema{}
+	if err = json.Unmarshal(schema, s); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	if err = s.compile(); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	return
+}
+
+func (s *JSONSchema) compile() (err error) {
+	if s.Pattern != "" {
+		if s.pattern, err = regexp.Compile(s.Pattern); err != nil {
+			return
+		}
+	}
+	for _, p := range s.Properties {
+		if err = p.compile(); err != nil {
+			return
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+	return
+}
+
+// Validate the JSON document against the schema.
+func (s *JSONSchema) Validate(eventName string, document []byte) error {
+	d := json.NewDecoder(bytes.NewReader(document))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return &SchemaError{Event: eventName, Violations: []SchemaViolation{{Rule: "json", Message: err.Error()}}}
+	}
+	se := &SchemaError{Event: eventName}
+	s.validate(v, "", se)
+	if len(se.Violations) > 0 {
+		return se
+	}
+	return nil
+}
+
+func (s *JSONSchema) validate(v interface{}, path string, se *SchemaError) {
+	violation := func(rule, format string, args ...interface{}) {
+		se.Violations = append(se.Violations, SchemaViolation{Field: path, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+	if len(s.Type) > 0 && !s.matchesType(v) {
+		violation("type", "must be of type %s", strings.Join(s.Type, " or "))
+		return
+	}
+	if s.Enum != nil && !containsJSON(s.Enum, v) {
+		violation("enum", "must be one of the allowed values")
+	}
+	if s.Const != nil && !equalJSON(*s.Const, v) {
+		violation("const", "must be the constant value")
+	}
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := value[name]; !ok {
+				se.Violations = append(se.Violations, SchemaViolation{Field: joinPath(path, name), Rule: "required", Message: "is required"})
+			}
+		}
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if p, ok := s.Properties[name]; ok {
+				p.validate(value[name], joinPath(path, name), se)
+				continue
+			}
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				se.Violations = append(se.Violations, SchemaViolation{Field: joinPath(path, name), Rule: "additionalProperties", Message: "is not allowed"})
+			}
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(value) < *s.MinItems {
+			violation("minItems", "must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(value) > *s.MaxItems {
+			violation("maxItems", "must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range value {
+				s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i), se)
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(value)
+		if s.MinLength != nil && n < *s.MinLength {
+			violation("minLength", "must have a length of at least %d", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			violation("maxLength", "must have a length of at most %d", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(value) {
+			violation("pattern", "must match %s", s.Pattern)
+		}
+	case json.Number:
+		n, _ := value.Float64()
+		if s.Minimum != nil && n < *s.Minimum {
+			violation("minimum", "must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			violation("maximum", "must be at most %v", *s.Maximum)
+		}
+		if s.ExclusiveMinimum != nil && n <= *s.ExclusiveMinimum {
+			violation("exclusiveMinimum", "must be greater than %v", *s.ExclusiveMinimum)
+		}
+		if s.ExclusiveMaximum != nil && n >= *s.ExclusiveMaximum {
+			violation("exclusiveMaximum", "must be less than %v", *s.ExclusiveMaximum)
+		}
+	}
+}
+
+func (s *JSONSchema) matchesType(v interface{}) bool {
+	for _, t := range s.Type {
+		switch value := v.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case json.Number:
+			if t == "number" {
+				return true
+			}
+			if t == "integer" {
+				f, err := value.Float64()
+				if err == nil && f == math.Trunc(f) {
+					return true
+				}
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func containsJSON(values []interface{}, v interface{}) bool {
+	for _, value := range values {
+		if equalJSON(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalJSON compares values decoded from the schema and the document, which may represent
+// numbers differently.
+func equalJSON(a, b interface{}) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+// JSONSchemas maps event names to the JSON Schemas that the JSON encoding of the events
+// must match.
+type JSONSchemas map[string]*JSONSchema
+
+// Add the schema for the event name.
+func (s JSONSchemas) Add(eventName string, schema []byte) error {
+	parsed, err := ParseJSONSchema(schema)
+	if err != nil {
+		return fmt.Errorf("%s: %w", eventName, err)
+	}
+	s[eventName] = parsed
+	return nil
+}
+
+// ValidateJSON validates the JSON document, e.g. the detail of an inbound event, against
+// the schema of the event name. Events without a schema are valid.
+func (s JSONSchemas) ValidateJSON(eventName string, document []byte) error {
+	schema, ok := s[eventName]
+	if !ok {
+		return nil
+	}
+	return schema.Validate(eventName, document)
+}
+
+// Validate the JSON encoding of the inbound or outbound event against its schema.
+func (s JSONSchemas) Validate(e interface{ EventName() string }) error {
+	schema, ok := s[e.EventName()]
+	if !ok {
+		return nil
+	}
+	document, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", e.EventName(), err)
+	}
+	return schema.Validate(e.EventName(), document)
+}
+
+// WithJSONSchemas validates the inbound and outbound events written by the store against
+// their schemas, so that malformed events are rejected before they're stored or sent.
+func WithJSONSchemas(schemas JSONSchemas) StoreOption {
+	return func(o *StoreOptions) error {
+		o.JSONSchemas = schemas
+		return nil
+	}
+}
+
+func (ddb *DynamoDBStore) validateJSONSchemas(inbound []InboundEvent, outbound []OutboundEvent) error {
+	if len(ddb.JSONSchemas) == 0 {
+		return nil
+	}
+	for _, e := range inbound {
+		if err := ddb.JSONSchemas.Validate(e); err != nil {
+			return err
+		}
+	}
+	for _, e := range outbound {
+		if err := ddb.JSONSchemas.Validate(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package stream
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const pullHandleSchema = `{
+	"type": "object",
+	"required": ["UserID", "Stake"],
+	"additionalProperties": false,
+	"properties": {
+		"UserID": {"type": "string", "minLength": 1, "pattern": "^user_"},
+		"Stake": {"type": "integer", "minimum": 1, "maximum": 10}
+	}
+}`
+
+func TestJSONSchema(t *testing.T) {
+	var tests = []struct {
+		name     string
+		document string
+		expected []SchemaViolation
+	}{
+		{
+			name:     "valid documents have no violations",
+			document: `{"UserID":"user_1","Stake":5}`,
+		},
+		{
+			name:     "required properties must be present",
+			document: `{"Stake":5}`,
+			expected: []SchemaViolation{{Field: "UserID", Rule: "required", Message: "is required"}},
+		},
+		{
+			name:     "types are checked",
+			document: `{"UserID":"user_1","Stake":1.5}`,
+			expected: []SchemaViolation{{Field: "Stake", Rule: "type", Message: "must be of type integer"}},
+		},
+		{
+			name:     "ranges, patterns and additional properties are checked",
+			document: `{"UserID":"admin","Stake":11,"Extra":true}`,
+			expected: []SchemaViolation{
+				{Field: "Extra", Rule: "additionalProperties", Message: "is not allowed"},
+				{Field: "Stake", Rule: "maximum", Message: "must be at most 10"},
+				{Field: "UserID", Rule: "pattern", Message: "must match ^user_"},
+			},
+		},
+	}
+	schema, err := ParseJSONSchema([]byte(pullHandleSchema))
+	if err != nil {
+		t.Fatalf("failed to parse schema: %v", err)
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Act.
+			err := schema.Validate("PullHandle", []byte(test.document))
+
+			// Assert.
+			if test.expected == nil {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			var se *SchemaError
+			if !errors.As(err, &se) {
+				t.Fatalf("expected a *SchemaError, got %v", err)
+			}
+			if diff := cmp.Diff(test.expected, se.Violations); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestStoreValidatesJSONSchemas(t *testing.T) {
+	// Arrange.
+	schemas := JSONSchemas{}
+	if err := schemas.Add("PullHandle", []byte(pullHandleSchema)); err != nil {
+		t.Fatalf("failed to add schema: %v", err)
+	}
+	if err := schemas.Add("Average", []byte(`{"type":"object","properties":{"Value":{"type":"number","minimum":0}}}`)); err != nil {
+		t.Fatalf("failed to add schema: %v", err)
+	}
+	s, err := NewStore("table", "SlotMachine", WithRegion(region), WithClient(testClient), WithJSONSchemas(schemas))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	// Act.
+	_, validErr := s.Prepare("id", 0, &AverageState{}, []InboundEvent{PullHandle{UserID: "user_1", Stake: 1}}, []OutboundEvent{Average{Value: 1}})
+	_, inboundErr := s.Prepare("id", 0, &AverageState{}, []InboundEvent{PullHandle{UserID: "user_1"}}, nil)
+	_, outboundErr := s.Prepare("id", 0, &AverageState{}, nil, []OutboundEvent{Average{Value: -1}})
+
+	// Assert.
+	if validErr != nil {
+		t.Errorf("expected valid events to be accepted, got %v", validErr)
+	}
+	if !errors.Is(inboundErr, ErrInvalidEvent) {
+		t.Errorf("expected the invalid inbound event to be rejected, got %v", inboundErr)
+	}
+	if !errors.Is(outboundErr, ErrInvalidEvent) {
+		t.Errorf("expected the invalid outbound event to be rejected, got %v", outboundErr)
+	}
+}
+
+func TestParseJSONSchemaRejectsInvalidSchemas(t *testing.T) {
+	if _, err := ParseJSONSchema([]byte(`{"type":"string","pattern":"("}`)); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+	if _, err := ParseJSONSchema([]byte(`{"type":1}`)); err == nil {
+		t.Error("expected an error for an invalid type")
+	}
+}
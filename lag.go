@@ -0,0 +1,113 @@
+package stream
+
+import (
+	"context"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// CheckpointReader returns how far a consumer of outbound events has got with an entity.
+// It's implemented by the consumer's checkpoint storage.
+type CheckpointReader interface {
+	// GetCheckpoint returns the sequence of the latest outbound events of the entity that the
+	// consumer has processed, or zero if it hasn't processed any.
+	GetCheckpoint(consumer, id string) (sequence int64, err error)
+}
+
+// ConsumerLag is how far behind a consumer is with an entity's outbound events.
+type ConsumerLag struct {
+	Consumer string
+	ID       string
+	// Latest is the sequence of the latest outbound events that were stored.
+	Latest int64
+	// Checkpoint is the sequence of the latest outbound events processed by the consumer.
+	Checkpoint int64
+	// Lag is the number of transactions with outbound events that haven't been processed.
+	Lag int64
+}
+
+// Lag compares the latest outbound events stored for each entity with the consumers'
+// checkpoints, e.g. to show which projections are behind on a dashboard.
+func (ddb *DynamoDBStore) Lag(ctx context.Context, checkpoints CheckpointReader, consumers []string, ids ...string) (lag []ConsumerLag, err error) {
+	for _, id := range ids {
+		var sequences []int64
+		sequences, err = ddb.getOutboundSequences(ctx, id)
+		if err != nil {
+			return
+		}
+		var latest int64
+		if len(sequences) > 0 {
+			latest = sequences[len(sequences)-1]
+		}
+		for _, consumer := range consumers {
+			var checkpoint int64
+			checkpoint, err = checkpoints.GetCheckpoint(consumer, id)
+			if err != nil {
+				return
+			}
+			var behind int64
+			for _, seq := range sequences {
+				if seq > checkpoint {
+					behind++
+				}
+			}
+			lag = append(lag, ConsumerLag{
+				Consumer:   consumer,
+				ID:         id,
+				Latest:     latest,
+				Checkpoint: checkpoint,
+				Lag:        behind,
+			})
+		}
+	}
+	return
+}
+
+// getOutboundSequences returns the distinct sequence numbers of the entity's outbound events,
+// in ascending order.
+func (ddb *DynamoDBStore) getOutboundSequences(ctx context.Context, id string) (sequences []int64, err error) {
+	qi := &dynamodb.QueryInput{
+		TableName:              ddb.TableName,
+		ConsistentRead:         aws.Bool(!ddb.EventuallyConsistentReads),
+		KeyConditionExpression: aws.String("#_pk = :_pk AND begins_with(#_sk, :_sk)"),
+		ProjectionExpression:   aws.String("#_seq"),
+		ExpressionAttributeNames: map[string]string{
+			"#_pk":  "_pk",
+			"#_sk":  "_sk",
+			"#_seq": "_seq",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":_pk": ddb.attributeValueString(ddb.createPartitionKey(id)),
+			":_sk": ddb.attributeValueString("OUTBOUND/"),
+		},
+		ReturnConsumedCapacity: ddb.returnConsumedCapacity(),
+	}
+	seen := make(map[int64]bool)
+	var pagerError error
+	err = ddb.queryPages(ctx, qi, func(qo *dynamodb.QueryOutput, _ bool) bool {
+		for i := 0; i < len(qo.Items); i++ {
+			var seq int64
+			seq, pagerError = ddb.getRecordSequenceNumber(qo.Items[i])
+			if pagerError != nil {
+				return false
+			}
+			if !seen[seq] {
+				seen[seq] = true
+				sequences = append(sequences, seq)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return
+	}
+	if pagerError != nil {
+		err = pagerError
+		return
+	}
+	sort.Slice(sequences, func(i, j int) bool { return sequences[i] < sequences[j] })
+	return
+}
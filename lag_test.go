@@ -0,0 +1,61 @@
+package stream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type mapCheckpointReader map[string]int64
+
+func (m mapCheckpointReader) GetCheckpoint(consumer, id string) (sequence int64, err error) {
+	return m[consumer+"/"+id], nil
+}
+
+func TestLagIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	// Arrange.
+	name := createLocalTable(t)
+	defer deleteLocalTable(t, name)
+	s, err := NewStore(name, "Average", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	// AverageState emits outbound events for every inbound event.
+	state := &AverageState{}
+	p, err := New(s, "id", state)
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err = p.Process(Add{Number: i}); err != nil {
+			t.Fatalf("failed to process events: %v", err)
+		}
+		if p, err = Load(s, "id", state); err != nil {
+			t.Fatalf("failed to load: %v", err)
+		}
+	}
+	checkpoints := mapCheckpointReader{
+		"upToDate/id": 3,
+		"behind/id":   1,
+	}
+
+	// Act.
+	lag, err := s.Lag(context.Background(), checkpoints, []string{"upToDate", "behind", "new"}, "id")
+	if err != nil {
+		t.Fatalf("failed to get lag: %v", err)
+	}
+
+	// Assert.
+	expected := []ConsumerLag{
+		{Consumer: "upToDate", ID: "id", Latest: 3, Checkpoint: 3, Lag: 0},
+		{Consumer: "behind", ID: "id", Latest: 3, Checkpoint: 1, Lag: 2},
+		{Consumer: "new", ID: "id", Latest: 3, Checkpoint: 0, Lag: 3},
+	}
+	if diff := cmp.Diff(expected, lag); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,87 @@
+package stream
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// EventMetadata is stored with each inbound and outbound event record, and sent with
+// outbound events, so that flows can be traced across services.
+type EventMetadata struct {
+	// CorrelationID is shared by all of the events in a flow, e.g. a request ID.
+	CorrelationID string
+	// CausationID is the ID of the message that caused the events.
+	CausationID string
+	// ActorID is the ID of the user or service that caused the events.
+	ActorID string
+	// FeatureFlags that were active when the inbound events were processed. They're
+	// only stored with inbound events.
+	FeatureFlags FeatureFlags
+	// TraceHeader is the X-Ray trace header, e.g. "Root=1-5759e988-bd862e3fe1be46a994272793;Sampled=1",
+	// that the handler sets on outbound events, so that consumers join the same trace. It's
+	// only stored with outbound events. Use TraceHeader to get it from the context of the
+	// Lambda invocation. NamespaceClient sets it from the context if it's empty.
+	TraceHeader string
+}
+
+// TraceHeader returns the X-Ray trace header of the Lambda invocation from the context, or
+// an empty string if there isn't one.
+func TraceHeader(ctx context.Context) string {
+	th, _ := ctx.Value("x-amzn-trace-id").(string)
+	return th
+}
+
+// WriteOption configures a single write.
+type WriteOption func(*WriteOptions)
+
+// WriteOptions for a single write.
+type WriteOptions struct {
+	Metadata EventMetadata
+	// Items to add to the transaction.
+	Items []types.TransactWriteItem
+}
+
+// WithEventMetadata stores the metadata with each inbound and outbound event record.
+func WithEventMetadata(m EventMetadata) WriteOption {
+	return func(o *WriteOptions) {
+		o.Metadata = m
+	}
+}
+
+func newWriteOptions(opts []WriteOption) (o WriteOptions) {
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return
+}
+
+// stampMetadata adds the metadata attributes to the inbound and outbound records.
+func (ddb *DynamoDBStore) stampMetadata(items []types.TransactWriteItem, m EventMetadata) {
+	attributes := map[string]string{
+		"_correlationId": m.CorrelationID,
+		"_causationId":   m.CausationID,
+		"_actorId":       m.ActorID,
+	}
+	for i := 0; i < len(items); i++ {
+		if items[i].Put == nil {
+			continue
+		}
+		r := items[i].Put.Item
+		prefix, _ := ddb.splitSortKey(r)
+		if prefix != "INBOUND" && prefix != "OUTBOUND" {
+			continue
+		}
+		for k, v := range attributes {
+			if v != "" {
+				r[k] = ddb.attributeValueString(v)
+			}
+		}
+		if flags, ok := ddb.attributeValueFeatureFlags(m.FeatureFlags); ok && prefix == "INBOUND" {
+			r["_flags"] = flags
+		}
+		if m.TraceHeader != "" && prefix == "OUTBOUND" {
+			r["_traceHeader"] = ddb.attributeValueString(m.TraceHeader)
+		}
+	}
+}
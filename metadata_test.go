@@ -0,0 +1,197 @@
+package stream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+type recordingStore struct {
+	Store
+	opts  WriteOptions
+	reads ReadOptions
+}
+
+func (s *recordingStore) Get(id string, state State) (sequence int64, err error) {
+	return 0, ErrStateNotFound
+}
+
+func (s *recordingStore) Execute(items []types.TransactWriteItem) error {
+	return nil
+}
+
+func (s *recordingStore) GetWithOptions(id string, state State, opts ...ReadOption) (sequence int64, err error) {
+	for _, opt := range opts {
+		opt(&s.reads)
+	}
+	return
+}
+
+func (s *recordingStore) PrepareWithOptions(id string, atSequence int64, state State, inbound []InboundEvent, outbound []OutboundEvent, opts ...WriteOption) (items []types.TransactWriteItem, err error) {
+	s.opts = newWriteOptions(opts)
+	return
+}
+
+func TestProcessorPassesMetadataToTheStore(t *testing.T) {
+	// Arrange.
+	store := &recordingStore{}
+	metadata := EventMetadata{
+		CorrelationID: "correlation",
+		CausationID:   "causation",
+		ActorID:       "actor",
+	}
+	p, err := New(store, "id", &AverageState{}, WithMetadata(metadata))
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+
+	// Act.
+	_, err = p.Prepare(Add{Number: 1})
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Assert.
+	if diff := cmp.Diff(metadata, store.opts.Metadata); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestNamespaceClientSetsTheTraceHeaderFromTheContext(t *testing.T) {
+	// Arrange.
+	store := &recordingStore{}
+	client := NewNamespaceClient(store, func(id string) *AverageState { return &AverageState{} })
+	ctx := context.WithValue(context.Background(), "x-amzn-trace-id", "Root=1-5759e988-bd862e3fe1be46a994272793;Sampled=1")
+
+	// Act.
+	_, err := client.Process(ctx, "id", Add{Number: 1})
+	if err != nil {
+		t.Fatalf("failed to process: %v", err)
+	}
+
+	// Assert.
+	if store.opts.Metadata.TraceHeader != "Root=1-5759e988-bd862e3fe1be46a994272793;Sampled=1" {
+		t.Errorf("unexpected trace header %q", store.opts.Metadata.TraceHeader)
+	}
+}
+
+func TestLoadPassesReadOptionsToTheStore(t *testing.T) {
+	// Arrange.
+	store := &recordingStore{reads: ReadOptions{ConsistentRead: true}}
+
+	// Act.
+	_, err := Load(store, "id", &AverageState{}, WithReadOptions(ConsistentRead(false)))
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+
+	// Assert.
+	if store.reads.ConsistentRead {
+		t.Error("expected an eventually consistent read")
+	}
+}
+
+func TestMetadataIsStampedOnEvents(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	// Act.
+	items, err := s.PrepareWithOptions("id", 0, &AverageState{}, []InboundEvent{Add{Number: 1}}, []OutboundEvent{Average{Value: 1}}, WithEventMetadata(EventMetadata{CorrelationID: "correlation"}))
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Assert.
+	if _, ok := items[0].Put.Item["_correlationId"]; ok {
+		t.Error("expected the state record not to have metadata")
+	}
+	for _, item := range items[1:] {
+		v, ok := item.Put.Item["_correlationId"].(*types.AttributeValueMemberS)
+		if !ok || v.Value != "correlation" {
+			t.Errorf("expected correlation ID to be stored, got %v", item.Put.Item["_correlationId"])
+		}
+		if _, ok := item.Put.Item["_actorId"]; ok {
+			t.Error("expected empty metadata not to be stored")
+		}
+	}
+}
+
+func TestEventsAreAssignedUniqueIDs(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	// Act.
+	items, err := s.Prepare("id", 0, &AverageState{}, []InboundEvent{Add{Number: 1}, Add{Number: 2}}, []OutboundEvent{Average{Value: 1}})
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Assert.
+	if id := EventID(items[0].Put.Item); id != "" {
+		t.Errorf("expected the state record not to have an ID, got %q", id)
+	}
+	seen := make(map[string]bool)
+	for _, item := range items[1:] {
+		id := EventID(item.Put.Item)
+		if id == "" {
+			t.Fatalf("expected event %v to have an ID", item.Put.Item["_sk"])
+		}
+		if seen[id] {
+			t.Errorf("duplicate event ID %q", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestTraceHeaderIsStoredOnOutboundEvents(t *testing.T) {
+	var tests = []struct {
+		name        string
+		traceHeader string
+		expected    string
+	}{
+		{
+			name: "without a trace header, none is stored",
+		},
+		{
+			name:        "the trace header can be set in the metadata",
+			traceHeader: "Root=1-67891233-abcdef012345678912345678;Sampled=1",
+			expected:    "Root=1-67891233-abcdef012345678912345678;Sampled=1",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient))
+			if err != nil {
+				t.Fatalf("failed to create store: %v", err)
+			}
+
+			// Act.
+			items, err := s.PrepareWithOptions("id", 0, &AverageState{}, []InboundEvent{Add{Number: 1}}, []OutboundEvent{Average{Value: 1}}, WithEventMetadata(EventMetadata{TraceHeader: test.traceHeader}))
+			if err != nil {
+				t.Fatalf("failed to prepare: %v", err)
+			}
+
+			// Assert.
+			if _, ok := items[1].Put.Item["_traceHeader"]; ok {
+				t.Error("expected inbound events not to store the trace header")
+			}
+			var actual string
+			if v, ok := items[2].Put.Item["_traceHeader"].(*types.AttributeValueMemberS); ok {
+				actual = v.Value
+			}
+			if actual != test.expected {
+				t.Errorf("expected trace header %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
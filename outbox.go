@@ -0,0 +1,19 @@
+package stream
+
+// WithOutbox stores an _outbox attribute on each outbound record, containing the store's
+// partition key prefix, e.g. "SlotMachine/". Create a global secondary index with _outbox
+// as the partition key and _id as the sort key, so that handler.Relay can publish the
+// events that haven't been sent, for environments that can't use DynamoDB Streams. The
+// relay removes the attribute once the event is sent, so the index only contains
+// undispatched events.
+func WithOutbox(do bool) StoreOption {
+	return func(o *StoreOptions) error {
+		o.Outbox = do
+		return nil
+	}
+}
+
+// OutboxPartition is the value of the _outbox attribute of the store's outbound records.
+func (ddb *DynamoDBStore) OutboxPartition() string {
+	return ddb.createPartitionKey("")
+}
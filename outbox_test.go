@@ -0,0 +1,29 @@
+package stream
+
+import "testing"
+
+func TestOutboxAttribute(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Payment", WithRegion(region), WithClient(testClient), WithTenant("tenant"), WithOutbox(true))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	// Act.
+	items, err := s.Prepare("id", 0, &AverageState{}, []InboundEvent{Add{Number: 1}}, []OutboundEvent{Average{Value: 1}})
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Assert.
+	for _, item := range items {
+		outbox := stringAttribute(item.Put.Item, "_outbox")
+		isOutbound := stringAttribute(item.Put.Item, "_typ") == "Average"
+		if isOutbound && outbox != "tenant/Payment/" {
+			t.Errorf("expected outbound records to be in the tenant's outbox, got %q", outbox)
+		}
+		if !isOutbound && outbox != "" {
+			t.Errorf("expected other records not to be in the outbox, got %q", outbox)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package stream
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Priority of an outbound event.
+type Priority int
+
+// Outbound event priorities. Events that don't implement Prioritizer have PriorityNormal.
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+)
+
+// Prioritizer can be implemented by outbound events to set their priority. The handler
+// publishes the outbound events in a stream batch in order of priority, highest first,
+// so that latency-sensitive events, e.g. a payment being authorized, aren't delayed by
+// bulk events. If the HIGH_PRIORITY_EVENT_BUS_NAME environment variable is set, events
+// with a priority above PriorityNormal are sent to that bus instead.
+type Prioritizer interface {
+	Priority() Priority
+}
+
+func (ddb *DynamoDBStore) attributeValuePriority(e OutboundEvent) (av types.AttributeValue, ok bool) {
+	p, isPrioritizer := e.(Prioritizer)
+	if !isPrioritizer || p.Priority() == PriorityNormal {
+		return
+	}
+	return ddb.attributeValueInteger(int64(p.Priority())), true
+}
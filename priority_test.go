@@ -0,0 +1,41 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type PaymentAuthorized struct {
+	Amount int `dynamodbav:"amount"`
+}
+
+func (PaymentAuthorized) EventName() string  { return "PaymentAuthorized" }
+func (PaymentAuthorized) IsOutbound()        {}
+func (PaymentAuthorized) Priority() Priority { return PriorityHigh }
+
+func TestPriorityIsStored(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	// Act.
+	items, err := s.Prepare("id", 0, &AverageState{}, nil, []OutboundEvent{PaymentAuthorized{Amount: 1}, Average{Value: 1}})
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Assert.
+	priority, ok := items[1].Put.Item["_priority"].(*types.AttributeValueMemberN)
+	if !ok {
+		t.Fatalf("expected the priority to be stored, got %v", items[1].Put.Item["_priority"])
+	}
+	if priority.Value != "1" {
+		t.Errorf("expected priority 1, got %s", priority.Value)
+	}
+	if _, ok := items[2].Put.Item["_priority"]; ok {
+		t.Error("expected events with normal priority not to have a priority attribute")
+	}
+}
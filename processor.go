@@ -1,6 +1,7 @@
 package stream
 
 import (
+	"context"
 	"errors"
 	"reflect"
 
@@ -12,6 +13,24 @@ type State interface {
 	Process(event InboundEvent) (outbound []OutboundEvent, err error)
 }
 
+// PartialState is implemented by states that track their own changes. If the store
+// is configured to use partial updates, only the changed attributes are written to the
+// state record, instead of the whole item.
+type PartialState interface {
+	State
+	// Changes returns the attributes that have changed since the state was loaded.
+	Changes() ChangeSet
+}
+
+// ChangeSet describes changes to top-level attributes of the state record. The
+// attribute names must match the names used when the state is stored.
+type ChangeSet struct {
+	// Set the attributes to the values.
+	Set map[string]interface{}
+	// Remove the attributes.
+	Remove []string
+}
+
 // InboundEvents are received from external systems.
 type InboundEvent interface {
 	EventName() string
@@ -32,16 +51,84 @@ type Store interface {
 	Execute(items []types.TransactWriteItem) error
 }
 
+// ReadOptionsStore is implemented by stores that accept options for a single read, e.g.
+// ConsistentRead(false). Stores that don't implement it ignore read options.
+type ReadOptionsStore interface {
+	GetWithOptions(id string, state State, opts ...ReadOption) (sequence int64, err error)
+}
+
+// WriteOptionsStore is implemented by stores that accept options for a single write, e.g.
+// WithEventMetadata. Stores that don't implement it ignore write options.
+type WriteOptionsStore interface {
+	PrepareWithOptions(id string, atSequence int64, state State, inbound []InboundEvent, outbound []OutboundEvent, opts ...WriteOption) (items []types.TransactWriteItem, err error)
+}
+
+// ContextStore is implemented by stores whose requests can be bound to a context, so that
+// they're cancelled with it, e.g. when a Lambda invocation times out.
+type ContextStore interface {
+	WithContext(ctx context.Context) Store
+}
+
+// StoreWithContext returns the store bound to the context, if it implements ContextStore.
+func StoreWithContext(ctx context.Context, store Store) Store {
+	if s, ok := store.(ContextStore); ok {
+		return s.WithContext(ctx)
+	}
+	return store
+}
+
+// GetWithOptions gets the state from the store, passing the options to stores that
+// implement ReadOptionsStore.
+func GetWithOptions(store Store, id string, state State, opts ...ReadOption) (sequence int64, err error) {
+	if s, ok := store.(ReadOptionsStore); ok && len(opts) > 0 {
+		return s.GetWithOptions(id, state, opts...)
+	}
+	return store.Get(id, state)
+}
+
+// PrepareWithOptions prepares the transaction, passing the options to stores that
+// implement WriteOptionsStore.
+func PrepareWithOptions(store Store, id string, atSequence int64, state State, inbound []InboundEvent, outbound []OutboundEvent, opts ...WriteOption) (items []types.TransactWriteItem, err error) {
+	if s, ok := store.(WriteOptionsStore); ok && len(opts) > 0 {
+		return s.PrepareWithOptions(id, atSequence, state, inbound, outbound, opts...)
+	}
+	return store.Prepare(id, atSequence, state, inbound, outbound)
+}
+
 // Processor of events.
 type Processor struct {
 	store    Store
 	id       string
 	state    State
 	sequence int64
+	metadata EventMetadata
+	reads    []ReadOption
+	outbound []OutboundEvent
+	results  []any
+	hooks    []Hooks
+}
+
+// ProcessorOption configures a Processor.
+type ProcessorOption func(*Processor)
+
+// WithMetadata stamps the metadata onto every inbound and outbound event stored by the
+// processor.
+func WithMetadata(m EventMetadata) ProcessorOption {
+	return func(p *Processor) {
+		p.metadata = m
+	}
+}
+
+// WithReadOptions sets the options used by Load to read the state, e.g.
+// ConsistentRead(false) for cheaper reads when the state may be slightly stale.
+func WithReadOptions(opts ...ReadOption) ProcessorOption {
+	return func(p *Processor) {
+		p.reads = append(p.reads, opts...)
+	}
 }
 
 // New creates a new, empty stream processor.
-func New(store Store, id string, state State) (p *Processor, err error) {
+func New(store Store, id string, state State, opts ...ProcessorOption) (p *Processor, err error) {
 	if reflect.ValueOf(state).Kind() != reflect.Ptr {
 		err = errors.New("the state parameter must be a pointer")
 		return
@@ -52,24 +139,29 @@ func New(store Store, id string, state State) (p *Processor, err error) {
 		state:    state,
 		sequence: 0,
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
 	return
 }
 
 // Load the state from the data store. Pass a pointer to the state.
-func Load(store Store, id string, state State) (p *Processor, err error) {
+func Load(store Store, id string, state State, opts ...ProcessorOption) (p *Processor, err error) {
 	if reflect.ValueOf(state).Kind() != reflect.Ptr {
 		err = errors.New("the state parameter must be a pointer")
 		return
 	}
-	sequence, err := store.Get(id, state)
-	if err != nil {
-		return
-	}
 	p = &Processor{
-		store:    store,
-		id:       id,
-		state:    state,
-		sequence: sequence,
+		store: store,
+		id:    id,
+		state: state,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.sequence, err = GetWithOptions(store, id, state, p.reads...)
+	if err != nil {
+		p = nil
 	}
 	return
 }
@@ -89,20 +181,81 @@ func (p *Processor) Process(events ...InboundEvent) error {
 func (p *Processor) Prepare(events ...InboundEvent) (items []types.TransactWriteItem, err error) {
 	var inbound []InboundEvent
 	var outbound []OutboundEvent
+	p.results = nil
+	setFeatureFlags(p.state, p.metadata.FeatureFlags)
 	for i := 0; i < len(events); i++ {
-		inbound = append(inbound, events[i])
+		var event InboundEvent
+		event, err = p.beforeProcess(events[i])
+		if err != nil {
+			return
+		}
+		err = validateEvent(event)
+		if err != nil {
+			return
+		}
+		inbound = append(inbound, event)
 		var outboundEvents []OutboundEvent
-		outboundEvents, err = p.state.Process(events[i])
+		outboundEvents, err = processEvent(p.state, event)
+		if err != nil {
+			return
+		}
+		var results []any
+		outboundEvents, results = SplitResults(outboundEvents)
+		p.results = append(p.results, results...)
+		outboundEvents, err = p.afterProcess(event, outboundEvents)
 		if err != nil {
 			return
 		}
 		outbound = append(outbound, outboundEvents...)
 	}
-	return p.store.Prepare(p.id, p.sequence, p.state, inbound, outbound)
+	p.outbound = outbound
+	err = validateState(p.state)
+	if err != nil {
+		return
+	}
+	err = p.beforePersist(inbound, outbound)
+	if err != nil {
+		return
+	}
+	return PrepareWithOptions(p.store, p.id, p.sequence, p.state, inbound, outbound, WithEventMetadata(p.metadata))
+}
+
+// Outbound returns the outbound events emitted by the state during the most recent call
+// to Process or Prepare, e.g. to include them in an API response without querying the
+// table. If Process returned an error, the events may not have been stored.
+func (p *Processor) Outbound() []OutboundEvent {
+	return p.outbound
 }
 
 // Execute the database transaction. Usually, you'd want to use the Process method,
 // this method is used if you need to customise the database transaction.
 func (p *Processor) Execute(items []types.TransactWriteItem) error {
-	return p.store.Execute(items)
+	err := p.store.Execute(items)
+	p.executed(err)
+	return err
+}
+
+// executed updates the sequence once the transaction has been stored, and calls the
+// AfterPersist hooks.
+func (p *Processor) executed(err error) {
+	if err == nil {
+		p.sequence++
+	}
+	p.afterPersist(err)
+}
+
+// ID of the entity.
+func (p *Processor) ID() string {
+	return p.id
+}
+
+// Sequence is the version of the entity's state, e.g. to use as an ETag. It's incremented
+// each time the processor stores the state, and is 0 for new entities.
+func (p *Processor) Sequence() int64 {
+	return p.sequence
+}
+
+// State of the entity.
+func (p *Processor) State() State {
+	return p.state
 }
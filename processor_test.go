@@ -146,6 +146,63 @@ func TestBatch(t *testing.T) {
 	}
 }
 
+func TestProcessorOutbound(t *testing.T) {
+	// Arrange.
+	store := &putStore{
+		states:    map[string]AverageState{},
+		sequences: map[string]int64{},
+	}
+	p, err := New(store, "id", &AverageState{})
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+
+	// Act.
+	err = p.Process(Add{Number: 2}, Add{Number: 4})
+	if err != nil {
+		t.Fatalf("failed to process events: %v", err)
+	}
+
+	// Assert.
+	expected := []OutboundEvent{Average{Value: 2}, Count{Number: 1}, Average{Value: 3}, Count{Number: 2}}
+	if diff := cmp.Diff(expected, p.Outbound()); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestProcessorAccessors(t *testing.T) {
+	// Arrange.
+	store := &putStore{
+		states:    map[string]AverageState{"id": {Sum: 1, Count: 1, Value: 1}},
+		sequences: map[string]int64{"id": 3},
+	}
+	state := &AverageState{}
+	p, err := Load(store, "id", state)
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	if p.Sequence() != 3 {
+		t.Errorf("expected the loaded sequence to be 3, got %d", p.Sequence())
+	}
+
+	// Act.
+	err = p.Process(Add{Number: 3})
+	if err != nil {
+		t.Fatalf("failed to process events: %v", err)
+	}
+
+	// Assert.
+	if p.ID() != "id" {
+		t.Errorf("expected ID %q, got %q", "id", p.ID())
+	}
+	if p.Sequence() != 4 {
+		t.Errorf("expected the sequence to be incremented to 4, got %d", p.Sequence())
+	}
+	if diff := cmp.Diff(&AverageState{Sum: 4, Count: 2, Value: 2}, p.State()); diff != "" {
+		t.Error(diff)
+	}
+}
+
 func TestProcessorIntegration(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration test")
@@ -0,0 +1,58 @@
+package projection
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fromStreamImage converts a DynamoDB stream image to the attribute values used by the SDK,
+// so that records from the stream and the table can be unmarshalled in the same way.
+func fromStreamImage(image map[string]events.DynamoDBAttributeValue) (item map[string]types.AttributeValue, err error) {
+	item = make(map[string]types.AttributeValue, len(image))
+	for k, v := range image {
+		item[k], err = fromStreamAttribute(v)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func fromStreamAttribute(av events.DynamoDBAttributeValue) (types.AttributeValue, error) {
+	switch av.DataType() {
+	case events.DataTypeBinary:
+		return &types.AttributeValueMemberB{Value: av.Binary()}, nil
+	case events.DataTypeBoolean:
+		return &types.AttributeValueMemberBOOL{Value: av.Boolean()}, nil
+	case events.DataTypeBinarySet:
+		return &types.AttributeValueMemberBS{Value: av.BinarySet()}, nil
+	case events.DataTypeList:
+		list := make([]types.AttributeValue, len(av.List()))
+		for i, v := range av.List() {
+			var err error
+			if list[i], err = fromStreamAttribute(v); err != nil {
+				return nil, err
+			}
+		}
+		return &types.AttributeValueMemberL{Value: list}, nil
+	case events.DataTypeMap:
+		m, err := fromStreamImage(av.Map())
+		if err != nil {
+			return nil, err
+		}
+		return &types.AttributeValueMemberM{Value: m}, nil
+	case events.DataTypeNumber:
+		return &types.AttributeValueMemberN{Value: av.Number()}, nil
+	case events.DataTypeNumberSet:
+		return &types.AttributeValueMemberNS{Value: av.NumberSet()}, nil
+	case events.DataTypeNull:
+		return &types.AttributeValueMemberNULL{Value: true}, nil
+	case events.DataTypeString:
+		return &types.AttributeValueMemberS{Value: av.String()}, nil
+	case events.DataTypeStringSet:
+		return &types.AttributeValueMemberSS{Value: av.StringSet()}, nil
+	}
+	return nil, fmt.Errorf("projection: unsupported attribute type %v", av.DataType())
+}
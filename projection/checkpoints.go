@@ -0,0 +1,73 @@
+package projection
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DynamoDBAPI is the subset of the DynamoDB client used by DynamoDBCheckpoints.
+type DynamoDBAPI interface {
+	GetItem(context.Context, *dynamodb.GetItemInput, ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(context.Context, *dynamodb.PutItemInput, ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+}
+
+// DynamoDBCheckpoints stores checkpoints in a table with the same key schema as a stream
+// table, e.g. the read model's table, or the stream table itself.
+type DynamoDBCheckpoints struct {
+	Client    DynamoDBAPI
+	TableName string
+}
+
+// NewDynamoDBCheckpoints creates checkpoints stored in the table.
+func NewDynamoDBCheckpoints(client DynamoDBAPI, tableName string) *DynamoDBCheckpoints {
+	return &DynamoDBCheckpoints{
+		Client:    client,
+		TableName: tableName,
+	}
+}
+
+func (c *DynamoDBCheckpoints) key(projection, partitionKey string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"_pk": &types.AttributeValueMemberS{Value: "PROJECTION/" + projection + "/" + partitionKey},
+		"_sk": &types.AttributeValueMemberS{Value: "CHECKPOINT"},
+	}
+}
+
+// GetPosition of the latest event of the entity processed by the projection.
+func (c *DynamoDBCheckpoints) GetPosition(ctx context.Context, projection, partitionKey string) (p Position, err error) {
+	gio, err := c.Client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(c.TableName),
+		Key:            c.key(projection, partitionKey),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return
+	}
+	if seq, ok := gio.Item["_seq"].(*types.AttributeValueMemberN); ok {
+		if p.Sequence, err = strconv.ParseInt(seq.Value, 10, 64); err != nil {
+			return
+		}
+	}
+	if idx, ok := gio.Item["_idx"].(*types.AttributeValueMemberN); ok {
+		if p.Index, err = strconv.Atoi(idx.Value); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// SetPosition of the latest event of the entity processed by the projection.
+func (c *DynamoDBCheckpoints) SetPosition(ctx context.Context, projection, partitionKey string, p Position) error {
+	item := c.key(projection, partitionKey)
+	item["_seq"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(p.Sequence, 10)}
+	item["_idx"] = &types.AttributeValueMemberN{Value: strconv.Itoa(p.Index)}
+	_, err := c.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(c.TableName),
+		Item:      item,
+	})
+	return err
+}
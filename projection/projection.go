@@ -0,0 +1,242 @@
+// Package projection maintains denormalized read models, e.g. a leaderboard table, from the
+// outbound event records in the DynamoDB stream of a stream table.
+package projection
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.uber.org/zap"
+)
+
+// Event is an outbound event record.
+type Event struct {
+	// PartitionKey of the entity, e.g. "SlotMachine/id", or "tenant/SlotMachine/id".
+	PartitionKey string
+	// Sequence of the transaction that stored the event.
+	Sequence int64
+	// Index of the event within the transaction.
+	Index int
+	// Type of the event, e.g. "GameWon".
+	Type string
+	// EventID is the unique ID of the event.
+	EventID string
+	// Item is the stored record, including the library's underscore-prefixed attributes.
+	Item map[string]types.AttributeValue
+}
+
+// Unmarshal the event's attributes into v.
+func (e Event) Unmarshal(v interface{}) error {
+	return attributevalue.UnmarshalMap(e.Item, v)
+}
+
+// Position of an event in an entity's outbound events.
+type Position struct {
+	Sequence int64
+	Index    int
+}
+
+// After returns true if p is later than other.
+func (p Position) After(other Position) bool {
+	if p.Sequence != other.Sequence {
+		return p.Sequence > other.Sequence
+	}
+	return p.Index > other.Index
+}
+
+// Projector updates a read model with an outbound event.
+type Projector interface {
+	Project(ctx context.Context, e Event) error
+}
+
+// ProjectorFunc is a function that implements Projector.
+type ProjectorFunc func(ctx context.Context, e Event) error
+
+// Project the event.
+func (f ProjectorFunc) Project(ctx context.Context, e Event) error {
+	return f(ctx, e)
+}
+
+// Checkpoints store the position of the latest event of each entity that a projection has
+// processed, so that events redelivered by the DynamoDB stream are skipped.
+type Checkpoints interface {
+	// GetPosition returns the zero Position if the projection hasn't processed any events
+	// of the entity.
+	GetPosition(ctx context.Context, projection, partitionKey string) (p Position, err error)
+	SetPosition(ctx context.Context, projection, partitionKey string, p Position) error
+}
+
+// Handler projects the outbound events in DynamoDB stream batches.
+type Handler struct {
+	// Name of the projection, used to store checkpoints.
+	Name        string
+	Projector   Projector
+	Checkpoints Checkpoints
+	// Decrypt decrypts the records written by a store configured with encryption, e.g.
+	// DynamoDBStore.Decrypt. If it's nil, encrypted records are logged and skipped, so that
+	// they don't block the stream.
+	Decrypt func(ctx context.Context, item map[string]types.AttributeValue) (map[string]types.AttributeValue, error)
+	// Log defaults to a no-op logger.
+	Log *zap.Logger
+}
+
+func (h Handler) log() *zap.Logger {
+	if h.Log == nil {
+		return zap.NewNop()
+	}
+	return h.Log
+}
+
+// HandleRequest projects the new outbound event records in the batch, in order, skipping
+// events that have already been processed. Use it as the handler of a Lambda function.
+func (h Handler) HandleRequest(ctx context.Context, event events.DynamoDBEvent) error {
+	for _, record := range event.Records {
+		if record.EventName == string(events.DynamoDBOperationTypeModify) || record.EventName == string(events.DynamoDBOperationTypeRemove) {
+			continue
+		}
+		item, err := fromStreamImage(record.Change.NewImage)
+		if err != nil {
+			return err
+		}
+		e, ok, err := h.newEvent(ctx, item)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err = h.project(ctx, e, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h Handler) project(ctx context.Context, e Event, rebuild bool) error {
+	position := Position{Sequence: e.Sequence, Index: e.Index}
+	if !rebuild {
+		checkpoint, err := h.Checkpoints.GetPosition(ctx, h.Name, e.PartitionKey)
+		if err != nil {
+			return fmt.Errorf("projection: failed to get checkpoint: %w", err)
+		}
+		if !position.After(checkpoint) {
+			return nil
+		}
+	}
+	if err := h.Projector.Project(ctx, e); err != nil {
+		return fmt.Errorf("projection: failed to project %s event %q: %w", e.Type, e.EventID, err)
+	}
+	if err := h.Checkpoints.SetPosition(ctx, h.Name, e.PartitionKey, position); err != nil {
+		return fmt.Errorf("projection: failed to set checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Scanner reads the table, e.g. a *dynamodb.Client.
+type Scanner interface {
+	Scan(context.Context, *dynamodb.ScanInput, ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+}
+
+// Rebuild replays all of the outbound events in the table through the projector, ignoring
+// the checkpoints, e.g. after a new projection is deployed, or a read model is cleared.
+// The events of each entity are projected in order, and the checkpoints are updated.
+func (h Handler) Rebuild(ctx context.Context, client Scanner, tableName string) error {
+	var outbound []Event
+	si := &dynamodb.ScanInput{
+		TableName:        aws.String(tableName),
+		ConsistentRead:   aws.Bool(true),
+		FilterExpression: aws.String("begins_with(#_sk, :_sk)"),
+		ExpressionAttributeNames: map[string]string{
+			"#_sk": "_sk",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":_sk": &types.AttributeValueMemberS{Value: "OUTBOUND/"},
+		},
+	}
+	for {
+		so, err := client.Scan(ctx, si)
+		if err != nil {
+			return fmt.Errorf("projection: failed to scan table: %w", err)
+		}
+		for _, item := range so.Items {
+			e, ok, err := h.newEvent(ctx, item)
+			if err != nil {
+				return err
+			}
+			if ok {
+				outbound = append(outbound, e)
+			}
+		}
+		if len(so.LastEvaluatedKey) == 0 {
+			break
+		}
+		si.ExclusiveStartKey = so.LastEvaluatedKey
+	}
+	sort.SliceStable(outbound, func(i, j int) bool {
+		if outbound[i].PartitionKey != outbound[j].PartitionKey {
+			return outbound[i].PartitionKey < outbound[j].PartitionKey
+		}
+		return Position{outbound[j].Sequence, outbound[j].Index}.After(Position{outbound[i].Sequence, outbound[i].Index})
+	})
+	for _, e := range outbound {
+		if err := h.project(ctx, e, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newEvent creates an Event from an outbound event record. ok is false for other records,
+// and for encrypted records if the handler can't decrypt them.
+func (h Handler) newEvent(ctx context.Context, item map[string]types.AttributeValue) (e Event, ok bool, err error) {
+	sk := stringValue(item, "_sk")
+	if !strings.HasPrefix(sk, "OUTBOUND/") {
+		return
+	}
+	if _, encrypted := item["_enc"]; encrypted {
+		if h.Decrypt == nil {
+			h.log().Warn("skipping encrypted event, set Decrypt to project it", zap.String("pk", stringValue(item, "_pk")), zap.String("sk", sk))
+			return
+		}
+		if item, err = h.Decrypt(ctx, item); err != nil {
+			err = fmt.Errorf("projection: failed to decrypt %q: %w", sk, err)
+			return
+		}
+	}
+	// OUTBOUND/<sequence>/<index>/<type>
+	parts := strings.SplitN(sk, "/", 4)
+	if len(parts) != 4 {
+		err = fmt.Errorf("projection: invalid sort key %q", sk)
+		return
+	}
+	e.Sequence, err = strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		err = fmt.Errorf("projection: invalid sequence in sort key %q: %w", sk, err)
+		return
+	}
+	e.Index, err = strconv.Atoi(parts[2])
+	if err != nil {
+		err = fmt.Errorf("projection: invalid index in sort key %q: %w", sk, err)
+		return
+	}
+	e.PartitionKey = stringValue(item, "_pk")
+	e.Type = stringValue(item, "_typ")
+	e.EventID = stringValue(item, "_id")
+	e.Item = item
+	return e, true, nil
+}
+
+func stringValue(item map[string]types.AttributeValue, name string) string {
+	if v, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
@@ -0,0 +1,217 @@
+package projection
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+type memoryCheckpoints map[string]Position
+
+func (m memoryCheckpoints) GetPosition(ctx context.Context, projection, partitionKey string) (Position, error) {
+	return m[projection+"/"+partitionKey], nil
+}
+
+func (m memoryCheckpoints) SetPosition(ctx context.Context, projection, partitionKey string, p Position) error {
+	m[projection+"/"+partitionKey] = p
+	return nil
+}
+
+type GameWon struct {
+	Payout int `dynamodbav:"payout"`
+}
+
+// leaderboard sums the payouts of each slot machine.
+type leaderboard map[string]int
+
+func (l leaderboard) Project(ctx context.Context, e Event) error {
+	var won GameWon
+	if err := e.Unmarshal(&won); err != nil {
+		return err
+	}
+	l[e.PartitionKey] += won.Payout
+	return nil
+}
+
+func streamRecord(eventName, pk, sk, payout string) events.DynamoDBEventRecord {
+	return events.DynamoDBEventRecord{
+		EventName: eventName,
+		Change: events.DynamoDBStreamRecord{
+			NewImage: map[string]events.DynamoDBAttributeValue{
+				"_pk":    events.NewStringAttribute(pk),
+				"_sk":    events.NewStringAttribute(sk),
+				"_typ":   events.NewStringAttribute("GameWon"),
+				"payout": events.NewNumberAttribute(payout),
+			},
+		},
+	}
+}
+
+func TestHandleRequest(t *testing.T) {
+	// Arrange.
+	l := leaderboard{}
+	checkpoints := memoryCheckpoints{}
+	h := Handler{Name: "leaderboard", Projector: l, Checkpoints: checkpoints}
+	batch := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{
+			streamRecord("INSERT", "SlotMachine/a", "INBOUND/1/0/PullHandle", "1000"),
+			streamRecord("INSERT", "SlotMachine/a", "OUTBOUND/1/0/GameWon", "10"),
+			streamRecord("INSERT", "SlotMachine/a", "OUTBOUND/1/1/GameWon", "5"),
+			streamRecord("INSERT", "SlotMachine/b", "OUTBOUND/1/0/GameWon", "20"),
+			streamRecord("MODIFY", "SlotMachine/b", "OUTBOUND/1/0/GameWon", "20"),
+		},
+	}
+
+	// Act.
+	err := h.HandleRequest(context.Background(), batch)
+	if err != nil {
+		t.Fatalf("failed to handle batch: %v", err)
+	}
+	// Redeliver part of the batch, as the DynamoDB stream does after a failure.
+	err = h.HandleRequest(context.Background(), events.DynamoDBEvent{Records: batch.Records[2:]})
+	if err != nil {
+		t.Fatalf("failed to handle redelivered batch: %v", err)
+	}
+
+	// Assert.
+	if diff := cmp.Diff(leaderboard{"SlotMachine/a": 15, "SlotMachine/b": 20}, l); diff != "" {
+		t.Errorf("unexpected read model: %s", diff)
+	}
+	if diff := cmp.Diff(Position{Sequence: 1, Index: 1}, checkpoints["leaderboard/SlotMachine/a"]); diff != "" {
+		t.Errorf("unexpected checkpoint: %s", diff)
+	}
+}
+
+func encryptedRecord(pk, sk string) events.DynamoDBEventRecord {
+	r := streamRecord("INSERT", pk, sk, "0")
+	delete(r.Change.NewImage, "payout")
+	r.Change.NewImage["_enc"] = events.NewBinaryAttribute([]byte("ciphertext"))
+	return r
+}
+
+func TestEncryptedEvents(t *testing.T) {
+	decrypt := func(ctx context.Context, item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+		decrypted := map[string]types.AttributeValue{"payout": &types.AttributeValueMemberN{Value: "30"}}
+		for k, v := range item {
+			if k != "_enc" {
+				decrypted[k] = v
+			}
+		}
+		return decrypted, nil
+	}
+	var tests = []struct {
+		name     string
+		decrypt  func(ctx context.Context, item map[string]types.AttributeValue) (map[string]types.AttributeValue, error)
+		expected leaderboard
+	}{
+		{
+			name:     "without a decrypter, encrypted events are skipped",
+			expected: leaderboard{"SlotMachine/a": 10},
+		},
+		{
+			name:     "with a decrypter, encrypted events are projected",
+			decrypt:  decrypt,
+			expected: leaderboard{"SlotMachine/a": 40},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			l := leaderboard{}
+			h := Handler{Name: "leaderboard", Projector: l, Checkpoints: memoryCheckpoints{}, Decrypt: test.decrypt}
+			batch := events.DynamoDBEvent{
+				Records: []events.DynamoDBEventRecord{
+					encryptedRecord("SlotMachine/a", "OUTBOUND/1/0/GameWon"),
+					streamRecord("INSERT", "SlotMachine/a", "OUTBOUND/2/0/GameWon", "10"),
+				},
+			}
+
+			// Act.
+			err := h.HandleRequest(context.Background(), batch)
+			if err != nil {
+				t.Fatalf("failed to handle batch: %v", err)
+			}
+
+			// Assert.
+			if diff := cmp.Diff(test.expected, l); diff != "" {
+				t.Errorf("unexpected read model: %s", diff)
+			}
+		})
+	}
+}
+
+// pagedScanner returns each page of items in turn.
+type pagedScanner struct {
+	pages [][]map[string]types.AttributeValue
+}
+
+func (s *pagedScanner) Scan(ctx context.Context, input *dynamodb.ScanInput, opts ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	page := 0
+	if input.ExclusiveStartKey != nil {
+		page = 1
+	}
+	so := &dynamodb.ScanOutput{Items: s.pages[page]}
+	if page < len(s.pages)-1 {
+		so.LastEvaluatedKey = map[string]types.AttributeValue{"_pk": &types.AttributeValueMemberS{Value: "next"}}
+	}
+	return so, nil
+}
+
+func tableItem(pk, sk string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"_pk":  &types.AttributeValueMemberS{Value: pk},
+		"_sk":  &types.AttributeValueMemberS{Value: sk},
+		"_typ": &types.AttributeValueMemberS{Value: "GameWon"},
+	}
+}
+
+func TestRebuild(t *testing.T) {
+	// Arrange.
+	var projected []string
+	checkpoints := memoryCheckpoints{"leaderboard/SlotMachine/a": {Sequence: 10}}
+	h := Handler{
+		Name: "leaderboard",
+		Projector: ProjectorFunc(func(ctx context.Context, e Event) error {
+			projected = append(projected, e.PartitionKey+"/"+stringValue(e.Item, "_sk"))
+			return nil
+		}),
+		Checkpoints: checkpoints,
+	}
+	scanner := &pagedScanner{
+		pages: [][]map[string]types.AttributeValue{
+			{
+				tableItem("SlotMachine/b", "OUTBOUND/1/0/GameWon"),
+				tableItem("SlotMachine/a", "OUTBOUND/10/0/GameWon"),
+			},
+			{
+				tableItem("SlotMachine/a", "OUTBOUND/2/0/GameWon"),
+				tableItem("SlotMachine/a", "OUTBOUND/2/1/GameWon"),
+			},
+		},
+	}
+
+	// Act.
+	err := h.Rebuild(context.Background(), scanner, "table")
+	if err != nil {
+		t.Fatalf("failed to rebuild: %v", err)
+	}
+
+	// Assert.
+	expected := []string{
+		"SlotMachine/a/OUTBOUND/2/0/GameWon",
+		"SlotMachine/a/OUTBOUND/2/1/GameWon",
+		"SlotMachine/a/OUTBOUND/10/0/GameWon",
+		"SlotMachine/b/OUTBOUND/1/0/GameWon",
+	}
+	if diff := cmp.Diff(expected, projected); diff != "" {
+		t.Errorf("unexpected events: %s", diff)
+	}
+	if diff := cmp.Diff(Position{Sequence: 1}, checkpoints["leaderboard/SlotMachine/b"]); diff != "" {
+		t.Errorf("unexpected checkpoint: %s", diff)
+	}
+}
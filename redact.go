@@ -0,0 +1,34 @@
+package stream
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Redactor can be implemented by outbound events to list fields that must not leave
+// the table, e.g. card numbers. The fields are stored as normal, but are removed by
+// the handler before the event is sent to EventBridge. Nested fields are separated
+// with a dot, e.g. "payment.cardNumber". States can implement it too, so that the
+// fields are removed from the state in StateChanged events.
+type Redactor interface {
+	Redacted() []string
+}
+
+func (ddb *DynamoDBStore) attributeValueRedacted(e OutboundEvent) (av types.AttributeValue, ok bool) {
+	r, isRedactor := e.(Redactor)
+	if !isRedactor {
+		return
+	}
+	// A String Set can't contain duplicates.
+	var fields []string
+	seen := make(map[string]bool)
+	for _, f := range r.Redacted() {
+		if !seen[f] {
+			seen[f] = true
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == 0 {
+		return
+	}
+	return &types.AttributeValueMemberSS{Value: fields}, true
+}
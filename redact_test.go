@@ -0,0 +1,102 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+type PaymentTaken struct {
+	CardNumber string `dynamodbav:"cardNumber"`
+	Amount     int    `dynamodbav:"amount"`
+}
+
+func (PaymentTaken) EventName() string  { return "PaymentTaken" }
+func (PaymentTaken) IsOutbound()        {}
+func (PaymentTaken) Redacted() []string { return []string{"cardNumber"} }
+
+func TestRedactedFieldsAreStored(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	// Act.
+	items, err := s.Prepare("id", 0, &AverageState{}, nil, []OutboundEvent{PaymentTaken{CardNumber: "4111111111111111", Amount: 100}, Average{Value: 1}})
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Assert.
+	redacted, ok := items[1].Put.Item["_redact"].(*types.AttributeValueMemberSS)
+	if !ok {
+		t.Fatalf("expected redacted fields to be stored, got %v", items[1].Put.Item["_redact"])
+	}
+	if diff := cmp.Diff([]string{"cardNumber"}, redacted.Value); diff != "" {
+		t.Error(diff)
+	}
+	if _, ok := items[1].Put.Item["cardNumber"]; !ok {
+		t.Error("expected the redacted field to be kept in the table")
+	}
+	if _, ok := items[2].Put.Item["_redact"]; ok {
+		t.Error("expected events that don't implement Redactor not to have redacted fields")
+	}
+}
+
+type DuplicateRedactions struct{}
+
+func (DuplicateRedactions) EventName() string  { return "DuplicateRedactions" }
+func (DuplicateRedactions) IsOutbound()        {}
+func (DuplicateRedactions) Redacted() []string { return []string{"a", "b", "a"} }
+
+type CardState struct {
+	CardNumber string `dynamodbav:"cardNumber"`
+}
+
+func (s *CardState) Process(event InboundEvent) (outbound []OutboundEvent, err error) {
+	return
+}
+
+func (s *CardState) Redacted() []string { return []string{"cardNumber"} }
+
+func TestRedactedFields(t *testing.T) {
+	var tests = []struct {
+		name     string
+		event    OutboundEvent
+		expected []string
+	}{
+		{
+			name:     "duplicate fields are stored once",
+			event:    DuplicateRedactions{},
+			expected: []string{"a", "b"},
+		},
+		{
+			name:     "the redacted fields of the state are redacted from StateChanged events",
+			event:    StateChanged{Namespace: "Card", State: &CardState{CardNumber: "4111111111111111"}},
+			expected: []string{"state.cardNumber"},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			s, err := NewStore("table", "Card", WithRegion(region), WithClient(testClient))
+			if err != nil {
+				t.Fatalf("failed to create store: %v", err)
+			}
+
+			// Act.
+			av, ok := s.attributeValueRedacted(test.event)
+
+			// Assert.
+			if !ok {
+				t.Fatal("expected redacted fields")
+			}
+			if diff := cmp.Diff(test.expected, av.(*types.AttributeValueMemberSS).Value); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
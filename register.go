@@ -0,0 +1,82 @@
+package stream
+
+import (
+	"reflect"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Register adds a reader for the inbound event type T, named using T's EventName method,
+// that unmarshals records into T. Records are decoded with the reader's Unmarshal function.
+//
+//	reader := stream.NewInboundEventReader()
+//	stream.Register[PullHandle](reader)
+func Register[T InboundEvent](reader *InboundEventReader) *InboundEventReader {
+	var zero T
+	reader.addType(zero.EventName(), reflect.TypeOf(zero))
+	return reader.Add(zero.EventName(), func(item map[string]types.AttributeValue) (InboundEvent, error) {
+		var e T
+		err := reader.unmarshal(item, &e)
+		return e, err
+	})
+}
+
+// RegisterOutbound adds a reader for the outbound event type T, named using T's EventName
+// method, that unmarshals records into T. Records are decoded with the reader's Unmarshal
+// function.
+func RegisterOutbound[T OutboundEvent](reader *OutboundEventReader) *OutboundEventReader {
+	var zero T
+	reader.addType(zero.EventName(), reflect.TypeOf(zero))
+	return reader.Add(zero.EventName(), func(item map[string]types.AttributeValue) (OutboundEvent, error) {
+		var e T
+		err := reader.unmarshal(item, &e)
+		return e, err
+	})
+}
+
+func (r *InboundEventReader) unmarshal(item map[string]types.AttributeValue, out interface{}) error {
+	if r.Unmarshal != nil {
+		return r.Unmarshal(item, out)
+	}
+	return attributevalue.UnmarshalMap(item, out)
+}
+
+func (r *OutboundEventReader) unmarshal(item map[string]types.AttributeValue, out interface{}) error {
+	if r.Unmarshal != nil {
+		return r.Unmarshal(item, out)
+	}
+	return attributevalue.UnmarshalMap(item, out)
+}
+
+func (r *InboundEventReader) addType(eventName string, t reflect.Type) {
+	if r.types == nil {
+		r.types = make(map[string]reflect.Type)
+	}
+	r.types[eventName] = t
+}
+
+// Types returns the types of the events added with Register, by event name.
+func (r *InboundEventReader) Types() map[string]reflect.Type {
+	m := make(map[string]reflect.Type, len(r.types))
+	for name, t := range r.types {
+		m[name] = t
+	}
+	return m
+}
+
+func (r *OutboundEventReader) addType(eventName string, t reflect.Type) {
+	if r.types == nil {
+		r.types = make(map[string]reflect.Type)
+	}
+	r.types[eventName] = t
+}
+
+// Types returns the types of the events added with RegisterOutbound, by event name.
+func (r *OutboundEventReader) Types() map[string]reflect.Type {
+	m := make(map[string]reflect.Type, len(r.types))
+	for name, t := range r.types {
+		m[name] = t
+	}
+	return m
+}
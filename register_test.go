@@ -0,0 +1,69 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRegister(t *testing.T) {
+	// Arrange.
+	inbound := Register[Add](NewInboundEventReader())
+	outbound := RegisterOutbound[Average](NewOutboundEventReader())
+
+	// Act.
+	add, ok, err := inbound.Read("Add", map[string]types.AttributeValue{
+		"Number": &types.AttributeValueMemberN{Value: "2"},
+	})
+	if err != nil || !ok {
+		t.Fatalf("failed to read inbound event: %v", err)
+	}
+	average, ok, err := outbound.Read("Average", map[string]types.AttributeValue{
+		"Value": &types.AttributeValueMemberN{Value: "1.5"},
+	})
+	if err != nil || !ok {
+		t.Fatalf("failed to read outbound event: %v", err)
+	}
+
+	// Assert.
+	if diff := cmp.Diff(Add{Number: 2}, add); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff(Average{Value: 1.5}, average); diff != "" {
+		t.Error(diff)
+	}
+}
+
+type Credited struct {
+	Amount int `json:"amount"`
+}
+
+func (Credited) EventName() string { return "Credited" }
+func (Credited) IsInbound()        {}
+
+func TestRegisterUsesTheStoreCodec(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient), WithCodecTag("json"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	reader := NewInboundEventReader()
+	reader.Unmarshal = s.Unmarshal
+	Register[Credited](reader)
+	items, err := s.Prepare("id", 0, &AverageState{}, []InboundEvent{Credited{Amount: 3}}, nil)
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Act.
+	deposited, ok, err := reader.Read("Credited", items[1].Put.Item)
+
+	// Assert.
+	if err != nil || !ok {
+		t.Fatalf("failed to read inbound event: %v", err)
+	}
+	if diff := cmp.Diff(Credited{Amount: 3}, deposited); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,58 @@
+package stream
+
+// Registry holds the event readers used when nil readers are passed to Query,
+// QueryWithHistory, QueryEnvelopes or Repair, so that each call site doesn't need to
+// rebuild the same readers.
+type Registry struct {
+	Inbound  *InboundEventReader
+	Outbound *OutboundEventReader
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		Inbound:  NewInboundEventReader(),
+		Outbound: NewOutboundEventReader(),
+	}
+}
+
+// Events is the package-level registry, used by stores that aren't configured with
+// WithRegistry. Event types can register themselves in init functions.
+//
+//	func init() {
+//		stream.Register[PullHandle](stream.Events.Inbound)
+//		stream.RegisterOutbound[GameWon](stream.Events.Outbound)
+//	}
+var Events = NewRegistry()
+
+// WithRegistry sets the registry used by the store, instead of the package-level Events
+// registry, e.g. to isolate the events of a namespace.
+func WithRegistry(r *Registry) StoreOption {
+	return func(o *StoreOptions) error {
+		o.Registry = r
+		return nil
+	}
+}
+
+func (ddb *DynamoDBStore) registry() *Registry {
+	if ddb.Registry != nil {
+		return ddb.Registry
+	}
+	return Events
+}
+
+// inboundEventReader returns r, or the registry's reader if r is nil.
+func (ddb *DynamoDBStore) inboundEventReader(r *InboundEventReader) *InboundEventReader {
+	if r != nil {
+		return r
+	}
+	return ddb.registry().Inbound
+}
+
+// outboundEventReader returns r, or the registry's reader if r is nil.
+func (ddb *DynamoDBStore) outboundEventReader(r *OutboundEventReader) *OutboundEventReader {
+	if r != nil {
+		return r
+	}
+	return ddb.registry().Outbound
+}
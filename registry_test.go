@@ -0,0 +1,72 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRegistry(t *testing.T) {
+	// Arrange.
+	registry := NewRegistry()
+	Register[Add](registry.Inbound)
+	scoped, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient), WithRegistry(registry))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	global, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	explicit := NewInboundEventReader()
+
+	// Assert.
+	if scoped.inboundEventReader(nil) != registry.Inbound {
+		t.Error("expected the store to use its registry")
+	}
+	if global.inboundEventReader(nil) != Events.Inbound || global.outboundEventReader(nil) != Events.Outbound {
+		t.Error("expected stores without a registry to use the package-level registry")
+	}
+	if scoped.inboundEventReader(explicit) != explicit {
+		t.Error("expected readers passed to the store to be used")
+	}
+}
+
+func TestQueryUsesRegistryIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	// Arrange.
+	name := createLocalTable(t)
+	defer deleteLocalTable(t, name)
+	registry := NewRegistry()
+	Register[Add](registry.Inbound)
+	RegisterOutbound[Average](registry.Outbound)
+	RegisterOutbound[Count](registry.Outbound)
+	s, err := NewStore(name, "Average", WithRegion(region), WithClient(testClient), WithRegistry(registry))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	p, err := New(s, "id", &AverageState{})
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+	err = p.Process(Add{Number: 2})
+	if err != nil {
+		t.Fatalf("failed to process: %v", err)
+	}
+
+	// Act.
+	_, inbound, outbound, err := s.Query("id", &AverageState{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+
+	// Assert.
+	if diff := cmp.Diff([]InboundEvent{Add{Number: 2}}, inbound); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]OutboundEvent{Average{Value: 2}, Count{Number: 1}}, outbound); diff != "" {
+		t.Error(diff)
+	}
+}
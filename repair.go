@@ -0,0 +1,214 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrCannotRepair is returned by Repair if there's no state history or inbound events to
+// reconstruct the state from.
+var ErrCannotRepair = errors.New("state cannot be repaired, no state history or inbound events were found")
+
+// Repair reconstructs a missing or corrupted STATE record. The state is read from the
+// latest STATE/<n> history record, and any inbound events stored after it are processed
+// to bring the state up to date. If there's no state history, all of the inbound events
+// are processed, starting with the empty state passed in.
+//
+// Outbound events returned while reprocessing inbound events are discarded, since they
+// were sent when the events were first processed.
+//
+// If the STATE record exists and can be read, it's returned without changes.
+func (ddb *DynamoDBStore) Repair(ctx context.Context, id string, state State, inboundEventReader *InboundEventReader) (sequence int64, err error) {
+	if reflect.ValueOf(state).Kind() != reflect.Ptr {
+		err = errors.New("the state parameter must be a pointer")
+		return
+	}
+	inboundEventReader = ddb.inboundEventReader(inboundEventReader)
+	records, err := ddb.queryRecords(ctx, id)
+	if err != nil {
+		return
+	}
+	var current map[string]types.AttributeValue
+	var history []map[string]types.AttributeValue
+	var inbound []map[string]types.AttributeValue
+	var events []map[string]types.AttributeValue
+	for _, r := range records {
+		prefix, suffix := ddb.splitSortKey(r)
+		switch prefix {
+		case "STATE":
+			if suffix == "" {
+				current = r
+			} else {
+				history = append(history, r)
+			}
+		case "INBOUND":
+			inbound = append(inbound, r)
+		}
+		if prefix == "INBOUND" || prefix == "OUTBOUND" {
+			events = append(events, r)
+		}
+	}
+
+	// Return the current state if it can be read.
+	var currentSequence int64
+	if current != nil {
+		initial := reflect.ValueOf(state).Elem().Interface()
+		currentSequence, _ = ddb.getRecordSequenceNumber(current)
+		if ddb.unmarshalMap(current, state) == nil && currentSequence > 0 {
+			return currentSequence, nil
+		}
+		reflect.ValueOf(state).Elem().Set(reflect.ValueOf(initial))
+	}
+
+	// Start with the latest state history.
+	sort.Slice(history, func(i, j int) bool {
+		si, _ := ddb.getRecordSequenceNumber(history[i])
+		sj, _ := ddb.getRecordSequenceNumber(history[j])
+		return si < sj
+	})
+	if len(history) > 0 {
+		latest := history[len(history)-1]
+		err = ddb.unmarshalMap(latest, state)
+		if err != nil {
+			err = fmt.Errorf("failed to read state history: %w", err)
+			return
+		}
+		sequence, err = ddb.getRecordSequenceNumber(latest)
+		if err != nil {
+			return
+		}
+	}
+
+	// Process inbound events stored after the state history.
+	err = ddb.sortEventRecords(inbound)
+	if err != nil {
+		return
+	}
+	for _, r := range inbound {
+		var seq int64
+		seq, err = ddb.getRecordSequenceNumber(r)
+		if err != nil {
+			return
+		}
+		if seq <= sequence && len(history) > 0 {
+			continue
+		}
+		var typ string
+		typ, err = ddb.getRecordType(r)
+		if err != nil {
+			return
+		}
+		event, ok, readErr := inboundEventReader.Read(typ, r)
+		if readErr != nil {
+			err = readErr
+			return
+		}
+		if !ok {
+			err = fmt.Errorf("inbound event: no reader for %q", typ)
+			return
+		}
+		setFeatureFlags(state, getRecordFeatureFlags(r))
+		_, err = processEvent(state, event)
+		if err != nil {
+			err = fmt.Errorf("failed to reprocess inbound event at sequence %d: %w", seq, err)
+			return
+		}
+		if seq > sequence {
+			sequence = seq
+		}
+	}
+	if sequence == 0 {
+		err = ErrCannotRepair
+		return
+	}
+	if currentSequence > sequence {
+		err = fmt.Errorf("%w: the STATE record is at sequence %d, but the history only reaches sequence %d", ErrCannotRepair, currentSequence, sequence)
+		return
+	}
+
+	// Rewrite the STATE record, unless it has been updated by another process.
+	item, err := ddb.createRecord(id, ddb.createStateRecordSortKey(), sequence, state, ddb.Namespace)
+	if err != nil {
+		return
+	}
+	if ddb.HashChain {
+		// Continue the hash chain from the latest event.
+		err = ddb.sortEventRecords(events)
+		if err != nil {
+			return
+		}
+		item["_hash"] = ddb.attributeValueString("")
+		if len(events) > 0 {
+			if v, ok := events[len(events)-1]["_hash"]; ok {
+				item["_hash"] = v
+			}
+		}
+	}
+	items := []types.TransactWriteItem{
+		{
+			Put: &types.Put{
+				TableName:           ddb.TableName,
+				Item:                item,
+				ConditionExpression: aws.String("attribute_not_exists(#_pk) OR attribute_not_exists(#_seq) OR #_seq = :_seq"),
+				ExpressionAttributeNames: map[string]string{
+					"#_pk":  "_pk",
+					"#_seq": "_seq",
+				},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":_seq": ddb.attributeValueInteger(currentSequence),
+				},
+			},
+		},
+	}
+	items, err = ddb.encryptItems(ctx, id, items)
+	if err != nil {
+		return
+	}
+	err = ddb.Execute(items)
+	return
+}
+
+// queryRecords returns all of the records of the entity, decrypted.
+func (ddb *DynamoDBStore) queryRecords(ctx context.Context, id string) (records []map[string]types.AttributeValue, err error) {
+	qi := &dynamodb.QueryInput{
+		TableName:              ddb.TableName,
+		ConsistentRead:         aws.Bool(true),
+		KeyConditionExpression: aws.String("#_pk = :_pk"),
+		ExpressionAttributeNames: map[string]string{
+			"#_pk": "_pk",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":_pk": ddb.attributeValueString(ddb.createPartitionKey(id)),
+		},
+		ReturnConsumedCapacity: ddb.returnConsumedCapacity(),
+	}
+	entityKey := ddb.newEntityKeyLoader(ctx, id)
+	var pagerError error
+	err = ddb.queryPages(ctx, qi, func(qo *dynamodb.QueryOutput, _ bool) bool {
+		for i := 0; i < len(qo.Items); i++ {
+			pagerError = checkRecordFormat(qo.Items[i])
+			if pagerError != nil {
+				return false
+			}
+			var r map[string]types.AttributeValue
+			r, pagerError = ddb.decryptRecord(ctx, qo.Items[i], entityKey)
+			if pagerError != nil {
+				return false
+			}
+			records = append(records, r)
+		}
+		return true
+	})
+	if err != nil {
+		return
+	}
+	err = pagerError
+	return
+}
@@ -0,0 +1,116 @@
+package stream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSortEventRecords(t *testing.T) {
+	s := &DynamoDBStore{}
+	record := func(sk string) map[string]types.AttributeValue {
+		return map[string]types.AttributeValue{"_sk": &types.AttributeValueMemberS{Value: sk}}
+	}
+	records := []map[string]types.AttributeValue{
+		record("INBOUND/10/0/Add"),
+		record("INBOUND/2/1/Add"),
+		record("INBOUND/2/0/Add"),
+		record("OUTBOUND/1/0/Average"),
+		record("INBOUND/1/0/Add"),
+	}
+	err := s.sortEventRecords(records)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var actual []string
+	for _, r := range records {
+		actual = append(actual, r["_sk"].(*types.AttributeValueMemberS).Value)
+	}
+	expected := []string{"INBOUND/1/0/Add", "OUTBOUND/1/0/Average", "INBOUND/2/0/Add", "INBOUND/2/1/Add", "INBOUND/10/0/Add"}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestRepairIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	inboundEventReader := NewInboundEventReader()
+	inboundEventReader.Add(Add{}.EventName(), func(item map[string]types.AttributeValue) (InboundEvent, error) {
+		var event Add
+		err := attributevalue.UnmarshalMap(item, &event)
+		return event, err
+	})
+	var tests = []struct {
+		name           string
+		persistHistory bool
+	}{
+		{
+			name:           "the state can be repaired from the inbound events",
+			persistHistory: false,
+		},
+		{
+			name:           "the state can be repaired from the state history",
+			persistHistory: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			name := createLocalTable(t)
+			defer deleteLocalTable(t, name)
+			s, err := NewStore(name, "Average", WithRegion(region), WithClient(testClient), WithPersistStateHistory(tt.persistHistory))
+			if err != nil {
+				t.Fatalf("failed to create store: %v", err)
+			}
+			state := &AverageState{}
+			p, err := New(s, "id", state)
+			if err != nil {
+				t.Fatalf("failed to create processor: %v", err)
+			}
+			err = p.Process(Add{Number: 1}, Add{Number: 2}, Add{Number: 3})
+			if err != nil {
+				t.Fatalf("failed to process events: %v", err)
+			}
+			_, err = testClient.DeleteItem(context.Background(), &dynamodb.DeleteItemInput{
+				TableName: aws.String(name),
+				Key: map[string]types.AttributeValue{
+					"_pk": &types.AttributeValueMemberS{Value: "Average/id"},
+					"_sk": &types.AttributeValueMemberS{Value: "STATE"},
+				},
+			})
+			if err != nil {
+				t.Fatalf("failed to delete state: %v", err)
+			}
+
+			// Act.
+			repaired := &AverageState{}
+			sequence, err := s.Repair(context.Background(), "id", repaired, inboundEventReader)
+			if err != nil {
+				t.Fatalf("failed to repair: %v", err)
+			}
+
+			// Assert.
+			if sequence != 1 {
+				t.Errorf("expected sequence 1, got %d", sequence)
+			}
+			if diff := cmp.Diff(state, repaired); diff != "" {
+				t.Error(diff)
+			}
+			retrieved := &AverageState{}
+			if _, err = s.Get("id", retrieved); err != nil {
+				t.Fatalf("failed to get repaired state: %v", err)
+			}
+			if diff := cmp.Diff(state, retrieved); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrInvalidReservation is returned by Reserve if the number of values to reserve is less than 1.
+var ErrInvalidReservation = errors.New("invalid reservation: must reserve at least one value")
+
+// Reservation is a block of values reserved for an entity by Reserve.
+type Reservation struct {
+	// First reserved value.
+	First int64
+	// Last reserved value.
+	Last int64
+}
+
+// Values returns each reserved value.
+func (r Reservation) Values() (values []int64) {
+	for v := r.First; v <= r.Last; v++ {
+		values = append(values, v)
+	}
+	return
+}
+
+// IDs returns each reserved value, prefixed with the entity ID, e.g. "order-1/3".
+func (r Reservation) IDs(id string) (ids []string) {
+	for _, v := range r.Values() {
+		ids = append(ids, fmt.Sprintf("%s/%d", id, v))
+	}
+	return
+}
+
+// Reserve atomically reserves a block of n values for the entity, e.g. to assign IDs
+// to order lines before the events that contain them are stored with Put. Values start
+// at 1, and are never reserved twice, even if the reservation isn't used.
+//
+// The counter is stored in a COUNTER record, separately from the state, so reserving
+// values doesn't change the state's sequence number or cause ErrOptimisticConcurrency.
+func (ddb *DynamoDBStore) Reserve(ctx context.Context, id string, n int64) (r Reservation, err error) {
+	if n < 1 {
+		err = ErrInvalidReservation
+		return
+	}
+	names := map[string]string{
+		"#_namespace": "_namespace",
+		"#_typ":       "_typ",
+		"#_ts":        "_ts",
+		"#_date":      "_date",
+		"#_fmt":       "_fmt",
+		"#_next":      "_next",
+	}
+	values := map[string]types.AttributeValue{
+		":_namespace": ddb.attributeValueString(ddb.Namespace),
+		":_typ":       ddb.attributeValueString("COUNTER"),
+		":_ts":        ddb.attributeValueInteger(ddb.Now().Unix()),
+		":_date":      ddb.attributeValueString(ddb.Now().Format(time.RFC3339)),
+		":_fmt":       ddb.attributeValueString(formatVersion()),
+		":_n":         ddb.attributeValueInteger(n),
+	}
+	set := "SET #_namespace = :_namespace, #_typ = :_typ, #_ts = :_ts, #_date = :_date, #_fmt = :_fmt"
+	if ddb.Tenant != "" {
+		names["#_tenant"] = "_tenant"
+		values[":_tenant"] = ddb.attributeValueString(ddb.Tenant)
+		set += ", #_tenant = :_tenant"
+	}
+	uio, err := ddb.Client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: ddb.TableName,
+		Key: map[string]types.AttributeValue{
+			"_pk": ddb.attributeValueString(ddb.createPartitionKey(id)),
+			"_sk": ddb.attributeValueString(ddb.createCounterRecordSortKey()),
+		},
+		UpdateExpression:          aws.String(set + " ADD #_next :_n"),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ReturnValues:              types.ReturnValueUpdatedNew,
+		ReturnConsumedCapacity:    ddb.returnConsumedCapacity(),
+	})
+	if err != nil {
+		return
+	}
+	if uio.ConsumedCapacity != nil {
+		ddb.reportCapacity(OperationReserve, *uio.ConsumedCapacity)
+	}
+	v, ok := uio.Attributes["_next"].(*types.AttributeValueMemberN)
+	if !ok {
+		err = errors.New("reserve: missing _next field in record")
+		return
+	}
+	last, err := strconv.ParseInt(v.Value, 10, 64)
+	if err != nil {
+		err = fmt.Errorf("reserve: invalid _next field in record: %w", err)
+		return
+	}
+	r = Reservation{First: last - n + 1, Last: last}
+	return
+}
@@ -0,0 +1,67 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReservationIDs(t *testing.T) {
+	r := Reservation{First: 3, Last: 5}
+	if diff := cmp.Diff([]string{"order/3", "order/4", "order/5"}, r.IDs("order")); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestReserveIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	// Arrange.
+	name := createLocalTable(t)
+	defer deleteLocalTable(t, name)
+	s, err := NewStore(name, "Average", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	state := &AverageState{}
+	p, err := New(s, "id", state)
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+	if err = p.Process(Add{Number: 1}); err != nil {
+		t.Fatalf("failed to process events: %v", err)
+	}
+
+	// Act.
+	first, err := s.Reserve(context.Background(), "id", 3)
+	if err != nil {
+		t.Fatalf("failed to reserve: %v", err)
+	}
+	second, err := s.Reserve(context.Background(), "id", 2)
+	if err != nil {
+		t.Fatalf("failed to reserve: %v", err)
+	}
+	_, invalidErr := s.Reserve(context.Background(), "id", 0)
+
+	// Assert.
+	if diff := cmp.Diff(Reservation{First: 1, Last: 3}, first); diff != "" {
+		t.Errorf("unexpected first reservation: %s", diff)
+	}
+	if diff := cmp.Diff(Reservation{First: 4, Last: 5}, second); diff != "" {
+		t.Errorf("unexpected second reservation: %s", diff)
+	}
+	if !errors.Is(invalidErr, ErrInvalidReservation) {
+		t.Errorf("expected ErrInvalidReservation, got %v", invalidErr)
+	}
+	// Reserving values doesn't change the state's sequence.
+	sequence, err := s.Get("id", &AverageState{})
+	if err != nil {
+		t.Fatalf("failed to get state: %v", err)
+	}
+	if sequence != 1 {
+		t.Errorf("expected sequence 1, got %d", sequence)
+	}
+}
@@ -0,0 +1,41 @@
+package stream
+
+import (
+	"time"
+)
+
+// ScheduledEventName is the name of the outbound event used to schedule inbound events.
+const ScheduledEventName = "ScheduledEvent"
+
+// ScheduledEvent is an outbound event that instructs the handler to deliver an inbound
+// event to an entity at a later time, e.g. to expire an unused coin after 10 minutes. If
+// the handler is configured with a Scheduler, it creates an EventBridge Scheduler schedule
+// instead of publishing the event.
+type ScheduledEvent struct {
+	// Namespace of the entity to deliver the event to.
+	Namespace string `json:"namespace" dynamodbav:"namespace"`
+	// ID of the entity to deliver the event to.
+	ID string `json:"id" dynamodbav:"id"`
+	// At is the time to deliver the event.
+	At time.Time `json:"at" dynamodbav:"at"`
+	// Type of the inbound event.
+	Type string `json:"type" dynamodbav:"type"`
+	// Event to deliver.
+	Event InboundEvent `json:"event" dynamodbav:"event"`
+}
+
+func (ScheduledEvent) EventName() string { return ScheduledEventName }
+func (ScheduledEvent) IsOutbound()       {}
+
+// Schedule the inbound event to be delivered to the entity at the given time.
+//
+//	outbound = append(outbound, stream.Schedule("Coin", c.ID, now.Add(10*time.Minute), ExpireCoin{}))
+func Schedule(namespace, id string, at time.Time, event InboundEvent) ScheduledEvent {
+	return ScheduledEvent{
+		Namespace: namespace,
+		ID:        id,
+		At:        at.UTC(),
+		Type:      event.EventName(),
+		Event:     event,
+	}
+}
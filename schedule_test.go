@@ -0,0 +1,49 @@
+package stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type ExpireCoin struct {
+	Reason string
+}
+
+func (ExpireCoin) EventName() string { return "ExpireCoin" }
+func (ExpireCoin) IsInbound()        {}
+
+func TestScheduledEventsAreStored(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Coin", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	at := time.Date(2022, time.November, 20, 13, 10, 0, 0, time.UTC)
+
+	// Act.
+	items, err := s.Prepare("id", 0, &AverageState{}, nil, []OutboundEvent{Schedule("Coin", "id", at, ExpireCoin{Reason: "unused"})})
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Assert.
+	item := items[len(items)-1].Put.Item
+	if typ := stringAttribute(item, "_typ"); typ != ScheduledEventName {
+		t.Errorf("expected type %q, got %q", ScheduledEventName, typ)
+	}
+	if v := stringAttribute(item, "at"); v != "2022-11-20T13:10:00Z" {
+		t.Errorf("unexpected time: %q", v)
+	}
+	if v := stringAttribute(item, "type"); v != "ExpireCoin" {
+		t.Errorf("unexpected event type: %q", v)
+	}
+	event, ok := item["event"].(*types.AttributeValueMemberM)
+	if !ok {
+		t.Fatalf("expected the event to be stored as a map, got %T", item["event"])
+	}
+	if v := stringAttribute(event.Value, "Reason"); v != "unused" {
+		t.Errorf("unexpected event: %v", event.Value)
+	}
+}
@@ -0,0 +1,192 @@
+package stream
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// SchemaViolation describes a field of an inbound event that breaks a rule.
+type SchemaViolation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// SchemaError is returned when an inbound event doesn't match the rules in its
+// `validate` struct tags.
+type SchemaError struct {
+	Event      string            `json:"event"`
+	Violations []SchemaViolation `json:"violations"`
+}
+
+func (e *SchemaError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Field + ": " + v.Message
+	}
+	return fmt.Sprintf("invalid %s: %s", e.Event, strings.Join(msgs, "; "))
+}
+
+func (e *SchemaError) Is(target error) bool {
+	return target == ErrInvalidEvent
+}
+
+// ValidateSchema checks an inbound event against the rules in its `validate` struct
+// tags, so that malformed commands can be rejected before they reach the state's
+// Process method. Rules are comma separated:
+//
+//	required    the field must not be the zero value
+//	min=n       numbers must be at least n, strings, slices and maps must have at least n elements
+//	max=n       numbers must be at most n, strings, slices and maps must have at most n elements
+//	oneof=a b   the field must be one of the space separated values
+//
+// Field names in violations use the json tag name if present. Nested structs are
+// checked too.
+func ValidateSchema(e InboundEvent) (err error) {
+	se := &SchemaError{Event: e.EventName()}
+	err = validateStruct(reflect.ValueOf(e), "", se)
+	if err != nil {
+		return
+	}
+	if len(se.Violations) > 0 {
+		return se
+	}
+	return nil
+}
+
+func validateStruct(v reflect.Value, prefix string, se *SchemaError) (err error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			// Unexported.
+			continue
+		}
+		name := prefix + fieldName(f)
+		fv := v.Field(i)
+		if tag, ok := f.Tag.Lookup("validate"); ok {
+			err = validateField(fv, name, tag, se)
+			if err != nil {
+				return
+			}
+		}
+		err = validateStruct(fv, name+".", se)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func fieldName(f reflect.StructField) string {
+	if tag, ok := f.Tag.Lookup("json"); ok {
+		name := strings.SplitN(tag, ",", 2)[0]
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+func validateField(v reflect.Value, name, tag string, se *SchemaError) (err error) {
+	for _, rule := range strings.Split(tag, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		ruleName, arg := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			ruleName, arg = rule[:i], rule[i+1:]
+		}
+		var msg string
+		if ruleName != "required" && indirect(v).Kind() == reflect.Ptr {
+			// Optional fields that aren't set are handled by the required rule.
+			continue
+		}
+		switch ruleName {
+		case "required":
+			if v.IsZero() {
+				msg = "is required"
+			}
+		case "min", "max":
+			var limit float64
+			limit, err = strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return fmt.Errorf("invalid validate tag %q on field %q: %w", rule, name, err)
+			}
+			n, isLength, ok := measure(v)
+			if !ok {
+				return fmt.Errorf("invalid validate tag %q on field %q: unsupported kind %v", rule, name, v.Kind())
+			}
+			msg = checkLimit(ruleName, n, limit, isLength, arg)
+		case "oneof":
+			options := strings.Fields(arg)
+			actual := fmt.Sprint(indirect(v).Interface())
+			if !contains(options, actual) {
+				msg = fmt.Sprintf("must be one of %s", strings.Join(options, ", "))
+			}
+		default:
+			return fmt.Errorf("invalid validate tag on field %q: unknown rule %q", name, ruleName)
+		}
+		if msg != "" {
+			se.Violations = append(se.Violations, SchemaViolation{Field: name, Rule: ruleName, Message: msg})
+		}
+	}
+	return
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
+
+func measure(v reflect.Value) (n float64, isLength, ok bool) {
+	v = indirect(v)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), true, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false, true
+	}
+	return
+}
+
+func checkLimit(rule string, n, limit float64, isLength bool, arg string) string {
+	if rule == "min" && n >= limit || rule == "max" && n <= limit {
+		return ""
+	}
+	comparison := "at least"
+	if rule == "max" {
+		comparison = "at most"
+	}
+	if isLength {
+		return fmt.Sprintf("must have a length of %s %s", comparison, arg)
+	}
+	return fmt.Sprintf("must be %s %s", comparison, arg)
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
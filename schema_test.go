@@ -0,0 +1,154 @@
+package stream
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type Address struct {
+	Postcode string `json:"postcode" validate:"required,max=8"`
+}
+
+type PlaceOrder struct {
+	CustomerID string   `json:"customerId" validate:"required"`
+	Quantity   int      `json:"quantity" validate:"min=1,max=10"`
+	Items      []string `json:"items" validate:"min=1"`
+	Priority   string   `json:"priority" validate:"oneof=standard express"`
+	Note       *string  `json:"note" validate:"max=5"`
+	Address    Address  `json:"address"`
+}
+
+func (PlaceOrder) EventName() string { return "PlaceOrder" }
+func (PlaceOrder) IsInbound()        {}
+
+type BadTag struct {
+	Value int `validate:"min=abc"`
+}
+
+func (BadTag) EventName() string { return "BadTag" }
+func (BadTag) IsInbound()        {}
+
+func TestValidateSchema(t *testing.T) {
+	valid := PlaceOrder{
+		CustomerID: "customer",
+		Quantity:   1,
+		Items:      []string{"item"},
+		Priority:   "express",
+		Address:    Address{Postcode: "AB1 2CD"},
+	}
+	long := "too long"
+	tests := []struct {
+		name     string
+		input    PlaceOrder
+		expected []SchemaViolation
+	}{
+		{
+			name:  "valid events pass",
+			input: valid,
+		},
+		{
+			name: "required fields must be set",
+			input: func() PlaceOrder {
+				po := valid
+				po.CustomerID = ""
+				return po
+			}(),
+			expected: []SchemaViolation{
+				{Field: "customerId", Rule: "required", Message: "is required"},
+			},
+		},
+		{
+			name: "numbers are compared against their value",
+			input: func() PlaceOrder {
+				po := valid
+				po.Quantity = 11
+				return po
+			}(),
+			expected: []SchemaViolation{
+				{Field: "quantity", Rule: "max", Message: "must be at most 10"},
+			},
+		},
+		{
+			name: "slices are compared against their length",
+			input: func() PlaceOrder {
+				po := valid
+				po.Items = nil
+				return po
+			}(),
+			expected: []SchemaViolation{
+				{Field: "items", Rule: "min", Message: "must have a length of at least 1"},
+			},
+		},
+		{
+			name: "oneof restricts values",
+			input: func() PlaceOrder {
+				po := valid
+				po.Priority = "overnight"
+				return po
+			}(),
+			expected: []SchemaViolation{
+				{Field: "priority", Rule: "oneof", Message: "must be one of standard, express"},
+			},
+		},
+		{
+			name: "pointers are checked when set",
+			input: func() PlaceOrder {
+				po := valid
+				po.Note = &long
+				return po
+			}(),
+			expected: []SchemaViolation{
+				{Field: "note", Rule: "max", Message: "must have a length of at most 5"},
+			},
+		},
+		{
+			name: "nested structs are checked",
+			input: func() PlaceOrder {
+				po := valid
+				po.Address.Postcode = ""
+				return po
+			}(),
+			expected: []SchemaViolation{
+				{Field: "address.postcode", Rule: "required", Message: "is required"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Act.
+			err := ValidateSchema(tt.input)
+
+			// Assert.
+			if tt.expected == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var se *SchemaError
+			if !errors.As(err, &se) {
+				t.Fatalf("expected SchemaError, got %v", err)
+			}
+			if se.Event != "PlaceOrder" {
+				t.Errorf("expected event name PlaceOrder, got %q", se.Event)
+			}
+			if diff := cmp.Diff(tt.expected, se.Violations); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestValidateSchemaInvalidTag(t *testing.T) {
+	err := ValidateSchema(BadTag{})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	var se *SchemaError
+	if errors.As(err, &se) {
+		t.Errorf("expected invalid tags not to be reported as schema violations, got %v", err)
+	}
+}
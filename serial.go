@@ -0,0 +1,113 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+)
+
+// ErrDispatcherClosed is returned by SerialDispatcher.Dispatch after Close is called.
+var ErrDispatcherClosed = errors.New("the dispatcher is closed")
+
+// SerialDispatcher dispatches commands using a CommandBus on a fixed number of worker
+// goroutines. Commands are sharded by the ID of the entity they're addressed to, so
+// commands for the same entity are processed one at a time, in the order they were
+// dispatched, and don't cause optimistic concurrency errors within the process.
+type SerialDispatcher struct {
+	bus     *CommandBus
+	shards  []chan serialJob
+	m       sync.RWMutex
+	closed  bool
+	workers sync.WaitGroup
+}
+
+type serialJob struct {
+	ctx    context.Context
+	h      commandHandler
+	id     string
+	cmd    InboundEvent
+	opts   []ProcessorOption
+	result chan serialResult
+}
+
+type serialResult struct {
+	p   *Processor
+	err error
+}
+
+// NewSerialDispatcher starts the workers. Call Close to stop them.
+func NewSerialDispatcher(bus *CommandBus, workers int) *SerialDispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+	d := &SerialDispatcher{
+		bus:    bus,
+		shards: make([]chan serialJob, workers),
+	}
+	for i := range d.shards {
+		d.shards[i] = make(chan serialJob)
+		d.workers.Add(1)
+		go d.work(d.shards[i])
+	}
+	return d
+}
+
+func (d *SerialDispatcher) work(jobs chan serialJob) {
+	defer d.workers.Done()
+	for j := range jobs {
+		p, err := d.bus.dispatch(j.ctx, j.h, j.id, j.cmd, j.opts)
+		j.result <- serialResult{p: p, err: err}
+	}
+}
+
+// shard returns the worker that processes commands for the entity.
+func (d *SerialDispatcher) shard(id string) chan serialJob {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return d.shards[h.Sum32()%uint32(len(d.shards))]
+}
+
+// Dispatch queues the command on the worker of the entity it's addressed to, and waits
+// for it to be processed. If the context is cancelled while the command is queued, the
+// context's error is returned.
+func (d *SerialDispatcher) Dispatch(ctx context.Context, cmd InboundEvent, opts ...ProcessorOption) (p *Processor, err error) {
+	h, id, err := d.bus.resolve(cmd)
+	if err != nil {
+		return
+	}
+	d.m.RLock()
+	defer d.m.RUnlock()
+	if d.closed {
+		return nil, ErrDispatcherClosed
+	}
+	j := serialJob{
+		ctx:    ctx,
+		h:      h,
+		id:     id,
+		cmd:    cmd,
+		opts:   opts,
+		result: make(chan serialResult, 1),
+	}
+	select {
+	case d.shard(id) <- j:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	r := <-j.result
+	return r.p, r.err
+}
+
+// Close waits for the dispatched commands to be processed, and stops the workers.
+func (d *SerialDispatcher) Close() {
+	d.m.Lock()
+	defer d.m.Unlock()
+	if d.closed {
+		return
+	}
+	d.closed = true
+	for _, jobs := range d.shards {
+		close(jobs)
+	}
+	d.workers.Wait()
+}
@@ -0,0 +1,127 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+// overlapStore stores wallets, and counts the times that an entity was loaded while
+// another command for it was being processed.
+type overlapStore struct {
+	Store
+	m        sync.Mutex
+	wallets  map[string]Wallet
+	active   map[string]int
+	overlaps int
+}
+
+func (s *overlapStore) Get(id string, state State) (sequence int64, err error) {
+	s.m.Lock()
+	s.active[id]++
+	if s.active[id] > 1 {
+		s.overlaps++
+	}
+	w, ok := s.wallets[id]
+	s.m.Unlock()
+	time.Sleep(time.Millisecond)
+	if !ok {
+		return 0, ErrStateNotFound
+	}
+	*state.(*Wallet) = w
+	return 1, nil
+}
+
+func (s *overlapStore) Prepare(id string, atSequence int64, state State, inbound []InboundEvent, outbound []OutboundEvent) (items []types.TransactWriteItem, err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.active[id]--
+	s.wallets[id] = *state.(*Wallet)
+	return
+}
+
+func (s *overlapStore) Execute(items []types.TransactWriteItem) error {
+	return nil
+}
+
+func TestSerialDispatcher(t *testing.T) {
+	// Arrange.
+	store := &overlapStore{wallets: map[string]Wallet{}, active: map[string]int{}}
+	bus := NewCommandBus()
+	RegisterCommand(bus, store, func(id string) State { return &Wallet{} },
+		func(cmd WalletDeposit) (string, error) { return cmd.WalletID, nil })
+	d := NewSerialDispatcher(bus, 4)
+	defer d.Close()
+
+	// Act.
+	var wg sync.WaitGroup
+	errs := make(chan error, 60)
+	for i := 0; i < 60; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := d.Dispatch(context.Background(), WalletDeposit{WalletID: fmt.Sprintf("wallet-%d", i%3), Amount: 1}); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	// Assert.
+	for err := range errs {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if store.overlaps != 0 {
+		t.Errorf("expected commands for the same entity to be processed one at a time, got %d overlaps", store.overlaps)
+	}
+	expected := map[string]Wallet{"wallet-0": {Balance: 20}, "wallet-1": {Balance: 20}, "wallet-2": {Balance: 20}}
+	if diff := cmp.Diff(expected, store.wallets); diff != "" {
+		t.Errorf("unexpected wallets: %s", diff)
+	}
+}
+
+func TestSerialDispatcherReturnsResults(t *testing.T) {
+	// Arrange.
+	store := &overlapStore{wallets: map[string]Wallet{"a": {Balance: 10}}, active: map[string]int{}}
+	bus := NewCommandBus()
+	RegisterCommand(bus, store, func(id string) State { return &Wallet{} },
+		func(cmd WalletDeposit) (string, error) { return cmd.WalletID, nil })
+	d := NewSerialDispatcher(bus, 2)
+	defer d.Close()
+
+	// Act.
+	result, err := DispatchCommand[DepositResult](context.Background(), d, WalletDeposit{WalletID: "a", Amount: 5})
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(DepositResult{Balance: 15}, result); diff != "" {
+		t.Errorf("unexpected result: %s", diff)
+	}
+}
+
+func TestSerialDispatcherClose(t *testing.T) {
+	// Arrange.
+	store := &overlapStore{wallets: map[string]Wallet{}, active: map[string]int{}}
+	bus := NewCommandBus()
+	RegisterCommand(bus, store, func(id string) State { return &Wallet{} },
+		func(cmd WalletDeposit) (string, error) { return cmd.WalletID, nil })
+	d := NewSerialDispatcher(bus, 2)
+
+	// Act.
+	d.Close()
+	_, err := d.Dispatch(context.Background(), WalletDeposit{WalletID: "a", Amount: 5})
+
+	// Assert.
+	if !errors.Is(err, ErrDispatcherClosed) {
+		t.Errorf("expected ErrDispatcherClosed, got %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package stream
+
+// StateChanged is the outbound event emitted for each write by stores configured with
+// WithStateChangedEvents, for consumers that want the latest snapshot of the state rather
+// than domain events. Its name is the namespace followed by "StateChanged", e.g.
+// "AccountStateChanged".
+type StateChanged struct {
+	Namespace string `json:"-" dynamodbav:"-"`
+	Sequence  int64  `json:"sequence" dynamodbav:"sequence"`
+	State     State  `json:"state" dynamodbav:"state"`
+}
+
+func (e StateChanged) EventName() string { return e.Namespace + "StateChanged" }
+func (StateChanged) IsOutbound()         {}
+
+// Redacted returns the fields of the state listed by its Redactor implementation, if it
+// has one, so that they're removed from the event by the handler.
+func (e StateChanged) Redacted() (fields []string) {
+	r, ok := e.State.(Redactor)
+	if !ok {
+		return
+	}
+	for _, f := range r.Redacted() {
+		fields = append(fields, "state."+f)
+	}
+	return
+}
+
+// WithStateChangedEvents adds a StateChanged outbound event, containing the new state and
+// sequence, to each write.
+func WithStateChangedEvents(do bool) StoreOption {
+	return func(o *StoreOptions) error {
+		o.StateChangedEvents = do
+		return nil
+	}
+}
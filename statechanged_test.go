@@ -0,0 +1,47 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStateChangedEvents(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient), WithStateChangedEvents(true))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	// Act.
+	items, err := s.Prepare("id", 1, &AverageState{Sum: 3, Count: 2, Value: 1.5}, []InboundEvent{Add{Number: 2}}, []OutboundEvent{Average{Value: 1.5}})
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Assert.
+	if len(items) != 4 {
+		t.Fatalf("expected state, inbound, outbound and state changed records, got %d", len(items))
+	}
+	r := items[3].Put.Item
+	if diff := cmp.Diff("OUTBOUND/2/1/AverageStateChanged", stringAttribute(r, "_sk")); diff != "" {
+		t.Error(diff)
+	}
+	var e struct {
+		Sequence int64
+		State    AverageState
+	}
+	if err = s.Unmarshal(r, &e); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if diff := cmp.Diff(AverageState{Sum: 3, Count: 2, Value: 1.5}, e.State); diff != "" {
+		t.Error(diff)
+	}
+	if e.Sequence != 2 {
+		t.Errorf("expected sequence 2, got %d", e.Sequence)
+	}
+	if _, ok := r["sequence"].(*types.AttributeValueMemberN); !ok {
+		t.Errorf("expected the sequence to be stored as a number, got %v", r["sequence"])
+	}
+}
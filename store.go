@@ -5,8 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -14,6 +16,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/oklog/ulid/v2"
 )
 
 // ErrStateNotFound is returned if the state is not found.
@@ -27,6 +31,23 @@ type StoreOptions struct {
 	Client              *dynamodb.Client
 	PersistStateHistory bool
 	CodecTag            string
+	TimeCodec           TimeCodec
+	CapacityReporter    CapacityReporter
+	ConsistentReads     bool
+	PartialUpdates      bool
+	KMSKeyARN           string
+	KMSClient           KMSAPI
+	CryptoShredding     bool
+	HashChain           bool
+	Tenant              string
+	StateChangedEvents  bool
+	Outbox              bool
+	Registry            *Registry
+	JSONSchemas         JSONSchemas
+	Clock               Clock
+	IDGenerator         IDGenerator
+	DataKeyCacheSize    int
+	DataKeyCacheTTL     time.Duration
 }
 
 func WithRegion(region string) StoreOption {
@@ -57,38 +78,144 @@ func WithCodecTag(tag string) StoreOption {
 	}
 }
 
+// WithTimeCodec sets how time.Time fields are stored. Defaults to TimeRFC3339Nano.
+func WithTimeCodec(c TimeCodec) StoreOption {
+	return func(o *StoreOptions) error {
+		o.TimeCodec = c
+		return nil
+	}
+}
+
+// WithConsistentReads sets whether Get and Query use strongly consistent reads by default.
+// Reads are strongly consistent unless disabled.
+func WithConsistentReads(do bool) StoreOption {
+	return func(o *StoreOptions) error {
+		o.ConsistentReads = do
+		return nil
+	}
+}
+
+// WithPartialUpdates enables updating only the changed attributes of states that
+// implement the PartialState interface, instead of rewriting the whole item.
+func WithPartialUpdates(do bool) StoreOption {
+	return func(o *StoreOptions) error {
+		o.PartialUpdates = do
+		return nil
+	}
+}
+
+// WithEncryption envelope-encrypts the payload of state and event records using data keys
+// generated by the KMS key. The library's attributes, e.g. _pk, _sk and _seq, are not encrypted.
+func WithEncryption(kmsKeyARN string) StoreOption {
+	return func(o *StoreOptions) error {
+		o.KMSKeyARN = kmsKeyARN
+		return nil
+	}
+}
+
+// WithKMSClient sets the KMS client used for encryption. If not set, a client is created
+// using the default config.
+func WithKMSClient(client KMSAPI) StoreOption {
+	return func(o *StoreOptions) error {
+		o.KMSClient = client
+		return nil
+	}
+}
+
+// WithCryptoShredding stores a data key per entity in a KEY record, instead of storing
+// the encrypted data key in each record. Use Shred to delete the key. Requires WithEncryption.
+func WithCryptoShredding(do bool) StoreOption {
+	return func(o *StoreOptions) error {
+		o.CryptoShredding = do
+		return nil
+	}
+}
+
+// WithDataKeyCache sets the number of plaintext data keys held in memory, and how long
+// they're held for. Within the TTL, writes to an entity reuse its data key instead of
+// calling KMS each time. Defaults to DefaultDataKeyCacheSize and DefaultDataKeyCacheTTL.
+func WithDataKeyCache(size int, ttl time.Duration) StoreOption {
+	return func(o *StoreOptions) error {
+		o.DataKeyCacheSize = size
+		o.DataKeyCacheTTL = ttl
+		return nil
+	}
+}
+
+// WithHashChain adds _hash and _prevHash attributes to each event, so that the event log
+// can be checked for modifications with VerifyChain.
+func WithHashChain(do bool) StoreOption {
+	return func(o *StoreOptions) error {
+		o.HashChain = do
+		return nil
+	}
+}
+
+// WithCapacityReporter requests the consumed capacity of all store operations, and passes
+// it to the reporter.
+func WithCapacityReporter(r CapacityReporter) StoreOption {
+	return func(o *StoreOptions) error {
+		o.CapacityReporter = r
+		return nil
+	}
+}
+
 // NewStore creates a new store using default config.
 func NewStore(tableName, namespace string, opts ...StoreOption) (s *DynamoDBStore, err error) {
-	o := StoreOptions{}
+	o := StoreOptions{
+		ConsistentReads: true,
+		Clock:           SystemClock,
+	}
 	for _, opt := range opts {
 		err = opt(&o)
 		if err != nil {
 			return
 		}
 	}
-	if o.Client == nil {
+	if o.CryptoShredding && o.KMSKeyARN == "" {
+		err = errors.New("crypto shredding requires encryption")
+		return
+	}
+	if o.Client == nil || (o.KMSKeyARN != "" && o.KMSClient == nil) {
 		var cfg aws.Config
 		cfg, err = config.LoadDefaultConfig(context.Background(), config.WithRegion(o.Region))
 		if err != nil {
 			return
 		}
-		o.Client = dynamodb.NewFromConfig(cfg)
+		if o.Client == nil {
+			o.Client = dynamodb.NewFromConfig(cfg)
+		}
+		if o.KMSKeyARN != "" && o.KMSClient == nil {
+			o.KMSClient = kms.NewFromConfig(cfg)
+		}
 	}
 	s = &DynamoDBStore{
-		Client:              o.Client,
-		TableName:           aws.String(tableName),
-		Namespace:           namespace,
-		PersistStateHistory: o.PersistStateHistory,
-		Encoder: attributevalue.NewEncoder(func(opts *attributevalue.EncoderOptions) {
-			opts.TagKey = o.CodecTag
-		}),
-		Decoder: attributevalue.NewDecoder(func(opts *attributevalue.DecoderOptions) {
-			opts.TagKey = o.CodecTag
-		}),
-		Now: func() time.Time {
-			return time.Now().UTC()
-		},
+		Client:                    o.Client,
+		TableName:                 aws.String(tableName),
+		Namespace:                 namespace,
+		PersistStateHistory:       o.PersistStateHistory,
+		CapacityReporter:          o.CapacityReporter,
+		EventuallyConsistentReads: !o.ConsistentReads,
+		PartialUpdates:            o.PartialUpdates,
+		KMSKeyARN:                 o.KMSKeyARN,
+		KMS:                       o.KMSClient,
+		CryptoShredding:           o.CryptoShredding,
+		DataKeyCacheSize:          o.DataKeyCacheSize,
+		DataKeyCacheTTL:           o.DataKeyCacheTTL,
+		HashChain:                 o.HashChain,
+		Tenant:                    o.Tenant,
+		StateChangedEvents:        o.StateChangedEvents,
+		Outbox:                    o.Outbox,
+		Registry:                  o.Registry,
+		JSONSchemas:               o.JSONSchemas,
+		Encoder:                   newEncoder(o),
+		Decoder:                   newDecoder(o),
+		Now:                       o.Clock.Now,
+	}
+	if o.IDGenerator == nil {
+		o.IDGenerator = ULIDGenerator(o.Clock)
 	}
+	s.NewID = o.IDGenerator.NewID
 	return
 }
 
@@ -108,66 +235,308 @@ type DynamoDBStore struct {
 	PersistStateHistory bool
 	Encoder             *attributevalue.Encoder
 	Decoder             *attributevalue.Decoder
-	Now                 func() time.Time
+	// Now returns the time of records, see WithClock.
+	Now func() time.Time
+	// NewID returns a unique ID for each inbound and outbound event record, see
+	// WithIDGenerator. Defaults to a ULID.
+	NewID func() string
+	// CapacityReporter, if set, receives the capacity consumed by each operation.
+	CapacityReporter CapacityReporter
+	// EventuallyConsistentReads changes the default read consistency of Get and Query.
+	EventuallyConsistentReads bool
+	// PartialUpdates enables UpdateItem expressions for states that implement PartialState.
+	PartialUpdates bool
+	// KMSKeyARN, if set, is used to encrypt the payload of records.
+	KMSKeyARN string
+	// KMS is used to generate and decrypt data keys.
+	KMS KMSAPI
+	// CryptoShredding stores a data key per entity, so that it can be deleted by Shred.
+	CryptoShredding bool
+	// HashChain links each event to its predecessor with a hash, see VerifyChain.
+	HashChain bool
+	// Tenant, if set, prefixes partition keys so that the store can only access the tenant's records.
+	Tenant string
+	// StateChangedEvents adds a StateChanged outbound event to each write.
+	StateChangedEvents bool
+	// Outbox stores an _outbox attribute on outbound records, see WithOutbox.
+	Outbox bool
+	// Registry of event readers used when nil readers are passed to Query, see WithRegistry.
+	Registry *Registry
+	// JSONSchemas that inbound and outbound events are validated against, see WithJSONSchemas.
+	JSONSchemas JSONSchemas
+	// DataKeyCacheSize is the maximum number of plaintext data keys held in memory.
+	// Defaults to DefaultDataKeyCacheSize.
+	DataKeyCacheSize int
+	// DataKeyCacheTTL is how long plaintext data keys are held in memory, and reused for
+	// writes. Defaults to DefaultDataKeyCacheTTL.
+	DataKeyCacheTTL time.Duration
+	// dataKeys caches plaintext data keys, see keyCache.
+	dataKeys     *dataKeyCache
+	dataKeysOnce sync.Once
+}
+
+// ReadOption overrides the store defaults for a single read.
+type ReadOption func(*ReadOptions)
+
+// ReadOptions for a single read.
+type ReadOptions struct {
+	ConsistentRead bool
+	// Projection, if not nil, limits the attributes returned by Query.
+	Projection []string
+}
+
+// ConsistentRead overrides the store's read consistency for a single call, e.g.
+// to use cheaper eventually-consistent reads for a latency-sensitive endpoint.
+func ConsistentRead(do bool) ReadOption {
+	return func(o *ReadOptions) {
+		o.ConsistentRead = do
+	}
+}
+
+// Projection limits Query to returning the named top-level attributes of each record,
+// e.g. to read event names and timestamps without transferring the event payloads. The
+// library's attributes, e.g. _typ and _ts, are always returned, so Projection() with no
+// attributes returns only the library's attributes. Unprojected fields of the state and
+// events are left empty.
+func Projection(attributes ...string) ReadOption {
+	return func(o *ReadOptions) {
+		o.Projection = append([]string{}, attributes...)
+	}
+}
+
+// projectedAttributes are returned by Query regardless of the projection.
+var projectedAttributes = []string{"_pk", "_sk", "_seq", "_typ", "_ts", "_date", "_fmt", "_id", "_ver", "_enc", "_key"}
+
+// createProjectionExpression adds the projected attributes to the expression attribute
+// names, and returns the projection expression.
+func createProjectionExpression(attributes []string, names map[string]string) *string {
+	expression := make([]string, 0, len(projectedAttributes)+len(attributes))
+	for _, name := range projectedAttributes {
+		names["#"+name] = name
+		expression = append(expression, "#"+name)
+	}
+	for i, name := range attributes {
+		names[fmt.Sprintf("#p%d", i)] = name
+		expression = append(expression, fmt.Sprintf("#p%d", i))
+	}
+	return aws.String(strings.Join(expression, ", "))
+}
+
+// project removes the unprojected payload attributes of a record, since the payload of
+// encrypted records is returned in full.
+func project(r map[string]types.AttributeValue, attributes []string) map[string]types.AttributeValue {
+	projected := make(map[string]types.AttributeValue, len(projectedAttributes)+len(attributes))
+	for _, name := range projectedAttributes {
+		if v, ok := r[name]; ok {
+			projected[name] = v
+		}
+	}
+	for _, name := range attributes {
+		if v, ok := r[name]; ok {
+			projected[name] = v
+		}
+	}
+	return projected
+}
+
+func (ddb *DynamoDBStore) readOptions(opts []ReadOption) (o ReadOptions) {
+	o.ConsistentRead = !ddb.EventuallyConsistentReads
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return
+}
+
+// Operation names passed to the CapacityReporter.
+const (
+	OperationGet       = "Get"
+	OperationExecute   = "Execute"
+	OperationQuery     = "Query"
+	OperationShred     = "Shred"
+	OperationScan      = "Scan"
+	OperationReserve   = "Reserve"
+	OperationImport    = "Import"
+	OperationRepublish = "Republish"
+)
+
+// CapacityReporter receives the capacity consumed by a store operation, e.g. to
+// attribute RCU/WCU cost per namespace and per operation.
+type CapacityReporter func(namespace, operation string, capacity []types.ConsumedCapacity)
+
+func (ddb *DynamoDBStore) returnConsumedCapacity() types.ReturnConsumedCapacity {
+	if ddb.CapacityReporter == nil {
+		return types.ReturnConsumedCapacityNone
+	}
+	return types.ReturnConsumedCapacityTotal
+}
+
+func (ddb *DynamoDBStore) reportCapacity(operation string, capacity ...types.ConsumedCapacity) {
+	if ddb.CapacityReporter == nil || len(capacity) == 0 {
+		return
+	}
+	ddb.CapacityReporter(ddb.Namespace, operation, capacity)
 }
 
 // Get data using the id and populate the state variable.
 func (ddb *DynamoDBStore) Get(id string, state State) (sequence int64, err error) {
+	return ddb.GetWithOptions(id, state)
+}
+
+// GetWithOptions gets data using the id and populates the state variable, overriding the
+// store defaults with the options.
+func (ddb *DynamoDBStore) GetWithOptions(id string, state State, opts ...ReadOption) (sequence int64, err error) {
+	return ddb.get(context.Background(), id, state, opts...)
+}
+
+func (ddb *DynamoDBStore) get(ctx context.Context, id string, state State, opts ...ReadOption) (sequence int64, err error) {
 	if reflect.ValueOf(state).Kind() != reflect.Ptr {
 		err = errors.New("the state parameter must be a pointer")
 		return
 	}
-	gio, err := ddb.Client.GetItem(context.Background(), &dynamodb.GetItemInput{
+	o := ddb.readOptions(opts)
+	gio, err := ddb.Client.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName:      ddb.TableName,
-		ConsistentRead: aws.Bool(true),
+		ConsistentRead: aws.Bool(o.ConsistentRead),
 		Key: map[string]types.AttributeValue{
 			"_pk": &types.AttributeValueMemberS{Value: ddb.createPartitionKey(id)},
 			"_sk": &types.AttributeValueMemberS{Value: ddb.createStateRecordSortKey()},
 		},
+		ReturnConsumedCapacity: ddb.returnConsumedCapacity(),
 	})
 	if err != nil {
 		return
 	}
+	if gio.ConsumedCapacity != nil {
+		ddb.reportCapacity(OperationGet, *gio.ConsumedCapacity)
+	}
 	if len(gio.Item) == 0 {
 		err = ErrStateNotFound
 		return
 	}
-	err = ddb.unmarshalMap(gio.Item, state)
+	err = checkRecordFormat(gio.Item)
+	if err != nil {
+		return
+	}
+	item, err := ddb.decryptRecord(ctx, gio.Item, ddb.newEntityKeyLoader(ctx, id))
+	if err != nil {
+		return
+	}
+	err = ddb.unmarshalMap(item, state)
 	if err != nil {
 		return
 	}
-	return ddb.getRecordSequenceNumber(gio.Item)
+	return ddb.getRecordSequenceNumber(item)
 }
 
 // Put the updated state in the database.
 func (ddb *DynamoDBStore) Put(id string, atSequence int64, state State, inbound []InboundEvent, outbound []OutboundEvent) error {
-	items, err := ddb.Prepare(id, atSequence, state, inbound, outbound)
+	return ddb.PutWithOptions(id, atSequence, state, inbound, outbound)
+}
+
+// PutWithOptions puts the updated state in the database, applying the write options.
+func (ddb *DynamoDBStore) PutWithOptions(id string, atSequence int64, state State, inbound []InboundEvent, outbound []OutboundEvent, opts ...WriteOption) error {
+	return ddb.put(context.Background(), id, atSequence, state, inbound, outbound, opts...)
+}
+
+func (ddb *DynamoDBStore) put(ctx context.Context, id string, atSequence int64, state State, inbound []InboundEvent, outbound []OutboundEvent, opts ...WriteOption) error {
+	items, err := ddb.prepare(ctx, id, atSequence, state, inbound, outbound, opts...)
 	if err != nil {
 		return err
 	}
-	return ddb.Execute(items)
+	return ddb.execute(ctx, items)
 }
 
 // Execute a prepared transaction.
 func (ddb *DynamoDBStore) Execute(items []types.TransactWriteItem) error {
-	_, err := ddb.Client.TransactWriteItems(context.Background(), &dynamodb.TransactWriteItemsInput{
-		TransactItems: items,
+	return ddb.execute(context.Background(), items)
+}
+
+func (ddb *DynamoDBStore) execute(ctx context.Context, items []types.TransactWriteItem) error {
+	twio, err := ddb.Client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems:          items,
+		ReturnConsumedCapacity: ddb.returnConsumedCapacity(),
 	})
 	if err != nil {
 		var transactionCanceled *types.TransactionCanceledException
 		if errors.As(err, &transactionCanceled) {
-			for _, reason := range transactionCanceled.CancellationReasons {
+			for i, reason := range transactionCanceled.CancellationReasons {
 				if *reason.Code == "ConditionalCheckFailed" {
+					if i < len(items) && ddb.isExternalItem(items[i]) {
+						return ErrConditionCheckFailed
+					}
 					return ErrOptimisticConcurrency
 				}
 			}
 		}
+		return err
 	}
-	return err
+	ddb.reportCapacity(OperationExecute, twio.ConsumedCapacity...)
+	return nil
+}
+
+// WithContext returns the store with its Get, Put, Prepare, Execute and Query requests
+// bound to the context, so that they're cancelled with it.
+func (ddb *DynamoDBStore) WithContext(ctx context.Context) Store {
+	return &contextStore{DynamoDBStore: ddb, ctx: ctx}
+}
+
+// contextStore is a DynamoDBStore whose requests use ctx instead of context.Background().
+type contextStore struct {
+	*DynamoDBStore
+	ctx context.Context
+}
+
+func (s *contextStore) Get(id string, state State) (sequence int64, err error) {
+	return s.get(s.ctx, id, state)
+}
+
+func (s *contextStore) GetWithOptions(id string, state State, opts ...ReadOption) (sequence int64, err error) {
+	return s.get(s.ctx, id, state, opts...)
+}
+
+func (s *contextStore) Put(id string, atSequence int64, state State, inbound []InboundEvent, outbound []OutboundEvent) error {
+	return s.put(s.ctx, id, atSequence, state, inbound, outbound)
+}
+
+func (s *contextStore) PutWithOptions(id string, atSequence int64, state State, inbound []InboundEvent, outbound []OutboundEvent, opts ...WriteOption) error {
+	return s.put(s.ctx, id, atSequence, state, inbound, outbound, opts...)
+}
+
+func (s *contextStore) Prepare(id string, atSequence int64, state State, inbound []InboundEvent, outbound []OutboundEvent) (items []types.TransactWriteItem, err error) {
+	return s.prepare(s.ctx, id, atSequence, state, inbound, outbound)
+}
+
+func (s *contextStore) PrepareWithOptions(id string, atSequence int64, state State, inbound []InboundEvent, outbound []OutboundEvent, opts ...WriteOption) (items []types.TransactWriteItem, err error) {
+	return s.prepare(s.ctx, id, atSequence, state, inbound, outbound, opts...)
+}
+
+func (s *contextStore) Execute(items []types.TransactWriteItem) error {
+	return s.execute(s.ctx, items)
+}
+
+func (s *contextStore) Query(id string, state State, inboundEventReader *InboundEventReader, outboundEventReader *OutboundEventReader, opts ...ReadOption) (sequence int64, inbound []InboundEvent, outbound []OutboundEvent, err error) {
+	return s.query(s.ctx, id, state, inboundEventReader, outboundEventReader, opts...)
+}
+
+func (s *contextStore) QueryWithHistory(id string, state State, inboundEventReader *InboundEventReader, outboundEventReader *OutboundEventReader, stateHistoryReader *StateHistoryReader, opts ...ReadOption) (sequence int64, inbound []InboundEvent, outbound []OutboundEvent, stateHistory []State, err error) {
+	return s.queryWithHistory(s.ctx, id, state, inboundEventReader, outboundEventReader, stateHistoryReader, opts...)
 }
 
 // Prepare the transaction.
 func (ddb *DynamoDBStore) Prepare(id string, atSequence int64, state State, inbound []InboundEvent, outbound []OutboundEvent) (items []types.TransactWriteItem, err error) {
+	return ddb.PrepareWithOptions(id, atSequence, state, inbound, outbound)
+}
+
+// PrepareWithOptions prepares the transaction, applying the write options.
+func (ddb *DynamoDBStore) PrepareWithOptions(id string, atSequence int64, state State, inbound []InboundEvent, outbound []OutboundEvent, opts ...WriteOption) (items []types.TransactWriteItem, err error) {
+	return ddb.prepare(context.Background(), id, atSequence, state, inbound, outbound, opts...)
+}
+
+func (ddb *DynamoDBStore) prepare(ctx context.Context, id string, atSequence int64, state State, inbound []InboundEvent, outbound []OutboundEvent, opts ...WriteOption) (items []types.TransactWriteItem, err error) {
+	o := newWriteOptions(opts)
+	if err = ddb.validateJSONSchemas(inbound, outbound); err != nil {
+		return
+	}
 	atSequence++
 	stwi, err := ddb.createStateTransactWriteItems(id, atSequence, state)
 	if err != nil {
@@ -177,6 +546,9 @@ func (ddb *DynamoDBStore) Prepare(id string, atSequence int64, state State, inbo
 	if err != nil {
 		return
 	}
+	if ddb.StateChangedEvents {
+		outbound = append(outbound[:len(outbound):len(outbound)], StateChanged{Namespace: ddb.Namespace, Sequence: atSequence, State: state})
+	}
 	otwi, err := ddb.createOutboundTransactWriteItems(id, atSequence, outbound)
 	if err != nil {
 		return
@@ -184,21 +556,36 @@ func (ddb *DynamoDBStore) Prepare(id string, atSequence int64, state State, inbo
 	items = append(items, stwi...)
 	items = append(items, itwi...)
 	items = append(items, otwi...)
+	ddb.stampMetadata(items, o.Metadata)
+	err = ddb.chainItems(ctx, id, atSequence, items)
+	if err != nil {
+		return
+	}
+	items, err = ddb.encryptItems(ctx, id, items)
+	if err != nil {
+		return
+	}
+	items = append(items, o.Items...)
 	return
 }
 
 func (ddb *DynamoDBStore) createInboundTransactWriteItems(id string, atSequence int64, inbound []InboundEvent) (puts []types.TransactWriteItem, err error) {
 	puts = make([]types.TransactWriteItem, len(inbound))
 	for i := 0; i < len(inbound); i++ {
+		name, _ := eventNameAndVersion(inbound[i])
 		var item map[string]types.AttributeValue
 		item, err = ddb.createRecord(id,
-			ddb.createInboundRecordSortKey(inbound[i].EventName(), atSequence, i),
+			ddb.createInboundRecordSortKey(name, atSequence, i),
 			atSequence,
 			inbound[i],
-			inbound[i].EventName())
+			name)
 		if err != nil {
 			return
 		}
+		item["_id"] = ddb.attributeValueString(ddb.newEventID())
+		if version, ok := ddb.attributeValueEventVersion(inbound[i]); ok {
+			item["_ver"] = version
+		}
 		puts[i] = ddb.createPut(item)
 	}
 	return
@@ -207,15 +594,35 @@ func (ddb *DynamoDBStore) createInboundTransactWriteItems(id string, atSequence
 func (ddb *DynamoDBStore) createOutboundTransactWriteItems(id string, atSequence int64, outbound []OutboundEvent) (puts []types.TransactWriteItem, err error) {
 	puts = make([]types.TransactWriteItem, len(outbound))
 	for i := 0; i < len(outbound); i++ {
+		name, _ := eventNameAndVersion(outbound[i])
 		var item map[string]types.AttributeValue
 		item, err = ddb.createRecord(id,
-			ddb.createOutboundRecordSortKey(outbound[i].EventName(), atSequence, i),
+			ddb.createOutboundRecordSortKey(name, atSequence, i),
 			atSequence,
 			outbound[i],
-			outbound[i].EventName())
+			name)
 		if err != nil {
 			return
 		}
+		item["_id"] = ddb.attributeValueString(ddb.newEventID())
+		if version, ok := ddb.attributeValueEventVersion(outbound[i]); ok {
+			item["_ver"] = version
+		}
+		if redacted, ok := ddb.attributeValueRedacted(outbound[i]); ok {
+			item["_redact"] = redacted
+		}
+		if priority, ok := ddb.attributeValuePriority(outbound[i]); ok {
+			item["_priority"] = priority
+		}
+		for k, v := range ddb.attributeValuesEventBridge(outbound[i]) {
+			item[k] = v
+		}
+		if requiresConfirmation(outbound[i]) {
+			item["_pending"] = ddb.attributeValueInteger(ddb.Now().Unix())
+		}
+		if ddb.Outbox {
+			item["_outbox"] = ddb.attributeValueString(ddb.OutboxPartition())
+		}
 		puts[i] = ddb.createPut(item)
 	}
 	return
@@ -256,8 +663,79 @@ func (ddb *DynamoDBStore) createStateTransactWriteItem(id string, atSequence int
 	return
 }
 
+func (ddb *DynamoDBStore) createStateUpdateTransactWriteItem(id string, atSequence int64, changes ChangeSet) (twi types.TransactWriteItem, err error) {
+	names := map[string]string{
+		"#_seq":  "_seq",
+		"#_ts":   "_ts",
+		"#_date": "_date",
+		"#_fmt":  "_fmt",
+	}
+	values := map[string]types.AttributeValue{
+		":_seq":     ddb.attributeValueInteger(atSequence - 1),
+		":_seq_new": ddb.attributeValueInteger(atSequence),
+		":_ts":      ddb.attributeValueInteger(ddb.Now().Unix()),
+		":_date":    ddb.attributeValueString(ddb.Now().Format(time.RFC3339)),
+		":_fmt":     ddb.attributeValueString(formatVersion()),
+	}
+	set := []string{"#_seq = :_seq_new", "#_ts = :_ts", "#_date = :_date", "#_fmt = :_fmt"}
+	setNames := make([]string, 0, len(changes.Set))
+	for name := range changes.Set {
+		setNames = append(setNames, name)
+	}
+	sort.Strings(setNames)
+	for i, name := range setNames {
+		if strings.HasPrefix(name, "_") {
+			err = fmt.Errorf("partial update: cannot set reserved attribute %q", name)
+			return
+		}
+		var av types.AttributeValue
+		av, err = ddb.Encoder.Encode(changes.Set[name])
+		if err != nil {
+			err = fmt.Errorf("partial update: error marshalling attribute %q: %w", name, err)
+			return
+		}
+		names[fmt.Sprintf("#s%d", i)] = name
+		values[fmt.Sprintf(":s%d", i)] = av
+		set = append(set, fmt.Sprintf("#s%d = :s%d", i, i))
+	}
+	expression := "SET " + strings.Join(set, ", ")
+	if len(changes.Remove) > 0 {
+		remove := make([]string, len(changes.Remove))
+		for i, name := range changes.Remove {
+			if strings.HasPrefix(name, "_") {
+				err = fmt.Errorf("partial update: cannot remove reserved attribute %q", name)
+				return
+			}
+			names[fmt.Sprintf("#r%d", i)] = name
+			remove[i] = fmt.Sprintf("#r%d", i)
+		}
+		expression += " REMOVE " + strings.Join(remove, ", ")
+	}
+	twi = types.TransactWriteItem{
+		Update: &types.Update{
+			TableName: ddb.TableName,
+			Key: map[string]types.AttributeValue{
+				"_pk": ddb.attributeValueString(ddb.createPartitionKey(id)),
+				"_sk": ddb.attributeValueString(ddb.createStateRecordSortKey()),
+			},
+			UpdateExpression:          aws.String(expression),
+			ConditionExpression:       aws.String("#_seq = :_seq"),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		},
+	}
+	return
+}
+
 func (ddb *DynamoDBStore) createStateTransactWriteItems(id string, atSequence int64, state State) (twis []types.TransactWriteItem, err error) {
-	twi, err := ddb.createStateTransactWriteItem(id, atSequence, state, ddb.createStateRecordSortKey())
+	var twi types.TransactWriteItem
+	ps, isPartial := state.(PartialState)
+	// Encrypted records can't be partially updated, because the payload is a single attribute.
+	if ddb.PartialUpdates && isPartial && atSequence > 1 && !ddb.isEncrypted() {
+		twi, err = ddb.createStateUpdateTransactWriteItem(id, atSequence, ps.Changes())
+	} else {
+		twi, err = ddb.createStateTransactWriteItem(id, atSequence, state, ddb.createStateRecordSortKey())
+	}
 	if err != nil {
 		return
 	}
@@ -273,6 +751,9 @@ func (ddb *DynamoDBStore) createStateTransactWriteItems(id string, atSequence in
 }
 
 func (ddb *DynamoDBStore) createPartitionKey(id string) string {
+	if ddb.Tenant != "" {
+		return fmt.Sprintf(`%s/%s/%s`, ddb.Tenant, ddb.Namespace, id)
+	}
 	return fmt.Sprintf(`%s/%s`, ddb.Namespace, id)
 }
 
@@ -280,6 +761,14 @@ func (ddb *DynamoDBStore) createStateRecordSortKey() string {
 	return "STATE"
 }
 
+func (ddb *DynamoDBStore) createKeyRecordSortKey() string {
+	return "KEY"
+}
+
+func (ddb *DynamoDBStore) createCounterRecordSortKey() string {
+	return "COUNTER"
+}
+
 func (ddb *DynamoDBStore) createVersionedRecordSortKey(atSequence int64) string {
 	return fmt.Sprintf("STATE/%d", atSequence)
 }
@@ -292,6 +781,10 @@ func (ddb *DynamoDBStore) createOutboundRecordSortKey(typeName string, sequence
 	return fmt.Sprintf(`OUTBOUND/%d/%d/%s`, sequence, index, typeName)
 }
 
+func (ddb *DynamoDBStore) createAnnotationRecordSortKey(eventSortKey, annotationID string) string {
+	return fmt.Sprintf(`ANNOTATION/%s/%s`, eventSortKey, annotationID)
+}
+
 func (ddb *DynamoDBStore) attributeValueString(v string) types.AttributeValue {
 	return &types.AttributeValueMemberS{Value: v}
 }
@@ -308,12 +801,16 @@ func (ddb *DynamoDBStore) createRecord(id, sk string, sequence int64, item inter
 		return
 	}
 	record["_namespace"] = ddb.attributeValueString(ddb.Namespace)
+	if ddb.Tenant != "" {
+		record["_tenant"] = ddb.attributeValueString(ddb.Tenant)
+	}
 	record["_pk"] = ddb.attributeValueString(ddb.createPartitionKey(id))
 	record["_seq"] = ddb.attributeValueInteger(int64(sequence))
 	record["_sk"] = ddb.attributeValueString(sk)
 	record["_typ"] = ddb.attributeValueString(recordName)
 	record["_ts"] = ddb.attributeValueInteger(ddb.Now().Unix())
 	record["_date"] = ddb.attributeValueString(ddb.Now().Format(time.RFC3339))
+	record["_fmt"] = ddb.attributeValueString(formatVersion())
 	return
 }
 
@@ -345,14 +842,37 @@ func (ddb *DynamoDBStore) getRecordType(r map[string]types.AttributeValue) (typ
 	return v.Value, nil
 }
 
+func (ddb *DynamoDBStore) newEventID() string {
+	if ddb.NewID == nil {
+		return ulid.Make().String()
+	}
+	return ddb.NewID()
+}
+
+// EventID returns the unique ID of an inbound or outbound event record, e.g. to use in
+// an event reader, or an empty string if the record doesn't have one.
+func EventID(item map[string]types.AttributeValue) string {
+	if v, ok := item["_id"].(*types.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
 func NewInboundEventReader() *InboundEventReader {
 	return &InboundEventReader{
-		readers: make(map[string]func(item map[string]types.AttributeValue) (InboundEvent, error), 0),
+		readers:   make(map[string]func(item map[string]types.AttributeValue) (InboundEvent, error), 0),
+		upcasters: make(upcasters),
 	}
 }
 
 type InboundEventReader struct {
-	readers map[string]func(item map[string]types.AttributeValue) (InboundEvent, error)
+	readers   map[string]func(item map[string]types.AttributeValue) (InboundEvent, error)
+	upcasters upcasters
+	// types of the events added with Register.
+	types map[string]reflect.Type
+	// Unmarshal decodes the records of events added with Register. Defaults to
+	// attributevalue.UnmarshalMap. Set it to DynamoDBStore.Unmarshal to use the store's codec.
+	Unmarshal func(item map[string]types.AttributeValue, out interface{}) error
 }
 
 func (r *InboundEventReader) Add(eventName string, f func(item map[string]types.AttributeValue) (InboundEvent, error)) *InboundEventReader {
@@ -360,23 +880,51 @@ func (r *InboundEventReader) Add(eventName string, f func(item map[string]types.
 	return r
 }
 
+// Upcast registers a function that transforms stored records of the event from a version
+// to the next, before they're read. Upcasters are chained, so records are upcast from their
+// stored version to the latest.
+func (r *InboundEventReader) Upcast(eventName string, fromVersion int, f Upcaster) *InboundEventReader {
+	r.upcasters.add(eventName, fromVersion, f)
+	return r
+}
+
+// Read the record. Readers added for the record's versioned event name, e.g. "GamePlayed@2",
+// take precedence over readers added for the event name, which read records after they're
+// upcast.
 func (r *InboundEventReader) Read(eventName string, item map[string]types.AttributeValue) (e InboundEvent, ok bool, err error) {
+	if version, versionErr := getRecordEventVersion(item); versionErr == nil {
+		if f, exact := r.readers[VersionedEventName(eventName, version)]; exact {
+			e, err = f(item)
+			return e, true, err
+		}
+	}
 	f, ok := r.readers[eventName]
 	if !ok {
 		return
 	}
+	item, err = r.upcasters.upcast(eventName, item)
+	if err != nil {
+		return
+	}
 	e, err = f(item)
 	return
 }
 
 func NewOutboundEventReader() *OutboundEventReader {
 	return &OutboundEventReader{
-		readers: make(map[string]func(item map[string]types.AttributeValue) (OutboundEvent, error), 0),
+		readers:   make(map[string]func(item map[string]types.AttributeValue) (OutboundEvent, error), 0),
+		upcasters: make(upcasters),
 	}
 }
 
 type OutboundEventReader struct {
-	readers map[string]func(item map[string]types.AttributeValue) (OutboundEvent, error)
+	readers   map[string]func(item map[string]types.AttributeValue) (OutboundEvent, error)
+	upcasters upcasters
+	// types of the events added with Register.
+	types map[string]reflect.Type
+	// Unmarshal decodes the records of events added with Register. Defaults to
+	// attributevalue.UnmarshalMap. Set it to DynamoDBStore.Unmarshal to use the store's codec.
+	Unmarshal func(item map[string]types.AttributeValue, out interface{}) error
 }
 
 func (r *OutboundEventReader) Add(eventName string, f func(item map[string]types.AttributeValue) (OutboundEvent, error)) *OutboundEventReader {
@@ -384,11 +932,32 @@ func (r *OutboundEventReader) Add(eventName string, f func(item map[string]types
 	return r
 }
 
+// Upcast registers a function that transforms stored records of the event from a version
+// to the next, before they're read. Upcasters are chained, so records are upcast from their
+// stored version to the latest.
+func (r *OutboundEventReader) Upcast(eventName string, fromVersion int, f Upcaster) *OutboundEventReader {
+	r.upcasters.add(eventName, fromVersion, f)
+	return r
+}
+
+// Read the record. Readers added for the record's versioned event name, e.g. "GamePlayed@2",
+// take precedence over readers added for the event name, which read records after they're
+// upcast.
 func (r *OutboundEventReader) Read(eventName string, item map[string]types.AttributeValue) (e OutboundEvent, ok bool, err error) {
+	if version, versionErr := getRecordEventVersion(item); versionErr == nil {
+		if f, exact := r.readers[VersionedEventName(eventName, version)]; exact {
+			e, err = f(item)
+			return e, true, err
+		}
+	}
 	f, ok := r.readers[eventName]
 	if !ok {
 		return
 	}
+	item, err = r.upcasters.upcast(eventName, item)
+	if err != nil {
+		return
+	}
 	e, err = f(item)
 	return
 }
@@ -406,34 +975,48 @@ func (r *StateHistoryReader) Read(item map[string]types.AttributeValue) (e State
 	return
 }
 
-func (ddb *DynamoDBStore) queryPages(qi *dynamodb.QueryInput, pager func(*dynamodb.QueryOutput, bool) bool) (err error) {
+func (ddb *DynamoDBStore) queryPages(ctx context.Context, qi *dynamodb.QueryInput, pager func(*dynamodb.QueryOutput, bool) bool) (err error) {
 	pages := dynamodb.NewQueryPaginator(ddb.Client, qi)
 	for carryOn := pages.HasMorePages(); carryOn && pages.HasMorePages(); {
 		var page *dynamodb.QueryOutput
-		page, err = pages.NextPage(context.Background())
+		page, err = pages.NextPage(ctx)
 		if err != nil {
 			return err
 		}
+		if page.ConsumedCapacity != nil {
+			ddb.reportCapacity(OperationQuery, *page.ConsumedCapacity)
+		}
 		carryOn = pager(page, pages.HasMorePages())
 	}
 	return
 }
 
-func (ddb *DynamoDBStore) Query(id string, state State, inboundEventReader *InboundEventReader, outboundEventReader *OutboundEventReader) (sequence int64, inbound []InboundEvent, outbound []OutboundEvent, err error) {
+func (ddb *DynamoDBStore) Query(id string, state State, inboundEventReader *InboundEventReader, outboundEventReader *OutboundEventReader, opts ...ReadOption) (sequence int64, inbound []InboundEvent, outbound []OutboundEvent, err error) {
+	return ddb.query(context.Background(), id, state, inboundEventReader, outboundEventReader, opts...)
+}
+
+func (ddb *DynamoDBStore) query(ctx context.Context, id string, state State, inboundEventReader *InboundEventReader, outboundEventReader *OutboundEventReader, opts ...ReadOption) (sequence int64, inbound []InboundEvent, outbound []OutboundEvent, err error) {
 	noopStateHistoryReader := NewStateHistoryReader(func(item map[string]types.AttributeValue) (State, error) { return nil, nil })
-	sequence, inbound, outbound, _, err = ddb.QueryWithHistory(id, state, inboundEventReader, outboundEventReader, noopStateHistoryReader)
+	sequence, inbound, outbound, _, err = ddb.queryWithHistory(ctx, id, state, inboundEventReader, outboundEventReader, noopStateHistoryReader, opts...)
 	return
 }
 
 // Query data for the id.
-func (ddb *DynamoDBStore) QueryWithHistory(id string, state State, inboundEventReader *InboundEventReader, outboundEventReader *OutboundEventReader, stateHistoryReader *StateHistoryReader) (sequence int64, inbound []InboundEvent, outbound []OutboundEvent, stateHistory []State, err error) {
+func (ddb *DynamoDBStore) QueryWithHistory(id string, state State, inboundEventReader *InboundEventReader, outboundEventReader *OutboundEventReader, stateHistoryReader *StateHistoryReader, opts ...ReadOption) (sequence int64, inbound []InboundEvent, outbound []OutboundEvent, stateHistory []State, err error) {
+	return ddb.queryWithHistory(context.Background(), id, state, inboundEventReader, outboundEventReader, stateHistoryReader, opts...)
+}
+
+func (ddb *DynamoDBStore) queryWithHistory(ctx context.Context, id string, state State, inboundEventReader *InboundEventReader, outboundEventReader *OutboundEventReader, stateHistoryReader *StateHistoryReader, opts ...ReadOption) (sequence int64, inbound []InboundEvent, outbound []OutboundEvent, stateHistory []State, err error) {
 	if reflect.ValueOf(state).Kind() != reflect.Ptr {
 		err = errors.New("the state parameter must be a pointer")
 		return
 	}
+	inboundEventReader = ddb.inboundEventReader(inboundEventReader)
+	outboundEventReader = ddb.outboundEventReader(outboundEventReader)
+	o := ddb.readOptions(opts)
 	qi := &dynamodb.QueryInput{
 		TableName:              ddb.TableName,
-		ConsistentRead:         aws.Bool(true),
+		ConsistentRead:         aws.Bool(o.ConsistentRead),
 		KeyConditionExpression: aws.String("#_pk = :_pk"),
 		ExpressionAttributeNames: map[string]string{
 			"#_pk": "_pk",
@@ -441,12 +1024,28 @@ func (ddb *DynamoDBStore) QueryWithHistory(id string, state State, inboundEventR
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":_pk": ddb.attributeValueString(ddb.createPartitionKey(id)),
 		},
+		ReturnConsumedCapacity: ddb.returnConsumedCapacity(),
+	}
+	if o.Projection != nil {
+		qi.ProjectionExpression = createProjectionExpression(o.Projection, qi.ExpressionAttributeNames)
 	}
+	entityKey := ddb.newEntityKeyLoader(ctx, id)
 	var found bool
 	var pagerError error
 	pager := func(qo *dynamodb.QueryOutput, _ bool) (carryOn bool) {
 		for i := 0; i < len(qo.Items); i++ {
-			r := qo.Items[i]
+			pagerError = checkRecordFormat(qo.Items[i])
+			if pagerError != nil {
+				return false
+			}
+			var r map[string]types.AttributeValue
+			r, pagerError = ddb.decryptRecord(ctx, qo.Items[i], entityKey)
+			if pagerError != nil {
+				return false
+			}
+			if o.Projection != nil {
+				r = project(r, o.Projection)
+			}
 			prefix, suffix := ddb.splitSortKey(r)
 			switch prefix {
 			case "STATE":
@@ -504,7 +1103,7 @@ func (ddb *DynamoDBStore) QueryWithHistory(id string, state State, inboundEventR
 		}
 		return true
 	}
-	err = ddb.queryPages(qi, pager)
+	err = ddb.queryPages(ctx, qi, pager)
 	if err != nil {
 		return
 	}
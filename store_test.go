@@ -3,10 +3,12 @@ package stream
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 func TestGetStateNotFoundIntegration(t *testing.T) {
@@ -205,3 +207,232 @@ func TestGetStateIntegration(t *testing.T) {
 		t.Error(diff)
 	}
 }
+
+func TestCapacityReporterIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	// Arrange.
+	name := createLocalTable(t)
+	defer deleteLocalTable(t, name)
+	operations := map[string]int{}
+	reporter := func(namespace, operation string, capacity []types.ConsumedCapacity) {
+		if namespace != "Average" {
+			t.Errorf("expected namespace %q, got %q", "Average", namespace)
+		}
+		operations[operation]++
+	}
+	now := time.Now()
+	clock := ClockFunc(func() time.Time { return now })
+	s, err := NewStore(name, "Average", WithRegion(region), WithClient(testClient), WithCapacityReporter(reporter), WithClock(clock))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	// Act.
+	err = s.Put("id", 0, &AverageState{}, nil, []OutboundEvent{RefundIssued{Amount: 1}})
+	if err != nil {
+		t.Fatalf("unexpected error writing initial state: %v", err)
+	}
+	_, err = s.Get("id", &AverageState{})
+	if err != nil {
+		t.Fatalf("unexpected error getting state: %v", err)
+	}
+	now = now.Add(time.Hour)
+	_, err = s.Republish(context.Background(), time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error republishing: %v", err)
+	}
+
+	// Assert.
+	expected := map[string]int{
+		OperationExecute:   1,
+		OperationGet:       1,
+		OperationScan:      1,
+		OperationRepublish: 1,
+	}
+	if diff := cmp.Diff(expected, operations); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestReadOptions(t *testing.T) {
+	var tests = []struct {
+		name     string
+		store    *DynamoDBStore
+		opts     []ReadOption
+		expected ReadOptions
+	}{
+		{
+			name:     "reads are consistent by default",
+			store:    &DynamoDBStore{},
+			expected: ReadOptions{ConsistentRead: true},
+		},
+		{
+			name:     "the store default can be eventually consistent",
+			store:    &DynamoDBStore{EventuallyConsistentReads: true},
+			expected: ReadOptions{ConsistentRead: false},
+		},
+		{
+			name:     "the store default can be overridden per call",
+			store:    &DynamoDBStore{},
+			opts:     []ReadOption{ConsistentRead(false)},
+			expected: ReadOptions{ConsistentRead: false},
+		},
+		{
+			name:     "a projection can be set per call",
+			store:    &DynamoDBStore{},
+			opts:     []ReadOption{Projection("sum")},
+			expected: ReadOptions{ConsistentRead: true, Projection: []string{"sum"}},
+		},
+		{
+			name:     "an empty projection returns only the library's attributes",
+			store:    &DynamoDBStore{},
+			opts:     []ReadOption{Projection()},
+			expected: ReadOptions{ConsistentRead: true, Projection: []string{}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			actual := tt.store.readOptions(tt.opts)
+			if diff := cmp.Diff(tt.expected, actual); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestPartialUpdateExpression(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient), WithPartialUpdates(true))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	changes := ChangeSet{
+		Set:    map[string]interface{}{"Sum": 3, "Count": 2},
+		Remove: []string{"Value"},
+	}
+
+	// Act.
+	twi, err := s.createStateUpdateTransactWriteItem("id", 2, changes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Assert.
+	if twi.Update == nil {
+		t.Fatal("expected an update, got nil")
+	}
+	expected := "SET #_seq = :_seq_new, #_ts = :_ts, #_date = :_date, #_fmt = :_fmt, #s0 = :s0, #s1 = :s1 REMOVE #r0"
+	if diff := cmp.Diff(expected, *twi.Update.UpdateExpression); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff("#_seq = :_seq", *twi.Update.ConditionExpression); diff != "" {
+		t.Error(diff)
+	}
+	expectedNames := map[string]string{
+		"#_seq":  "_seq",
+		"#_ts":   "_ts",
+		"#_date": "_date",
+		"#_fmt":  "_fmt",
+		"#s0":    "Count",
+		"#s1":    "Sum",
+		"#r0":    "Value",
+	}
+	if diff := cmp.Diff(expectedNames, twi.Update.ExpressionAttributeNames); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestPartialUpdateCannotChangeReservedAttributes(t *testing.T) {
+	s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient), WithPartialUpdates(true))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	_, err = s.createStateUpdateTransactWriteItem("id", 2, ChangeSet{Set: map[string]interface{}{"_seq": 1}})
+	if err == nil {
+		t.Error("expected error setting a reserved attribute, got nil")
+	}
+}
+
+func TestProjection(t *testing.T) {
+	// Arrange.
+	record := map[string]types.AttributeValue{
+		"_pk":   &types.AttributeValueMemberS{Value: "Average/id"},
+		"_sk":   &types.AttributeValueMemberS{Value: "INBOUND/1/0/Add"},
+		"_typ":  &types.AttributeValueMemberS{Value: "Add"},
+		"_hash": &types.AttributeValueMemberS{Value: "hash"},
+		"num":   &types.AttributeValueMemberN{Value: "1"},
+		"other": &types.AttributeValueMemberN{Value: "2"},
+	}
+	names := map[string]string{}
+
+	// Act.
+	expression := createProjectionExpression([]string{"num"}, names)
+	projected := project(record, []string{"num"})
+
+	// Assert.
+	if *expression != "#_pk, #_sk, #_seq, #_typ, #_ts, #_date, #_fmt, #_id, #_ver, #_enc, #_key, #p0" {
+		t.Errorf("unexpected projection expression: %s", *expression)
+	}
+	if names["#p0"] != "num" {
+		t.Errorf("expected the projected attribute to be named, got %v", names)
+	}
+	expected := map[string]types.AttributeValue{
+		"_pk":  record["_pk"],
+		"_sk":  record["_sk"],
+		"_typ": record["_typ"],
+		"num":  record["num"],
+	}
+	if diff := cmp.Diff(expected, projected, cmpopts.IgnoreUnexported(types.AttributeValueMemberS{}, types.AttributeValueMemberN{})); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestQueryProjectionIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	// Arrange.
+	name := createLocalTable(t)
+	defer deleteLocalTable(t, name)
+	s, err := NewStore(name, "Average", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	err = s.Put("id", 0, &AverageState{Sum: 1, Count: 1, Value: 1}, []InboundEvent{Add{Number: 1}}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error writing initial state: %v", err)
+	}
+	var names []string
+	inboundEventReader := NewInboundEventReader().Add(Add{}.EventName(), func(item map[string]types.AttributeValue) (InboundEvent, error) {
+		for name := range item {
+			names = append(names, name)
+		}
+		return Add{}, nil
+	})
+
+	// Act.
+	state := &AverageState{}
+	sequence, inbound, _, err := s.Query("id", state, inboundEventReader, NewOutboundEventReader(), Projection("Count"))
+	if err != nil {
+		t.Fatalf("unexpected error querying: %v", err)
+	}
+
+	// Assert.
+	if sequence != 1 {
+		t.Errorf("expected sequence 1, got %d", sequence)
+	}
+	if len(inbound) != 1 {
+		t.Fatalf("expected 1 inbound event, got %d", len(inbound))
+	}
+	if diff := cmp.Diff(&AverageState{Count: 1}, state); diff != "" {
+		t.Errorf("expected only the projected state attributes to be read: %s", diff)
+	}
+	for _, name := range names {
+		if name == "Number" {
+			t.Error("expected the event payload not to be returned")
+		}
+	}
+}
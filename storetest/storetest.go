@@ -0,0 +1,317 @@
+// Package storetest is a conformance test suite for implementations of stream.Store, so
+// that alternative backends can check that they behave like the DynamoDB store.
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) stream.Store {
+//			return NewMemoryStore()
+//		})
+//	}
+package storetest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/a-h/stream"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+// HistoryQuerier is implemented by stores that keep the history of an entity's state.
+type HistoryQuerier interface {
+	QueryWithHistory(id string, state stream.State, inboundEventReader *stream.InboundEventReader, outboundEventReader *stream.OutboundEventReader, stateHistoryReader *stream.StateHistoryReader, opts ...stream.ReadOption) (sequence int64, inbound []stream.InboundEvent, outbound []stream.OutboundEvent, stateHistory []stream.State, err error)
+}
+
+// Run the conformance tests against stores created by newStore. Each test creates a new
+// store, which must be empty. The query tests are only run if the store implements
+// stream.Querier, and the history tests if it implements HistoryQuerier, in which case
+// the store must keep the history of each state.
+func Run(t *testing.T, newStore func(t *testing.T) stream.Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s stream.Store)
+	}{
+		{name: "Get returns ErrStateNotFound for missing entities", test: testGetNotFound},
+		{name: "Put stores the state", test: testPutAndGet},
+		{name: "Put rejects stale sequences", test: testOptimisticConcurrency},
+		{name: "Prepare doesn't store anything until Execute", test: testPrepareAndExecute},
+		{name: "entities are isolated", test: testIsolation},
+		{name: "Processor creates and updates entities", test: testProcessor},
+		{name: "Query returns events in order", test: testQuery},
+		{name: "QueryWithHistory returns state history in order", test: testHistory},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+// Counter is the state used by the conformance tests.
+type Counter struct {
+	Count int `json:"count" dynamodbav:"count"`
+}
+
+func (c *Counter) Process(event stream.InboundEvent) (outbound []stream.OutboundEvent, err error) {
+	if e, ok := event.(Increment); ok {
+		c.Count += e.By
+		outbound = append(outbound, Incremented{Count: c.Count})
+	}
+	return
+}
+
+// Increment is the inbound event used by the conformance tests.
+type Increment struct {
+	By int `json:"by" dynamodbav:"by"`
+}
+
+func (Increment) EventName() string { return "Increment" }
+func (Increment) IsInbound()        {}
+
+// Incremented is the outbound event used by the conformance tests.
+type Incremented struct {
+	Count int `json:"count" dynamodbav:"count"`
+}
+
+func (Incremented) EventName() string { return "Incremented" }
+func (Incremented) IsOutbound()       {}
+
+func inboundEventReader() *stream.InboundEventReader {
+	return stream.Register[Increment](stream.NewInboundEventReader())
+}
+
+func outboundEventReader() *stream.OutboundEventReader {
+	return stream.RegisterOutbound[Incremented](stream.NewOutboundEventReader())
+}
+
+func stateHistoryReader() *stream.StateHistoryReader {
+	return stream.NewStateHistoryReader(func(item map[string]types.AttributeValue) (stream.State, error) {
+		var s Counter
+		err := attributevalue.UnmarshalMap(item, &s)
+		return &s, err
+	})
+}
+
+// put processes the increments, and stores the state at the sequence.
+func put(t *testing.T, s stream.Store, id string, atSequence int64, state *Counter, increments ...int) error {
+	var inbound []stream.InboundEvent
+	var outbound []stream.OutboundEvent
+	for _, by := range increments {
+		e := Increment{By: by}
+		o, err := state.Process(e)
+		if err != nil {
+			t.Fatalf("failed to process event: %v", err)
+		}
+		inbound = append(inbound, e)
+		outbound = append(outbound, o...)
+	}
+	return s.Put(id, atSequence, state, inbound, outbound)
+}
+
+func testGetNotFound(t *testing.T, s stream.Store) {
+	_, err := s.Get("missing", &Counter{})
+	if !errors.Is(err, stream.ErrStateNotFound) {
+		t.Errorf("expected ErrStateNotFound, got %v", err)
+	}
+}
+
+func testPutAndGet(t *testing.T, s stream.Store) {
+	// Arrange.
+	state := &Counter{}
+	if err := put(t, s, "id", 0, state, 1, 2); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	if err := put(t, s, "id", 1, state, 3); err != nil {
+		t.Fatalf("failed to put at sequence 1: %v", err)
+	}
+
+	// Act.
+	retrieved := &Counter{}
+	sequence, err := s.Get("id", retrieved)
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+
+	// Assert.
+	if sequence != 2 {
+		t.Errorf("expected sequence 2, got %d", sequence)
+	}
+	if diff := cmp.Diff(&Counter{Count: 6}, retrieved); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func testOptimisticConcurrency(t *testing.T, s stream.Store) {
+	if err := put(t, s, "id", 0, &Counter{}, 1); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	if err := put(t, s, "id", 0, &Counter{}, 1); !errors.Is(err, stream.ErrOptimisticConcurrency) {
+		t.Errorf("expected creating an existing entity to return ErrOptimisticConcurrency, got %v", err)
+	}
+	if err := put(t, s, "id", 1, &Counter{Count: 1}, 1); err != nil {
+		t.Fatalf("failed to put at sequence 1: %v", err)
+	}
+	if err := put(t, s, "id", 1, &Counter{Count: 1}, 1); !errors.Is(err, stream.ErrOptimisticConcurrency) {
+		t.Errorf("expected a stale sequence to return ErrOptimisticConcurrency, got %v", err)
+	}
+	if err := put(t, s, "id", 5, &Counter{Count: 2}, 1); !errors.Is(err, stream.ErrOptimisticConcurrency) {
+		t.Errorf("expected a future sequence to return ErrOptimisticConcurrency, got %v", err)
+	}
+	sequence, err := s.Get("id", &Counter{})
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	if sequence != 2 {
+		t.Errorf("expected rejected writes not to change the sequence, got %d", sequence)
+	}
+}
+
+func testPrepareAndExecute(t *testing.T, s stream.Store) {
+	// Arrange.
+	state := &Counter{}
+	outbound, err := state.Process(Increment{By: 1})
+	if err != nil {
+		t.Fatalf("failed to process event: %v", err)
+	}
+
+	// Act.
+	items, err := s.Prepare("id", 0, state, []stream.InboundEvent{Increment{By: 1}}, outbound)
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+	_, getErr := s.Get("id", &Counter{})
+	if err = s.Execute(items); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+
+	// Assert.
+	if !errors.Is(getErr, stream.ErrStateNotFound) {
+		t.Errorf("expected nothing to be stored before Execute, got %v", getErr)
+	}
+	sequence, err := s.Get("id", &Counter{})
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	if sequence != 1 {
+		t.Errorf("expected sequence 1, got %d", sequence)
+	}
+}
+
+func testIsolation(t *testing.T, s stream.Store) {
+	if err := put(t, s, "a", 0, &Counter{}, 1); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	if err := put(t, s, "b", 0, &Counter{}, 2); err != nil {
+		t.Fatalf("expected entities to have their own sequence, got %v", err)
+	}
+	retrieved := &Counter{}
+	if _, err := s.Get("a", retrieved); err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	if diff := cmp.Diff(&Counter{Count: 1}, retrieved); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func testProcessor(t *testing.T, s stream.Store) {
+	// Arrange.
+	p, err := stream.New(s, "id", &Counter{})
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+	if err = p.Process(Increment{By: 1}); err != nil {
+		t.Fatalf("failed to create entity: %v", err)
+	}
+
+	// Act.
+	state := &Counter{}
+	p, err = stream.Load(s, "id", state)
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	if err = p.Process(Increment{By: 2}); err != nil {
+		t.Fatalf("failed to update entity: %v", err)
+	}
+
+	// Assert.
+	if p.Sequence() != 2 {
+		t.Errorf("expected sequence 2, got %d", p.Sequence())
+	}
+	retrieved := &Counter{}
+	if _, err = s.Get("id", retrieved); err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	if diff := cmp.Diff(&Counter{Count: 3}, retrieved); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func testQuery(t *testing.T, s stream.Store) {
+	q, ok := s.(stream.Querier)
+	if !ok {
+		t.Skip("store does not implement stream.Querier")
+	}
+	// Arrange.
+	state := &Counter{}
+	if err := put(t, s, "id", 0, state, 1, 2); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	if err := put(t, s, "id", 1, state, 3); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+
+	// Act.
+	retrieved := &Counter{}
+	sequence, inbound, outbound, err := q.Query("id", retrieved, inboundEventReader(), outboundEventReader())
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+
+	// Assert.
+	if sequence != 2 {
+		t.Errorf("expected sequence 2, got %d", sequence)
+	}
+	if diff := cmp.Diff(&Counter{Count: 6}, retrieved); diff != "" {
+		t.Errorf("unexpected state: %s", diff)
+	}
+	expectedInbound := []stream.InboundEvent{Increment{By: 1}, Increment{By: 2}, Increment{By: 3}}
+	if diff := cmp.Diff(expectedInbound, inbound); diff != "" {
+		t.Errorf("unexpected inbound events: %s", diff)
+	}
+	expectedOutbound := []stream.OutboundEvent{Incremented{Count: 1}, Incremented{Count: 3}, Incremented{Count: 6}}
+	if diff := cmp.Diff(expectedOutbound, outbound); diff != "" {
+		t.Errorf("unexpected outbound events: %s", diff)
+	}
+	if _, _, _, err = q.Query("missing", &Counter{}, inboundEventReader(), outboundEventReader()); !errors.Is(err, stream.ErrStateNotFound) {
+		t.Errorf("expected querying a missing entity to return ErrStateNotFound, got %v", err)
+	}
+}
+
+func testHistory(t *testing.T, s stream.Store) {
+	q, ok := s.(HistoryQuerier)
+	if !ok {
+		t.Skip("store does not implement storetest.HistoryQuerier")
+	}
+	// Arrange.
+	state := &Counter{}
+	if err := put(t, s, "id", 0, state, 1); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	if err := put(t, s, "id", 1, state, 2); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+
+	// Act.
+	_, _, _, history, err := q.QueryWithHistory("id", &Counter{}, inboundEventReader(), outboundEventReader(), stateHistoryReader())
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+
+	// Assert.
+	expected := []stream.State{&Counter{Count: 1}, &Counter{Count: 3}}
+	if diff := cmp.Diff(expected, history); diff != "" {
+		t.Error(diff)
+	}
+}
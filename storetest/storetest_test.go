@@ -0,0 +1,141 @@
+package storetest
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/a-h/stream"
+	"github.com/a-h/stream/streamtest"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// memoryStore is a minimal in-memory store, used to check that the suite can run against
+// stores other than DynamoDB.
+type memoryStore struct {
+	m         sync.Mutex
+	states    map[string]map[string]types.AttributeValue
+	sequences map[string]int64
+	events    map[string][]map[string]types.AttributeValue
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		states:    make(map[string]map[string]types.AttributeValue),
+		sequences: make(map[string]int64),
+		events:    make(map[string][]map[string]types.AttributeValue),
+	}
+}
+
+func (s *memoryStore) Get(id string, state stream.State) (sequence int64, err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	item, ok := s.states[id]
+	if !ok {
+		return 0, stream.ErrStateNotFound
+	}
+	return s.sequences[id], attributevalue.UnmarshalMap(item, state)
+}
+
+func (s *memoryStore) Put(id string, atSequence int64, state stream.State, inbound []stream.InboundEvent, outbound []stream.OutboundEvent) error {
+	items, err := s.Prepare(id, atSequence, state, inbound, outbound)
+	if err != nil {
+		return err
+	}
+	return s.Execute(items)
+}
+
+// Prepare returns the state record, followed by the event records.
+func (s *memoryStore) Prepare(id string, atSequence int64, state stream.State, inbound []stream.InboundEvent, outbound []stream.OutboundEvent) (items []types.TransactWriteItem, err error) {
+	add := func(v interface{}, typ string) error {
+		item, err := attributevalue.MarshalMap(v)
+		if err != nil {
+			return err
+		}
+		item["_pk"] = &types.AttributeValueMemberS{Value: id}
+		item["_seq"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(atSequence+1, 10)}
+		item["_typ"] = &types.AttributeValueMemberS{Value: typ}
+		items = append(items, types.TransactWriteItem{Put: &types.Put{Item: item}})
+		return nil
+	}
+	if err = add(state, "STATE"); err != nil {
+		return
+	}
+	for _, e := range inbound {
+		if err = add(e, e.EventName()); err != nil {
+			return
+		}
+	}
+	for _, e := range outbound {
+		if err = add(e, e.EventName()); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *memoryStore) Execute(items []types.TransactWriteItem) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	state := items[0].Put.Item
+	id := state["_pk"].(*types.AttributeValueMemberS).Value
+	sequence, err := strconv.ParseInt(state["_seq"].(*types.AttributeValueMemberN).Value, 10, 64)
+	if err != nil {
+		return err
+	}
+	if s.sequences[id] != sequence-1 {
+		return stream.ErrOptimisticConcurrency
+	}
+	s.states[id] = state
+	s.sequences[id] = sequence
+	for _, item := range items[1:] {
+		s.events[id] = append(s.events[id], item.Put.Item)
+	}
+	return nil
+}
+
+func (s *memoryStore) Query(id string, state stream.State, inboundEventReader *stream.InboundEventReader, outboundEventReader *stream.OutboundEventReader, opts ...stream.ReadOption) (sequence int64, inbound []stream.InboundEvent, outbound []stream.OutboundEvent, err error) {
+	sequence, err = s.Get(id, state)
+	if err != nil {
+		return
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	for _, item := range s.events[id] {
+		typ := item["_typ"].(*types.AttributeValueMemberS).Value
+		if e, ok, readErr := inboundEventReader.Read(typ, item); ok || readErr != nil {
+			if readErr != nil {
+				return sequence, nil, nil, readErr
+			}
+			inbound = append(inbound, e)
+			continue
+		}
+		e, _, readErr := outboundEventReader.Read(typ, item)
+		if readErr != nil {
+			return sequence, nil, nil, readErr
+		}
+		outbound = append(outbound, e)
+	}
+	return
+}
+
+func TestMemoryStore(t *testing.T) {
+	Run(t, func(t *testing.T) stream.Store {
+		return newMemoryStore()
+	})
+}
+
+func TestDynamoDBStoreIntegration(t *testing.T) {
+	local := streamtest.Default(t)
+	name := local.NewTable(t)
+	Run(t, func(t *testing.T) stream.Store {
+		// Use a namespace per test, so that each store is empty.
+		s, err := stream.NewStore(name, uuid.New().String(), stream.WithClient(local.Client), stream.WithPersistStateHistory(true))
+		if err != nil {
+			t.Fatalf("failed to create store: %v", err)
+		}
+		return s
+	})
+}
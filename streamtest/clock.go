@@ -0,0 +1,65 @@
+package streamtest
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Clock is a stream.Clock that only changes when it's set or advanced, so that tests can
+// assert exact timestamps.
+//
+//	clock := streamtest.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+//	store := streamtest.NewStore(t, "Order", stream.WithClock(clock), stream.WithIDGenerator(streamtest.NewIDs("event")))
+type Clock struct {
+	m   sync.Mutex
+	now time.Time
+}
+
+// NewClock creates a clock set to now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the clock's time.
+func (c *Clock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.now
+}
+
+// Set the clock's time.
+func (c *Clock) Set(now time.Time) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.now = now
+}
+
+// Advance the clock by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// IDs is a stream.IDGenerator that returns the prefix followed by a counter, e.g.
+// "event-1", "event-2".
+type IDs struct {
+	Prefix string
+
+	m sync.Mutex
+	n int
+}
+
+// NewIDs creates a generator of IDs with the prefix.
+func NewIDs(prefix string) *IDs {
+	return &IDs{Prefix: prefix}
+}
+
+// NewID returns the next ID.
+func (g *IDs) NewID() string {
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.n++
+	return fmt.Sprintf("%s-%d", g.Prefix, g.n)
+}
@@ -0,0 +1,40 @@
+package streamtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestClock(t *testing.T) {
+	// Arrange.
+	start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewClock(start)
+
+	// Act.
+	before := clock.Now()
+	clock.Advance(time.Minute)
+	after := clock.Now()
+
+	// Assert.
+	if !before.Equal(start) {
+		t.Errorf("expected %v, got %v", start, before)
+	}
+	if !after.Equal(start.Add(time.Minute)) {
+		t.Errorf("expected %v, got %v", start.Add(time.Minute), after)
+	}
+}
+
+func TestIDs(t *testing.T) {
+	// Arrange.
+	ids := NewIDs("event")
+
+	// Act.
+	actual := []string{ids.NewID(), ids.NewID()}
+
+	// Assert.
+	if diff := cmp.Diff([]string{"event-1", "event-2"}, actual); diff != "" {
+		t.Error(diff)
+	}
+}
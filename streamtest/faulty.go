@@ -0,0 +1,188 @@
+package streamtest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/a-h/stream"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Store operations that faults can be injected into.
+const (
+	OpGet     = "Get"
+	OpPut     = "Put"
+	OpPrepare = "Prepare"
+	OpExecute = "Execute"
+)
+
+// ErrThrottled is returned by throttled operations. It's the error DynamoDB returns when a
+// table's capacity is exceeded, so it can be checked with errors.As and smithy.APIError.
+var ErrThrottled error = &types.ProvisionedThroughputExceededException{
+	Message: aws.String("streamtest: throttled"),
+}
+
+// Fault is injected into calls to a FaultyStore.
+type Fault struct {
+	// Op is the operation to fail, e.g. OpExecute, which is used by stream.Processor.
+	Op string
+	// Calls are the 1-based numbers of the calls to Op that fail, e.g. 1 and 2 to fail the
+	// first two attempts. If empty, every call fails.
+	Calls []int
+	// Latency is added before the call.
+	Latency time.Duration
+	// Err is returned by the call. If nil, only the latency is added.
+	Err error
+	// Partial calls the underlying store before returning Err, e.g. to simulate a write
+	// that succeeded but whose response was lost.
+	Partial bool
+}
+
+func (f Fault) matches(op string, call int) bool {
+	if f.Op != op {
+		return false
+	}
+	if len(f.Calls) == 0 {
+		return true
+	}
+	for _, c := range f.Calls {
+		if c == call {
+			return true
+		}
+	}
+	return false
+}
+
+// Conflict makes the calls to op return stream.ErrOptimisticConcurrency, as if another
+// process had updated the state.
+func Conflict(op string, calls ...int) Fault {
+	return Fault{Op: op, Calls: calls, Err: stream.ErrOptimisticConcurrency}
+}
+
+// Throttle makes the calls to op return ErrThrottled.
+func Throttle(op string, calls ...int) Fault {
+	return Fault{Op: op, Calls: calls, Err: ErrThrottled}
+}
+
+// Slow adds latency to the calls to op.
+func Slow(op string, latency time.Duration, calls ...int) Fault {
+	return Fault{Op: op, Calls: calls, Latency: latency}
+}
+
+// LostResponse makes the calls to op succeed, but return err, e.g. a timeout. Use it to
+// test that retried writes are idempotent.
+func LostResponse(op string, err error, calls ...int) Fault {
+	return Fault{Op: op, Calls: calls, Err: err, Partial: true}
+}
+
+// FaultyStore wraps a store and injects faults into its calls on a schedule, to test
+// retry and idempotency logic deterministically.
+//
+//	store := streamtest.NewFaultyStore(inner, streamtest.Conflict(streamtest.OpExecute, 1, 2))
+//	bus := stream.NewCommandBus()
+//	stream.RegisterCommand(bus, store, NewOrder, OrderID)
+//	_, err := bus.Dispatch(ctx, PlaceOrder{}) // Succeeds on the third attempt.
+//
+// Only the methods of stream.Store are wrapped.
+type FaultyStore struct {
+	Store  stream.Store
+	Faults []Fault
+	// Sleep adds latency. Defaults to time.Sleep, replace it to use a fake clock.
+	Sleep func(d time.Duration)
+
+	m     sync.Mutex
+	calls map[string]int
+}
+
+// NewFaultyStore creates a FaultyStore that wraps the store.
+func NewFaultyStore(store stream.Store, faults ...Fault) *FaultyStore {
+	return &FaultyStore{
+		Store:  store,
+		Faults: faults,
+		Sleep:  time.Sleep,
+		calls:  make(map[string]int),
+	}
+}
+
+// Calls returns the number of calls made to op, including calls that failed.
+func (s *FaultyStore) Calls(op string) int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.calls[op]
+}
+
+// inject counts the call to op, and applies the latency of matching faults. If a fault
+// returns an error, it's returned with whether the underlying store should still be called.
+func (s *FaultyStore) inject(op string) (partial bool, err error) {
+	s.m.Lock()
+	s.calls[op]++
+	call := s.calls[op]
+	s.m.Unlock()
+	for _, f := range s.Faults {
+		if !f.matches(op, call) {
+			continue
+		}
+		if f.Latency > 0 {
+			s.Sleep(f.Latency)
+		}
+		if f.Err != nil && err == nil {
+			err, partial = f.Err, f.Partial
+		}
+	}
+	return
+}
+
+func (s *FaultyStore) Get(id string, state stream.State) (sequence int64, err error) {
+	return s.GetWithOptions(id, state)
+}
+
+func (s *FaultyStore) GetWithOptions(id string, state stream.State, opts ...stream.ReadOption) (sequence int64, err error) {
+	partial, injected := s.inject(OpGet)
+	if injected != nil && !partial {
+		return 0, injected
+	}
+	sequence, err = stream.GetWithOptions(s.Store, id, state, opts...)
+	if err == nil && injected != nil {
+		err = injected
+	}
+	return
+}
+
+func (s *FaultyStore) Put(id string, atSequence int64, state stream.State, inbound []stream.InboundEvent, outbound []stream.OutboundEvent) (err error) {
+	partial, injected := s.inject(OpPut)
+	if injected != nil && !partial {
+		return injected
+	}
+	if err = s.Store.Put(id, atSequence, state, inbound, outbound); err != nil {
+		return
+	}
+	return injected
+}
+
+func (s *FaultyStore) Prepare(id string, atSequence int64, state stream.State, inbound []stream.InboundEvent, outbound []stream.OutboundEvent) (items []types.TransactWriteItem, err error) {
+	return s.PrepareWithOptions(id, atSequence, state, inbound, outbound)
+}
+
+func (s *FaultyStore) PrepareWithOptions(id string, atSequence int64, state stream.State, inbound []stream.InboundEvent, outbound []stream.OutboundEvent, opts ...stream.WriteOption) (items []types.TransactWriteItem, err error) {
+	partial, injected := s.inject(OpPrepare)
+	if injected != nil && !partial {
+		return nil, injected
+	}
+	items, err = stream.PrepareWithOptions(s.Store, id, atSequence, state, inbound, outbound, opts...)
+	if err == nil && injected != nil {
+		err = injected
+	}
+	return
+}
+
+func (s *FaultyStore) Execute(items []types.TransactWriteItem) (err error) {
+	partial, injected := s.inject(OpExecute)
+	if injected != nil && !partial {
+		return injected
+	}
+	if err = s.Store.Execute(items); err != nil {
+		return
+	}
+	return injected
+}
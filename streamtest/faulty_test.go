@@ -0,0 +1,114 @@
+package streamtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/a-h/stream"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/google/go-cmp/cmp"
+)
+
+// writeCounter is a store that counts writes, and has no entities.
+type writeCounter struct {
+	puts     int
+	executes int
+}
+
+func (s *writeCounter) Get(id string, state stream.State) (sequence int64, err error) {
+	return 0, stream.ErrStateNotFound
+}
+
+func (s *writeCounter) Put(id string, atSequence int64, state stream.State, inbound []stream.InboundEvent, outbound []stream.OutboundEvent) error {
+	s.puts++
+	return nil
+}
+
+func (s *writeCounter) Prepare(id string, atSequence int64, state stream.State, inbound []stream.InboundEvent, outbound []stream.OutboundEvent) (items []types.TransactWriteItem, err error) {
+	return
+}
+
+func (s *writeCounter) Execute(items []types.TransactWriteItem) error {
+	s.executes++
+	return nil
+}
+
+func TestFaultyStoreConflictsAreRetried(t *testing.T) {
+	// Arrange.
+	inner := &writeCounter{}
+	store := NewFaultyStore(inner, Conflict(OpExecute, 1, 2))
+	bus := stream.NewCommandBus()
+	stream.RegisterCommand(bus, store, func(id string) stream.State { return &counter{} },
+		func(cmd increment) (string, error) { return "id", nil })
+
+	// Act.
+	_, err := bus.Dispatch(context.Background(), increment{})
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls := store.Calls(OpExecute); calls != 3 {
+		t.Errorf("expected 3 calls to Execute, got %d", calls)
+	}
+	if inner.executes != 1 {
+		t.Errorf("expected the underlying store to be written once, got %d", inner.executes)
+	}
+}
+
+func TestFaultyStoreThrottle(t *testing.T) {
+	// Arrange.
+	store := NewFaultyStore(&writeCounter{}, Throttle(OpGet))
+
+	// Act.
+	_, err := store.Get("id", &counter{})
+
+	// Assert.
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an API error, got %v", err)
+	}
+	if apiErr.ErrorCode() != "ProvisionedThroughputExceededException" {
+		t.Errorf("unexpected error code %q", apiErr.ErrorCode())
+	}
+}
+
+func TestFaultyStoreLatency(t *testing.T) {
+	// Arrange.
+	var slept []time.Duration
+	store := NewFaultyStore(&writeCounter{}, Slow(OpPut, time.Second, 2))
+	store.Sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	// Act.
+	for i := 0; i < 3; i++ {
+		if err := store.Put("id", 0, &counter{}, nil, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// Assert.
+	if diff := cmp.Diff([]time.Duration{time.Second}, slept); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestFaultyStoreLostResponse(t *testing.T) {
+	// Arrange.
+	errTimeout := errors.New("timeout")
+	inner := &writeCounter{}
+	store := NewFaultyStore(inner, LostResponse(OpPut, errTimeout, 1))
+
+	// Act.
+	err := store.Put("id", 0, &counter{}, nil, nil)
+
+	// Assert.
+	if !errors.Is(err, errTimeout) {
+		t.Errorf("expected the injected error, got %v", err)
+	}
+	if inner.puts != 1 {
+		t.Errorf("expected the write to reach the underlying store, got %d writes", inner.puts)
+	}
+}
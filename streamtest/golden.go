@@ -0,0 +1,190 @@
+package streamtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/a-h/stream"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// GoldenTime is the time stored in golden records, so that they don't change between runs.
+var GoldenTime = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Golden checks that the records the store writes for the state and events match the
+// golden file testdata/<name>.golden.json, and that the records in the file are read back
+// into the same state and events by the store's registry. A failure means that stored
+// data is written or read differently, e.g. because an attribute name, codec tag or time
+// codec changed, so records already in the table may no longer be readable.
+//
+// Set UPDATE_GOLDEN=1 to write the golden files, and check them in. The store's clock and
+// event IDs are fixed while the records are created. Encrypted stores aren't supported,
+// because the ciphertext changes every time.
+//
+//	func TestOrderRecords(t *testing.T) {
+//		store, _ := stream.NewStore("table", "Order")
+//		streamtest.Golden(t, store, "order_placed", &Order{ID: "1"},
+//			[]stream.InboundEvent{PlaceOrder{ID: "1"}}, []stream.OutboundEvent{OrderPlaced{ID: "1"}})
+//	}
+func Golden(t TB, store *stream.DynamoDBStore, name string, state stream.State, inbound []stream.InboundEvent, outbound []stream.OutboundEvent) {
+	t.Helper()
+	items, err := goldenItems(store, state, inbound, outbound)
+	if err != nil {
+		t.Fatalf("golden %s: failed to create records: %v", name, err)
+	}
+	actual, err := marshalGolden(items)
+	if err != nil {
+		t.Fatalf("golden %s: failed to marshal records: %v", name, err)
+	}
+	fileName := filepath.Join("testdata", name+".golden.json")
+	if update, _ := strconv.ParseBool(os.Getenv("UPDATE_GOLDEN")); update {
+		if err = os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatalf("golden %s: failed to create testdata directory: %v", name, err)
+		}
+		if err = os.WriteFile(fileName, actual, 0644); err != nil {
+			t.Fatalf("golden %s: failed to write golden file: %v", name, err)
+		}
+	}
+	expected, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("golden %s: failed to read golden file, run with UPDATE_GOLDEN=1 to create it: %v", name, err)
+	}
+	if diff := cmp.Diff(string(expected), string(actual)); diff != "" {
+		t.Errorf("golden %s: stored records have changed (-golden +actual):\n%s", name, diff)
+	}
+
+	// Replay the golden records, rather than the new ones, to check that data already
+	// stored can still be read.
+	golden, err := ReadGolden(fileName)
+	if err != nil {
+		t.Fatalf("golden %s: %v", name, err)
+	}
+	replayedState := reflect.New(reflect.TypeOf(state).Elem()).Interface().(stream.State)
+	replayedInbound, replayedOutbound, err := ReplayGolden(store, golden, replayedState)
+	if err != nil {
+		t.Fatalf("golden %s: failed to read records: %v", name, err)
+	}
+	opts := []cmp.Option{cmp.Exporter(func(reflect.Type) bool { return true }), cmpopts.EquateEmpty()}
+	if diff := cmp.Diff(state, replayedState, opts...); diff != "" {
+		t.Errorf("golden %s: unexpected state read from golden file (-want +got):\n%s", name, diff)
+	}
+	if diff := cmp.Diff(inbound, replayedInbound, opts...); diff != "" {
+		t.Errorf("golden %s: unexpected inbound events read from golden file (-want +got):\n%s", name, diff)
+	}
+	if diff := cmp.Diff(outbound, replayedOutbound, opts...); diff != "" {
+		t.Errorf("golden %s: unexpected outbound events read from golden file (-want +got):\n%s", name, diff)
+	}
+}
+
+// goldenItems returns the items written by the store for a new entity, with a fixed clock
+// and event IDs.
+func goldenItems(store *stream.DynamoDBStore, state stream.State, inbound []stream.InboundEvent, outbound []stream.OutboundEvent) (items []map[string]types.AttributeValue, err error) {
+	now, newID := store.Now, store.NewID
+	defer func() {
+		store.Now, store.NewID = now, newID
+	}()
+	store.Now = NewClock(GoldenTime).Now
+	store.NewID = NewIDs("golden").NewID
+	twis, err := store.Prepare("golden", 0, state, inbound, outbound)
+	if err != nil {
+		return
+	}
+	for _, twi := range twis {
+		if twi.Put != nil {
+			items = append(items, twi.Put.Item)
+		}
+	}
+	return
+}
+
+// marshalGolden encodes the items as an indented JSON array of DynamoDB JSON items, so
+// that changes produce a readable diff.
+func marshalGolden(items []map[string]types.AttributeValue) ([]byte, error) {
+	raw := make([]json.RawMessage, len(items))
+	for i, item := range items {
+		data, err := stream.MarshalItemJSON(item)
+		if err != nil {
+			return nil, err
+		}
+		raw[i] = data
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err = json.Indent(&buf, data, "", "  "); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// ReadGolden reads the records in a golden file written by Golden.
+func ReadGolden(fileName string) (items []map[string]types.AttributeValue, err error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return
+	}
+	var raw []json.RawMessage
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid golden file %s: %w", fileName, err)
+	}
+	items = make([]map[string]types.AttributeValue, len(raw))
+	for i, r := range raw {
+		if items[i], err = stream.UnmarshalItemJSON(r); err != nil {
+			return nil, fmt.Errorf("invalid golden file %s: record %d: %w", fileName, i, err)
+		}
+	}
+	return
+}
+
+// ReplayGolden reads the records into the state, and the events with the store's registry,
+// in the same way as DynamoDBStore.Query.
+func ReplayGolden(store *stream.DynamoDBStore, items []map[string]types.AttributeValue, state stream.State) (inbound []stream.InboundEvent, outbound []stream.OutboundEvent, err error) {
+	registry := store.Registry
+	if registry == nil {
+		registry = stream.Events
+	}
+	for i, item := range items {
+		sk, _ := item["_sk"].(*types.AttributeValueMemberS)
+		typ, _ := item["_typ"].(*types.AttributeValueMemberS)
+		if sk == nil || typ == nil {
+			return nil, nil, fmt.Errorf("record %d: missing _sk or _typ", i)
+		}
+		switch {
+		case sk.Value == "STATE":
+			if err = store.Unmarshal(item, state); err != nil {
+				return nil, nil, fmt.Errorf("state: %w", err)
+			}
+		case strings.HasPrefix(sk.Value, "INBOUND/"):
+			e, ok, err := registry.Inbound.Read(typ.Value, item)
+			if err != nil {
+				return nil, nil, fmt.Errorf("inbound event %q: %w", typ.Value, err)
+			}
+			if !ok {
+				return nil, nil, fmt.Errorf("inbound event: no reader for %q", typ.Value)
+			}
+			inbound = append(inbound, e)
+		case strings.HasPrefix(sk.Value, "OUTBOUND/"):
+			e, ok, err := registry.Outbound.Read(typ.Value, item)
+			if err != nil {
+				return nil, nil, fmt.Errorf("outbound event %q: %w", typ.Value, err)
+			}
+			if !ok {
+				return nil, nil, fmt.Errorf("outbound event: no reader for %q", typ.Value)
+			}
+			outbound = append(outbound, e)
+		}
+	}
+	return
+}
@@ -0,0 +1,57 @@
+package streamtest
+
+import (
+	"testing"
+
+	"github.com/a-h/stream"
+)
+
+type incremented struct {
+	Count int `json:"count" dynamodbav:"count"`
+}
+
+func (incremented) EventName() string { return "Incremented" }
+func (incremented) IsOutbound()       {}
+
+func newGoldenStore(t *testing.T, opts ...stream.StoreOption) *stream.DynamoDBStore {
+	registry := stream.NewRegistry()
+	stream.Register[increment](registry.Inbound)
+	stream.RegisterOutbound[incremented](registry.Outbound)
+	opts = append(opts, stream.WithRegion(Region), stream.WithRegistry(registry))
+	store, err := stream.NewStore("table", "Counter", opts...)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	return store
+}
+
+func TestGolden(t *testing.T) {
+	// Arrange.
+	store := newGoldenStore(t)
+
+	// Act.
+	Golden(t, store, "counter", &counter{Count: 1},
+		[]stream.InboundEvent{increment{}},
+		[]stream.OutboundEvent{incremented{Count: 1}})
+
+	// Assert.
+	if store.Now == nil || store.NewID == nil {
+		t.Error("expected the store's clock and IDs to be restored")
+	}
+}
+
+func TestGoldenDetectsCodecChanges(t *testing.T) {
+	// Arrange.
+	store := newGoldenStore(t, stream.WithCodecTag("json"))
+	r := &recorder{}
+
+	// Act.
+	Golden(r, store, "counter", &counter{Count: 1},
+		[]stream.InboundEvent{increment{}},
+		[]stream.OutboundEvent{incremented{Count: 1}})
+
+	// Assert.
+	if len(r.errors) == 0 {
+		t.Error("expected the golden records to differ")
+	}
+}
@@ -0,0 +1,157 @@
+package streamtest
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/a-h/stream"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// TB is the subset of testing.TB used by Scenario, so that failures can be tested.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...any)
+	Fatalf(format string, args ...any)
+}
+
+// Scenario tests a state's Process method without a store, in Given/When/Then style.
+//
+//	streamtest.NewScenario(t, &SlotMachine{}).
+//		Given(InsertCoin{}, InsertCoin{}).
+//		When(PullHandle{}).
+//		ThenState(&SlotMachine{Balance: 1, Games: 1}).
+//		ThenEvents(GameLost{})
+type Scenario struct {
+	t     TB
+	state stream.State
+	// opts are passed to cmp.Diff when comparing states, events and results.
+	opts []cmp.Option
+
+	whenCalled  bool
+	outbound    []stream.OutboundEvent
+	results     []any
+	err         error
+	errReported bool
+}
+
+// NewScenario creates a scenario that processes events with the state. States are
+// compared including unexported fields. Use CompareWith to ignore fields.
+func NewScenario(t TB, state stream.State) *Scenario {
+	return &Scenario{
+		t:     t,
+		state: state,
+		opts: []cmp.Option{
+			cmp.Exporter(func(reflect.Type) bool { return true }),
+			cmpopts.EquateEmpty(),
+		},
+	}
+}
+
+// CompareWith adds cmp options used to compare states, events and results, e.g.
+// cmpopts.IgnoreFields for timestamps.
+func (s *Scenario) CompareWith(opts ...cmp.Option) *Scenario {
+	s.opts = append(s.opts, opts...)
+	return s
+}
+
+// Given processes the events that happened before the scenario. The test fails if the
+// state returns an error.
+func (s *Scenario) Given(events ...stream.InboundEvent) *Scenario {
+	s.t.Helper()
+	for i, e := range events {
+		if _, err := s.state.Process(e); err != nil {
+			s.t.Fatalf("given event %d (%s): unexpected error: %v", i, e.EventName(), err)
+		}
+	}
+	return s
+}
+
+// When processes the event or command under test. Its outbound events, result and error
+// are checked by ThenEvents, ThenResult and ThenError.
+func (s *Scenario) When(event stream.InboundEvent) *Scenario {
+	outbound, err := s.state.Process(event)
+	s.outbound, s.results = stream.SplitResults(outbound)
+	s.err = err
+	s.whenCalled = true
+	return s
+}
+
+// ThenState checks the state after the events have been processed.
+func (s *Scenario) ThenState(expected stream.State) *Scenario {
+	s.t.Helper()
+	s.checkNoError()
+	if diff := cmp.Diff(expected, s.state, s.opts...); diff != "" {
+		s.t.Errorf("unexpected state (-want +got):\n%s", diff)
+	}
+	return s
+}
+
+// ThenEvents checks the outbound events returned by When, excluding command results.
+// Call it without arguments to check that no events were returned.
+func (s *Scenario) ThenEvents(expected ...stream.OutboundEvent) *Scenario {
+	s.t.Helper()
+	if !s.checkWhen("ThenEvents") {
+		return s
+	}
+	s.checkNoError()
+	if diff := cmp.Diff(expected, s.outbound, s.opts...); diff != "" {
+		s.t.Errorf("unexpected outbound events (-want +got):\n%s", diff)
+	}
+	return s
+}
+
+// ThenResult checks the command result returned by When with stream.Result. If more than
+// one result was returned, the last is used, as in stream.ProcessCommand.
+func (s *Scenario) ThenResult(expected any) *Scenario {
+	s.t.Helper()
+	if !s.checkWhen("ThenResult") {
+		return s
+	}
+	s.checkNoError()
+	if len(s.results) == 0 {
+		s.t.Errorf("expected result %#v, but no result was returned", expected)
+		return s
+	}
+	if diff := cmp.Diff(expected, s.results[len(s.results)-1], s.opts...); diff != "" {
+		s.t.Errorf("unexpected result (-want +got):\n%s", diff)
+	}
+	return s
+}
+
+// ThenError checks that When returned an error that matches expected using errors.Is.
+// Call it before ThenState to check that a rejected event left the state unchanged.
+func (s *Scenario) ThenError(expected error) *Scenario {
+	s.t.Helper()
+	if !s.checkWhen("ThenError") {
+		return s
+	}
+	s.errReported = true
+	if s.err == nil {
+		s.t.Errorf("expected error %q, got nil", expected)
+		return s
+	}
+	if !errors.Is(s.err, expected) {
+		s.t.Errorf("expected error %q, got %q", expected, s.err)
+	}
+	return s
+}
+
+func (s *Scenario) checkWhen(method string) bool {
+	s.t.Helper()
+	if !s.whenCalled {
+		s.t.Errorf("%s must be called after When", method)
+	}
+	return s.whenCalled
+}
+
+// checkNoError fails the test if When returned an unexpected error, since the state and
+// events are unlikely to match. It's reported once, even if several checks are made.
+func (s *Scenario) checkNoError() {
+	s.t.Helper()
+	if s.err != nil && !s.errReported {
+		s.t.Errorf("unexpected error: %v", s.err)
+		s.errReported = true
+	}
+}
@@ -0,0 +1,166 @@
+package streamtest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/a-h/stream"
+)
+
+var errInsufficientFunds = errors.New("insufficient funds")
+
+type deposit struct{ Amount int }
+
+func (deposit) EventName() string              { return "Deposit" }
+func (deposit) IsInbound()                     {}
+func (deposit) IsCommand(result depositResult) {}
+
+type withdraw struct{ Amount int }
+
+func (withdraw) EventName() string { return "Withdraw" }
+func (withdraw) IsInbound()        {}
+
+type depositResult struct{ Balance int }
+
+type deposited struct{ Amount int }
+
+func (deposited) EventName() string { return "Deposited" }
+func (deposited) IsOutbound()       {}
+
+type account struct {
+	Balance int
+	// deposits is unexported to check that states are compared in full.
+	deposits int
+}
+
+func (a *account) Process(event stream.InboundEvent) (outbound []stream.OutboundEvent, err error) {
+	switch e := event.(type) {
+	case deposit:
+		a.Balance += e.Amount
+		a.deposits++
+		outbound = append(outbound, deposited{Amount: e.Amount}, stream.Result(depositResult{Balance: a.Balance}))
+	case withdraw:
+		if e.Amount > a.Balance {
+			return nil, fmt.Errorf("withdraw %d: %w", e.Amount, errInsufficientFunds)
+		}
+		a.Balance -= e.Amount
+	}
+	return
+}
+
+// recorder is a TB that records failures instead of failing the test.
+type recorder struct {
+	errors []string
+	fatal  bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+	r.fatal = true
+}
+
+func TestScenario(t *testing.T) {
+	tests := []struct {
+		name           string
+		run            func(t TB)
+		expectedErrors int
+	}{
+		{
+			name: "matching state, events and result pass",
+			run: func(t TB) {
+				NewScenario(t, &account{}).
+					Given(deposit{Amount: 5}).
+					When(deposit{Amount: 10}).
+					ThenState(&account{Balance: 15, deposits: 2}).
+					ThenEvents(deposited{Amount: 10}).
+					ThenResult(depositResult{Balance: 15})
+			},
+		},
+		{
+			name: "a different state fails",
+			run: func(t TB) {
+				NewScenario(t, &account{}).
+					When(deposit{Amount: 10}).
+					ThenState(&account{Balance: 10, deposits: 2})
+			},
+			expectedErrors: 1,
+		},
+		{
+			name: "different events fail",
+			run: func(t TB) {
+				NewScenario(t, &account{}).
+					When(deposit{Amount: 10}).
+					ThenEvents()
+			},
+			expectedErrors: 1,
+		},
+		{
+			name: "expected errors pass, and the state can be checked afterwards",
+			run: func(t TB) {
+				NewScenario(t, &account{}).
+					Given(deposit{Amount: 5}).
+					When(withdraw{Amount: 10}).
+					ThenError(errInsufficientFunds).
+					ThenState(&account{Balance: 5, deposits: 1}).
+					ThenEvents()
+			},
+		},
+		{
+			name: "unexpected errors are reported once",
+			run: func(t TB) {
+				NewScenario(t, &account{}).
+					When(withdraw{Amount: 10}).
+					ThenState(&account{}).
+					ThenEvents()
+			},
+			expectedErrors: 1,
+		},
+		{
+			name: "a missing error fails",
+			run: func(t TB) {
+				NewScenario(t, &account{}).
+					When(deposit{Amount: 10}).
+					ThenError(errInsufficientFunds)
+			},
+			expectedErrors: 1,
+		},
+		{
+			name: "checking events before When fails",
+			run: func(t TB) {
+				NewScenario(t, &account{}).
+					ThenEvents()
+			},
+			expectedErrors: 1,
+		},
+		{
+			name: "errors in the given events are fatal",
+			run: func(t TB) {
+				NewScenario(t, &account{}).
+					Given(withdraw{Amount: 10})
+			},
+			expectedErrors: 1,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			r := &recorder{}
+
+			// Act.
+			test.run(r)
+
+			// Assert.
+			if len(r.errors) != test.expectedErrors {
+				t.Errorf("expected %d errors, got %d: %v", test.expectedErrors, len(r.errors), r.errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+// Package streamtest runs integration tests against DynamoDB Local. It attaches to the
+// instance at DYNAMODB_ENDPOINT, or http://localhost:8000, or starts the
+// amazon/dynamodb-local Docker image if nothing is listening, and creates a table per
+// test that's deleted when the test finishes.
+//
+//	func TestOrderIntegration(t *testing.T) {
+//		store := streamtest.NewStore(t, "Order")
+//		p, err := stream.New(store, "id", NewOrder())
+//		...
+//	}
+//
+// Scenario tests a state's Process method without a store, and FaultyStore injects faults
+// into a store to test retries. Golden checks stored records against golden files.
+package streamtest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/a-h/stream"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/google/uuid"
+)
+
+// Region of the DynamoDB Local client.
+const Region = "eu-west-1"
+
+// DefaultEndpoint is used if the DYNAMODB_ENDPOINT environment variable isn't set.
+const DefaultEndpoint = "http://localhost:8000"
+
+// Image is the Docker image started if DynamoDB Local isn't running.
+var Image = "amazon/dynamodb-local"
+
+// Local is a DynamoDB Local instance.
+type Local struct {
+	Endpoint string
+	Client   *dynamodb.Client
+	// container is the ID of the Docker container started by Start, if any.
+	container string
+}
+
+// Start attaches to DynamoDB Local at DYNAMODB_ENDPOINT, or DefaultEndpoint. If it doesn't
+// respond, and Docker is installed, a container is started on a free port. Call Close to
+// stop the container.
+func Start(ctx context.Context) (l *Local, err error) {
+	endpoint := os.Getenv("DYNAMODB_ENDPOINT")
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	l, err = attach(ctx, endpoint)
+	if err == nil {
+		return
+	}
+	if _, lookErr := exec.LookPath("docker"); lookErr != nil {
+		return nil, fmt.Errorf("streamtest: DynamoDB Local isn't running at %s, and docker isn't installed: %w", endpoint, err)
+	}
+	return start(ctx)
+}
+
+func newClient(ctx context.Context, endpoint string) (client *dynamodb.Client, err error) {
+	creds := credentials.NewStaticCredentialsProvider("fake", "accessKeyId", "secretKeyId")
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(Region), config.WithCredentialsProvider(creds))
+	if err != nil {
+		return
+	}
+	client = dynamodb.NewFromConfig(cfg, dynamodb.WithEndpointResolver(dynamodb.EndpointResolverFromURL(endpoint)))
+	return
+}
+
+func attach(ctx context.Context, endpoint string) (l *Local, err error) {
+	client, err := newClient(ctx, endpoint)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Second*2)
+	defer cancel()
+	_, err = client.ListTables(ctx, &dynamodb.ListTablesInput{Limit: aws.Int32(1)})
+	if err != nil {
+		return
+	}
+	return &Local{Endpoint: endpoint, Client: client}, nil
+}
+
+func start(ctx context.Context) (l *Local, err error) {
+	port, err := freePort()
+	if err != nil {
+		return
+	}
+	out, err := exec.CommandContext(ctx, "docker", "run", "--rm", "-d", "-p", strconv.Itoa(port)+":8000", Image, "-jar", "DynamoDBLocal.jar", "-inMemory", "-sharedDb").Output()
+	if err != nil {
+		return nil, fmt.Errorf("streamtest: failed to start %s: %w", Image, err)
+	}
+	container := strings.TrimSpace(string(out))
+	endpoint := "http://localhost:" + strconv.Itoa(port)
+	for deadline := time.Now().Add(time.Second * 30); time.Now().Before(deadline); time.Sleep(time.Millisecond * 250) {
+		if l, err = attach(ctx, endpoint); err == nil {
+			l.container = container
+			return
+		}
+	}
+	stop(container)
+	return nil, fmt.Errorf("streamtest: DynamoDB Local didn't start: %w", err)
+}
+
+func freePort() (port int, err error) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+func stop(container string) error {
+	return exec.Command("docker", "stop", container).Run()
+}
+
+// Close stops the Docker container, if Start started one.
+func (l *Local) Close() error {
+	if l.container == "" {
+		return nil
+	}
+	return stop(l.container)
+}
+
+// NewTable creates a table with a random name, and deletes it when the test finishes.
+func (l *Local) NewTable(t testing.TB, opts ...stream.TableOption) (name string) {
+	t.Helper()
+	name = uuid.New().String()
+	if err := stream.CreateTable(context.Background(), l.Client, name, opts...); err != nil {
+		t.Fatalf("streamtest: failed to create table: %v", err)
+	}
+	t.Cleanup(func() {
+		_, err := l.Client.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{
+			TableName: aws.String(name),
+		})
+		if err != nil {
+			t.Errorf("streamtest: failed to delete table: %v", err)
+		}
+	})
+	return
+}
+
+// NewStore returns a store for the namespace in a new table, which is deleted when the
+// test finishes.
+func (l *Local) NewStore(t testing.TB, namespace string, opts ...stream.StoreOption) *stream.DynamoDBStore {
+	t.Helper()
+	name := l.NewTable(t)
+	opts = append([]stream.StoreOption{stream.WithRegion(Region), stream.WithClient(l.Client)}, opts...)
+	s, err := stream.NewStore(name, namespace, opts...)
+	if err != nil {
+		t.Fatalf("streamtest: failed to create store: %v", err)
+	}
+	return s
+}
+
+var (
+	defaultLocal    *Local
+	defaultErr      error
+	defaultLocalMtx sync.Mutex
+)
+
+// Default returns the Local shared by NewTable and NewStore, starting it on first use.
+// Tests skip if testing.Short() is set. Call Stop from TestMain to stop the container
+// once the tests have finished.
+func Default(t testing.TB) *Local {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	defaultLocalMtx.Lock()
+	defer defaultLocalMtx.Unlock()
+	if defaultLocal == nil && defaultErr == nil {
+		defaultLocal, defaultErr = Start(context.Background())
+	}
+	if defaultErr != nil {
+		t.Fatal(defaultErr)
+	}
+	return defaultLocal
+}
+
+// Stop stops the container started by Default, if any.
+func Stop() (err error) {
+	defaultLocalMtx.Lock()
+	defer defaultLocalMtx.Unlock()
+	if defaultLocal == nil {
+		return nil
+	}
+	err = defaultLocal.Close()
+	defaultLocal, defaultErr = nil, nil
+	return
+}
+
+// NewTable creates a table in the shared DynamoDB Local, see Default.
+func NewTable(t testing.TB, opts ...stream.TableOption) (name string) {
+	t.Helper()
+	return Default(t).NewTable(t, opts...)
+}
+
+// NewStore returns a store in a new table of the shared DynamoDB Local, see Default.
+func NewStore(t testing.TB, namespace string, opts ...stream.StoreOption) *stream.DynamoDBStore {
+	t.Helper()
+	return Default(t).NewStore(t, namespace, opts...)
+}
@@ -0,0 +1,63 @@
+package streamtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/a-h/stream"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type counter struct {
+	Count int `json:"count"`
+}
+
+type increment struct{}
+
+func (increment) EventName() string { return "Increment" }
+func (increment) IsInbound()        {}
+
+func (c *counter) Process(event stream.InboundEvent) (outbound []stream.OutboundEvent, err error) {
+	c.Count++
+	return
+}
+
+func TestNewStoreIntegration(t *testing.T) {
+	// Arrange.
+	local := Default(t)
+	var name string
+	t.Run("store", func(t *testing.T) {
+		s := local.NewStore(t, "Counter")
+		name = aws.ToString(s.TableName)
+
+		// Act.
+		p, err := stream.New(s, "id", &counter{})
+		if err != nil {
+			t.Fatalf("failed to create processor: %v", err)
+		}
+		if err = p.Process(increment{}); err != nil {
+			t.Fatalf("failed to process: %v", err)
+		}
+
+		// Assert.
+		var c counter
+		if _, err = s.Get("id", &c); err != nil {
+			t.Fatalf("failed to get state: %v", err)
+		}
+		if c.Count != 1 {
+			t.Errorf("expected count 1, got %d", c.Count)
+		}
+	})
+
+	// Assert.
+	_, err := local.Client.DescribeTable(context.Background(), &dynamodb.DescribeTableInput{
+		TableName: aws.String(name),
+	})
+	var notFound *types.ResourceNotFoundException
+	if !errors.As(err, &notFound) {
+		t.Errorf("expected the table to be deleted after the test, got %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TableAPI is the subset of the DynamoDB client used by CreateTable and VerifyTableSchema.
+type TableAPI interface {
+	CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error)
+	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+	DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error)
+	UpdateTimeToLive(ctx context.Context, params *dynamodb.UpdateTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error)
+}
+
+// TableOption configures CreateTable, and the settings checked by VerifyTableSchema.
+type TableOption func(*TableOptions)
+
+// TableOptions for CreateTable and VerifyTableSchema.
+type TableOptions struct {
+	// Stream enables DynamoDB Streams with the NEW_IMAGE view type, used by the handler
+	// package to publish outbound events.
+	Stream bool
+	// TTL enables time to live on the _ttl attribute, used by the consumer package's
+	// Deduplicator, and the websocket package's subscriptions.
+	TTL bool
+	// OutboxIndex is the name of a global secondary index on the _outbox and _id
+	// attributes, used with WithOutbox. No index is created if empty.
+	OutboxIndex string
+	// Timeout is the maximum time to wait for the table to become active. Defaults to
+	// 5 minutes.
+	Timeout time.Duration
+}
+
+// TableStream enables DynamoDB Streams on the table.
+func TableStream(enabled bool) TableOption {
+	return func(o *TableOptions) {
+		o.Stream = enabled
+	}
+}
+
+// TableTTL enables time to live on the table's _ttl attribute.
+func TableTTL(enabled bool) TableOption {
+	return func(o *TableOptions) {
+		o.TTL = enabled
+	}
+}
+
+// TableOutboxIndex creates a global secondary index for the outbox, see WithOutbox.
+func TableOutboxIndex(name string) TableOption {
+	return func(o *TableOptions) {
+		o.OutboxIndex = name
+	}
+}
+
+// CreateTable creates a table keyed by _pk and _sk, with on-demand billing, for use by
+// DynamoDBStore, and waits for it to become active, e.g. to bootstrap a CI environment
+// or DynamoDB Local.
+func CreateTable(ctx context.Context, client TableAPI, name string, opts ...TableOption) (err error) {
+	o := TableOptions{
+		Timeout: time.Minute * 5,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	_, err = client.CreateTable(ctx, createTableInput(name, o))
+	if err != nil {
+		return
+	}
+	err = dynamodb.NewTableExistsWaiter(client).Wait(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(name),
+	}, o.Timeout)
+	if err != nil || !o.TTL {
+		return
+	}
+	_, err = client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(name),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String("_ttl"),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	return
+}
+
+func createTableInput(name string, o TableOptions) *dynamodb.CreateTableInput {
+	cti := &dynamodb.CreateTableInput{
+		TableName: aws.String(name),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("_pk"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("_sk"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("_pk"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("_sk"), KeyType: types.KeyTypeRange},
+		},
+		BillingMode: types.BillingModePayPerRequest,
+	}
+	if o.Stream {
+		cti.StreamSpecification = &types.StreamSpecification{
+			StreamEnabled:  aws.Bool(true),
+			StreamViewType: types.StreamViewTypeNewImage,
+		}
+	}
+	if o.OutboxIndex != "" {
+		cti.AttributeDefinitions = append(cti.AttributeDefinitions,
+			types.AttributeDefinition{AttributeName: aws.String("_outbox"), AttributeType: types.ScalarAttributeTypeS},
+			types.AttributeDefinition{AttributeName: aws.String("_id"), AttributeType: types.ScalarAttributeTypeS},
+		)
+		cti.GlobalSecondaryIndexes = []types.GlobalSecondaryIndex{
+			{
+				IndexName: aws.String(o.OutboxIndex),
+				KeySchema: []types.KeySchemaElement{
+					{AttributeName: aws.String("_outbox"), KeyType: types.KeyTypeHash},
+					{AttributeName: aws.String("_id"), KeyType: types.KeyTypeRange},
+				},
+				Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+			},
+		}
+	}
+	return cti
+}
+
+// ErrTableSchema is matched by the TableSchemaError returned by VerifyTableSchema.
+var ErrTableSchema = errors.New("table schema doesn't match the store")
+
+// TableSchemaError lists the differences between a table and the schema expected by
+// DynamoDBStore.
+type TableSchemaError struct {
+	Table    string
+	Problems []string
+}
+
+func (e *TableSchemaError) Error() string {
+	return fmt.Sprintf("table %s: %s", e.Table, strings.Join(e.Problems, "; "))
+}
+
+func (e *TableSchemaError) Is(target error) bool {
+	return target == ErrTableSchema
+}
+
+// VerifyTableSchema checks that the table is keyed by _pk and _sk, and has the stream,
+// time to live and outbox index settings enabled by the options, so that applications
+// can fail fast at startup, rather than on the first write. Differences are returned as
+// a *TableSchemaError.
+func VerifyTableSchema(ctx context.Context, client TableAPI, name string, opts ...TableOption) (err error) {
+	var o TableOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	dto, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(name),
+	})
+	if err != nil {
+		return
+	}
+	table := dto.Table
+	var problems []string
+	defined := attributeTypes(table.AttributeDefinitions)
+	problems = append(problems, verifyKeySchema("", table.KeySchema, defined, "_pk", "_sk")...)
+	if o.Stream {
+		spec := table.StreamSpecification
+		switch {
+		case spec == nil || !aws.ToBool(spec.StreamEnabled):
+			problems = append(problems, "stream is not enabled")
+		case spec.StreamViewType != types.StreamViewTypeNewImage && spec.StreamViewType != types.StreamViewTypeNewAndOldImages:
+			problems = append(problems, fmt.Sprintf("stream view type is %s, expected NEW_IMAGE or NEW_AND_OLD_IMAGES", spec.StreamViewType))
+		}
+	}
+	if o.OutboxIndex != "" {
+		problems = append(problems, verifyOutboxIndex(table.GlobalSecondaryIndexes, o.OutboxIndex, defined)...)
+	}
+	if o.TTL {
+		var ttl *dynamodb.DescribeTimeToLiveOutput
+		ttl, err = client.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{
+			TableName: aws.String(name),
+		})
+		if err != nil {
+			return
+		}
+		d := ttl.TimeToLiveDescription
+		switch {
+		case d == nil || (d.TimeToLiveStatus != types.TimeToLiveStatusEnabled && d.TimeToLiveStatus != types.TimeToLiveStatusEnabling):
+			problems = append(problems, "time to live is not enabled")
+		case aws.ToString(d.AttributeName) != "_ttl":
+			problems = append(problems, fmt.Sprintf("time to live attribute is %s, expected _ttl", aws.ToString(d.AttributeName)))
+		}
+	}
+	if len(problems) > 0 {
+		return &TableSchemaError{Table: name, Problems: problems}
+	}
+	return nil
+}
+
+func verifyOutboxIndex(indexes []types.GlobalSecondaryIndexDescription, name string, defined map[string]types.ScalarAttributeType) (problems []string) {
+	for _, index := range indexes {
+		if aws.ToString(index.IndexName) != name {
+			continue
+		}
+		problems = verifyKeySchema("index "+name+" ", index.KeySchema, defined, "_outbox", "_id")
+		if index.Projection == nil || index.Projection.ProjectionType != types.ProjectionTypeAll {
+			problems = append(problems, "index "+name+" doesn't project all attributes")
+		}
+		return
+	}
+	return []string{"index " + name + " doesn't exist"}
+}
+
+func verifyKeySchema(prefix string, schema []types.KeySchemaElement, defined map[string]types.ScalarAttributeType, hash, rng string) (problems []string) {
+	expected := map[types.KeyType]string{
+		types.KeyTypeHash:  hash,
+		types.KeyTypeRange: rng,
+	}
+	actual := make(map[types.KeyType]string, len(schema))
+	for _, k := range schema {
+		actual[k.KeyType] = aws.ToString(k.AttributeName)
+	}
+	for _, kt := range []types.KeyType{types.KeyTypeHash, types.KeyTypeRange} {
+		attr := expected[kt]
+		if actual[kt] != attr {
+			problems = append(problems, fmt.Sprintf("%s%s key is %q, expected %q", prefix, strings.ToLower(string(kt)), actual[kt], attr))
+			continue
+		}
+		if defined[attr] != types.ScalarAttributeTypeS {
+			problems = append(problems, fmt.Sprintf("%s%s attribute type is %q, expected S", prefix, attr, defined[attr]))
+		}
+	}
+	return
+}
+
+func attributeTypes(definitions []types.AttributeDefinition) map[string]types.ScalarAttributeType {
+	defined := make(map[string]types.ScalarAttributeType, len(definitions))
+	for _, d := range definitions {
+		defined[aws.ToString(d.AttributeName)] = d.AttributeType
+	}
+	return defined
+}
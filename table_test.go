@@ -0,0 +1,228 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+type tableClient struct {
+	create         *dynamodb.CreateTableInput
+	ttl            *dynamodb.UpdateTimeToLiveInput
+	table          *types.TableDescription
+	ttlDescription *types.TimeToLiveDescription
+}
+
+func (c *tableClient) CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	c.create = params
+	return &dynamodb.CreateTableOutput{}, nil
+}
+
+func (c *tableClient) DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	if c.table != nil {
+		return &dynamodb.DescribeTableOutput{Table: c.table}, nil
+	}
+	return &dynamodb.DescribeTableOutput{
+		Table: &types.TableDescription{TableName: params.TableName, TableStatus: types.TableStatusActive},
+	}, nil
+}
+
+func (c *tableClient) DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error) {
+	return &dynamodb.DescribeTimeToLiveOutput{TimeToLiveDescription: c.ttlDescription}, nil
+}
+
+func (c *tableClient) UpdateTimeToLive(ctx context.Context, params *dynamodb.UpdateTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error) {
+	c.ttl = params
+	return &dynamodb.UpdateTimeToLiveOutput{}, nil
+}
+
+func TestCreateTable(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []TableOption
+		expectTTL   bool
+		expectIndex bool
+		expectView  types.StreamViewType
+	}{
+		{
+			name: "keys only",
+		},
+		{
+			name:       "stream",
+			opts:       []TableOption{TableStream(true)},
+			expectView: types.StreamViewTypeNewImage,
+		},
+		{
+			name:      "ttl",
+			opts:      []TableOption{TableTTL(true)},
+			expectTTL: true,
+		},
+		{
+			name:        "outbox index",
+			opts:        []TableOption{TableOutboxIndex("outbox")},
+			expectIndex: true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			client := &tableClient{}
+
+			// Act.
+			err := CreateTable(context.Background(), client, "stream", test.opts...)
+
+			// Assert.
+			if err != nil {
+				t.Fatalf("failed to create table: %v", err)
+			}
+			if client.create.BillingMode != types.BillingModePayPerRequest {
+				t.Errorf("expected on-demand billing, got %v", client.create.BillingMode)
+			}
+			if len(client.create.KeySchema) != 2 || aws.ToString(client.create.KeySchema[0].AttributeName) != "_pk" || aws.ToString(client.create.KeySchema[1].AttributeName) != "_sk" {
+				t.Errorf("unexpected key schema: %+v", client.create.KeySchema)
+			}
+			var view types.StreamViewType
+			if client.create.StreamSpecification != nil {
+				view = client.create.StreamSpecification.StreamViewType
+			}
+			if view != test.expectView {
+				t.Errorf("expected stream view %q, got %q", test.expectView, view)
+			}
+			if (client.ttl != nil) != test.expectTTL {
+				t.Errorf("expected TTL %v, got %v", test.expectTTL, client.ttl != nil)
+			}
+			if client.ttl != nil && aws.ToString(client.ttl.TimeToLiveSpecification.AttributeName) != "_ttl" {
+				t.Errorf("expected TTL on _ttl, got %q", aws.ToString(client.ttl.TimeToLiveSpecification.AttributeName))
+			}
+			if (len(client.create.GlobalSecondaryIndexes) == 1) != test.expectIndex {
+				t.Errorf("expected index %v, got %d indexes", test.expectIndex, len(client.create.GlobalSecondaryIndexes))
+			}
+		})
+	}
+}
+
+// describeCreatedTable returns the description of a table created with the options.
+func describeCreatedTable(opts ...TableOption) *types.TableDescription {
+	var o TableOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	cti := createTableInput("stream", o)
+	td := &types.TableDescription{
+		TableName:            cti.TableName,
+		AttributeDefinitions: cti.AttributeDefinitions,
+		KeySchema:            cti.KeySchema,
+		StreamSpecification:  cti.StreamSpecification,
+	}
+	for _, gsi := range cti.GlobalSecondaryIndexes {
+		td.GlobalSecondaryIndexes = append(td.GlobalSecondaryIndexes, types.GlobalSecondaryIndexDescription{
+			IndexName:  gsi.IndexName,
+			KeySchema:  gsi.KeySchema,
+			Projection: gsi.Projection,
+		})
+	}
+	return td
+}
+
+func TestVerifyTableSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		table    *types.TableDescription
+		ttl      *types.TimeToLiveDescription
+		opts     []TableOption
+		expected []string
+	}{
+		{
+			name:  "a table created by CreateTable is valid",
+			table: describeCreatedTable(TableStream(true), TableOutboxIndex("outbox")),
+			ttl: &types.TimeToLiveDescription{
+				AttributeName:    aws.String("_ttl"),
+				TimeToLiveStatus: types.TimeToLiveStatusEnabled,
+			},
+			opts: []TableOption{TableStream(true), TableTTL(true), TableOutboxIndex("outbox")},
+		},
+		{
+			name: "the key schema must use _pk and _sk strings",
+			table: &types.TableDescription{
+				AttributeDefinitions: []types.AttributeDefinition{
+					{AttributeName: aws.String("pk"), AttributeType: types.ScalarAttributeTypeS},
+					{AttributeName: aws.String("_sk"), AttributeType: types.ScalarAttributeTypeN},
+				},
+				KeySchema: []types.KeySchemaElement{
+					{AttributeName: aws.String("pk"), KeyType: types.KeyTypeHash},
+					{AttributeName: aws.String("_sk"), KeyType: types.KeyTypeRange},
+				},
+			},
+			expected: []string{
+				`hash key is "pk", expected "_pk"`,
+				`_sk attribute type is "N", expected S`,
+			},
+		},
+		{
+			name:     "the stream must be enabled",
+			table:    describeCreatedTable(),
+			opts:     []TableOption{TableStream(true)},
+			expected: []string{"stream is not enabled"},
+		},
+		{
+			name: "the stream must include the new image",
+			table: func() *types.TableDescription {
+				td := describeCreatedTable(TableStream(true))
+				td.StreamSpecification.StreamViewType = types.StreamViewTypeKeysOnly
+				return td
+			}(),
+			opts:     []TableOption{TableStream(true)},
+			expected: []string{"stream view type is KEYS_ONLY, expected NEW_IMAGE or NEW_AND_OLD_IMAGES"},
+		},
+		{
+			name:     "the outbox index must exist",
+			table:    describeCreatedTable(),
+			opts:     []TableOption{TableOutboxIndex("outbox")},
+			expected: []string{"index outbox doesn't exist"},
+		},
+		{
+			name:  "time to live must use the _ttl attribute",
+			table: describeCreatedTable(),
+			ttl: &types.TimeToLiveDescription{
+				AttributeName:    aws.String("expires"),
+				TimeToLiveStatus: types.TimeToLiveStatusEnabled,
+			},
+			opts:     []TableOption{TableTTL(true)},
+			expected: []string{"time to live attribute is expires, expected _ttl"},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			client := &tableClient{table: test.table, ttlDescription: test.ttl}
+
+			// Act.
+			err := VerifyTableSchema(context.Background(), client, "stream", test.opts...)
+
+			// Assert.
+			if len(test.expected) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrTableSchema) {
+				t.Fatalf("expected ErrTableSchema, got %v", err)
+			}
+			var tse *TableSchemaError
+			if !errors.As(err, &tse) {
+				t.Fatalf("expected a *TableSchemaError, got %T", err)
+			}
+			if diff := cmp.Diff(test.expected, tse.Problems); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
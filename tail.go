@@ -0,0 +1,205 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TailedEvent is an outbound event passed to the function given to Tail.
+type TailedEvent struct {
+	ID string `json:"id"`
+	ExportRecord
+}
+
+// TailOption configures Tail.
+type TailOption func(*TailOptions)
+
+// TailOptions for Tail.
+type TailOptions struct {
+	// Types of outbound event to return. If empty, every type is returned.
+	Types []string
+	// Since is the earliest time of the events to return. Defaults to the time that Tail
+	// is called.
+	Since time.Time
+	// PollInterval is the time to wait between scans of the table. Defaults to 2 seconds.
+	PollInterval time.Duration
+}
+
+// TailTypes only returns outbound events of the given types.
+func TailTypes(types ...string) TailOption {
+	return func(o *TailOptions) {
+		o.Types = append(o.Types, types...)
+	}
+}
+
+// TailSince returns the outbound events stored since t, rather than only new events.
+func TailSince(t time.Time) TailOption {
+	return func(o *TailOptions) {
+		o.Since = t
+	}
+}
+
+// TailPollInterval sets the time to wait between scans of the table.
+func TailPollInterval(d time.Duration) TailOption {
+	return func(o *TailOptions) {
+		o.PollInterval = d
+	}
+}
+
+// Tail passes the outbound events stored in the store's namespace to f as they're written,
+// until the context is cancelled or f returns an error, e.g. to watch events while
+// debugging. Events are found by repeatedly scanning the table for records with a recent
+// _ts attribute, so use it during development, rather than to drive production workloads.
+// Encrypted events are decrypted, and Redactor fields are removed.
+func (ddb *DynamoDBStore) Tail(ctx context.Context, f func(TailedEvent) error, opts ...TailOption) (err error) {
+	o := TailOptions{
+		Since:        ddb.Now(),
+		PollInterval: time.Second * 2,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	cursor := newTailCursor(o.Since)
+	for {
+		var items []map[string]types.AttributeValue
+		items, err = ddb.scanOutbound(ctx, cursor.from, o.Types)
+		if err != nil {
+			return
+		}
+		for _, item := range cursor.next(items) {
+			var e TailedEvent
+			e, err = ddb.createTailedEvent(ctx, item)
+			if err != nil {
+				return
+			}
+			if err = f(e); err != nil {
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(o.PollInterval):
+		}
+	}
+}
+
+func (ddb *DynamoDBStore) scanOutbound(ctx context.Context, from int64, eventTypes []string) (items []map[string]types.AttributeValue, err error) {
+	filter := "begins_with(#_pk, :_pk) AND begins_with(#_sk, :_sk) AND #_ts >= :_from"
+	names := map[string]string{
+		"#_pk": "_pk",
+		"#_sk": "_sk",
+		"#_ts": "_ts",
+	}
+	values := map[string]types.AttributeValue{
+		":_pk":   ddb.attributeValueString(ddb.createPartitionKey("")),
+		":_sk":   ddb.attributeValueString("OUTBOUND/"),
+		":_from": ddb.attributeValueInteger(from),
+	}
+	if len(eventTypes) > 0 {
+		placeholders := make([]string, len(eventTypes))
+		for i, t := range eventTypes {
+			placeholders[i] = ":_typ" + strconv.Itoa(i)
+			values[placeholders[i]] = ddb.attributeValueString(t)
+		}
+		filter += " AND #_typ IN (" + strings.Join(placeholders, ", ") + ")"
+		names["#_typ"] = "_typ"
+	}
+	pages := dynamodb.NewScanPaginator(ddb.Client, &dynamodb.ScanInput{
+		TableName:                 ddb.TableName,
+		ConsistentRead:            aws.Bool(!ddb.EventuallyConsistentReads),
+		FilterExpression:          aws.String(filter),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ReturnConsumedCapacity:    ddb.returnConsumedCapacity(),
+	})
+	for pages.HasMorePages() {
+		var page *dynamodb.ScanOutput
+		page, err = pages.NextPage(ctx)
+		if err != nil {
+			return
+		}
+		if page.ConsumedCapacity != nil {
+			ddb.reportCapacity(OperationScan, *page.ConsumedCapacity)
+		}
+		items = append(items, page.Items...)
+	}
+	return
+}
+
+func (ddb *DynamoDBStore) createTailedEvent(ctx context.Context, item map[string]types.AttributeValue) (e TailedEvent, err error) {
+	e.ID = strings.TrimPrefix(stringAttribute(item, "_pk"), ddb.createPartitionKey(""))
+	item, err = ddb.decryptRecord(ctx, item, ddb.newEntityKeyLoader(ctx, e.ID))
+	if err != nil {
+		return
+	}
+	e.ExportRecord, _, err = ddb.createExportRecord(item, ExportOptions{ApplyRedactors: true})
+	if err != nil {
+		err = fmt.Errorf("tail: %s: %w", e.ID, err)
+	}
+	return
+}
+
+// tailCursor tracks the records already returned by Tail. The _ts attribute only has a
+// resolution of a second, so each scan includes the latest second of the previous scan,
+// and records seen in that second are skipped.
+type tailCursor struct {
+	from int64
+	seen map[string]struct{}
+}
+
+func newTailCursor(since time.Time) *tailCursor {
+	return &tailCursor{
+		from: since.Unix(),
+		seen: make(map[string]struct{}),
+	}
+}
+
+// next returns the unseen items, ordered by time, and moves the cursor forward.
+func (c *tailCursor) next(items []map[string]types.AttributeValue) (unseen []map[string]types.AttributeValue) {
+	for _, item := range items {
+		if _, ok := c.seen[tailKey(item)]; !ok {
+			unseen = append(unseen, item)
+		}
+	}
+	sort.SliceStable(unseen, func(i, j int) bool {
+		if ti, tj := tailNumber(unseen[i], "_ts"), tailNumber(unseen[j], "_ts"); ti != tj {
+			return ti < tj
+		}
+		if si, sj := tailNumber(unseen[i], "_seq"), tailNumber(unseen[j], "_seq"); si != sj {
+			return si < sj
+		}
+		return tailKey(unseen[i]) < tailKey(unseen[j])
+	})
+	for _, item := range unseen {
+		ts := tailNumber(item, "_ts")
+		if ts > c.from {
+			c.from = ts
+			c.seen = make(map[string]struct{})
+		}
+		if ts == c.from {
+			c.seen[tailKey(item)] = struct{}{}
+		}
+	}
+	return
+}
+
+func tailKey(item map[string]types.AttributeValue) string {
+	return stringAttribute(item, "_pk") + "/" + stringAttribute(item, "_sk")
+}
+
+func tailNumber(item map[string]types.AttributeValue, name string) int64 {
+	if v, ok := item[name].(*types.AttributeValueMemberN); ok {
+		n, _ := strconv.ParseInt(v.Value, 10, 64)
+		return n
+	}
+	return 0
+}
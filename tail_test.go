@@ -0,0 +1,106 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+func tailItem(id, sk string, ts, seq int64) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"_pk":  &types.AttributeValueMemberS{Value: "Average/" + id},
+		"_sk":  &types.AttributeValueMemberS{Value: sk},
+		"_ts":  &types.AttributeValueMemberN{Value: strconv.FormatInt(ts, 10)},
+		"_seq": &types.AttributeValueMemberN{Value: strconv.FormatInt(seq, 10)},
+	}
+}
+
+func TestTailCursor(t *testing.T) {
+	// Arrange.
+	cursor := newTailCursor(time.Unix(100, 0))
+	first := []map[string]types.AttributeValue{
+		tailItem("b", "OUTBOUND/1/0/Changed", 101, 1),
+		tailItem("a", "OUTBOUND/10/0/Changed", 100, 10),
+		tailItem("a", "OUTBOUND/9/0/Changed", 100, 9),
+	}
+	// The second scan includes the latest second of the first scan.
+	second := []map[string]types.AttributeValue{
+		tailItem("b", "OUTBOUND/1/0/Changed", 101, 1),
+		tailItem("b", "OUTBOUND/2/0/Changed", 101, 2),
+	}
+
+	// Act.
+	var keys []string
+	for _, items := range [][]map[string]types.AttributeValue{first, second} {
+		for _, item := range cursor.next(items) {
+			keys = append(keys, tailKey(item))
+		}
+	}
+
+	// Assert.
+	expected := []string{
+		"Average/a/OUTBOUND/9/0/Changed",
+		"Average/a/OUTBOUND/10/0/Changed",
+		"Average/b/OUTBOUND/1/0/Changed",
+		"Average/b/OUTBOUND/2/0/Changed",
+	}
+	if diff := cmp.Diff(expected, keys); diff != "" {
+		t.Error(diff)
+	}
+	if cursor.from != 101 {
+		t.Errorf("expected the cursor to move to 101, got %d", cursor.from)
+	}
+}
+
+func TestTailIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	// Arrange.
+	name := createLocalTable(t)
+	defer deleteLocalTable(t, name)
+	s, err := NewStore(name, "Customer", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	since := time.Now()
+	items, err := s.Prepare("id", 0, &AverageState{}, nil, []OutboundEvent{CustomerRegistered{
+		Name:    "Alice",
+		Address: map[string]string{"postcode": "AB1 2CD"},
+	}})
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+	if err = s.Execute(items); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+	errStop := errors.New("stop")
+
+	// Act.
+	var tailed []TailedEvent
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	err = s.Tail(ctx, func(e TailedEvent) error {
+		tailed = append(tailed, e)
+		return errStop
+	}, TailSince(since), TailTypes("CustomerRegistered"), TailPollInterval(time.Millisecond*100))
+
+	// Assert.
+	if !errors.Is(err, errStop) {
+		t.Fatalf("expected the error returned by the function, got %v", err)
+	}
+	if len(tailed) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(tailed))
+	}
+	if tailed[0].ID != "id" || tailed[0].Type != "CustomerRegistered" {
+		t.Errorf("unexpected event: %+v", tailed[0])
+	}
+	if _, ok := tailed[0].Data["address"].(map[string]interface{})["postcode"]; ok {
+		t.Error("expected the redacted field to be removed")
+	}
+}
@@ -0,0 +1,36 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrInvalidTenant is returned when a tenant ID is empty or contains a "/".
+var ErrInvalidTenant = errors.New("invalid tenant: must be non-empty and must not contain '/'")
+
+// WithTenant scopes the store to a tenant. Partition keys are prefixed with the
+// tenant ID, so a Processor that uses the store can't read or write another tenant's
+// records. Don't mix tenant-scoped and unscoped stores in the same table.
+func WithTenant(tenant string) StoreOption {
+	return func(o *StoreOptions) error {
+		if tenant == "" || strings.Contains(tenant, "/") {
+			return ErrInvalidTenant
+		}
+		o.Tenant = tenant
+		return nil
+	}
+}
+
+// List returns the IDs of the entities in the store's namespace, and tenant if the
+// store is tenant-scoped. It scans the table, so it's intended for administrative
+// tasks rather than request handling.
+func (ddb *DynamoDBStore) List(ctx context.Context) (ids []string, err error) {
+	err = ddb.scanEntities(ctx, nil, func(id string, _ map[string]types.AttributeValue, _ bool) bool {
+		ids = append(ids, id)
+		return true
+	})
+	return
+}
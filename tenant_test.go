@@ -0,0 +1,103 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestWithTenant(t *testing.T) {
+	tests := []struct {
+		tenant   string
+		expected error
+	}{
+		{tenant: "tenant", expected: nil},
+		{tenant: "", expected: ErrInvalidTenant},
+		{tenant: "a/b", expected: ErrInvalidTenant},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.tenant, func(t *testing.T) {
+			_, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient), WithTenant(tt.tenant))
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestTenantScopedPartitionKeys(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Average", WithRegion(region), WithClient(testClient), WithTenant("tenant"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	// Act.
+	items, err := s.Prepare("id", 0, &AverageState{}, []InboundEvent{Add{Number: 1}}, []OutboundEvent{Average{Value: 1}})
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Assert.
+	for _, item := range items {
+		if diff := cmp.Diff(&types.AttributeValueMemberS{Value: "tenant/Average/id"}, item.Put.Item["_pk"], ignoreAttributeValueUnexported); diff != "" {
+			t.Error(diff)
+		}
+		if diff := cmp.Diff(&types.AttributeValueMemberS{Value: "tenant"}, item.Put.Item["_tenant"], ignoreAttributeValueUnexported); diff != "" {
+			t.Error(diff)
+		}
+	}
+}
+
+func TestTenantIsolationIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	// Arrange.
+	name := createLocalTable(t)
+	defer deleteLocalTable(t, name)
+	a, err := NewStore(name, "Average", WithRegion(region), WithClient(testClient), WithTenant("a"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	b, err := NewStore(name, "Average", WithRegion(region), WithClient(testClient), WithTenant("b"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	for _, id := range []string{"1", "2"} {
+		p, err := New(a, id, &AverageState{})
+		if err != nil {
+			t.Fatalf("failed to create processor: %v", err)
+		}
+		if err = p.Process(Add{Number: 1}); err != nil {
+			t.Fatalf("failed to process: %v", err)
+		}
+	}
+
+	// Act.
+	_, getErr := b.Get("1", &AverageState{})
+	idsA, err := a.List(context.Background())
+	if err != nil {
+		t.Fatalf("failed to list tenant a: %v", err)
+	}
+	idsB, err := b.List(context.Background())
+	if err != nil {
+		t.Fatalf("failed to list tenant b: %v", err)
+	}
+
+	// Assert.
+	if !errors.Is(getErr, ErrStateNotFound) {
+		t.Errorf("expected tenant b not to see tenant a's state, got %v", getErr)
+	}
+	if diff := cmp.Diff([]string{"1", "2"}, idsA, cmpopts.SortSlices(func(x, y string) bool { return x < y })); diff != "" {
+		t.Error(diff)
+	}
+	if len(idsB) != 0 {
+		t.Errorf("expected no IDs for tenant b, got %v", idsB)
+	}
+}
@@ -0,0 +1,46 @@
+package stream
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TransactionStep is the inbound events to process with a Processor as part of a
+// transaction.
+type TransactionStep struct {
+	Processor *Processor
+	Events    []InboundEvent
+}
+
+// Step creates a TransactionStep.
+func Step(p *Processor, events ...InboundEvent) TransactionStep {
+	return TransactionStep{Processor: p, Events: events}
+}
+
+// Transact processes the inbound events of each step, e.g. to transfer balance between two
+// entities, then stores all of the updated states and outbound events in a single DynamoDB
+// transaction. If any of the states has been updated since it was loaded, nothing is stored
+// and ErrOptimisticConcurrency is returned.
+//
+// The transaction is executed by the store of the first step, so all of the processors must
+// use stores that write to the same table, although they may use different namespaces.
+func Transact(steps ...TransactionStep) (err error) {
+	if len(steps) == 0 {
+		return errors.New("at least one transaction step is required")
+	}
+	var items []types.TransactWriteItem
+	for _, step := range steps {
+		var stepItems []types.TransactWriteItem
+		stepItems, err = step.Processor.Prepare(step.Events...)
+		if err != nil {
+			return
+		}
+		items = append(items, stepItems...)
+	}
+	err = steps[0].Processor.store.Execute(items)
+	for _, step := range steps {
+		step.Processor.executed(err)
+	}
+	return
+}
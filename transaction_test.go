@@ -0,0 +1,109 @@
+package stream
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// executeStore records the items passed to each call to Execute.
+type executeStore struct {
+	Store
+	executed [][]types.TransactWriteItem
+}
+
+func (s *executeStore) Prepare(id string, atSequence int64, state State, inbound []InboundEvent, outbound []OutboundEvent) (items []types.TransactWriteItem, err error) {
+	items = append(items, types.TransactWriteItem{Put: &types.Put{TableName: aws.String(id)}})
+	return
+}
+
+func (s *executeStore) Execute(items []types.TransactWriteItem) error {
+	s.executed = append(s.executed, items)
+	return nil
+}
+
+func TestTransact(t *testing.T) {
+	// Arrange.
+	store := &executeStore{}
+	from, err := New(store, "from", &AverageState{})
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+	to, err := New(store, "to", &AverageState{})
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+
+	// Act.
+	err = Transact(Step(from, Subtract{Number: 1}), Step(to, Add{Number: 1}))
+	if err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+
+	// Assert.
+	if len(store.executed) != 1 {
+		t.Fatalf("expected a single transaction, got %d", len(store.executed))
+	}
+	if len(store.executed[0]) != 2 {
+		t.Errorf("expected the items of both processors to be executed, got %d", len(store.executed[0]))
+	}
+	if from.Sequence() != 1 || to.Sequence() != 1 {
+		t.Errorf("expected both sequences to be incremented, got %d and %d", from.Sequence(), to.Sequence())
+	}
+}
+
+func TestTransactIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	// Arrange.
+	name := createLocalTable(t)
+	defer deleteLocalTable(t, name)
+	s, err := NewStore(name, "Transfer", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	from, err := New(s, "from", &AverageState{})
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+	to, err := New(s, "to", &AverageState{})
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+
+	t.Run("the states are stored together", func(t *testing.T) {
+		err = Transact(Step(from, Add{Number: 10}), Step(to, Add{Number: 5}))
+		if err != nil {
+			t.Fatalf("failed to execute transaction: %v", err)
+		}
+		var retrieved AverageState
+		sequence, err := s.Get("to", &retrieved)
+		if err != nil {
+			t.Fatalf("failed to get state: %v", err)
+		}
+		if sequence != 1 || retrieved.Sum != 5 {
+			t.Errorf("expected sum 5 at sequence 1, got %d at sequence %d", retrieved.Sum, sequence)
+		}
+	})
+	t.Run("nothing is stored if any state is stale", func(t *testing.T) {
+		stale, err := New(s, "to", &AverageState{})
+		if err != nil {
+			t.Fatalf("failed to create processor: %v", err)
+		}
+		err = Transact(Step(from, Subtract{Number: 1}), Step(stale, Add{Number: 1}))
+		if !errors.Is(err, ErrOptimisticConcurrency) {
+			t.Fatalf("expected ErrOptimisticConcurrency, got %v", err)
+		}
+		var retrieved AverageState
+		sequence, err := s.Get("from", &retrieved)
+		if err != nil {
+			t.Fatalf("failed to get state: %v", err)
+		}
+		if sequence != 1 || retrieved.Sum != 10 {
+			t.Errorf("expected the state to be unchanged, got sum %d at sequence %d", retrieved.Sum, sequence)
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package stream
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Versioned can be implemented by inbound and outbound events to store their version in the
+// _ver attribute, so that records written with older versions can be upcast when they're
+// read. Events that don't implement Versioned are version 1, unless their name includes
+// the version, e.g. "GamePlayed@2".
+type Versioned interface {
+	EventVersion() int
+}
+
+// Upcaster transforms a stored event record from one version to the next, e.g. to add a
+// default UserID to version 1 of PullHandle.
+type Upcaster func(item map[string]types.AttributeValue) (map[string]types.AttributeValue, error)
+
+// upcasters of each event name, by the version they upcast from.
+type upcasters map[string]map[int]Upcaster
+
+func (u upcasters) add(eventName string, fromVersion int, f Upcaster) {
+	if u[eventName] == nil {
+		u[eventName] = make(map[int]Upcaster)
+	}
+	u[eventName][fromVersion] = f
+}
+
+// upcast applies the upcasters registered for the event, starting from the version of the
+// record, until there are no more upcasters.
+func (u upcasters) upcast(eventName string, item map[string]types.AttributeValue) (upcast map[string]types.AttributeValue, err error) {
+	byVersion := u[eventName]
+	if len(byVersion) == 0 {
+		return item, nil
+	}
+	version, err := getRecordEventVersion(item)
+	if err != nil {
+		return
+	}
+	upcast = item
+	for f, ok := byVersion[version]; ok; f, ok = byVersion[version] {
+		copied := make(map[string]types.AttributeValue, len(upcast))
+		for k, v := range upcast {
+			copied[k] = v
+		}
+		upcast, err = f(copied)
+		if err != nil {
+			err = fmt.Errorf("failed to upcast %s from version %d: %w", eventName, version, err)
+			return
+		}
+		version++
+	}
+	return
+}
+
+// ParseEventName splits a versioned event name, e.g. "GamePlayed@2", into the name and
+// version. The version is 0 if the name isn't versioned.
+func ParseEventName(eventName string) (name string, version int) {
+	i := strings.LastIndex(eventName, "@")
+	if i < 0 {
+		return eventName, 0
+	}
+	version, err := strconv.Atoi(eventName[i+1:])
+	if err != nil || version < 1 {
+		return eventName, 0
+	}
+	return eventName[:i], version
+}
+
+// VersionedEventName returns the event name with the version, e.g. "GamePlayed@2".
+func VersionedEventName(name string, version int) string {
+	return name + "@" + strconv.Itoa(version)
+}
+
+// eventNameAndVersion returns the name that the event is stored with, and its version, from
+// a versioned event name, or the Versioned interface.
+func eventNameAndVersion(e interface{ EventName() string }) (name string, version int) {
+	name, version = ParseEventName(e.EventName())
+	if v, isVersioned := e.(Versioned); isVersioned && version == 0 {
+		version = v.EventVersion()
+	}
+	return
+}
+
+func (ddb *DynamoDBStore) attributeValueEventVersion(e interface{ EventName() string }) (av types.AttributeValue, ok bool) {
+	_, version := eventNameAndVersion(e)
+	if version == 0 {
+		return
+	}
+	return ddb.attributeValueInteger(int64(version)), true
+}
+
+// getRecordEventVersion returns the version of the event stored in the record, or 1 if the
+// record has no _ver attribute.
+func getRecordEventVersion(item map[string]types.AttributeValue) (version int, err error) {
+	v, ok := item["_ver"].(*types.AttributeValueMemberN)
+	if !ok {
+		return 1, nil
+	}
+	version, err = strconv.Atoi(v.Value)
+	if err != nil {
+		err = fmt.Errorf("invalid event version %q: %w", v.Value, err)
+	}
+	return
+}
@@ -0,0 +1,202 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+// PullHandle is version 3 of the event. Version 1 had no UserID, and version 2 stored the
+// stake as Bet.
+type PullHandle struct {
+	UserID string
+	Stake  int
+}
+
+func (PullHandle) EventName() string { return "PullHandle" }
+func (PullHandle) IsInbound()        {}
+func (PullHandle) EventVersion() int { return 3 }
+
+func newPullHandleReader() *InboundEventReader {
+	return NewInboundEventReader().
+		Add("PullHandle", func(item map[string]types.AttributeValue) (InboundEvent, error) {
+			var e PullHandle
+			err := attributevalue.UnmarshalMap(item, &e)
+			return e, err
+		}).
+		Upcast("PullHandle", 1, func(item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+			item["UserID"] = &types.AttributeValueMemberS{Value: "anonymous"}
+			return item, nil
+		}).
+		Upcast("PullHandle", 2, func(item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+			item["Stake"] = item["Bet"]
+			delete(item, "Bet")
+			return item, nil
+		})
+}
+
+func TestUpcast(t *testing.T) {
+	var tests = []struct {
+		name     string
+		item     map[string]types.AttributeValue
+		expected PullHandle
+	}{
+		{
+			name: "version 1 records have no _ver attribute, and are upcast through each version",
+			item: map[string]types.AttributeValue{
+				"Bet": &types.AttributeValueMemberN{Value: "1"},
+			},
+			expected: PullHandle{UserID: "anonymous", Stake: 1},
+		},
+		{
+			name: "version 2 records are upcast from version 2",
+			item: map[string]types.AttributeValue{
+				"_ver":   &types.AttributeValueMemberN{Value: "2"},
+				"UserID": &types.AttributeValueMemberS{Value: "user"},
+				"Bet":    &types.AttributeValueMemberN{Value: "2"},
+			},
+			expected: PullHandle{UserID: "user", Stake: 2},
+		},
+		{
+			name: "current records are not upcast",
+			item: map[string]types.AttributeValue{
+				"_ver":   &types.AttributeValueMemberN{Value: "3"},
+				"UserID": &types.AttributeValueMemberS{Value: "user"},
+				"Stake":  &types.AttributeValueMemberN{Value: "3"},
+			},
+			expected: PullHandle{UserID: "user", Stake: 3},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// Act.
+			e, ok, err := newPullHandleReader().Read("PullHandle", test.item)
+
+			// Assert.
+			if err != nil || !ok {
+				t.Fatalf("failed to read event: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, e); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestUpcastDoesNotModifyTheRecord(t *testing.T) {
+	// Arrange.
+	item := map[string]types.AttributeValue{
+		"Bet": &types.AttributeValueMemberN{Value: "1"},
+	}
+
+	// Act.
+	_, _, err := newPullHandleReader().Read("PullHandle", item)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("failed to read event: %v", err)
+	}
+	if _, ok := item["Bet"]; !ok || len(item) != 1 {
+		t.Errorf("expected the record not to be modified, got %v", item)
+	}
+}
+
+func TestVersionedEventsStoreTheirVersion(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "SlotMachine", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	// Act.
+	items, err := s.Prepare("id", 0, &AverageState{}, []InboundEvent{PullHandle{UserID: "user", Stake: 1}, Add{Number: 1}}, nil)
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Assert.
+	version, err := getRecordEventVersion(items[1].Put.Item)
+	if err != nil || version != 3 {
+		t.Errorf("expected version 3, got %d: %v", version, err)
+	}
+	if _, ok := items[2].Put.Item["_ver"]; ok {
+		t.Error("expected events that don't implement Versioned not to store a version")
+	}
+}
+
+func TestParseEventName(t *testing.T) {
+	var tests = []struct {
+		eventName       string
+		expectedName    string
+		expectedVersion int
+	}{
+		{eventName: "GamePlayed", expectedName: "GamePlayed", expectedVersion: 0},
+		{eventName: "GamePlayed@2", expectedName: "GamePlayed", expectedVersion: 2},
+		{eventName: "GamePlayed@latest", expectedName: "GamePlayed@latest", expectedVersion: 0},
+		{eventName: "GamePlayed@0", expectedName: "GamePlayed@0", expectedVersion: 0},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.eventName, func(t *testing.T) {
+			// Act.
+			name, version := ParseEventName(test.eventName)
+
+			// Assert.
+			if name != test.expectedName || version != test.expectedVersion {
+				t.Errorf("expected %q version %d, got %q version %d", test.expectedName, test.expectedVersion, name, version)
+			}
+		})
+	}
+}
+
+// GamePlayedV1 and GamePlayed are versions of the same event, using versioned event names.
+type GamePlayedV1 struct {
+	Bet int
+}
+
+func (GamePlayedV1) EventName() string { return "GamePlayed@1" }
+func (GamePlayedV1) IsInbound()        {}
+
+type GamePlayed struct {
+	Stake int
+}
+
+func (GamePlayed) EventName() string { return "GamePlayed@2" }
+func (GamePlayed) IsInbound()        {}
+
+func TestVersionedEventNames(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "SlotMachine", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	reader := NewInboundEventReader()
+	Register[GamePlayedV1](reader)
+	Register[GamePlayed](reader)
+
+	// Act.
+	items, err := s.Prepare("id", 0, &AverageState{}, []InboundEvent{GamePlayedV1{Bet: 1}, GamePlayed{Stake: 2}}, nil)
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	// Assert.
+	var read []InboundEvent
+	for _, item := range items[1:] {
+		if typ := item.Put.Item["_typ"].(*types.AttributeValueMemberS).Value; typ != "GamePlayed" {
+			t.Errorf("expected the type to be stored without the version, got %q", typ)
+		}
+		e, ok, err := reader.Read("GamePlayed", item.Put.Item)
+		if err != nil || !ok {
+			t.Fatalf("failed to read event: %v", err)
+		}
+		read = append(read, e)
+	}
+	expected := []InboundEvent{GamePlayedV1{Bet: 1}, GamePlayed{Stake: 2}}
+	if diff := cmp.Diff(expected, read); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,93 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Validator can be implemented by states to check their invariants, e.g. that a balance
+// never falls below a floor. The Processor calls Validate after the state has processed
+// the inbound events, and before it's stored.
+//
+// Inbound events can also implement Validator. The Processor calls Validate before the
+// event is passed to the state.
+type Validator interface {
+	Validate() error
+}
+
+// ErrInvalidState is matched by errors.Is for errors returned by the Processor when the
+// state fails validation.
+var ErrInvalidState = errors.New("invalid state")
+
+// StateValidationError is returned by the Processor when the state fails validation.
+// Nothing is stored, but the state passed to the Processor has been modified by the
+// inbound events, so it should be reloaded before it's used again.
+type StateValidationError struct {
+	Err error
+}
+
+func (e *StateValidationError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrInvalidState, e.Err)
+}
+
+func (e *StateValidationError) Unwrap() error {
+	return e.Err
+}
+
+func (e *StateValidationError) Is(target error) bool {
+	return target == ErrInvalidState
+}
+
+func validateState(state State) error {
+	v, ok := state.(Validator)
+	if !ok {
+		return nil
+	}
+	if err := v.Validate(); err != nil {
+		return &StateValidationError{Err: err}
+	}
+	return nil
+}
+
+// ErrInvalidEvent is matched by errors.Is for errors returned when an inbound event fails
+// validation, including *SchemaError, e.g. so that APIs can return a 400 response.
+var ErrInvalidEvent = errors.New("invalid event")
+
+// EventValidationError is returned when the Validate method of an inbound event returns
+// an error.
+type EventValidationError struct {
+	Event string
+	Err   error
+}
+
+func (e *EventValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %v", e.Event, e.Err)
+}
+
+func (e *EventValidationError) Unwrap() error {
+	return e.Err
+}
+
+func (e *EventValidationError) Is(target error) bool {
+	return target == ErrInvalidEvent
+}
+
+// ValidateEvent checks the inbound event against the rules in its `validate` struct tags,
+// see ValidateSchema, and then calls its Validate method if it implements Validator.
+func ValidateEvent(e InboundEvent) error {
+	if err := ValidateSchema(e); err != nil {
+		return err
+	}
+	return validateEvent(e)
+}
+
+func validateEvent(e InboundEvent) error {
+	v, ok := e.(Validator)
+	if !ok {
+		return nil
+	}
+	if err := v.Validate(); err != nil {
+		return &EventValidationError{Event: e.EventName(), Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package stream
+
+import (
+	"errors"
+	"testing"
+)
+
+var errBelowFloor = errors.New("sum must not be negative")
+
+type FlooredState struct {
+	AverageState
+}
+
+func (s *FlooredState) Validate() error {
+	if s.Sum < 0 {
+		return errBelowFloor
+	}
+	return nil
+}
+
+func TestStateValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		events   []InboundEvent
+		expected error
+	}{
+		{
+			name:     "valid states are stored",
+			events:   []InboundEvent{Add{Number: 1}},
+			expected: nil,
+		},
+		{
+			name:     "invalid states are rejected",
+			events:   []InboundEvent{Add{Number: 1}, Subtract{Number: 2}},
+			expected: errBelowFloor,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			s, err := NewStore("table", "Floored", WithRegion(region), WithClient(testClient))
+			if err != nil {
+				t.Fatalf("failed to create store: %v", err)
+			}
+			p, err := New(s, "id", &FlooredState{})
+			if err != nil {
+				t.Fatalf("failed to create processor: %v", err)
+			}
+
+			// Act.
+			_, err = p.Prepare(tt.events...)
+
+			// Assert.
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+			if tt.expected != nil && !errors.Is(err, ErrInvalidState) {
+				t.Errorf("expected ErrInvalidState, got %v", err)
+			}
+		})
+	}
+}
+
+type Withdraw struct {
+	Amount int `validate:"min=1"`
+	Reason string
+}
+
+func (Withdraw) EventName() string { return "Withdraw" }
+func (Withdraw) IsInbound()        {}
+func (w Withdraw) Validate() error {
+	if w.Amount > 100 && w.Reason == "" {
+		return errors.New("a reason is required for large withdrawals")
+	}
+	return nil
+}
+
+func TestEventValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		event     InboundEvent
+		expectErr bool
+	}{
+		{name: "valid events are accepted", event: Withdraw{Amount: 101, Reason: "rent"}},
+		{name: "events that fail Validate are rejected", event: Withdraw{Amount: 101}, expectErr: true},
+		{name: "events that fail their schema are rejected", event: Withdraw{Amount: 0}, expectErr: true},
+		{name: "events that don't implement Validator are accepted", event: Add{Number: 1}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateEvent(tt.event)
+			if tt.expectErr != errors.Is(err, ErrInvalidEvent) {
+				t.Errorf("expected ErrInvalidEvent: %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestProcessorValidatesEvents(t *testing.T) {
+	// Arrange.
+	s, err := NewStore("table", "Floored", WithRegion(region), WithClient(testClient))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	p, err := New(s, "id", &FlooredState{})
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+
+	// Act.
+	_, err = p.Prepare(Withdraw{Amount: 101})
+
+	// Assert.
+	var eve *EventValidationError
+	if !errors.As(err, &eve) {
+		t.Fatalf("expected an *EventValidationError, got %v", err)
+	}
+	if eve.Event != "Withdraw" {
+		t.Errorf("expected the event name to be set, got %q", eve.Event)
+	}
+}
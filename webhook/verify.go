@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSignature is returned when a webhook's signature can't be verified.
+var ErrInvalidSignature = errors.New("webhook: invalid signature")
+
+// Verifier checks that the request was signed by the sender.
+type Verifier func(r *http.Request, body []byte) error
+
+// HMACSHA256 verifies a hex encoded HMAC-SHA256 of the body in the given header, with
+// an optional prefix, e.g. "sha256=".
+func HMACSHA256(header, prefix string, secret []byte) Verifier {
+	return func(r *http.Request, body []byte) error {
+		v := r.Header.Get(header)
+		if !strings.HasPrefix(v, prefix) {
+			return ErrInvalidSignature
+		}
+		return compare(sign(secret, body), strings.TrimPrefix(v, prefix))
+	}
+}
+
+// GitHub verifies the X-Hub-Signature-256 header sent by GitHub.
+func GitHub(secret []byte) Verifier {
+	return HMACSHA256("X-Hub-Signature-256", "sha256=", secret)
+}
+
+// Stripe verifies the Stripe-Signature header sent by Stripe. Signatures older than
+// the tolerance are rejected to prevent replay attacks.
+func Stripe(secret []byte, tolerance time.Duration) Verifier {
+	return func(r *http.Request, body []byte) (err error) {
+		var timestamp string
+		var signatures []string
+		for _, part := range strings.Split(r.Header.Get("Stripe-Signature"), ",") {
+			kv := strings.SplitN(part, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "t":
+				timestamp = kv[1]
+			case "v1":
+				signatures = append(signatures, kv[1])
+			}
+		}
+		if err = checkTimestamp(timestamp, tolerance); err != nil {
+			return err
+		}
+		expected := sign(secret, []byte(timestamp+"."+string(body)))
+		for _, s := range signatures {
+			if compare(expected, s) == nil {
+				return nil
+			}
+		}
+		return ErrInvalidSignature
+	}
+}
+
+// Stream verifies the X-Stream-Signature header sent by the stream handler's webhooks, the
+// hex encoded HMAC-SHA256 of the X-Stream-Timestamp header, a ".", and the body, prefixed
+// with "sha256=". Signatures older than the tolerance are rejected to prevent replay attacks.
+func Stream(secret []byte, tolerance time.Duration) Verifier {
+	return func(r *http.Request, body []byte) (err error) {
+		timestamp := r.Header.Get("X-Stream-Timestamp")
+		if err = checkTimestamp(timestamp, tolerance); err != nil {
+			return err
+		}
+		v := r.Header.Get("X-Stream-Signature")
+		if !strings.HasPrefix(v, "sha256=") {
+			return ErrInvalidSignature
+		}
+		return compare(sign(secret, []byte(timestamp+"."+string(body))), strings.TrimPrefix(v, "sha256="))
+	}
+}
+
+// checkTimestamp returns an error if the Unix timestamp is invalid, or outside of the
+// tolerance.
+func checkTimestamp(timestamp string, tolerance time.Duration) error {
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := now().Sub(time.Unix(t, 0)); tolerance > 0 && (age > tolerance || age < -tolerance) {
+		return fmt.Errorf("%w: timestamp outside of tolerance", ErrInvalidSignature)
+	}
+	return nil
+}
+
+var now = time.Now
+
+func sign(secret, data []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func compare(expected []byte, actualHex string) error {
+	actual, err := hex.DecodeString(actualHex)
+	if err != nil || !hmac.Equal(expected, actual) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
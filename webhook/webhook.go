@@ -0,0 +1,200 @@
+// Package webhook receives signed webhooks, e.g. from Stripe or GitHub, and processes
+// them as inbound events.
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/a-h/stream"
+)
+
+// Extractor reads a value, such as the event type or entity ID, from a webhook.
+type Extractor func(r *http.Request, body []byte) (string, error)
+
+// FromHeader reads a value from a request header, e.g. X-GitHub-Event.
+func FromHeader(name string) Extractor {
+	return func(r *http.Request, body []byte) (v string, err error) {
+		v = r.Header.Get(name)
+		if v == "" {
+			err = fmt.Errorf("missing %s header", name)
+		}
+		return
+	}
+}
+
+// FromJSONField reads a string or number from the JSON body. Nested fields are
+// separated with a dot, e.g. "data.object.customer".
+func FromJSONField(path string) Extractor {
+	return func(r *http.Request, body []byte) (v string, err error) {
+		var current interface{}
+		d := json.NewDecoder(strings.NewReader(string(body)))
+		d.UseNumber()
+		if err = d.Decode(&current); err != nil {
+			return
+		}
+		for _, name := range strings.Split(path, ".") {
+			m, ok := current.(map[string]interface{})
+			if !ok {
+				return "", fmt.Errorf("missing field %q", path)
+			}
+			current = m[name]
+		}
+		switch value := current.(type) {
+		case string:
+			v = value
+		case json.Number:
+			v = value.String()
+		}
+		if v == "" {
+			err = fmt.Errorf("missing field %q", path)
+		}
+		return
+	}
+}
+
+// Decoder creates an inbound event from the webhook body.
+type Decoder func(body []byte) (stream.InboundEvent, error)
+
+// JSON decodes the webhook body into T.
+func JSON[T stream.InboundEvent]() Decoder {
+	return func(body []byte) (stream.InboundEvent, error) {
+		var e T
+		err := json.Unmarshal(body, &e)
+		return e, err
+	}
+}
+
+// Handler verifies signed webhooks, decodes them into registered inbound events, and
+// processes them.
+type Handler struct {
+	Store    stream.Store
+	NewState func(id string) stream.State
+	Verify   Verifier
+	// EventType reads the event type used to find the Decoder. Defaults to the "type"
+	// field of the JSON body, as used by Stripe.
+	EventType Extractor
+	// ID reads the ID of the entity to process the event against.
+	ID Extractor
+	// MaxBodyBytes limits the size of the webhook body. Defaults to 1MB.
+	MaxBodyBytes     int64
+	ProcessorOptions []stream.ProcessorOption
+	// Schemas, if set, validate the webhook body against the schema of the event type
+	// before it's decoded.
+	Schemas  stream.JSONSchemas
+	decoders map[string]Decoder
+}
+
+// Option configures a Handler.
+type Option func(*Handler)
+
+// WithEventType sets how the event type is read from the webhook.
+func WithEventType(e Extractor) Option {
+	return func(h *Handler) {
+		h.EventType = e
+	}
+}
+
+// WithMaxBodyBytes limits the size of the webhook body.
+func WithMaxBodyBytes(n int64) Option {
+	return func(h *Handler) {
+		h.MaxBodyBytes = n
+	}
+}
+
+// WithProcessorOptions applies the options to each Processor created by the handler.
+func WithProcessorOptions(opts ...stream.ProcessorOption) Option {
+	return func(h *Handler) {
+		h.ProcessorOptions = append(h.ProcessorOptions, opts...)
+	}
+}
+
+// WithJSONSchemas validates the webhook body against the schema of the event type.
+func WithJSONSchemas(schemas stream.JSONSchemas) Option {
+	return func(h *Handler) {
+		h.Schemas = schemas
+	}
+}
+
+// New creates a Handler that processes webhooks against the entity returned by id.
+func New(store stream.Store, newState func(id string) stream.State, verify Verifier, id Extractor, opts ...Option) *Handler {
+	h := &Handler{
+		Store:        store,
+		NewState:     newState,
+		Verify:       verify,
+		EventType:    FromJSONField("type"),
+		ID:           id,
+		MaxBodyBytes: 1 << 20,
+		decoders:     make(map[string]Decoder),
+	}
+	for _, o := range opts {
+		o(h)
+	}
+	return h
+}
+
+// Register the decoder for an event type. Webhooks with unregistered event types are
+// acknowledged, but not processed.
+func (h *Handler) Register(eventType string, d Decoder) {
+	if h.decoders == nil {
+		h.decoders = make(map[string]Decoder)
+	}
+	h.decoders[eventType] = d
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.MaxBodyBytes))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err = h.Verify(r, body); err != nil {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	eventType, err := h.EventType(r, body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get event type: %v", err), http.StatusBadRequest)
+		return
+	}
+	decode, ok := h.decoders[eventType]
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err = h.Schemas.ValidateJSON(eventType, body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	event, err := decode(body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode %s: %v", eventType, err), http.StatusBadRequest)
+		return
+	}
+	if err = stream.ValidateEvent(event); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id, err := h.ID(r, body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get id: %v", err), http.StatusBadRequest)
+		return
+	}
+	if _, err = h.client().Process(r.Context(), id, event); err != nil {
+		// Senders retry webhooks that fail with a server error.
+		http.Error(w, "failed to process event", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) client() *stream.NamespaceClient[stream.State] {
+	return stream.NewNamespaceClient(h.Store, h.NewState, stream.WithProcessorOptions[stream.State](h.ProcessorOptions...))
+}
@@ -0,0 +1,263 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a-h/stream"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+type ChargeSucceeded struct {
+	Type string `json:"type"`
+	Data struct {
+		Customer string `json:"customer" validate:"required"`
+		Amount   int    `json:"amount"`
+	} `json:"data"`
+}
+
+func (ChargeSucceeded) EventName() string { return "ChargeSucceeded" }
+func (ChargeSucceeded) IsInbound()        {}
+
+type Customer struct {
+	Charged int
+}
+
+func (c *Customer) Process(event stream.InboundEvent) (outbound []stream.OutboundEvent, err error) {
+	if e, ok := event.(ChargeSucceeded); ok {
+		c.Charged += e.Data.Amount
+	}
+	return
+}
+
+type memoryStore struct {
+	stream.Store
+	processed map[string][]stream.InboundEvent
+}
+
+func (s *memoryStore) Get(id string, state stream.State) (sequence int64, err error) {
+	if _, ok := s.processed[id]; !ok {
+		err = stream.ErrStateNotFound
+	}
+	return
+}
+
+func (s *memoryStore) Prepare(id string, atSequence int64, state stream.State, inbound []stream.InboundEvent, outbound []stream.OutboundEvent) (items []types.TransactWriteItem, err error) {
+	s.processed[id] = append(s.processed[id], inbound...)
+	return
+}
+
+func (s *memoryStore) Execute(items []types.TransactWriteItem) error {
+	return nil
+}
+
+func githubSignature(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHandler(t *testing.T) {
+	const secret = "secret"
+	validBody := `{"type":"charge.succeeded","data":{"customer":"cus_1","amount":100}}`
+	tests := []struct {
+		name              string
+		body              string
+		signature         string
+		expectedStatus    int
+		expectedProcessed map[string]int
+	}{
+		{
+			name:              "valid webhooks are processed",
+			body:              validBody,
+			signature:         githubSignature(secret, validBody),
+			expectedStatus:    http.StatusNoContent,
+			expectedProcessed: map[string]int{"cus_1": 1},
+		},
+		{
+			name:              "invalid signatures are rejected",
+			body:              validBody,
+			signature:         githubSignature("wrong", validBody),
+			expectedStatus:    http.StatusUnauthorized,
+			expectedProcessed: map[string]int{},
+		},
+		{
+			name:              "unregistered event types are ignored",
+			body:              `{"type":"charge.refunded","data":{"customer":"cus_1"}}`,
+			signature:         githubSignature(secret, `{"type":"charge.refunded","data":{"customer":"cus_1"}}`),
+			expectedStatus:    http.StatusNoContent,
+			expectedProcessed: map[string]int{},
+		},
+		{
+			name:              "invalid events are rejected",
+			body:              `{"type":"charge.succeeded","data":{"amount":100}}`,
+			signature:         githubSignature(secret, `{"type":"charge.succeeded","data":{"amount":100}}`),
+			expectedStatus:    http.StatusBadRequest,
+			expectedProcessed: map[string]int{},
+		},
+		{
+			name:              "events that don't match the JSON schema are rejected",
+			body:              `{"type":"charge.succeeded","data":{"customer":"cus_1","amount":0}}`,
+			signature:         githubSignature(secret, `{"type":"charge.succeeded","data":{"customer":"cus_1","amount":0}}`),
+			expectedStatus:    http.StatusBadRequest,
+			expectedProcessed: map[string]int{},
+		},
+	}
+	schemas := stream.JSONSchemas{}
+	err := schemas.Add("charge.succeeded", []byte(`{"type":"object","properties":{"data":{"type":"object","properties":{"amount":{"type":"integer","minimum":1}}}}}`))
+	if err != nil {
+		t.Fatalf("failed to add schema: %v", err)
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			store := &memoryStore{processed: make(map[string][]stream.InboundEvent)}
+			h := New(store, func(id string) stream.State { return &Customer{} }, GitHub([]byte(secret)), FromJSONField("data.customer"), WithJSONSchemas(schemas))
+			h.Register("charge.succeeded", JSON[ChargeSucceeded]())
+			r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(tt.body))
+			r.Header.Set("X-Hub-Signature-256", tt.signature)
+			w := httptest.NewRecorder()
+
+			// Act.
+			h.ServeHTTP(w, r)
+
+			// Assert.
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			processed := make(map[string]int)
+			for id, events := range store.processed {
+				processed[id] = len(events)
+			}
+			if diff := cmp.Diff(tt.expectedProcessed, processed); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestStripe(t *testing.T) {
+	const secret = "whsec"
+	body := `{"type":"charge.succeeded"}`
+	signedAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%d.%s", signedAt.Unix(), body)))
+	header := fmt.Sprintf("t=%d,v1=%s", signedAt.Unix(), hex.EncodeToString(mac.Sum(nil)))
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		name      string
+		header    string
+		now       time.Time
+		expectErr bool
+	}{
+		{
+			name:   "valid signatures are accepted",
+			header: header,
+			now:    signedAt.Add(time.Minute),
+		},
+		{
+			name:      "old signatures are rejected",
+			header:    header,
+			now:       signedAt.Add(time.Hour),
+			expectErr: true,
+		},
+		{
+			name:      "missing signatures are rejected",
+			header:    fmt.Sprintf("t=%d", signedAt.Unix()),
+			now:       signedAt,
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			now = func() time.Time { return tt.now }
+			r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+			r.Header.Set("Stripe-Signature", tt.header)
+
+			// Act.
+			err := Stripe([]byte(secret), 5*time.Minute)(r, []byte(body))
+
+			// Assert.
+			if tt.expectErr != (err != nil) {
+				t.Errorf("expected error %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestStream(t *testing.T) {
+	const secret = "secret"
+	body := `{"amount":100}`
+	signedAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	timestamp := fmt.Sprintf("%d", signedAt.Unix())
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + body))
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		now       time.Time
+		expectErr bool
+	}{
+		{
+			name:      "valid signatures are accepted",
+			timestamp: timestamp,
+			signature: signature,
+			now:       signedAt.Add(time.Minute),
+		},
+		{
+			name:      "old signatures are rejected",
+			timestamp: timestamp,
+			signature: signature,
+			now:       signedAt.Add(time.Hour),
+			expectErr: true,
+		},
+		{
+			name:      "changed timestamps are rejected",
+			timestamp: fmt.Sprintf("%d", signedAt.Unix()+1),
+			signature: signature,
+			now:       signedAt,
+			expectErr: true,
+		},
+		{
+			name:      "signatures of the body alone are rejected",
+			timestamp: timestamp,
+			signature: githubSignature(secret, body),
+			now:       signedAt,
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			now = func() time.Time { return tt.now }
+			r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+			r.Header.Set("X-Stream-Timestamp", tt.timestamp)
+			r.Header.Set("X-Stream-Signature", tt.signature)
+
+			// Act.
+			err := Stream([]byte(secret), 5*time.Minute)(r, []byte(body))
+
+			// Assert.
+			if tt.expectErr != (err != nil) {
+				t.Errorf("expected error %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+// Package websocket pushes outbound events to API Gateway WebSocket clients that have
+// subscribed to an entity, e.g. so that a UI shows live slot machine updates. Subscriptions
+// are stored in the stream table.
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/a-h/stream"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/iotdataplane"
+	"go.uber.org/multierr"
+)
+
+// DynamoDBAPI is the subset of the DynamoDB client used by Connections.
+type DynamoDBAPI interface {
+	PutItem(context.Context, *dynamodb.PutItemInput, ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DeleteItem(context.Context, *dynamodb.DeleteItemInput, ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	Query(context.Context, *dynamodb.QueryInput, ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+}
+
+// Connections stores the channels that each WebSocket connection has subscribed to. A
+// channel is the entity's partition key, e.g. "SlotMachine/123", optionally preceded by a
+// prefix, matching the channels that the stream handler publishes to, see
+// handler.Config.Realtime.
+//
+// Each subscription is stored twice, under the channel, so that its subscribers can be
+// found, and under the connection, so that its subscriptions can be removed when it
+// disconnects. Enable TTL on the table's _ttl attribute, so that subscriptions of
+// connections that weren't removed are deleted.
+type Connections struct {
+	Client    DynamoDBAPI
+	TableName string
+	// TTL of subscriptions. API Gateway closes connections after 2 hours. Defaults to 2
+	// hours.
+	TTL time.Duration
+	// Clock is used for the expiry of subscriptions. Defaults to stream.SystemClock.
+	Clock stream.Clock
+}
+
+// NewConnections creates Connections stored in the table.
+func NewConnections(client DynamoDBAPI, tableName string) *Connections {
+	return &Connections{
+		Client:    client,
+		TableName: tableName,
+		TTL:       2 * time.Hour,
+		Clock:     stream.SystemClock,
+	}
+}
+
+func channelKey(channel, connectionID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"_pk": &types.AttributeValueMemberS{Value: "WEBSOCKET/CHANNEL/" + channel},
+		"_sk": &types.AttributeValueMemberS{Value: "CONNECTION/" + connectionID},
+	}
+}
+
+func connectionKey(connectionID, channel string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"_pk": &types.AttributeValueMemberS{Value: "WEBSOCKET/CONNECTION/" + connectionID},
+		"_sk": &types.AttributeValueMemberS{Value: "CHANNEL/" + channel},
+	}
+}
+
+// Subscribe the connection to the channel.
+func (c *Connections) Subscribe(ctx context.Context, connectionID, channel string) error {
+	ttl := &types.AttributeValueMemberN{Value: strconv.FormatInt(c.Clock.Now().Add(c.TTL).Unix(), 10)}
+	for _, item := range []map[string]types.AttributeValue{channelKey(channel, connectionID), connectionKey(connectionID, channel)} {
+		item["_ttl"] = ttl
+		_, err := c.Client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(c.TableName),
+			Item:      item,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to subscribe %s to %s: %w", connectionID, channel, err)
+		}
+	}
+	return nil
+}
+
+// Unsubscribe the connection from the channel.
+func (c *Connections) Unsubscribe(ctx context.Context, connectionID, channel string) error {
+	for _, key := range []map[string]types.AttributeValue{channelKey(channel, connectionID), connectionKey(connectionID, channel)} {
+		_, err := c.Client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(c.TableName),
+			Key:       key,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to unsubscribe %s from %s: %w", connectionID, channel, err)
+		}
+	}
+	return nil
+}
+
+// Disconnect removes the connection's subscriptions.
+func (c *Connections) Disconnect(ctx context.Context, connectionID string) error {
+	channels, err := c.query(ctx, "WEBSOCKET/CONNECTION/"+connectionID, "CHANNEL/")
+	if err != nil {
+		return fmt.Errorf("failed to get subscriptions of %s: %w", connectionID, err)
+	}
+	for _, channel := range channels {
+		if err = c.Unsubscribe(ctx, connectionID, channel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Subscribers returns the IDs of the connections subscribed to the channel.
+func (c *Connections) Subscribers(ctx context.Context, channel string) (connectionIDs []string, err error) {
+	connectionIDs, err = c.query(ctx, "WEBSOCKET/CHANNEL/"+channel, "CONNECTION/")
+	if err != nil {
+		err = fmt.Errorf("failed to get subscribers of %s: %w", channel, err)
+	}
+	return
+}
+
+// query returns the sort keys of the unexpired records in the partition, without the
+// prefix.
+func (c *Connections) query(ctx context.Context, pk, prefix string) (values []string, err error) {
+	qi := &dynamodb.QueryInput{
+		TableName:              aws.String(c.TableName),
+		KeyConditionExpression: aws.String("#_pk = :_pk AND begins_with(#_sk, :_sk)"),
+		FilterExpression:       aws.String("#_ttl >= :_now"),
+		ExpressionAttributeNames: map[string]string{
+			"#_pk":  "_pk",
+			"#_sk":  "_sk",
+			"#_ttl": "_ttl",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":_pk":  &types.AttributeValueMemberS{Value: pk},
+			":_sk":  &types.AttributeValueMemberS{Value: prefix},
+			":_now": &types.AttributeValueMemberN{Value: strconv.FormatInt(c.Clock.Now().Unix(), 10)},
+		},
+		ConsistentRead: aws.Bool(true),
+	}
+	pages := dynamodb.NewQueryPaginator(c.Client, qi)
+	for pages.HasMorePages() {
+		var page *dynamodb.QueryOutput
+		page, err = pages.NextPage(ctx)
+		if err != nil {
+			return
+		}
+		for _, item := range page.Items {
+			if sk, ok := item["_sk"].(*types.AttributeValueMemberS); ok {
+				values = append(values, strings.TrimPrefix(sk.Value, prefix))
+			}
+		}
+	}
+	return
+}
+
+// ErrGone is returned by ManagementAPI.PostToConnection if the client has disconnected.
+var ErrGone = errors.New("the connection is gone")
+
+// ManagementAPI posts data to a WebSocket connection, e.g. using the PostToConnection
+// method of the github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi client, with
+// the API's endpoint. It returns ErrGone if the client returned a GoneException.
+type ManagementAPI interface {
+	PostToConnection(ctx context.Context, connectionID string, data []byte) error
+}
+
+// Pusher pushes messages to the connections subscribed to a channel. It implements
+// handler.RealtimeAPI, using the topic as the channel, so that the stream handler pushes
+// each outbound event to the clients subscribed to the entity that produced it.
+type Pusher struct {
+	Connections *Connections
+	API         ManagementAPI
+}
+
+// NewPusher creates a Pusher.
+func NewPusher(connections *Connections, api ManagementAPI) *Pusher {
+	return &Pusher{
+		Connections: connections,
+		API:         api,
+	}
+}
+
+// Publish the payload of the input to each connection subscribed to its topic.
+func (p *Pusher) Publish(ctx context.Context, input *iotdataplane.PublishInput, _ ...func(*iotdataplane.Options)) (*iotdataplane.PublishOutput, error) {
+	if err := p.Push(ctx, aws.ToString(input.Topic), input.Payload); err != nil {
+		return nil, err
+	}
+	return &iotdataplane.PublishOutput{}, nil
+}
+
+// Push the payload to each connection subscribed to the channel. Connections that have
+// gone are disconnected.
+func (p *Pusher) Push(ctx context.Context, channel string, payload []byte) (err error) {
+	connectionIDs, err := p.Connections.Subscribers(ctx, channel)
+	if err != nil {
+		return
+	}
+	var errs []error
+	for _, id := range connectionIDs {
+		perr := p.API.PostToConnection(ctx, id, payload)
+		if errors.Is(perr, ErrGone) {
+			perr = p.Connections.Disconnect(ctx, id)
+		}
+		if perr != nil {
+			errs = append(errs, fmt.Errorf("failed to post to %s: %w", id, perr))
+		}
+	}
+	return multierr.Combine(errs...)
+}
+
+// Request is the body of messages sent by clients to subscribe to, or unsubscribe from, a
+// channel, routed using the $request.body.action route selection expression.
+//
+//	{"action": "subscribe", "channel": "SlotMachine/123"}
+type Request struct {
+	Action  string `json:"action"`
+	Channel string `json:"channel"`
+}
+
+// Authorizer returns an error if the client isn't allowed to subscribe to the channel.
+type Authorizer func(ctx context.Context, request events.APIGatewayWebsocketProxyRequest, channel string) error
+
+// AllowAll is an Authorizer that allows any client to subscribe to any channel, e.g. for
+// public data, or APIs that authorize clients when they connect.
+func AllowAll(ctx context.Context, request events.APIGatewayWebsocketProxyRequest, channel string) error {
+	return nil
+}
+
+// Handler handles the $disconnect, subscribe and unsubscribe routes of an API Gateway
+// WebSocket API.
+type Handler struct {
+	Connections *Connections
+	// Authorize is called before a client subscribes to a channel. If it's nil, all
+	// subscriptions are denied, since channels can contain other tenants' entities. Use
+	// AllowAll to allow any client to subscribe to any channel.
+	Authorize Authorizer
+}
+
+// NewHandler creates a Handler that stores subscriptions in connections, and checks each
+// subscription with authorize.
+func NewHandler(connections *Connections, authorize Authorizer) *Handler {
+	return &Handler{
+		Connections: connections,
+		Authorize:   authorize,
+	}
+}
+
+// HandleRequest handles a WebSocket route.
+func (h *Handler) HandleRequest(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+	connectionID := request.RequestContext.ConnectionID
+	if request.RequestContext.RouteKey == "$disconnect" {
+		if err := h.Connections.Disconnect(ctx, connectionID); err != nil {
+			return response(http.StatusInternalServerError), err
+		}
+		return response(http.StatusOK), nil
+	}
+	if request.RequestContext.RouteKey == "$connect" {
+		return response(http.StatusOK), nil
+	}
+	var r Request
+	if err := json.Unmarshal([]byte(request.Body), &r); err != nil || r.Channel == "" {
+		return response(http.StatusBadRequest), nil
+	}
+	switch r.Action {
+	case "subscribe":
+		if h.Authorize == nil {
+			return response(http.StatusForbidden), nil
+		}
+		if err := h.Authorize(ctx, request, r.Channel); err != nil {
+			return response(http.StatusForbidden), nil
+		}
+		if err := h.Connections.Subscribe(ctx, connectionID, r.Channel); err != nil {
+			return response(http.StatusInternalServerError), err
+		}
+	case "unsubscribe":
+		if err := h.Connections.Unsubscribe(ctx, connectionID, r.Channel); err != nil {
+			return response(http.StatusInternalServerError), err
+		}
+	default:
+		return response(http.StatusBadRequest), nil
+	}
+	return response(http.StatusOK), nil
+}
+
+func response(status int) events.APIGatewayProxyResponse {
+	return events.APIGatewayProxyResponse{StatusCode: status}
+}
@@ -0,0 +1,238 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a-h/stream"
+	"github.com/a-h/stream/handler"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/iotdataplane"
+	"github.com/google/go-cmp/cmp"
+)
+
+// memoryDynamoDB stores items by partition and sort key.
+type memoryDynamoDB struct {
+	items map[string]map[string]map[string]types.AttributeValue
+}
+
+func keys(item map[string]types.AttributeValue) (pk, sk string) {
+	return item["_pk"].(*types.AttributeValueMemberS).Value, item["_sk"].(*types.AttributeValueMemberS).Value
+}
+
+func (db *memoryDynamoDB) PutItem(_ context.Context, input *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	pk, sk := keys(input.Item)
+	if db.items[pk] == nil {
+		db.items[pk] = make(map[string]map[string]types.AttributeValue)
+	}
+	db.items[pk][sk] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (db *memoryDynamoDB) DeleteItem(_ context.Context, input *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	pk, sk := keys(input.Key)
+	delete(db.items[pk], sk)
+	if len(db.items[pk]) == 0 {
+		delete(db.items, pk)
+	}
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (db *memoryDynamoDB) Query(_ context.Context, input *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	pk := input.ExpressionAttributeValues[":_pk"].(*types.AttributeValueMemberS).Value
+	prefix := input.ExpressionAttributeValues[":_sk"].(*types.AttributeValueMemberS).Value
+	now, _ := strconv.ParseInt(input.ExpressionAttributeValues[":_now"].(*types.AttributeValueMemberN).Value, 10, 64)
+	var sks []string
+	for sk, item := range db.items[pk] {
+		ttl, _ := strconv.ParseInt(item["_ttl"].(*types.AttributeValueMemberN).Value, 10, 64)
+		if strings.HasPrefix(sk, prefix) && ttl >= now {
+			sks = append(sks, sk)
+		}
+	}
+	sort.Strings(sks)
+	var output dynamodb.QueryOutput
+	for _, sk := range sks {
+		output.Items = append(output.Items, db.items[pk][sk])
+	}
+	return &output, nil
+}
+
+// mockManagementAPI records the data posted to each connection.
+type mockManagementAPI struct {
+	gone   map[string]bool
+	posted map[string][]string
+}
+
+func (m *mockManagementAPI) PostToConnection(ctx context.Context, connectionID string, data []byte) error {
+	if m.gone[connectionID] {
+		return ErrGone
+	}
+	m.posted[connectionID] = append(m.posted[connectionID], string(data))
+	return nil
+}
+
+func request(routeKey, connectionID, body string) events.APIGatewayWebsocketProxyRequest {
+	return events.APIGatewayWebsocketProxyRequest{
+		Body: body,
+		RequestContext: events.APIGatewayWebsocketProxyRequestContext{
+			RouteKey:     routeKey,
+			ConnectionID: connectionID,
+		},
+	}
+}
+
+func TestHandler(t *testing.T) {
+	// Arrange.
+	connections := NewConnections(&memoryDynamoDB{items: map[string]map[string]map[string]types.AttributeValue{}}, "table")
+	h := NewHandler(connections, func(ctx context.Context, request events.APIGatewayWebsocketProxyRequest, channel string) error {
+		if strings.HasPrefix(channel, "Private/") {
+			return errors.New("forbidden")
+		}
+		return nil
+	})
+	ctx := context.Background()
+	requests := []events.APIGatewayWebsocketProxyRequest{
+		request("$connect", "a", ""),
+		request("subscribe", "a", `{"action":"subscribe","channel":"SlotMachine/1"}`),
+		request("subscribe", "a", `{"action":"subscribe","channel":"SlotMachine/2"}`),
+		request("subscribe", "b", `{"action":"subscribe","channel":"SlotMachine/1"}`),
+		request("subscribe", "c", `{"action":"subscribe","channel":"SlotMachine/1"}`),
+		request("unsubscribe", "c", `{"action":"unsubscribe","channel":"SlotMachine/1"}`),
+		request("subscribe", "c", `{"action":"subscribe","channel":"Private/1"}`),
+		request("subscribe", "c", `{"action":"subscribe"}`),
+		request("$disconnect", "b", ""),
+	}
+
+	// Act.
+	var statuses []int
+	for _, r := range requests {
+		resp, err := h.HandleRequest(ctx, r)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		statuses = append(statuses, resp.StatusCode)
+	}
+
+	// Assert.
+	expectedStatuses := []int{200, 200, 200, 200, 200, 200, http.StatusForbidden, http.StatusBadRequest, 200}
+	if diff := cmp.Diff(expectedStatuses, statuses); diff != "" {
+		t.Errorf("unexpected statuses: %s", diff)
+	}
+	for channel, expected := range map[string][]string{
+		"SlotMachine/1": {"a"},
+		"SlotMachine/2": {"a"},
+		"Private/1":     nil,
+	} {
+		actual, err := connections.Subscribers(ctx, channel)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Errorf("unexpected subscribers of %s: %s", channel, diff)
+		}
+	}
+}
+
+func TestSubscriptionsExpire(t *testing.T) {
+	// Arrange.
+	now := time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+	connections := NewConnections(&memoryDynamoDB{items: map[string]map[string]map[string]types.AttributeValue{}}, "table")
+	connections.Clock = stream.ClockFunc(func() time.Time { return now })
+	ctx := context.Background()
+	if err := connections.Subscribe(ctx, "a", "SlotMachine/1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Act.
+	now = now.Add(3 * time.Hour)
+	actual, err := connections.Subscribers(ctx, "SlotMachine/1")
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(actual) != 0 {
+		t.Errorf("expected expired subscriptions to be ignored, got %v", actual)
+	}
+}
+
+var _ handler.RealtimeAPI = &Pusher{}
+
+func TestPusher(t *testing.T) {
+	// Arrange.
+	db := &memoryDynamoDB{items: map[string]map[string]map[string]types.AttributeValue{}}
+	connections := NewConnections(db, "table")
+	ctx := context.Background()
+	for _, id := range []string{"a", "b", "gone"} {
+		if err := connections.Subscribe(ctx, id, "SlotMachine/1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := connections.Subscribe(ctx, "c", "SlotMachine/2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	api := &mockManagementAPI{gone: map[string]bool{"gone": true}, posted: map[string][]string{}}
+	p := NewPusher(connections, api)
+
+	// Act.
+	_, err := p.Publish(ctx, &iotdataplane.PublishInput{
+		Topic:   aws.String("SlotMachine/1"),
+		Payload: []byte(`{"detailType":"CoinInserted"}`),
+	})
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string][]string{
+		"a": {`{"detailType":"CoinInserted"}`},
+		"b": {`{"detailType":"CoinInserted"}`},
+	}
+	if diff := cmp.Diff(expected, api.posted); diff != "" {
+		t.Errorf("unexpected posts: %s", diff)
+	}
+	subscribers, err := connections.Subscribers(ctx, "SlotMachine/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"a", "b"}, subscribers); diff != "" {
+		t.Errorf("expected gone connections to be removed: %s", diff)
+	}
+	if _, ok := db.items["WEBSOCKET/CONNECTION/gone"]; ok {
+		t.Error("expected the subscriptions of the gone connection to be removed")
+	}
+}
+
+func TestHandlerDeniesSubscriptionsWithoutAnAuthorizer(t *testing.T) {
+	// Arrange.
+	connections := NewConnections(&memoryDynamoDB{items: map[string]map[string]map[string]types.AttributeValue{}}, "table")
+	h := NewHandler(connections, nil)
+	ctx := context.Background()
+
+	// Act.
+	resp, err := h.HandleRequest(ctx, request("subscribe", "a", `{"action":"subscribe","channel":"SlotMachine/1"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Assert.
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d", http.StatusForbidden, resp.StatusCode)
+	}
+	subscribers, err := connections.Subscribers(ctx, "SlotMachine/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(subscribers) > 0 {
+		t.Errorf("expected no subscribers, got %v", subscribers)
+	}
+}